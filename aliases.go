@@ -0,0 +1,113 @@
+package bramble
+
+import (
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// The aliases starting with a single underscore are reserved for the fields
+// injected by the planner (e.g. "_id", "_typename", the join keys and the
+// required fields) and the boundary queries ("_0", "_result"). The client
+// aliases starting with an underscore are escaped by appending an underscore
+// before the operation is planned, so they never clash with them, and
+// unescaped in the response. The leading underscore is replaced with another
+// prefix for the services rejecting it, see ServiceAliases.
+
+// isReservedAlias returns whether the alias starts with a single underscore
+func isReservedAlias(alias string) bool {
+	return len(alias) > 1 && alias[0] == '_' && alias[1] != '_'
+}
+
+// escapeAlias returns the alias to use in the queries sent to the services
+// for a client alias
+func escapeAlias(alias string) string {
+	if isReservedAlias(alias) {
+		return alias + "_"
+	}
+	return alias
+}
+
+// unescapeAlias returns the client alias of an escaped alias
+func unescapeAlias(alias string) string {
+	if isReservedAlias(alias) {
+		return strings.TrimSuffix(alias, "_")
+	}
+	return alias
+}
+
+// unescapePath returns the path with the client aliases
+func unescapePath(path ast.Path) ast.Path {
+	var result ast.Path
+	for i, elem := range path {
+		name, ok := elem.(ast.PathName)
+		if !ok || !isReservedAlias(string(name)) {
+			if result != nil {
+				result = append(result, elem)
+			}
+			continue
+		}
+		if result == nil {
+			result = append(make(ast.Path, 0, len(path)), path[:i]...)
+		}
+		result = append(result, ast.PathName(unescapeAlias(string(name))))
+	}
+	if result == nil {
+		return path
+	}
+	return result
+}
+
+// escapeOperationAliases returns the operation with the reserved client
+// aliases escaped. The operation can be shared with the cached operations,
+// the selection sets are copied if they need to be modified.
+func escapeOperationAliases(op *ast.OperationDefinition) *ast.OperationDefinition {
+	selectionSet, escaped := escapeSelectionSetAliases(op.SelectionSet)
+	if !escaped {
+		return op
+	}
+	result := *op
+	result.SelectionSet = selectionSet
+	return &result
+}
+
+func escapeSelectionSetAliases(selectionSet ast.SelectionSet) (ast.SelectionSet, bool) {
+	var result ast.SelectionSet
+	for i, selection := range selectionSet {
+		escaped := selection
+		switch selection := selection.(type) {
+		case *ast.Field:
+			subSelectionSet, subEscaped := escapeSelectionSetAliases(selection.SelectionSet)
+			if subEscaped || isReservedAlias(selection.Alias) {
+				field := *selection
+				field.Alias = escapeAlias(selection.Alias)
+				field.SelectionSet = subSelectionSet
+				escaped = &field
+			}
+		case *ast.InlineFragment:
+			if subSelectionSet, subEscaped := escapeSelectionSetAliases(selection.SelectionSet); subEscaped {
+				fragment := *selection
+				fragment.SelectionSet = subSelectionSet
+				escaped = &fragment
+			}
+		case *ast.FragmentSpread:
+			if subSelectionSet, subEscaped := escapeSelectionSetAliases(selection.Definition.SelectionSet); subEscaped {
+				definition := *selection.Definition
+				definition.SelectionSet = subSelectionSet
+				spread := *selection
+				spread.Definition = &definition
+				escaped = &spread
+			}
+		}
+		if escaped != selection && result == nil {
+			result = append(make(ast.SelectionSet, 0, len(selectionSet)), selectionSet[:i]...)
+		}
+		if result != nil {
+			result = append(result, escaped)
+		}
+	}
+	if result == nil {
+		return selectionSet, false
+	}
+	return result, true
+}
@@ -0,0 +1,57 @@
+package bramble
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestEscapeOperationAliases(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+	type Movie { id: ID! title: String! }
+	type Query { movie: Movie! movies: [Movie!]! }
+	`})
+
+	t.Run("without reserved aliases", func(t *testing.T) {
+		query := gqlparser.MustLoadQuery(schema, `{ movie { __typename id title: id } }`)
+		op := query.Operations[0]
+		assert.Same(t, op, escapeOperationAliases(op))
+	})
+
+	t.Run("with reserved aliases", func(t *testing.T) {
+		query := gqlparser.MustLoadQuery(schema, `
+		{
+			movie { _id: title id }
+			movies { ... on Movie { _typename: title } ...F }
+		}
+		fragment F on Movie { _id_: id }`)
+		op := query.Operations[0]
+		original := formatSelectionSetSingleLine(testContextWithoutVariables(op), nil, op.SelectionSet)
+
+		escaped := escapeOperationAliases(op)
+		assert.Equal(t, "{ movie { _id_: title id } movies { ... on Movie { _typename_: title } ...F } }", formatSelectionSetSingleLine(testContextWithoutVariables(escaped), nil, escaped.SelectionSet))
+		spread := escaped.SelectionSet[1].(*ast.Field).SelectionSet[1].(*ast.FragmentSpread)
+		assert.Equal(t, "_id__", spread.Definition.SelectionSet[0].(*ast.Field).Alias)
+
+		// the cached operation isn't modified
+		assert.Equal(t, original, formatSelectionSetSingleLine(testContextWithoutVariables(op), nil, op.SelectionSet))
+		assert.Equal(t, "_id_", query.Fragments.ForName("F").SelectionSet[0].(*ast.Field).Alias)
+	})
+}
+
+func TestUnescapeAlias(t *testing.T) {
+	for _, alias := range []string{"id", "__typename", "_id", "_id_", "_0", "a_"} {
+		assert.Equal(t, alias, unescapeAlias(escapeAlias(alias)))
+	}
+	assert.Equal(t, "_id_", escapeAlias("_id"))
+	assert.Equal(t, "__typename", escapeAlias("__typename"))
+}
+
+func TestUnescapePath(t *testing.T) {
+	path := ast.Path{ast.PathName("movies"), ast.PathIndex(0), ast.PathName("_id_")}
+	assert.Equal(t, ast.Path{ast.PathName("movies"), ast.PathIndex(0), ast.PathName("_id")}, unescapePath(path))
+	assert.Equal(t, ast.PathName("_id_"), path[2])
+	assert.Equal(t, ast.Path{ast.PathName("movies")}, unescapePath(ast.Path{ast.PathName("movies")}))
+}
@@ -0,0 +1,306 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// boundaryBatchKey identifies the child steps that can be batched together:
+// the steps querying the same boundary type of the same service
+type boundaryBatchKey struct {
+	serviceURL string
+	parentType string
+}
+
+// executeChildSteps executes the child steps of a step. With boundary query
+// batching, the sibling steps querying the same boundary type of the same
+// service are sent in a single request. The child steps aren't started once
+// the execution is cancelled (e.g. the client disconnected).
+func (e *QueryExecution) executeChildSteps(ctx context.Context, steps []*QueryPlanStep, result map[string]interface{}) {
+	if ctx.Err() != nil {
+		return
+	}
+	groups := make(map[boundaryBatchKey][]*QueryPlanStep)
+	var keys []boundaryBatchKey
+	for _, step := range steps {
+		if !e.boundaryBatching || step.Join != nil || step.ServiceURL == internalServiceName {
+			e.wg.Add(1)
+			go e.executeChildStep(ctx, step, result, nil)
+			continue
+		}
+		key := boundaryBatchKey{serviceURL: step.ServiceURL, parentType: step.ParentType}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], step)
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) == 1 {
+			e.wg.Add(1)
+			go e.executeChildStep(ctx, group[0], result, nil)
+			continue
+		}
+		batch := newBoundaryBatch(len(group))
+		for i, step := range group {
+			e.wg.Add(1)
+			go e.executeChildStep(ctx, step, result, batch.participant(i))
+		}
+	}
+}
+
+// boundaryBatch merges the boundary queries of several child steps in a
+// single document. The first step submitting its query sends the document
+// once every step has either submitted its query or left the batch (e.g.
+// because it has nothing to query).
+type boundaryBatch struct {
+	mu      sync.Mutex
+	pending int
+	fields  []string
+	// joined is the number of steps that joined the batch with join
+	joined int
+	// ready is closed once all the steps submitted their query or left
+	ready chan struct{}
+	// done is closed once the response is received
+	done chan struct{}
+	data map[string]json.RawMessage
+	err  error
+}
+
+func newBoundaryBatch(size int) *boundaryBatch {
+	return &boundaryBatch{
+		pending: size,
+		ready:   make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (b *boundaryBatch) participant(i int) *boundaryBatchParticipant {
+	return &boundaryBatchParticipant{
+		batch:  b,
+		prefix: fmt.Sprintf("%s%d", boundaryBatchAliasPrefix, i),
+	}
+}
+
+// join adds a step to the batch, the step must submit its query or leave
+func (b *boundaryBatch) join() *boundaryBatchParticipant {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending++
+	b.joined++
+	return b.participant(b.joined - 1)
+}
+
+// boundaryBatchAliasPrefix prefixes the aliases of the boundary queries of
+// each step in the batched document
+const boundaryBatchAliasPrefix = "_b"
+
+// boundaryBatchParticipant is a child step part of a batch, a nil participant
+// sends its requests directly
+type boundaryBatchParticipant struct {
+	batch  *boundaryBatch
+	prefix string
+	once   sync.Once
+}
+
+// aliasPrefix returns the prefix of the step aliases in the batched document
+func (p *boundaryBatchParticipant) aliasPrefix() string {
+	if p == nil {
+		return ""
+	}
+	return p.prefix
+}
+
+// leave removes the step from the batch if it didn't submit its query
+func (p *boundaryBatchParticipant) leave() {
+	if p == nil {
+		return
+	}
+	p.once.Do(func() {
+		p.batch.mu.Lock()
+		defer p.batch.mu.Unlock()
+		p.batch.pending--
+		if p.batch.pending == 0 {
+			close(p.batch.ready)
+			if len(p.batch.fields) == 0 {
+				close(p.batch.done)
+			}
+		}
+	})
+}
+
+// childStepRequest sends the request of a child step. For batched steps the
+// query is submitted to the batch and the step part of the batched response
+// is decoded into resp. The query must be a selection set of aliased boundary
+// queries.
+func (e *QueryExecution) childStepRequest(ctx context.Context, step *QueryPlanStep, p *boundaryBatchParticipant, req *Request, resp interface{}) error {
+	if p == nil {
+		return e.request(ctx, step, req, resp)
+	}
+
+	b := p.batch
+	var sender bool
+	p.once.Do(func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		sender = len(b.fields) == 0
+		b.fields = append(b.fields, strings.TrimSuffix(strings.TrimPrefix(req.Query, "{"), "}"))
+		b.pending--
+		if b.pending == 0 {
+			close(b.ready)
+		}
+	})
+
+	if sender {
+		<-b.ready
+		b.mu.Lock()
+		req.Query = "{" + strings.Join(b.fields, " ") + "}"
+		b.mu.Unlock()
+		var data map[string]json.RawMessage
+		b.err = e.request(ctx, step, req, &data)
+		b.data = data
+		close(b.done)
+	}
+	<-b.done
+
+	data, err := p.response(b.data, b.err)
+	if len(data) > 0 {
+		buf, jsonErr := json.Marshal(data)
+		if jsonErr == nil {
+			jsonErr = json.Unmarshal(buf, resp)
+		}
+		if jsonErr != nil && err == nil {
+			err = fmt.Errorf("error decoding response: %w", jsonErr)
+		}
+	}
+	return err
+}
+
+// response returns the part of the batched response and errors of the step,
+// with the aliases and error paths of its own query
+func (p *boundaryBatchParticipant) response(data map[string]json.RawMessage, err error) (map[string]json.RawMessage, error) {
+	res := make(map[string]json.RawMessage)
+	for alias, value := range data {
+		if original, ok := p.originalAlias(alias); ok {
+			res[original] = value
+		}
+	}
+
+	var gqlErrs GraphqlErrors
+	if !errors.As(err, &gqlErrs) {
+		return res, err
+	}
+	var errs GraphqlErrors
+	for _, ge := range gqlErrs {
+		if len(ge.Path) > 0 {
+			if name, ok := ge.Path[0].(ast.PathName); ok && strings.HasPrefix(string(name), boundaryBatchAliasPrefix) {
+				original, ok := p.originalAlias(string(name))
+				if !ok {
+					// error of another step
+					continue
+				}
+				ge.Path = append(ast.Path{ast.PathName(original)}, ge.Path[1:]...)
+			}
+		}
+		errs = append(errs, ge)
+	}
+	if len(errs) == 0 {
+		return res, nil
+	}
+	return res, errs
+}
+
+// originalAlias returns the alias in the step query of an alias of the
+// batched document, if it belongs to the step
+func (p *boundaryBatchParticipant) originalAlias(alias string) (string, bool) {
+	if !strings.HasPrefix(alias, p.prefix) {
+		return "", false
+	}
+	original := strings.TrimPrefix(alias, p.prefix)
+	// "_b1_0" belongs to step 1, "_b10_0" to step 10
+	if !strings.HasPrefix(original, "_") {
+		return "", false
+	}
+	return original, true
+}
+
+// maxSubscriptionBatchSize is the maximum number of child steps of
+// subscription events batched together, a new batch is opened once a batch is
+// full
+const maxSubscriptionBatchSize = 100
+
+// subscriptionBatchKey identifies the child steps of subscription events that
+// can be batched together: the steps querying the same boundary type of the
+// same service with the same headers
+type subscriptionBatchKey struct {
+	boundaryBatchKey
+	headers string
+}
+
+// subscriptionBatches batches the child steps of the concurrent subscription
+// events (e.g. the same event delivered to several subscribers): the steps
+// querying the same boundary type of the same service within the batch window
+// are sent in a single request, with the context of the first step. It is
+// safe for concurrent use.
+type subscriptionBatches struct {
+	mu   sync.Mutex
+	open map[subscriptionBatchKey]*boundaryBatch
+}
+
+func newSubscriptionBatches() *subscriptionBatches {
+	return &subscriptionBatches{
+		open: make(map[subscriptionBatchKey]*boundaryBatch),
+	}
+}
+
+// join adds the step to the open batch of its service, type and headers. A
+// batch is opened for the window if there is none, its request is sent once
+// the window is over and all its steps submitted their query. The step must
+// submit its query right away.
+func (s *subscriptionBatches) join(window time.Duration, step *QueryPlanStep, header http.Header) *boundaryBatchParticipant {
+	if s == nil || window <= 0 {
+		return nil
+	}
+
+	key := subscriptionBatchKey{
+		boundaryBatchKey: boundaryBatchKey{serviceURL: step.ServiceURL, parentType: step.ParentType},
+		headers:          headersKey(header),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.open[key]
+	if !ok {
+		// the window is a participant of the batch, leaving once it's over
+		b = newBoundaryBatch(1)
+		w := &boundaryBatchParticipant{batch: b}
+		s.open[key] = b
+		time.AfterFunc(window, func() {
+			s.close(key, b)
+			w.leave()
+		})
+	}
+	p := b.join()
+	if b.joined >= maxSubscriptionBatchSize {
+		delete(s.open, key)
+	}
+	return p
+}
+
+// close stops adding steps to the batch
+func (s *subscriptionBatches) close(key subscriptionBatchKey, b *boundaryBatch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.open[key] == b {
+		delete(s.open, key)
+	}
+}
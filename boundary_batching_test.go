@@ -0,0 +1,256 @@
+package bramble
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+var boundaryBatchingTestQuery = regexp.MustCompile(`(\w+): node\(id: "(\w+)"\)`)
+
+func newBoundaryBatchingFixture(producer string, requests *int64) *queryExecutionFixture {
+	return &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Person @boundary {
+					id: ID!
+				}
+
+				type Movie {
+					id: ID!
+					director: Person!
+					producer: Person
+				}
+
+				type Query {
+					movie(id: ID!): Movie!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					fmt.Fprintf(w, `{ "data": { "movie": { "id": "1", "director": { "_id": "1", "id": "1" }, "producer": { "_id": %[1]q, "id": %[1]q } } } }`, producer)
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+
+				type Person @boundary {
+					id: ID!
+					name: String
+				}
+
+				type Query {
+					node(id: ID!): Node
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt64(requests, 1)
+					body, _ := ioutil.ReadAll(r.Body)
+					var req Request
+					_ = json.Unmarshal(body, &req)
+
+					data := map[string]interface{}{}
+					var errs []map[string]interface{}
+					for _, m := range boundaryBatchingTestQuery.FindAllStringSubmatch(req.Query, -1) {
+						if m[2] == "unknown" {
+							data[m[1]] = nil
+							errs = append(errs, map[string]interface{}{"message": "person not found", "path": []string{m[1]}})
+							continue
+						}
+						data[m[1]] = map[string]interface{}{"_id": m[2], "name": "Person " + m[2]}
+					}
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data, "errors": errs})
+				}),
+			},
+		},
+		query: `{
+			movie(id: "1") {
+				id
+				director { id name }
+				producer { id name }
+			}
+		}`,
+	}
+}
+
+func TestBoundaryQueryBatching(t *testing.T) {
+	t.Run("sibling steps are sent in a single request", func(t *testing.T) {
+		var requests int64
+		f := newBoundaryBatchingFixture("2", &requests)
+		f.boundaryBatching = true
+		f.expected = `{
+			"movie": {
+				"id": "1",
+				"director": { "id": "1", "name": "Person 1" },
+				"producer": { "id": "2", "name": "Person 2" }
+			}
+		}`
+		f.run(t)
+		assert.Equal(t, int64(1), requests)
+	})
+
+	t.Run("sibling steps are sent separately without batching", func(t *testing.T) {
+		var requests int64
+		f := newBoundaryBatchingFixture("2", &requests)
+		f.expected = `{
+			"movie": {
+				"id": "1",
+				"director": { "id": "1", "name": "Person 1" },
+				"producer": { "id": "2", "name": "Person 2" }
+			}
+		}`
+		f.run(t)
+		assert.Equal(t, int64(2), requests)
+	})
+
+	t.Run("errors are reported on their step", func(t *testing.T) {
+		var requests int64
+		f := newBoundaryBatchingFixture("unknown", &requests)
+		f.boundaryBatching = true
+		f.errors = gqlerror.List{{
+			Message:   "person not found",
+			Path:      ast.Path{ast.PathName("movie"), ast.PathName("producer")},
+			Locations: []gqlerror.Location{{Line: 5, Column: 19}},
+			Extensions: map[string]interface{}{
+				"selectionSet": "{ _id: id name }",
+				"serviceName":  "",
+			},
+		}}
+		f.run(t)
+		assert.Equal(t, int64(1), requests)
+		assert.JSONEq(t, `{
+			"movie": {
+				"id": "1",
+				"director": { "id": "1", "name": "Person 1" },
+				"producer": { "id": "unknown", "name": null }
+			}
+		}`, string(f.resp.Data))
+	})
+}
+
+func TestBoundaryBatchParticipantResponse(t *testing.T) {
+	b := newBoundaryBatch(11)
+	p1, p10 := b.participant(1), b.participant(10)
+	data := map[string]json.RawMessage{
+		"_b1_0":       json.RawMessage(`{"id": "a"}`),
+		"_b10_0":      json.RawMessage(`{"id": "b"}`),
+		"_b10_result": json.RawMessage(`[]`),
+	}
+	errs := GraphqlErrors{
+		{Message: "step 1", Path: ast.Path{ast.PathName("_b1_0"), ast.PathName("name")}},
+		{Message: "step 10", Path: ast.Path{ast.PathName("_b10_0")}},
+		{Message: "no path"},
+	}
+
+	res, err := p1.response(data, errs)
+	assert.Equal(t, map[string]json.RawMessage{"_0": json.RawMessage(`{"id": "a"}`)}, res)
+	require.IsType(t, GraphqlErrors{}, err)
+	assert.Equal(t, GraphqlErrors{
+		{Message: "step 1", Path: ast.Path{ast.PathName("_0"), ast.PathName("name")}},
+		{Message: "no path"},
+	}, err)
+
+	res, err = p10.response(data, errs)
+	assert.Len(t, res, 2)
+	assert.Contains(t, res, "_result")
+	assert.Len(t, err, 2)
+}
+
+func TestSubscriptionEventsBatching(t *testing.T) {
+	var requests int64
+	services := []testService{
+		{
+			schema: `directive @boundary on OBJECT
+			type Movie @boundary {
+				id: ID!
+			}
+
+			type Query {
+				movie(id: ID!): Movie
+			}
+
+			type Subscription {
+				movieReleased: Movie!
+			}`,
+			handler: http.NotFoundHandler(),
+		},
+		{
+			schema: `directive @boundary on OBJECT
+			interface Node { id: ID! }
+
+			type Movie @boundary {
+				id: ID!
+				title: String!
+			}
+
+			type Query {
+				node(id: ID!): Node
+			}`,
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt64(&requests, 1)
+				body, _ := ioutil.ReadAll(r.Body)
+				var req Request
+				_ = json.Unmarshal(body, &req)
+				data := map[string]interface{}{}
+				for _, m := range boundaryBatchingTestQuery.FindAllStringSubmatch(req.Query, -1) {
+					data[m[1]] = map[string]interface{}{"_id": m[2], "title": "Movie " + m[2]}
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+			}),
+		},
+	}
+
+	var schemas []*ast.Schema
+	var svcs []*Service
+	for _, s := range services {
+		srv := httptest.NewServer(s.handler)
+		defer srv.Close()
+		schema := gqlparser.MustLoadSchema(&ast.Source{Input: s.schema})
+		schemas = append(schemas, schema)
+		svcs = append(svcs, &Service{ServiceURL: srv.URL, Schema: schema})
+	}
+	merged, err := MergeSchemas(schemas...)
+	require.NoError(t, err)
+
+	es := newExecutableSchema(nil, 50, nil, svcs...)
+	es.MergedSchema = merged
+	es.BoundaryQueries = buildBoundaryQueriesMap(svcs...)
+	es.Locations = buildFieldURLMap(svcs...)
+	es.IsBoundary = buildIsBoundaryMap(svcs...)
+	es.PublicSchema = buildPublicSchema(merged)
+	es.SubscriptionBatchWindow = 50 * time.Millisecond
+
+	op := gqlparser.MustLoadQuery(merged, `subscription { movieReleased { title } }`).Operations[0]
+	var wg sync.WaitGroup
+	responses := make([]string, 3)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			event := subscriptionEvent{Data: map[string]json.RawMessage{
+				"movieReleased": json.RawMessage(fmt.Sprintf(`{ "_id": "%d" }`, i)),
+			}}
+			resp := es.ExecuteQuery(withSubscriptionEvent(testContextWithVariables(map[string]interface{}{}, op), event))
+			assert.Empty(t, resp.Errors)
+			responses[i] = string(resp.Data)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(1), requests)
+	for i, resp := range responses {
+		assert.JSONEq(t, fmt.Sprintf(`{ "movieReleased": { "title": "Movie %d" } }`, i), resp)
+	}
+}
@@ -0,0 +1,161 @@
+package bramble
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+)
+
+// BoundaryCacheConfig configures the cache of the boundary lookups
+type BoundaryCacheConfig struct {
+	// MaxEntries is the number of entities kept in the cache, the cache is
+	// disabled if 0
+	MaxEntries int `json:"max-entries"`
+	// TTLs are the durations the entities are cached for, by type name. They
+	// override the TTLs declared with @boundary(cacheTTL: "...") on the
+	// boundary queries.
+	TTLs map[string]string `json:"ttls"`
+
+	ttlDurations map[string]time.Duration
+}
+
+func (c *BoundaryCacheConfig) parse() error {
+	if c.MaxEntries < 0 {
+		return errors.New("invalid boundary cache: max-entries must be positive")
+	}
+	c.ttlDurations = make(map[string]time.Duration, len(c.TTLs))
+	for typeName, ttl := range c.TTLs {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return fmt.Errorf("invalid boundary cache TTL for type %q: %w", typeName, err)
+		}
+		c.ttlDurations[typeName] = d
+	}
+	return nil
+}
+
+// boundaryCache returns the boundary cache described by the config, or nil if
+// it's disabled
+func (c BoundaryCacheConfig) boundaryCache() *BoundaryCache {
+	if c.MaxEntries == 0 {
+		return nil
+	}
+	return NewBoundaryCache(c.MaxEntries, c.ttlDurations)
+}
+
+// BoundaryCache caches the results of the boundary lookups by service, type,
+// id, selection set and headers, so the entities rarely changing don't need
+// to be fetched from their service for every query. Only the types with a TTL
+// are cached. A nil BoundaryCache caches nothing. It is safe for concurrent
+// use.
+type BoundaryCache struct {
+	entries graphql.Cache
+	ttls    map[string]time.Duration
+	now     func() time.Time
+}
+
+type boundaryCacheEntry struct {
+	fields  []byte
+	expires time.Time
+}
+
+// NewBoundaryCache returns a cache of at most maxEntries entities. The TTLs by
+// type name override the TTLs of the boundary queries.
+func NewBoundaryCache(maxEntries int, ttls map[string]time.Duration) *BoundaryCache {
+	return &BoundaryCache{
+		entries: lru.New(maxEntries),
+		ttls:    ttls,
+		now:     time.Now,
+	}
+}
+
+// ttl returns the duration the results of the step are cached for, 0 if they
+// aren't cached. The steps with required fields aren't cached as their
+// results depend on the required values.
+func (c *BoundaryCache) ttl(step *QueryPlanStep, query BoundaryQuery) time.Duration {
+	if c == nil || len(step.Requires) > 0 {
+		return 0
+	}
+	if ttl, ok := c.ttls[step.ParentType]; ok {
+		return ttl
+	}
+	return query.CacheTTL
+}
+
+// boundaryCacheKey returns the key of the entity with the given id fetched by
+// the step with the given selection set and headers. The headers (e.g. the
+// Authorization header of the caller) are part of the key as the fields
+// resolved by the service may depend on them.
+func boundaryCacheKey(step *QueryPlanStep, header http.Header, selectionSet, id string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s", step.ServiceURL, step.ParentType, id, selectionSet, headersKey(header))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get decodes the cached fields of the entity into v, it returns false if the
+// entity isn't cached or expired
+func (c *BoundaryCache) get(ctx context.Context, key string, v interface{}) bool {
+	cached, ok := c.entries.Get(ctx, key)
+	if !ok {
+		return false
+	}
+	entry := cached.(boundaryCacheEntry)
+	if !c.now().Before(entry.expires) {
+		return false
+	}
+	return json.Unmarshal(entry.fields, v) == nil
+}
+
+// add caches the fields of the entity, the null entities aren't cached
+func (c *BoundaryCache) add(ctx context.Context, key string, fields interface{}, ttl time.Duration) {
+	b, err := json.Marshal(fields)
+	if err != nil || string(b) == "null" {
+		return
+	}
+	c.entries.Add(ctx, key, boundaryCacheEntry{fields: b, expires: c.now().Add(ttl)})
+}
+
+// insertCachedBoundaryResults inserts the cached entities into their targets
+// and returns the targets missing from the cache
+func (e *QueryExecution) insertCachedBoundaryResults(ctx context.Context, step *QueryPlanStep, selectionSet string, targets []insertionTarget) []insertionTarget {
+	// the steps without children keep the fields as returned, like
+	// executeChildStep
+	raw := len(step.Then) == 0 || e.rawJSON
+	header := GetOutgoingServiceRequestHeadersFromContext(ctx, step.ServiceURL)
+	var missing []insertionTarget
+	for _, target := range targets {
+		key := boundaryCacheKey(step, header, selectionSet, target.ID)
+		fields := map[string]interface{}{}
+		var ok bool
+		if raw {
+			var rawFields map[string]json.RawMessage
+			if ok = e.boundaryCache.get(ctx, key, &rawFields); ok {
+				for k, v := range rawFields {
+					fields[k] = v
+				}
+			}
+		} else {
+			ok = e.boundaryCache.get(ctx, key, &fields)
+		}
+		if !ok {
+			missing = append(missing, target)
+			continue
+		}
+		e.m.Lock()
+		for k, v := range fields {
+			target.Target[k] = v
+		}
+		e.m.Unlock()
+	}
+	promBoundaryCacheHits.WithLabelValues(step.ServiceName, step.ParentType).Add(float64(len(targets) - len(missing)))
+	promBoundaryCacheMisses.WithLabelValues(step.ServiceName, step.ParentType).Add(float64(len(missing)))
+	return missing
+}
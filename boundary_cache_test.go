@@ -0,0 +1,153 @@
+package bramble
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestBoundaryCacheConfig(t *testing.T) {
+	assert.Nil(t, BoundaryCacheConfig{TTLs: map[string]string{"Currency": "1h"}}.boundaryCache())
+
+	c := BoundaryCacheConfig{MaxEntries: 10, TTLs: map[string]string{"Currency": "1h"}}
+	require.NoError(t, c.parse())
+	cache := c.boundaryCache()
+	require.NotNil(t, cache)
+	assert.Equal(t, time.Hour, cache.ttl(&QueryPlanStep{ParentType: "Currency"}, BoundaryQuery{CacheTTL: time.Minute}))
+	assert.Equal(t, time.Minute, cache.ttl(&QueryPlanStep{ParentType: "Country"}, BoundaryQuery{CacheTTL: time.Minute}))
+	assert.Equal(t, time.Duration(0), cache.ttl(&QueryPlanStep{ParentType: "Country"}, BoundaryQuery{}))
+	assert.Equal(t, time.Duration(0), cache.ttl(&QueryPlanStep{ParentType: "Currency", Requires: []string{"rate"}}, BoundaryQuery{}))
+
+	c = BoundaryCacheConfig{MaxEntries: 10, TTLs: map[string]string{"Currency": "forever"}}
+	assert.EqualError(t, c.parse(), `invalid boundary cache TTL for type "Currency": time: invalid duration "forever"`)
+
+	c = BoundaryCacheConfig{MaxEntries: -1}
+	assert.EqualError(t, c.parse(), "invalid boundary cache: max-entries must be positive")
+}
+
+func TestBoundaryCacheExpiration(t *testing.T) {
+	now := time.Now()
+	cache := NewBoundaryCache(10, nil)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	var fields map[string]interface{}
+	assert.False(t, cache.get(ctx, "a", &fields))
+
+	cache.add(ctx, "a", map[string]interface{}{"code": "NZD"}, time.Minute)
+	cache.add(ctx, "b", map[string]interface{}(nil), time.Minute)
+	require.True(t, cache.get(ctx, "a", &fields))
+	assert.Equal(t, map[string]interface{}{"code": "NZD"}, fields)
+	assert.False(t, cache.get(ctx, "b", &fields))
+
+	now = now.Add(time.Minute)
+	assert.False(t, cache.get(ctx, "a", &fields))
+}
+
+func TestQueryExecutionBoundaryCache(t *testing.T) {
+	var requests int64
+	services := []testService{
+		{
+			schema: `directive @boundary on OBJECT
+			type Country @boundary {
+				id: ID!
+			}
+
+			type Movie {
+				id: ID!
+				countries: [Country!]!
+			}
+
+			type Query {
+				movie(id: ID!): Movie!
+			}`,
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{ "data": { "movie": { "id": "1", "countries": [{ "_id": "NZ" }, { "_id": "FR" }] } } }`))
+			}),
+		},
+		{
+			schema: `directive @boundary(cacheTTL: String) on OBJECT | FIELD_DEFINITION
+			type Country @boundary {
+				id: ID!
+				name: String!
+				code: String!
+			}
+
+			type Query {
+				countries(ids: [ID!]): [Country]! @boundary(cacheTTL: "1h")
+			}`,
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt64(&requests, 1)
+				w.Write([]byte(`{ "data": { "_result": [{ "_id": "NZ", "name": "New Zealand", "code": "NZ" }, { "_id": "FR", "name": "France", "code": "FR" }] } }`))
+			}),
+		},
+	}
+
+	var schemas []*ast.Schema
+	var svcs []*Service
+	for _, s := range services {
+		srv := httptest.NewServer(s.handler)
+		defer srv.Close()
+		schema := gqlparser.MustLoadSchema(&ast.Source{Input: s.schema})
+		schemas = append(schemas, schema)
+		svcs = append(svcs, &Service{ServiceURL: srv.URL, Schema: schema})
+	}
+	merged, err := MergeSchemas(schemas...)
+	require.NoError(t, err)
+
+	now := time.Now()
+	es := newExecutableSchema(nil, 50, nil, svcs...)
+	es.MergedSchema = merged
+	es.BoundaryQueries = buildBoundaryQueriesMap(svcs...)
+	es.Locations = buildFieldURLMap(svcs...)
+	es.IsBoundary = buildIsBoundaryMap(svcs...)
+	es.PublicSchema = buildPublicSchema(merged)
+	es.BoundaryCache = NewBoundaryCache(10, nil)
+	es.BoundaryCache.now = func() time.Time { return now }
+
+	execute := func(query string) string {
+		op := gqlparser.MustLoadQuery(merged, query).Operations[0]
+		resp := es.ExecuteQuery(testContextWithVariables(map[string]interface{}{}, op))
+		require.Empty(t, resp.Errors)
+		return string(resp.Data)
+	}
+
+	expected := `{ "movie": { "countries": [{ "name": "New Zealand" }, { "name": "France" }] } }`
+	assert.JSONEq(t, expected, execute(`{ movie(id: "1") { countries { name } } }`))
+	assert.JSONEq(t, expected, execute(`{ movie(id: "1") { countries { name } } }`))
+	assert.Equal(t, int64(1), requests)
+
+	// a different selection set isn't cached
+	assert.JSONEq(t, `{ "movie": { "countries": [{ "code": "NZ" }, { "code": "FR" }] } }`, execute(`{ movie(id: "1") { countries { code } } }`))
+	assert.Equal(t, int64(2), requests)
+
+	now = now.Add(time.Hour)
+	assert.JSONEq(t, expected, execute(`{ movie(id: "1") { countries { name } } }`))
+	assert.Equal(t, int64(3), requests)
+
+	// the entities fetched with the headers of a caller aren't returned to
+	// the other callers, the request ID isn't part of the key
+	executeAs := func(authorization, requestID string) string {
+		op := gqlparser.MustLoadQuery(merged, `{ movie(id: "1") { countries { name } } }`).Operations[0]
+		ctx := testContextWithVariables(map[string]interface{}{}, op)
+		ctx = AddOutgoingRequestsHeaderToContext(ctx, "Authorization", authorization)
+		ctx = AddOutgoingRequestsHeaderToContext(ctx, "X-Request-Id", requestID)
+		resp := es.ExecuteQuery(ctx)
+		require.Empty(t, resp.Errors)
+		return string(resp.Data)
+	}
+	assert.JSONEq(t, expected, executeAs("Bearer a", "1"))
+	assert.Equal(t, int64(4), requests)
+	assert.JSONEq(t, expected, executeAs("Bearer b", "2"))
+	assert.Equal(t, int64(5), requests)
+	assert.JSONEq(t, expected, executeAs("Bearer a", "3"))
+	assert.Equal(t, int64(5), requests)
+}
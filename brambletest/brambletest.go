@@ -0,0 +1,288 @@
+// Package brambletest runs a Bramble gateway federating fake services, to
+// write integration and contract tests against the gateway.
+//
+//	gateway := brambletest.NewGateway(t, []brambletest.Service{
+//		{
+//			Name:    "movies",
+//			Schema:  moviesSchema,
+//			Handler: brambletest.Respond(`{ "data": { "movie": { "id": "1", "title": "Inception" } } }`),
+//		},
+//	})
+//	gateway.Query(`{ movie(id: "1") { title } }`, nil).AssertData(t, `{ "movie": { "title": "Inception" } }`)
+package brambletest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/movio/bramble"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+const (
+	serviceType  = "type Service {\n\tname: String!\n\tversion: String!\n\tschema: String!\n}\n"
+	serviceField = "extend type Query {\n\tservice: Service!\n}\n"
+)
+
+// Service is a fake service federated by the test gateway
+type Service struct {
+	// Name is the name of the service
+	Name string
+	// Schema is the SDL of the service. The Service type and the service
+	// query field are added if it doesn't define them.
+	Schema string
+	// Handler receives the queries of the gateway, except the service query
+	// which is answered with the schema.
+	Handler http.Handler
+}
+
+// Respond returns a handler replying to every query with the given JSON
+// response
+func Respond(response string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(response))
+	})
+}
+
+// Gateway is a Bramble gateway federating fake services, the services are
+// stopped at the end of the test
+type Gateway struct {
+	*bramble.Gateway
+
+	t        testing.TB
+	services map[string]string
+}
+
+// NewGateway starts the fake services and returns a gateway federating them,
+// the test fails if their schemas can't be merged.
+func NewGateway(t testing.TB, services []Service, opts ...bramble.GatewayOpt) *Gateway {
+	t.Helper()
+
+	g := &Gateway{
+		t:        t,
+		services: make(map[string]string),
+	}
+	var urls []string
+	for _, s := range services {
+		server := NewService(t, s)
+		g.services[server.URL] = s.Name
+		urls = append(urls, server.URL)
+	}
+
+	gtw, err := bramble.New(append([]bramble.GatewayOpt{bramble.WithServices(urls...)}, opts...)...)
+	require.NoError(t, err)
+	g.Gateway = gtw
+	return g
+}
+
+// NewService starts the fake service, e.g. to federate it in a gateway
+// configured by the test. It is stopped at the end of the test.
+func NewService(t testing.TB, s Service) *httptest.Server {
+	t.Helper()
+
+	handler, err := newServiceHandler(s)
+	require.NoError(t, err, "invalid service %q", s.Name)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Query runs the query through the gateway
+func (g *Gateway) Query(query string, variables map[string]interface{}) *Response {
+	g.t.Helper()
+
+	body, err := json.Marshal(bramble.Request{Query: query, Variables: variables})
+	require.NoError(g.t, err)
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return g.Do(req)
+}
+
+// Do sends the request to the gateway, e.g. to set headers. The query plan
+// is always requested.
+func (g *Gateway) Do(req *http.Request) *Response {
+	g.t.Helper()
+
+	req.Header.Set("X-Bramble-Debug", strings.TrimSpace(req.Header.Get("X-Bramble-Debug")+" plan"))
+	rec := httptest.NewRecorder()
+	g.ServeHTTP(rec, req)
+
+	var result struct {
+		Data       json.RawMessage `json:"data"`
+		Errors     gqlerror.List   `json:"errors"`
+		Extensions struct {
+			Plan struct {
+				RootSteps []*PlanStep
+			} `json:"plan"`
+		} `json:"extensions"`
+	}
+	require.NoError(g.t, json.Unmarshal(rec.Body.Bytes(), &result), "invalid response: %s", rec.Body.String())
+
+	resp := &Response{
+		StatusCode: rec.Code,
+		Header:     rec.Header(),
+		Data:       result.Data,
+		Errors:     result.Errors,
+		Plan:       result.Extensions.Plan.RootSteps,
+	}
+	g.nameSteps(resp.Plan)
+	return resp
+}
+
+func (g *Gateway) nameSteps(steps []*PlanStep) {
+	for _, step := range steps {
+		step.Service = g.services[step.ServiceURL]
+		g.nameSteps(step.Then)
+	}
+}
+
+// Response is the response of the gateway
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Data       json.RawMessage
+	Errors     gqlerror.List
+	// Plan are the root steps of the query plan
+	Plan []*PlanStep
+}
+
+// PlanStep is a step of the query plan, i.e. a request to a service
+type PlanStep struct {
+	// Service is the name of the service, empty if it's not a fake service
+	Service        string `json:"-"`
+	ServiceURL     string
+	ParentType     string
+	SelectionSet   string
+	InsertionPoint []string
+	Then           []*PlanStep
+}
+
+// AssertData checks that the query succeeded and returned the expected data
+func (r *Response) AssertData(t testing.TB, expected string) bool {
+	t.Helper()
+	return assert.Empty(t, r.Errors) && assert.JSONEq(t, expected, string(r.Data))
+}
+
+// AssertErrors checks the messages of the errors, in order
+func (r *Response) AssertErrors(t testing.TB, messages ...string) bool {
+	t.Helper()
+	var actual []string
+	for _, err := range r.Errors {
+		actual = append(actual, err.Message)
+	}
+	return assert.Equal(t, messages, actual)
+}
+
+// AssertPlanServices checks the services queried by the plan, the services of
+// every level of the plan are listed in order, e.g. ["movies", "people"]
+// for a plan querying the movies then the people service
+func (r *Response) AssertPlanServices(t testing.TB, services ...string) bool {
+	t.Helper()
+	var actual []string
+	steps := r.Plan
+	for len(steps) > 0 {
+		var next []*PlanStep
+		for _, step := range steps {
+			actual = append(actual, step.Service)
+			next = append(next, step.Then...)
+		}
+		steps = next
+	}
+	return assert.Equal(t, services, actual)
+}
+
+// newServiceHandler returns the handler of the fake service, answering the
+// service query with its schema
+func newServiceHandler(s Service) (http.Handler, error) {
+	schema, err := serviceSchema(s.Schema)
+	if err != nil {
+		return nil, err
+	}
+	serviceResponse, err := json.Marshal(map[string]interface{}{
+		"data": map[string]interface{}{
+			"service": map[string]string{
+				"name":    s.Name,
+				"version": "test",
+				"schema":  schema,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req bramble.Request
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if isServiceQuery(req.Query) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(serviceResponse)
+			return
+		}
+		if s.Handler == nil {
+			http.Error(w, fmt.Sprintf("service %q has no handler", s.Name), http.StatusInternalServerError)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		s.Handler.ServeHTTP(w, r)
+	}), nil
+}
+
+// serviceSchema adds the Service type and the service query field to the
+// schema if they are missing
+func serviceSchema(schema string) (string, error) {
+	doc, err := parser.ParseSchema(&ast.Source{Input: schema})
+	if err != nil {
+		return "", err
+	}
+	hasType, hasField := false, false
+	for _, def := range append(doc.Definitions, doc.Extensions...) {
+		switch def.Name {
+		case "Service":
+			hasType = true
+		case "Query":
+			hasField = hasField || def.Fields.ForName("service") != nil
+		}
+	}
+	if !hasType {
+		schema += "\n" + serviceType
+	}
+	if !hasField {
+		schema += "\n" + serviceField
+	}
+	return schema, nil
+}
+
+// isServiceQuery returns whether the query is the service query of the
+// gateway
+func isServiceQuery(query string) bool {
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	if err != nil || len(doc.Operations) != 1 || doc.Operations[0].Operation != ast.Query {
+		return false
+	}
+	for _, selection := range doc.Operations[0].SelectionSet {
+		if field, ok := selection.(*ast.Field); ok && field.Name == "service" {
+			return true
+		}
+	}
+	return false
+}
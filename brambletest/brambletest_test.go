@@ -0,0 +1,108 @@
+package brambletest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/movio/bramble"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestGateway(t *testing.T) *Gateway {
+	return NewGateway(t, []Service{
+		{
+			Name: "movies",
+			Schema: `
+			directive @boundary on OBJECT | FIELD_DEFINITION
+			type Person @boundary { id: ID! }
+			type Movie { id: ID! title: String! director: Person }
+			type Query {
+				movie(id: ID!): Movie
+				person(id: ID!): Person @boundary
+			}`,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req bramble.Request
+				_ = json.NewDecoder(r.Body).Decode(&req)
+				switch {
+				case !strings.Contains(req.Query, "director"):
+					w.Write([]byte(`{ "data": { "movie": { "title": "Inception" } } }`))
+				case strings.Contains(req.Query, "unknown"):
+					w.Write([]byte(`{ "data": { "movie": { "title": "Inception", "director": { "_id": "unknown" } } } }`))
+				default:
+					w.Write([]byte(`{ "data": { "movie": { "title": "Inception", "director": { "_id": "1" } } } }`))
+				}
+			}),
+		},
+		{
+			Name: "people",
+			Schema: `
+			directive @boundary on OBJECT | FIELD_DEFINITION
+			type Service { name: String! version: String! schema: String! }
+			type Person @boundary { id: ID! name: String }
+			type Query {
+				person(id: ID!): Person @boundary
+				service: Service!
+			}`,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req bramble.Request
+				_ = json.NewDecoder(r.Body).Decode(&req)
+				if strings.Contains(req.Query, "unknown") {
+					w.Write([]byte(`{ "errors": [{ "message": "unknown person" }] }`))
+					return
+				}
+				w.Write([]byte(`{ "data": { "_0": { "_id": "1", "name": "Christopher Nolan" } } }`))
+			}),
+		},
+	})
+}
+
+func TestGateway(t *testing.T) {
+	gateway := newTestGateway(t)
+
+	t.Run("data and plan", func(t *testing.T) {
+		resp := gateway.Query(`query Movie($id: ID!) { movie(id: $id) { title director { name } } }`, map[string]interface{}{"id": "1"})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.AssertData(t, `{ "movie": { "title": "Inception", "director": { "name": "Christopher Nolan" } } }`)
+		resp.AssertPlanServices(t, "movies", "people")
+		assert.Equal(t, "Person", resp.Plan[0].Then[0].ParentType)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		resp := gateway.Query(`{ movie(id: "unknown") { title director { name } } }`, nil)
+		resp.AssertErrors(t, "unknown person")
+		assert.JSONEq(t, `{ "movie": { "title": "Inception", "director": { "name": null } } }`, string(resp.Data))
+	})
+
+	t.Run("custom request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{ "query": "{ movie(id: \"1\") { title } }" }`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := gateway.Do(req)
+		resp.AssertData(t, `{ "movie": { "title": "Inception" } }`)
+		resp.AssertPlanServices(t, "movies")
+	})
+}
+
+func TestServiceSchema(t *testing.T) {
+	schema, err := serviceSchema(`type Query { movie: String }`)
+	assert.NoError(t, err)
+	assert.Contains(t, schema, serviceType)
+	assert.Contains(t, schema, serviceField)
+
+	schema, err = serviceSchema(`type Service { name: String! } type Query { service: Service! }`)
+	assert.NoError(t, err)
+	assert.Equal(t, `type Service { name: String! } type Query { service: Service! }`, schema)
+
+	_, err = serviceSchema(`type Query {`)
+	assert.Error(t, err)
+}
+
+func TestIsServiceQuery(t *testing.T) {
+	assert.True(t, isServiceQuery(`{ service { name version schema } }`))
+	assert.True(t, isServiceQuery(`query brambleServicePoll { service { name } }`))
+	assert.False(t, isServiceQuery(`{ services { name } }`))
+	assert.False(t, isServiceQuery(`{ movie(id: "service") { title } }`))
+	assert.False(t, isServiceQuery(`mutation { service { name } }`))
+}
@@ -0,0 +1,105 @@
+package bramble
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// canaryHeader is the request header forcing the requests to the listed
+// services (comma-separated service names) to their canary
+const canaryHeader = "X-Bramble-Canary"
+
+const (
+	primaryVariant = "primary"
+	canaryVariant  = "canary"
+)
+
+// ServiceCanary is a canary version of a service, a percentage of the
+// requests to the service are routed to it
+type ServiceCanary struct {
+	URL string `json:"url"`
+	// Percentage of the plan steps of the service routed to the canary,
+	// between 0 and 100
+	Percentage float64 `json:"percentage"`
+}
+
+// Validate checks the URL is set and the percentage is valid
+func (c ServiceCanary) Validate() error {
+	if c.URL == "" {
+		return errors.New("canary url is required")
+	}
+	if c.Percentage < 0 || c.Percentage > 100 {
+		return errors.New("canary percentage must be between 0 and 100")
+	}
+	return nil
+}
+
+// canaryMiddleware adds the services whose requests are forced to their canary
+// by the X-Bramble-Canary header to the context
+func canaryMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var services []string
+		for _, value := range r.Header.Values(canaryHeader) {
+			for _, service := range strings.Split(value, ",") {
+				if service = strings.TrimSpace(service); service != "" {
+					services = append(services, service)
+				}
+			}
+		}
+		if len(services) > 0 {
+			r = r.WithContext(AddForcedCanariesToContext(r.Context(), services...))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// AddForcedCanariesToContext forces the requests to the given services (by
+// name) to be routed to their canary
+func AddForcedCanariesToContext(ctx context.Context, services ...string) context.Context {
+	existing, _ := ctx.Value(canaryContextKey).(map[string]bool)
+	forced := make(map[string]bool, len(existing)+len(services))
+	for service := range existing {
+		forced[service] = true
+	}
+	for _, service := range services {
+		forced[service] = true
+	}
+	return context.WithValue(ctx, canaryContextKey, forced)
+}
+
+func canaryForced(ctx context.Context, service string) bool {
+	forced, _ := ctx.Value(canaryContextKey).(map[string]bool)
+	return forced[service]
+}
+
+// canaryRoute returns the variant of the service the request of the step is
+// routed to and, for the canary, its URL. The variant is empty if the service
+// has no canary, otherwise it's added to the request log.
+func (e *QueryExecution) canaryRoute(ctx context.Context, step *QueryPlanStep) (string, string) {
+	canary, ok := e.serviceCanaries[step.ServiceURL]
+	if !ok {
+		return "", ""
+	}
+	if canaryForced(ctx, step.ServiceName) || rand.Float64()*100 < canary.Percentage {
+		AddField(ctx, "variant."+step.ServiceName, canaryVariant)
+		return canaryVariant, canary.URL
+	}
+	AddField(ctx, "variant."+step.ServiceName, primaryVariant)
+	return primaryVariant, ""
+}
+
+// observeVariantRequest records the request to a variant of a service
+func observeVariantRequest(step *QueryPlanStep, variant string, start time.Time, err error) {
+	if variant == "" {
+		return
+	}
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	promServiceVariantRequestDurations.WithLabelValues(step.ServiceName, variant, status).Observe(time.Since(start).Seconds())
+}
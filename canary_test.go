@@ -0,0 +1,95 @@
+package bramble
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+)
+
+func newCanaryTestService(t *testing.T, variant string, calls *int32) *httptest.Server {
+	t.Helper()
+	return newTestService(t, "movies", `type Service { name: String! version: String! schema: String! } type Query { service: Service! variant: String! }`, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		fmt.Fprintf(w, `{ "data": { "variant": %q } }`, variant)
+	})
+}
+
+func TestServiceCanary(t *testing.T) {
+	var primaryCalls, canaryCalls int32
+	primary := newCanaryTestService(t, "primary", &primaryCalls)
+	canary := newCanaryTestService(t, "canary", &canaryCalls)
+
+	es := newExecutableSchema(nil, 50, nil, NewService(primary.URL))
+	require.NoError(t, es.UpdateSchema(true))
+
+	query := func(forceCanary bool) string {
+		t.Helper()
+		doc := gqlparser.MustLoadQuery(es.MergedSchema, "{ variant }")
+		ctx := testContextWithVariables(nil, doc.Operations[0])
+		if forceCanary {
+			ctx = AddForcedCanariesToContext(ctx, "movies")
+		}
+		resp := es.ExecuteQuery(ctx)
+		require.Empty(t, resp.Errors)
+		var data struct{ Variant string }
+		require.NoError(t, json.Unmarshal(resp.Data, &data))
+		return data.Variant
+	}
+
+	t.Run("no canary", func(t *testing.T) {
+		assert.Equal(t, "primary", query(false))
+	})
+
+	t.Run("percentage of the steps routed to the canary", func(t *testing.T) {
+		atomic.StoreInt32(&primaryCalls, 0)
+		atomic.StoreInt32(&canaryCalls, 0)
+		es.ServiceCanaries = map[string]ServiceCanary{primary.URL: {URL: canary.URL, Percentage: 50}}
+		for i := 0; i < 200; i++ {
+			query(false)
+		}
+		assert.InDelta(t, 100, atomic.LoadInt32(&canaryCalls), 40)
+		assert.Equal(t, int32(200), atomic.LoadInt32(&primaryCalls)+atomic.LoadInt32(&canaryCalls))
+
+		es.ServiceCanaries = map[string]ServiceCanary{primary.URL: {URL: canary.URL, Percentage: 100}}
+		assert.Equal(t, "canary", query(false))
+	})
+
+	t.Run("forced canary", func(t *testing.T) {
+		es.ServiceCanaries = map[string]ServiceCanary{primary.URL: {URL: canary.URL, Percentage: 0}}
+		assert.Equal(t, "primary", query(false))
+		assert.Equal(t, "canary", query(true))
+	})
+}
+
+func TestCanaryMiddleware(t *testing.T) {
+	var forced map[string]bool
+	handler := canaryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forced = map[string]bool{
+			"service-a": canaryForced(r.Context(), "service-a"),
+			"service-b": canaryForced(r.Context(), "service-b"),
+			"service-c": canaryForced(r.Context(), "service-c"),
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	req.Header.Add(canaryHeader, "service-a, service-b")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, map[string]bool{"service-a": true, "service-b": true, "service-c": false}, forced)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/query", nil))
+	assert.Equal(t, map[string]bool{"service-a": false, "service-b": false, "service-c": false}, forced)
+}
+
+func TestServiceCanaryValidate(t *testing.T) {
+	assert.NoError(t, ServiceCanary{URL: "http://movies-canary/query", Percentage: 5}.Validate())
+	assert.Error(t, ServiceCanary{Percentage: 5}.Validate())
+	assert.Error(t, ServiceCanary{URL: "http://movies-canary/query", Percentage: 101}.Validate())
+	assert.Error(t, ServiceCanary{URL: "http://movies-canary/query", Percentage: -1}.Validate())
+}
@@ -0,0 +1,136 @@
+package bramble
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// SchemaCheckResult is the result of a schema compatibility check
+type SchemaCheckResult struct {
+	// Whether the candidate schema would merge cleanly with the other services
+	Valid bool `json:"valid"`
+	// Errors found in the candidate schema itself (parsing and validation)
+	Errors []string `json:"errors"`
+	// Conflicts between the candidate schema and the other services' schemas
+	Conflicts []SchemaConflict `json:"conflicts"`
+	// Breaking changes between the current merged schema and the merged
+	// schema that would result from the candidate schema
+	BreakingChanges []SchemaChange `json:"breakingChanges"`
+	// Resulting merged schema, in SDL format
+	MergedSchema string `json:"mergedSchema,omitempty"`
+}
+
+// SchemaConflict is a conflict between the candidate schema and the schema of
+// an existing service.
+type SchemaConflict struct {
+	TypeName string `json:"typeName"`
+	Service  string `json:"service"`
+	Message  string `json:"message"`
+}
+
+// CheckSchema reports whether the candidate schema would merge cleanly with
+// the schemas of the currently federated services, without modifying the
+// executable schema.
+// The service argument is the URL or name of the service the candidate schema
+// is for. If it matches an existing service, the candidate schema replaces the
+// service's current schema.
+func (s *ExecutableSchema) CheckSchema(service, candidate string) SchemaCheckResult {
+	var result SchemaCheckResult
+
+	candidateSchema, gqlErr := gqlparser.LoadSchema(&ast.Source{Name: service, Input: candidate})
+	if gqlErr != nil {
+		result.Errors = append(result.Errors, gqlErr.Error())
+		return result
+	}
+
+	if err := ValidateSchema(candidateSchema); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+
+	s.mutex.RLock()
+	currentSchema := s.MergedSchema
+	var others []*Service
+	for _, svc := range s.Services {
+		if svc.Schema == nil || svc.ServiceURL == service || (svc.Name != "" && svc.Name == service) {
+			continue
+		}
+		others = append(others, svc)
+	}
+	s.mutex.RUnlock()
+
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].ServiceURL < others[j].ServiceURL
+	})
+
+	result.Conflicts = schemaConflicts(candidateSchema, others)
+
+	merged, err := MergeServiceSchemas(append([]*Service{{Name: service, Schema: candidateSchema}}, others...)...)
+	if err != nil {
+		// conflicts were already reported individually, only report the merge
+		// error if it wasn't caught
+		if len(result.Conflicts) == 0 {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		return result
+	}
+
+	result.BreakingChanges = BreakingChanges(currentSchema, merged)
+	result.MergedSchema = formatSchema(merged)
+	result.Valid = len(result.Errors) == 0 && len(result.Conflicts) == 0
+
+	return result
+}
+
+// schemaConflicts merges every type of the candidate schema with the same type
+// from each service and returns the list of conflicts.
+func schemaConflicts(candidate *ast.Schema, services []*Service) []SchemaConflict {
+	var conflicts []SchemaConflict
+
+	candidateTypes, err := mergeTypes(candidate.Types, nil)
+	if err != nil {
+		return nil
+	}
+
+	for _, svc := range services {
+		serviceTypes, err := mergeTypes(svc.Schema.Types, nil)
+		if err != nil {
+			continue
+		}
+
+		serviceName := svc.Name
+		if serviceName == "" {
+			serviceName = svc.ServiceURL
+		}
+
+		for _, name := range sortedTypeNames(candidate) {
+			if isGraphQLBuiltinName(name) {
+				continue
+			}
+			candidateType, ok := candidateTypes[name]
+			if !ok {
+				continue
+			}
+			serviceType, ok := serviceTypes[name]
+			if !ok {
+				continue
+			}
+			if _, err := mergeTypeDefinitions(svc.Schema.Types, candidate.Types, serviceType, candidateType); err != nil {
+				conflicts = append(conflicts, SchemaConflict{
+					TypeName: name,
+					Service:  serviceName,
+					Message:  err.Error(),
+				})
+			}
+		}
+	}
+
+	return conflicts
+}
+
+// Error returns a string representation of the conflict
+func (c SchemaConflict) Error() string {
+	return fmt.Sprintf("conflict with service %q on type %s: %s", c.Service, c.TypeName, c.Message)
+}
@@ -0,0 +1,175 @@
+package bramble
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func newCheckSchemaTestExecutableSchema(t *testing.T, schemas map[string]string) *ExecutableSchema {
+	var services []*Service
+	var astSchemas []*ast.Schema
+	for name, schema := range schemas {
+		s := gqlparser.MustLoadSchema(&ast.Source{Name: name, Input: schema})
+		services = append(services, &Service{
+			ServiceURL:   "http://" + name,
+			Name:         name,
+			SchemaSource: schema,
+			Schema:       s,
+		})
+		astSchemas = append(astSchemas, s)
+	}
+	merged, err := MergeSchemas(astSchemas...)
+	require.NoError(t, err)
+
+	es := newExecutableSchema(nil, 50, nil, services...)
+	es.MergedSchema = merged
+	return es
+}
+
+func TestCheckSchema(t *testing.T) {
+	es := newCheckSchemaTestExecutableSchema(t, map[string]string{
+		"movies": `
+			directive @boundary on OBJECT | FIELD_DEFINITION
+
+			type Service {
+				name: String!
+				version: String!
+				schema: String!
+			}
+
+			type Movie @boundary {
+				id: ID!
+				title: String!
+			}
+
+			type Query {
+				service: Service!
+				movie(id: ID!): Movie! @boundary
+			}`,
+		"gizmos": `
+			type Service {
+				name: String!
+				version: String!
+				schema: String!
+			}
+
+			type Gizmo {
+				id: ID!
+				name: String!
+			}
+
+			type Query {
+				service: Service!
+				gizmo(id: ID!): Gizmo!
+			}`,
+	})
+
+	t.Run("valid schema", func(t *testing.T) {
+		result := es.CheckSchema("compta", `
+			directive @boundary on OBJECT | FIELD_DEFINITION
+
+			type Service {
+				name: String!
+				version: String!
+				schema: String!
+			}
+
+			type Movie @boundary {
+				id: ID!
+				compTitles: [String!]!
+			}
+
+			type Query {
+				service: Service!
+				movieWithComps(id: ID!): Movie @boundary
+			}`)
+
+		assert.True(t, result.Valid)
+		assert.Empty(t, result.Errors)
+		assert.Empty(t, result.Conflicts)
+		assert.Empty(t, result.BreakingChanges)
+		assert.Contains(t, result.MergedSchema, "compTitles")
+	})
+
+	t.Run("invalid schema", func(t *testing.T) {
+		result := es.CheckSchema("invalid", `type Query { foo: Bar! }`)
+
+		assert.False(t, result.Valid)
+		assert.NotEmpty(t, result.Errors)
+	})
+
+	t.Run("conflicting types", func(t *testing.T) {
+		result := es.CheckSchema("conflicts", `
+			type Service {
+				name: String!
+				version: String!
+				schema: String!
+			}
+
+			type Movie {
+				id: ID!
+				title: String!
+			}
+
+			type Gizmo {
+				id: ID!
+			}
+
+			type Query {
+				service: Service!
+				gizmo2(id: ID!): Gizmo!
+				movie2(id: ID!): Movie!
+			}`)
+
+		assert.False(t, result.Valid)
+		assert.Equal(t, []SchemaConflict{
+			{
+				TypeName: "Gizmo",
+				Service:  "gizmos",
+				Message:  "conflicting shared type: Gizmo (field name is missing from one of the definitions)",
+			},
+			{
+				TypeName: "Movie",
+				Service:  "movies",
+				Message:  "conflicting non boundary type: Movie",
+			},
+		}, result.Conflicts)
+	})
+
+	t.Run("breaking changes", func(t *testing.T) {
+		result := es.CheckSchema("gizmos", `
+			type Service {
+				name: String!
+				version: String!
+				schema: String!
+			}
+
+			type Gizmo {
+				id: ID!
+				name: String
+			}
+
+			type Query {
+				service: Service!
+				gizmo(id: ID!, size: Int!): Gizmo!
+			}`)
+
+		assert.True(t, result.Valid)
+		assert.Equal(t, []SchemaChange{
+			{
+				Criticality: ChangeBreaking,
+				Path:        "Gizmo.name",
+				Message:     "field Gizmo.name changed type from String! to String",
+			},
+			{
+				Criticality: ChangeBreaking,
+				Path:        "Query.gizmo(size:)",
+				Message:     "required argument Query.gizmo(size:) was added",
+			},
+		}, result.BreakingChanges)
+	})
+}
@@ -2,17 +2,19 @@ package bramble
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/vektah/gqlparser/v2/ast"
 )
 
 // GraphQLClient is a GraphQL client.
@@ -21,6 +23,26 @@ type GraphQLClient struct {
 	MaxResponseSize int64
 	Tracer          opentracing.Tracer
 	UserAgent       string
+	// Transports override the transport of the HTTP client for the
+	// configured services
+	Transports *Transports
+	// Credentials authenticate the requests to the configured services
+	Credentials *Credentials
+	// Signer signs the requests to the configured services
+	Signer *RequestSigner
+	// Recording records the requests and their responses, or replays the
+	// recorded responses
+	Recording *Recording
+	// Aliases translates the reserved aliases of the requests to the
+	// configured services
+	Aliases *ServiceAliases
+	// CompressRequestsMinSize enables the compression of the requests of at
+	// least this size to the services advertising support, with the
+	// Accept-Encoding header of their responses. 0 disables it.
+	CompressRequestsMinSize int
+
+	// requestEncodings are the encodings accepted by the services, by URL
+	requestEncodings sync.Map
 }
 
 // ClientOpt is a function used to set a GraphQL client option
@@ -51,6 +73,49 @@ func WithMaxResponseSize(maxResponseSize int64) ClientOpt {
 	}
 }
 
+// WithTransports sets the transports of the requests to the services.
+func WithTransports(transports *Transports) ClientOpt {
+	return func(s *GraphQLClient) {
+		s.Transports = transports
+	}
+}
+
+// WithCredentials sets the credentials of the requests to the services.
+func WithCredentials(credentials *Credentials) ClientOpt {
+	return func(s *GraphQLClient) {
+		s.Credentials = credentials
+	}
+}
+
+// WithRequestSigner sets the signer of the requests to the services.
+func WithRequestSigner(signer *RequestSigner) ClientOpt {
+	return func(s *GraphQLClient) {
+		s.Signer = signer
+	}
+}
+
+// WithRecording sets the recording of the requests to the services.
+func WithRecording(recording *Recording) ClientOpt {
+	return func(s *GraphQLClient) {
+		s.Recording = recording
+	}
+}
+
+// WithServiceAliases sets the alias prefixes of the requests to the services.
+func WithServiceAliases(aliases *ServiceAliases) ClientOpt {
+	return func(s *GraphQLClient) {
+		s.Aliases = aliases
+	}
+}
+
+// WithRequestCompression enables the compression of the requests of at least
+// minSize bytes to the services accepting compressed requests.
+func WithRequestCompression(minSize int) ClientOpt {
+	return func(s *GraphQLClient) {
+		s.CompressRequestsMinSize = minSize
+	}
+}
+
 // WithUserAgent set the user agent used by the client.
 func WithUserAgent(userAgent string) ClientOpt {
 	return func(s *GraphQLClient) {
@@ -58,15 +123,38 @@ func WithUserAgent(userAgent string) ClientOpt {
 	}
 }
 
+// serviceClientOpts returns the options of the query client the clients
+// updating the new services also use
+func (s *ExecutableSchema) serviceClientOpts() []ClientOpt {
+	if s.GraphqlClient == nil {
+		return nil
+	}
+	return []ClientOpt{WithTransports(s.GraphqlClient.Transports), WithCredentials(s.GraphqlClient.Credentials), WithRequestSigner(s.GraphqlClient.Signer), WithRecording(s.GraphqlClient.Recording)}
+}
+
 // Request executes a GraphQL request.
 func (c *GraphQLClient) Request(ctx context.Context, url string, request *Request, out interface{}) error {
+	request, aliases, err := c.Aliases.translateRequest(url, request)
+	if err != nil {
+		return err
+	}
 	var buf bytes.Buffer
-	err := json.NewEncoder(&buf).Encode(request)
+	err = json.NewEncoder(&buf).Encode(request)
 	if err != nil {
 		return fmt.Errorf("unable to encode request body: %w", err)
 	}
+	requestSize := int64(buf.Len())
+
+	body := buf.Bytes()
+	encoding := c.requestEncoding(url, buf.Len())
+	if encoding != "" {
+		body, err = compress(encoding, body)
+		if err != nil {
+			return fmt.Errorf("unable to compress request body: %w", err)
+		}
+	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &buf)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("unable to create request: %w", err)
 	}
@@ -74,14 +162,34 @@ func (c *GraphQLClient) Request(ctx context.Context, url string, request *Reques
 	if request.Headers != nil {
 		httpReq.Header = request.Headers.Clone()
 	}
+	if encoding != "" {
+		httpReq.Header.Set("Content-Encoding", encoding)
+	}
 
 	httpReq.Header.Set("Content-Type", "application/json; charset=utf-8")
 	httpReq.Header.Set("Accept", "application/json; charset=utf-8")
+	// the responses are decompressed by the client (not the transport) so
+	// the size on the wire can be measured
+	httpReq.Header.Set("Accept-Encoding", "gzip")
 
 	if c.UserAgent != "" {
 		httpReq.Header.Set("User-Agent", c.UserAgent)
 	}
 
+	if timeout := requestTimeout(ctx, c.HTTPClient); timeout > 0 {
+		httpReq.Header.Set(timeoutHeader, timeout.Round(time.Millisecond).String())
+	}
+
+	auth := c.Credentials.authorizerFor(url)
+	if auth != nil {
+		authorization, err := auth.authorization(ctx)
+		if err != nil {
+			return err
+		}
+		httpReq.Header.Set("Authorization", authorization)
+	}
+	c.Signer.sign(url, httpReq.Header, body)
+
 	if c.Tracer != nil {
 		span := opentracing.SpanFromContext(ctx)
 		if span != nil {
@@ -92,19 +200,67 @@ func (c *GraphQLClient) Request(ctx context.Context, url string, request *Reques
 		}
 	}
 
-	res, err := c.HTTPClient.Do(httpReq)
+	httpClient := c.HTTPClient
+	transport := localServiceTransport(url)
+	if transport == nil {
+		transport = c.Transports.For(url)
+	}
+	if c.Recording != nil {
+		if transport == nil {
+			transport = c.HTTPClient.Transport
+		}
+		transport = c.Recording.transport(transport)
+	}
+	if transport != nil {
+		client := *c.HTTPClient
+		client.Transport = transport
+		httpClient = &client
+	}
+
+	res, err := httpClient.Do(httpReq)
 	if err != nil {
 		return fmt.Errorf("error during request: %w", err)
 	}
 	defer res.Body.Close()
 
+	c.recordRequestEncodings(url, res.Header.Get("Accept-Encoding"))
+
+	if auth != nil && res.StatusCode == http.StatusUnauthorized {
+		// the next request gets new credentials
+		auth.invalidate()
+	}
+
+	if d := GetDownstreamResponseHeadersFromContext(ctx); d != nil {
+		d.add(url, res.Header)
+	}
+	getSchemaSkewDetectorFromContext(ctx).check(ctx, url, res.Header.Get(schemaHashHeader))
+
 	maxResponseSize := c.MaxResponseSize
 	if maxResponseSize == 0 {
 		maxResponseSize = math.MaxInt64
 	}
 
+	wire := &countingReader{r: res.Body}
+	decoded := &countingReader{r: wire}
+	if res.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(wire)
+		if err != nil {
+			return fmt.Errorf("error decompressing response: %w", err)
+		}
+		defer gz.Close()
+		decoded.r = gz
+	}
+	defer func() {
+		getPayloadSizesFromContext(ctx).add(url, PayloadSizes{
+			Requests:          1,
+			RequestBytes:      requestSize,
+			ResponseBytes:     decoded.n,
+			ResponseWireBytes: wire.n,
+		})
+	}()
+
 	limitReader := io.LimitedReader{
-		R: res.Body,
+		R: decoded,
 		N: maxResponseSize,
 	}
 
@@ -112,16 +268,22 @@ func (c *GraphQLClient) Request(ctx context.Context, url string, request *Reques
 		Data: out,
 	}
 
-	err = json.NewDecoder(&limitReader).Decode(&graphqlResponse)
+	responseBody, err := aliases.translateResponse(&limitReader)
+	if err == nil {
+		err = decodeResponse(json.NewDecoder(responseBody), &graphqlResponse)
+	}
 	if err != nil {
-		if errors.Is(err, io.ErrUnexpectedEOF) {
-			if limitReader.N == 0 {
-				return fmt.Errorf("response exceeded maximum size of %d bytes", maxResponseSize)
-			}
+		// the decoding fails on a truncated response
+		if limitReader.N == 0 {
+			return fmt.Errorf("response exceeded maximum size of %d bytes", maxResponseSize)
 		}
 		return fmt.Errorf("error decoding response: %w", err)
 	}
 
+	if d := getDownstreamExtensionsFromContext(ctx); d != nil && len(graphqlResponse.Extensions) > 0 {
+		d.add(url, graphqlResponse.Extensions)
+	}
+
 	if len(graphqlResponse.Errors) > 0 {
 		return graphqlResponse.Errors
 	}
@@ -129,6 +291,30 @@ func (c *GraphQLClient) Request(ctx context.Context, url string, request *Reques
 	return nil
 }
 
+// requestEncoding returns the encoding of the request body of the given size
+// to the service, or "" if it isn't compressed
+func (c *GraphQLClient) requestEncoding(url string, size int) string {
+	if c.CompressRequestsMinSize <= 0 || size < c.CompressRequestsMinSize {
+		return ""
+	}
+	encoding, _ := c.requestEncodings.Load(url)
+	s, _ := encoding.(string)
+	return s
+}
+
+// recordRequestEncodings records the encoding of the next requests to the
+// service from the Accept-Encoding header of its response
+func (c *GraphQLClient) recordRequestEncodings(url string, acceptEncoding string) {
+	if c.CompressRequestsMinSize <= 0 {
+		return
+	}
+	if encoding := negotiateContentEncoding(acceptEncoding, compressionEncodings); encoding != "" {
+		c.requestEncodings.Store(url, encoding)
+	} else {
+		c.requestEncodings.Delete(url)
+	}
+}
+
 // Request is a GraphQL request.
 type Request struct {
 	Query         string                 `json:"query"`
@@ -146,8 +332,9 @@ func NewRequest(body string) *Request {
 
 // Response is a GraphQL response
 type Response struct {
-	Errors GraphqlErrors `json:"errors"`
-	Data   interface{}
+	Errors     GraphqlErrors `json:"errors"`
+	Data       interface{}
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
 }
 
 // GraphqlErrors represents a list of GraphQL errors, as returned in a GraphQL
@@ -157,6 +344,7 @@ type GraphqlErrors []GraphqlError
 // GraphqlError is a single GraphQL error
 type GraphqlError struct {
 	Message    string                 `json:"message"`
+	Path       ast.Path               `json:"path,omitempty"`
 	Extensions map[string]interface{} `json:"extensions"`
 }
 
@@ -0,0 +1,134 @@
+package bramble
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// tooManyOperationsCode is the error code returned when a client exceeds its
+// limit of in-flight operations or subscriptions
+const tooManyOperationsCode = "TOO_MANY_OPERATIONS"
+
+// clientIDClaim is the claim used to identify the clients when no client ID
+// header is configured
+const clientIDClaim = "sub"
+
+// clientLimiter counts the in-flight operations and the active subscriptions
+// of every client, across all the connections. It is safe for concurrent use.
+type clientLimiter struct {
+	mu            sync.Mutex
+	operations    map[string]int
+	subscriptions map[string]int
+}
+
+func newClientLimiter() *clientLimiter {
+	return &clientLimiter{
+		operations:    make(map[string]int),
+		subscriptions: make(map[string]int),
+	}
+}
+
+// acquireOperation reserves an operation slot for the client. The returned
+// function must be called once the operation is done.
+func (l *clientLimiter) acquireOperation(client string, limit int) (func(), *gqlerror.Error) {
+	return l.acquire("operations", client, limit)
+}
+
+// acquireSubscription reserves a subscription slot for the client. The
+// returned function must be called once the subscription is done.
+func (l *clientLimiter) acquireSubscription(client string, limit int) (func(), *gqlerror.Error) {
+	return l.acquire("subscriptions", client, limit)
+}
+
+func (l *clientLimiter) acquire(kind string, client string, limit int) (func(), *gqlerror.Error) {
+	if l == nil || limit <= 0 || client == "" {
+		return func() {}, nil
+	}
+
+	counts := l.operations
+	if kind == "subscriptions" {
+		counts = l.subscriptions
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if counts[client] >= limit {
+		promClientLimitRejections.WithLabelValues(kind).Inc()
+		return nil, tooManyOperationsError(kind, limit)
+	}
+	counts[client]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			counts[client]--
+			if counts[client] <= 0 {
+				delete(counts, client)
+			}
+		})
+	}, nil
+}
+
+func tooManyOperationsError(kind string, limit int) *gqlerror.Error {
+	return &gqlerror.Error{
+		Message:    fmt.Sprintf("too many %s in flight, the limit is %d per client", kind, limit),
+		Extensions: map[string]interface{}{"code": tooManyOperationsCode},
+	}
+}
+
+// clientIDMiddleware identifies the client of the request and adds its ID to
+// the context, unless a plugin already did. The client is identified by the
+// ClientIDHeader if set, otherwise by the "sub" claim, or by its remote
+// address.
+func clientIDMiddleware(es *ExecutableSchema) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if GetClientIDFromContext(ctx) == "" {
+				var header string
+				if es != nil {
+					header = es.ClientIDHeader
+				}
+				ctx = AddClientIDToContext(ctx, requestClientID(r, header))
+			}
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func requestClientID(r *http.Request, header string) string {
+	if header != "" {
+		if id := r.Header.Get(header); id != "" {
+			return id
+		}
+	}
+	if claims, ok := GetClaimsFromContext(r.Context()); ok {
+		if sub, ok := claims[clientIDClaim].(string); ok && sub != "" {
+			return sub
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// acquireClientOperation reserves an in-flight operation slot for the client
+// of the context
+func (s *ExecutableSchema) acquireClientOperation(ctx context.Context) (func(), *gqlerror.Error) {
+	return s.clientLimiter.acquireOperation(GetClientIDFromContext(ctx), s.MaxOperationsPerClient)
+}
+
+// acquireClientSubscription reserves a subscription slot for the client of
+// the context
+func (s *ExecutableSchema) acquireClientSubscription(ctx context.Context) (func(), *gqlerror.Error) {
+	return s.clientLimiter.acquireSubscription(GetClientIDFromContext(ctx), s.MaxSubscriptionsPerClient)
+}
@@ -0,0 +1,120 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientLimiter(t *testing.T) {
+	l := newClientLimiter()
+
+	release1, err := l.acquireOperation("a", 2)
+	require.Nil(t, err)
+	release2, err := l.acquireOperation("a", 2)
+	require.Nil(t, err)
+
+	_, err = l.acquireOperation("a", 2)
+	require.NotNil(t, err)
+	assert.Equal(t, tooManyOperationsCode, err.Extensions["code"])
+
+	t.Run("other clients aren't limited", func(t *testing.T) {
+		release, err := l.acquireOperation("b", 2)
+		require.Nil(t, err)
+		release()
+	})
+
+	t.Run("subscriptions are counted separately", func(t *testing.T) {
+		release, err := l.acquireSubscription("a", 1)
+		require.Nil(t, err)
+		_, err = l.acquireSubscription("a", 1)
+		require.NotNil(t, err)
+		release()
+	})
+
+	release1()
+	release1()
+	release, err := l.acquireOperation("a", 2)
+	require.Nil(t, err)
+	_, err = l.acquireOperation("a", 2)
+	require.NotNil(t, err, "releasing twice must only free one slot")
+
+	release()
+	release2()
+	assert.Empty(t, l.operations)
+	assert.Empty(t, l.subscriptions)
+}
+
+func TestClientLimiterNoLimit(t *testing.T) {
+	l := newClientLimiter()
+	for i := 0; i < 10; i++ {
+		_, err := l.acquireOperation("a", 0)
+		require.Nil(t, err)
+	}
+	_, err := l.acquireOperation("", 1)
+	require.Nil(t, err)
+	_, err = l.acquireOperation("", 1)
+	require.Nil(t, err, "unidentified clients aren't limited")
+
+	var nilLimiter *clientLimiter
+	_, err = nilLimiter.acquireSubscription("a", 1)
+	require.Nil(t, err)
+}
+
+func TestRequestClientID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	req.RemoteAddr = "10.0.0.1:4567"
+	assert.Equal(t, "10.0.0.1", requestClientID(req, "X-Client-ID"))
+
+	req = req.WithContext(AddClaimsToContext(req.Context(), map[string]interface{}{"sub": "user-1"}))
+	assert.Equal(t, "user-1", requestClientID(req, "X-Client-ID"))
+
+	req.Header.Set("X-Client-ID", "api-key-1")
+	assert.Equal(t, "api-key-1", requestClientID(req, "X-Client-ID"))
+	assert.Equal(t, "user-1", requestClientID(req, ""))
+}
+
+func TestMaxOperationsPerClient(t *testing.T) {
+	service := newTestService(t, "test", `type Service { name: String! version: String! schema: String! }
+	type Query { test: String service: Service! }`, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{ "data": { "test": "Hello" }}`))
+	})
+
+	es := newExecutableSchema(nil, 50, nil, NewService(service.URL))
+	require.NoError(t, es.UpdateSchema(true))
+	es.MaxOperationsPerClient = 1
+	es.ClientIDHeader = "X-Client-ID"
+	router := NewGateway(es, nil).Router()
+
+	query := func(client string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"query": "{ test }"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Client-ID", client)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var resp map[string]interface{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		return resp
+	}
+
+	// simulate an operation in flight for the client
+	release, limitErr := es.acquireClientOperation(AddClientIDToContext(context.Background(), "a"))
+	require.Nil(t, limitErr)
+
+	resp := query("a")
+	require.Contains(t, resp, "errors")
+	errs := resp["errors"].([]interface{})
+	require.Len(t, errs, 1)
+	assert.Equal(t, tooManyOperationsCode, errs[0].(map[string]interface{})["extensions"].(map[string]interface{})["code"])
+
+	assert.Equal(t, map[string]interface{}{"test": "Hello"}, query("b")["data"])
+
+	release()
+	assert.Equal(t, map[string]interface{}{"test": "Hello"}, query("a")["data"])
+}
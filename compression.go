@@ -0,0 +1,260 @@
+package bramble
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	encodingBrotli   = "br"
+	encodingGzip     = "gzip"
+	encodingIdentity = "identity"
+)
+
+const (
+	defaultCompressionMinSize  = 1024
+	defaultMaxDecompressedSize = 10 * 1024 * 1024
+)
+
+// compressionEncodings are the supported encodings, in order of preference
+var compressionEncodings = []string{encodingBrotli, encodingGzip}
+
+// errDecompressedSizeExceeded is returned when reading a decompressed request
+// body larger than the max size
+var errDecompressedSizeExceeded = errors.New("decompressed request body too large")
+
+// CompressionConfig configures the compression of the responses and of the
+// requests to the services
+type CompressionConfig struct {
+	// Encodings are the encodings of the responses, in order of preference
+	// when the client accepts several. Defaults to ["br", "gzip"].
+	Encodings []string `json:"encodings"`
+	// MinSize is the size under which the bodies aren't compressed, defaults
+	// to 1024 bytes
+	MinSize int `json:"min-size"`
+	// MaxRequestSize limits the size of the decompressed request bodies,
+	// defaults to 10MB
+	MaxRequestSize int64 `json:"max-request-size"`
+	// Downstream compresses the requests to the services advertising support
+	// (with the Accept-Encoding header of their responses)
+	Downstream bool `json:"downstream"`
+}
+
+// validate checks the config and sets the defaults
+func (c *CompressionConfig) validate() error {
+	for _, encoding := range c.Encodings {
+		if !isSupportedEncoding(encoding) {
+			return fmt.Errorf("unsupported encoding %q", encoding)
+		}
+	}
+	if c.MinSize < 0 {
+		return errors.New("min-size must not be negative")
+	}
+	if c.MaxRequestSize < 0 {
+		return errors.New("max-request-size must not be negative")
+	}
+	if len(c.Encodings) == 0 {
+		c.Encodings = compressionEncodings
+	}
+	if c.MinSize == 0 {
+		c.MinSize = defaultCompressionMinSize
+	}
+	if c.MaxRequestSize == 0 {
+		c.MaxRequestSize = defaultMaxDecompressedSize
+	}
+	return nil
+}
+
+func isSupportedEncoding(encoding string) bool {
+	for _, e := range compressionEncodings {
+		if e == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+// compress returns the data compressed with the encoding
+func compress(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case encodingGzip:
+		w = gzip.NewWriter(&buf)
+	case encodingBrotli:
+		w = brotli.NewWriterLevel(&buf, brotli.DefaultCompression)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressor returns a reader of the decompressed body
+func decompressor(encoding string, body io.Reader) (io.Reader, error) {
+	switch encoding {
+	case encodingGzip:
+		return gzip.NewReader(body)
+	case encodingBrotli:
+		return brotli.NewReader(body), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
+
+// negotiateContentEncoding returns the encoding with the highest quality in
+// the Accept-Encoding header, or "" if none of the encodings is accepted. The
+// order of the encodings breaks the ties.
+func negotiateContentEncoding(acceptEncoding string, encodings []string) string {
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, err := mime.ParseMediaType(strings.TrimSpace(coding))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressionMiddleware decompresses the request bodies compressed with gzip
+// or brotli, and compresses the responses with the encoding negotiated with
+// the client if the compression is enabled.
+func compressionMiddleware(es *ExecutableSchema) middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var config *CompressionConfig
+			if es != nil {
+				config = es.Compression
+			}
+
+			if encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding != "" && encoding != encodingIdentity {
+				body, err := decompressor(encoding, r.Body)
+				if err != nil {
+					status := http.StatusBadRequest
+					if !isSupportedEncoding(encoding) {
+						status = http.StatusUnsupportedMediaType
+					}
+					http.Error(w, err.Error(), status)
+					return
+				}
+				maxSize := int64(defaultMaxDecompressedSize)
+				if config != nil {
+					maxSize = config.MaxRequestSize
+				}
+				r.Body = &decompressedBody{r: body, closer: r.Body, remaining: maxSize}
+				r.Header.Del("Content-Encoding")
+				r.Header.Del("Content-Length")
+				r.ContentLength = -1
+			}
+
+			if config == nil || r.Header.Get("Upgrade") != "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateContentEncoding(r.Header.Get("Accept-Encoding"), config.Encodings)
+			if encoding == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &bufferedResponseWriter{header: w.Header(), status: http.StatusOK}
+			h.ServeHTTP(rec, r)
+
+			body := rec.body.Bytes()
+			if len(body) >= config.MinSize && w.Header().Get("Content-Encoding") == "" {
+				if compressed, err := compress(encoding, body); err == nil {
+					body = compressed
+					w.Header().Set("Content-Encoding", encoding)
+				}
+			}
+			w.Header().Del("Content-Length")
+			w.WriteHeader(rec.status)
+			_, _ = w.Write(body)
+		})
+	}
+}
+
+// decompressedBody is a decompressed request body, limited to a max size
+type decompressedBody struct {
+	r         io.Reader
+	closer    io.Closer
+	remaining int64
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// the body may end exactly at the max size
+		var next [1]byte
+		if _, err := io.ReadFull(b.r, next[:]); err == io.EOF {
+			return 0, io.EOF
+		}
+		return 0, errDecompressedSizeExceeded
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *decompressedBody) Close() error {
+	return b.closer.Close()
+}
+
+// bufferedResponseWriter buffers the response so it can be compressed
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
@@ -0,0 +1,162 @@
+package bramble
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateContentEncoding(t *testing.T) {
+	encodings := []string{encodingBrotli, encodingGzip}
+	tests := map[string]string{
+		"":                            "",
+		"gzip":                        "gzip",
+		"gzip, deflate, br":           "br",
+		"br;q=0.5, gzip":              "gzip",
+		"gzip;q=0, deflate":           "",
+		"*":                           "br",
+		"gzip;q=0.5, *;q=0.8":         "br",
+		"br;q=0, *":                   "gzip",
+		"identity":                    "",
+		"deflate, gzip;q=invalid, br": "br",
+	}
+	for acceptEncoding, expected := range tests {
+		assert.Equal(t, expected, negotiateContentEncoding(acceptEncoding, encodings), acceptEncoding)
+	}
+	assert.Equal(t, "gzip", negotiateContentEncoding("gzip, br", []string{encodingGzip}))
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	largeBody := `{"data":{"text":"` + strings.Repeat("a", 2000) + `"}}`
+	var requestBody string
+	var requestErr error
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		body, requestErr = ioutil.ReadAll(r.Body)
+		requestBody = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("size") == "small" {
+			w.Write([]byte(`{"data":{}}`))
+			return
+		}
+		w.Write([]byte(largeBody))
+	})
+	config := &CompressionConfig{MaxRequestSize: 100}
+	require.NoError(t, config.validate())
+	es := &ExecutableSchema{Compression: config}
+
+	serve := func(es *ExecutableSchema, req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		compressionMiddleware(es)(handler).ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, encoding := range compressionEncodings {
+		t.Run(encoding, func(t *testing.T) {
+			body, err := compress(encoding, []byte(`{"query":"{ text }"}`))
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body))
+			req.Header.Set("Content-Encoding", encoding)
+			req.Header.Set("Accept-Encoding", encoding)
+			rec := serve(es, req)
+
+			require.NoError(t, requestErr)
+			assert.Equal(t, `{"query":"{ text }"}`, requestBody)
+			assert.Equal(t, encoding, rec.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+			decompressed, err := decompressor(encoding, rec.Body)
+			require.NoError(t, err)
+			response, err := ioutil.ReadAll(decompressed)
+			require.NoError(t, err)
+			assert.Equal(t, largeBody, string(response))
+		})
+	}
+
+	t.Run("small responses aren't compressed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/query?size=small", strings.NewReader(`{}`))
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := serve(es, req)
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, `{"data":{}}`, rec.Body.String())
+	})
+
+	t.Run("compression disabled", func(t *testing.T) {
+		body, err := compress(encodingGzip, []byte(`{}`))
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := serve(nil, req)
+		assert.Equal(t, `{}`, requestBody)
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, largeBody, rec.Body.String())
+	})
+
+	t.Run("unsupported request encoding", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{}`))
+		req.Header.Set("Content-Encoding", "compress")
+		rec := serve(es, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+
+	t.Run("invalid compressed request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{}`))
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := serve(es, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("decompressed request too large", func(t *testing.T) {
+		body, err := compress(encodingGzip, []byte(strings.Repeat(" ", 101)))
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", "gzip")
+		serve(es, req)
+		assert.Equal(t, errDecompressedSizeExceeded, requestErr)
+
+		body, err = compress(encodingGzip, []byte(strings.Repeat(" ", 100)))
+		require.NoError(t, err)
+		req = httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", "gzip")
+		serve(es, req)
+		assert.NoError(t, requestErr)
+	})
+}
+
+func TestClientRequestCompression(t *testing.T) {
+	var encodings []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.Header.Get("Content-Encoding")
+		encodings = append(encodings, encoding)
+		var body io.Reader = r.Body
+		if encoding != "" {
+			var err error
+			body, err = decompressor(encoding, r.Body)
+			require.NoError(t, err)
+		}
+		data, err := ioutil.ReadAll(body)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"query":"{ test`)
+		w.Header().Set("Accept-Encoding", "gzip")
+		w.Write([]byte(`{ "data": { "test": "ok" } }`))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithRequestCompression(100))
+	large := NewRequest("{ test " + strings.Repeat(" ", 100) + "}")
+	var resp map[string]interface{}
+	// the first request tells whether the service accepts compressed requests
+	require.NoError(t, client.Request(context.Background(), server.URL, large, &resp))
+	require.NoError(t, client.Request(context.Background(), server.URL, large, &resp))
+	require.NoError(t, client.Request(context.Background(), server.URL, NewRequest("{ test }"), &resp))
+	assert.Equal(t, map[string]interface{}{"test": "ok"}, resp)
+	assert.Equal(t, []string{"", "gzip", ""}, encodings)
+}
@@ -0,0 +1,167 @@
+package bramble
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// requestLimiter limits the number of concurrent requests, a nil limiter
+// doesn't limit anything
+type requestLimiter chan struct{}
+
+func newRequestLimiter(limit int) requestLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return make(requestLimiter, limit)
+}
+
+// acquire waits for a request slot, or until the context is done
+func (l requestLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tryAcquire acquires a request slot if one is available
+func (l requestLimiter) tryAcquire() bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release releases a slot acquired with acquire or tryAcquire
+func (l requestLimiter) release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// serviceRequestLimiters contains the request limiter of every service,
+// shared by all the queries. It is safe for concurrent use.
+type serviceRequestLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]requestLimiter
+}
+
+func newServiceRequestLimiters() *serviceRequestLimiters {
+	return &serviceRequestLimiters{
+		limiters: make(map[string]requestLimiter),
+	}
+}
+
+// get returns the limiter of the service. The limiter is replaced if the
+// limit changed, the requests holding a slot of the previous limiter must
+// release it there.
+func (s *serviceRequestLimiters) get(serviceURL string, limit int) requestLimiter {
+	if s == nil || limit <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.limiters[serviceURL]
+	if !ok || cap(l) != limit {
+		l = newRequestLimiter(limit)
+		s.limiters[serviceURL] = l
+	}
+	return l
+}
+
+// request sends the request of the step to its service, calling the step
+// hooks before and after it. The failed requests classified as retried are
+// sent again, the error returned is classified.
+func (e *QueryExecution) request(ctx context.Context, step *QueryPlanStep, req *Request, resp interface{}) error {
+	nameRequest(req, e.operationName)
+	if len(e.hooks) > 0 && req.Headers == nil {
+		req.Headers = make(http.Header)
+	}
+	if err := e.hooks.onStepRequest(ctx, step, req); err != nil {
+		return err
+	}
+	stepCtx, cancel := e.withStepDeadline(ctx, step)
+	defer cancel()
+	for retry := 1; ; retry++ {
+		err := e.doRequest(stepCtx, step, req, resp)
+		err = budgetExceededError(ctx, stepCtx, err)
+		if translateErr := e.translateTypenames(step, resp); translateErr != nil && err == nil {
+			err = fmt.Errorf("error translating the response type names: %w", translateErr)
+		}
+		err = e.hooks.onStepResponse(ctx, step, resp, err)
+		if err == nil || e.errorClassifier == nil {
+			return err
+		}
+
+		action := e.errorClassifier.classify(ctx, step, err)
+		if action == ErrorActionRetry && canRetryStep(step) {
+			if backoff, ok := e.errorClassifier.retryBackoff(retry); ok {
+				select {
+				case <-time.After(backoff):
+					resetResponse(resp)
+					continue
+				case <-stepCtx.Done():
+				}
+			}
+		}
+		return &classifiedError{action: action, err: err}
+	}
+}
+
+// doRequest sends the request once the query and the service are below their
+// limit of concurrent requests
+func (e *QueryExecution) doRequest(ctx context.Context, step *QueryPlanStep, req *Request, resp interface{}) error {
+	if err := e.scheduler.acquire(ctx, step); err != nil {
+		return err
+	}
+	defer e.scheduler.release()
+
+	serviceLimiter := e.serviceLimiters.get(step.ServiceURL, e.maxServiceConcurrency)
+	if err := serviceLimiter.acquire(ctx); err != nil {
+		return err
+	}
+	defer serviceLimiter.release()
+
+	promHTTPInFlightGauge.Inc()
+	defer promHTTPInFlightGauge.Dec()
+
+	start := time.Now()
+	variant, canaryURL := e.canaryRoute(ctx, step)
+	if variant == canaryVariant {
+		// the canary is neither load balanced nor hedged
+		err := e.graphqlClient.Request(ctx, canaryURL, req, resp)
+		observeVariantRequest(step, variant, start, err)
+		return err
+	}
+
+	balancer := e.endpointBalancers.get(e.serviceEndpoints[step.ServiceURL].forStep(step))
+	url := step.ServiceURL
+	ep := balancer.acquire()
+	if ep != nil {
+		url = ep.url
+	}
+
+	var err error
+	if replica := e.hedgingReplica(step); replica != "" {
+		err = e.hedgedRequest(ctx, step, url, replica, req, resp)
+	} else {
+		err = e.graphqlClient.Request(ctx, url, req, resp)
+	}
+	balancer.release(ep, step.ServiceName, err)
+	observeVariantRequest(step, variant, start, err)
+	return err
+}
@@ -0,0 +1,100 @@
+package bramble
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLimiter(t *testing.T) {
+	var unlimited requestLimiter
+	require.NoError(t, unlimited.acquire(context.Background()))
+	unlimited.release()
+
+	l := newRequestLimiter(1)
+	require.NoError(t, l.acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, l.acquire(ctx))
+
+	l.release()
+	require.NoError(t, l.acquire(context.Background()))
+}
+
+func TestServiceRequestLimiters(t *testing.T) {
+	s := newServiceRequestLimiters()
+	assert.Nil(t, s.get("http://a", 0))
+
+	a := s.get("http://a", 2)
+	assert.Equal(t, 2, cap(a))
+	assert.Equal(t, a, s.get("http://a", 2))
+	assert.NotEqual(t, a, s.get("http://b", 2))
+	assert.Equal(t, 3, cap(s.get("http://a", 3)))
+
+	var nilLimiters *serviceRequestLimiters
+	assert.Nil(t, nilLimiters.get("http://a", 2))
+}
+
+func TestQueryExecutionConcurrencyLimits(t *testing.T) {
+	run := func(t *testing.T, queryLimit, serviceLimit int, services int) int64 {
+		var inFlight, maxInFlight int64
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt64(&inFlight, 1)
+			for {
+				max := atomic.LoadInt64(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt64(&inFlight, -1)
+			w.Write([]byte(`{ "data": {} }`))
+		})
+
+		var steps []*QueryPlanStep
+		for i := 0; i < services; i++ {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			steps = append(steps, &QueryPlanStep{ServiceURL: server.URL})
+		}
+
+		e := newQueryExecution(NewClient(), nil, nil, 50, nil)
+		e.scheduler = newStepScheduler(queryLimit, nil, false)
+		e.serviceLimiters = newServiceRequestLimiters()
+		e.maxServiceConcurrency = serviceLimit
+
+		var wg sync.WaitGroup
+		for _, step := range steps {
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func(step *QueryPlanStep) {
+					defer wg.Done()
+					resp := map[string]interface{}{}
+					assert.NoError(t, e.request(context.Background(), step, NewRequest("{ a }"), &resp))
+				}(step)
+			}
+		}
+		wg.Wait()
+		return maxInFlight
+	}
+
+	t.Run("per query", func(t *testing.T) {
+		assert.LessOrEqual(t, run(t, 3, 0, 2), int64(3))
+	})
+
+	t.Run("per service", func(t *testing.T) {
+		assert.LessOrEqual(t, run(t, 0, 1, 1), int64(1))
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		assert.Greater(t, run(t, 0, 0, 1), int64(1))
+	})
+}
@@ -3,9 +3,12 @@ package bramble
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -22,16 +25,73 @@ type PluginConfig struct {
 
 // Config contains the gateway configuration
 type Config struct {
-	GatewayPort            int       `json:"gateway-port"`
-	MetricsPort            int       `json:"metrics-port"`
-	PrivatePort            int       `json:"private-port"`
-	Services               []string  `json:"services"`
-	LogLevel               log.Level `json:"loglevel"`
-	PollInterval           string    `json:"poll-interval"`
-	PollIntervalDuration   time.Duration
-	MaxRequestsPerQuery    int64 `json:"max-requests-per-query"`
-	MaxServiceResponseSize int64 `json:"max-service-response-size"`
-	Plugins                []PluginConfig
+	GatewayPort                     int       `json:"gateway-port"`
+	MetricsPort                     int       `json:"metrics-port"`
+	PrivatePort                     int       `json:"private-port"`
+	Services                        []string  `json:"services"`
+	LogLevel                        log.Level `json:"loglevel"`
+	PollInterval                    string    `json:"poll-interval"`
+	PollIntervalDuration            time.Duration
+	MaxRequestsPerQuery             int64               `json:"max-requests-per-query"`
+	MaxServiceResponseSize          int64               `json:"max-service-response-size"`
+	MaxQueryComplexity              int                 `json:"max-query-complexity"`
+	RejectBreakingChanges           bool                `json:"reject-breaking-changes"`
+	SafeMode                        bool                `json:"safe-mode"`
+	RolesClaim                      string              `json:"roles-claim"`
+	Joins                           []Join              `json:"joins"`
+	ErrorMode                       string              `json:"error-mode"`
+	ServiceName                     string              `json:"service-name"`
+	RawJSONMerge                    bool                `json:"raw-json-merge"`
+	BoundaryQueryBatching           bool                `json:"boundary-query-batching"`
+	MaxConcurrentRequestsPerQuery   int                 `json:"max-concurrent-requests-per-query"`
+	MaxConcurrentRequestsPerService int                 `json:"max-concurrent-requests-per-service"`
+	ServiceReplicas                 map[string][]string `json:"service-replicas"`
+	HedgingDelay                    string              `json:"hedging-delay"`
+	HedgingDelayDuration            time.Duration
+	ExecutionTimeout                string `json:"execution-timeout"`
+	ExecutionTimeoutDuration        time.Duration
+	DeadlineBudgeting               bool   `json:"deadline-budgeting"`
+	SubscriptionKeepAlive           string `json:"subscription-keep-alive"`
+	SubscriptionKeepAliveDuration   time.Duration
+	SubscriptionBatchWindow         string `json:"subscription-batch-window"`
+	SubscriptionBatchWindowDuration time.Duration
+	ShutdownDelay                   string `json:"shutdown-delay"`
+	ShutdownDelayDuration           time.Duration
+	DrainTimeout                    string `json:"drain-timeout"`
+	DrainTimeoutDuration            time.Duration
+	IdempotencyCacheWindow          string `json:"idempotency-cache-window"`
+	IdempotencyCacheWindowDuration  time.Duration
+	ServiceEndpoints                map[string]ServiceEndpoints    `json:"service-endpoints"`
+	ServiceCanaries                 map[string]ServiceCanary       `json:"service-canaries"`
+	DownstreamTransport             TransportConfig                `json:"downstream-transport"`
+	ServiceTransports               map[string]TransportConfig     `json:"service-transports"`
+	ServiceCredentials              map[string]ServiceCredentials  `json:"service-credentials"`
+	SlowQueryLog                    SlowQueryLogConfig             `json:"slow-query-log"`
+	ErrorClassification             ErrorClassificationConfig      `json:"error-classification"`
+	BoundaryCache                   BoundaryCacheConfig            `json:"boundary-cache"`
+	SchemaRegistry                  *SchemaRegistryConfig          `json:"schema-registry"`
+	EventWebhooks                   []EventWebhook                 `json:"event-webhooks"`
+	ReadinessQuorum                 float64                        `json:"readiness-quorum"`
+	MaxOperationsPerClient          int                            `json:"max-operations-per-client"`
+	MaxSubscriptionsPerClient       int                            `json:"max-subscriptions-per-client"`
+	ClientIDHeader                  string                         `json:"client-id-header"`
+	ClientMetadataHeaders           []string                       `json:"client-metadata-headers"`
+	ReportDeprecations              bool                           `json:"report-deprecations"`
+	OperationMetrics                bool                           `json:"operation-metrics"`
+	Introspection                   IntrospectionConfig            `json:"introspection"`
+	PaginationGuard                 PaginationGuardConfig          `json:"pagination-guard"`
+	DirectivePassthrough            DirectivePassthroughConfig     `json:"directive-passthrough"`
+	ErrorStatusCodes                map[string]int                 `json:"error-status-codes"`
+	StrictResponseValidation        bool                           `json:"strict-response-validation"`
+	LenientNullServices             []string                       `json:"lenient-null-services"`
+	SchemaTransforms                map[string]SchemaTransform     `json:"schema-transforms"`
+	ServiceSchemas                  map[string]ServiceSchemaConfig `json:"service-schemas"`
+	RESTServices                    map[string]RESTServiceConfig   `json:"rest-services"`
+	Recording                       *RecordingConfig               `json:"recording"`
+	RequestSigning                  RequestSigningConfig           `json:"request-signing"`
+	ServiceAliasPrefixes            map[string]string              `json:"service-alias-prefixes"`
+	Compression                     *CompressionConfig             `json:"compression"`
+	Plugins                         []PluginConfig
 	// Config extensions that can be shared among plugins
 	Extensions map[string]json.RawMessage
 
@@ -40,6 +100,15 @@ type Config struct {
 	watcher          *fsnotify.Watcher
 	configFiles      []string
 	linkedFiles      []string
+	initErrors       []error
+	errorFormatter   ErrorFormatter
+	transports       *Transports
+	credentials      *Credentials
+	signer           *RequestSigner
+	aliases          *ServiceAliases
+	schemaRegistry   SchemaRegistry
+	recording        *Recording
+	reloadMutex      sync.Mutex
 }
 
 // GatewayAddress returns the host:port string of the gateway
@@ -60,22 +129,26 @@ func (c *Config) MetricAddress() string {
 // Load loads or reloads all the config files.
 func (c *Config) Load() error {
 	c.Extensions = nil
+	c.initErrors = nil
 	// concatenate plugins from all the config files
 	var plugins []PluginConfig
 	for _, configFile := range c.configFiles {
 		c.Plugins = nil
-		f, err := os.Open(configFile)
+		f, err := readConfigFile(configFile)
 		if err != nil {
 			return err
 		}
-		defer f.Close()
-		if err := json.NewDecoder(f).Decode(&c); err != nil {
-			return fmt.Errorf("error decoding config file %q: %w", configFile, err)
+		if err := f.decode(c); err != nil {
+			return err
 		}
 		plugins = append(plugins, c.Plugins...)
 	}
 	c.Plugins = plugins
 
+	if err := c.validate(); err != nil {
+		return err
+	}
+
 	logLevel := os.Getenv("BRAMBLE_LOG_LEVEL")
 	if level, err := log.ParseLevel(logLevel); err == nil {
 		c.LogLevel = level
@@ -90,6 +163,153 @@ func (c *Config) Load() error {
 		return fmt.Errorf("invalid poll interval: %w", err)
 	}
 
+	if c.HedgingDelay != "" {
+		c.HedgingDelayDuration, err = time.ParseDuration(c.HedgingDelay)
+		if err != nil {
+			return fmt.Errorf("invalid hedging delay: %w", err)
+		}
+	}
+
+	if c.ExecutionTimeout != "" {
+		c.ExecutionTimeoutDuration, err = time.ParseDuration(c.ExecutionTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid execution timeout: %w", err)
+		}
+	}
+
+	if c.SubscriptionKeepAlive != "" {
+		c.SubscriptionKeepAliveDuration, err = time.ParseDuration(c.SubscriptionKeepAlive)
+		if err != nil {
+			return fmt.Errorf("invalid subscription keep-alive: %w", err)
+		}
+	}
+
+	if c.ShutdownDelay != "" {
+		c.ShutdownDelayDuration, err = time.ParseDuration(c.ShutdownDelay)
+		if err != nil {
+			return fmt.Errorf("invalid shutdown delay: %w", err)
+		}
+	}
+
+	if c.SubscriptionBatchWindow != "" {
+		c.SubscriptionBatchWindowDuration, err = time.ParseDuration(c.SubscriptionBatchWindow)
+		if err != nil {
+			return fmt.Errorf("invalid subscription batch window: %w", err)
+		}
+	}
+
+	if c.DrainTimeout != "" {
+		c.DrainTimeoutDuration, err = time.ParseDuration(c.DrainTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid drain timeout: %w", err)
+		}
+	}
+
+	for service, endpoints := range c.ServiceEndpoints {
+		if err := endpoints.Validate(); err != nil {
+			return fmt.Errorf("invalid endpoints for service %q: %w", service, err)
+		}
+	}
+
+	if err := c.PaginationGuard.Validate(); err != nil {
+		return fmt.Errorf("invalid pagination guard: %w", err)
+	}
+
+	if err := c.DirectivePassthrough.Validate(); err != nil {
+		return fmt.Errorf("invalid directive passthrough: %w", err)
+	}
+
+	for service, canary := range c.ServiceCanaries {
+		if err := canary.Validate(); err != nil {
+			return fmt.Errorf("invalid canary for service %q: %w", service, err)
+		}
+	}
+
+	for service, transform := range c.SchemaTransforms {
+		if err := transform.Validate(); err != nil {
+			return fmt.Errorf("invalid schema transform for service %q: %w", service, err)
+		}
+	}
+
+	for service, schema := range c.ServiceSchemas {
+		if err := schema.Validate(); err != nil {
+			return fmt.Errorf("invalid schema source for service %q: %w", service, err)
+		}
+	}
+
+	c.transports, err = NewTransports(c.DownstreamTransport, c.ServiceTransports, c.ServiceEndpoints, c.alternateServiceURLs())
+	if err != nil {
+		return fmt.Errorf("invalid downstream transport: %w", err)
+	}
+
+	restServices := make(map[string]http.Handler, len(c.RESTServices))
+	for name, config := range c.RESTServices {
+		if isRegisteredLocalService(name) {
+			return fmt.Errorf("invalid REST service %q: a local service is already registered with this name", name)
+		}
+		service, err := newRESTService(name, config, c.transports.For(config.URL), c.MaxServiceResponseSize)
+		if err != nil {
+			return fmt.Errorf("invalid REST service %q: %w", name, err)
+		}
+		restServices[restServiceURL(name)] = service
+	}
+	c.transports = c.transports.withHandlers(restServices)
+
+	if err := c.SlowQueryLog.parse(); err != nil {
+		return err
+	}
+
+	if err := c.ErrorClassification.parse(); err != nil {
+		return err
+	}
+
+	if err := c.BoundaryCache.parse(); err != nil {
+		return err
+	}
+
+	if c.IdempotencyCacheWindow != "" {
+		c.IdempotencyCacheWindowDuration, err = time.ParseDuration(c.IdempotencyCacheWindow)
+		if err != nil {
+			return fmt.Errorf("invalid idempotency cache window: %w", err)
+		}
+	}
+
+	c.schemaRegistry = nil
+	if c.SchemaRegistry != nil {
+		c.schemaRegistry, err = c.SchemaRegistry.registry()
+		if err != nil {
+			return fmt.Errorf("invalid schema registry: %w", err)
+		}
+	}
+
+	c.recording = nil
+	if c.Recording != nil {
+		c.recording, err = NewRecording(*c.Recording)
+		if err != nil {
+			return fmt.Errorf("invalid recording: %w", err)
+		}
+	}
+
+	c.credentials, err = NewCredentials(c.ServiceCredentials, c.ServiceEndpoints, c.alternateServiceURLs())
+	if err != nil {
+		return err
+	}
+
+	c.signer, err = NewRequestSigner(c.RequestSigning, c.ServiceEndpoints, c.alternateServiceURLs())
+	if err != nil {
+		return fmt.Errorf("invalid request signing: %w", err)
+	}
+
+	c.aliases, err = NewServiceAliases(c.ServiceAliasPrefixes, c.ServiceEndpoints, c.alternateServiceURLs())
+	if err != nil {
+		return err
+	}
+
+	c.errorFormatter, err = errorFormatterForMode(c.ErrorMode)
+	if err != nil {
+		return err
+	}
+
 	services, err := c.buildServiceList()
 	if err != nil {
 		return err
@@ -101,6 +321,65 @@ func (c *Config) Load() error {
 	return nil
 }
 
+// validate checks the options that aren't checked when they're parsed
+func (c *Config) validate() error {
+	ports := []struct {
+		name string
+		port int
+	}{
+		{"gateway-port", c.GatewayPort},
+		{"private-port", c.PrivatePort},
+		{"metrics-port", c.MetricsPort},
+	}
+	for _, p := range ports {
+		if p.port < 0 || p.port > 65535 {
+			return fmt.Errorf("invalid %s: %d is not a valid port", p.name, p.port)
+		}
+	}
+
+	limits := []struct {
+		name  string
+		value int64
+	}{
+		{"max-requests-per-query", c.MaxRequestsPerQuery},
+		{"max-service-response-size", c.MaxServiceResponseSize},
+		{"max-query-complexity", int64(c.MaxQueryComplexity)},
+		{"max-concurrent-requests-per-query", int64(c.MaxConcurrentRequestsPerQuery)},
+		{"max-concurrent-requests-per-service", int64(c.MaxConcurrentRequestsPerService)},
+		{"max-operations-per-client", int64(c.MaxOperationsPerClient)},
+		{"max-subscriptions-per-client", int64(c.MaxSubscriptionsPerClient)},
+	}
+	for _, l := range limits {
+		if l.value < 0 {
+			return fmt.Errorf("invalid %s: must not be negative", l.name)
+		}
+	}
+
+	if c.ReadinessQuorum < 0 || c.ReadinessQuorum > 1 {
+		return fmt.Errorf("invalid readiness-quorum: %v is not between 0 and 1", c.ReadinessQuorum)
+	}
+
+	for code, status := range c.ErrorStatusCodes {
+		if status < 200 || status > 599 {
+			return fmt.Errorf("invalid error-status-codes: %d is not a valid status for %s", status, code)
+		}
+	}
+
+	if c.Compression != nil {
+		if err := c.Compression.validate(); err != nil {
+			return fmt.Errorf("invalid compression: %w", err)
+		}
+	}
+
+	for i, plugin := range c.Plugins {
+		if plugin.Name == "" {
+			return fmt.Errorf("invalid plugin %d: name is required", i)
+		}
+	}
+
+	return nil
+}
+
 func (c *Config) buildServiceList() ([]string, error) {
 	serviceSet := map[string]bool{}
 	for _, service := range c.Services {
@@ -109,6 +388,12 @@ func (c *Config) buildServiceList() ([]string, error) {
 	for _, service := range strings.Fields(os.Getenv("BRAMBLE_SERVICE_LIST")) {
 		serviceSet[service] = true
 	}
+	for _, service := range localServiceURLs() {
+		serviceSet[service] = true
+	}
+	for name := range c.RESTServices {
+		serviceSet[restServiceURL(name)] = true
+	}
 	for _, plugin := range c.plugins {
 		ok, path := plugin.GraphqlQueryPath()
 		if ok {
@@ -161,20 +446,61 @@ func (c *Config) Watch() {
 				continue
 			}
 
-			err := c.Load()
-			if err != nil {
-				log.WithError(err).Error("error reloading config")
-			}
-			log.WithField("services", c.Services).Info("config file updated")
-			err = c.executableSchema.UpdateServiceList(c.Services)
-			if err != nil {
-				log.WithError(err).Error("error updating services")
-			}
-			log.WithField("services", c.Services).Info("updated services")
+			c.Reload()
 		}
 	}
 }
 
+// reloadableOptions are the options applied when the config is reloaded, the
+// other options require a restart. The plugins are reconfigured, whether
+// their new config applies depends on the plugin.
+var reloadableOptions = map[string]bool{
+	"services": true,
+	"loglevel": true,
+}
+
+// Reload reloads the config files and applies the reloadable options. The
+// config isn't applied if it's invalid.
+func (c *Config) Reload() {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+
+	before := c.restartOptions()
+	if err := c.Load(); err != nil {
+		log.WithError(err).Error("error reloading config")
+		return
+	}
+	after := c.restartOptions()
+	for option, value := range after {
+		if value != before[option] {
+			log.WithField("option", option).Warn("config option changed, restart the gateway to apply it")
+		}
+	}
+
+	log.WithField("services", c.Services).Info("config file updated")
+	err := c.executableSchema.UpdateServiceList(c.Services)
+	if err != nil {
+		log.WithError(err).Error("error updating services")
+	}
+	log.WithField("services", c.Services).Info("updated services")
+}
+
+// restartOptions returns the JSON encoded values of the options that aren't
+// reloadable
+func (c *Config) restartOptions() map[string]string {
+	options := make(map[string]string)
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || reloadableOptions[name] {
+			continue
+		}
+		value, _ := json.Marshal(v.Field(i).Interface())
+		options[name] = string(value)
+	}
+	return options
+}
+
 // GetConfig returns operational config for the gateway
 func GetConfig(configFiles []string) (*Config, error) {
 	watcher, err := fsnotify.NewWatcher()
@@ -198,6 +524,7 @@ func GetConfig(configFiles []string) (*Config, error) {
 		MetricsPort:            9009,
 		LogLevel:               log.DebugLevel,
 		PollInterval:           "5s",
+		DrainTimeout:           "30s",
 		MaxRequestsPerQuery:    50,
 		MaxServiceResponseSize: 1024 * 1024,
 
@@ -221,7 +548,12 @@ func (c *Config) ConfigurePlugins() []Plugin {
 		}
 		err := p.Configure(c, pl.Config)
 		if err != nil {
-			log.WithError(err).Fatalf("error unmarshalling config for plugin %q: %s", pl.Name, err)
+			if !c.SafeMode {
+				log.WithError(err).Fatalf("error unmarshalling config for plugin %q: %s", pl.Name, err)
+			}
+			log.WithError(err).Errorf("error configuring plugin %q, plugin disabled", pl.Name)
+			c.initErrors = append(c.initErrors, fmt.Errorf("error configuring plugin %q: %w", pl.Name, err))
+			continue
 		}
 		enabledPlugins = append(enabledPlugins, p)
 	}
@@ -229,6 +561,22 @@ func (c *Config) ConfigurePlugins() []Plugin {
 	return enabledPlugins
 }
 
+// alternateServiceURLs returns the replica and canary URLs of the services,
+// which share the transport and credentials of their service
+func (c *Config) alternateServiceURLs() map[string][]string {
+	if len(c.ServiceCanaries) == 0 {
+		return c.ServiceReplicas
+	}
+	urls := make(map[string][]string, len(c.ServiceReplicas)+len(c.ServiceCanaries))
+	for service, replicas := range c.ServiceReplicas {
+		urls[service] = append(urls[service], replicas...)
+	}
+	for service, canary := range c.ServiceCanaries {
+		urls[service] = append(urls[service], canary.URL)
+	}
+	return urls
+}
+
 // Init initializes the config and does an initial fetch of the services.
 func (c *Config) Init() error {
 	var err error
@@ -239,14 +587,74 @@ func (c *Config) Init() error {
 
 	var services []*Service
 	for _, s := range c.Services {
-		services = append(services, NewService(s))
+		services = append(services, NewService(s, WithTransports(c.transports), WithCredentials(c.credentials), WithRequestSigner(c.signer), WithRecording(c.recording)))
 	}
 
-	queryClient := NewClient(WithMaxResponseSize(c.MaxServiceResponseSize), WithUserAgent(GenerateUserAgent("query")))
+	queryClientOpts := []ClientOpt{WithMaxResponseSize(c.MaxServiceResponseSize), WithUserAgent(GenerateUserAgent("query")), WithTransports(c.transports), WithCredentials(c.credentials), WithRequestSigner(c.signer), WithRecording(c.recording), WithServiceAliases(c.aliases)}
+	if c.Compression != nil && c.Compression.Downstream {
+		queryClientOpts = append(queryClientOpts, WithRequestCompression(c.Compression.MinSize))
+	}
+	queryClient := NewClient(queryClientOpts...)
 	es := newExecutableSchema(c.plugins, c.MaxRequestsPerQuery, queryClient, services...)
+	es.RejectBreakingChanges = c.RejectBreakingChanges
+	es.RolesClaim = c.RolesClaim
+	es.Joins = c.Joins
+	es.ErrorFormatter = c.errorFormatter
+	es.ServiceName = c.ServiceName
+	es.RawJSONMerge = c.RawJSONMerge
+	es.BoundaryQueryBatching = c.BoundaryQueryBatching
+	es.BoundaryCache = c.BoundaryCache.boundaryCache()
+	es.MaxConcurrentRequestsPerQuery = c.MaxConcurrentRequestsPerQuery
+	es.MaxConcurrentRequestsPerService = c.MaxConcurrentRequestsPerService
+	es.ServiceReplicas = c.ServiceReplicas
+	es.HedgingDelay = c.HedgingDelayDuration
+	es.ExecutionTimeout = c.ExecutionTimeoutDuration
+	es.DeadlineBudgeting = c.DeadlineBudgeting
+	es.SubscriptionKeepAlive = c.SubscriptionKeepAliveDuration
+	es.SubscriptionBatchWindow = c.SubscriptionBatchWindowDuration
+	es.SlowQueryLog = c.SlowQueryLog.slowQueryLog()
+	es.ServiceEndpoints = c.ServiceEndpoints
+	es.ServiceCanaries = c.ServiceCanaries
+	if c.schemaRegistry != nil {
+		es.SchemaRegistry = c.schemaRegistry
+		es.FetchServiceSchemasFromRegistry = c.SchemaRegistry.FetchServices
+		es.PinnedSchemaVersion = c.SchemaRegistry.PinnedVersion
+	}
+	es.ReadinessQuorum = c.ReadinessQuorum
+	webhookClient := &http.Client{Timeout: 5 * time.Second}
+	for _, webhook := range c.EventWebhooks {
+		es.Events.Subscribe(newWebhookHandler(webhook, webhookClient), webhook.Events...)
+	}
+	es.MaxOperationsPerClient = c.MaxOperationsPerClient
+	es.MaxSubscriptionsPerClient = c.MaxSubscriptionsPerClient
+	es.ClientIDHeader = c.ClientIDHeader
+	es.ClientMetadataHeaders = c.ClientMetadataHeaders
+	es.ReportDeprecations = c.ReportDeprecations
+	es.OperationMetrics = c.OperationMetrics
+	es.Introspection = c.Introspection
+	es.PaginationGuard = c.PaginationGuard
+	es.DirectivePassthrough = c.DirectivePassthrough
+	es.MaxQueryComplexity = c.MaxQueryComplexity
+	es.ErrorStatusCodes = c.ErrorStatusCodes
+	es.StrictResponseValidation = c.StrictResponseValidation
+	if len(c.LenientNullServices) > 0 {
+		es.LenientNullServices = make(map[string]bool, len(c.LenientNullServices))
+		for _, url := range c.LenientNullServices {
+			es.LenientNullServices[url] = true
+		}
+	}
+	es.Compression = c.Compression
+	es.SchemaTransforms = c.SchemaTransforms
+	es.ServiceSchemas = c.ServiceSchemas
+	es.ErrorClassification = c.ErrorClassification.errorClassification()
+	es.IdempotencyCacheWindow = c.IdempotencyCacheWindowDuration
 	err = es.UpdateSchema(true)
 	if err != nil {
-		return err
+		if !c.SafeMode {
+			return err
+		}
+		log.WithError(err).Error("error updating schema")
+		c.initErrors = append(c.initErrors, fmt.Errorf("error updating schema: %w", err))
 	}
 
 	c.executableSchema = es
@@ -261,6 +669,13 @@ func (c *Config) Init() error {
 	return nil
 }
 
+// InitErrors returns the errors that happened while loading and initializing
+// the configuration in safe mode. If there are any the gateway should be
+// started in safe mode.
+func (c *Config) InitErrors() []error {
+	return c.initErrors
+}
+
 type arrayFlags []string
 
 func (a *arrayFlags) String() string {
@@ -0,0 +1,192 @@
+package bramble
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configInterpolation matches the references to environment variables in the
+// config files: ${VAR}, ${VAR:-default} and the $${ escape
+var configInterpolation = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// configFileError is an error in a config file, with its position if known
+type configFileError struct {
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *configFileError) Error() string {
+	msg := strings.TrimPrefix(e.Err.Error(), "json: ")
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, msg)
+}
+
+func (e *configFileError) Unwrap() error {
+	return e.Err
+}
+
+// configFile is a JSON or YAML config file with its environment variables
+// interpolated
+type configFile struct {
+	path string
+	yaml bool
+	// source is the interpolated file, used to report the error positions
+	source []byte
+	// data is the source converted to JSON
+	data []byte
+}
+
+// readConfigFile reads a config file. Files with a .yaml or .yml extension are
+// parsed as YAML, others as JSON.
+func readConfigFile(path string) (*configFile, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	f := &configFile{path: path, yaml: ext == ".yaml" || ext == ".yml"}
+	f.source, err = f.interpolate(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if !f.yaml {
+		f.data = f.source
+		return f, nil
+	}
+
+	var v interface{}
+	if err := yaml.Unmarshal(f.source, &v); err != nil {
+		return nil, &configFileError{File: path, Err: err}
+	}
+	f.data, err = json.Marshal(yamlToJSON(v))
+	if err != nil {
+		return nil, &configFileError{File: path, Err: err}
+	}
+	return f, nil
+}
+
+// interpolate replaces the references to environment variables. A variable
+// that isn't set and has no default is an error.
+func (f *configFile) interpolate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	last := 0
+	for _, m := range configInterpolation.FindAllSubmatchIndex(data, -1) {
+		buf.Write(data[last:m[0]])
+		last = m[1]
+		if m[2] < 0 {
+			buf.WriteString("${")
+			continue
+		}
+		name := string(data[m[2]:m[3]])
+		value, ok := os.LookupEnv(name)
+		if (!ok || value == "") && m[4] >= 0 {
+			value, ok = string(data[m[4]:m[5]]), true
+		}
+		if !ok {
+			line, column := filePosition(data, m[0])
+			return nil, &configFileError{
+				File:   f.path,
+				Line:   line,
+				Column: column,
+				Err:    fmt.Errorf("environment variable %q is not set", name),
+			}
+		}
+		buf.WriteString(value)
+	}
+	buf.Write(data[last:])
+	return buf.Bytes(), nil
+}
+
+// decode decodes the file into v. Unknown options are an error.
+func (f *configFile) decode(v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(f.data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return f.errorAt(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return &configFileError{File: f.path, Err: errors.New("unexpected data after the configuration")}
+	}
+	return nil
+}
+
+// errorAt adds the position of the decoding error
+func (f *configFile) errorAt(err error) error {
+	offset := -1
+	var key string
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		// the offset is after the invalid character
+		offset = int(syntaxErr.Offset) - 1
+	case errors.As(err, &typeErr):
+		key = typeErr.Field[strings.LastIndex(typeErr.Field, ".")+1:]
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		key, _ = strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+	}
+
+	result := &configFileError{File: f.path, Err: err}
+	switch {
+	case f.yaml && key != "":
+		// there are no offsets in the YAML source, look for the key instead
+		pattern := `(?m)^[ \t]*(?:-[ \t]+)?["']?(` + regexp.QuoteMeta(key) + `)["']?[ \t]*:`
+		if loc := regexp.MustCompile(pattern).FindSubmatchIndex(f.source); loc != nil {
+			result.Line, result.Column = filePosition(f.source, loc[2])
+		}
+	case key != "":
+		if loc := regexp.MustCompile(`"` + regexp.QuoteMeta(key) + `"\s*:`).FindIndex(f.source); loc != nil {
+			result.Line, result.Column = filePosition(f.source, loc[0])
+		}
+	case !f.yaml && offset >= 0:
+		result.Line, result.Column = filePosition(f.source, offset)
+	}
+	return result
+}
+
+// filePosition returns the line and column (starting at 1) of the offset
+func filePosition(data []byte, offset int) (int, int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	line := bytes.Count(data[:offset], []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(data[:offset], '\n')
+	return line, column
+}
+
+// yamlToJSON converts the YAML maps, which can have non-string keys, to maps
+// that can be encoded to JSON
+func yamlToJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = yamlToJSON(value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = yamlToJSON(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,245 @@
+package bramble
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestConfigYAML(t *testing.T) {
+	os.Setenv("BRAMBLE_TEST_SERVICE", "http://movies/query")
+	defer os.Unsetenv("BRAMBLE_TEST_SERVICE")
+
+	path := writeConfigFile(t, "config.yaml", `
+services:
+  - ${BRAMBLE_TEST_SERVICE}
+gateway-port: ${BRAMBLE_TEST_PORT:-8090}
+poll-interval: 10s
+service-endpoints:
+  http://movies/query:
+    urls: ["http://movies-1/query", "http://movies-2/query"]
+plugins:
+  - name: cors
+    config:
+      allowed-origins: ["$${ORIGIN}"]
+`)
+	cfg, err := GetConfig([]string{path})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://movies/query"}, cfg.Services)
+	assert.Equal(t, 8090, cfg.GatewayPort)
+	assert.Equal(t, 10*time.Second, cfg.PollIntervalDuration)
+	assert.Equal(t, []string{"http://movies-1/query", "http://movies-2/query"}, cfg.ServiceEndpoints["http://movies/query"].URLs)
+	require.Len(t, cfg.Plugins, 1)
+	assert.Equal(t, "cors", cfg.Plugins[0].Name)
+	assert.JSONEq(t, `{"allowed-origins": ["${ORIGIN}"]}`, string(cfg.Plugins[0].Config))
+}
+
+func TestConfigRESTServices(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+services:
+  - http://movies/query
+rest-services:
+  people:
+    url: http://people/api
+    schema: "type Query { person(id: ID!): String }"
+    fields:
+      Query.person:
+        path: /people/{id}
+`)
+	cfg, err := GetConfig([]string{path})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"http://movies/query", "local://people"}, cfg.Services)
+	assert.IsType(t, localTransport{}, cfg.transports.For("local://people"))
+	assert.Nil(t, cfg.transports.For("http://movies/query"))
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		expected string
+	}{
+		{
+			name:     "unknown option",
+			file:     "config.json",
+			content:  "{\n  \"services\": [\"http://movies/query\"],\n  \"gateway-prot\": 8080\n}",
+			expected: `config.json:3:3: unknown field "gateway-prot"`,
+		},
+		{
+			name:     "syntax error",
+			file:     "config.json",
+			content:  "{\n  \"services\": [\"http://movies/query\"]\n  \"gateway-port\": 8080\n}",
+			expected: `config.json:3:3: invalid character '"' after object key:value pair`,
+		},
+		{
+			name:     "invalid type",
+			file:     "config.json",
+			content:  "{\n  \"services\": [\"http://movies/query\"],\n  \"gateway-port\": \"8080\"\n}",
+			expected: `config.json:3:3: cannot unmarshal string into Go struct field Config.gateway-port of type int`,
+		},
+		{
+			name:     "trailing data",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"]} {}`,
+			expected: `config.json: unexpected data after the configuration`,
+		},
+		{
+			name:     "unknown YAML option",
+			file:     "config.yml",
+			content:  "services:\n  - http://movies/query\nslow-query-log:\n  treshold: 1s\n",
+			expected: `config.yml:4:3: unknown field "treshold"`,
+		},
+		{
+			name:     "invalid YAML type",
+			file:     "config.yaml",
+			content:  "services:\n  - http://movies/query\nmax-requests-per-query: many\n",
+			expected: `config.yaml:3:1: cannot unmarshal string into Go struct field Config.max-requests-per-query of type int64`,
+		},
+		{
+			name:     "YAML syntax error",
+			file:     "config.yaml",
+			content:  "services:\n  - http://movies/query\n gateway-port: 8080\n",
+			expected: `config.yaml: yaml: line 2: did not find expected key`,
+		},
+		{
+			name:     "missing environment variable",
+			file:     "config.yaml",
+			content:  "services:\n  - ${BRAMBLE_TEST_UNSET_SERVICE}\n",
+			expected: `config.yaml:2:5: environment variable "BRAMBLE_TEST_UNSET_SERVICE" is not set`,
+		},
+		{
+			name:     "invalid value",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "readiness-quorum": 2}`,
+			expected: `invalid readiness-quorum: 2 is not between 0 and 1`,
+		},
+		{
+			name:     "invalid error status",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "error-status-codes": {"UNAUTHENTICATED": 42}}`,
+			expected: `invalid error-status-codes: 42 is not a valid status for UNAUTHENTICATED`,
+		},
+		{
+			name:     "invalid REST service",
+			file:     "config.json",
+			content:  `{"rest-services": {"people": {"url": "http://people", "schema": "type Query { person: String }"}}}`,
+			expected: `invalid REST service "people": no REST operation for field Query.person`,
+		},
+		{
+			name:     "invalid recording",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "recording": {"mode": "rewind", "directory": "recordings"}}`,
+			expected: `invalid recording: invalid mode "rewind", must be "record" or "replay"`,
+		},
+		{
+			name:     "invalid compression",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "compression": {"encodings": ["deflate"]}}`,
+			expected: `invalid compression: unsupported encoding "deflate"`,
+		},
+		{
+			name:     "invalid service schema source",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "service-schemas": {"http://movies/query": {"sdl-file": "movies.graphql", "query": "{ sdl }"}}}`,
+			expected: `invalid schema source for service "http://movies/query": exactly one of sdl-url, sdl-file and query is required`,
+		},
+		{
+			name:     "invalid error rule",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "error-classification": {"rules": [{"kind": "transport", "action": "ignore"}]}}`,
+			expected: `invalid error classification rule 0: unknown action "ignore"`,
+		},
+		{
+			name:     "invalid idempotency cache window",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "idempotency-cache-window": "a day"}`,
+			expected: `invalid idempotency cache window: time: invalid duration "a day"`,
+		},
+		{
+			name:     "empty request signing secret",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "request-signing": {"secrets": {"http://movies/query": ""}}}`,
+			expected: `invalid request signing: empty secret for service "http://movies/query"`,
+		},
+		{
+			name:     "empty mutations endpoints",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "service-endpoints": {"http://movies/query": {"mutations": {"urls": []}}}}`,
+			expected: `invalid endpoints for service "http://movies/query": mutations: at least one URL is required`,
+		},
+		{
+			name:     "invalid boundary cache TTL",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "boundary-cache": {"max-entries": 1000, "ttls": {"Currency": "a day"}}}`,
+			expected: `invalid boundary cache TTL for type "Currency": time: invalid duration "a day"`,
+		},
+		{
+			name:     "invalid subscription batch window",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "subscription-batch-window": "soon"}`,
+			expected: `invalid subscription batch window: time: invalid duration "soon"`,
+		},
+		{
+			name:     "invalid pagination guard policy",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "pagination-guard": {"policy": "ignore"}}`,
+			expected: `invalid pagination guard: unknown policy "ignore"`,
+		},
+		{
+			name:     "invalid directive passthrough policy",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "directive-passthrough": {"directives": {"live": "keep"}}}`,
+			expected: `invalid directive passthrough: directive "live": unknown policy "keep"`,
+		},
+		{
+			name:     "negative max query complexity",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "max-query-complexity": -1}`,
+			expected: `invalid max-query-complexity: must not be negative`,
+		},
+		{
+			name:     "invalid service alias prefix",
+			file:     "config.json",
+			content:  `{"services": ["http://movies/query"], "service-alias-prefixes": {"http://movies/query": "1_"}}`,
+			expected: `invalid alias prefix "1_" for service "http://movies/query": must be a name starting with a letter`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, tt.file, tt.content)
+			_, err := GetConfig([]string{path})
+			require.Error(t, err)
+			assert.Equal(t, tt.expected, strings.TrimPrefix(err.Error(), filepath.Dir(path)+string(filepath.Separator)))
+		})
+	}
+}
+
+func TestConfigRestartOptions(t *testing.T) {
+	cfg := &Config{GatewayPort: 8082, Services: []string{"http://movies/query"}}
+	before := cfg.restartOptions()
+	assert.NotContains(t, before, "services")
+	assert.NotContains(t, before, "loglevel")
+
+	cfg.Services = append(cfg.Services, "http://actors/query")
+	assert.Equal(t, before, cfg.restartOptions())
+
+	cfg.GatewayPort = 8090
+	after := cfg.restartOptions()
+	assert.Equal(t, "8090", after["gateway-port"])
+	assert.Equal(t, "8082", before["gateway-port"])
+}
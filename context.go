@@ -3,6 +3,9 @@ package bramble
 import (
 	"context"
 	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 type contextKey string
@@ -10,6 +13,23 @@ type brambleContextKey int
 
 const permissionsContextKey brambleContextKey = 1
 const requestHeaderContextKey brambleContextKey = 2
+const requestLimitsContextKey brambleContextKey = 3
+const claimsContextKey brambleContextKey = 4
+const localeContextKey brambleContextKey = 5
+const responseHeadersContextKey brambleContextKey = 6
+const serviceRequestHeadersContextKey brambleContextKey = 7
+const requestIDContextKey brambleContextKey = 8
+const downstreamExtensionsContextKey brambleContextKey = 9
+const schemaSkewDetectorContextKey brambleContextKey = 10
+const clientIDContextKey brambleContextKey = 11
+const payloadSizesContextKey brambleContextKey = 12
+const subscriptionEventContextKey brambleContextKey = 13
+const canaryContextKey brambleContextKey = 14
+const responseErrorCodesContextKey brambleContextKey = 15
+const idempotencyKeyContextKey brambleContextKey = 16
+const operationFingerprintContextKey brambleContextKey = 17
+const responseEncodingContextKey brambleContextKey = 18
+const loggerContextKey brambleContextKey = 19
 
 // AddPermissionsToContext adds permissions to the request context. If
 // permissions are set the execution will check them against the query.
@@ -47,3 +67,126 @@ func GetOutgoingRequestHeadersFromContext(ctx context.Context) http.Header {
 	h, _ := ctx.Value(requestHeaderContextKey).(http.Header)
 	return h
 }
+
+// AddOutgoingServiceRequestHeadersToContext adds headers to the outgoing
+// requests to a single service (identified by its URL) for the current query.
+// They take precedence over the headers added for all services.
+func AddOutgoingServiceRequestHeadersToContext(ctx context.Context, serviceURL string, header http.Header) context.Context {
+	existing, _ := ctx.Value(serviceRequestHeadersContextKey).(map[string]http.Header)
+	headers := make(map[string]http.Header, len(existing)+1)
+	for url, h := range existing {
+		headers[url] = h
+	}
+
+	h := headers[serviceURL].Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	for key, values := range header {
+		h[key] = append(h[key], values...)
+	}
+	headers[serviceURL] = h
+
+	return context.WithValue(ctx, serviceRequestHeadersContextKey, headers)
+}
+
+// GetOutgoingServiceRequestHeadersFromContext returns the headers that should
+// be added to outgoing requests to the given service: the headers added for
+// all services and the service specific ones.
+func GetOutgoingServiceRequestHeadersFromContext(ctx context.Context, serviceURL string) http.Header {
+	h := GetOutgoingRequestHeadersFromContext(ctx)
+	headers, _ := ctx.Value(serviceRequestHeadersContextKey).(map[string]http.Header)
+	serviceHeaders := headers[serviceURL]
+	if len(serviceHeaders) == 0 {
+		return h
+	}
+
+	result := h.Clone()
+	if result == nil {
+		result = make(http.Header)
+	}
+	for key, values := range serviceHeaders {
+		result[key] = values
+	}
+	return result
+}
+
+// AddRequestIDToContext adds the ID of the incoming request to the context
+func AddRequestIDToContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+// GetRequestIDFromContext returns the ID of the incoming request, or an empty
+// string
+func GetRequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+func addLoggerToContext(ctx context.Context, logger *log.Entry) context.Context {
+	return context.WithValue(ctx, loggerContextKey, logger)
+}
+
+// GetLoggerFromContext returns the logger of the incoming request, logging
+// its ID in the request.id field, or the standard logger
+func GetLoggerFromContext(ctx context.Context) *log.Entry {
+	if logger, ok := ctx.Value(loggerContextKey).(*log.Entry); ok {
+		return logger
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// RequestLimits contains the limits that apply to a single request. They are
+// used by transports that can't rely on HTTP level limits (e.g. websockets).
+type RequestLimits struct {
+	MaxRequestBytes int64
+	MaxResponseTime time.Duration
+}
+
+// AddRequestLimitsToContext adds the request limits to the context
+func AddRequestLimitsToContext(ctx context.Context, limits RequestLimits) context.Context {
+	return context.WithValue(ctx, requestLimitsContextKey, limits)
+}
+
+// GetRequestLimitsFromContext returns the request limits stored in the context
+func GetRequestLimitsFromContext(ctx context.Context) (RequestLimits, bool) {
+	limits, ok := ctx.Value(requestLimitsContextKey).(RequestLimits)
+	return limits, ok
+}
+
+// AddClaimsToContext adds the claims of the authenticated user (e.g. JWT
+// claims) to the context
+func AddClaimsToContext(ctx context.Context, claims map[string]interface{}) context.Context {
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+// GetClaimsFromContext returns the claims stored in the context
+func GetClaimsFromContext(ctx context.Context) (map[string]interface{}, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(map[string]interface{})
+	return claims, ok
+}
+
+// AddClientIDToContext adds the ID of the client (e.g. API key or user) to the
+// context. The per-client limits are counted against this ID.
+func AddClientIDToContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, clientIDContextKey, id)
+}
+
+// GetClientIDFromContext returns the client ID stored in the context
+func GetClientIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(clientIDContextKey).(string)
+	return id
+}
+
+// AddIdempotencyKeyToContext adds the idempotency key of the operation to the
+// context. It's sent to the services with the requests of the mutations.
+func AddIdempotencyKeyToContext(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey, key)
+}
+
+// GetIdempotencyKeyFromContext returns the idempotency key stored in the
+// context, or an empty string
+func GetIdempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyContextKey).(string)
+	return key
+}
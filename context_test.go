@@ -19,3 +19,25 @@ func TestContextOutgoingRequestHeaders(t *testing.T) {
 		"My-Header-2": []string{"value3"},
 	}, header)
 }
+
+func TestContextOutgoingServiceRequestHeaders(t *testing.T) {
+	ctx := context.Background()
+	ctx = AddOutgoingRequestsHeaderToContext(ctx, "My-Header-1", "value1")
+	ctx = AddOutgoingRequestsHeaderToContext(ctx, "My-Header-2", "value2")
+	ctx = AddOutgoingServiceRequestHeadersToContext(ctx, "http://service-a", http.Header{
+		"My-Header-2": []string{"service-a"},
+	})
+	ctx = AddOutgoingServiceRequestHeadersToContext(ctx, "http://service-a", http.Header{
+		"My-Header-3": []string{"value3"},
+	})
+
+	assert.Equal(t, http.Header{
+		"My-Header-1": []string{"value1"},
+		"My-Header-2": []string{"service-a"},
+		"My-Header-3": []string{"value3"},
+	}, GetOutgoingServiceRequestHeadersFromContext(ctx, "http://service-a"))
+	assert.Equal(t, http.Header{
+		"My-Header-1": []string{"value1"},
+		"My-Header-2": []string{"value2"},
+	}, GetOutgoingServiceRequestHeadersFromContext(ctx, "http://service-b"))
+}
@@ -0,0 +1,51 @@
+package bramble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// stepPhases returns the number of sequential phases of the steps of the
+// plan: the step itself and the longest chain of its child steps
+func stepPhases(steps []*QueryPlanStep, phases map[*QueryPlanStep]int) int {
+	max := 0
+	for _, step := range steps {
+		n := 1 + stepPhases(step.Then, phases)
+		phases[step] = n
+		if n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// withStepDeadline returns the context of a request of the step with the
+// deadline budget of the step: the time left before the execution deadline
+// is split evenly between the step and the sequential phases of its child
+// steps, so a slow step doesn't use the time of the steps depending on it.
+// The context is returned as is if the budgeting is disabled, the context
+// has no deadline or the step has no child steps.
+func (e *QueryExecution) withStepDeadline(ctx context.Context, step *QueryPlanStep) (context.Context, context.CancelFunc) {
+	phases := e.stepPhases[step]
+	deadline, ok := ctx.Deadline()
+	if phases <= 1 || !ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, time.Until(deadline)/time.Duration(phases))
+}
+
+// budgetExceededError returns the error of a request of the step that didn't
+// complete within the deadline budget of the step, while the execution
+// deadline isn't exceeded
+func budgetExceededError(ctx, stepCtx context.Context, err error) error {
+	if err == nil || ctx.Err() != nil || !errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	var gqlErr GraphqlErrors
+	if errors.As(err, &gqlErr) {
+		return err
+	}
+	return fmt.Errorf("%w: the step did not complete within its deadline budget", ErrExecutionTimeout)
+}
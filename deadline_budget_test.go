@@ -0,0 +1,134 @@
+package bramble
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestStepPhases(t *testing.T) {
+	leaf := &QueryPlanStep{}
+	child := &QueryPlanStep{Then: []*QueryPlanStep{leaf}}
+	sibling := &QueryPlanStep{}
+	root := &QueryPlanStep{Then: []*QueryPlanStep{child, sibling}}
+	other := &QueryPlanStep{}
+
+	phases := map[*QueryPlanStep]int{}
+	assert.Equal(t, 3, stepPhases([]*QueryPlanStep{root, other}, phases))
+	assert.Equal(t, map[*QueryPlanStep]int{
+		root:    3,
+		child:   2,
+		leaf:    1,
+		sibling: 1,
+		other:   1,
+	}, phases)
+}
+
+func deadlineBudgetTestServices(rootDelay, childDelay time.Duration) []testService {
+	return []testService{
+		{
+			name: "movies",
+			schema: `directive @boundary on OBJECT
+			type Movie @boundary {
+				id: ID!
+				title: String
+			}
+
+			type Query {
+				movie(id: ID!): Movie
+			}`,
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// the connection is watched once the body is read
+				io.Copy(ioutil.Discard, r.Body)
+				select {
+				case <-time.After(rootDelay):
+					w.Write([]byte(`{ "data": { "movie": { "_id": "1", "title": "Test title" } } }`))
+				case <-r.Context().Done():
+				}
+			}),
+		},
+		{
+			name: "releases",
+			schema: `directive @boundary on OBJECT
+			interface Node { id: ID! }
+
+			type Movie @boundary {
+				id: ID!
+				release: Int
+			}
+
+			type Query {
+				node(id: ID!): Node!
+			}`,
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// the connection is watched once the body is read
+				io.Copy(ioutil.Discard, r.Body)
+				select {
+				case <-time.After(childDelay):
+					w.Write([]byte(`{ "data": { "_0": { "_id": "1", "release": 2007 } } }`))
+				case <-r.Context().Done():
+				}
+			}),
+		},
+	}
+}
+
+func TestDeadlineBudgetingLeavesTimeToChildSteps(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: deadlineBudgetTestServices(10*time.Millisecond, 200*time.Millisecond),
+		query: `{
+			movie(id: "1") {
+				title
+				release
+			}
+		}`,
+		executionTimeout:  500 * time.Millisecond,
+		deadlineBudgeting: true,
+		expected: `{
+			"movie": {
+				"title": "Test title",
+				"release": 2007
+			}
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestDeadlineBudgetingCancelsSlowRootStep(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: deadlineBudgetTestServices(time.Second, 0),
+		query: `{
+			movie(id: "1") {
+				title
+				release
+			}
+		}`,
+		executionTimeout:  200 * time.Millisecond,
+		deadlineBudgeting: true,
+		expected: `{
+			"movie": null
+		}`,
+		errors: gqlerror.List{{
+			Message:   "execution timeout exceeded: the step did not complete within its deadline budget",
+			Path:      ast.Path{ast.PathName("movie")},
+			Locations: []gqlerror.Location{{Line: 2, Column: 4}},
+			Extensions: map[string]interface{}{
+				"code":         "EXECUTION_TIMEOUT",
+				"selectionSet": `{ movie(id: "1") { _id: id title } }`,
+				"serviceName":  "movies",
+			},
+		}},
+	}
+
+	start := time.Now()
+	f.run(t)
+	jsonEqWithOrder(t, f.expected, string(f.resp.Data))
+	assert.Less(t, int64(time.Since(start)), int64(200*time.Millisecond))
+}
@@ -0,0 +1,58 @@
+package bramble
+
+import (
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// DeprecationWarning is a deprecated field selected by an operation, as
+// reported in the deprecations extension of the response
+type DeprecationWarning struct {
+	// Field is the coordinate of the field (Type.field)
+	Field  string `json:"field"`
+	Reason string `json:"reason,omitempty"`
+	// Path is the response path of the field, without list indices
+	Path []string `json:"path"`
+}
+
+// deprecationWarnings returns the deprecated fields selected by the operation
+func deprecationWarnings(op *ast.OperationDefinition) []DeprecationWarning {
+	var warnings []DeprecationWarning
+	seen := make(map[string]bool)
+	var walk func(selectionSet ast.SelectionSet, path []string)
+	walk = func(selectionSet ast.SelectionSet, path []string) {
+		for _, selection := range selectionSet {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				fieldPath := append(path[:len(path):len(path)], selection.Alias)
+				if selection.Definition != nil && selection.ObjectDefinition != nil {
+					if deprecated, reason := hasDeprecatedDirective(selection.Definition.Directives); deprecated {
+						field := selection.ObjectDefinition.Name + "." + selection.Name
+						key := field + " " + strings.Join(fieldPath, ".")
+						if !seen[key] {
+							seen[key] = true
+							warnings = append(warnings, DeprecationWarning{Field: field, Reason: *reason, Path: fieldPath})
+						}
+					}
+				}
+				walk(selection.SelectionSet, fieldPath)
+			case *ast.InlineFragment:
+				walk(selection.SelectionSet, path)
+			case *ast.FragmentSpread:
+				if selection.Definition != nil {
+					walk(selection.Definition.SelectionSet, path)
+				}
+			}
+		}
+	}
+	walk(op.SelectionSet, nil)
+	return warnings
+}
+
+// observeDeprecationWarnings counts the uses of the deprecated fields
+func observeDeprecationWarnings(warnings []DeprecationWarning) {
+	for _, w := range warnings {
+		promDeprecatedFieldUsages.WithLabelValues(w.Field).Inc()
+	}
+}
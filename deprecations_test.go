@@ -0,0 +1,48 @@
+package bramble
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+)
+
+func TestDeprecationWarnings(t *testing.T) {
+	srv := newTestService(t, "movies", `
+		type Service { name: String! version: String! schema: String! }
+		type Movie {
+			id: ID!
+			title: String! @deprecated(reason: "use name")
+			name: String!
+			rating: Int @deprecated
+		}
+		type Query { service: Service! movies: [Movie!]! }`, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{ "data": { "movies": [{ "id": "1", "title": "Alien", "name": "Alien", "rating": 5 }] } }`)
+	})
+
+	es := newExecutableSchema(nil, 50, nil, NewService(srv.URL))
+	require.NoError(t, es.UpdateSchema(true))
+
+	query := `{ movies { id title ... on Movie { title } name: title rating } }`
+	execute := func() map[string]interface{} {
+		doc := gqlparser.MustLoadQuery(es.MergedSchema, query)
+		ctx := testContextWithVariables(nil, doc.Operations[0])
+		ctx = graphql.WithResponseContext(ctx, graphql.DefaultErrorPresenter, graphql.DefaultRecover)
+		resp := es.ExecuteQuery(ctx)
+		require.Empty(t, resp.Errors)
+		return graphql.GetExtensions(ctx)
+	}
+
+	assert.NotContains(t, execute(), "deprecations")
+
+	es.ReportDeprecations = true
+	assert.Equal(t, []DeprecationWarning{
+		{Field: "Movie.title", Reason: "use name", Path: []string{"movies", "title"}},
+		{Field: "Movie.title", Reason: "use name", Path: []string{"movies", "name"}},
+		{Field: "Movie.rating", Path: []string{"movies", "rating"}},
+	}, execute()["deprecations"])
+}
@@ -0,0 +1,291 @@
+package bramble
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// ChangeCriticality is the impact of a schema change on existing clients
+type ChangeCriticality string
+
+const (
+	// ChangeBreaking changes will break existing queries
+	ChangeBreaking ChangeCriticality = "BREAKING"
+	// ChangeDangerous changes won't break queries but could break clients
+	// (e.g. an enum value was added and the client does an exhaustive match)
+	ChangeDangerous ChangeCriticality = "DANGEROUS"
+	// ChangeSafe changes are backward compatible
+	ChangeSafe ChangeCriticality = "SAFE"
+)
+
+// SchemaChange is a single change between two versions of a schema
+type SchemaChange struct {
+	Criticality ChangeCriticality `json:"criticality"`
+	// Path of the changed element, e.g. "Movie.title"
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// DiffSchemas returns the list of changes from oldSchema to newSchema
+func DiffSchemas(oldSchema, newSchema *ast.Schema) []SchemaChange {
+	if oldSchema == nil || newSchema == nil {
+		return nil
+	}
+
+	d := schemaDiff{}
+
+	for _, name := range sortedTypeNames(oldSchema) {
+		if isGraphQLBuiltinName(name) {
+			continue
+		}
+		oldType := oldSchema.Types[name]
+		newType, ok := newSchema.Types[name]
+		if !ok {
+			d.add(ChangeBreaking, name, "type %s was removed", name)
+			continue
+		}
+
+		if oldType.Kind != newType.Kind {
+			d.add(ChangeBreaking, name, "type %s changed kind from %s to %s", name, oldType.Kind, newType.Kind)
+			continue
+		}
+
+		d.diffTypes(oldType, newType)
+	}
+
+	for _, name := range sortedTypeNames(newSchema) {
+		if isGraphQLBuiltinName(name) {
+			continue
+		}
+		if _, ok := oldSchema.Types[name]; !ok {
+			d.add(ChangeSafe, name, "type %s was added", name)
+		}
+	}
+
+	return d.changes
+}
+
+// BreakingChanges returns the list of changes from oldSchema to newSchema
+// that could break existing clients.
+func BreakingChanges(oldSchema, newSchema *ast.Schema) []SchemaChange {
+	return FilterSchemaChanges(DiffSchemas(oldSchema, newSchema), ChangeBreaking)
+}
+
+// FilterSchemaChanges returns the changes with the given criticality
+func FilterSchemaChanges(changes []SchemaChange, criticality ChangeCriticality) []SchemaChange {
+	var result []SchemaChange
+	for _, c := range changes {
+		if c.Criticality == criticality {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+type schemaDiff struct {
+	changes []SchemaChange
+}
+
+func (d *schemaDiff) add(criticality ChangeCriticality, path string, format string, args ...interface{}) {
+	d.changes = append(d.changes, SchemaChange{
+		Criticality: criticality,
+		Path:        path,
+		Message:     fmt.Sprintf(format, args...),
+	})
+}
+
+func (d *schemaDiff) diffTypes(oldType, newType *ast.Definition) {
+	switch oldType.Kind {
+	case ast.Object, ast.Interface:
+		for _, i := range oldType.Interfaces {
+			if !stringSliceContains(newType.Interfaces, i) {
+				d.add(ChangeBreaking, oldType.Name, "%s no longer implements interface %s", oldType.Name, i)
+			}
+		}
+		for _, i := range newType.Interfaces {
+			if !stringSliceContains(oldType.Interfaces, i) {
+				d.add(ChangeDangerous, oldType.Name, "%s now implements interface %s", oldType.Name, i)
+			}
+		}
+		for _, oldField := range oldType.Fields {
+			if isGraphQLBuiltinName(oldField.Name) {
+				continue
+			}
+			path := oldType.Name + "." + oldField.Name
+			newField := newType.Fields.ForName(oldField.Name)
+			if newField == nil {
+				d.add(ChangeBreaking, path, "field %s was removed", path)
+				continue
+			}
+			d.diffOutputTypes(path, "field", oldField.Type, newField.Type)
+			d.diffArguments(path, oldField.Arguments, newField.Arguments)
+
+			oldDeprecated, _ := hasDeprecatedDirective(oldField.Directives)
+			newDeprecated, _ := hasDeprecatedDirective(newField.Directives)
+			if !oldDeprecated && newDeprecated {
+				d.add(ChangeSafe, path, "field %s was deprecated", path)
+			}
+		}
+		for _, newField := range newType.Fields {
+			if isGraphQLBuiltinName(newField.Name) {
+				continue
+			}
+			if oldType.Fields.ForName(newField.Name) == nil {
+				path := newType.Name + "." + newField.Name
+				d.add(ChangeSafe, path, "field %s was added", path)
+			}
+		}
+	case ast.InputObject:
+		for _, oldField := range oldType.Fields {
+			path := oldType.Name + "." + oldField.Name
+			newField := newType.Fields.ForName(oldField.Name)
+			if newField == nil {
+				d.add(ChangeBreaking, path, "input field %s was removed", path)
+				continue
+			}
+			d.diffInputTypes(path, "input field", oldField.Type, newField.Type)
+		}
+		for _, newField := range newType.Fields {
+			if oldType.Fields.ForName(newField.Name) != nil {
+				continue
+			}
+			path := newType.Name + "." + newField.Name
+			if newField.Type.NonNull && newField.DefaultValue == nil {
+				d.add(ChangeBreaking, path, "required input field %s was added", path)
+			} else {
+				d.add(ChangeSafe, path, "optional input field %s was added", path)
+			}
+		}
+	case ast.Enum:
+		for _, v := range oldType.EnumValues {
+			if newType.EnumValues.ForName(v.Name) == nil {
+				path := oldType.Name + "." + v.Name
+				d.add(ChangeBreaking, path, "enum value %s was removed", path)
+			}
+		}
+		for _, v := range newType.EnumValues {
+			if oldType.EnumValues.ForName(v.Name) == nil {
+				path := newType.Name + "." + v.Name
+				d.add(ChangeDangerous, path, "enum value %s was added", path)
+			}
+		}
+	case ast.Union:
+		for _, t := range oldType.Types {
+			if !stringSliceContains(newType.Types, t) {
+				d.add(ChangeBreaking, oldType.Name, "member %s was removed from union %s", t, oldType.Name)
+			}
+		}
+		for _, t := range newType.Types {
+			if !stringSliceContains(oldType.Types, t) {
+				d.add(ChangeDangerous, oldType.Name, "member %s was added to union %s", t, oldType.Name)
+			}
+		}
+	}
+}
+
+func (d *schemaDiff) diffArguments(fieldPath string, oldArgs, newArgs ast.ArgumentDefinitionList) {
+	for _, oldArg := range oldArgs {
+		path := fmt.Sprintf("%s(%s:)", fieldPath, oldArg.Name)
+		newArg := newArgs.ForName(oldArg.Name)
+		if newArg == nil {
+			d.add(ChangeBreaking, path, "argument %s was removed", path)
+			continue
+		}
+		d.diffInputTypes(path, "argument", oldArg.Type, newArg.Type)
+		if valueString(oldArg.DefaultValue) != valueString(newArg.DefaultValue) {
+			d.add(ChangeDangerous, path, "argument %s default value changed from %q to %q", path, valueString(oldArg.DefaultValue), valueString(newArg.DefaultValue))
+		}
+	}
+	for _, newArg := range newArgs {
+		if oldArgs.ForName(newArg.Name) != nil {
+			continue
+		}
+		path := fmt.Sprintf("%s(%s:)", fieldPath, newArg.Name)
+		if newArg.Type.NonNull && newArg.DefaultValue == nil {
+			d.add(ChangeBreaking, path, "required argument %s was added", path)
+		} else {
+			d.add(ChangeDangerous, path, "optional argument %s was added", path)
+		}
+	}
+}
+
+func (d *schemaDiff) diffOutputTypes(path, kind string, oldType, newType *ast.Type) {
+	if oldType.String() == newType.String() {
+		return
+	}
+	if isSafeOutputTypeChange(oldType, newType) {
+		d.add(ChangeSafe, path, "%s %s changed type from %s to %s", kind, path, oldType, newType)
+		return
+	}
+	d.add(ChangeBreaking, path, "%s %s changed type from %s to %s", kind, path, oldType, newType)
+}
+
+func (d *schemaDiff) diffInputTypes(path, kind string, oldType, newType *ast.Type) {
+	if oldType.String() == newType.String() {
+		return
+	}
+	if isSafeInputTypeChange(oldType, newType) {
+		d.add(ChangeSafe, path, "%s %s changed type from %s to %s", kind, path, oldType, newType)
+		return
+	}
+	d.add(ChangeBreaking, path, "%s %s changed type from %s to %s", kind, path, oldType, newType)
+}
+
+// isSafeOutputTypeChange returns whether changing an output field type from
+// oldType to newType is safe for clients. Output types can only become
+// stricter (nullable to non-nullable).
+func isSafeOutputTypeChange(oldType, newType *ast.Type) bool {
+	if oldType.NonNull && !newType.NonNull {
+		return false
+	}
+	if (oldType.Elem == nil) != (newType.Elem == nil) {
+		return false
+	}
+	if oldType.Elem != nil {
+		return isSafeOutputTypeChange(oldType.Elem, newType.Elem)
+	}
+	return oldType.NamedType == newType.NamedType
+}
+
+// isSafeInputTypeChange returns whether changing an input type from oldType
+// to newType is safe for clients. Input types can only become more lenient
+// (non-nullable to nullable).
+func isSafeInputTypeChange(oldType, newType *ast.Type) bool {
+	if !oldType.NonNull && newType.NonNull {
+		return false
+	}
+	if (oldType.Elem == nil) != (newType.Elem == nil) {
+		return false
+	}
+	if oldType.Elem != nil {
+		return isSafeInputTypeChange(oldType.Elem, newType.Elem)
+	}
+	return oldType.NamedType == newType.NamedType
+}
+
+func valueString(v *ast.Value) string {
+	if v == nil {
+		return ""
+	}
+	return v.String()
+}
+
+func sortedTypeNames(schema *ast.Schema) []string {
+	names := make([]string, 0, len(schema.Types))
+	for name := range schema.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func stringSliceContains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package bramble
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	oldSchema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		enum Color {
+			RED
+			GREEN
+		}
+
+		union Animal = Cat | Dog
+
+		type Cat { name: String! }
+		type Dog { name: String! }
+		type Bird { name: String! }
+
+		input Filter {
+			name: String
+			color: Color!
+		}
+
+		type Gizmo {
+			id: ID!
+			name: String
+			color: Color!
+			size: Int!
+		}
+
+		type Query {
+			gizmo(id: ID!, filter: Filter): Gizmo
+			gizmos(limit: Int = 10): [Gizmo!]!
+		}
+	`})
+	newSchema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		enum Color {
+			RED
+			BLUE
+		}
+
+		union Animal = Cat | Bird
+
+		type Cat { name: String! }
+		type Dog { name: String! }
+		type Bird { name: String! }
+
+		input Filter {
+			name: String
+			color: Color
+			size: Int!
+		}
+
+		type Gizmo {
+			id: ID!
+			name: String!
+			color: Color! @deprecated
+			weight: Float
+		}
+
+		type Widget {
+			id: ID!
+		}
+
+		type Query {
+			gizmo(id: ID!, filter: Filter, exact: Boolean): Gizmo
+			gizmos(limit: Int = 20): [Gizmo!]!
+		}
+	`})
+
+	assert.Equal(t, []SchemaChange{
+		{ChangeBreaking, "Animal", "member Dog was removed from union Animal"},
+		{ChangeDangerous, "Animal", "member Bird was added to union Animal"},
+		{ChangeBreaking, "Color.GREEN", "enum value Color.GREEN was removed"},
+		{ChangeDangerous, "Color.BLUE", "enum value Color.BLUE was added"},
+		{ChangeSafe, "Filter.color", "input field Filter.color changed type from Color! to Color"},
+		{ChangeBreaking, "Filter.size", "required input field Filter.size was added"},
+		{ChangeSafe, "Gizmo.name", "field Gizmo.name changed type from String to String!"},
+		{ChangeSafe, "Gizmo.color", "field Gizmo.color was deprecated"},
+		{ChangeBreaking, "Gizmo.size", "field Gizmo.size was removed"},
+		{ChangeSafe, "Gizmo.weight", "field Gizmo.weight was added"},
+		{ChangeDangerous, "Query.gizmo(exact:)", "optional argument Query.gizmo(exact:) was added"},
+		{ChangeDangerous, "Query.gizmos(limit:)", `argument Query.gizmos(limit:) default value changed from "10" to "20"`},
+		{ChangeSafe, "Widget", "type Widget was added"},
+	}, DiffSchemas(oldSchema, newSchema))
+}
+
+func TestUpdateSchemaRejectsBreakingChanges(t *testing.T) {
+	schema := `
+		type Service {
+			name: String!
+			version: String!
+			schema: String!
+		}
+
+		type Query {
+			service: Service!
+			foo: String
+			bar: String
+		}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodedSchema, _ := json.Marshal(schema)
+		fmt.Fprintf(w, `{
+			"data": {
+				"service": {
+					"schema": %s,
+					"version": "1.0",
+					"name": "test-service"
+				}
+			}
+		}`, string(encodedSchema))
+	}))
+	defer server.Close()
+
+	es := newExecutableSchema(nil, 50, nil, NewService(server.URL))
+	es.RejectBreakingChanges = true
+	require.NoError(t, es.UpdateSchema(true))
+	assert.NotNil(t, es.MergedSchema.Query.Fields.ForName("bar"))
+
+	schema = `
+		type Service {
+			name: String!
+			version: String!
+			schema: String!
+		}
+
+		type Query {
+			service: Service!
+			foo: String
+		}`
+
+	require.Error(t, es.UpdateSchema(false))
+	assert.NotNil(t, es.MergedSchema.Query.Fields.ForName("bar"))
+	report := es.LastSchemaChanges()
+	assert.False(t, report.Applied)
+	assert.Equal(t, []SchemaChange{
+		{ChangeBreaking, "Query.bar", "field Query.bar was removed"},
+	}, report.Changes)
+
+	require.NoError(t, es.ForceSchemaUpdate())
+	assert.Nil(t, es.MergedSchema.Query.Fields.ForName("bar"))
+	assert.True(t, es.LastSchemaChanges().Applied)
+}
+
+func TestServiceRemovalRejectedBreakingChange(t *testing.T) {
+	newServer := func(field string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			schema := fmt.Sprintf(`
+				type Service {
+					name: String!
+					version: String!
+					schema: String!
+				}
+
+				type Query {
+					service: Service!
+					%s: String
+				}`, field)
+			encodedSchema, _ := json.Marshal(schema)
+			fmt.Fprintf(w, `{
+				"data": {
+					"service": {
+						"schema": %s,
+						"version": "1.0",
+						"name": "%s-service"
+					}
+				}
+			}`, string(encodedSchema), field)
+		}))
+	}
+	foo := newServer("foo")
+	defer foo.Close()
+	bar := newServer("bar")
+	defer bar.Close()
+
+	es := newExecutableSchema(nil, 50, nil, NewService(foo.URL), NewService(bar.URL))
+	es.RejectBreakingChanges = true
+	require.NoError(t, es.UpdateSchema(true))
+
+	require.Error(t, es.UpdateServiceList([]string{foo.URL}))
+	assert.Len(t, es.Services, 2)
+	assert.NotNil(t, es.MergedSchema.Query.Fields.ForName("bar"))
+	report := es.LastSchemaChanges()
+	assert.False(t, report.Applied)
+	assert.Equal(t, []string{bar.URL}, report.RemovedServices)
+
+	require.NoError(t, es.ForceSchemaUpdate())
+	assert.Len(t, es.Services, 1)
+	assert.Nil(t, es.MergedSchema.Query.Fields.ForName("bar"))
+	assert.True(t, es.LastSchemaChanges().Applied)
+}
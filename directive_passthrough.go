@@ -0,0 +1,200 @@
+package bramble
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// DirectivePolicy is the handling of the executable directives defined by the
+// services (e.g. @live, @stream) in the client operations
+type DirectivePolicy string
+
+const (
+	// StripDirectivePolicy accepts the directive in the operations but
+	// removes it from the documents sent to the services
+	StripDirectivePolicy DirectivePolicy = "strip"
+	// ForwardDirectivePolicy accepts the directive in the operations and
+	// sends it to the services defining it, in the documents of their steps
+	ForwardDirectivePolicy DirectivePolicy = "forward"
+	// RejectDirectivePolicy leaves the directive out of the merged schema,
+	// the operations using it fail the validation
+	RejectDirectivePolicy DirectivePolicy = "reject"
+)
+
+// executableDirectiveLocations are the locations of the directives used in
+// the operations
+var executableDirectiveLocations = map[ast.DirectiveLocation]bool{
+	ast.LocationQuery:              true,
+	ast.LocationMutation:           true,
+	ast.LocationSubscription:       true,
+	ast.LocationField:              true,
+	ast.LocationFragmentDefinition: true,
+	ast.LocationFragmentSpread:     true,
+	ast.LocationInlineFragment:     true,
+}
+
+// DirectivePassthroughConfig is the policy for the executable directives
+// defined by the services but not handled by the gateway. The directives
+// that aren't rejected are added to the merged schema, with the definition of
+// the first service defining them.
+type DirectivePassthroughConfig struct {
+	// Policy is the policy of the directives without override, defaults to
+	// reject
+	Policy DirectivePolicy `json:"policy"`
+	// Directives are the policies overriding Policy, by directive name
+	Directives map[string]DirectivePolicy `json:"directives"`
+}
+
+// Validate checks the policies are valid
+func (c DirectivePassthroughConfig) Validate() error {
+	if err := validateDirectivePolicy(c.Policy); err != nil {
+		return err
+	}
+	for name, policy := range c.Directives {
+		if allowedDirective(name) {
+			return fmt.Errorf("directive %q is handled by the gateway", name)
+		}
+		if err := validateDirectivePolicy(policy); err != nil {
+			return fmt.Errorf("directive %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func validateDirectivePolicy(policy DirectivePolicy) error {
+	switch policy {
+	case "", StripDirectivePolicy, ForwardDirectivePolicy, RejectDirectivePolicy:
+		return nil
+	}
+	return fmt.Errorf("unknown policy %q", policy)
+}
+
+// policy returns the policy of the directive
+func (c DirectivePassthroughConfig) policy(name string) DirectivePolicy {
+	policy, ok := c.Directives[name]
+	if !ok {
+		policy = c.Policy
+	}
+	if policy == "" {
+		return RejectDirectivePolicy
+	}
+	return policy
+}
+
+// addPassthroughDirectives adds the executable directives of the services
+// that aren't rejected to the merged schema
+func addPassthroughDirectives(schema *ast.Schema, services []*Service, config DirectivePassthroughConfig) {
+	for _, service := range services {
+		for name, def := range service.Schema.Directives {
+			if allowedDirective(name) || schema.Directives[name] != nil || !isExecutableDirective(def) {
+				continue
+			}
+			if config.policy(name) == RejectDirectivePolicy {
+				continue
+			}
+			schema.Directives[name] = def
+		}
+	}
+}
+
+func isExecutableDirective(def *ast.DirectiveDefinition) bool {
+	for _, location := range def.Locations {
+		if executableDirectiveLocations[location] {
+			return true
+		}
+	}
+	return false
+}
+
+// isPassthroughDirective returns whether the directive comes from the
+// services, the directives handled by the gateway aren't merged otherwise
+func (s *ExecutableSchema) isPassthroughDirective(name string) bool {
+	return !allowedDirective(name) && s.MergedSchema != nil && s.MergedSchema.Directives[name] != nil
+}
+
+// forwardedDirectives returns the directives sent to the service: the
+// stripped directives, and the forwarded directives the service doesn't
+// define, are removed. The mutex must be held.
+func (s *ExecutableSchema) forwardedDirectives(directives ast.DirectiveList, serviceURL string) ast.DirectiveList {
+	var result ast.DirectiveList
+	for _, d := range directives {
+		if s.isPassthroughDirective(d.Name) {
+			if s.DirectivePassthrough.policy(d.Name) != ForwardDirectivePolicy {
+				continue
+			}
+			service, ok := s.Services[serviceURL]
+			if !ok || service.Schema == nil || service.Schema.Directives[d.Name] == nil {
+				continue
+			}
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+// applyDirectivePassthrough filters the directives of the fields of the
+// operation, according to the service resolving each field. The operation
+// must be a copy (see evaluateSkipAndInclude). The mutex must be held.
+func (s *ExecutableSchema) applyDirectivePassthrough(op *ast.OperationDefinition) {
+	if s.DirectivePassthrough.Policy == "" && len(s.DirectivePassthrough.Directives) == 0 {
+		return
+	}
+	var root string
+	switch op.Operation {
+	case ast.Query:
+		root = queryObjectName
+	case ast.Mutation:
+		root = mutationObjectName
+	case ast.Subscription:
+		root = subscriptionObjectName
+	}
+	s.applyDirectivePassthroughRec(root, "", op.SelectionSet)
+}
+
+func (s *ExecutableSchema) applyDirectivePassthroughRec(parentType, parentLocation string, selectionSet ast.SelectionSet) {
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			location, err := s.Locations.URLFor(parentType, parentLocation, selection.Name)
+			if err != nil {
+				location = parentLocation
+			}
+			selection.Directives = s.forwardedDirectives(selection.Directives, location)
+			if selection.Definition != nil {
+				s.applyDirectivePassthroughRec(selection.Definition.Type.Name(), location, selection.SelectionSet)
+			}
+		case *ast.InlineFragment:
+			typeCondition := parentType
+			if selection.TypeCondition != "" {
+				typeCondition = selection.TypeCondition
+			}
+			s.applyDirectivePassthroughRec(typeCondition, parentLocation, selection.SelectionSet)
+		case *ast.FragmentSpread:
+			s.applyDirectivePassthroughRec(selection.Definition.TypeCondition, parentLocation, selection.Definition.SelectionSet)
+		}
+	}
+}
+
+// operationDirectives returns the directives of the operation forwarded to
+// the root steps, formatted, by service URL. The mutex must be held.
+func (s *ExecutableSchema) operationDirectives(op *ast.OperationDefinition, plan *QueryPlan, vars map[string]interface{}) map[string]string {
+	if len(op.Directives) == 0 {
+		return nil
+	}
+	result := make(map[string]string)
+	for _, step := range plan.RootSteps {
+		if _, ok := result[step.ServiceURL]; ok {
+			continue
+		}
+		var sb strings.Builder
+		for _, d := range s.forwardedDirectives(op.Directives, step.ServiceURL) {
+			sb.WriteString(" @")
+			sb.WriteString(d.Name)
+			formatArgumentList(&sb, s.MergedSchema, vars, d.Arguments)
+		}
+		result[step.ServiceURL] = sb.String()
+	}
+	return result
+}
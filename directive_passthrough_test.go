@@ -0,0 +1,105 @@
+package bramble
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestDirectivePassthroughConfigValidate(t *testing.T) {
+	assert.NoError(t, DirectivePassthroughConfig{}.Validate())
+	assert.NoError(t, DirectivePassthroughConfig{Policy: StripDirectivePolicy, Directives: map[string]DirectivePolicy{"live": ForwardDirectivePolicy}}.Validate())
+	assert.EqualError(t, DirectivePassthroughConfig{Policy: "keep"}.Validate(), `unknown policy "keep"`)
+	assert.EqualError(t, DirectivePassthroughConfig{Directives: map[string]DirectivePolicy{"live": "keep"}}.Validate(), `directive "live": unknown policy "keep"`)
+	assert.EqualError(t, DirectivePassthroughConfig{Directives: map[string]DirectivePolicy{"skip": StripDirectivePolicy}}.Validate(), `directive "skip" is handled by the gateway`)
+}
+
+func TestAddPassthroughDirectives(t *testing.T) {
+	services := []*Service{
+		{Schema: gqlparser.MustLoadSchema(&ast.Source{Input: `
+			directive @live on QUERY
+			directive @cached(ttl: Int) on FIELD
+			directive @key(fields: String) on OBJECT
+			type Query { movie: String }`})},
+		{Schema: gqlparser.MustLoadSchema(&ast.Source{Input: `
+			directive @stream on FIELD
+			type Query { review: String }`})},
+	}
+	merged := func(config DirectivePassthroughConfig) []string {
+		schema := &ast.Schema{Directives: map[string]*ast.DirectiveDefinition{}}
+		addPassthroughDirectives(schema, services, config)
+		var names []string
+		for name := range schema.Directives {
+			names = append(names, name)
+		}
+		return names
+	}
+
+	assert.Empty(t, merged(DirectivePassthroughConfig{}))
+	assert.ElementsMatch(t, []string{"live", "cached", "stream"}, merged(DirectivePassthroughConfig{Policy: StripDirectivePolicy}))
+	assert.ElementsMatch(t, []string{"live"}, merged(DirectivePassthroughConfig{Directives: map[string]DirectivePolicy{"live": ForwardDirectivePolicy}}))
+	assert.ElementsMatch(t, []string{"cached", "stream"}, merged(DirectivePassthroughConfig{Policy: ForwardDirectivePolicy, Directives: map[string]DirectivePolicy{"live": RejectDirectivePolicy}}))
+}
+
+func directivePassthroughTestFixture(t *testing.T, config DirectivePassthroughConfig, moviesQuery, reviewsQuery string) *queryExecutionFixture {
+	return &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `
+				directive @live on QUERY
+				directive @cached(ttl: Int) on FIELD
+				type Query {
+					movie: String
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var req Request
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+					assert.Equal(t, moviesQuery, req.Query)
+					w.Write([]byte(`{ "data": { "movie": "Test title" } }`))
+				}),
+			},
+			{
+				schema: `
+				type Query {
+					review: String
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var req Request
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+					assert.Equal(t, reviewsQuery, req.Query)
+					w.Write([]byte(`{ "data": { "review": "Test review" } }`))
+				}),
+			},
+		},
+		query: `query @live {
+			movie @cached(ttl: 10)
+			review @cached(ttl: 5)
+		}`,
+		expected: `{
+			"movie": "Test title",
+			"review": "Test review"
+		}`,
+		directivePassthrough: config,
+	}
+}
+
+func TestQueryExecutionForwardsDirectives(t *testing.T) {
+	directivePassthroughTestFixture(t,
+		DirectivePassthroughConfig{Policy: ForwardDirectivePolicy},
+		"query @live {    movie @cached(ttl: 10)\n}",
+		"query {    review\n}",
+	).checkSuccess(t)
+}
+
+func TestQueryExecutionStripsDirectives(t *testing.T) {
+	directivePassthroughTestFixture(t,
+		DirectivePassthroughConfig{Policy: ForwardDirectivePolicy, Directives: map[string]DirectivePolicy{"cached": StripDirectivePolicy}},
+		"query @live {    movie\n}",
+		"query {    review\n}",
+	).checkSuccess(t)
+}
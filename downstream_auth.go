@@ -0,0 +1,191 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauth2TokenExpiryMargin is the time before their expiry the OAuth2 tokens
+// are refreshed, so they don't expire while a request is in flight
+const oauth2TokenExpiryMargin = 10 * time.Second
+
+// ServiceCredentials are the credentials the gateway authenticates with to a
+// service. The client certificates are configured in the service transport.
+type ServiceCredentials struct {
+	// BearerToken is sent in the Authorization header of every request
+	BearerToken string `json:"bearer-token"`
+	// OAuth2 gets the bearer tokens with the OAuth2 client credentials flow
+	OAuth2 *OAuth2ClientCredentials `json:"oauth2"`
+}
+
+// OAuth2ClientCredentials configures the OAuth2 client credentials flow
+type OAuth2ClientCredentials struct {
+	TokenURL     string   `json:"token-url"`
+	ClientID     string   `json:"client-id"`
+	ClientSecret string   `json:"client-secret"`
+	Scopes       []string `json:"scopes"`
+	// Params are additional parameters of the token requests (e.g. audience)
+	Params map[string]string `json:"params"`
+}
+
+// Validate checks that exactly one kind of credentials is set
+func (c ServiceCredentials) Validate() error {
+	switch {
+	case c.BearerToken != "" && c.OAuth2 != nil:
+		return errors.New("only one of bearer-token and oauth2 can be set")
+	case c.BearerToken == "" && c.OAuth2 == nil:
+		return errors.New("one of bearer-token and oauth2 is required")
+	case c.OAuth2 != nil && (c.OAuth2.TokenURL == "" || c.OAuth2.ClientID == ""):
+		return errors.New("oauth2 token-url and client-id are required")
+	}
+	return nil
+}
+
+// authorizer returns the Authorization header of the requests to a service
+type authorizer interface {
+	authorization(ctx context.Context) (string, error)
+	// invalidate discards the cached credentials after they were rejected
+	invalidate()
+}
+
+// Credentials are the credentials of the requests to the services, by URL. A
+// nil Credentials doesn't authenticate the requests.
+type Credentials struct {
+	byURL map[string]authorizer
+}
+
+// NewCredentials builds the credentials of the services, by service URL. The
+// credentials are also used for the endpoints and replicas of the services.
+// It returns nil if no credentials are configured.
+func NewCredentials(services map[string]ServiceCredentials, endpoints map[string]ServiceEndpoints, replicas map[string][]string) (*Credentials, error) {
+	if len(services) == 0 {
+		return nil, nil
+	}
+
+	c := &Credentials{byURL: make(map[string]authorizer)}
+	// the token requests don't use the service transports
+	tokenClient := &http.Client{Timeout: 5 * time.Second}
+	for serviceURL, credentials := range services {
+		if err := credentials.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid credentials for service %q: %w", serviceURL, err)
+		}
+		var a authorizer = staticToken(credentials.BearerToken)
+		if credentials.OAuth2 != nil {
+			a = &oauth2TokenSource{config: *credentials.OAuth2, client: tokenClient}
+		}
+		c.byURL[serviceURL] = a
+		for _, endpoint := range endpoints[serviceURL].allURLs() {
+			c.byURL[endpoint] = a
+		}
+		for _, replica := range replicas[serviceURL] {
+			c.byURL[replica] = a
+		}
+	}
+	return c, nil
+}
+
+// authorizerFor returns the authorizer of the requests to the given URL, or nil
+func (c *Credentials) authorizerFor(url string) authorizer {
+	if c == nil {
+		return nil
+	}
+	return c.byURL[url]
+}
+
+type staticToken string
+
+func (t staticToken) authorization(ctx context.Context) (string, error) {
+	return "Bearer " + string(t), nil
+}
+
+func (t staticToken) invalidate() {}
+
+// oauth2TokenSource gets the tokens with the client credentials flow and
+// caches them until they expire. It is safe for concurrent use.
+type oauth2TokenSource struct {
+	config OAuth2ClientCredentials
+	client *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (s *oauth2TokenSource) authorization(ctx context.Context) (string, error) {
+	// the lock is held during the token request so concurrent requests wait
+	// for the same token
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && (s.expiry.IsZero() || time.Now().Add(oauth2TokenExpiryMargin).Before(s.expiry)) {
+		return "Bearer " + s.token, nil
+	}
+
+	token, err := s.requestToken(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to get OAuth2 token: %w", err)
+	}
+	s.token = token.AccessToken
+	s.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		s.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return "Bearer " + s.token, nil
+}
+
+func (s *oauth2TokenSource) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = ""
+}
+
+func (s *oauth2TokenSource) requestToken(ctx context.Context) (*oauth2TokenResponse, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+	for k, v := range s.config.Params {
+		form.Set(k, v)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("token endpoint returned %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token oauth2TokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("error decoding token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("no access token in token response")
+	}
+	return &token, nil
+}
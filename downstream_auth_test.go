@@ -0,0 +1,175 @@
+package bramble
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAuthTestService(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer expired" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{ "data": { "authorization": "` + r.Header.Get("Authorization") + `" } }`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTokenTestServer(t *testing.T, expiresIn int, tokens ...string) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		id, secret, _ := r.BasicAuth()
+		assert.Equal(t, "gateway", id)
+		assert.Equal(t, "secret", secret)
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "movies:read movies:write", r.PostForm.Get("scope"))
+		assert.Equal(t, "movies", r.PostForm.Get("audience"))
+		token := tokens[len(tokens)-1]
+		if int(n) <= len(tokens) {
+			token = tokens[n-1]
+		}
+		fmt.Fprintf(w, `{ "access_token": %q, "token_type": "bearer", "expires_in": %d }`, token, expiresIn)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func requestAuthorization(t *testing.T, c *GraphQLClient, url string) (string, error) {
+	t.Helper()
+	var res struct {
+		Authorization string
+	}
+	err := c.Request(context.Background(), url, &Request{}, &res)
+	return res.Authorization, err
+}
+
+func TestServiceCredentialsValidate(t *testing.T) {
+	assert.NoError(t, ServiceCredentials{BearerToken: "token"}.Validate())
+	assert.NoError(t, ServiceCredentials{OAuth2: &OAuth2ClientCredentials{TokenURL: "http://auth/token", ClientID: "gateway"}}.Validate())
+	assert.Error(t, ServiceCredentials{}.Validate())
+	assert.Error(t, ServiceCredentials{BearerToken: "token", OAuth2: &OAuth2ClientCredentials{TokenURL: "http://auth/token", ClientID: "gateway"}}.Validate())
+	assert.Error(t, ServiceCredentials{OAuth2: &OAuth2ClientCredentials{ClientID: "gateway"}}.Validate())
+}
+
+func TestDownstreamCredentials(t *testing.T) {
+	oauth2Config := func(tokenURL string) *OAuth2ClientCredentials {
+		return &OAuth2ClientCredentials{
+			TokenURL:     tokenURL,
+			ClientID:     "gateway",
+			ClientSecret: "secret",
+			Scopes:       []string{"movies:read", "movies:write"},
+			Params:       map[string]string{"audience": "movies"},
+		}
+	}
+
+	t.Run("no credentials", func(t *testing.T) {
+		credentials, err := NewCredentials(nil, nil, nil)
+		require.NoError(t, err)
+		assert.Nil(t, credentials)
+	})
+
+	t.Run("static bearer token", func(t *testing.T) {
+		srv := newAuthTestService(t)
+		other := newAuthTestService(t)
+		replica := newAuthTestService(t)
+		credentials, err := NewCredentials(
+			map[string]ServiceCredentials{srv.URL: {BearerToken: "static-token"}},
+			nil,
+			map[string][]string{srv.URL: {replica.URL}},
+		)
+		require.NoError(t, err)
+		c := NewClient(WithCredentials(credentials))
+
+		authorization, err := requestAuthorization(t, c, srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer static-token", authorization)
+
+		authorization, err = requestAuthorization(t, c, replica.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer static-token", authorization)
+
+		authorization, err = requestAuthorization(t, c, other.URL)
+		require.NoError(t, err)
+		assert.Empty(t, authorization, "other services aren't authenticated")
+	})
+
+	t.Run("OAuth2 tokens are cached", func(t *testing.T) {
+		srv := newAuthTestService(t)
+		tokenSrv, calls := newTokenTestServer(t, 3600, "token-1", "token-2")
+		credentials, err := NewCredentials(map[string]ServiceCredentials{srv.URL: {OAuth2: oauth2Config(tokenSrv.URL)}}, nil, nil)
+		require.NoError(t, err)
+		c := NewClient(WithCredentials(credentials))
+
+		for i := 0; i < 3; i++ {
+			authorization, err := requestAuthorization(t, c, srv.URL)
+			require.NoError(t, err)
+			assert.Equal(t, "Bearer token-1", authorization)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+
+	t.Run("OAuth2 tokens are refreshed before they expire", func(t *testing.T) {
+		srv := newAuthTestService(t)
+		// the token expires within the refresh margin
+		tokenSrv, calls := newTokenTestServer(t, 5, "token-1", "token-2")
+		credentials, err := NewCredentials(map[string]ServiceCredentials{srv.URL: {OAuth2: oauth2Config(tokenSrv.URL)}}, nil, nil)
+		require.NoError(t, err)
+		c := NewClient(WithCredentials(credentials))
+
+		authorization, err := requestAuthorization(t, c, srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer token-1", authorization)
+		authorization, err = requestAuthorization(t, c, srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer token-2", authorization)
+		assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+	})
+
+	t.Run("rejected OAuth2 tokens are discarded", func(t *testing.T) {
+		srv := newAuthTestService(t)
+		tokenSrv, calls := newTokenTestServer(t, 3600, "expired", "token-2")
+		credentials, err := NewCredentials(map[string]ServiceCredentials{srv.URL: {OAuth2: oauth2Config(tokenSrv.URL)}}, nil, nil)
+		require.NoError(t, err)
+		c := NewClient(WithCredentials(credentials))
+
+		_, err = requestAuthorization(t, c, srv.URL)
+		require.Error(t, err)
+		authorization, err := requestAuthorization(t, c, srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer token-2", authorization)
+		assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+	})
+
+	t.Run("token endpoint failure", func(t *testing.T) {
+		srv := newAuthTestService(t)
+		tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("invalid client"))
+		}))
+		defer tokenSrv.Close()
+		credentials, err := NewCredentials(map[string]ServiceCredentials{srv.URL: {OAuth2: oauth2Config(tokenSrv.URL)}}, nil, nil)
+		require.NoError(t, err)
+
+		_, err = requestAuthorization(t, NewClient(WithCredentials(credentials)), srv.URL)
+		require.Error(t, err)
+		assert.Equal(t, "unable to get OAuth2 token: token endpoint returned 403: invalid client", err.Error())
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		_, err := NewCredentials(map[string]ServiceCredentials{"http://movies/query": {}}, nil, nil)
+		assert.Error(t, err)
+	})
+}
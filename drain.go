@@ -0,0 +1,127 @@
+package bramble
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// shuttingDownCode is the error code returned for the operations received
+// while the gateway is shutting down
+const shuttingDownCode = "SHUTTING_DOWN"
+
+// drainState tracks the in-flight operations, so they can complete before
+// the gateway shuts down
+type drainState struct {
+	mutex sync.Mutex
+	// draining is set when the shutdown starts, the readiness check fails
+	draining bool
+	// rejecting is set once the new operations are rejected
+	rejecting bool
+	inFlight  int
+	// idle is closed when the operations are rejected and none is in flight
+	idle     chan struct{}
+	idleOnce sync.Once
+	// cancelled is closed when the drain is over, the remaining operations are
+	// cancelled and the websocket connections closed
+	cancelled chan struct{}
+}
+
+func newDrainState() *drainState {
+	return &drainState{
+		idle:      make(chan struct{}),
+		cancelled: make(chan struct{}),
+	}
+}
+
+// acquire counts a new operation, it returns an error if the operations are
+// rejected
+func (d *drainState) acquire() (func(), *gqlerror.Error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.rejecting {
+		return nil, &gqlerror.Error{
+			Message:    "the gateway is shutting down",
+			Extensions: map[string]interface{}{"code": shuttingDownCode},
+		}
+	}
+	d.inFlight++
+
+	var once sync.Once
+	return func() {
+		once.Do(d.release)
+	}, nil
+}
+
+func (d *drainState) release() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.inFlight--
+	if d.rejecting && d.inFlight == 0 {
+		d.idleOnce.Do(func() { close(d.idle) })
+	}
+}
+
+// operationContext returns a context cancelled when the drain is over
+func (d *drainState) operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-d.cancelled:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// Draining returns true once the gateway started shutting down
+func (s *ExecutableSchema) Draining() bool {
+	s.drain.mutex.Lock()
+	defer s.drain.mutex.Unlock()
+	return s.drain.draining
+}
+
+// Drain drains the gateway before it shuts down. The readiness check fails
+// right away so the load balancers stop sending traffic to the gateway, the
+// new operations are rejected after delay, and the in-flight operations
+// (including the subscriptions) have until timeout to complete. The remaining
+// operations are then cancelled and the websocket connections closed.
+func (s *ExecutableSchema) Drain(delay, timeout time.Duration) {
+	d := s.drain
+	d.mutex.Lock()
+	if d.draining {
+		d.mutex.Unlock()
+		return
+	}
+	d.draining = true
+	d.mutex.Unlock()
+
+	log.WithField("delay", delay).Info("draining, readiness check failing")
+	time.Sleep(delay)
+
+	d.mutex.Lock()
+	d.rejecting = true
+	inFlight := d.inFlight
+	if inFlight == 0 {
+		d.idleOnce.Do(func() { close(d.idle) })
+	}
+	d.mutex.Unlock()
+
+	log.WithField("operations", inFlight).Info("rejecting new operations, waiting for the in-flight operations")
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-d.idle:
+		log.Info("in-flight operations completed")
+	case <-timer.C:
+		d.mutex.Lock()
+		inFlight = d.inFlight
+		d.mutex.Unlock()
+		log.WithField("operations", inFlight).Warn("drain timeout, cancelling the in-flight operations")
+	}
+	close(d.cancelled)
+}
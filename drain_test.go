@@ -0,0 +1,141 @@
+package bramble
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+)
+
+// newDrainTestSchema returns a schema whose service blocks the queries until
+// unblock is closed or the request is cancelled
+func newDrainTestSchema(t *testing.T, unblock chan struct{}) *ExecutableSchema {
+	t.Helper()
+	srv := newTestService(t, "movies", `type Service { name: String! version: String! schema: String! } type Query { service: Service! movie: String! }`, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-unblock:
+			fmt.Fprint(w, `{ "data": { "movie": "Alien" } }`)
+		case <-r.Context().Done():
+		}
+	})
+
+	es := newExecutableSchema(nil, 50, nil, NewService(srv.URL))
+	require.NoError(t, es.UpdateSchema(true))
+	return es
+}
+
+func execDrainTestQuery(es *ExecutableSchema) *graphql.Response {
+	doc := gqlparser.MustLoadQuery(es.MergedSchema, "{ movie }")
+	ctx := testContextWithVariables(nil, doc.Operations[0])
+	return es.Exec(ctx)(ctx)
+}
+
+func waitForRejection(t *testing.T, es *ExecutableSchema) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		es.drain.mutex.Lock()
+		defer es.drain.mutex.Unlock()
+		return es.drain.rejecting
+	}, time.Second, time.Millisecond)
+}
+
+func TestDrain(t *testing.T) {
+	t.Run("in-flight operations complete", func(t *testing.T) {
+		unblock := make(chan struct{})
+		es := newDrainTestSchema(t, unblock)
+
+		inFlight := make(chan *graphql.Response)
+		go func() { inFlight <- execDrainTestQuery(es) }()
+		require.Eventually(t, func() bool {
+			es.drain.mutex.Lock()
+			defer es.drain.mutex.Unlock()
+			return es.drain.inFlight == 1
+		}, time.Second, time.Millisecond)
+
+		drained := make(chan struct{})
+		go func() {
+			es.Drain(0, 5*time.Second)
+			close(drained)
+		}()
+		waitForRejection(t, es)
+		assert.True(t, es.Draining())
+
+		resp := execDrainTestQuery(es)
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, "the gateway is shutting down", resp.Errors[0].Message)
+		assert.Equal(t, shuttingDownCode, resp.Errors[0].Extensions["code"])
+
+		close(unblock)
+		resp = <-inFlight
+		assert.Empty(t, resp.Errors)
+		assert.JSONEq(t, `{"movie": "Alien"}`, string(resp.Data))
+		select {
+		case <-drained:
+		case <-time.After(time.Second):
+			t.Fatal("drain didn't complete with the in-flight operations")
+		}
+	})
+
+	t.Run("remaining operations are cancelled after the timeout", func(t *testing.T) {
+		es := newDrainTestSchema(t, make(chan struct{}))
+
+		inFlight := make(chan *graphql.Response)
+		go func() { inFlight <- execDrainTestQuery(es) }()
+		require.Eventually(t, func() bool {
+			es.drain.mutex.Lock()
+			defer es.drain.mutex.Unlock()
+			return es.drain.inFlight == 1
+		}, time.Second, time.Millisecond)
+
+		es.Drain(0, 50*time.Millisecond)
+		select {
+		case resp := <-inFlight:
+			assert.NotEmpty(t, resp.Errors)
+		case <-time.After(time.Second):
+			t.Fatal("the in-flight operation wasn't cancelled")
+		}
+	})
+
+	t.Run("readiness fails during the delay", func(t *testing.T) {
+		es := newDrainTestSchema(t, make(chan struct{}))
+		handler := NewGateway(es, nil).readyzHandler(false)
+
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		go es.Drain(100*time.Millisecond, time.Second)
+		require.Eventually(t, es.Draining, time.Second, time.Millisecond)
+		rec = httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.JSONEq(t, `{"status": "draining"}`, rec.Body.String())
+
+		// the operations are still accepted during the delay
+		release, err := es.drain.acquire()
+		require.Nil(t, err)
+		release()
+	})
+
+	t.Run("websocket connections are closed with going away", func(t *testing.T) {
+		es := newDrainTestSchema(t, make(chan struct{}))
+		gateway := httptest.NewServer(NewGateway(es, nil).Router())
+		t.Cleanup(gateway.Close)
+
+		conn := dialGraphqlTransportWS(t, gateway)
+		require.NoError(t, conn.WriteJSON(wsMessage{Type: wsConnectionInitMsg}))
+		assert.Equal(t, wsConnectionAckMsg, readWSMessage(t, conn).Type)
+
+		es.Drain(0, time.Second)
+		_, _, err := conn.ReadMessage()
+		require.Error(t, err)
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err.Error())
+	})
+}
@@ -0,0 +1,104 @@
+package bramble
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// dryRunIDPlaceholder replaces the ids of the parent objects in the documents
+// of the child steps, they're only known once the parent steps are executed
+const dryRunIDPlaceholder = "$id"
+
+// DryRunDocument is a document the execution of a plan step would send
+type DryRunDocument struct {
+	ServiceURL     string   `json:"serviceUrl"`
+	ServiceName    string   `json:"serviceName"`
+	ParentType     string   `json:"parentType"`
+	InsertionPoint []string `json:"insertionPoint"`
+	Document       string   `json:"document"`
+}
+
+// DryRunResult is the result of the dry run of an operation: the documents
+// of the steps of the plan, in execution order, the services they target and
+// the estimated number of requests
+type DryRunResult struct {
+	Documents []DryRunDocument `json:"documents"`
+	Services  []string         `json:"services"`
+	// EstimatedRequests is the number of requests of the plan, one per step.
+	// The child steps without parent objects aren't executed, and boundary
+	// query batching can send several steps in a single request.
+	EstimatedRequests int `json:"estimatedRequests"`
+}
+
+// dryRun returns the documents of the steps of the plan without executing
+// them. The ids and required fields of the parent objects are replaced with
+// variables (e.g. $id) in the documents of the child steps.
+func (e *QueryExecution) dryRun(ctx context.Context, plan *QueryPlan) DryRunResult {
+	result := DryRunResult{
+		Documents: []DryRunDocument{},
+		Services:  []string{},
+	}
+	services := make(map[string]bool)
+	var visit func(steps []*QueryPlanStep, root bool)
+	visit = func(steps []*QueryPlanStep, root bool) {
+		for _, step := range steps {
+			if step.ServiceURL != internalServiceName {
+				document := e.childStepDryRunDocument(ctx, step)
+				if root {
+					document = e.rootStepDocument(ctx, step)
+				}
+				result.Documents = append(result.Documents, DryRunDocument{
+					ServiceURL:     step.ServiceURL,
+					ServiceName:    step.ServiceName,
+					ParentType:     step.ParentType,
+					InsertionPoint: step.InsertionPoint,
+					Document:       document,
+				})
+				result.EstimatedRequests++
+				if !services[step.ServiceName] {
+					services[step.ServiceName] = true
+					result.Services = append(result.Services, step.ServiceName)
+				}
+			}
+			visit(step.Then, false)
+		}
+	}
+	visit(plan.RootSteps, true)
+	sort.Strings(result.Services)
+	return result
+}
+
+// childStepDryRunDocument returns the document of the child step for a single
+// parent object, with its id and required fields as variables
+func (e *QueryExecution) childStepDryRunDocument(ctx context.Context, step *QueryPlanStep) string {
+	selectionSet := e.formatStepSelectionSet(ctx, step)
+	if step.Join != nil {
+		return fmt.Sprintf("{ %s: %s(%s: $%s) %s }", nodeAlias(0), step.Join.Query, step.Join.Argument, step.Join.Argument, selectionSet)
+	}
+
+	boundaryQuery := e.boundaryQueries.Query(step.ServiceURL, step.ParentType)
+	if boundaryQuery.Array {
+		var requires string
+		if len(step.Requires) > 0 {
+			requires = fmt.Sprintf(", %s: [{%s}]", representationsArgumentName, dryRunRequiredArguments(step))
+		}
+		return fmt.Sprintf("{ _result: %s(%s: [%s])%s %s }", boundaryQuery.Query, boundaryQuery.ArgumentName(), dryRunIDPlaceholder, requires, selectionSet)
+	}
+	var requires string
+	if len(step.Requires) > 0 {
+		requires = ", " + dryRunRequiredArguments(step)
+	}
+	return fmt.Sprintf("{ %s: %s(%s: %s%s) { ... on %s %s } }", nodeAlias(0), boundaryQuery.Query, boundaryQuery.ArgumentName(), dryRunIDPlaceholder, requires, step.ParentType, selectionSet)
+}
+
+// dryRunRequiredArguments returns the required fields of the step as
+// arguments whose values are variables named after the fields
+func dryRunRequiredArguments(step *QueryPlanStep) string {
+	args := make([]string, 0, len(step.Requires))
+	for _, name := range step.Requires {
+		args = append(args, name+": $"+name)
+	}
+	return strings.Join(args, ", ")
+}
@@ -0,0 +1,124 @@
+package bramble
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunReturnsStepDocuments(t *testing.T) {
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Write([]byte(`{ "errors": [{ "message": "unexpected request" }] }`))
+	})
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				name: "movies",
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+				type Movie @boundary {
+					id: ID!
+					title: String!
+				}
+
+				type Query {
+					movies: [Movie!]!
+				}`,
+				handler: handler,
+			},
+			{
+				name: "reviews",
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+				type Movie @boundary {
+					id: ID!
+					rating: Int
+				}
+
+				type Query {
+					movie(id: ID!): Movie @boundary
+				}`,
+				handler: handler,
+			},
+			{
+				name: "posters",
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+				type Movie @boundary {
+					id: ID!
+					posterUrl: String
+				}
+
+				type Query {
+					movies(ids: [ID!]): [Movie]! @boundary
+				}`,
+				handler: handler,
+			},
+		},
+		debug: &DebugInfo{DryRun: true},
+		query: `{
+			movies {
+				title
+				rating
+				posterUrl
+			}
+		}`,
+		expected: `null`,
+	}
+
+	f.checkSuccess(t)
+	assert.False(t, called, "the services shouldn't be called")
+	require.IsType(t, DryRunResult{}, f.resp.Extensions["dryRun"])
+	result := f.resp.Extensions["dryRun"].(DryRunResult)
+	assert.Equal(t, 3, result.EstimatedRequests)
+	assert.Equal(t, []string{"movies", "posters", "reviews"}, result.Services)
+	require.Len(t, result.Documents, 3)
+
+	documents := make(map[string]DryRunDocument)
+	for _, d := range result.Documents {
+		documents[d.ServiceName] = d
+	}
+	assert.Equal(t, "Query", documents["movies"].ParentType)
+	assert.Contains(t, documents["movies"].Document, "query {")
+	assert.Contains(t, documents["movies"].Document, "_id: id")
+	assert.Equal(t, "Movie", documents["reviews"].ParentType)
+	assert.Equal(t, []string{"movies"}, documents["reviews"].InsertionPoint)
+	assert.Contains(t, documents["reviews"].Document, "_0: movie(id: $id) { ... on Movie {")
+	assert.Contains(t, documents["posters"].Document, "_result: movies(ids: [$id]) {")
+}
+
+func TestDryRunDoesNotExecuteMutations(t *testing.T) {
+	called := false
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `type Query {
+					movie: String
+				}
+
+				type Mutation {
+					createMovie(title: String!): String
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					called = true
+					w.Write([]byte(`{ "data": { "createMovie": "1" } }`))
+				}),
+			},
+		},
+		debug: &DebugInfo{DryRun: true, Plan: true},
+		query: `mutation {
+			createMovie(title: "Alien")
+		}`,
+		expected: `null`,
+	}
+
+	f.checkSuccess(t)
+	assert.False(t, called, "the mutation shouldn't be executed")
+	assert.NotNil(t, f.resp.Extensions["plan"])
+	result := f.resp.Extensions["dryRun"].(DryRunResult)
+	require.Len(t, result.Documents, 1)
+	assert.Equal(t, 1, result.EstimatedRequests)
+	assert.Contains(t, result.Documents[0].Document, `mutation {`)
+	assert.Contains(t, result.Documents[0].Document, `createMovie(title: "Alien")`)
+}
@@ -0,0 +1,133 @@
+package bramble
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GatewayOpt is a function used to set an option of a gateway created with
+// New
+type GatewayOpt func(*gatewayOptions)
+
+type gatewayOptions struct {
+	services               []string
+	plugins                []Plugin
+	client                 *GraphQLClient
+	maxRequestsPerQuery    int64
+	maxServiceResponseSize int64
+	executionTimeout       time.Duration
+	serviceName            string
+	logLevel               *log.Level
+}
+
+// New creates a gateway federating the given services, it is meant to embed
+// Bramble in another program without going through the configuration files.
+// The schemas of the services are fetched and merged before the gateway is
+// returned, an error is returned if any of them can't be fetched or merged.
+// The gateway is an http.Handler serving the public router.
+//
+// The plugins are initialized but not configured, they must be configured
+// before being passed to New.
+func New(opts ...GatewayOpt) (*Gateway, error) {
+	o := gatewayOptions{
+		maxRequestsPerQuery:    50,
+		maxServiceResponseSize: 1024 * 1024,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.logLevel != nil {
+		log.SetLevel(*o.logLevel)
+	}
+
+	if len(o.services) == 0 {
+		return nil, fmt.Errorf("no services to federate")
+	}
+	var services []*Service
+	for _, url := range o.services {
+		services = append(services, NewService(url))
+	}
+
+	client := o.client
+	if client == nil {
+		client = NewClient(WithMaxResponseSize(o.maxServiceResponseSize), WithUserAgent(GenerateUserAgent("query")))
+	}
+
+	es := newExecutableSchema(o.plugins, o.maxRequestsPerQuery, client, services...)
+	es.ExecutionTimeout = o.executionTimeout
+	es.ServiceName = o.serviceName
+	if err := es.UpdateSchema(true); err != nil {
+		return nil, fmt.Errorf("error updating schema: %w", err)
+	}
+
+	for _, plugin := range o.plugins {
+		plugin.Init(es)
+	}
+
+	return NewGateway(es, o.plugins), nil
+}
+
+// WithServices adds the URLs of the services federated by the gateway.
+func WithServices(urls ...string) GatewayOpt {
+	return func(o *gatewayOptions) {
+		o.services = append(o.services, urls...)
+	}
+}
+
+// WithPlugins adds plugins to the gateway.
+func WithPlugins(plugins ...Plugin) GatewayOpt {
+	return func(o *gatewayOptions) {
+		o.plugins = append(o.plugins, plugins...)
+	}
+}
+
+// WithClient sets the client used to query the services. The max service
+// response size doesn't apply to it.
+func WithClient(client *GraphQLClient) GatewayOpt {
+	return func(o *gatewayOptions) {
+		o.client = client
+	}
+}
+
+// WithMaxRequestsPerQuery sets the max number of requests to the services
+// per query, defaults to 50.
+func WithMaxRequestsPerQuery(maxRequestsPerQuery int64) GatewayOpt {
+	return func(o *gatewayOptions) {
+		o.maxRequestsPerQuery = maxRequestsPerQuery
+	}
+}
+
+// WithMaxServiceResponseSize sets the max response size of the services,
+// defaults to 1MB.
+func WithMaxServiceResponseSize(maxServiceResponseSize int64) GatewayOpt {
+	return func(o *gatewayOptions) {
+		o.maxServiceResponseSize = maxServiceResponseSize
+	}
+}
+
+// WithExecutionTimeout sets the time after which the pending requests of a
+// query are cancelled, there is no timeout by default.
+func WithExecutionTimeout(timeout time.Duration) GatewayOpt {
+	return func(o *gatewayOptions) {
+		o.executionTimeout = timeout
+	}
+}
+
+// WithServiceName sets the name of the gateway when it's federated by
+// another gateway.
+func WithServiceName(name string) GatewayOpt {
+	return func(o *gatewayOptions) {
+		o.serviceName = name
+	}
+}
+
+// WithLogLevel sets the level of the logs. The logs are global, this
+// affects the whole program.
+func WithLogLevel(level log.Level) GatewayOpt {
+	return func(o *gatewayOptions) {
+		o.logLevel = &level
+	}
+}
@@ -0,0 +1,90 @@
+package bramble
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type embedTestPlugin struct {
+	BasePlugin
+	schema *ExecutableSchema
+}
+
+func (p *embedTestPlugin) ID() string {
+	return "embed-test"
+}
+
+func (p *embedTestPlugin) Init(schema *ExecutableSchema) {
+	p.schema = schema
+}
+
+func (p *embedTestPlugin) SetupPublicMux(mux *http.ServeMux) {
+	mux.HandleFunc("/plugin", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plugin"))
+	})
+}
+
+func TestNew(t *testing.T) {
+	service := newFederationTestService(t, "test", `
+		type Service { name: String! version: String! schema: String! }
+		type Query { test: String service: Service! }`,
+		`{ "data": { "test": "Hello" } }`,
+		nil,
+	)
+	defer service.Close()
+
+	plugin := &embedTestPlugin{}
+	gtw, err := New(
+		WithServices(service.URL),
+		WithPlugins(plugin),
+		WithMaxRequestsPerQuery(10),
+		WithExecutionTimeout(time.Second),
+	)
+	require.NoError(t, err)
+
+	es := gtw.ExecutableSchema
+	assert.Same(t, es, plugin.schema)
+	assert.Equal(t, int64(10), es.MaxRequestsPerQuery)
+	assert.Equal(t, time.Second, es.ExecutionTimeout)
+	assert.Equal(t, "test", es.Services[service.URL].Name)
+	assert.NotNil(t, es.MergedSchema.Query.Fields.ForName("test"))
+
+	t.Run("query", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{ "query": "{ test }" }`))
+		req.Header.Set("Content-Type", "application/json")
+		gtw.ServeHTTP(rec, req)
+		assert.JSONEq(t, `{ "data": { "test": "Hello" } }`, rec.Body.String())
+	})
+
+	t.Run("plugin routes", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		gtw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/plugin", nil))
+		assert.Equal(t, "plugin", rec.Body.String())
+	})
+}
+
+func TestNewErrors(t *testing.T) {
+	t.Run("no services", func(t *testing.T) {
+		_, err := New()
+		require.Error(t, err)
+		assert.Equal(t, "no services to federate", err.Error())
+	})
+
+	t.Run("unreachable service", func(t *testing.T) {
+		service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer service.Close()
+
+		_, err := New(WithServices(service.URL))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "error updating schema")
+	})
+}
@@ -0,0 +1,441 @@
+package bramble
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	contentTypeJSON     = "application/json"
+	contentTypeCBOR     = "application/cbor"
+	contentTypeMsgpack  = "application/msgpack"
+	contentTypeXMsgpack = "application/x-msgpack"
+)
+
+// responseEncoding is a binary encoding of the responses
+type responseEncoding struct {
+	// null is the encoding of the null value
+	null byte
+	// encode encodes a decoded JSON value
+	encode func(w *bytes.Buffer, v interface{})
+	// writeMapHeader and writeArrayHeader start a map (object) or an array
+	// of n elements
+	writeMapHeader   func(w *bytes.Buffer, n int)
+	writeArrayHeader func(w *bytes.Buffer, n int)
+}
+
+var cborEncoding = &responseEncoding{
+	null:             0xf6,
+	encode:           encodeCBOR,
+	writeMapHeader:   func(w *bytes.Buffer, n int) { writeCBORHead(w, 5, uint64(n)) },
+	writeArrayHeader: func(w *bytes.Buffer, n int) { writeCBORHead(w, 4, uint64(n)) },
+}
+
+var msgpackEncoding = &responseEncoding{
+	null:             0xc0,
+	encode:           encodeMsgpack,
+	writeMapHeader:   func(w *bytes.Buffer, n int) { writeMsgpackLength(w, n, 0x80, 15, 0, 0xde, 0xdf) },
+	writeArrayHeader: func(w *bytes.Buffer, n int) { writeMsgpackLength(w, n, 0x90, 15, 0, 0xdc, 0xdd) },
+}
+
+var responseEncodings = map[string]*responseEncoding{
+	contentTypeCBOR:     cborEncoding,
+	contentTypeMsgpack:  msgpackEncoding,
+	contentTypeXMsgpack: msgpackEncoding,
+}
+
+// encodeJSON encodes the JSON value, keeping the order of the fields
+func (e *responseEncoding) encodeJSON(w *bytes.Buffer, data []byte) error {
+	v, err := decodeOrderedJSON(json.NewDecoder(bytes.NewReader(data)))
+	if err != nil {
+		return err
+	}
+	e.encode(w, v)
+	return nil
+}
+
+// requestedEncoding is the binary encoding requested by the client.
+// dataEncoded is set by the execution once the data of the response is
+// encoded with it.
+type requestedEncoding struct {
+	encoding    *responseEncoding
+	dataEncoded bool
+}
+
+func addRequestedEncodingToContext(ctx context.Context, encoding *responseEncoding) (context.Context, *requestedEncoding) {
+	requested := &requestedEncoding{encoding: encoding}
+	return context.WithValue(ctx, responseEncodingContextKey, requested), requested
+}
+
+func getRequestedEncodingFromContext(ctx context.Context) *requestedEncoding {
+	requested, _ := ctx.Value(responseEncodingContextKey).(*requestedEncoding)
+	return requested
+}
+
+// binaryTransport serves the POST and GET requests of the clients preferring
+// CBOR or MessagePack responses in the Accept header. The data is encoded by
+// the result marshaller, only the errors and extensions are transcoded from
+// JSON.
+type binaryTransport struct{}
+
+var _ graphql.Transport = binaryTransport{}
+
+func (binaryTransport) Supports(r *http.Request) bool {
+	if r.Header.Get("Upgrade") != "" {
+		return false
+	}
+	if _, ok := responseEncodings[negotiateResponseContentType(r.Header.Get("Accept"))]; !ok {
+		return false
+	}
+	if r.Method == http.MethodGet {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && r.Method == http.MethodPost && mediaType == contentTypeJSON
+}
+
+func (binaryTransport) Do(w http.ResponseWriter, r *http.Request, exec graphql.GraphExecutor) {
+	contentType := negotiateResponseContentType(r.Header.Get("Accept"))
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Content-Type", contentType)
+	ctx, requested := addRequestedEncodingToContext(r.Context(), responseEncodings[contentType])
+
+	params, err := readRawParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeEncodedResponse(w, requested, &graphql.Response{Errors: gqlerror.List{{Message: err.Error()}}})
+		return
+	}
+
+	rc, errs := exec.CreateOperationContext(ctx, params)
+	if errs != nil {
+		if errcode.GetErrorKind(errs) == errcode.KindProtocol {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		}
+		writeEncodedResponse(w, requested, exec.DispatchError(graphql.WithOperationContext(ctx, rc), errs))
+		return
+	}
+	if r.Method == http.MethodGet && rc.Operation.Operation != ast.Query {
+		w.WriteHeader(http.StatusNotAcceptable)
+		writeEncodedResponse(w, requested, &graphql.Response{Errors: gqlerror.List{{Message: "GET requests only allow query operations"}}})
+		return
+	}
+
+	responses, ctx := exec.DispatchOperation(ctx, rc)
+	writeEncodedResponse(w, requested, responses(ctx))
+}
+
+// negotiateResponseContentType returns the supported content type with the
+// highest quality in the Accept header. JSON is preferred for equal
+// qualities and wildcards.
+func negotiateResponseContentType(accept string) string {
+	best, bestQ := contentTypeJSON, -1.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		if _, ok := responseEncodings[mediaType]; !ok && mediaType != contentTypeJSON {
+			continue
+		}
+		if q > bestQ || (q == bestQ && mediaType == contentTypeJSON) {
+			best, bestQ = mediaType, q
+		}
+	}
+	return best
+}
+
+// readRawParams reads the parameters of a POST or GET request like the
+// default transports
+func readRawParams(r *http.Request) (*graphql.RawParams, error) {
+	start := graphql.Now()
+	params := &graphql.RawParams{}
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		params.Query = query.Get("query")
+		params.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := decodeJSONNumbers(strings.NewReader(variables), &params.Variables); err != nil {
+				return nil, errors.New("variables could not be decoded")
+			}
+		}
+		if extensions := query.Get("extensions"); extensions != "" {
+			if err := decodeJSONNumbers(strings.NewReader(extensions), &params.Extensions); err != nil {
+				return nil, errors.New("extensions could not be decoded")
+			}
+		}
+	} else if err := decodeJSONNumbers(r.Body, params); err != nil {
+		return nil, fmt.Errorf("json body could not be decoded: %w", err)
+	}
+	params.ReadTime = graphql.TraceTiming{Start: start, End: graphql.Now()}
+	return params, nil
+}
+
+func decodeJSONNumbers(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// writeEncodedResponse writes the response in the requested encoding, with
+// the fields in the same order as the JSON responses
+func writeEncodedResponse(w io.Writer, requested *requestedEncoding, response *graphql.Response) {
+	encoding := requested.encoding
+	var buf bytes.Buffer
+	fields := 1
+	if len(response.Errors) > 0 {
+		fields++
+	}
+	if len(response.Extensions) > 0 {
+		fields++
+	}
+	encoding.writeMapHeader(&buf, fields)
+	if len(response.Errors) > 0 {
+		encoding.encode(&buf, "errors")
+		writeTranscoded(&buf, encoding, response.Errors)
+	}
+	encoding.encode(&buf, "data")
+	switch {
+	case response.Data == nil:
+		buf.WriteByte(encoding.null)
+	case requested.dataEncoded:
+		buf.Write(response.Data)
+	default:
+		// e.g. the cached responses of the idempotent mutations
+		if err := encoding.encodeJSON(&buf, response.Data); err != nil {
+			buf.WriteByte(encoding.null)
+		}
+	}
+	if len(response.Extensions) > 0 {
+		encoding.encode(&buf, "extensions")
+		writeTranscoded(&buf, encoding, response.Extensions)
+	}
+	_, _ = w.Write(buf.Bytes())
+}
+
+// writeTranscoded encodes the value as its JSON encoding
+func writeTranscoded(w *bytes.Buffer, encoding *responseEncoding, v interface{}) {
+	b, err := json.Marshal(v)
+	if err == nil {
+		err = encoding.encodeJSON(w, b)
+	}
+	if err != nil {
+		w.WriteByte(encoding.null)
+	}
+}
+
+// orderedMap is a JSON object that keeps the order of its fields
+type orderedMap []orderedMapEntry
+
+type orderedMapEntry struct {
+	key   string
+	value interface{}
+}
+
+// decodeOrderedJSON decodes the next JSON value, objects are decoded as
+// orderedMap and numbers as json.Number
+func decodeOrderedJSON(dec *json.Decoder) (interface{}, error) {
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		var m orderedMap
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, orderedMapEntry{key: key.(string), value: value})
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return m, nil
+	case json.Delim('['):
+		l := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+
+	return tok, nil
+}
+
+// encodeCBOR encodes the value in CBOR (RFC 8949)
+func encodeCBOR(w *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteByte(0xf6)
+	case bool:
+		if v {
+			w.WriteByte(0xf5)
+		} else {
+			w.WriteByte(0xf4)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			if i >= 0 {
+				writeCBORHead(w, 0, uint64(i))
+			} else {
+				writeCBORHead(w, 1, uint64(-1-i))
+			}
+			return
+		}
+		f, _ := v.Float64()
+		w.WriteByte(0xfb)
+		_ = binary.Write(w, binary.BigEndian, math.Float64bits(f))
+	case string:
+		writeCBORHead(w, 3, uint64(len(v)))
+		w.WriteString(v)
+	case []interface{}:
+		writeCBORHead(w, 4, uint64(len(v)))
+		for _, elem := range v {
+			encodeCBOR(w, elem)
+		}
+	case orderedMap:
+		writeCBORHead(w, 5, uint64(len(v)))
+		for _, entry := range v {
+			encodeCBOR(w, entry.key)
+			encodeCBOR(w, entry.value)
+		}
+	default:
+		panic(fmt.Sprintf("unsupported CBOR value %T", v))
+	}
+}
+
+// writeCBORHead writes the head of a data item of the major type with the
+// argument n
+func writeCBORHead(w *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		w.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		w.WriteByte(major<<5 | 24)
+		w.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		w.WriteByte(major<<5 | 25)
+		_ = binary.Write(w, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		w.WriteByte(major<<5 | 26)
+		_ = binary.Write(w, binary.BigEndian, uint32(n))
+	default:
+		w.WriteByte(major<<5 | 27)
+		_ = binary.Write(w, binary.BigEndian, n)
+	}
+}
+
+// encodeMsgpack encodes the value in MessagePack
+func encodeMsgpack(w *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteByte(0xc0)
+	case bool:
+		if v {
+			w.WriteByte(0xc3)
+		} else {
+			w.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			encodeMsgpackInt(w, i)
+			return
+		}
+		f, _ := v.Float64()
+		w.WriteByte(0xcb)
+		_ = binary.Write(w, binary.BigEndian, math.Float64bits(f))
+	case string:
+		writeMsgpackLength(w, len(v), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		w.WriteString(v)
+	case []interface{}:
+		writeMsgpackLength(w, len(v), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, elem := range v {
+			encodeMsgpack(w, elem)
+		}
+	case orderedMap:
+		writeMsgpackLength(w, len(v), 0x80, 15, 0, 0xde, 0xdf)
+		for _, entry := range v {
+			encodeMsgpack(w, entry.key)
+			encodeMsgpack(w, entry.value)
+		}
+	default:
+		panic(fmt.Sprintf("unsupported MessagePack value %T", v))
+	}
+}
+
+// writeMsgpackLength writes the length n of a string, array or map: in the
+// fix format up to fixMax, otherwise with the 8 (if any), 16 or 32 bits codes
+func writeMsgpackLength(w *bytes.Buffer, n int, fix, fixMax byte, codes ...byte) {
+	switch {
+	case fixMax > 0 && n <= int(fixMax):
+		w.WriteByte(fix | byte(n))
+	case codes[0] != 0 && n <= math.MaxUint8:
+		w.WriteByte(codes[0])
+		w.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		w.WriteByte(codes[1])
+		_ = binary.Write(w, binary.BigEndian, uint16(n))
+	default:
+		w.WriteByte(codes[2])
+		_ = binary.Write(w, binary.BigEndian, uint32(n))
+	}
+}
+
+func encodeMsgpackInt(w io.Writer, i int64) {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		_, _ = w.Write([]byte{byte(i)})
+	case i < 0 && i >= -32:
+		_, _ = w.Write([]byte{byte(int8(i))})
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		_, _ = w.Write([]byte{0xd0, byte(int8(i))})
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		_, _ = w.Write([]byte{0xd1})
+		_ = binary.Write(w, binary.BigEndian, int16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		_, _ = w.Write([]byte{0xd2})
+		_ = binary.Write(w, binary.BigEndian, int32(i))
+	default:
+		_, _ = w.Write([]byte{0xd3})
+		_ = binary.Write(w, binary.BigEndian, i)
+	}
+}
@@ -0,0 +1,233 @@
+package bramble
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestNegotiateResponseContentType(t *testing.T) {
+	for accept, expected := range map[string]string{
+		"":                                   contentTypeJSON,
+		"*/*":                                contentTypeJSON,
+		"application/json; charset=utf-8":    contentTypeJSON,
+		"application/cbor":                   contentTypeCBOR,
+		"application/msgpack":                contentTypeMsgpack,
+		"application/x-msgpack":              contentTypeXMsgpack,
+		"application/json, application/cbor": contentTypeJSON,
+		"application/json;q=0.5, application/cbor":  contentTypeCBOR,
+		"application/cbor;q=0, application/msgpack": contentTypeMsgpack,
+		"text/html, application/cbor;q=0.1":         contentTypeCBOR,
+		"application/protobuf":                      contentTypeJSON,
+	} {
+		assert.Equal(t, expected, negotiateResponseContentType(accept), accept)
+	}
+}
+
+func TestEncodeCBOR(t *testing.T) {
+	// examples from RFC 8949 appendix A
+	for input, expected := range map[string]string{
+		`0`:                         "00",
+		`23`:                        "17",
+		`24`:                        "1818",
+		`100`:                       "1864",
+		`1000`:                      "1903e8",
+		`1000000`:                   "1a000f4240",
+		`1000000000000`:             "1b000000e8d4a51000",
+		`-1`:                        "20",
+		`-100`:                      "3863",
+		`1.1`:                       "fb3ff199999999999a",
+		`false`:                     "f4",
+		`true`:                      "f5",
+		`null`:                      "f6",
+		`""`:                        "60",
+		`"IETF"`:                    "6449455446",
+		`[]`:                        "80",
+		`[1, [2, 3], [4, 5]]`:       "8301820203820405",
+		`{}`:                        "a0",
+		`{"a": 1, "b": [2, 3]}`:     "a26161016162820203",
+		`{"b": 1, "a": {"c": "d"}}`: "a26162016161a161636164",
+	} {
+		v, err := decodeOrderedJSON(json.NewDecoder(strings.NewReader(input)))
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		encodeCBOR(&buf, v)
+		assert.Equal(t, expected, hex.EncodeToString(buf.Bytes()), input)
+	}
+}
+
+func TestEncodeMsgpack(t *testing.T) {
+	for input, expected := range map[string]string{
+		`0`:                                 "00",
+		`127`:                               "7f",
+		`200`:                               "d100c8",
+		`70000`:                             "d200011170",
+		`5000000000`:                        "d3000000012a05f200",
+		`-1`:                                "ff",
+		`-32`:                               "e0",
+		`-33`:                               "d0df",
+		`1.5`:                               "cb3ff8000000000000",
+		`false`:                             "c2",
+		`true`:                              "c3",
+		`null`:                              "c0",
+		`"a"`:                               "a161",
+		`[1, 2]`:                            "920102",
+		`{"b": true, "a": null}`:            "82a162c3a161c0",
+		`"` + strings.Repeat("a", 32) + `"`: "d920" + strings.Repeat("61", 32),
+	} {
+		v, err := decodeOrderedJSON(json.NewDecoder(strings.NewReader(input)))
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		encodeMsgpack(&buf, v)
+		assert.Equal(t, expected, hex.EncodeToString(buf.Bytes()), input)
+	}
+}
+
+func TestMarshalResultEncodings(t *testing.T) {
+	schema := loadSchema(`
+	scalar JSON
+	type Movie {
+		id: ID!
+		title: String!
+		rating: Float
+		tags: [String!]
+		metadata: JSON
+	}
+	type Query {
+		movies: [Movie]
+		movie: Movie
+		count: Int!
+	}`)
+	query := gqlparser.MustLoadQuery(schema, `{
+		movies { id title rating tags metadata }
+		movie { title ... on Movie { id } }
+		count
+	}`)
+	data := map[string]interface{}{
+		"movies": []interface{}{
+			map[string]interface{}{
+				"id":       "1",
+				"title":    "Ratatouille",
+				"rating":   4.5,
+				"tags":     []interface{}{"animation", "cooking"},
+				"metadata": map[string]interface{}{"b": 1, "a": []interface{}{true, nil}},
+			},
+			map[string]interface{}{
+				"id":       json.Number("2"),
+				"title":    json.RawMessage(`"Toy Story"`),
+				"rating":   json.Number("5"),
+				"tags":     []interface{}{"animation", nil},
+				"metadata": json.RawMessage(`{"z": 1, "a": 2}`),
+			},
+		},
+		"movie": map[string]interface{}{"id": "3", "title": nil},
+		"count": 2,
+	}
+
+	expected, err := marshalResult(data, query.Operations[0].SelectionSet, schema, &ast.Type{NamedType: "Query"})
+	var nullErrs gqlerror.List
+	require.True(t, errors.As(err, &nullErrs))
+	for contentType, encoding := range responseEncodings {
+		var buf bytes.Buffer
+		require.NoError(t, encoding.encodeJSON(&buf, expected))
+		res, err := marshalValidatedResult(data, query.Operations[0].SelectionSet, schema, &ast.Type{NamedType: "Query"}, nil, nil, encoding)
+		assert.Equal(t, nullErrs, err, contentType)
+		assert.Equal(t, hex.EncodeToString(buf.Bytes()), hex.EncodeToString(res), contentType)
+	}
+}
+
+func TestBinaryTransport(t *testing.T) {
+	var mutations int
+	service := newTestService(t, "test", `type Service { name: String! version: String! schema: String! }
+	type Query { movie: Movie! service: Service! }
+	type Movie { title: String! rating: Float }
+	type Mutation { rate: Int! }`, func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.Contains(req.Query, "rate") {
+			mutations++
+			fmt.Fprintf(w, `{ "data": { "rate": %d } }`, mutations)
+			return
+		}
+		w.Write([]byte(`{ "data": { "movie": { "title": "Ratatouille", "rating": 4.5 } } }`))
+	})
+
+	es := newExecutableSchema(nil, 50, nil, NewService(service.URL))
+	require.NoError(t, es.UpdateSchema(true))
+	es.IdempotencyCacheWindow = time.Minute
+	router := NewGateway(es, nil).Router()
+
+	do := func(method, query, accept string, header http.Header) *httptest.ResponseRecorder {
+		var req *http.Request
+		if method == http.MethodGet {
+			req = httptest.NewRequest(method, "/query?query="+url.QueryEscape(query), nil)
+		} else {
+			body, _ := json.Marshal(map[string]string{"query": query})
+			req = httptest.NewRequest(method, "/query", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for k := range header {
+			req.Header.Set(k, header.Get(k))
+		}
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	transcoded := func(encoding *responseEncoding, body []byte) string {
+		var buf bytes.Buffer
+		require.NoError(t, encoding.encodeJSON(&buf, body))
+		return hex.EncodeToString(buf.Bytes())
+	}
+
+	for _, method := range []string{http.MethodPost, http.MethodGet} {
+		t.Run(method, func(t *testing.T) {
+			query := "{ movie { title rating } __typename }"
+			expected := do(method, query, "", nil)
+
+			for contentType, encoding := range responseEncodings {
+				rec := do(method, query, contentType, nil)
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, contentType, rec.Header().Get("Content-Type"))
+				assert.Equal(t, "Accept", rec.Header().Get("Vary"))
+				assert.Equal(t, transcoded(encoding, expected.Body.Bytes()), hex.EncodeToString(rec.Body.Bytes()), contentType)
+			}
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		rec := do(http.MethodPost, "{ movie { unknown } }", contentTypeCBOR, nil)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Equal(t, contentTypeCBOR, rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), `Cannot query field "unknown" on type "Movie".`)
+
+		rec = do(http.MethodGet, "mutation { rate }", contentTypeMsgpack, nil)
+		assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+		assert.Equal(t, "82a66572726f72739181a76d657373616765d928474554207265717565737473206f6e6c7920616c6c6f77207175657279206f7065726174696f6e73a464617461c0", hex.EncodeToString(rec.Body.Bytes()))
+	})
+
+	t.Run("replayed idempotent mutation", func(t *testing.T) {
+		header := http.Header{"Idempotency-Key": []string{"abc"}}
+		expected := do(http.MethodPost, "mutation { rate }", "", header)
+		assert.JSONEq(t, `{"data": {"rate": 1}}`, expected.Body.String())
+
+		rec := do(http.MethodPost, "mutation { rate }", contentTypeCBOR, header)
+		assert.Equal(t, contentTypeCBOR, rec.Header().Get("Content-Type"))
+		assert.Equal(t, transcoded(cborEncoding, expected.Body.Bytes()), hex.EncodeToString(rec.Body.Bytes()))
+		assert.Equal(t, 1, mutations)
+	})
+}
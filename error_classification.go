@@ -0,0 +1,297 @@
+package bramble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ErrorAction is the action taken when the request of a plan step fails
+type ErrorAction string
+
+const (
+	// ErrorActionRetry sends the request of the step again, it's failed if
+	// the retries are exhausted
+	ErrorActionRetry ErrorAction = "retry"
+	// ErrorActionNull leaves the fields of the step null, without reporting
+	// the error
+	ErrorActionNull ErrorAction = "null"
+	// ErrorActionFailStep reports the error and leaves the fields of the step
+	// null, the other steps are executed. It's the default action.
+	ErrorActionFailStep ErrorAction = "fail-step"
+	// ErrorActionFailRequest cancels the execution of the other steps, the
+	// response only contains the errors
+	ErrorActionFailRequest ErrorAction = "fail-request"
+)
+
+// validate returns an error if the action is unknown
+func (a ErrorAction) validate() error {
+	switch a {
+	case ErrorActionRetry, ErrorActionNull, ErrorActionFailStep, ErrorActionFailRequest:
+		return nil
+	}
+	return fmt.Errorf("unknown action %q", a)
+}
+
+// ErrorClassifier decides the action taken when the request of a plan step
+// fails. Plugins implementing this interface are called before the rules of
+// the configuration. The error is either GraphqlErrors (the errors returned
+// by the service) or a transport error.
+type ErrorClassifier interface {
+	// ClassifyStepError returns the action taken for the error, or an empty
+	// action to defer to the next classifier
+	ClassifyStepError(ctx context.Context, step *QueryPlanStep, err error) ErrorAction
+}
+
+// Error kinds matched by the error rules
+const (
+	// transportErrorKind matches the errors without GraphQL errors from the
+	// service: network errors, invalid responses...
+	transportErrorKind = "transport"
+	// graphqlErrorKind matches the GraphQL errors returned by the service
+	graphqlErrorKind = "graphql"
+)
+
+// ErrorRule maps the errors of the plan steps to an action
+type ErrorRule struct {
+	// Services are the names or URLs of the services the rule applies to,
+	// all of them if empty
+	Services []string `json:"services"`
+	// Kind is "transport" or "graphql", the rule matches both if empty
+	Kind string `json:"kind"`
+	// Codes are the codes (the "code" extension) of the GraphQL errors
+	// matched by the rule, any code if empty. The rule matches if one of the
+	// errors has one of the codes.
+	Codes  []string    `json:"codes"`
+	Action ErrorAction `json:"action"`
+}
+
+// Validate returns an error if the rule is invalid
+func (r ErrorRule) Validate() error {
+	if err := r.Action.validate(); err != nil {
+		return err
+	}
+	switch r.Kind {
+	case "", graphqlErrorKind:
+	case transportErrorKind:
+		if len(r.Codes) > 0 {
+			return errors.New("transport errors don't have codes")
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	return nil
+}
+
+// matches returns whether the rule applies to the error of the step
+func (r ErrorRule) matches(step *QueryPlanStep, err error) bool {
+	if len(r.Services) > 0 {
+		var found bool
+		for _, s := range r.Services {
+			if s == step.ServiceName || s == step.ServiceURL {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	var gqlErrs GraphqlErrors
+	if !errors.As(err, &gqlErrs) {
+		return r.Kind != graphqlErrorKind && len(r.Codes) == 0
+	}
+	if r.Kind == transportErrorKind {
+		return false
+	}
+	if len(r.Codes) == 0 {
+		return true
+	}
+	for _, ge := range gqlErrs {
+		code, _ := ge.Extensions["code"].(string)
+		for _, c := range r.Codes {
+			if code == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ErrorClassification maps the errors of the plan steps to actions with a
+// list of rules, the first matching rule applies
+type ErrorClassification struct {
+	Rules []ErrorRule
+	// MaxRetries is the maximum number of retries of a step
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, doubled for each
+	// subsequent retry
+	RetryBackoff time.Duration
+}
+
+// ErrorClassificationConfig is the configuration of the error classification
+type ErrorClassificationConfig struct {
+	Rules                []ErrorRule `json:"rules"`
+	MaxRetries           int         `json:"max-retries"`
+	RetryBackoff         string      `json:"retry-backoff"`
+	retryBackoffDuration time.Duration
+}
+
+func (c *ErrorClassificationConfig) parse() error {
+	for i, rule := range c.Rules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("invalid error classification rule %d: %w", i, err)
+		}
+	}
+	if c.MaxRetries < 0 {
+		return errors.New("invalid error classification: max-retries must be positive")
+	}
+	c.retryBackoffDuration = 100 * time.Millisecond
+	if c.RetryBackoff != "" {
+		backoff, err := time.ParseDuration(c.RetryBackoff)
+		if err != nil {
+			return fmt.Errorf("invalid error classification retry backoff: %w", err)
+		}
+		c.retryBackoffDuration = backoff
+	}
+	return nil
+}
+
+// errorClassification returns the error classification described by the
+// config, or nil if there are no rules
+func (c ErrorClassificationConfig) errorClassification() *ErrorClassification {
+	if len(c.Rules) == 0 {
+		return nil
+	}
+	maxRetries := c.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = 2
+	}
+	return &ErrorClassification{
+		Rules:        c.Rules,
+		MaxRetries:   maxRetries,
+		RetryBackoff: c.retryBackoffDuration,
+	}
+}
+
+// stepErrorClassifier calls the classifiers of the plugins, then applies the
+// rules of the error classification. A nil classifier fails the steps.
+type stepErrorClassifier struct {
+	classifiers    []ErrorClassifier
+	classification *ErrorClassification
+}
+
+// stepErrorClassifier returns the classifier of the step errors, or nil if
+// there are neither classifier plugins nor rules
+func (s *ExecutableSchema) stepErrorClassifier() *stepErrorClassifier {
+	var classifiers []ErrorClassifier
+	for _, p := range s.plugins {
+		if c, ok := p.(ErrorClassifier); ok {
+			classifiers = append(classifiers, c)
+		}
+	}
+	if len(classifiers) == 0 && s.ErrorClassification == nil {
+		return nil
+	}
+	return &stepErrorClassifier{
+		classifiers:    classifiers,
+		classification: s.ErrorClassification,
+	}
+}
+
+// classify returns the action taken for the error of the step
+func (c *stepErrorClassifier) classify(ctx context.Context, step *QueryPlanStep, err error) ErrorAction {
+	if c == nil {
+		return ErrorActionFailStep
+	}
+	for _, classifier := range c.classifiers {
+		if action := classifier.ClassifyStepError(ctx, step, err); action != "" {
+			return action
+		}
+	}
+	if c.classification != nil {
+		for _, rule := range c.classification.Rules {
+			if rule.matches(step, err) {
+				return rule.Action
+			}
+		}
+	}
+	return ErrorActionFailStep
+}
+
+// retryBackoff returns the delay before the given retry (starting at 1) of a
+// step, and whether the step can be retried that many times
+func (c *stepErrorClassifier) retryBackoff(retry int) (time.Duration, bool) {
+	if c == nil {
+		return 0, false
+	}
+	maxRetries, backoff := 2, 100*time.Millisecond
+	if c.classification != nil {
+		maxRetries, backoff = c.classification.MaxRetries, c.classification.RetryBackoff
+	}
+	if retry > maxRetries {
+		return 0, false
+	}
+	return backoff << (retry - 1), true
+}
+
+// classifiedError is the error of a step with the action taken for it
+type classifiedError struct {
+	action ErrorAction
+	err    error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// classifyStepError returns the action taken for the error of the step. The
+// action of the errors classified while sending the request is kept, the
+// retried errors are failed.
+func (e *QueryExecution) classifyStepError(ctx context.Context, step *QueryPlanStep, err error) ErrorAction {
+	var classified *classifiedError
+	var action ErrorAction
+	if errors.As(err, &classified) {
+		action = classified.action
+	} else {
+		action = e.errorClassifier.classify(ctx, step, err)
+	}
+	if action == ErrorActionRetry {
+		return ErrorActionFailStep
+	}
+	return action
+}
+
+// canRetryStep returns whether the request of the step can be sent again.
+// The mutations aren't retried, they may not be idempotent.
+func canRetryStep(step *QueryPlanStep) bool {
+	return step.ParentType != mutationObjectName
+}
+
+// resetResponse sets the response a request is decoded into back to its zero
+// value, before the request is retried
+func resetResponse(resp interface{}) {
+	v := reflect.ValueOf(resp)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+}
+
+// failRequest cancels the execution of the other steps after a step failed
+// with the fail-request action. The mutex must be held.
+func (e *QueryExecution) failRequest() {
+	if e.requestFailed {
+		return
+	}
+	e.requestFailed = true
+	if e.cancel != nil {
+		e.cancel()
+	}
+}
@@ -0,0 +1,312 @@
+package bramble
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestErrorRuleMatches(t *testing.T) {
+	step := &QueryPlanStep{ServiceName: "movies", ServiceURL: "http://movies/query"}
+	transportErr := errors.New("error during request: connection refused")
+	gqlErr := GraphqlErrors{{Message: "unavailable", Extensions: map[string]interface{}{"code": "UNAVAILABLE"}}}
+
+	tests := []struct {
+		name     string
+		rule     ErrorRule
+		err      error
+		expected bool
+	}{
+		{"any error", ErrorRule{}, transportErr, true},
+		{"service name", ErrorRule{Services: []string{"movies"}}, gqlErr, true},
+		{"service URL", ErrorRule{Services: []string{"http://movies/query"}}, gqlErr, true},
+		{"other service", ErrorRule{Services: []string{"reviews"}}, gqlErr, false},
+		{"transport kind", ErrorRule{Kind: "transport"}, transportErr, true},
+		{"transport kind with GraphQL error", ErrorRule{Kind: "transport"}, gqlErr, false},
+		{"GraphQL kind with transport error", ErrorRule{Kind: "graphql"}, transportErr, false},
+		{"code", ErrorRule{Codes: []string{"NOT_FOUND", "UNAVAILABLE"}}, gqlErr, true},
+		{"other code", ErrorRule{Codes: []string{"NOT_FOUND"}}, gqlErr, false},
+		{"code with transport error", ErrorRule{Codes: []string{"UNAVAILABLE"}}, transportErr, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.rule.matches(step, tt.err))
+		})
+	}
+}
+
+func TestErrorRuleValidate(t *testing.T) {
+	assert.NoError(t, ErrorRule{Kind: "graphql", Codes: []string{"UNAVAILABLE"}, Action: ErrorActionRetry}.Validate())
+	assert.EqualError(t, ErrorRule{Action: "ignore"}.Validate(), `unknown action "ignore"`)
+	assert.EqualError(t, ErrorRule{Kind: "http", Action: ErrorActionNull}.Validate(), `unknown kind "http"`)
+	assert.EqualError(t, ErrorRule{Kind: "transport", Codes: []string{"UNAVAILABLE"}, Action: ErrorActionNull}.Validate(), "transport errors don't have codes")
+}
+
+type errorClassifierPlugin struct {
+	BasePlugin
+	action ErrorAction
+}
+
+func (p *errorClassifierPlugin) ID() string {
+	return "error-classifier"
+}
+
+func (p *errorClassifierPlugin) ClassifyStepError(ctx context.Context, step *QueryPlanStep, err error) ErrorAction {
+	return p.action
+}
+
+func TestStepErrorClassifier(t *testing.T) {
+	step := &QueryPlanStep{ServiceName: "movies"}
+	err := errors.New("connection refused")
+
+	es := newExecutableSchema(nil, 50, nil)
+	assert.Nil(t, es.stepErrorClassifier())
+	assert.Equal(t, ErrorActionFailStep, es.stepErrorClassifier().classify(context.Background(), step, err))
+
+	es.ErrorClassification = &ErrorClassification{
+		Rules: []ErrorRule{
+			{Services: []string{"reviews"}, Action: ErrorActionFailRequest},
+			{Kind: "transport", Action: ErrorActionRetry},
+			{Action: ErrorActionNull},
+		},
+		MaxRetries:   2,
+		RetryBackoff: 10 * time.Millisecond,
+	}
+	c := es.stepErrorClassifier()
+	assert.Equal(t, ErrorActionRetry, c.classify(context.Background(), step, err))
+	assert.Equal(t, ErrorActionNull, c.classify(context.Background(), step, GraphqlErrors{{Message: "not found"}}))
+
+	backoff, ok := c.retryBackoff(2)
+	assert.True(t, ok)
+	assert.Equal(t, 20*time.Millisecond, backoff)
+	_, ok = c.retryBackoff(3)
+	assert.False(t, ok)
+
+	// the plugins are called before the rules, an empty action defers to
+	// the rules
+	plugin := &errorClassifierPlugin{action: ErrorActionFailRequest}
+	es.plugins = []Plugin{plugin}
+	assert.Equal(t, ErrorActionFailRequest, es.stepErrorClassifier().classify(context.Background(), step, err))
+	plugin.action = ""
+	assert.Equal(t, ErrorActionRetry, es.stepErrorClassifier().classify(context.Background(), step, err))
+}
+
+func TestErrorClassificationConfig(t *testing.T) {
+	c := ErrorClassificationConfig{Rules: []ErrorRule{{Action: ErrorActionRetry}}}
+	require.NoError(t, c.parse())
+	assert.Equal(t, &ErrorClassification{
+		Rules:        c.Rules,
+		MaxRetries:   2,
+		RetryBackoff: 100 * time.Millisecond,
+	}, c.errorClassification())
+
+	assert.Nil(t, (&ErrorClassificationConfig{}).errorClassification())
+
+	c = ErrorClassificationConfig{Rules: []ErrorRule{{Action: ErrorActionRetry}}, RetryBackoff: "soon"}
+	assert.EqualError(t, c.parse(), `invalid error classification retry backoff: time: invalid duration "soon"`)
+}
+
+const errorClassificationMovieSchema = `
+	directive @boundary on OBJECT | FIELD_DEFINITION
+	type Movie @boundary {
+		id: ID!
+		title: String
+	}
+	type Query {
+		movie(id: ID!): Movie
+	}`
+
+const errorClassificationReviewSchema = `
+	directive @boundary on OBJECT | FIELD_DEFINITION
+	type Movie @boundary {
+		id: ID!
+		rating: Int
+	}
+	type Query {
+		movieReview(id: ID!): Movie @boundary
+		reviewCount: Int
+	}`
+
+func TestQueryExecutionRetriesClassifiedErrors(t *testing.T) {
+	var attempts int32
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				name:   "movies",
+				schema: errorClassificationMovieSchema,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if atomic.AddInt32(&attempts, 1) == 1 {
+						w.Write([]byte(`{ "errors": [{ "message": "overloaded", "extensions": { "code": "UNAVAILABLE" } }] }`))
+						return
+					}
+					w.Write([]byte(`{ "data": { "movie": { "title": "Alien" } } }`))
+				}),
+			},
+		},
+		errorClassification: &ErrorClassification{
+			Rules:        []ErrorRule{{Codes: []string{"UNAVAILABLE"}, Action: ErrorActionRetry}},
+			MaxRetries:   2,
+			RetryBackoff: time.Millisecond,
+		},
+		query:    `{ movie(id: "1") { title } }`,
+		expected: `{ "movie": { "title": "Alien" } }`,
+	}
+
+	f.checkSuccess(t)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestQueryExecutionFailsExhaustedRetries(t *testing.T) {
+	var attempts int32
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				name:   "movies",
+				schema: errorClassificationMovieSchema,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&attempts, 1)
+					w.Write([]byte(`{ "errors": [{ "message": "overloaded", "extensions": { "code": "UNAVAILABLE" } }] }`))
+				}),
+			},
+		},
+		errorClassification: &ErrorClassification{
+			Rules:        []ErrorRule{{Action: ErrorActionRetry}},
+			MaxRetries:   2,
+			RetryBackoff: time.Millisecond,
+		},
+		query: `{ movie(id: "1") { title } }`,
+		errors: gqlerror.List{
+			&gqlerror.Error{
+				Message:   "overloaded",
+				Path:      ast.Path{ast.PathName("movie")},
+				Locations: []gqlerror.Location{{Line: 1, Column: 3}},
+				Extensions: map[string]interface{}{
+					"code":         "UNAVAILABLE",
+					"selectionSet": `{ movie(id: "1") { title } }`,
+					"serviceName":  "movies",
+				},
+			},
+		},
+	}
+
+	f.run(t)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+}
+
+func TestQueryExecutionClassifiedErrorsFallBackToNull(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				name:   "movies",
+				schema: errorClassificationMovieSchema,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "movie": { "_id": "1", "title": "Alien" } } }`))
+				}),
+			},
+			{
+				name:   "reviews",
+				schema: errorClassificationReviewSchema,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+					w.Write([]byte(`internal server error`))
+				}),
+			},
+		},
+		errorClassification: &ErrorClassification{
+			Rules: []ErrorRule{{Services: []string{"reviews"}, Action: ErrorActionNull}},
+		},
+		query:    `{ movie(id: "1") { title rating } }`,
+		expected: `{ "movie": { "title": "Alien", "rating": null } }`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionClassifiedErrorsFailTheRequest(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				name:   "movies",
+				schema: errorClassificationMovieSchema,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "movie": { "_id": "1", "title": "Alien" } } }`))
+				}),
+			},
+			{
+				name:   "reviews",
+				schema: errorClassificationReviewSchema,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "errors": [{ "message": "forbidden", "extensions": { "code": "FORBIDDEN" } }] }`))
+				}),
+			},
+		},
+		errorClassification: &ErrorClassification{
+			Rules: []ErrorRule{{Codes: []string{"FORBIDDEN"}, Action: ErrorActionFailRequest}},
+		},
+		query: `{ movie(id: "1") { title } reviewCount }`,
+		errors: gqlerror.List{
+			&gqlerror.Error{
+				Message:   "forbidden",
+				Locations: []gqlerror.Location{{Line: 1, Column: 28}},
+				Extensions: map[string]interface{}{
+					"code":         "FORBIDDEN",
+					"selectionSet": `{ reviewCount }`,
+					"serviceName":  "reviews",
+				},
+			},
+		},
+	}
+
+	f.run(t)
+	assert.Nil(t, f.resp.Data)
+}
+
+func TestQueryExecutionDoesNotRetryMutations(t *testing.T) {
+	var attempts int32
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				name: "movies",
+				schema: `
+				type Query {
+					movie(id: ID!): String
+				}
+				type Mutation {
+					rateMovie(id: ID!, rating: Int!): Int
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&attempts, 1)
+					w.Write([]byte(`{ "errors": [{ "message": "overloaded", "extensions": { "code": "UNAVAILABLE" } }] }`))
+				}),
+			},
+		},
+		errorClassification: &ErrorClassification{
+			Rules:        []ErrorRule{{Action: ErrorActionRetry}},
+			MaxRetries:   2,
+			RetryBackoff: time.Millisecond,
+		},
+		query: `mutation { rateMovie(id: "1", rating: 5) }`,
+		errors: gqlerror.List{
+			&gqlerror.Error{
+				Message:   "overloaded",
+				Locations: []gqlerror.Location{{Line: 1, Column: 12}},
+				Extensions: map[string]interface{}{
+					"code":         "UNAVAILABLE",
+					"selectionSet": `{ rateMovie(id: "1", rating: 5) }`,
+					"serviceName":  "movies",
+				},
+			},
+		},
+	}
+
+	f.run(t)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
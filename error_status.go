@@ -0,0 +1,115 @@
+package bramble
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// responseErrorCodes collects the codes (extensions.code) of the errors of
+// the response, the HTTP status of the response is chosen from them
+type responseErrorCodes struct {
+	mu    sync.Mutex
+	codes []string
+}
+
+func (c *responseErrorCodes) add(code string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.codes = append(c.codes, code)
+}
+
+// status returns the highest status mapped to the codes, or 0 if none of them
+// is mapped
+func (c *responseErrorCodes) status(mapping map[string]int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := 0
+	for _, code := range c.codes {
+		if s, ok := mapping[code]; ok && s > status {
+			status = s
+		}
+	}
+	return status
+}
+
+func addResponseErrorCodesToContext(ctx context.Context) (context.Context, *responseErrorCodes) {
+	codes := &responseErrorCodes{}
+	return context.WithValue(ctx, responseErrorCodesContextKey, codes), codes
+}
+
+func getResponseErrorCodesFromContext(ctx context.Context) *responseErrorCodes {
+	codes, _ := ctx.Value(responseErrorCodesContextKey).(*responseErrorCodes)
+	return codes
+}
+
+// errorCode returns the code of the error, or "none" if it doesn't have one
+func errorCode(extensions map[string]interface{}) string {
+	if code, ok := extensions["code"].(string); ok && code != "" {
+		return code
+	}
+	return "none"
+}
+
+// errorCodesResponseMiddleware counts the errors of the responses by code,
+// and records the codes for errorStatusMiddleware
+func errorCodesResponseMiddleware(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	res := next(ctx)
+	if res == nil {
+		return res
+	}
+	codes := getResponseErrorCodesFromContext(ctx)
+	for _, err := range res.Errors {
+		code := errorCode(err.Extensions)
+		promResponseErrors.WithLabelValues(code).Inc()
+		if codes != nil {
+			codes.add(code)
+		}
+	}
+	return res
+}
+
+// errorStatusMiddleware sets the HTTP status of the responses from the codes
+// of their errors, using the ErrorStatusCodes mapping. The status is only
+// changed if the response would have been a 200.
+func errorStatusMiddleware(es *ExecutableSchema) middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if es == nil || len(es.ErrorStatusCodes) == 0 || r.Header.Get("Upgrade") != "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+			ctx, codes := addResponseErrorCodesToContext(r.Context())
+			h.ServeHTTP(&errorStatusResponseWriter{ResponseWriter: w, codes: codes, mapping: es.ErrorStatusCodes}, r.WithContext(ctx))
+		})
+	}
+}
+
+type errorStatusResponseWriter struct {
+	http.ResponseWriter
+	codes       *responseErrorCodes
+	mapping     map[string]int
+	wroteHeader bool
+}
+
+func (w *errorStatusResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if status == http.StatusOK {
+		if s := w.codes.status(w.mapping); s != 0 {
+			status = s
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorStatusResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
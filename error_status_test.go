@@ -0,0 +1,66 @@
+package bramble
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseErrorCodesStatus(t *testing.T) {
+	mapping := map[string]int{"NOT_FOUND": 200, "UNAUTHENTICATED": 401, "INTERNAL_SERVER_ERROR": 502}
+
+	codes := &responseErrorCodes{}
+	assert.Equal(t, 0, codes.status(mapping))
+
+	codes.add("NOT_FOUND")
+	codes.add("none")
+	assert.Equal(t, 200, codes.status(mapping))
+
+	codes.add("INTERNAL_SERVER_ERROR")
+	codes.add("UNAUTHENTICATED")
+	assert.Equal(t, 502, codes.status(mapping), "the highest status is used")
+}
+
+func TestErrorStatusCodes(t *testing.T) {
+	service := newTestService(t, "test", `type Service { name: String! version: String! schema: String! }
+	type Query { me: String notFound: String broken: String service: Service! }`, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query string
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case strings.Contains(req.Query, "me"):
+			w.Write([]byte(`{ "errors": [{ "message": "unauthenticated", "extensions": { "code": "UNAUTHENTICATED" } }] }`))
+		case strings.Contains(req.Query, "notFound"):
+			w.Write([]byte(`{ "data": { "notFound": null }, "errors": [{ "message": "not found", "extensions": { "code": "NOT_FOUND" } }] }`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	es := newExecutableSchema(nil, 50, nil, NewService(service.URL))
+	require.NoError(t, es.UpdateSchema(true))
+	es.ErrorStatusCodes = map[string]int{"UNAUTHENTICATED": 401, "INTERNAL_SERVER_ERROR": 502}
+	router := NewGateway(es, nil).Router()
+
+	query := func(query string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"query": query})
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, query("{ me }").Code)
+	assert.Equal(t, http.StatusOK, query("{ notFound }").Code)
+
+	rec := query("{ broken }")
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"INTERNAL_SERVER_ERROR"`)
+}
@@ -0,0 +1,76 @@
+package bramble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	// ErrorModeVerbose returns the errors with the service details
+	ErrorModeVerbose = "verbose"
+	// ErrorModeRedacted hides the service internals from the errors
+	ErrorModeRedacted = "redacted"
+)
+
+// ErrorFormatter formats an error that occurred while executing a query plan
+// step before it's added to the response.
+// err is the original error: a GraphqlError returned by the service, or a
+// transport error (network error, invalid response...). gqlErr is the error
+// formatted in verbose mode. Returning nil removes the error from the
+// response.
+type ErrorFormatter func(ctx context.Context, step *QueryPlanStep, err error, gqlErr *gqlerror.Error) *gqlerror.Error
+
+// VerboseErrorFormatter returns the errors as is, with the selectionSet,
+// serviceName and serviceUrl extensions
+func VerboseErrorFormatter(ctx context.Context, step *QueryPlanStep, err error, gqlErr *gqlerror.Error) *gqlerror.Error {
+	return gqlErr
+}
+
+// RedactedErrorFormatter removes the internal details from the errors: the
+// selectionSet and serviceUrl extensions are removed, and the messages of
+// transport errors (which can contain internal URLs) are replaced with a
+// generic message
+func RedactedErrorFormatter(ctx context.Context, step *QueryPlanStep, err error, gqlErr *gqlerror.Error) *gqlerror.Error {
+	extensions := make(map[string]interface{}, len(gqlErr.Extensions))
+	for k, v := range gqlErr.Extensions {
+		if k == "selectionSet" || k == "serviceUrl" {
+			continue
+		}
+		extensions[k] = v
+	}
+
+	message := gqlErr.Message
+	var serviceErrs GraphqlErrors
+	if !errors.As(err, &serviceErrs) {
+		message = "error while querying service"
+		extensions["code"] = "INTERNAL_SERVER_ERROR"
+		if step.ServiceName != "" {
+			extensions["serviceName"] = step.ServiceName
+		}
+	}
+
+	if len(extensions) == 0 {
+		extensions = nil
+	}
+
+	return &gqlerror.Error{
+		Message:    message,
+		Path:       gqlErr.Path,
+		Locations:  gqlErr.Locations,
+		Extensions: extensions,
+	}
+}
+
+// errorFormatterForMode returns the error formatter for the given error mode
+func errorFormatterForMode(mode string) (ErrorFormatter, error) {
+	switch mode {
+	case "", ErrorModeVerbose:
+		return VerboseErrorFormatter, nil
+	case ErrorModeRedacted:
+		return RedactedErrorFormatter, nil
+	}
+	return nil, fmt.Errorf("invalid error mode %q, must be %q or %q", mode, ErrorModeVerbose, ErrorModeRedacted)
+}
@@ -0,0 +1,115 @@
+package bramble
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestRedactedErrorFormatter(t *testing.T) {
+	step := &QueryPlanStep{
+		ServiceName: "movies",
+		ServiceURL:  "http://movies.internal/query",
+	}
+	path := ast.Path{ast.PathName("movie"), ast.PathName("title")}
+
+	t.Run("service error", func(t *testing.T) {
+		err := GraphqlErrors{{Message: "Movie does not exist"}}
+		gqlErr := &gqlerror.Error{
+			Message:   "Movie does not exist",
+			Path:      path,
+			Locations: []gqlerror.Location{{Line: 1, Column: 2}},
+			Extensions: map[string]interface{}{
+				"code":         "NOT_FOUND",
+				"selectionSet": "{ movie { title } }",
+				"serviceName":  "movies",
+				"serviceUrl":   "http://movies.internal/query",
+			},
+		}
+
+		assert.Equal(t, &gqlerror.Error{
+			Message:   "Movie does not exist",
+			Path:      path,
+			Locations: []gqlerror.Location{{Line: 1, Column: 2}},
+			Extensions: map[string]interface{}{
+				"code":        "NOT_FOUND",
+				"serviceName": "movies",
+			},
+		}, RedactedErrorFormatter(context.Background(), step, err, gqlErr))
+	})
+
+	t.Run("transport error", func(t *testing.T) {
+		err := errors.New("error during request: Post http://movies.internal/query: connection refused")
+		gqlErr := &gqlerror.Error{
+			Message: err.Error(),
+			Path:    path,
+			Extensions: map[string]interface{}{
+				"selectionSet": "{ movie { title } }",
+			},
+		}
+
+		assert.Equal(t, &gqlerror.Error{
+			Message: "error while querying service",
+			Path:    path,
+			Extensions: map[string]interface{}{
+				"code":        "INTERNAL_SERVER_ERROR",
+				"serviceName": "movies",
+			},
+		}, RedactedErrorFormatter(context.Background(), step, err, gqlErr))
+	})
+}
+
+func TestErrorFormatterForMode(t *testing.T) {
+	for _, mode := range []string{"", ErrorModeVerbose, ErrorModeRedacted} {
+		formatter, err := errorFormatterForMode(mode)
+		require.NoError(t, err)
+		assert.NotNil(t, formatter)
+	}
+
+	_, err := errorFormatterForMode("quiet")
+	assert.Error(t, err)
+}
+
+func TestQueryExecutionRedactedErrors(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `type Movie {
+					id: ID!
+					title: String
+				}
+
+				type Query {
+					movie(id: ID!): Movie
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				}),
+			},
+		},
+		query: `{
+			movie(id: "1") {
+				title
+			}
+		}`,
+		errorFormatter: RedactedErrorFormatter,
+		errors: gqlerror.List{
+			&gqlerror.Error{
+				Message:   "error while querying service",
+				Path:      ast.Path{ast.PathName("movie")},
+				Locations: []gqlerror.Location{{Line: 2, Column: 4}},
+				Extensions: map[string]interface{}{
+					"code": "INTERNAL_SERVER_ERROR",
+				},
+			},
+		},
+	}
+
+	f.run(t)
+}
@@ -0,0 +1,179 @@
+package bramble
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// EventType is the type of a gateway lifecycle event
+type EventType string
+
+const (
+	// SchemaUpdatedEvent is published when a new merged schema is applied
+	SchemaUpdatedEvent EventType = "schema_updated"
+	// SchemaUpdateRejectedEvent is published when a merged schema update is
+	// rejected because of breaking changes
+	SchemaUpdateRejectedEvent EventType = "schema_update_rejected"
+	// ServiceDownEvent is published when a service schema can't be updated
+	// anymore (unreachable or invalid schema)
+	ServiceDownEvent EventType = "service_down"
+	// ServiceUpEvent is published when a service that was down is updated
+	// successfully again
+	ServiceUpEvent EventType = "service_up"
+	// ServiceRemovedEvent is published when a service is removed from the
+	// service list
+	ServiceRemovedEvent EventType = "service_removed"
+	// PlanCacheFlushedEvent is published when the query plan cache is
+	// flushed, after a new merged schema is applied
+	PlanCacheFlushedEvent EventType = "plan_cache_flushed"
+)
+
+// eventBufferSize is the number of events buffered for each subscriber, the
+// events published while the buffer is full are dropped
+const eventBufferSize = 100
+
+// Event is a gateway lifecycle event
+type Event struct {
+	Type      EventType `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	// Service is the name of the service, for service events
+	Service string `json:"service,omitempty"`
+	// ServiceURL is the URL of the service, for service events
+	ServiceURL string `json:"serviceUrl,omitempty"`
+	// Error is the reason of service down events
+	Error string `json:"error,omitempty"`
+	// Changes are the changes of schema update events
+	Changes *SchemaChangeReport `json:"changes,omitempty"`
+}
+
+type eventSubscriber struct {
+	types  map[EventType]bool
+	events chan Event
+}
+
+// EventBus dispatches the gateway lifecycle events to the subscribers. Each
+// subscriber receives the events in order, in its own goroutine, so a slow
+// subscriber doesn't block the gateway or the other subscribers. It is safe
+// for concurrent use.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[int]*eventSubscriber
+	nextID      int
+}
+
+// NewEventBus returns a new event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[int]*eventSubscriber),
+	}
+}
+
+// Subscribe calls the handler for every event of the given types, or every
+// event if no types are given. The returned function unsubscribes the handler.
+func (b *EventBus) Subscribe(handler func(Event), types ...EventType) func() {
+	sub := &eventSubscriber{
+		events: make(chan Event, eventBufferSize),
+	}
+	if len(types) > 0 {
+		sub.types = make(map[EventType]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = sub
+	b.mu.Unlock()
+
+	go func() {
+		for e := range sub.events {
+			handler(e)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, id)
+			b.mu.Unlock()
+			close(sub.events)
+		})
+	}
+}
+
+// Publish sends the event to the subscribers. It never blocks, the event is
+// dropped for the subscribers whose buffer is full.
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, sub := range b.subscribers {
+		if sub.types != nil && !sub.types[e.Type] {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			promDroppedEvents.WithLabelValues(string(e.Type)).Inc()
+			log.WithField("event", e.Type).Warn("event subscriber is too slow, dropping event")
+		}
+	}
+}
+
+// EventWebhook is a URL the events are posted to as JSON
+type EventWebhook struct {
+	URL string `json:"url"`
+	// Events are the types of events sent to the webhook, all the events are
+	// sent if empty
+	Events []EventType `json:"events"`
+}
+
+// newWebhookHandler returns an event handler posting the events to the
+// webhook. Failed deliveries are logged and not retried.
+func newWebhookHandler(webhook EventWebhook, client *http.Client) func(Event) {
+	return func(e Event) {
+		logger := log.WithFields(log.Fields{"event": e.Type, "url": webhook.URL})
+		if err := postEvent(client, webhook.URL, e); err != nil {
+			logger.WithError(err).Error("unable to send event to webhook")
+		}
+	}
+}
+
+func postEvent(client *http.Client, url string, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("unable to encode event: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", GenerateUserAgent("events"))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error during request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
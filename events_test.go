@@ -0,0 +1,129 @@
+package bramble
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveEvent(t *testing.T, events chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(time.Second):
+		require.FailNow(t, "timeout waiting for event")
+		return Event{}
+	}
+}
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+
+	all := make(chan Event, 10)
+	unsubscribe := bus.Subscribe(func(e Event) { all <- e })
+	services := make(chan Event, 10)
+	bus.Subscribe(func(e Event) { services <- e }, ServiceDownEvent, ServiceUpEvent)
+
+	bus.Publish(Event{Type: SchemaUpdatedEvent})
+	bus.Publish(Event{Type: ServiceDownEvent, ServiceURL: "http://service"})
+
+	e := receiveEvent(t, all)
+	assert.Equal(t, SchemaUpdatedEvent, e.Type)
+	assert.False(t, e.Timestamp.IsZero())
+	assert.Equal(t, ServiceDownEvent, receiveEvent(t, all).Type)
+	assert.Equal(t, "http://service", receiveEvent(t, services).ServiceURL)
+
+	unsubscribe()
+	unsubscribe()
+	bus.Publish(Event{Type: ServiceUpEvent})
+	assert.Equal(t, ServiceUpEvent, receiveEvent(t, services).Type)
+	assert.Empty(t, all)
+}
+
+func TestEventBusSlowSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	block := make(chan struct{})
+	defer close(block)
+	bus.Subscribe(func(e Event) { <-block })
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < eventBufferSize*2; i++ {
+			bus.Publish(Event{Type: PlanCacheFlushedEvent})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "publish blocked on a slow subscriber")
+	}
+}
+
+func TestEventWebhook(t *testing.T) {
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		assert.Equal(t, "application/json; charset=utf-8", r.Header.Get("Content-Type"))
+		received <- e
+	}))
+	defer server.Close()
+
+	bus := NewEventBus()
+	bus.Subscribe(newWebhookHandler(EventWebhook{URL: server.URL}, server.Client()))
+	bus.Publish(Event{Type: ServiceRemovedEvent, ServiceURL: "http://service"})
+
+	e := receiveEvent(t, received)
+	assert.Equal(t, ServiceRemovedEvent, e.Type)
+	assert.Equal(t, "http://service", e.ServiceURL)
+}
+
+func TestUpdateSchemaPublishesEvents(t *testing.T) {
+	var down int32
+	service := testServiceHandler("test-service", `type Service { name: String! version: String! schema: String! }
+	type Query { service: Service! foo: String }`, nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		service.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	es := newExecutableSchema(nil, 50, nil, NewService(server.URL))
+	events := make(chan Event, 10)
+	es.Events.Subscribe(func(e Event) { events <- e })
+
+	require.NoError(t, es.UpdateSchema(true))
+	e := receiveEvent(t, events)
+	assert.Equal(t, SchemaUpdatedEvent, e.Type)
+	require.NotNil(t, e.Changes)
+	assert.Equal(t, []string{"test-service"}, e.Changes.Services)
+	assert.Equal(t, PlanCacheFlushedEvent, receiveEvent(t, events).Type)
+
+	atomic.StoreInt32(&down, 1)
+	es.UpdateSchema(false)
+	e = receiveEvent(t, events)
+	assert.Equal(t, ServiceDownEvent, e.Type)
+	assert.Equal(t, "test-service", e.Service)
+	assert.Equal(t, server.URL, e.ServiceURL)
+	assert.NotEmpty(t, e.Error)
+
+	// still down, no new event
+	es.UpdateSchema(false)
+
+	atomic.StoreInt32(&down, 0)
+	require.NoError(t, es.UpdateSchema(false))
+	e = receiveEvent(t, events)
+	assert.Equal(t, ServiceUpEvent, e.Type)
+	assert.Empty(t, events)
+}
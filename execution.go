@@ -1,18 +1,22 @@
 package bramble
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
 	"github.com/opentracing/opentracing-go"
 	log "github.com/sirupsen/logrus"
 	"github.com/uber/jaeger-client-go"
@@ -37,45 +41,360 @@ func newExecutableSchema(plugins []Plugin, maxRequestsPerQuery int64, client *Gr
 		GraphqlClient:       client,
 		plugins:             plugins,
 		MaxRequestsPerQuery: maxRequestsPerQuery,
+		planCache:           newPlanCache(),
+		fingerprints:        newFingerprintCache(),
+		schemaSkew:          newSchemaSkewDetector(),
+		serviceLimiters:     newServiceRequestLimiters(),
+		clientLimiter:       newClientLimiter(),
+		idempotencyCache:    newIdempotencyCache(),
+		endpointBalancers:   newEndpointBalancers(),
+		subscriptions:       newUpstreamSubscriptions(),
+		subscriptionBatches: newSubscriptionBatches(),
+		drain:               newDrainState(),
+		Events:              NewEventBus(),
 	}
 }
 
 // ExecutableSchema contains all the necessary information to execute queries
 type ExecutableSchema struct {
-	MergedSchema        *ast.Schema
+	// MergedSchema is the full merged schema, including the @private fields
+	MergedSchema *ast.Schema
+	// PublicSchema is the merged schema without the @private fields, exposed
+	// to the clients
+	PublicSchema        *ast.Schema
 	Locations           FieldURLMap
 	IsBoundary          map[string]bool
 	Services            map[string]*Service
 	BoundaryQueries     BoundaryQueriesMap
+	FieldRoles          FieldRolesMap
+	Requires            RequiresMap
 	GraphqlClient       *GraphQLClient
 	Tracer              opentracing.Tracer
 	MaxRequestsPerQuery int64
+	// MaxQueryComplexity is the maximum complexity of the operations, as
+	// computed by gqlgen (one per field), no limit if 0
+	MaxQueryComplexity int
+	// RejectBreakingChanges prevents schema updates containing breaking
+	// changes from being applied, unless forced with ForceSchemaUpdate.
+	RejectBreakingChanges bool
+	// LocaleArguments are the field arguments the request locale (if any) is
+	// injected into
+	LocaleArguments LocaleArguments
+	// RolesClaim is the claim containing the caller roles checked against
+	// the @auth directives, defaults to "roles"
+	RolesClaim string
+	// Joins are fields added to the merged schema, resolved by another
+	// service from a foreign key
+	Joins []Join
+	// ErrorFormatter formats the errors of the query plan steps, defaults to
+	// VerboseErrorFormatter. Plugins can set a custom formatter in Init.
+	ErrorFormatter ErrorFormatter
+	// ServiceName is the name of the gateway when it's federated by another
+	// Bramble gateway. If set the gateway exposes the service and boundary
+	// queries.
+	ServiceName string
+	// RawJSONMerge keeps the responses of the services as raw JSON when
+	// merging them, only the objects along the insertion points of the
+	// children steps are decoded
+	RawJSONMerge bool
+	// BoundaryCache caches the results of the boundary lookups, if set
+	BoundaryCache *BoundaryCache
+	// BoundaryQueryBatching sends the boundary queries of the sibling child
+	// steps querying the same type of the same service in a single request
+	BoundaryQueryBatching bool
+	// MaxConcurrentRequestsPerQuery limits the number of concurrent requests
+	// to the services made by a single query, 0 means no limit
+	MaxConcurrentRequestsPerQuery int
+	// MaxConcurrentRequestsPerService limits the number of concurrent
+	// requests to each service, across all the queries, 0 means no limit
+	MaxConcurrentRequestsPerService int
+	// ServiceReplicas are the replicas of the services, by service URL. The
+	// replicas must serve the same schema as the service.
+	ServiceReplicas map[string][]string
+	// HedgingDelay is the time after which a query request to a service with
+	// replicas is also sent to one of the replicas, the first successful
+	// response is used. Requests aren't hedged if it's 0.
+	HedgingDelay time.Duration
+	// ExecutionTimeout is the time after which the pending requests of an
+	// operation are cancelled and the partial result is returned, with an
+	// error for each step that didn't complete. No timeout if it's 0.
+	ExecutionTimeout time.Duration
+	// DeadlineBudgeting splits the time left before the execution deadline
+	// (the execution timeout or the deadline of the incoming request) between
+	// the sequential phases of the plan: the requests of a step are cancelled
+	// once the step used its share of the time left.
+	DeadlineBudgeting bool
+	// ServiceEndpoints are the URLs the query requests to a service are load
+	// balanced across, by service URL. The service URL still identifies the
+	// service and is used for the schema updates.
+	ServiceEndpoints map[string]ServiceEndpoints
+	// ReadinessQuorum is the fraction of the services whose schema must be
+	// merged for the gateway to be ready, defaults to 1 (all the services)
+	ReadinessQuorum float64
+	// Events publishes the gateway lifecycle events (schema updates, services
+	// down...), plugins can subscribe to it in Init
+	Events *EventBus
+	// MaxOperationsPerClient limits the number of operations in flight for
+	// each client, 0 means no limit
+	MaxOperationsPerClient int
+	// MaxSubscriptionsPerClient limits the number of active websocket
+	// subscriptions of each client, 0 means no limit
+	MaxSubscriptionsPerClient int
+	// ClientIDHeader is the request header identifying the client for the
+	// per-client limits. If empty, or missing from the request, the client
+	// is identified by the "sub" claim or its remote address.
+	ClientIDHeader string
+	// ClientMetadataHeaders are the request headers identifying the client
+	// application (e.g. "apollographql-client-name"), forwarded to all the
+	// services
+	ClientMetadataHeaders []string
+	// SlowQueryLog reports the operations whose execution exceeded a
+	// threshold, no operation is reported if it's nil
+	SlowQueryLog *SlowQueryLog
+	// SchemaRegistry stores the versions of the merged schema, and the
+	// schemas of the services if FetchServiceSchemasFromRegistry is set
+	SchemaRegistry SchemaRegistry
+	// FetchServiceSchemasFromRegistry gets the schemas of the services from
+	// the schema registry instead of querying the services
+	FetchServiceSchemasFromRegistry bool
+	// PinnedSchemaVersion is the hash of the version of the merged schema to
+	// serve, the schemas of the services are taken from the version in the
+	// schema registry and no version is published
+	PinnedSchemaVersion string
+	// ServiceCanaries are the canary versions of the services, by service
+	// URL. A percentage of the plan steps of the service are routed to its
+	// canary.
+	ServiceCanaries map[string]ServiceCanary
+	// SubscriptionKeepAlive is the interval of the pings sent on the
+	// subscription connections to the services, 30s if zero
+	SubscriptionKeepAlive time.Duration
+	// SubscriptionBatchWindow is the time the child steps of the concurrent
+	// subscription events are batched for, they aren't batched if zero
+	SubscriptionBatchWindow time.Duration
+	// ReportDeprecations adds the deprecated fields selected by the operations
+	// to the deprecations extension of the responses
+	ReportDeprecations bool
+	// Introspection restricts the introspection queries to a list of callers
+	Introspection IntrospectionConfig
+	// PaginationGuard is the policy applied to the paginated fields selected
+	// without any pagination argument
+	PaginationGuard PaginationGuardConfig
+	// DirectivePassthrough is the policy applied to the executable
+	// directives defined by the services
+	DirectivePassthrough DirectivePassthroughConfig
+	// StrictResponseValidation validates the merged result against the
+	// merged schema before it's returned, the invalid values are replaced
+	// with null and reported as errors
+	StrictResponseValidation bool
+	// LenientNullServices are the URLs of the services whose non-nullable
+	// fields are treated as nullable: their null values are reported as
+	// errors without bubbling up to the parent
+	LenientNullServices map[string]bool
+	// Compression configures the compression of the responses, they aren't
+	// compressed if it's nil
+	Compression *CompressionConfig
+	// ErrorStatusCodes maps the codes of the response errors to the HTTP
+	// status of the response, the highest mapped status is used
+	ErrorStatusCodes map[string]int
+	// SchemaTransforms rename and remove the types and fields of the
+	// services before their schemas are merged, by service URL
+	SchemaTransforms map[string]SchemaTransform
+	// ServiceSchemas are the sources of the schemas of the services not
+	// implementing the service query, by service URL
+	ServiceSchemas map[string]ServiceSchemaConfig
+	// ErrorClassification maps the errors of the plan steps to the action
+	// taken (retry, null, fail-step or fail-request), after the classifier
+	// plugins. The steps are failed if it's nil.
+	ErrorClassification *ErrorClassification
+	// IdempotencyCacheWindow is how long the responses of the mutations sent
+	// with an idempotency key are kept, the mutations sent again with the
+	// same key by the same client get the kept response. The responses
+	// aren't kept if it's 0.
+	IdempotencyCacheWindow time.Duration
+	// OperationMetrics reports the duration of the operations by
+	// fingerprint
+	OperationMetrics bool
+
+	joins          JoinsMap
+	gatewayService *gatewayService
+
+	// planCache contains the query plans computed with the current schema
+	planCache graphql.Cache
+	// fingerprints contains the fingerprints of the operations, by query
+	// document
+	fingerprints graphql.Cache
+	// schemaSkew detects the services serving a schema different from the
+	// one they had when the merged schema was built
+	schemaSkew *schemaSkewDetector
+	// serviceLimiters limit the concurrent requests to each service
+	serviceLimiters *serviceRequestLimiters
+	// clientLimiter counts the operations and subscriptions of each client
+	clientLimiter *clientLimiter
+	// idempotencyCache keeps the responses of the mutations sent with an
+	// idempotency key
+	idempotencyCache *idempotencyCache
+	// endpointBalancers pick the endpoint of the services with endpoints
+	endpointBalancers *endpointBalancers
+	// transformedNames are the original names of the types and fields of the
+	// transformed services, by service URL
+	transformedNames map[string]*transformedNames
+	// drain tracks the in-flight operations for the graceful shutdown
+	drain *drainState
+	// subscriptionBatches batches the child steps of the subscription events
+	subscriptionBatches *subscriptionBatches
+	// subscriptions multiplexes the subscriptions to the services
+	subscriptions *upstreamSubscriptions
+	mutex         sync.RWMutex
+	plugins       []Plugin
+	schemaChanges SchemaChangeReport
+	// pendingServices is the new list of services, waiting for the merged
+	// schema to be successfully updated
+	pendingServices map[string]*Service
+	// mergedServices are the URLs of the services part of the merged schema
+	mergedServices map[string]bool
+	// schemaVersion is the hash of the merged schema
+	schemaVersion string
+	// publishedSchemaVersion is the last schema version published to the
+	// schema registry
+	publishedSchemaVersion string
+	// pinnedVersionApplied is set once the pinned schema version is merged
+	pinnedVersionApplied bool
+	// serviceListMutex serializes the changes made by AddService and
+	// RemoveService
+	serviceListMutex sync.Mutex
+	// hooks are the execution hooks added with AddExecutionHooks
+	hooks      []ExecutionHooks
+	hooksMutex sync.Mutex
+	// reconfigureMutex serializes the calls to ReconfigurePlugin
+	reconfigureMutex sync.Mutex
+}
 
-	mutex   sync.RWMutex
-	plugins []Plugin
+// SchemaChangeReport contains the changes detected during the last merged
+// schema update.
+type SchemaChangeReport struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Names of the services that were updated
+	Services []string `json:"services"`
+	// URLs of the services that were removed
+	RemovedServices []string `json:"removedServices,omitempty"`
+	// Whether the new merged schema was applied
+	Applied bool           `json:"applied"`
+	Changes []SchemaChange `json:"changes"`
 }
 
 // UpdateServiceList replaces the list of services with the provided one and
 // update the schema.
+// The new list of services is applied at the same time as the new merged
+// schema, once the in-flight queries are done. If the schema update fails
+// (or is rejected) the current services are kept and the new list is applied
+// on the next successful update.
 func (s *ExecutableSchema) UpdateServiceList(services []string) error {
+	s.mutex.Lock()
+	current := s.Services
+	if s.pendingServices != nil {
+		current = s.pendingServices
+	}
 	newServices := make(map[string]*Service)
 	for _, svcURL := range services {
-		if svc, ok := s.Services[svcURL]; ok {
+		if svc, ok := current[svcURL]; ok {
 			newServices[svcURL] = svc
 		} else {
-			newServices[svcURL] = NewService(svcURL)
+			newServices[svcURL] = NewService(svcURL, s.serviceClientOpts()...)
 		}
 	}
-	s.Services = newServices
+	s.pendingServices = newServices
+	s.mutex.Unlock()
 
 	return s.UpdateSchema(true)
 }
 
+// ServiceURLs returns the URLs of the services, including the changes to the
+// list of services waiting for the next successful schema update
+func (s *ExecutableSchema) ServiceURLs() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	current := s.Services
+	if s.pendingServices != nil {
+		current = s.pendingServices
+	}
+	urls := make([]string, 0, len(current))
+	for url := range current {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// ServiceList returns the services of the merged schema, ordered by URL
+func (s *ExecutableSchema) ServiceList() []*Service {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	services := make([]*Service, 0, len(s.Services))
+	for _, svc := range s.Services {
+		services = append(services, svc)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].ServiceURL < services[j].ServiceURL
+	})
+	return services
+}
+
+// AddService adds the service to the list of services and updates the schema.
+// Adding a service already in the list only updates the schema.
+func (s *ExecutableSchema) AddService(serviceURL string) error {
+	s.serviceListMutex.Lock()
+	defer s.serviceListMutex.Unlock()
+	urls := s.ServiceURLs()
+	for _, url := range urls {
+		if url == serviceURL {
+			return s.UpdateSchema(false)
+		}
+	}
+	return s.UpdateServiceList(append(urls, serviceURL))
+}
+
+// RemoveService removes the service from the list of services and updates the
+// schema. It returns false if the service isn't in the list.
+func (s *ExecutableSchema) RemoveService(serviceURL string) (bool, error) {
+	s.serviceListMutex.Lock()
+	defer s.serviceListMutex.Unlock()
+	var urls []string
+	found := false
+	for _, url := range s.ServiceURLs() {
+		if url == serviceURL {
+			found = true
+			continue
+		}
+		urls = append(urls, url)
+	}
+	if !found {
+		return false, nil
+	}
+	return true, s.UpdateServiceList(urls)
+}
+
 // UpdateSchema updates the schema from every service and then update the merged
 // schema.
 func (s *ExecutableSchema) UpdateSchema(forceRebuild bool) error {
+	return s.updateSchema(forceRebuild, false)
+}
+
+// ForceSchemaUpdate updates and rebuilds the merged schema, even if it
+// contains breaking changes.
+func (s *ExecutableSchema) ForceSchemaUpdate() error {
+	return s.updateSchema(true, true)
+}
+
+// LastSchemaChanges returns the changes detected during the last merged schema
+// update.
+func (s *ExecutableSchema) LastSchemaChanges() SchemaChangeReport {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.schemaChanges
+}
+
+func (s *ExecutableSchema) updateSchema(forceRebuild, allowBreakingChanges bool) error {
 	var services []*Service
-	var schemas []*ast.Schema
 	var updatedServices []string
 	var invalidschema float64 = 0
 
@@ -83,20 +402,76 @@ func (s *ExecutableSchema) UpdateSchema(forceRebuild bool) error {
 
 	promServiceUpdateError.Reset()
 
-	for url, s := range s.Services {
+	s.mutex.RLock()
+	serviceMap := s.Services
+	pending := s.pendingServices
+	s.mutex.RUnlock()
+	gatewayName := s.ServiceName
+	events := s.Events
+	transforms := s.SchemaTransforms
+	schemaConfigs := s.ServiceSchemas
+
+	source, upToDate, err := s.schemaSource(pending != nil)
+	if err != nil {
+		invalidschema = 1
+		promSchemaRegistryErrors.Inc()
+		return err
+	}
+	if upToDate {
+		return nil
+	}
+
+	var removedServices []string
+	if pending != nil {
+		for url := range serviceMap {
+			if _, ok := pending[url]; !ok {
+				removedServices = append(removedServices, url)
+			}
+		}
+		sort.Strings(removedServices)
+		serviceMap = pending
+		forceRebuild = true
+	}
+
+	for url, s := range serviceMap {
 		logger := log.WithFields(log.Fields{
 			"url":     url,
 			"version": s.Version,
 			"service": s.Name,
 		})
-		updated, err := s.Update()
+		s.transform = nil
+		if t, ok := transforms[url]; ok {
+			s.transform = &t
+		}
+		s.schemaConfig = nil
+		if c, ok := schemaConfigs[url]; ok {
+			s.schemaConfig = &c
+		}
+		wasDown := s.Status != "" && s.Status != "OK"
+		var updated bool
+		var err error
+		if source != nil {
+			updated, err = s.updateFrom(source)
+		} else {
+			updated, err = s.Update()
+		}
+		if err == nil && gatewayName != "" && s.Name == gatewayName {
+			err = fmt.Errorf("service has the same name as the gateway (%q), a gateway can't federate itself", gatewayName)
+			s.Status = "Invalid (same name as the gateway)"
+		}
 		if err != nil {
 			promServiceUpdateError.WithLabelValues(s.ServiceURL).Inc()
 			invalidschema = 1
 			logger.WithError(err).Error("unable to update service")
+			if !wasDown {
+				events.Publish(Event{Type: ServiceDownEvent, Service: s.Name, ServiceURL: url, Error: err.Error()})
+			}
 			// Ignore this service in this update
 			continue
 		}
+		if wasDown {
+			events.Publish(Event{Type: ServiceUpEvent, Service: s.Name, ServiceURL: url})
+		}
 
 		if updated {
 			logger.Info("service was upgraded")
@@ -104,44 +479,223 @@ func (s *ExecutableSchema) UpdateSchema(forceRebuild bool) error {
 		}
 
 		services = append(services, s)
-		schemas = append(schemas, s.Schema)
 	}
 
 	if len(updatedServices) > 0 || forceRebuild {
 		log.Info("rebuilding merged schema")
-		schema, err := MergeSchemas(schemas...)
+		schema, err := MergeServiceSchemas(services...)
 		if err != nil {
 			invalidschema = 1
 			return fmt.Errorf("update of service %v caused schema error: %w", updatedServices, err)
 		}
+		addPassthroughDirectives(schema, services, s.DirectivePassthrough)
 
-		boundaryQueries := buildBoundaryQueriesMap(services...)
 		locations := buildFieldURLMap(services...)
+		joins, err := applyJoins(schema, locations, s.Joins)
+		if err != nil {
+			invalidschema = 1
+			return fmt.Errorf("update of service %v caused schema error: %w", updatedServices, err)
+		}
+
+		if gatewayName != "" {
+			addGatewayServiceFields(schema, locations)
+		}
+		publicSchema := buildPublicSchema(schema)
+		var gwService *gatewayService
+		if gatewayName != "" {
+			gwService = &gatewayService{
+				Name:    gatewayName,
+				Version: Version,
+				Schema:  formatSchema(publicSchema),
+			}
+		}
+
+		s.mutex.RLock()
+		changes := DiffSchemas(s.MergedSchema, schema)
+		s.mutex.RUnlock()
+		logSchemaChanges(changes)
+
+		report := SchemaChangeReport{
+			Timestamp:       time.Now(),
+			Services:        updatedServices,
+			RemovedServices: removedServices,
+			Applied:         true,
+			Changes:         changes,
+		}
+
+		breakingChanges := FilterSchemaChanges(changes, ChangeBreaking)
+		if len(breakingChanges) > 0 && s.RejectBreakingChanges && !allowBreakingChanges {
+			report.Applied = false
+			s.mutex.Lock()
+			s.schemaChanges = report
+			s.mutex.Unlock()
+			events.Publish(Event{Type: SchemaUpdateRejectedEvent, Changes: &report})
+			return fmt.Errorf("update of service %v rejected: %d breaking changes", updatedServices, len(breakingChanges))
+		}
+
+		mergedSDL := formatSchema(schema)
+		boundaryQueries := buildBoundaryQueriesMap(services...)
+		fieldRoles := buildFieldRolesMap(services...)
+		requires := buildRequiresMap(services...)
 		isBoundary := buildIsBoundaryMap(services...)
+		transformedNames := buildTransformedNamesMap(services...)
 
+		// the lock is only acquired once the in-flight queries are done, so
+		// they can't be routed to a removed service
 		s.mutex.Lock()
+		if pending != nil && s.pendingServices != nil {
+			s.Services = pending
+			if sameServiceMap(s.pendingServices, pending) {
+				s.pendingServices = nil
+			}
+		}
 		s.Locations = locations
 		s.IsBoundary = isBoundary
 		s.MergedSchema = schema
+		s.PublicSchema = publicSchema
+		s.gatewayService = gwService
 		s.BoundaryQueries = boundaryQueries
+		s.FieldRoles = fieldRoles
+		s.Requires = requires
+		s.joins = joins
+		s.transformedNames = transformedNames
+		s.planCache = newPlanCache()
+		s.schemaSkew.setServices(services, s.ServiceEndpoints)
+		if s.GraphqlClient != nil {
+			s.GraphqlClient.Aliases.updateSchemas(services)
+		}
+		s.mergedServices = make(map[string]bool, len(services))
+		for _, svc := range services {
+			s.mergedServices[svc.ServiceURL] = true
+		}
+		if len(changes) > 0 || len(removedServices) > 0 {
+			s.schemaChanges = report
+		}
+		s.schemaVersion = schemaHash(mergedSDL)
+		s.pinnedVersionApplied = s.PinnedSchemaVersion != ""
+		schemaVersion := s.schemaVersion
 		s.mutex.Unlock()
+
+		logger := log.WithField("schema.version", schemaVersion)
+		if s.PinnedSchemaVersion != "" && schemaVersion != s.PinnedSchemaVersion {
+			logger.WithField("schema.pinned_version", s.PinnedSchemaVersion).Warn("merged schema differs from the pinned schema version")
+		}
+		s.publishSchemaVersion(mergedSDL, services)
+
+		events.Publish(Event{Type: SchemaUpdatedEvent, Changes: &report})
+		events.Publish(Event{Type: PlanCacheFlushedEvent})
+		for _, url := range removedServices {
+			log.WithField("url", url).Info("service removed")
+			events.Publish(Event{Type: ServiceRemovedEvent, ServiceURL: url})
+		}
 	}
 
 	return nil
 }
 
-// Exec returns the query execution handler
+// plan returns the query plan of the operation, from the plan cache if the
+// same operation was already planned with the current schema
+func (s *ExecutableSchema) plan(ctx context.Context, fingerprint string, op *ast.OperationDefinition, variables map[string]interface{}) (*QueryPlan, error) {
+	var key string
+	if s.planCache != nil {
+		key = planCacheKey(fingerprint, op, variables)
+		if plan, ok := s.planCache.Get(ctx, key); ok {
+			promPlanCacheHits.Inc()
+			return plan.(*QueryPlan), nil
+		}
+		promPlanCacheMisses.Inc()
+	}
+
+	plan, err := Plan(&PlanningContext{
+		Operation:  op,
+		Schema:     s.MergedSchema,
+		Locations:  s.Locations,
+		IsBoundary: s.IsBoundary,
+		Services:   s.Services,
+		Joins:      s.joins,
+		Requires:   s.Requires,
+	})
+	if err != nil {
+		return nil, err
+	}
+	translateStepNames(s.MergedSchema, s.transformedNames, plan.RootSteps)
+
+	if s.planCache != nil {
+		preformatDocuments(ctx, s.MergedSchema, plan.RootSteps)
+		s.planCache.Add(ctx, key, plan)
+	}
+	return plan, nil
+}
+
+func sameServiceMap(a, b map[string]*Service) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for url, svc := range a {
+		if b[url] != svc {
+			return false
+		}
+	}
+	return true
+}
+
+func logSchemaChanges(changes []SchemaChange) {
+	for _, c := range changes {
+		logger := log.WithFields(log.Fields{
+			"criticality": c.Criticality,
+			"path":        c.Path,
+		})
+		if c.Criticality == ChangeBreaking {
+			logger.Warn(c.Message)
+		} else {
+			logger.Info(c.Message)
+		}
+	}
+}
+
+// Exec returns the query execution handler. The handler returns a single
+// response, following calls return nil to signal the end of the response
+// stream to the transport.
 func (s *ExecutableSchema) Exec(ctx context.Context) graphql.ResponseHandler {
-	return s.ExecuteQuery
+	if subscriptionOperation(ctx) {
+		return s.executeSubscription(ctx)
+	}
+	var executed int32
+	return func(ctx context.Context) *graphql.Response {
+		if !atomic.CompareAndSwapInt32(&executed, 0, 1) {
+			return nil
+		}
+		release, drainErr := s.drain.acquire()
+		if drainErr != nil {
+			return &graphql.Response{Errors: gqlerror.List{drainErr}}
+		}
+		defer release()
+		ctx, cancel := s.drain.operationContext(ctx)
+		defer cancel()
+		return s.ExecuteQuery(ctx)
+	}
 }
 
 // ExecuteQuery executes an incoming query
 func (s *ExecutableSchema) ExecuteQuery(ctx context.Context) *graphql.Response {
+	return s.executeIdempotentMutation(ctx, graphql.GetOperationContext(ctx).Operation, s.executeQuery)
+}
+
+func (s *ExecutableSchema) executeQuery(ctx context.Context) (response *graphql.Response) {
 	start := time.Now()
 
 	opctx := graphql.GetOperationContext(ctx)
 	op := opctx.Operation
 
+	release, limitErr := s.acquireClientOperation(ctx)
+	if limitErr != nil {
+		return &graphql.Response{Errors: gqlerror.List{limitErr}}
+	}
+	defer release()
+
+	fingerprint := s.operationFingerprint(ctx)
+	ctx = AddOperationFingerprintToContext(ctx, fingerprint)
+
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
@@ -158,18 +712,54 @@ func (s *ExecutableSchema) ExecuteQuery(ctx context.Context) *graphql.Response {
 	// The op passed in is a cached value
 	// so it must be copied before modification
 	op = s.evaluateSkipAndInclude(variables, op)
+	s.applyDirectivePassthrough(op)
+
+	// cached (and persisted) operations aren't validated again by gqlgen,
+	// they might reference fields that were removed from the schema since
+	if errs := unavailableFieldErrors(s.PublicSchema, op); len(errs) > 0 {
+		return &graphql.Response{Errors: errs}
+	}
+
+	if err := s.checkIntrospection(ctx, op); err != nil {
+		return &graphql.Response{Errors: gqlerror.List{err}}
+	}
+
+	if locale, ok := GetLocaleFromContext(ctx); ok {
+		injectLocaleArguments(s.MergedSchema, op.SelectionSet, s.LocaleArguments, locale)
+	}
+
+	unboundedLists, paginationErrs := s.PaginationGuard.guardPagination(op, variables)
+	if len(paginationErrs) > 0 {
+		return &graphql.Response{Errors: paginationErrs}
+	}
+
+	hooks := s.executionHooks()
+	defer func() {
+		if response != nil {
+			hooks.onError(ctx, response.Errors)
+		}
+	}()
+	ctx, err := hooks.onRequest(ctx, op, variables)
+	if err != nil {
+		return &graphql.Response{Errors: gqlerror.List{hookError(err)}}
+	}
 
 	var errs gqlerror.List
 	perms, hasPerms := GetPermissionsFromContext(ctx)
 	if hasPerms {
 		errs = perms.FilterAuthorizedFields(op)
 	}
+	errs = append(errs, s.filterFieldsByRole(ctx, op)...)
 
-	filteredSchema := s.MergedSchema
+	filteredSchema := s.Schema()
 	if hasPerms {
-		filteredSchema = perms.FilterSchema(s.MergedSchema)
+		filteredSchema = perms.FilterSchema(filteredSchema)
 	}
-	for _, f := range selectionSetToFields(op.SelectionSet) {
+	// the client aliases are escaped so they don't clash with the aliases of
+	// the fields injected by the planner, the response is marshalled with the
+	// client aliases
+	plannedOp := escapeOperationAliases(op)
+	for _, f := range selectionSetToFields(plannedOp.SelectionSet) {
 		switch f.Name {
 		case "__type":
 			name := f.Arguments.ForName("name").Value.Raw
@@ -179,26 +769,107 @@ func (s *ExecutableSchema) ExecuteQuery(ctx context.Context) *graphql.Response {
 		}
 	}
 
-	plan, err := Plan(&PlanningContext{
-		Operation:  op,
-		Schema:     s.Schema(),
-		Locations:  s.Locations,
-		IsBoundary: s.IsBoundary,
-		Services:   s.Services,
-	})
-
+	plan, err := s.plan(ctx, fingerprint, plannedOp, variables)
 	if err != nil {
 		return graphql.ErrorResponse(ctx, err.Error())
 	}
+	plan, err = hooks.onPlan(ctx, plan)
+	if err != nil {
+		return &graphql.Response{Errors: gqlerror.List{hookError(err)}}
+	}
 
 	AddField(ctx, "operation.name", op.Name)
 	AddField(ctx, "operation.type", op.Operation)
+	AddField(ctx, "operation.fingerprint", fingerprint)
+
+	qe := newQueryExecution(s.GraphqlClient, s.MergedSchema, s.Tracer, s.MaxRequestsPerQuery, s.BoundaryQueries)
+	qe.errorFormatter = s.ErrorFormatter
+	qe.gatewayService = s.gatewayService
+	qe.rawJSON = s.RawJSONMerge
+	qe.boundaryBatching = s.BoundaryQueryBatching
+	qe.boundaryCache = s.BoundaryCache
+	if op.Operation == ast.Subscription {
+		qe.subscriptionBatches = s.subscriptionBatches
+		qe.subscriptionBatchWindow = s.SubscriptionBatchWindow
+	}
+	qe.serviceLimiters = s.serviceLimiters
+	qe.maxServiceConcurrency = s.MaxConcurrentRequestsPerService
+	qe.serviceReplicas = s.ServiceReplicas
+	qe.hedgingDelay = s.HedgingDelay
+	qe.endpointBalancers = s.endpointBalancers
+	qe.serviceEndpoints = s.ServiceEndpoints
+	qe.serviceCanaries = s.ServiceCanaries
+	qe.transformedNames = s.transformedNames
+	qe.hooks = hooks
+	qe.operationName = op.Name
+	qe.operationDirectives = s.operationDirectives(op, plan, variables)
+	qe.errorClassifier = s.stepErrorClassifier()
+
+	if debugInfo, ok := ctx.Value(DebugKey).(DebugInfo); ok && debugInfo.DryRun && op.Operation != ast.Subscription {
+		// the documents are generated but not sent, there's no data
+		AddField(ctx, "dry_run", true)
+		graphql.RegisterExtension(ctx, "dryRun", qe.dryRun(ctx, plan))
+		if debugInfo.Plan {
+			graphql.RegisterExtension(ctx, "plan", plan)
+		}
+		return &graphql.Response{Data: json.RawMessage("null"), Errors: errs}
+	}
+
+	ctx = addSchemaSkewDetectorToContext(ctx, s.schemaSkew)
+	ctx, sizes := addPayloadSizesToContext(ctx)
+	debugInfo, hasDebugInfo := ctx.Value(DebugKey).(DebugInfo)
+	var downstream *downstreamExtensions
+	if hasDebugInfo {
+		ctx, downstream = addDownstreamExtensionsToContext(ctx)
+	}
+	qe.scheduler = newStepScheduler(s.MaxConcurrentRequestsPerQuery, plan, hasDebugInfo && debugInfo.Schedule)
 
-	qe := newQueryExecution(s.GraphqlClient, s.Schema(), s.Tracer, s.MaxRequestsPerQuery, s.BoundaryQueries)
-	executionErrors := qe.execute(ctx, plan, result)
+	execCtx := ctx
+	if s.ExecutionTimeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(ctx, s.ExecutionTimeout)
+		defer cancel()
+		qe.executionTimeout = s.ExecutionTimeout
+	}
+	if op.Operation == ast.Mutation {
+		execCtx = addMutationIdempotencyKeyToContext(execCtx)
+	}
+	if s.DeadlineBudgeting {
+		qe.stepPhases = make(map[*QueryPlanStep]int)
+		stepPhases(plan.RootSteps, qe.stepPhases)
+	}
+	executionErrors := qe.execute(execCtx, plan, result)
+	for _, err := range executionErrors {
+		err.Path = unescapePath(err.Path)
+	}
 	errs = append(errs, executionErrors...)
+	defer func() {
+		if response != nil {
+			s.reportSlowQuery(ctx, time.Since(start), opctx.Operation, variables, qe, sizes, len(response.Errors))
+			if s.OperationMetrics {
+				observeOperationDuration(opctx.Operation, fingerprint, time.Since(start))
+			}
+		}
+	}()
+	if qe.requestFailed {
+		// a step failed with the fail-request action, the partial result
+		// isn't returned
+		AddField(ctx, "errors", errs)
+		return &graphql.Response{Errors: errs}
+	}
+	if err := hooks.onMergedResponse(ctx, result); err != nil {
+		return &graphql.Response{Errors: append(errs, hookError(err))}
+	}
+	sizes.observe(s.serviceNameForURL)
+	totalSizes := sizes.total()
+	AddFields(ctx, EventFields{
+		"downstream.requests":            totalSizes.Requests,
+		"downstream.request_bytes":       totalSizes.RequestBytes,
+		"downstream.response_bytes":      totalSizes.ResponseBytes,
+		"downstream.response_wire_bytes": totalSizes.ResponseWireBytes,
+	})
 	extensions := make(map[string]interface{})
-	if debugInfo, ok := ctx.Value(DebugKey).(DebugInfo); ok {
+	if hasDebugInfo {
 		if debugInfo.Query {
 			extensions["query"] = op
 		}
@@ -210,10 +881,34 @@ func (s *ExecutableSchema) ExecuteQuery(ctx context.Context) *graphql.Response {
 		}
 		if debugInfo.Timing {
 			extensions["timing"] = time.Since(start).Round(time.Millisecond).String()
+			extensions["steps"] = qe.StepTimings
+		}
+		if debugInfo.Schedule {
+			extensions["schedule"] = qe.scheduler.scheduleDecisions()
 		}
 		if debugInfo.TraceID {
 			extensions["traceid"] = TraceIDFromContext(ctx)
 		}
+		if debugInfo.Sizes {
+			extensions["sizes"] = map[string]interface{}{
+				"services": sizes.byURL(),
+				"total":    totalSizes,
+			}
+		}
+		if d := downstream.list(); len(d) > 0 {
+			extensions["downstream"] = d
+		}
+	}
+
+	if s.ReportDeprecations {
+		if warnings := deprecationWarnings(op); len(warnings) > 0 {
+			extensions["deprecations"] = warnings
+			observeDeprecationWarnings(warnings)
+		}
+	}
+
+	if len(unboundedLists) > 0 {
+		extensions["unboundedLists"] = unboundedLists
 	}
 
 	for _, plugin := range s.plugins {
@@ -226,8 +921,36 @@ func (s *ExecutableSchema) ExecuteQuery(ctx context.Context) *graphql.Response {
 		graphql.RegisterExtension(ctx, name, value)
 	}
 
-	res, err := marshalResult(result, op.SelectionSet, s.MergedSchema, &ast.Type{NamedType: strings.Title(string(op.Operation))})
-	if err != nil {
+	var validation *resultValidation
+	if s.StrictResponseValidation {
+		validation = &resultValidation{locations: s.Locations, services: s.Services}
+	}
+	var lenient *lenientNulls
+	if len(s.LenientNullServices) > 0 {
+		lenient = &lenientNulls{
+			resultValidation: resultValidation{locations: s.Locations, services: s.Services},
+			urls:             s.LenientNullServices,
+		}
+	}
+	// the data is written directly in the binary encoding requested by the
+	// client, if any
+	var encoding *responseEncoding
+	requestedEncoding := getRequestedEncodingFromContext(ctx)
+	if requestedEncoding != nil {
+		encoding = requestedEncoding.encoding
+	}
+	res, err := marshalValidatedResult(result, plannedOp.SelectionSet, s.MergedSchema, &ast.Type{NamedType: strings.Title(string(op.Operation))}, validation, lenient, encoding)
+	var nullErrs gqlerror.List
+	if errors.As(err, &nullErrs) {
+		// non-nullable fields are null, the null values bubbled up to the
+		// closest nullable fields. Only report them if no error was reported
+		// for the fields (e.g. the step resolving them failed).
+		for _, nullErr := range nullErrs {
+			if !errorReportedAt(errs, nullErr.Path) {
+				errs = append(errs, nullErr)
+			}
+		}
+	} else if err != nil {
 		errs = append(errs, &gqlerror.Error{Message: err.Error()})
 		AddField(ctx, "errors", errs)
 		return &graphql.Response{
@@ -238,6 +961,9 @@ func (s *ExecutableSchema) ExecuteQuery(ctx context.Context) *graphql.Response {
 	if len(errs) > 0 {
 		AddField(ctx, "errors", errs)
 	}
+	if requestedEncoding != nil {
+		requestedEncoding.dataEncoded = true
+	}
 	return &graphql.Response{
 		Data:   res,
 		Errors: errs,
@@ -245,6 +971,27 @@ func (s *ExecutableSchema) ExecuteQuery(ctx context.Context) *graphql.Response {
 
 }
 
+// errorReportedAt returns whether an error was reported for the given path
+// or one of its sub-paths
+func errorReportedAt(errs gqlerror.List, path ast.Path) bool {
+	for _, e := range errs {
+		if len(e.Path) < len(path) {
+			continue
+		}
+		match := true
+		for i := range path {
+			if e.Path[i] != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
 // TraceIDFromContext retrieves the trace ID from the context if it exists.
 // Returns an empty string otherwise.
 func TraceIDFromContext(ctx context.Context) string {
@@ -259,14 +1006,15 @@ func TraceIDFromContext(ctx context.Context) string {
 	return jaegerContext.TraceID().String()
 }
 
-// Schema returns the merged schema
+// Schema returns the public schema, used to validate incoming queries
 func (s *ExecutableSchema) Schema() *ast.Schema {
-	return s.MergedSchema
+	return s.PublicSchema
 }
 
-// Complexity returns the query complexity (unimplemented)
+// Complexity returns the complexity of a field. The cost of the fields of the
+// services is unknown, so gqlgen's default complexity is used: one plus the
+// complexity of the selection set.
 func (s *ExecutableSchema) Complexity(typeName, fieldName string, childComplexity int, args map[string]interface{}) (int, bool) {
-	// FIXME: TBD
 	return 0, false
 }
 
@@ -289,7 +1037,7 @@ func (s *ExecutableSchema) resolveSchema(ctx context.Context, schema *ast.Schema
 			result[f.Alias] = s.resolveType(ctx, schema, &ast.Type{NamedType: "Subscription"}, f.SelectionSet)
 		case "directives":
 			directives := []map[string]interface{}{}
-			for _, d := range s.Schema().Directives {
+			for _, d := range schema.Directives {
 				directives = append(directives, s.resolveDirective(ctx, schema, d, f.SelectionSet))
 			}
 			result[f.Alias] = directives
@@ -563,13 +1311,97 @@ type QueryExecution struct {
 	Schema       *ast.Schema
 	Errors       []*gqlerror.Error
 	RequestCount int64
+	// StepTimings contains the execution time of every step of the plan,
+	// including the steps executed by the gateway itself
+	StepTimings []StepTiming
 
+	start           time.Time
 	maxRequest      int64
 	tracer          opentracing.Tracer
 	wg              sync.WaitGroup
 	m               sync.Mutex
 	graphqlClient   *GraphQLClient
 	boundaryQueries BoundaryQueriesMap
+	errorFormatter  ErrorFormatter
+	gatewayService  *gatewayService
+	// rawJSON is set if the responses are merged as raw JSON
+	rawJSON bool
+	// boundaryBatching is set if the boundary queries of sibling child steps
+	// are batched
+	boundaryBatching bool
+	// boundaryCache caches the results of the boundary lookups, if set
+	boundaryCache *BoundaryCache
+	// subscriptionBatches batches the child steps of the subscription events
+	// with the other events', for subscriptionBatchWindow
+	subscriptionBatches     *subscriptionBatches
+	subscriptionBatchWindow time.Duration
+	// scheduler limits the concurrent requests of the query, prioritizing
+	// the steps on the critical path of the plan
+	scheduler *stepScheduler
+	// serviceLimiters limit the concurrent requests to each service, across
+	// all the queries
+	serviceLimiters       *serviceRequestLimiters
+	maxServiceConcurrency int
+	// serviceReplicas are the URLs the requests to a service can be hedged
+	// to, after hedgingDelay
+	serviceReplicas map[string][]string
+	hedgingDelay    time.Duration
+	// endpointBalancers pick the endpoint of the services with
+	// serviceEndpoints each request is sent to
+	endpointBalancers *endpointBalancers
+	serviceEndpoints  map[string]ServiceEndpoints
+	// serviceCanaries a percentage of the requests to the services are routed
+	// to, by service URL
+	serviceCanaries map[string]ServiceCanary
+	// transformedNames are the original names of the types and fields of the
+	// transformed services, by service URL
+	transformedNames map[string]*transformedNames
+	// hooks are called before and after every request to the services
+	hooks executionHooks
+	// executionTimeout is the execution deadline of the operation, the steps
+	// failing after it are reported as timed out
+	executionTimeout time.Duration
+	// stepPhases are the number of sequential phases of the steps, by step,
+	// the deadline budget of the steps is computed from it. It's nil if the
+	// deadline budgeting is disabled.
+	stepPhases map[*QueryPlanStep]int
+	// operationName is the name of the client operation, the documents sent
+	// to the services are named after it
+	operationName string
+	// operationDirectives are the formatted directives of the operation sent
+	// with the root steps, by service URL
+	operationDirectives map[string]string
+	// errorClassifier decides the action taken for the errors of the steps
+	errorClassifier *stepErrorClassifier
+	// requestFailed is set once a step failed with the fail-request action,
+	// cancel cancels the execution of the other steps
+	requestFailed bool
+	cancel        context.CancelFunc
+}
+
+// StepTiming is the execution time of a query plan step
+type StepTiming struct {
+	ServiceName    string   `json:"serviceName"`
+	ServiceURL     string   `json:"serviceUrl"`
+	InsertionPoint []string `json:"insertionPoint"`
+	// Start is the time elapsed between the start of the execution and the
+	// start of the step
+	Start    time.Duration `json:"-"`
+	Duration time.Duration `json:"-"`
+}
+
+// MarshalJSON marshals the durations as duration strings
+func (t StepTiming) MarshalJSON() ([]byte, error) {
+	type stepTiming StepTiming
+	return json.Marshal(&struct {
+		stepTiming
+		Start    string `json:"start"`
+		Duration string `json:"duration"`
+	}{
+		stepTiming: stepTiming(t),
+		Start:      t.Start.Round(time.Millisecond).String(),
+		Duration:   t.Duration.Round(time.Millisecond).String(),
+	})
 }
 
 func newQueryExecution(client *GraphQLClient, schema *ast.Schema, tracer opentracing.Tracer, maxRequest int64, boundaryQueries BoundaryQueriesMap) *QueryExecution {
@@ -582,17 +1414,67 @@ func newQueryExecution(client *GraphQLClient, schema *ast.Schema, tracer opentra
 	}
 }
 
-func (e *QueryExecution) execute(ctx context.Context, plan *QueryPlan, resData map[string]interface{}) []*gqlerror.Error {
-	e.wg.Add(len(plan.RootSteps))
+// isMutationPlan returns whether the plan is the plan of a mutation
+func isMutationPlan(plan *QueryPlan) bool {
 	for _, step := range plan.RootSteps {
-		if step.ServiceURL == internalServiceName {
-			e.executeBrambleStep(ctx, step, resData)
-			continue
+		if step.ParentType == mutationObjectName {
+			return true
 		}
-		go e.executeRootStep(ctx, step, resData)
 	}
+	return false
+}
 
-	e.wg.Wait()
+// startRootStep executes a root step in a new goroutine
+func (e *QueryExecution) startRootStep(ctx context.Context, step *QueryPlanStep, resData map[string]interface{}) {
+	if step.ServiceURL == internalServiceName {
+		go e.executeBrambleStep(ctx, step, resData)
+		return
+	}
+	go e.executeRootStep(ctx, step, resData)
+}
+
+func (e *QueryExecution) execute(ctx context.Context, plan *QueryPlan, resData map[string]interface{}) []*gqlerror.Error {
+	e.start = time.Now()
+	parentCtx := ctx
+	ctx, e.cancel = context.WithCancel(ctx)
+	defer e.cancel()
+	if isMutationPlan(plan) {
+		// top-level mutation fields are executed serially: each root step and
+		// its child steps complete before the next root step starts
+		key := GetIdempotencyKeyFromContext(ctx)
+		for i, step := range plan.RootSteps {
+			if ctx.Err() != nil {
+				// the client disconnected or the request failed, the
+				// remaining mutations aren't executed
+				break
+			}
+			stepCtx := ctx
+			if key != "" {
+				stepCtx = AddIdempotencyKeyToContext(ctx, stepIdempotencyKey(key, i, len(plan.RootSteps)))
+			}
+			e.wg.Add(1)
+			e.startRootStep(stepCtx, step, resData)
+			e.wg.Wait()
+		}
+	} else {
+		e.wg.Add(len(plan.RootSteps))
+		for _, step := range plan.RootSteps {
+			e.startRootStep(ctx, step, resData)
+		}
+		e.wg.Wait()
+	}
+
+	if errors.Is(parentCtx.Err(), context.Canceled) {
+		// the incoming request was cancelled, i.e. the client disconnected
+		// before the end of the execution
+		promCancelledOperations.Inc()
+		AddField(ctx, "cancelled", true)
+	}
+
+	stripInjectedFields(resData, plan.RootSteps)
+	sort.SliceStable(e.StepTimings, func(i, j int) bool {
+		return e.StepTimings[i].Start < e.StepTimings[j].Start
+	})
 
 	if e.RequestCount > e.maxRequest {
 		e.Errors = append(e.Errors, &gqlerror.Error{
@@ -603,10 +1485,66 @@ func (e *QueryExecution) execute(ctx context.Context, plan *QueryPlan, resData m
 	return e.Errors
 }
 
+// recordStepTiming records the execution time of a step started at the given
+// time
+func (e *QueryExecution) recordStepTiming(step *QueryPlanStep, start time.Time) {
+	duration := time.Since(start)
+	promQueryStepDurations.WithLabelValues(step.ServiceName).Observe(duration.Seconds())
+
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.StepTimings = append(e.StepTimings, StepTiming{
+		ServiceName:    step.ServiceName,
+		ServiceURL:     step.ServiceURL,
+		InsertionPoint: step.InsertionPoint,
+		Start:          start.Sub(e.start),
+		Duration:       duration,
+	})
+}
+
 func (e *QueryExecution) addError(ctx context.Context, step *QueryPlanStep, err error) {
-	var path ast.Path
+	e.addErrorAtPaths(ctx, step, nil, "", err)
+}
+
+// addChildStepError adds the error returned by a child step, using the paths
+// of the insertion targets in the merged result.
+func (e *QueryExecution) addChildStepError(ctx context.Context, step *QueryPlanStep, targets []insertionTarget, err error) {
+	prefixes := make([]ast.Path, 0, len(targets))
+	for _, t := range targets {
+		prefixes = append(prefixes, t.Path)
+	}
+
+	var field string
+	for _, f := range selectionSetToFields(step.SelectionSet) {
+		if f.Alias != injectedIDAlias {
+			field = f.Alias
+			break
+		}
+	}
+
+	e.addErrorAtPaths(ctx, step, prefixes, field, err)
+}
+
+// addErrorAtPaths adds the error returned by a step. For steps querying
+// multiple objects at once (with "_0", "_1"... aliases or a "_result" array)
+// prefixes contains the path of each object in the merged result, and the
+// paths of the GraphQL errors returned by the service are translated
+// accordingly. Other errors are reported on the given field of every object.
+// The errors classified as null aren't reported.
+func (e *QueryExecution) addErrorAtPaths(ctx context.Context, step *QueryPlanStep, prefixes []ast.Path, field string, err error) {
+	action := e.classifyStepError(ctx, step, err)
+	GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"service": step.ServiceName,
+		"url":     step.ServiceURL,
+		"action":  action,
+	}).WithError(err).Info("step failed")
+	if action == ErrorActionNull {
+		return
+	}
+
+	var stepPath ast.Path
 	for _, p := range step.InsertionPoint {
-		path = append(path, ast.PathName(p))
+		stepPath = append(stepPath, ast.PathName(p))
 	}
 
 	var locs []gqlerror.Location
@@ -619,45 +1557,188 @@ func (e *QueryExecution) addError(ctx context.Context, step *QueryPlanStep, err
 
 		// if the field has a subset it's part of the path
 		if len(f.SelectionSet) > 0 {
-			path = append(path, ast.PathName(f.Alias))
+			stepPath = append(stepPath, ast.PathName(f.Alias))
 		}
 	}
 
+	// the selection set is formatted once, a service failing to resolve
+	// many objects can return thousands of errors
+	selectionSet := formatSelectionSetSingleLine(ctx, e.Schema, step.SelectionSet)
+
+	var gqlErr GraphqlErrors
+	timedOut := (e.timedOut(ctx) || errors.Is(err, ErrExecutionTimeout)) && !errors.As(err, &gqlErr)
+	if timedOut && !errors.Is(err, ErrExecutionTimeout) {
+		err = fmt.Errorf("%w: the step did not complete within %s", ErrExecutionTimeout, e.executionTimeout)
+	}
+
 	e.m.Lock()
 	defer e.m.Unlock()
+	if action == ErrorActionFailRequest {
+		defer e.failRequest()
+	}
 
-	var gqlErr GraphqlErrors
 	if errors.As(err, &gqlErr) {
 		for _, ge := range gqlErr {
-			extensions := ge.Extensions
-			if extensions == nil {
-				extensions = make(map[string]interface{})
-			}
-			extensions["selectionSet"] = formatSelectionSetSingleLine(ctx, e.Schema, step.SelectionSet)
+			// the extensions returned by the service are kept intact
+			extensions := make(map[string]interface{}, len(ge.Extensions)+3)
+			extensions["selectionSet"] = selectionSet
 			extensions["serviceName"] = step.ServiceName
 			extensions["serviceUrl"] = step.ServiceURL
+			for k, v := range ge.Extensions {
+				extensions[k] = v
+			}
+
+			path, fieldPath := translateErrorPath(ge.Path, prefixes)
+			errLocs := locs
+			if path == nil {
+				path = stepPath
+			} else if pos := fieldPosition(step.SelectionSet, fieldPath); pos != nil {
+				errLocs = []gqlerror.Location{{Line: pos.Line, Column: pos.Column}}
+			}
 
-			e.Errors = append(e.Errors, &gqlerror.Error{
+			e.appendError(ctx, step, err, &gqlerror.Error{
 				Message:    ge.Message,
 				Path:       path,
-				Locations:  locs,
+				Locations:  errLocs,
 				Extensions: extensions,
 			})
 		}
-	} else {
-		e.Errors = append(e.Errors, &gqlerror.Error{
-			Message:   err.Error(),
-			Path:      path,
-			Locations: locs,
-			Extensions: map[string]interface{}{
-				"selectionSet": formatSelectionSetSingleLine(ctx, e.Schema, step.SelectionSet),
-			},
+		return
+	}
+
+	paths := []ast.Path{stepPath}
+	if len(prefixes) > 0 {
+		paths = paths[:0]
+		for _, prefix := range prefixes {
+			if field != "" {
+				prefix = appendPath(prefix, ast.PathName(field))
+			}
+			paths = append(paths, prefix)
+		}
+	}
+
+	for _, path := range paths {
+		extensions := map[string]interface{}{
+			"selectionSet": selectionSet,
+		}
+		if timedOut {
+			extensions["code"] = executionTimeoutCode
+			extensions["serviceName"] = step.ServiceName
+		} else {
+			extensions["code"] = serviceErrorCode
+		}
+		e.appendError(ctx, step, err, &gqlerror.Error{
+			Message:    err.Error(),
+			Path:       path,
+			Locations:  locs,
+			Extensions: extensions,
 		})
 	}
 }
 
+// ErrExecutionTimeout is the error of the steps that didn't complete before
+// the execution timeout of the operation
+var ErrExecutionTimeout = errors.New("execution timeout exceeded")
+
+// executionTimeoutCode is the error code of the steps that didn't complete
+// before the execution timeout
+const executionTimeoutCode = "EXECUTION_TIMEOUT"
+
+// serviceErrorCode is the error code of the steps that failed without a
+// GraphQL error from the service: transport errors, invalid responses...
+const serviceErrorCode = "INTERNAL_SERVER_ERROR"
+
+// timedOut returns whether the execution timeout of the operation is exceeded
+func (e *QueryExecution) timedOut(ctx context.Context) bool {
+	return e.executionTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// appendError adds the error to the execution errors, after formatting it
+// with the error formatter. The errors of the steps cancelled by a failed
+// request are dropped. The mutex must be held.
+func (e *QueryExecution) appendError(ctx context.Context, step *QueryPlanStep, err error, gqlErr *gqlerror.Error) {
+	if e.requestFailed {
+		return
+	}
+	if e.errorFormatter != nil {
+		gqlErr = e.errorFormatter(ctx, step, err, gqlErr)
+		if gqlErr == nil {
+			return
+		}
+	}
+	e.Errors = append(e.Errors, gqlErr)
+}
+
+// translateErrorPath translates the path of an error returned by a service to
+// a path in the merged result, or returns nil if it can't be translated.
+// Without prefixes (root steps) the path is already a path in the result.
+// It also returns the path relative to the step's selection set.
+func translateErrorPath(path ast.Path, prefixes []ast.Path) (ast.Path, ast.Path) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	if prefixes == nil {
+		return path, path
+	}
+
+	name, ok := path[0].(ast.PathName)
+	if !ok || !strings.HasPrefix(string(name), "_") {
+		return nil, nil
+	}
+
+	index, rest := -1, path[1:]
+	if name == "_result" {
+		if len(rest) > 0 {
+			if i, ok := rest[0].(ast.PathIndex); ok {
+				index, rest = int(i), rest[1:]
+			}
+		}
+	} else if i, err := strconv.Atoi(string(name[1:])); err == nil {
+		index = i
+	}
+
+	if index < 0 || index >= len(prefixes) {
+		return nil, nil
+	}
+	return appendPath(prefixes[index], rest...), rest
+}
+
+// fieldPosition returns the position in the client document of the field at
+// the given path in the selection set, or of its closest parent
+func fieldPosition(selectionSet ast.SelectionSet, path ast.Path) *ast.Position {
+	var pos *ast.Position
+	for _, elem := range path {
+		name, ok := elem.(ast.PathName)
+		if !ok {
+			continue
+		}
+
+		var field *ast.Field
+		for _, f := range selectionSetToFields(selectionSet) {
+			if f.Alias == string(name) {
+				field = f
+				break
+			}
+		}
+		if field == nil {
+			break
+		}
+		if field.Position != nil {
+			pos = field.Position
+		}
+		selectionSet = field.SelectionSet
+	}
+	return pos
+}
+
+// appendPath returns a copy of the path with the elements appended
+func appendPath(path ast.Path, elems ...ast.PathElement) ast.Path {
+	return append(append(ast.Path{}, path...), elems...)
+}
+
 func (e *QueryExecution) executeRootStep(ctx context.Context, step *QueryPlanStep, result map[string]interface{}) {
 	defer e.wg.Done()
+	defer e.recordStepTiming(step, time.Now())
 	defer func() {
 		if r := recover(); r != nil {
 			AddField(ctx, "panic", map[string]interface{}{
@@ -677,31 +1758,42 @@ func (e *QueryExecution) executeRootStep(ctx context.Context, step *QueryPlanSte
 		}
 	}
 
-	q := formatSelectionSet(ctx, e.Schema, step.SelectionSet)
-	if step.ParentType == mutationObjectName {
-		q = "mutation " + q
-	} else {
-		q = "query " + q
+	if step.ParentType == subscriptionObjectName {
+		e.executeSubscriptionRootStep(ctx, step, result)
+		return
 	}
 
 	resp := map[string]json.RawMessage{}
-	promHTTPInFlightGauge.Inc()
-	req := NewRequest(q)
-	req.Headers = GetOutgoingRequestHeadersFromContext(ctx)
-	err := e.graphqlClient.Request(ctx, step.ServiceURL, req, &resp)
-	promHTTPInFlightGauge.Dec()
+	req := NewRequest(e.rootStepDocument(ctx, step))
+	req.Headers = GetOutgoingServiceRequestHeadersFromContext(ctx, step.ServiceURL)
+	if step.ParentType == mutationObjectName {
+		req.Headers = withIdempotencyKeyHeader(ctx, req.Headers)
+	}
+	err := e.request(ctx, step, req, &resp)
 	if err != nil {
 		e.addError(ctx, step, err)
+		// the service only returned errors (e.g. during an outage), there's
+		// nothing to merge and nothing to insert the children steps into
+		if len(resp) == 0 {
+			return
+		}
 	}
 
 	e.m.Lock()
-	mergeMaps(result, jsonMapToInterfaceMap(resp))
+	e.mergeStepResult(ctx, step, result, jsonMapToInterfaceMap(resp))
 	e.m.Unlock()
 
-	for _, subStep := range step.Then {
-		e.wg.Add(1)
-		go e.executeChildStep(ctx, subStep, result)
+	e.executeChildSteps(ctx, step.Then, result)
+}
+
+// rootStepDocument returns the document of the root step, with the
+// operation directives forwarded to the service
+func (e *QueryExecution) rootStepDocument(ctx context.Context, step *QueryPlanStep) string {
+	q := e.formatStepSelectionSet(ctx, step)
+	if step.ParentType == mutationObjectName {
+		return "mutation" + e.operationDirectives[step.ServiceURL] + " " + q
 	}
+	return "query" + e.operationDirectives[step.ServiceURL] + " " + q
 }
 
 func jsonMapToInterfaceMap(m map[string]json.RawMessage) map[string]interface{} {
@@ -715,9 +1807,17 @@ func jsonMapToInterfaceMap(m map[string]json.RawMessage) map[string]interface{}
 
 // executeChildStep executes a child step. It finds the insertion targets for
 // the step's insertion point and queries the specified service using the node
-// query type.
-func (e *QueryExecution) executeChildStep(ctx context.Context, step *QueryPlanStep, result map[string]interface{}) {
+// query type. If the step is part of a batch its query is sent along with the
+// queries of the other steps of the batch.
+func (e *QueryExecution) executeChildStep(ctx context.Context, step *QueryPlanStep, result map[string]interface{}, batch *boundaryBatchParticipant) {
+	if step.Join != nil {
+		e.executeJoinStep(ctx, step, result)
+		return
+	}
+
 	defer e.wg.Done()
+	defer batch.leave()
+	defer e.recordStepTiming(step, time.Now())
 	defer func() {
 		if r := recover(); r != nil {
 			AddField(ctx, "panic", map[string]interface{}{
@@ -738,34 +1838,55 @@ func (e *QueryExecution) executeChildStep(ctx context.Context, step *QueryPlanSt
 	}
 
 	e.m.Lock()
-	result = prepareMapForInsertion(step.InsertionPoint, result).(map[string]interface{})
+	result = e.prepareMapForInsertion(step.InsertionPoint, result)
+	insertionPoints := e.filterInsertionTargets(buildInsertionSlice(step.InsertionPoint, result, nil), step.ParentType)
 	e.m.Unlock()
 
-	insertionPoints := buildInsertionSlice(step.InsertionPoint, result)
 	if len(insertionPoints) == 0 {
 		return
 	}
 
-	atomic.AddInt64(&e.RequestCount, 1)
+	boundaryQuery := e.boundaryQueries.Query(step.ServiceURL, step.ParentType)
+	selectionSet := e.formatStepSelectionSet(ctx, step)
+	cacheTTL := e.boundaryCache.ttl(step, boundaryQuery)
+	if cacheTTL > 0 {
+		insertionPoints = e.insertCachedBoundaryResults(ctx, step, selectionSet, insertionPoints)
+		if len(insertionPoints) == 0 {
+			e.executeChildSteps(ctx, step.Then, result)
+			return
+		}
+	}
 
-	if e.RequestCount > e.maxRequest {
+	if atomic.AddInt64(&e.RequestCount, 1) > e.maxRequest {
 		return
 	}
 
-	boundaryQuery := e.boundaryQueries.Query(step.ServiceURL, step.ParentType)
-	selectionSet := formatSelectionSet(ctx, e.Schema, step.SelectionSet)
+	if batch == nil {
+		batch = e.subscriptionBatches.join(e.subscriptionBatchWindow, step, GetOutgoingServiceRequestHeadersFromContext(ctx, step.ServiceURL))
+		defer batch.leave()
+	}
+	aliasPrefix := batch.aliasPrefix()
 	var b strings.Builder
 
 	b.WriteString("{")
 	if boundaryQuery.Array {
-		var ids string
+		var ids strings.Builder
 		for _, ip := range insertionPoints {
-			ids += fmt.Sprintf("%q ", ip.ID)
+			ids.WriteString(boundaryQuery.formatTargetID(ip))
+			ids.WriteString(" ")
+		}
+		var requires string
+		if len(step.Requires) > 0 {
+			requires = fmt.Sprintf(", %s: %s", representationsArgumentName, e.formatRepresentations(step, insertionPoints))
 		}
-		b.WriteString(fmt.Sprintf("_result: %s(ids: [%s]) %s", boundaryQuery.Query, ids, selectionSet))
+		b.WriteString(fmt.Sprintf("%s_result: %s(%s: [%s]%s) %s", aliasPrefix, boundaryQuery.Query, boundaryQuery.ArgumentName(), ids.String(), requires, selectionSet))
 	} else {
 		for i, ip := range insertionPoints {
-			b.WriteString(fmt.Sprintf("%s: %s(id: %q) { ... on %s %s } ", nodeAlias(i), boundaryQuery.Query, ip.ID, step.ParentType, selectionSet))
+			var requires string
+			if len(step.Requires) > 0 {
+				requires = ", " + e.formatRequiredArguments(step, ip.Target)
+			}
+			b.WriteString(fmt.Sprintf("%s%s: %s(%s: %s%s) { ... on %s %s } ", aliasPrefix, nodeAlias(i), boundaryQuery.Query, boundaryQuery.ArgumentName(), boundaryQuery.formatTargetID(ip), requires, step.ParentType, selectionSet))
 		}
 	}
 	b.WriteString("}")
@@ -773,22 +1894,27 @@ func (e *QueryExecution) executeChildStep(ctx context.Context, step *QueryPlanSt
 	query := b.String()
 
 	if boundaryQuery.Array {
-		if len(step.Then) == 0 {
+		if len(step.Then) == 0 || e.rawJSON {
 			resp := struct {
 				Result []map[string]json.RawMessage `json:"_result"`
 			}{}
-			promHTTPInFlightGauge.Inc()
 			req := NewRequest(query)
-			req.Headers = GetOutgoingRequestHeadersFromContext(ctx)
-			err := e.graphqlClient.Request(ctx, step.ServiceURL, req, &resp)
-			promHTTPInFlightGauge.Dec()
+			req.Headers = GetOutgoingServiceRequestHeadersFromContext(ctx, step.ServiceURL)
+			err := e.childStepRequest(ctx, step, batch, req, &resp)
 			if err != nil {
-				e.addError(ctx, step, err)
+				e.addChildStepError(ctx, step, insertionPoints, err)
 			}
 			if len(resp.Result) != len(insertionPoints) {
-				e.addError(ctx, step, fmt.Errorf("error while querying %s: service returned incorrect number of elements", step.ServiceURL))
+				if err == nil {
+					e.addError(ctx, step, fmt.Errorf("error while querying %s: service returned incorrect number of elements", step.ServiceURL))
+				}
 				return
 			}
+			if err == nil && cacheTTL > 0 {
+				for i, ip := range insertionPoints {
+					e.boundaryCache.add(ctx, boundaryCacheKey(step, req.Headers, selectionSet, ip.ID), resp.Result[i], cacheTTL)
+				}
+			}
 			e.m.Lock()
 			for i := range insertionPoints {
 				for k, v := range resp.Result[i] {
@@ -796,25 +1922,31 @@ func (e *QueryExecution) executeChildStep(ctx context.Context, step *QueryPlanSt
 				}
 			}
 			e.m.Unlock()
+
+			e.executeChildSteps(ctx, step.Then, result)
 			return
 		}
 
 		resp := struct {
 			Result []map[string]interface{} `json:"_result"`
 		}{}
-		promHTTPInFlightGauge.Inc()
 		req := NewRequest(query)
-		req.Headers = GetOutgoingRequestHeadersFromContext(ctx)
-		err := e.graphqlClient.Request(ctx, step.ServiceURL, req, &resp)
-		promHTTPInFlightGauge.Dec()
+		req.Headers = GetOutgoingServiceRequestHeadersFromContext(ctx, step.ServiceURL)
+		err := e.childStepRequest(ctx, step, batch, req, &resp)
 		if err != nil {
-			e.addError(ctx, step, err)
-			return
+			e.addChildStepError(ctx, step, insertionPoints, err)
 		}
 		if len(resp.Result) != len(insertionPoints) {
-			e.addError(ctx, step, fmt.Errorf("error while querying %s: service returned incorrect number of elements", step.ServiceURL))
+			if err == nil {
+				e.addError(ctx, step, fmt.Errorf("error while querying %s: service returned incorrect number of elements", step.ServiceURL))
+			}
 			return
 		}
+		if err == nil && cacheTTL > 0 {
+			for i, ip := range insertionPoints {
+				e.boundaryCache.add(ctx, boundaryCacheKey(step, req.Headers, selectionSet, ip.ID), resp.Result[i], cacheTTL)
+			}
+		}
 		e.m.Lock()
 		for i := range insertionPoints {
 			for k, v := range resp.Result[i] {
@@ -823,10 +1955,7 @@ func (e *QueryExecution) executeChildStep(ctx context.Context, step *QueryPlanSt
 		}
 		e.m.Unlock()
 
-		for _, subStep := range step.Then {
-			e.wg.Add(1)
-			go e.executeChildStep(ctx, subStep, result)
-		}
+		e.executeChildSteps(ctx, step.Then, result)
 		return
 	}
 
@@ -834,21 +1963,27 @@ func (e *QueryExecution) executeChildStep(ctx context.Context, step *QueryPlanSt
 	// This is to preserve fields order with inline fragments on unions, as we
 	// have no way to determine which type was matched.
 	// e.g.: { ... on Cat { name, age } ... on Dog { age, name } }
-	if len(step.Then) == 0 {
+	// This is also the case with raw JSON merge, the sub-steps decode the
+	// objects they need.
+	if len(step.Then) == 0 || e.rawJSON {
 		resp := map[string]map[string]json.RawMessage{}
-		promHTTPInFlightGauge.Inc()
 		req := NewRequest(query)
-		req.Headers = GetOutgoingRequestHeadersFromContext(ctx)
-		err := e.graphqlClient.Request(ctx, step.ServiceURL, req, &resp)
-		promHTTPInFlightGauge.Dec()
+		req.Headers = GetOutgoingServiceRequestHeadersFromContext(ctx, step.ServiceURL)
+		err := e.childStepRequest(ctx, step, batch, req, &resp)
 		if err != nil {
-			e.addError(ctx, step, err)
-			return
+			e.addChildStepError(ctx, step, insertionPoints, err)
 		}
 		if len(resp) != len(insertionPoints) {
-			e.addError(ctx, step, fmt.Errorf("error while querying %s: service returned incorrect number of elements", step.ServiceURL))
+			if err == nil {
+				e.addError(ctx, step, fmt.Errorf("error while querying %s: service returned incorrect number of elements", step.ServiceURL))
+			}
 			return
 		}
+		if err == nil && cacheTTL > 0 {
+			for i, ip := range insertionPoints {
+				e.boundaryCache.add(ctx, boundaryCacheKey(step, req.Headers, selectionSet, ip.ID), resp[nodeAlias(i)], cacheTTL)
+			}
+		}
 		e.m.Lock()
 		for i := range insertionPoints {
 			for k, v := range resp[nodeAlias(i)] {
@@ -856,23 +1991,29 @@ func (e *QueryExecution) executeChildStep(ctx context.Context, step *QueryPlanSt
 			}
 		}
 		e.m.Unlock()
+
+		e.executeChildSteps(ctx, step.Then, result)
 		return
 	}
 
 	resp := map[string]map[string]interface{}{}
-	promHTTPInFlightGauge.Inc()
 	req := NewRequest(query)
-	req.Headers = GetOutgoingRequestHeadersFromContext(ctx)
-	err := e.graphqlClient.Request(ctx, step.ServiceURL, req, &resp)
-	promHTTPInFlightGauge.Dec()
+	req.Headers = GetOutgoingServiceRequestHeadersFromContext(ctx, step.ServiceURL)
+	err := e.childStepRequest(ctx, step, batch, req, &resp)
 	if err != nil {
-		e.addError(ctx, step, err)
-		return
+		e.addChildStepError(ctx, step, insertionPoints, err)
 	}
 	if len(resp) != len(insertionPoints) {
-		e.addError(ctx, step, fmt.Errorf("error while querying %s: service returned incorrect number of elements", step.ServiceURL))
+		if err == nil {
+			e.addError(ctx, step, fmt.Errorf("error while querying %s: service returned incorrect number of elements", step.ServiceURL))
+		}
 		return
 	}
+	if err == nil && cacheTTL > 0 {
+		for i, ip := range insertionPoints {
+			e.boundaryCache.add(ctx, boundaryCacheKey(step, req.Headers, selectionSet, ip.ID), resp[nodeAlias(i)], cacheTTL)
+		}
+	}
 	e.m.Lock()
 	for i := range insertionPoints {
 		for k, v := range resp[nodeAlias(i)] {
@@ -881,17 +2022,50 @@ func (e *QueryExecution) executeChildStep(ctx context.Context, step *QueryPlanSt
 	}
 	e.m.Unlock()
 
-	for _, subStep := range step.Then {
-		e.wg.Add(1)
-		go e.executeChildStep(ctx, subStep, result)
-	}
+	e.executeChildSteps(ctx, step.Then, result)
 }
 
-// executeBrambleStep executes the Bramble-specific operations
+// executeBrambleStep executes the Bramble-specific operations: the
+// __typename of namespaces and the gateway service fields. It's executed like
+// the other steps, the errors are reported at the step's path.
 func (e *QueryExecution) executeBrambleStep(ctx context.Context, step *QueryPlanStep, result map[string]interface{}) {
+	defer e.wg.Done()
+	defer e.recordStepTiming(step, time.Now())
+	defer func() {
+		if r := recover(); r != nil {
+			AddField(ctx, "panic", map[string]interface{}{
+				"err":        r,
+				"stacktrace": string(debug.Stack()),
+			})
+			e.addError(ctx, step, errors.New("an error happened during query execution"))
+		}
+	}()
+
+	if e.tracer != nil {
+		contextSpan := opentracing.SpanFromContext(ctx)
+		if contextSpan != nil {
+			span := e.tracer.StartSpan(step.ServiceName, opentracing.ChildOf(contextSpan.Context()))
+			ctx = opentracing.ContextWithSpan(ctx, span)
+			defer span.Finish()
+		}
+	}
+
+	// the step doesn't make any request, but it must still honor the
+	// deadline of the query
+	if err := ctx.Err(); err != nil {
+		e.addError(ctx, step, err)
+		return
+	}
+
 	m := buildTypenameResponseMap(step.SelectionSet, step.ParentType)
-	mergeMaps(result, m)
-	e.wg.Done()
+	if e.gatewayService != nil && step.ParentType == queryObjectName {
+		e.gatewayService.resolve(ctx, step.SelectionSet, m)
+	}
+	e.m.Lock()
+	e.mergeStepResult(ctx, step, result, m)
+	e.m.Unlock()
+
+	e.executeChildSteps(ctx, step.Then, result)
 }
 
 // buildTypenameResponseMap recursively builds the response map for `__typename`
@@ -915,104 +2089,266 @@ func nodeAlias(i int) string {
 	return fmt.Sprintf("_%d", i)
 }
 
-// mergeMaps merge dst into src, unmarshalling json.RawMessages when necessary
-func mergeMaps(dst, src map[string]interface{}) {
-	for k, v := range dst {
-		if b, ok := src[k]; ok {
-			// The value is in both maps, we need to merge them.
-			// If any of the 2 values is a json.RawMessage, unmarshal it first
-
-			var aValue map[string]interface{}
-			var bValue map[string]interface{}
-
-			switch value := v.(type) {
-			case json.RawMessage:
-				// we want to unmarshal only what's necessary, so unmarshal only
-				// one level of the result
-				var m map[string]json.RawMessage
-				_ = json.Unmarshal([]byte(value), &m)
-				aValue = jsonMapToInterfaceMap(m)
-				dst[k] = aValue
-			case map[string]interface{}:
-				aValue = value
-			default:
-				panic("invalid merge")
-			}
-
-			switch value := b.(type) {
-			case json.RawMessage:
-				var m map[string]json.RawMessage
-				_ = json.Unmarshal([]byte(value), &m)
-				bValue = jsonMapToInterfaceMap(m)
-			case map[string]interface{}:
-				bValue = value
-			default:
-				panic("invalid merge")
-			}
+// mergeStepResult merges the result of a root step in the merged result and
+// reports the fields with conflicting values. The mutex must be held.
+func (e *QueryExecution) mergeStepResult(ctx context.Context, step *QueryPlanStep, result, data map[string]interface{}) {
+	for _, path := range mergeMaps(result, data, nil) {
+		err := fmt.Errorf("conflicting values returned for field %s", path)
+		e.appendError(ctx, step, err, &gqlerror.Error{
+			Message: err.Error(),
+			Path:    path,
+		})
+	}
+}
 
-			mergeMaps(aValue, bValue)
+// mergeMaps merges src into dst, unmarshalling json.RawMessages when
+// necessary. The result doesn't depend on the order the maps are merged in:
+// objects are merged recursively, null values are replaced with the other
+// value, and fields with different values are set to null (even if another
+// step returns the same value later). The paths of these fields are returned.
+func mergeMaps(dst, src map[string]interface{}, path ast.Path) []ast.Path {
+	var conflicts []ast.Path
+	for k, b := range src {
+		a, ok := dst[k]
+		if !ok {
+			dst[k] = b
 			continue
 		}
+
+		var fieldConflicts []ast.Path
+		dst[k], fieldConflicts = mergeValues(a, b, appendPath(path, ast.PathName(k)))
+		conflicts = append(conflicts, fieldConflicts...)
 	}
+	return conflicts
+}
 
-	for k, v := range src {
-		if _, ok := dst[k]; ok {
-			continue
+// conflictingValue replaces the value of a field that different steps
+// returned different values for. It's marshalled as null.
+type conflictingValue struct{}
+
+// MarshalJSON marshals the value as null
+func (conflictingValue) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+func mergeValues(a, b interface{}, path ast.Path) (interface{}, []ast.Path) {
+	// the conflict was already reported
+	if _, ok := a.(conflictingValue); ok {
+		return a, nil
+	}
+	if _, ok := b.(conflictingValue); ok {
+		return b, nil
+	}
+
+	aObj, aNull := mergeValueObject(a)
+	bObj, bNull := mergeValueObject(b)
+	switch {
+	case aNull:
+		return b, nil
+	case bNull:
+		return a, nil
+	case aObj != nil && bObj != nil:
+		return aObj, mergeMaps(aObj, bObj, path)
+	case aObj == nil && bObj == nil && jsonValuesEqual(a, b):
+		return a, nil
+	}
+	return conflictingValue{}, []ast.Path{path}
+}
+
+// mergeValueObject returns the value as a map if it's an object (only
+// unmarshalling one level of raw values), or whether it's null
+func mergeValueObject(v interface{}) (map[string]interface{}, bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, true
+	case map[string]interface{}:
+		return v, v == nil
+	case json.RawMessage:
+		trimmed := bytes.TrimSpace(v)
+		if len(trimmed) == 0 || trimmed[0] == 'n' {
+			return nil, true
+		}
+		if trimmed[0] == '{' {
+			var m map[string]json.RawMessage
+			_ = json.Unmarshal(trimmed, &m)
+			return jsonMapToInterfaceMap(m), false
 		}
-		dst[k] = v
 	}
+	return nil, false
+}
+
+// jsonValuesEqual returns whether the values have the same JSON encoding
+func jsonValuesEqual(a, b interface{}) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
 }
 
 type insertionTarget struct {
 	ID     string
 	Target map[string]interface{}
+	// Path of the target in the merged result
+	Path ast.Path
+	// numericID is whether the id is a number (e.g. an Int or a custom
+	// scalar serialized as a number), it isn't quoted in the boundary queries
+	numericID bool
 }
 
 // prepareMapForInsertion recursively traverses the result map to the insertion
-// point and unmarshals any json.RawMessage it finds on the way
+// point and unmarshals any json.RawMessage it finds on the way. The lists
+// along the insertion point can be nested at any depth.
 func prepareMapForInsertion(insertionPoint []string, in interface{}) interface{} {
-	if len(insertionPoint) == 0 {
-		switch in := in.(type) {
-		case json.RawMessage:
-			var i interface{}
-			_ = json.Unmarshal([]byte(in), &i)
-			switch i := i.(type) {
-			case map[string]interface{}, []interface{}:
-				return i
-			case nil:
-				return nil
-			default:
-				panic("unknown type after unmarshalling")
-			}
-		default:
-			return in
-		}
+	if raw, ok := in.(json.RawMessage); ok {
+		var i interface{}
+		_ = json.Unmarshal([]byte(raw), &i)
+		in = i
 	}
 
 	switch in := in.(type) {
 	case map[string]interface{}:
-		in[insertionPoint[0]] = prepareMapForInsertion(insertionPoint[1:], in[insertionPoint[0]])
-		return in
-	case json.RawMessage:
-		var m map[string]interface{}
-		_ = json.Unmarshal([]byte(in), &m)
-		if m == nil {
-			return nil
+		if len(insertionPoint) > 0 {
+			in[insertionPoint[0]] = prepareMapForInsertion(insertionPoint[1:], in[insertionPoint[0]])
 		}
-		m[insertionPoint[0]] = prepareMapForInsertion(insertionPoint[1:], m[insertionPoint[0]])
-		return m
+		return in
 	case []interface{}:
 		for i, e := range in {
 			in[i] = prepareMapForInsertion(insertionPoint, e)
 		}
 		return in
-	case nil:
-		return nil
+	case nil, conflictingValue:
+		return in
 	default:
 		panic(fmt.Sprintf("unhandled type: %s", reflect.TypeOf(in).Name()))
 	}
 }
 
+// prepareMapForInsertion prepares the result for the insertion of a step's
+// data, decoding only the objects along the insertion point with raw JSON
+// merge
+func (e *QueryExecution) prepareMapForInsertion(insertionPoint []string, result map[string]interface{}) map[string]interface{} {
+	if e.rawJSON {
+		return prepareRawMapForInsertion(insertionPoint, result).(map[string]interface{})
+	}
+	return prepareMapForInsertion(insertionPoint, result).(map[string]interface{})
+}
+
+// stripInjectedFields removes the fields injected by the planner (see
+// QueryPlanStep.InjectedFields) from the merged result, once all the steps are
+// executed
+func stripInjectedFields(data map[string]interface{}, steps []*QueryPlanStep) {
+	for _, step := range steps {
+		if len(step.InjectedFields) > 0 {
+			base := append([]string{}, step.InsertionPoint...)
+			if step.Join != nil {
+				base = append(base, step.Join.FieldAlias)
+			}
+			for _, field := range step.InjectedFields {
+				deleteFieldAtPath(data, append(base, strings.Split(field, ".")...))
+			}
+		}
+		stripInjectedFields(data, step.Then)
+	}
+}
+
+// deleteFieldAtPath deletes the last element of the path from all the objects
+// it leads to. The raw values along the path are decoded if they contain the
+// field.
+func deleteFieldAtPath(in interface{}, path []string) {
+	switch in := in.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			delete(in, path[0])
+			return
+		}
+		if raw, ok := in[path[0]].(json.RawMessage); ok {
+			if !bytes.Contains(raw, []byte(`"`+path[len(path)-1]+`"`)) {
+				return
+			}
+			in[path[0]] = decodeRawJSONLevel(raw)
+		}
+		deleteFieldAtPath(in[path[0]], path[1:])
+	case []interface{}:
+		for _, e := range in {
+			deleteFieldAtPath(e, path)
+		}
+	}
+}
+
+// insertionTargetID returns the id of the object, decoding it if it's raw,
+// and whether it's a number. The numbers are returned as they were
+// serialized, so large Int ids don't lose precision.
+func insertionTargetID(obj map[string]interface{}) (string, bool) {
+	id, ok := obj[injectedIDAlias]
+	if !ok {
+		id = obj["id"]
+	}
+	switch id := id.(type) {
+	case string:
+		return id, false
+	case json.Number:
+		return id.String(), true
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64), true
+	case json.RawMessage:
+		var v interface{}
+		d := json.NewDecoder(bytes.NewReader(id))
+		d.UseNumber()
+		_ = d.Decode(&v)
+		switch v := v.(type) {
+		case string:
+			return v, false
+		case json.Number:
+			return v.String(), true
+		}
+	}
+	return "", false
+}
+
+// filterInsertionTargets returns the targets of the parent type. The type of
+// the targets is only known if the planner injected their __typename, when
+// the step is for a fragment on an abstract type.
+func (e *QueryExecution) filterInsertionTargets(targets []insertionTarget, parentType string) []insertionTarget {
+	var result []insertionTarget
+	for _, target := range targets {
+		typename := insertionTargetTypename(target.Target)
+		if typename == "" || typename == parentType || e.isPossibleType(parentType, typename) {
+			result = append(result, target)
+		}
+	}
+	return result
+}
+
+// isPossibleType returns whether the objects of the type can be returned for
+// the abstract type
+func (e *QueryExecution) isPossibleType(abstractType, typename string) bool {
+	if e.Schema == nil {
+		return false
+	}
+	def := e.Schema.Types[abstractType]
+	if def == nil || !def.IsAbstractType() {
+		return false
+	}
+	return ast.DefinitionList(e.Schema.GetPossibleTypes(def)).ForName(typename) != nil
+}
+
+// insertionTargetTypename returns the injected (or selected) __typename of the
+// object, decoding it if it's raw
+func insertionTargetTypename(obj map[string]interface{}) string {
+	typename, ok := obj[injectedTypenameAlias]
+	if !ok {
+		typename = obj["__typename"]
+	}
+	switch typename := typename.(type) {
+	case string:
+		return typename
+	case json.RawMessage:
+		var s string
+		_ = json.Unmarshal(typename, &s)
+		return s
+	}
+	return ""
+}
+
 // buildInsertionSlice returns the list of maps where the data should be inserted
 // It recursively traverses maps and list to find the insertion points.
 // For example, if we have "insertionPoint" [movie, compTitles] and "in"
@@ -1021,36 +2357,32 @@ func prepareMapForInsertion(insertionPoint []string, in interface{}) interface{}
 //  { id: 2 }
 // ] }
 // we want to return [{ id: 1 }, { id: 2 }]
-func buildInsertionSlice(insertionPoint []string, in interface{}) []insertionTarget {
+func buildInsertionSlice(insertionPoint []string, in interface{}, path ast.Path) []insertionTarget {
 	if len(insertionPoint) == 0 {
 		switch in := in.(type) {
 		case map[string]interface{}:
-			eid := ""
-			if id, ok := in["_id"]; ok {
-				eid = id.(string)
-			} else if id, ok := in["id"]; ok {
-				eid = id.(string)
-			}
-
+			eid, numeric := insertionTargetID(in)
 			if eid == "" {
 				return nil
 			}
 
 			return []insertionTarget{{
-				ID:     eid,
-				Target: in,
+				ID:        eid,
+				Target:    in,
+				Path:      path,
+				numericID: numeric,
 			}}
 		case []interface{}:
 			var result []insertionTarget
-			for _, e := range in {
-				result = append(result, buildInsertionSlice(insertionPoint, e)...)
+			for i, e := range in {
+				result = append(result, buildInsertionSlice(insertionPoint, e, appendPath(path, ast.PathIndex(i)))...)
 			}
 			return result
 		case json.RawMessage:
 			var m map[string]interface{}
 			_ = json.Unmarshal([]byte(in), &m)
-			return buildInsertionSlice(nil, m)
-		case nil:
+			return buildInsertionSlice(nil, m, path)
+		case nil, conflictingValue:
 			return nil
 		default:
 			panic(fmt.Sprintf("unhandled insertion point type: %q", reflect.TypeOf(in).Name()))
@@ -1059,14 +2391,14 @@ func buildInsertionSlice(insertionPoint []string, in interface{}) []insertionTar
 
 	switch in := in.(type) {
 	case map[string]interface{}:
-		return buildInsertionSlice(insertionPoint[1:], in[insertionPoint[0]])
+		return buildInsertionSlice(insertionPoint[1:], in[insertionPoint[0]], appendPath(path, ast.PathName(insertionPoint[0])))
 	case []interface{}:
 		var result []insertionTarget
-		for _, e := range in {
-			result = append(result, buildInsertionSlice(insertionPoint, e)...)
+		for i, e := range in {
+			result = append(result, buildInsertionSlice(insertionPoint, e, appendPath(path, ast.PathIndex(i)))...)
 		}
 		return result
-	case nil:
+	case nil, conflictingValue:
 		return nil
 	default:
 		panic(fmt.Sprintf("unhandled insertion point type: %s", reflect.TypeOf(in).Name()))
@@ -1152,6 +2484,64 @@ func (s *ExecutableSchema) evaluateSkipAndInclude(vars map[string]interface{}, o
 	}
 }
 
+// unavailableFieldErrors returns a validation error for each field of the
+// operation that doesn't exist in the schema anymore (e.g. because its service
+// was removed)
+func unavailableFieldErrors(schema *ast.Schema, op *ast.OperationDefinition) gqlerror.List {
+	if schema == nil {
+		return nil
+	}
+
+	var root *ast.Definition
+	switch op.Operation {
+	case ast.Query:
+		root = schema.Query
+	case ast.Mutation:
+		root = schema.Mutation
+	case ast.Subscription:
+		root = schema.Subscription
+	}
+	if root == nil {
+		err := gqlerror.ErrorPosf(op.Position, "Schema does not support operation type %q", op.Operation)
+		errcode.Set(err, errcode.ValidationFailed)
+		return gqlerror.List{err}
+	}
+
+	return unavailableFieldErrorsRec(schema, root.Name, op.SelectionSet)
+}
+
+func unavailableFieldErrorsRec(schema *ast.Schema, parentType string, selectionSet ast.SelectionSet) gqlerror.List {
+	var errs gqlerror.List
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name, "__") {
+				continue
+			}
+			var def *ast.FieldDefinition
+			if parent := schema.Types[parentType]; parent != nil {
+				def = parent.Fields.ForName(selection.Name)
+			}
+			if def == nil {
+				err := gqlerror.ErrorPosf(selection.Position, "Cannot query field %q on type %q.", selection.Name, parentType)
+				errcode.Set(err, errcode.ValidationFailed)
+				errs = append(errs, err)
+				continue
+			}
+			errs = append(errs, unavailableFieldErrorsRec(schema, def.Type.Name(), selection.SelectionSet)...)
+		case *ast.InlineFragment:
+			typeCondition := parentType
+			if selection.TypeCondition != "" {
+				typeCondition = selection.TypeCondition
+			}
+			errs = append(errs, unavailableFieldErrorsRec(schema, typeCondition, selection.SelectionSet)...)
+		case *ast.FragmentSpread:
+			errs = append(errs, unavailableFieldErrorsRec(schema, selection.Definition.TypeCondition, selection.Definition.SelectionSet)...)
+		}
+	}
+	return errs
+}
+
 func removeSkipAndInclude(directives ast.DirectiveList) ast.DirectiveList {
 	var result ast.DirectiveList
 	for _, d := range directives {
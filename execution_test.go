@@ -7,10 +7,15 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/stretchr/testify/assert"
@@ -221,6 +226,7 @@ func TestIntrospectionQuery(t *testing.T) {
 
 	es := ExecutableSchema{
 		MergedSchema: mergedSchema,
+		PublicSchema: mergedSchema,
 	}
 
 	t.Run("basic type fields", func(t *testing.T) {
@@ -708,30 +714,22 @@ func TestQueryExecutionMultipleServices(t *testing.T) {
 	f.checkSuccess(t)
 }
 
-func TestQueryExecutionNamespaceAndFragmentSpread(t *testing.T) {
+func TestQueryExecutionSharedValueType(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `
-				directive @namespace on OBJECT
-				type Foo {
-					id: ID!
-				}
-
-				type MyNamespace @namespace {
-					foo: Foo!
+				schema: `type Price {
+					amount: Float!
 				}
 
 				type Query {
-					ns: MyNamespace!
+					gizmoPrice: Price!
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
 						"data": {
-							"ns": {
-							"foo": {
-								"id": "1"
-							}
+							"gizmoPrice": {
+								"amount": 1.5
 							}
 						}
 					}
@@ -739,36 +737,18 @@ func TestQueryExecutionNamespaceAndFragmentSpread(t *testing.T) {
 				}),
 			},
 			{
-				schema: `
-				directive @namespace on OBJECT
-				interface Person { name: String! }
-
-				type Movie {
-					title: String!
-				}
-
-				type Director implements Person {
-					name: String!
-					movies: [Movie!]
-				}
-
-				type MyNamespace @namespace {
-					somePerson: Person!
+				schema: `type Price {
+					amount: Float!
 				}
 
 				type Query {
-					ns: MyNamespace!
+					gimmickPrice: Price!
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
 						"data": {
-							"ns": {
-							"somePerson": {
-								"name": "Luc Besson",
-								"movies": [
-									{"title": "The Big Blue"}
-								]
-							}
+							"gimmickPrice": {
+								"amount": 2.5
 							}
 						}
 					}
@@ -777,330 +757,382 @@ func TestQueryExecutionNamespaceAndFragmentSpread(t *testing.T) {
 			},
 		},
 		query: `{
-			ns {
-			somePerson {
-				... on Director {
-					name
-					movies {
-						title
-					}
-				}
+			gizmoPrice {
+				amount
 			}
-			foo {
-				id
+			gimmickPrice {
+				amount
 			}
-		}
 		}`,
 		expected: `{
-			"ns": {
-			"somePerson": {
-				"name": "Luc Besson",
-				"movies": [
-					{"title": "The Big Blue"}
-				]
+			"gizmoPrice": {
+				"amount": 1.5
 			},
-			"foo": {
-				"id": "1"
+			"gimmickPrice": {
+				"amount": 2.5
 			}
-		}
 		}`,
 	}
 
-	f.run(t)
+	f.checkSuccess(t)
 }
 
-func TestQueryExecutionWithTypename(t *testing.T) {
+func TestQueryExecutionTimeoutReturnsPartialResult(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `type Movie {
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
 					id: ID!
 					title: String
 				}
 
 				type Query {
 					movie(id: ID!): Movie!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "movie": { "_id": "1", "title": "Test title" } } }`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+
+				type Movie @boundary {
+					id: ID!
+					release: Int
 				}
-				`,
+
+				type Query {
+					node(id: ID!): Node!
+				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					w.Write([]byte(`{
-						"data": {
-							"movie": {
-								"id": "1",
-								"title": "Test title",
-								"__typename": "Movie"
-							}
-						}
-					}`))
+					time.Sleep(300 * time.Millisecond)
+					w.Write([]byte(`{ "data": { "_0": { "_id": "1", "release": 2007 } } }`))
 				}),
 			},
 		},
 		query: `{
 			movie(id: "1") {
-				id
 				title
-				__typename
+				release
 			}
 		}`,
+		executionTimeout: 50 * time.Millisecond,
 		expected: `{
 			"movie": {
-				"id": "1",
 				"title": "Test title",
-				"__typename": "Movie"
+				"release": null
 			}
 		}`,
+		errors: gqlerror.List{{
+			Message:   "execution timeout exceeded: the step did not complete within 50ms",
+			Path:      ast.Path{ast.PathName("movie"), ast.PathName("release")},
+			Locations: []gqlerror.Location{{Line: 4, Column: 5}},
+			Extensions: map[string]interface{}{
+				"code":         "EXECUTION_TIMEOUT",
+				"selectionSet": "{ _id: id release }",
+				"serviceName":  "",
+			},
+		}},
 	}
 
-	f.checkSuccess(t)
+	f.run(t)
+	jsonEqWithOrder(t, f.expected, string(f.resp.Data))
 }
 
-func TestQueryExecutionWithTypenameAndNamespaces(t *testing.T) {
+// disconnectingHooks cancel the context of the execution, as a client
+// disconnect does, once the service has responded
+type disconnectingHooks struct {
+	BaseExecutionHooks
+	service string
+	cancel  context.CancelFunc
+}
+
+func (h *disconnectingHooks) OnRequest(ctx context.Context, op *ast.OperationDefinition, variables map[string]interface{}) (context.Context, error) {
+	ctx, h.cancel = context.WithCancel(ctx)
+	return ctx, nil
+}
+
+func (h *disconnectingHooks) OnStepResponse(ctx context.Context, step *QueryPlanStep, response interface{}, err error) error {
+	if step.ServiceName == h.service {
+		h.cancel()
+	}
+	return err
+}
+
+func TestQueryExecutionClientDisconnectSkipsChildSteps(t *testing.T) {
+	var childRequests int64
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `
-				directive @namespace on OBJECT
-
-				type Movie {
-					id: ID!
-					title: String!
-				}
-
-				type Cinema {
+				name: "movies",
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
 					id: ID!
+					title: String
 				}
 
-				type MovieQuery @namespace {
-					movies: [Movie!]!
-				}
+				type Query {
+					movie(id: ID!): Movie!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "movie": { "_id": "1", "title": "Test title" } } }`))
+				}),
+			},
+			{
+				name: "releases",
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
 
-				type CinemaQuery @namespace {
-					cinemas: [Cinema!]!
+				type Movie @boundary {
+					id: ID!
+					release: Int
 				}
 
 				type Query {
-					movie: MovieQuery!
-					cinema: CinemaQuery!
-				}
-				`,
-				handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-					w.Write([]byte(`{
-						"data": {
-							"movie": {
-								"movies": [
-									{"__typename": "Movie", "id": "1"}
-								]
-							}
-						}
-					}`))
+					node(id: ID!): Node!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt64(&childRequests, 1)
+					w.Write([]byte(`{ "data": { "_0": { "_id": "1", "release": 2007 } } }`))
 				}),
 			},
 		},
 		query: `{
-			__typename
-			movie {
-				__typename
-				movies {
-					__typename
-					id
-				}
-			}
-			cinema {
-				__typename
+			movie(id: "1") {
+				title
+				release
 			}
 		}`,
+		hooks: []ExecutionHooks{&disconnectingHooks{service: "movies"}},
 		expected: `{
-			"__typename": "Query",
 			"movie": {
-				"__typename": "MovieQuery",
-				"movies": [
-					{"__typename": "Movie", "id": "1"}
-				]
-			},
-			"cinema": {
-				"__typename": "CinemaQuery"
+				"title": "Test title",
+				"release": null
 			}
 		}`,
 	}
 
-	f.checkSuccess(t)
+	f.run(t)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&childRequests))
 }
 
-func TestQueryExecutionWithMultipleNodeQueries(t *testing.T) {
-	schema1 := `directive @boundary on OBJECT
-				type Movie @boundary {
-					id: ID!
-					title: String
-				}
-
-				type Query {
-					movies: [Movie!]!
-				}`
-	schema2 := `directive @boundary on OBJECT
-				interface Node { id: ID! }
-
-				type Movie implements Node @boundary {
-					id: ID!
-					release: Int
-				}
-
-				type Query {
-					node(id: ID!): Node!
-	}`
-
+func TestQueryExecutionClientDisconnectCancelsPendingRequests(t *testing.T) {
+	cancelled := make(chan struct{})
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: schema1,
+				name: "movies",
+				schema: `type Query {
+					movie: String
+				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					w.Write([]byte(`{
-						"data": {
-							"movies": [
-							{ "id": "1", "title": "Test title 1" },
-							{ "id": "2", "title": "Test title 2" },
-							{ "id": "3", "title": "Test title 3" }
-							]
-						}
-					}
-					`))
+					w.Write([]byte(`{ "data": { "movie": "Test title" } }`))
 				}),
 			},
 			{
-				schema: schema2,
+				name: "reviews",
+				schema: `type Query {
+					review: String
+				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					var q map[string]string
-					json.NewDecoder(r.Body).Decode(&q)
-					assertQueriesEqual(t, schema2, `{
-						_0: node(id: "1") { ... on Movie { _id: id release } }
-						_1: node(id: "2") { ... on Movie { _id: id release } }
-						_2: node(id: "3") { ... on Movie { _id: id release } }
-					}`, q["query"])
-					w.Write([]byte(`{
-						"data": {
-							"_0": { "id": "1", "release": 2007 },
-							"_1": { "id": "2", "release": 2008 },
-							"_2": { "id": "3", "release": 2009 }
-						}
+					// the connection is watched once the body is read
+					io.Copy(ioutil.Discard, r.Body)
+					select {
+					case <-r.Context().Done():
+						close(cancelled)
+					case <-time.After(5 * time.Second):
+						w.Write([]byte(`{ "data": { "review": "Test review" } }`))
 					}
-					`))
 				}),
 			},
 		},
 		query: `{
-			movies {
-				id
-				title
-				release
-			}
+			movie
+			review
 		}`,
+		hooks:          []ExecutionHooks{&disconnectingHooks{service: "movies"}},
+		errorFormatter: RedactedErrorFormatter,
 		expected: `{
-			"movies": [
-				{
-					"id": "1",
-					"title": "Test title 1",
-					"release": 2007
-				},
-				{
-					"id": "2",
-					"title": "Test title 2",
-					"release": 2008
-				},
-				{
-					"id": "3",
-					"title": "Test title 3",
-					"release": 2009
-				}
-			]
+			"movie": "Test title",
+			"review": null
 		}`,
+		errors: gqlerror.List{{
+			Message:   "error while querying service",
+			Locations: []gqlerror.Location{{Line: 3, Column: 4}},
+			Extensions: map[string]interface{}{
+				"code":        "INTERNAL_SERVER_ERROR",
+				"serviceName": "reviews",
+			},
+		}},
 	}
 
-	f.checkSuccess(t)
+	f.run(t)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the pending request wasn't cancelled")
+	}
 }
 
-func TestQueryExecutionMultipleServicesWithArray(t *testing.T) {
-	schema1 := `directive @boundary on OBJECT
-	interface Node { id: ID! }
+func TestMutationExecutionClientDisconnectSkipsRemainingMutations(t *testing.T) {
+	var requests int64
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				name: "movies",
+				schema: `type Query {
+					movie: String
+				}
 
-	type Movie implements Node @boundary {
+				type Mutation {
+					addMovie: String
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "addMovie": "1" } }`))
+				}),
+			},
+			{
+				name: "reviews",
+				schema: `type Query {
+					review: String
+				}
+
+				type Mutation {
+					addReview: String
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt64(&requests, 1)
+					w.Write([]byte(`{ "data": { "addReview": "2" } }`))
+				}),
+			},
+		},
+		query: `mutation {
+			addMovie
+			addReview
+		}`,
+		hooks: []ExecutionHooks{&disconnectingHooks{service: "movies"}},
+		expected: `{
+			"addMovie": "1",
+			"addReview": null
+		}`,
+	}
+
+	f.run(t)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&requests))
+}
+
+func TestQueryExecutionBoundaryQueryWithKeyArgument(t *testing.T) {
+	ownersSchema := `directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+	type Owner @boundary {
 		id: ID!
-		title: String
+		name: String
 	}
 
 	type Query {
-		node(id: ID!): Node
-		movie(id: ID!): Movie!
+		getOwner(ownerId: Int!, locale: String): Owner @boundary(key: "ownerId")
 	}`
+	require.NoError(t, validateBoundaryObjects(gqlparser.MustLoadSchema(&ast.Source{Input: ownersSchema})))
+	require.NoError(t, validateSchemaValidAfterMerge(gqlparser.MustLoadSchema(&ast.Source{Input: ownersSchema})))
 
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: schema1,
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+				type Owner @boundary {
+					id: ID!
+				}
+
+				type Pet {
+					name: String!
+					owner: Owner
+				}
+
+				type Query {
+					pet: Pet!
+				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					var req map[string]string
-					json.NewDecoder(r.Body).Decode(&req)
-					query := gqlparser.MustLoadQuery(gqlparser.MustLoadSchema(&ast.Source{Input: schema1}), req["query"])
-					var ids []string
-					for _, s := range query.Operations[0].SelectionSet {
-						ids = append(ids, s.(*ast.Field).Arguments[0].Value.Raw)
+					w.Write([]byte(`{ "data": { "pet": { "name": "Rex", "owner": { "_id": "7" } } } }`))
+				}),
+			},
+			{
+				schema: ownersSchema,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					body, _ := ioutil.ReadAll(r.Body)
+					if !strings.Contains(string(body), "_0: getOwner(ownerId: 7)") {
+						w.Write([]byte(`{ "errors": [{ "message": "unexpected query" }] }`))
+						return
 					}
-					if query.Operations[0].SelectionSet[0].(*ast.Field).Name == "node" {
-						var res string
-						for i, id := range ids {
-							if i != 0 {
-								res += ","
+					w.Write([]byte(`{ "data": { "_0": { "_id": "7", "name": "Alice" } } }`))
+				}),
+			},
+		},
+		query: `{
+			pet {
+				name
+				owner { name }
+			}
+		}`,
+		expected: `{
+			"pet": {
+				"name": "Rex",
+				"owner": { "name": "Alice" }
+			}
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionAliasedBoundaryID(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+
+				type Query {
+					movie(id: ID!): Movie!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := io.ReadAll(r.Body)
+					assert.Contains(t, string(b), "_id: id")
+					w.Write([]byte(`{
+						"data": {
+							"movie": {
+								"_id": "1",
+								"movieId": "1",
+								"title": "Test title"
 							}
-							res += fmt.Sprintf(`
-								"_%d": {
-									"id": "%s",
-									"title": "title %s"
-								}`, i, id, id)
 						}
-						w.Write([]byte(fmt.Sprintf(`{ "data": { %s } }`, res)))
-					} else {
-						w.Write([]byte(fmt.Sprintf(`{
-							"data": {
-								"movie": {
-									"id": "%s",
-									"title": "title %s"
-								}
-							}
-						}`, ids[0], ids[0])))
 					}
+					`))
 				}),
 			},
 			{
 				schema: `directive @boundary on OBJECT
 				interface Node { id: ID! }
 
-				type Movie implements Node @boundary {
+				type Movie @boundary {
 					id: ID!
-					compTitles: [Movie]
+					release: Int
 				}
 
 				type Query {
-					node(id: ID!): Node
+					node(id: ID!): Node!
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := io.ReadAll(r.Body)
+					assert.Contains(t, string(b), `node(id: \"1\")`)
 					w.Write([]byte(`{
 						"data": {
 							"_0": {
-								"id": "1",
-								"compTitles": [
-									{
-										"id": "2",
-										"compTitles": [
-											{ "id": "3" },
-											{ "id": "4" }
-										]
-									},
-									{
-										"id": "3",
-										"compTitles": [
-											{ "id": "4" },
-											{ "id": "5" }
-										]
-									}
-								]
+								"_id": "1",
+								"release": 2007
 							}
 						}
 					}
@@ -1110,52 +1142,16 @@ func TestQueryExecutionMultipleServicesWithArray(t *testing.T) {
 		},
 		query: `{
 			movie(id: "1") {
-				id
+				movieId: id
 				title
-				compTitles {
-					id
-					title
-					compTitles {
-						id
-						title
-					}
-				}
+				release
 			}
 		}`,
 		expected: `{
 			"movie": {
-				"id": "1",
-				"title": "title 1",
-				"compTitles": [
-					{
-						"id": "2",
-						"title": "title 2",
-						"compTitles": [
-							{
-								"id": "3",
-								"title": "title 3"
-							},
-							{
-								"id": "4",
-								"title": "title 4"
-							}
-						]
-					},
-					{
-						"id": "3",
-						"title": "title 3",
-						"compTitles": [
-							{
-								"id": "4",
-								"title": "title 4"
-							},
-							{
-								"id": "5",
-								"title": "title 5"
-							}
-						]
-					}
-				]
+				"movieId": "1",
+				"title": "Test title",
+				"release": 2007
 			}
 		}`,
 	}
@@ -1163,174 +1159,212 @@ func TestQueryExecutionMultipleServicesWithArray(t *testing.T) {
 	f.checkSuccess(t)
 }
 
-func TestQueryExecutionMultipleServicesWithEmptyArray(t *testing.T) {
+func TestInsertionTargetID(t *testing.T) {
+	for _, tt := range []struct {
+		obj     map[string]interface{}
+		id      string
+		numeric bool
+	}{
+		{map[string]interface{}{"_id": "a"}, "a", false},
+		{map[string]interface{}{"id": 7.0}, "7", true},
+		{map[string]interface{}{"_id": json.RawMessage(`"a"`)}, "a", false},
+		{map[string]interface{}{"_id": json.RawMessage(`9007199254740993`)}, "9007199254740993", true},
+		{map[string]interface{}{"_id": json.RawMessage(`null`)}, "", false},
+	} {
+		id, numeric := insertionTargetID(tt.obj)
+		assert.Equal(t, tt.id, id)
+		assert.Equal(t, tt.numeric, numeric)
+	}
+}
+
+func TestQueryExecutionIntBoundaryID(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `directive @boundary on OBJECT
-				interface Node { id: ID! }
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+				type Owner @boundary {
+					id: Int!
+				}
 
-				type Movie implements Node @boundary {
-					id: ID!
+				type Pet {
+					name: String!
+					owner: Owner
 				}
 
 				type Query {
-					movies: [Movie!]!
+					pets: [Pet!]!
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					w.Write([]byte(`{
-							"data": {
-								"movies": []
-							}
-						}`))
+					w.Write([]byte(`{ "data": { "pets": [
+						{ "name": "Rex", "owner": { "id": 7 } },
+						{ "name": "Tom", "owner": { "id": 12 } }
+					] } }`))
 				}),
 			},
 			{
-				schema: `directive @boundary on OBJECT
-				interface Node { id: ID! }
-
-				type Movie implements Node @boundary {
-					id: ID!
-					title: String
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+				type Owner @boundary {
+					id: Int!
+					name: String
 				}
 
 				type Query {
-					node(id: ID!): Node
+					owner(id: Int!): Owner @boundary
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					t.Fatal("service should not be called on empty array")
+					body, _ := ioutil.ReadAll(r.Body)
+					if !strings.Contains(string(body), "_0: owner(id: 7)") || !strings.Contains(string(body), "_1: owner(id: 12)") {
+						w.Write([]byte(`{ "errors": [{ "message": "unexpected query" }] }`))
+						return
+					}
+					w.Write([]byte(`{ "data": { "_0": { "name": "Alice" }, "_1": { "name": "Bob" } } }`))
 				}),
 			},
 		},
 		query: `{
-			movies {
-				id
-				title
+			pets {
+				name
+				owner { id name }
 			}
 		}`,
 		expected: `{
-			"movies": []
+			"pets": [
+				{ "name": "Rex", "owner": { "id": 7, "name": "Alice" } },
+				{ "name": "Tom", "owner": { "id": 12, "name": "Bob" } }
+			]
 		}`,
 	}
 
 	f.checkSuccess(t)
 }
 
-func TestQueryExecutionMultipleServicesWithNestedArrays(t *testing.T) {
-	schema1 := `directive @boundary on OBJECT
-				interface Node { id: ID! }
+func TestQueryExecutionCustomScalarBoundaryID(t *testing.T) {
+	t.Run("string serialized ids are quoted", func(t *testing.T) {
+		f := &queryExecutionFixture{
+			services: []testService{
+				{
+					schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+					scalar UUID
 
-				type Movie implements Node @boundary {
-					id: ID!
-					title: String
-				}
+					type Owner @boundary {
+						id: UUID!
+					}
 
-				type Query {
-					node(id: ID!): Node
-					movie(id: ID!): Movie!
-			}`
-	services := []testService{
-		{
-			schema: schema1,
-			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				var req map[string]string
-				json.NewDecoder(r.Body).Decode(&req)
-				query := gqlparser.MustLoadQuery(gqlparser.MustLoadSchema(&ast.Source{Input: schema1}), req["query"])
-				var ids []string
-				for _, s := range query.Operations[0].SelectionSet {
-					ids = append(ids, s.(*ast.Field).Arguments[0].Value.Raw)
-				}
-				if query.Operations[0].SelectionSet[0].(*ast.Field).Name == "node" {
-					var res string
-					for i, id := range ids {
-						if i != 0 {
-							res += ","
-						}
-						res += fmt.Sprintf(`
-								"_%d": {
-									"id": "%s",
-									"title": "title %s"
-								}`, i, id, id)
+					type Pet {
+						name: String!
+						owner: Owner
 					}
-					w.Write([]byte(fmt.Sprintf(`{ "data": { %s } }`, res)))
-				} else {
-					w.Write([]byte(fmt.Sprintf(`{
-							"data": {
-								"movie": {
-									"id": "%s",
-									"title": "title %s"
-								}
-							}
-						}`, ids[0], ids[0])))
-				}
-			}),
-		},
-		{
-			schema: `directive @boundary on OBJECT
-			interface Node { id: ID! }
 
-			type Movie implements Node @boundary {
-				id: ID!
-				compTitles: [[Movie]]
-			}
+					type Query {
+						pet: Pet!
+					}`,
+					handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						w.Write([]byte(`{ "data": { "pet": { "name": "Rex", "owner": { "_id": "5e1f4c1e-7d0b-4d6e-9a7c-1f2b3c4d5e6f" } } } }`))
+					}),
+				},
+				{
+					schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+					scalar UUID
 
-			type Query {
-				node(id: ID!): Node
-			}`,
-			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				w.Write([]byte(`{
-					"data": {
-						"_0": {
-							"id": "1",
-							"compTitles": [[
-								{
-									"id": "2"
-								},
-								{
-									"id": "3"
-								}
-							]]
-						}
+					type Owner @boundary {
+						id: UUID!
+						name: String
 					}
-				}`))
-			}),
-		},
-	}
 
-	f := &queryExecutionFixture{
-		services: services,
-		query: `{
-		movie(id: "1") {
-			id
-			title
-			compTitles {
-				id
-				title
-			}
+					type Query {
+						owners(ids: [UUID!]): [Owner]! @boundary
+					}`,
+					handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						body, _ := ioutil.ReadAll(r.Body)
+						if !strings.Contains(string(body), `owners(ids: [\"5e1f4c1e-7d0b-4d6e-9a7c-1f2b3c4d5e6f\" ])`) {
+							w.Write([]byte(`{ "errors": [{ "message": "unexpected query" }] }`))
+							return
+						}
+						w.Write([]byte(`{ "data": { "_result": [{ "_id": "5e1f4c1e-7d0b-4d6e-9a7c-1f2b3c4d5e6f", "name": "Alice" }] } }`))
+					}),
+				},
+			},
+			query: `{
+				pet {
+					name
+					owner { name }
+				}
+			}`,
+			expected: `{
+				"pet": {
+					"name": "Rex",
+					"owner": { "name": "Alice" }
+				}
+			}`,
 		}
-	}`,
-		expected: `{
-		"movie": {
-			"id": "1",
-			"title": "title 1",
-			"compTitles": [[
+
+		f.checkSuccess(t)
+	})
+
+	t.Run("number serialized ids aren't quoted", func(t *testing.T) {
+		f := &queryExecutionFixture{
+			services: []testService{
 				{
-					"id": "2",
-					"title": "title 2"
+					schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+					scalar Long
+
+					type Owner @boundary {
+						id: Long!
+					}
+
+					type Pet {
+						name: String!
+						owner: Owner
+					}
+
+					type Query {
+						pet: Pet!
+					}`,
+					handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						w.Write([]byte(`{ "data": { "pet": { "name": "Rex", "owner": { "_id": 4294967296 } } } }`))
+					}),
 				},
 				{
-					"id": "3",
-					"title": "title 3"
+					schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+					scalar Long
+
+					type Owner @boundary {
+						id: Long!
+						name: String
+					}
+
+					type Query {
+						owner(id: Long!): Owner @boundary
+					}`,
+					handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						body, _ := ioutil.ReadAll(r.Body)
+						if !strings.Contains(string(body), "_0: owner(id: 4294967296)") {
+							w.Write([]byte(`{ "errors": [{ "message": "unexpected query" }] }`))
+							return
+						}
+						w.Write([]byte(`{ "data": { "_0": { "_id": 4294967296, "name": "Alice" } } }`))
+					}),
+				},
+			},
+			query: `{
+				pet {
+					name
+					owner { name }
 				}
-			]]
+			}`,
+			expected: `{
+				"pet": {
+					"name": "Rex",
+					"owner": { "name": "Alice" }
+				}
+			}`,
 		}
-		}`,
-	}
 
-	f.checkSuccess(t)
+		f.checkSuccess(t)
+	})
 }
 
-func TestQueryExecutionEmptyNodeResponse(t *testing.T) {
+func TestQueryExecutionClientAliasesCollidingWithInjectedAliases(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
@@ -1344,11 +1378,13 @@ func TestQueryExecutionEmptyNodeResponse(t *testing.T) {
 					movie(id: ID!): Movie!
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := io.ReadAll(r.Body)
+					assert.Contains(t, string(b), "_id_: title")
 					w.Write([]byte(`{
 						"data": {
-							"movie": {
-								"id": "1",
-								"title": "Test title"
+							"_0_": {
+								"_id": "1",
+								"_id_": "Test title"
 							}
 						}
 					}
@@ -1370,7 +1406,10 @@ func TestQueryExecutionEmptyNodeResponse(t *testing.T) {
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
 						"data": {
-							"_0": null
+							"_0": {
+								"_id": "1",
+								"_0_": 2007
+							}
 						}
 					}
 					`))
@@ -1378,17 +1417,15 @@ func TestQueryExecutionEmptyNodeResponse(t *testing.T) {
 			},
 		},
 		query: `{
-			movie(id: "1") {
-				id
-				title
-				release
+			_0: movie(id: "1") {
+				_id: title
+				_0: release
 			}
 		}`,
 		expected: `{
-			"movie": {
-				"id": "1",
-				"title": "Test title",
-				"release": null
+			"_0": {
+				"_id": "Test title",
+				"_0": 2007
 			}
 		}`,
 	}
@@ -1396,203 +1433,217 @@ func TestQueryExecutionEmptyNodeResponse(t *testing.T) {
 	f.checkSuccess(t)
 }
 
-func TestQueryExecutionWithNullResponse(t *testing.T) {
+func TestQueryExecutionNamespaceAndFragmentSpread(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `directive @boundary on OBJECT
-				type Movie @boundary {
+				schema: `
+				directive @namespace on OBJECT
+				type Foo {
 					id: ID!
 				}
 
+				type MyNamespace @namespace {
+					foo: Foo!
+				}
+
 				type Query {
-					movies: [Movie!]
+					ns: MyNamespace!
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
 						"data": {
-							"movies": null
+							"ns": {
+							"foo": {
+								"id": "1"
+							}
+							}
 						}
 					}
 					`))
 				}),
 			},
 			{
-				schema: `directive @boundary on OBJECT
-				interface Node { id: ID! }
+				schema: `
+				directive @namespace on OBJECT
+				interface Person { name: String! }
 
-				type Movie @boundary {
-					id: ID!
-					title: String
+				type Movie {
+					title: String!
+				}
+
+				type Director implements Person {
+					name: String!
+					movies: [Movie!]
+				}
+
+				type MyNamespace @namespace {
+					somePerson: Person!
 				}
 
 				type Query {
-					node(id: ID!): Node!
+					ns: MyNamespace!
 				}`,
-				handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
-					assert.Fail(t, "handler should not be called")
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"ns": {
+							"somePerson": {
+								"name": "Luc Besson",
+								"movies": [
+									{"title": "The Big Blue"}
+								]
+							}
+							}
+						}
+					}
+					`))
 				}),
 			},
 		},
 		query: `{
-			movies {
+			ns {
+			somePerson {
+				... on Director {
+					name
+					movies {
+						title
+					}
+				}
+			}
+			foo {
 				id
-				title
 			}
+		}
 		}`,
 		expected: `{
-			"movies": null
+			"ns": {
+			"somePerson": {
+				"name": "Luc Besson",
+				"movies": [
+					{"title": "The Big Blue"}
+				]
+			},
+			"foo": {
+				"id": "1"
+			}
+		}
 		}`,
 	}
 
-	f.checkSuccess(t)
+	f.run(t)
 }
 
-func TestQueryExecutionWithNullResponseAndSubBoundaryType(t *testing.T) {
+func TestQueryExecutionWithTypename(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `directive @boundary on OBJECT
-				type Movie @boundary {
+				schema: `type Movie {
 					id: ID!
-					compTitles: [Movie!]
+					title: String
 				}
 
 				type Query {
-					movies: [Movie!]
-				}`,
+					movie(id: ID!): Movie!
+				}
+				`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
 						"data": {
-							"movies": null
+							"movie": {
+								"id": "1",
+								"title": "Test title",
+								"__typename": "Movie"
+							}
 						}
-					}
-					`))
-				}),
-			},
-			{
-				schema: `directive @boundary on OBJECT
-				interface Node { id: ID! }
-
-				type Movie @boundary {
-					id: ID!
-					title: String
-				}
-
-				type Query {
-					node(id: ID!): Node!
-				}`,
-				handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
-					assert.Fail(t, "handler should not be called")
+					}`))
 				}),
 			},
 		},
 		query: `{
-			movies {
+			movie(id: "1") {
 				id
 				title
-				compTitles {
-					title
-				}
+				__typename
 			}
 		}`,
 		expected: `{
-			"movies": null
+			"movie": {
+				"id": "1",
+				"title": "Test title",
+				"__typename": "Movie"
+			}
 		}`,
 	}
 
 	f.checkSuccess(t)
 }
 
-func TestQueryExecutionWithInputObject(t *testing.T) {
-	schema1 := `directive @boundary on OBJECT
-		type Movie @boundary {
-			id: ID!
-			title: String
-			otherMovie(arg: MovieInput): Movie
-		}
-
-		input MovieInput {
-			id: ID!
-			title: String
-		}
-
-		type Query {
-			movie(in: MovieInput): Movie!
-	}`
+func TestQueryExecutionWithTypenameAndNamespaces(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: schema1,
-				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					var q map[string]string
-					json.NewDecoder(r.Body).Decode(&q)
-					assertQueriesEqual(t, schema1, `{
-						movie(in: {id: "1", title: "title"}) {
-							id
-							title
-							otherMovie(arg: {id: "2", title: "another title"}) {
-								title
-							}
-						}
-					}`, q["query"])
-					w.Write([]byte(`{
-						"data": {
-							"movie": {
-								"id": "1",
-								"title": "Test title",
-								"otherMovie": {
-									"title": "another title"
-								}
-							}
-						}
-					}
-					`))
-				}),
-			},
-			{
-				schema: `directive @boundary on OBJECT
-				interface Node { id: ID! }
+				schema: `
+				directive @namespace on OBJECT
 
-				type Movie @boundary {
+				type Movie {
 					id: ID!
-					release: Int
+					title: String!
+				}
+
+				type Cinema {
+					id: ID!
+				}
+
+				type MovieQuery @namespace {
+					movies: [Movie!]!
+				}
+
+				type CinemaQuery @namespace {
+					cinemas: [Cinema!]!
 				}
 
 				type Query {
-					node(id: ID!): Node!
-				}`,
-				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					movie: MovieQuery!
+					cinema: CinemaQuery!
+				}
+				`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 					w.Write([]byte(`{
 						"data": {
-							"_0": {
-								"id": "1",
-								"release": 2007
+							"movie": {
+								"movies": [
+									{"__typename": "Movie", "id": "1"}
+								]
 							}
 						}
-					}
-					`))
+					}`))
 				}),
 			},
 		},
 		query: `{
-			movie(in: {id: "1", title: "title"}) {
-				id
-				title
-				release
-				otherMovie(arg: {id: "2", title: "another title"}) {
-					title
+			__typename
+			movie {
+				__typename
+				movies {
+					__typename
+					id
 				}
 			}
+			cinema {
+				__typename
+			}
 		}`,
 		expected: `{
+			"__typename": "Query",
 			"movie": {
-				"id": "1",
-				"title": "Test title",
-				"release": 2007,
-				"otherMovie": {
-					"title": "another title"
-				}
+				"__typename": "MovieQuery",
+				"movies": [
+					{"__typename": "Movie", "id": "1"}
+				]
+			},
+			"cinema": {
+				"__typename": "CinemaQuery"
 			}
 		}`,
 	}
@@ -1600,91 +1651,90 @@ func TestQueryExecutionWithInputObject(t *testing.T) {
 	f.checkSuccess(t)
 }
 
-func TestQueryExecutionMultipleObjects(t *testing.T) {
-	f := &queryExecutionFixture{
-		services: []testService{
-			{
-				schema: `directive @boundary on OBJECT
+func TestQueryExecutionWithMultipleNodeQueries(t *testing.T) {
+	schema1 := `directive @boundary on OBJECT
 				type Movie @boundary {
 					id: ID!
 					title: String
 				}
 
 				type Query {
-					movie(id: ID!): Movie!
-				}`,
-				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					w.Write([]byte(`{
-						"data": {
-							"movie": {
-								"id": "1",
-								"title": "Test title"
-							}
-						}
-					}
-					`))
-				}),
-			},
-			{
-				schema: `directive @boundary on OBJECT
+					movies: [Movie!]!
+				}`
+	schema2 := `directive @boundary on OBJECT
 				interface Node { id: ID! }
 
-				type Movie @boundary {
+				type Movie implements Node @boundary {
 					id: ID!
 					release: Int
 				}
 
 				type Query {
 					node(id: ID!): Node!
-					movies: [Movie!]
-				}`,
+	}`
+
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: schema1,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					body, _ := ioutil.ReadAll(r.Body)
-					if strings.Contains(string(body), "movies") {
-						w.Write([]byte(`{
-							"data": {
-								"movies": [
-									{ "id": "1", "release": 2007 },
-									{ "id": "2", "release": 2018 }
-								]
-							}
+					w.Write([]byte(`{
+						"data": {
+							"movies": [
+							{ "id": "1", "title": "Test title 1" },
+							{ "id": "2", "title": "Test title 2" },
+							{ "id": "3", "title": "Test title 3" }
+							]
 						}
-						`))
-					} else {
-						w.Write([]byte(`{
-							"data": {
-								"_0": {
-									"id": "1",
-									"release": 2007
-								}
-							}
+					}
+					`))
+				}),
+			},
+			{
+				schema: schema2,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var q map[string]string
+					json.NewDecoder(r.Body).Decode(&q)
+					assertQueriesEqual(t, schema2, `{
+						_0: node(id: "1") { ... on Movie { _id: id release } }
+						_1: node(id: "2") { ... on Movie { _id: id release } }
+						_2: node(id: "3") { ... on Movie { _id: id release } }
+					}`, q["query"])
+					w.Write([]byte(`{
+						"data": {
+							"_0": { "id": "1", "release": 2007 },
+							"_1": { "id": "2", "release": 2008 },
+							"_2": { "id": "3", "release": 2009 }
 						}
-						`))
 					}
+					`))
 				}),
 			},
 		},
 		query: `{
-			movie(id: "1") {
-				id
-				title
-				release
-			}
-
 			movies {
 				id
+				title
 				release
 			}
 		}`,
 		expected: `{
-			"movie": {
-				"id": "1",
-				"title": "Test title",
-				"release": 2007
-			},
 			"movies": [
-				{"id": "1", "release": 2007},
-				{"id": "2", "release": 2018}
+				{
+					"id": "1",
+					"title": "Test title 1",
+					"release": 2007
+				},
+				{
+					"id": "2",
+					"title": "Test title 2",
+					"release": 2008
+				},
+				{
+					"id": "3",
+					"title": "Test title 3",
+					"release": 2009
+				}
 			]
 		}`,
 	}
@@ -1692,238 +1742,2370 @@ func TestQueryExecutionMultipleObjects(t *testing.T) {
 	f.checkSuccess(t)
 }
 
-func TestQueryExecutionMultipleServicesWithSkipTrueDirectives(t *testing.T) {
+func TestQueryExecutionMultipleServicesWithArray(t *testing.T) {
+	schema1 := `directive @boundary on OBJECT
+	interface Node { id: ID! }
+
+	type Movie implements Node @boundary {
+		id: ID!
+		title: String
+	}
+
+	type Query {
+		node(id: ID!): Node
+		movie(id: ID!): Movie!
+	}`
+
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `directive @boundary on OBJECT
-				type Movie @boundary {
-					id: ID!
-					title: String
-				}
-				type Query {
-					movie(id: ID!): Movie!
-				}`,
+				schema: schema1,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					w.Write([]byte(`{
-						"data": {
-							"movie": {
-								"id": "1"
+					var req map[string]string
+					json.NewDecoder(r.Body).Decode(&req)
+					query := gqlparser.MustLoadQuery(gqlparser.MustLoadSchema(&ast.Source{Input: schema1}), req["query"])
+					var ids []string
+					for _, s := range query.Operations[0].SelectionSet {
+						ids = append(ids, s.(*ast.Field).Arguments[0].Value.Raw)
+					}
+					if query.Operations[0].SelectionSet[0].(*ast.Field).Name == "node" {
+						var res string
+						for i, id := range ids {
+							if i != 0 {
+								res += ","
+							}
+							res += fmt.Sprintf(`
+								"_%d": {
+									"id": "%s",
+									"title": "title %s"
+								}`, i, id, id)
+						}
+						w.Write([]byte(fmt.Sprintf(`{ "data": { %s } }`, res)))
+					} else {
+						w.Write([]byte(fmt.Sprintf(`{
+							"data": {
+								"movie": {
+									"id": "%s",
+									"title": "title %s"
+								}
+							}
+						}`, ids[0], ids[0])))
+					}
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+
+				type Movie implements Node @boundary {
+					id: ID!
+					compTitles: [Movie]
+				}
+
+				type Query {
+					node(id: ID!): Node
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"_0": {
+								"id": "1",
+								"compTitles": [
+									{
+										"id": "2",
+										"compTitles": [
+											{ "id": "3" },
+											{ "id": "4" }
+										]
+									},
+									{
+										"id": "3",
+										"compTitles": [
+											{ "id": "4" },
+											{ "id": "5" }
+										]
+									}
+								]
 							}
 						}
 					}
 					`))
 				}),
 			},
+		},
+		query: `{
+			movie(id: "1") {
+				id
+				title
+				compTitles {
+					id
+					title
+					compTitles {
+						id
+						title
+					}
+				}
+			}
+		}`,
+		expected: `{
+			"movie": {
+				"id": "1",
+				"title": "title 1",
+				"compTitles": [
+					{
+						"id": "2",
+						"title": "title 2",
+						"compTitles": [
+							{
+								"id": "3",
+								"title": "title 3"
+							},
+							{
+								"id": "4",
+								"title": "title 4"
+							}
+						]
+					},
+					{
+						"id": "3",
+						"title": "title 3",
+						"compTitles": [
+							{
+								"id": "4",
+								"title": "title 4"
+							},
+							{
+								"id": "5",
+								"title": "title 5"
+							}
+						]
+					}
+				]
+			}
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionMultipleServicesWithEmptyArray(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
 			{
 				schema: `directive @boundary on OBJECT
 				interface Node { id: ID! }
-				type Gizmo {
-					foo: String!
-					bar: String!
+
+				type Movie implements Node @boundary {
+					id: ID!
 				}
-				type Movie @boundary {
+
+				type Query {
+					movies: [Movie!]!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+							"data": {
+								"movies": []
+							}
+						}`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+
+				type Movie implements Node @boundary {
 					id: ID!
-					gizmo: Gizmo
+					title: String
 				}
+
 				type Query {
-					node(id: ID!): Node!
+					node(id: ID!): Node
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					panic("should not be called")
+					t.Fatal("service should not be called on empty array")
 				}),
 			},
 		},
-		query: `query q($skipTitle: Boolean!, $skipGizmo: Boolean!) {
-			movie(id: "1") {
-				id
-				title @skip(if: $skipTitle)
-				gizmo @skip(if: $skipGizmo) {
-					foo
-					bar
-				}
-			}
-		}`,
-		variables: map[string]interface{}{
-			"skipTitle": true,
-			"skipGizmo": true,
+		query: `{
+			movies {
+				id
+				title
+			}
+		}`,
+		expected: `{
+			"movies": []
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionMultipleServicesWithNestedArrays(t *testing.T) {
+	schema1 := `directive @boundary on OBJECT
+				interface Node { id: ID! }
+
+				type Movie implements Node @boundary {
+					id: ID!
+					title: String
+				}
+
+				type Query {
+					node(id: ID!): Node
+					movie(id: ID!): Movie!
+			}`
+	services := []testService{
+		{
+			schema: schema1,
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req map[string]string
+				json.NewDecoder(r.Body).Decode(&req)
+				query := gqlparser.MustLoadQuery(gqlparser.MustLoadSchema(&ast.Source{Input: schema1}), req["query"])
+				var ids []string
+				for _, s := range query.Operations[0].SelectionSet {
+					ids = append(ids, s.(*ast.Field).Arguments[0].Value.Raw)
+				}
+				if query.Operations[0].SelectionSet[0].(*ast.Field).Name == "node" {
+					var res string
+					for i, id := range ids {
+						if i != 0 {
+							res += ","
+						}
+						res += fmt.Sprintf(`
+								"_%d": {
+									"id": "%s",
+									"title": "title %s"
+								}`, i, id, id)
+					}
+					w.Write([]byte(fmt.Sprintf(`{ "data": { %s } }`, res)))
+				} else {
+					w.Write([]byte(fmt.Sprintf(`{
+							"data": {
+								"movie": {
+									"id": "%s",
+									"title": "title %s"
+								}
+							}
+						}`, ids[0], ids[0])))
+				}
+			}),
+		},
+		{
+			schema: `directive @boundary on OBJECT
+			interface Node { id: ID! }
+
+			type Movie implements Node @boundary {
+				id: ID!
+				compTitles: [[Movie]]
+			}
+
+			type Query {
+				node(id: ID!): Node
+			}`,
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{
+					"data": {
+						"_0": {
+							"id": "1",
+							"compTitles": [[
+								{
+									"id": "2"
+								},
+								{
+									"id": "3"
+								}
+							]]
+						}
+					}
+				}`))
+			}),
+		},
+	}
+
+	f := &queryExecutionFixture{
+		services: services,
+		query: `{
+		movie(id: "1") {
+			id
+			title
+			compTitles {
+				id
+				title
+			}
+		}
+	}`,
+		expected: `{
+		"movie": {
+			"id": "1",
+			"title": "title 1",
+			"compTitles": [[
+				{
+					"id": "2",
+					"title": "title 2"
+				},
+				{
+					"id": "3",
+					"title": "title 3"
+				}
+			]]
+		}
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionEmptyNodeResponse(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+
+				type Query {
+					movie(id: ID!): Movie!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"movie": {
+								"id": "1",
+								"title": "Test title"
+							}
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+
+				type Movie @boundary {
+					id: ID!
+					release: Int
+				}
+
+				type Query {
+					node(id: ID!): Node!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"_0": null
+						}
+					}
+					`))
+				}),
+			},
+		},
+		query: `{
+			movie(id: "1") {
+				id
+				title
+				release
+			}
+		}`,
+		expected: `{
+			"movie": {
+				"id": "1",
+				"title": "Test title",
+				"release": null
+			}
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionWithNullResponse(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+				}
+
+				type Query {
+					movies: [Movie!]
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"movies": null
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+
+				type Query {
+					node(id: ID!): Node!
+				}`,
+				handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+					assert.Fail(t, "handler should not be called")
+				}),
+			},
+		},
+		query: `{
+			movies {
+				id
+				title
+			}
+		}`,
+		expected: `{
+			"movies": null
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionWithNullResponseAndSubBoundaryType(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					compTitles: [Movie!]
+				}
+
+				type Query {
+					movies: [Movie!]
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"movies": null
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+
+				type Query {
+					node(id: ID!): Node!
+				}`,
+				handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+					assert.Fail(t, "handler should not be called")
+				}),
+			},
+		},
+		query: `{
+			movies {
+				id
+				title
+				compTitles {
+					title
+				}
+			}
+		}`,
+		expected: `{
+			"movies": null
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionWithInputObject(t *testing.T) {
+	schema1 := `directive @boundary on OBJECT
+		type Movie @boundary {
+			id: ID!
+			title: String
+			otherMovie(arg: MovieInput): Movie
+		}
+
+		input MovieInput {
+			id: ID!
+			title: String
+		}
+
+		type Query {
+			movie(in: MovieInput): Movie!
+	}`
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: schema1,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var q map[string]string
+					json.NewDecoder(r.Body).Decode(&q)
+					assertQueriesEqual(t, schema1, `{
+						movie(in: {id: "1", title: "title"}) {
+							id
+							title
+							otherMovie(arg: {id: "2", title: "another title"}) {
+								title
+							}
+						}
+					}`, q["query"])
+					w.Write([]byte(`{
+						"data": {
+							"movie": {
+								"id": "1",
+								"title": "Test title",
+								"otherMovie": {
+									"title": "another title"
+								}
+							}
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+
+				type Movie @boundary {
+					id: ID!
+					release: Int
+				}
+
+				type Query {
+					node(id: ID!): Node!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"_0": {
+								"id": "1",
+								"release": 2007
+							}
+						}
+					}
+					`))
+				}),
+			},
+		},
+		query: `{
+			movie(in: {id: "1", title: "title"}) {
+				id
+				title
+				release
+				otherMovie(arg: {id: "2", title: "another title"}) {
+					title
+				}
+			}
+		}`,
+		expected: `{
+			"movie": {
+				"id": "1",
+				"title": "Test title",
+				"release": 2007,
+				"otherMovie": {
+					"title": "another title"
+				}
+			}
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionMultipleObjects(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+
+				type Query {
+					movie(id: ID!): Movie!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"movie": {
+								"id": "1",
+								"title": "Test title"
+							}
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+
+				type Movie @boundary {
+					id: ID!
+					release: Int
+				}
+
+				type Query {
+					node(id: ID!): Node!
+					movies: [Movie!]
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					body, _ := ioutil.ReadAll(r.Body)
+					if strings.Contains(string(body), "movies") {
+						w.Write([]byte(`{
+							"data": {
+								"movies": [
+									{ "id": "1", "release": 2007 },
+									{ "id": "2", "release": 2018 }
+								]
+							}
+						}
+						`))
+					} else {
+						w.Write([]byte(`{
+							"data": {
+								"_0": {
+									"id": "1",
+									"release": 2007
+								}
+							}
+						}
+						`))
+					}
+				}),
+			},
+		},
+		query: `{
+			movie(id: "1") {
+				id
+				title
+				release
+			}
+
+			movies {
+				id
+				release
+			}
+		}`,
+		expected: `{
+			"movie": {
+				"id": "1",
+				"title": "Test title",
+				"release": 2007
+			},
+			"movies": [
+				{"id": "1", "release": 2007},
+				{"id": "2", "release": 2018}
+			]
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionMultipleServicesWithSkipTrueDirectives(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+				type Query {
+					movie(id: ID!): Movie!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"movie": {
+								"id": "1"
+							}
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+				type Gizmo {
+					foo: String!
+					bar: String!
+				}
+				type Movie @boundary {
+					id: ID!
+					gizmo: Gizmo
+				}
+				type Query {
+					node(id: ID!): Node!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					panic("should not be called")
+				}),
+			},
+		},
+		query: `query q($skipTitle: Boolean!, $skipGizmo: Boolean!) {
+			movie(id: "1") {
+				id
+				title @skip(if: $skipTitle)
+				gizmo @skip(if: $skipGizmo) {
+					foo
+					bar
+				}
+			}
+		}`,
+		variables: map[string]interface{}{
+			"skipTitle": true,
+			"skipGizmo": true,
+		},
+		expected: `{
+			"movie": {
+				"id": "1"
+			}
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionMultipleServicesWithSkippedFragments(t *testing.T) {
+	services := []testService{
+		{
+			schema: `directive @boundary on OBJECT
+			type Movie @boundary {
+				id: ID!
+				title: String
+			}
+			type Query {
+				movie(id: ID!): Movie!
+			}`,
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				if !strings.Contains(string(b), "title") {
+					// all the fields are skipped, the selection set can't be
+					// empty though
+					assert.Contains(t, string(b), "_typename: __typename")
+					w.Write([]byte(`{ "data": { "movie": { "_typename": "Movie" } } }`))
+					return
+				}
+				w.Write([]byte(`{
+					"data": {
+						"movie": {
+							"id": "1",
+							"title": "Test title"
+						}
+					}
+				}
+				`))
+			}),
+		},
+		{
+			schema: `directive @boundary on OBJECT
+			interface Node { id: ID! }
+			type Gizmo {
+				foo: String!
+			}
+			type Movie @boundary {
+				id: ID!
+				gizmo: Gizmo
+			}
+			type Query {
+				node(id: ID!): Node!
+			}`,
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("should not be called")
+			}),
+		},
+	}
+
+	t.Run("inline fragment", func(t *testing.T) {
+		f := &queryExecutionFixture{
+			services: services,
+			query: `query q($withGizmo: Boolean!) {
+				movie(id: "1") {
+					id
+					title
+					... on Movie @include(if: $withGizmo) {
+						gizmo { foo }
+					}
+				}
+			}`,
+			variables: map[string]interface{}{"withGizmo": false},
+			expected: `{
+				"movie": {
+					"id": "1",
+					"title": "Test title"
+				}
+			}`,
+		}
+
+		f.checkSuccess(t)
+	})
+
+	t.Run("fragment spread", func(t *testing.T) {
+		f := &queryExecutionFixture{
+			services: services,
+			query: `query q($skipGizmo: Boolean!) {
+				movie(id: "1") {
+					id
+					title
+					...GizmoFragment @skip(if: $skipGizmo)
+				}
+			}
+
+			fragment GizmoFragment on Movie {
+				gizmo { foo }
+			}`,
+			variables: map[string]interface{}{"skipGizmo": true},
+			expected: `{
+				"movie": {
+					"id": "1",
+					"title": "Test title"
+				}
+			}`,
+		}
+
+		f.checkSuccess(t)
+	})
+
+	t.Run("all the fields of an object", func(t *testing.T) {
+		f := &queryExecutionFixture{
+			services: services,
+			query: `query q($skip: Boolean!) {
+				movie(id: "1") {
+					title @skip(if: $skip)
+					gizmo @skip(if: $skip) { foo }
+				}
+			}`,
+			variables: map[string]interface{}{"skip": true},
+			expected: `{
+				"movie": {}
+			}`,
+		}
+
+		f.checkSuccess(t)
+	})
+}
+
+func TestQueryExecutionMultipleServicesWithSkipFalseDirectives(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+				type Query {
+					movie(id: ID!): Movie!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"movie": {
+								"id": "1"
+							}
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+				type Gizmo {
+					foo: String!
+					bar: String!
+				}
+				type Movie @boundary {
+					id: ID!
+					gizmo: Gizmo
+				}
+				type Query {
+					node(id: ID!): Node!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"_0": {
+								"id": "1",
+								"title": "no soup for you",
+								"gizmo": {
+									"foo": "a foo",
+									"bar": "a bar"
+								}
+							}
+						}
+					}
+					`))
+				}),
+			},
+		},
+		query: `query q($skipTitle: Boolean!, $skipGizmo: Boolean!) {
+			movie(id: "1") {
+				id
+				title @skip(if: $skipTitle)
+				gizmo @skip(if: $skipGizmo) {
+					foo
+					bar
+				}
+			}
+		}`,
+		variables: map[string]interface{}{
+			"skipTitle": false,
+			"skipGizmo": false,
+		},
+		expected: `{
+			"movie": {
+				"id": "1",
+				"title": "no soup for you",
+				"gizmo": {
+					"foo": "a foo",
+					"bar": "a bar"
+				}
+			}
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionMultipleServicesWithIncludeFalseDirectives(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+				type Query {
+					movie(id: ID!): Movie!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"movie": {
+								"id": "1"
+							}
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+				type Gizmo {
+					foo: String!
+					bar: String!
+				}
+				type Movie @boundary {
+					id: ID!
+					gizmo: Gizmo
+				}
+				type Query {
+					node(id: ID!): Node!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					panic("should not be called")
+				}),
+			},
+		},
+		query: `query q($includeTitle: Boolean!, $includeGizmo: Boolean!) {
+			movie(id: "1") {
+				id
+				title @include(if: $includeTitle)
+				gizmo @include(if: $includeGizmo) {
+					foo
+					bar
+				}
+			}
+		}`,
+		variables: map[string]interface{}{
+			"includeTitle": false,
+			"includeGizmo": false,
+		},
+		expected: `{
+			"movie": {
+				"id": "1"
+			}
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionMultipleServicesWithIncludeTrueDirectives(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+				type Query {
+					movie(id: ID!): Movie!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"movie": {
+								"id": "1"
+							}
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+				type Gizmo {
+					foo: String!
+					bar: String!
+				}
+				type Movie @boundary {
+					id: ID!
+					gizmo: Gizmo
+				}
+				type Query {
+					node(id: ID!): Node!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"_0": {
+								"id": "1",
+								"title": "yada yada yada",
+								"gizmo": {
+									"foo": "a foo",
+									"bar": "a bar"
+								}
+							}
+						}
+					}
+					`))
+				}),
+			},
+		},
+		query: `query q($includeTitle: Boolean!, $includeGizmo: Boolean!) {
+			movie(id: "1") {
+				id
+				title @include(if: $includeTitle)
+				gizmo @include(if: $includeGizmo) {
+					foo
+					bar
+				}
+			}
+		}`,
+		variables: map[string]interface{}{
+			"includeTitle": true,
+			"includeGizmo": true,
+		},
+		expected: `{
+			"movie": {
+				"id": "1",
+				"title": "yada yada yada",
+				"gizmo": {
+					"foo": "a foo",
+					"bar": "a bar"
+				}
+			}
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestMutationExecution(t *testing.T) {
+	schema1 := `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+				type Query {
+					movie(id: ID!): Movie!
+				}
+				type Mutation {
+					updateTitle(id: ID!, title: String): Movie
+				}`
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: schema1,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var q map[string]string
+					json.NewDecoder(r.Body).Decode(&q)
+					assertQueriesEqual(t, schema1, `mutation { updateTitle(id: "2", title: "New title") { _id: id title } }`, q["query"])
+
+					w.Write([]byte(`{
+						"data": {
+							"updateTitle": {
+								"id": "2",
+								"title": "New title"
+							}
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+				type Movie @boundary {
+					id: ID!
+					release: Int
+				}
+				type Query {
+					node(id: ID!): Node!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"_0": {
+								"id": "2",
+								"release": 2007
+							}
+						}
+					}
+					`))
+				}),
+			},
+		},
+		query: `mutation {
+			updateTitle(id: "2", title: "New title") {
+				title
+				release
+			}
+		}`,
+		expected: `{
+			"updateTitle": {
+				"title": "New title",
+				"release": 2007
+			}
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestMutationExecutionIsSequential(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	record := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+				type Query {
+					movie(id: ID!): Movie!
+				}
+				type Mutation {
+					updateTitle(id: ID!, title: String): Movie
+					deleteMovie(id: ID!): Boolean
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := ioutil.ReadAll(r.Body)
+					if strings.Contains(string(b), "deleteMovie") {
+						record("deleteMovie")
+						w.Write([]byte(`{ "data": { "deleteMovie": true } }`))
+						return
+					}
+					// the next mutation must wait for the whole field to be resolved
+					time.Sleep(20 * time.Millisecond)
+					record("updateTitle")
+					w.Write([]byte(`{ "data": { "updateTitle": { "_id": "2", "title": "New title" } } }`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+				type Movie @boundary {
+					id: ID!
+					release: Int
+				}
+				type Query {
+					node(id: ID!): Node!
+				}
+				type Mutation {
+					rateMovie(id: ID!, rating: Int!): Boolean
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := ioutil.ReadAll(r.Body)
+					if strings.Contains(string(b), "rateMovie") {
+						record("rateMovie")
+						w.Write([]byte(`{ "data": { "rateMovie": true } }`))
+						return
+					}
+					time.Sleep(20 * time.Millisecond)
+					record("release")
+					w.Write([]byte(`{ "data": { "_0": { "_id": "2", "release": 2007 } } }`))
+				}),
+			},
+		},
+		query: `mutation {
+			updateTitle(id: "2", title: "New title") {
+				title
+				release
+			}
+			rateMovie(id: "2", rating: 5)
+			deleteMovie(id: "2")
+		}`,
+		expected: `{
+			"updateTitle": {
+				"title": "New title",
+				"release": 2007
+			},
+			"rateMovie": true,
+			"deleteMovie": true
+		}`,
+	}
+
+	f.checkSuccess(t)
+	assert.Equal(t, []string{"updateTitle", "release", "rateMovie", "deleteMovie"}, calls)
+}
+
+func TestQueryExecutionWithUnions(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `
+				interface Node { id: ID! }
+				directive @boundary on OBJECT
+
+				type Dog { name: String! age: Int }
+				type Cat { name: String! age: Int }
+				type Snake { name: String! age: Int }
+				union Animal = Dog | Cat | Snake
+
+				type Person @boundary {
+					id: ID!
+					pet: Animal
+				}
+
+				type Query {
+					node(id: ID!): Node
+					animals: [Animal]!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := ioutil.ReadAll(r.Body)
+					if strings.Contains(string(b), "animals") {
+						w.Write([]byte(`{
+							"data": {
+								"foo": [
+									{ "name": "fido", "age": 4 },
+									{ "name": "felix", "age": 2 },
+									{ "age": 20, "name": "ka" }
+								]
+							}
+						}
+						`))
+					} else {
+						w.Write([]byte(`{
+							"data": {
+								"_0": {
+									"_id": "2",
+									"pet": {
+										"name": "felix",
+										"age": 2
+									}
+								}
+							}
+						}
+						`))
+					}
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+
+				type Person @boundary {
+					id: ID!
+					name: String!
+				}
+
+				type Query {
+					person(id: ID!): Person
+				}`,
+
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"person": {
+								"_id": "2",
+								"name": "Bob"
+							}
+						}
+					}
+					`))
+				}),
+			},
+		},
+		query: `{
+			person(id: "2") {
+				name
+				pet {
+					... on Dog { name, age }
+					... on Cat { name, age }
+					... on Snake { age, name }
+				}
+			}
+			foo: animals {
+				... on Dog { name, age }
+				... on Cat { name, age }
+				... on Snake { age, name }
+			}
+		}`,
+		expected: `{
+			"person": {
+				"name": "Bob",
+				"pet": {
+					"name": "felix",
+					"age": 2
+				}
+			},
+			"foo": [
+				{ "name": "fido", "age": 4 },
+				{ "name": "felix", "age": 2 },
+				{ "age": 20, "name": "ka" }
+			]
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionWithInterfaceSpanningServices(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
+				interface Named { name: String! }
+
+				type Movie implements Named @boundary {
+					id: ID!
+					name: String!
+				}
+
+				type Book implements Named @boundary {
+					id: ID!
+					name: String!
+				}
+
+				type Query {
+					search: [Named!]!
+					movie(id: ID!): Movie @boundary
+					book(id: ID!): Book @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"search": [
+								{ "_typename": "Movie", "_id": "1", "name": "Alien" },
+								{ "_typename": "Book", "_id": "2", "name": "Dune" }
+							]
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
+				type Movie @boundary {
+					id: ID!
+					posterUrl: String!
+				}
+
+				type Query {
+					movie(id: ID!): Movie @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := ioutil.ReadAll(r.Body)
+					if strings.Contains(string(b), `\"2\"`) {
+						w.Write([]byte(`{ "errors": [{ "message": "the book was sent to the movie service" }] }`))
+						return
+					}
+					w.Write([]byte(`{
+						"data": {
+							"_0": { "_id": "1", "posterUrl": "alien.png" }
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
+				type Book @boundary {
+					id: ID!
+					pages: Int!
+				}
+
+				type Query {
+					book(id: ID!): Book @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := ioutil.ReadAll(r.Body)
+					if strings.Contains(string(b), `\"1\"`) {
+						w.Write([]byte(`{ "errors": [{ "message": "the movie was sent to the book service" }] }`))
+						return
+					}
+					w.Write([]byte(`{
+						"data": {
+							"_0": { "_id": "2", "pages": 412 }
+						}
+					}
+					`))
+				}),
+			},
+		},
+		query: `{
+			search {
+				name
+				... on Movie { posterUrl }
+				... on Book { pages }
+			}
+		}`,
+		expected: `{
+			"search": [
+				{ "name": "Alien", "posterUrl": "alien.png" },
+				{ "name": "Dune", "pages": 412 }
+			]
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionWithUnionMembersOfDifferentServices(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
+				type Movie @boundary {
+					id: ID!
+					title: String!
+				}
+
+				type Book @boundary {
+					id: ID!
+				}
+
+				union Media = Movie | Book
+
+				type Query {
+					media: [Media!]!
+					movie(id: ID!): Movie @boundary
+					book(id: ID!): Book @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := ioutil.ReadAll(r.Body)
+					if strings.Contains(string(b), "Podcast") {
+						w.Write([]byte(`{ "errors": [{ "message": "unknown type Podcast" }] }`))
+						return
+					}
+					w.Write([]byte(`{
+						"data": {
+							"media": [
+								{ "_typename": "Movie", "_id": "1", "title": "Alien" },
+								{ "_typename": "Book", "_id": "2" }
+							]
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
+				type Book @boundary {
+					id: ID!
+					title: String!
+				}
+
+				type Podcast {
+					title: String!
+				}
+
+				union Media = Book | Podcast
+
+				type Query {
+					podcasts: [Media!]!
+					book(id: ID!): Book @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := ioutil.ReadAll(r.Body)
+					if strings.Contains(string(b), `\"1\"`) {
+						w.Write([]byte(`{ "errors": [{ "message": "the movie was sent to the book service" }] }`))
+						return
+					}
+					w.Write([]byte(`{
+						"data": {
+							"_0": { "_id": "2", "title": "Dune" }
+						}
+					}
+					`))
+				}),
+			},
+		},
+		query: `{
+			media {
+				... on Movie { title }
+				... on Book { title }
+				... on Podcast { title }
+			}
+		}`,
+		expected: `{
+			"media": [
+				{ "title": "Alien" },
+				{ "title": "Dune" }
+			]
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionStrictResponseValidation(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+
+				type Query {
+					movie(id: ID!): Movie!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "movie": { "_id": "1", "id": "1", "title": "Test title" } } }`))
+				}),
+			},
+			{
+				name: "releases",
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+				enum Genre { DRAMA COMEDY }
+
+				type Movie @boundary {
+					id: ID!
+					release: Int
+					genre: Genre!
+				}
+
+				type Query {
+					node(id: ID!): Node
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "_0": { "_id": "1", "release": "2007", "genre": "DRAMA" } } }`))
+				}),
+			},
+		},
+		query: `{
+			movie(id: "1") {
+				id
+				title
+				release
+				genre
+			}
+		}`,
+		strictResponseValidation: true,
+		errors: gqlerror.List{
+			{
+				Message:    `service "releases" returned an invalid value for field Movie.release: expected Int, got a string`,
+				Path:       ast.Path{ast.PathName("movie"), ast.PathName("release")},
+				Extensions: map[string]interface{}{"code": invalidResponseCode, "serviceName": "releases"},
+			},
+		},
+	}
+	f.run(t)
+	jsonEqWithOrder(t, `{
+		"movie": {
+			"id": "1",
+			"title": "Test title",
+			"release": null,
+			"genre": "DRAMA"
+		}
+	}`, string(f.resp.Data))
+
+	// the values are returned as is without strict validation
+	f.strictResponseValidation = false
+	f.errors = nil
+	f.expected = `{
+		"movie": {
+			"id": "1",
+			"title": "Test title",
+			"release": "2007",
+			"genre": "DRAMA"
+		}
+	}`
+	f.run(t)
+}
+
+func TestQueryExecutionStripsInjectedTypename(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `
+				interface Named { name: String! }
+				type Gizmo implements Named { name: String! }
+
+				type Query {
+					named: [Named!]!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"named": [
+								{ "_typename": "Gizmo" }
+							]
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `
+				interface Named { name: String! }
+				type Gimmick implements Named { name: String! size: Float! }
+
+				type Query {
+					gimmicks: [Named!]!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "gimmicks": [] } }`))
+				}),
+			},
+		},
+		query: `{
+			named {
+				... on Gimmick { size }
+			}
+		}`,
+		expected: `{
+			"named": [{}]
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionWithRequiredFields(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
+				enum Unit { KG LB }
+
+				type Product @boundary {
+					id: ID!
+					name: String!
+					weight: Float!
+					unit: Unit!
+				}
+
+				type Query {
+					products: [Product!]!
+					product(id: ID!): Product @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"products": [
+								{ "_id": "1", "name": "Table", "_weight": 12.5, "_unit": "KG" },
+								{ "_id": "2", "name": "Chair", "_weight": 4, "_unit": "LB" }
+							]
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+				directive @requires(fields: String!) on FIELD_DEFINITION
+
+				enum Unit { KG LB }
+
+				type Product @boundary {
+					id: ID!
+					shippingEstimate: Float! @requires(fields: "weight unit")
+				}
+
+				type Query {
+					product(id: ID!, weight: Float, unit: Unit): Product @boundary(key: "id")
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := ioutil.ReadAll(r.Body)
+					query := string(b)
+					if !strings.Contains(query, `product(id: \"1\", weight: 12.5, unit: KG)`) || !strings.Contains(query, `product(id: \"2\", weight: 4, unit: LB)`) {
+						w.Write([]byte(`{ "errors": [{ "message": "missing required fields" }] }`))
+						return
+					}
+					w.Write([]byte(`{
+						"data": {
+							"_0": { "_id": "1", "shippingEstimate": 25 },
+							"_1": { "_id": "2", "shippingEstimate": 8 }
+						}
+					}
+					`))
+				}),
+			},
+		},
+		query: `{
+			products {
+				name
+				shippingEstimate
+			}
+		}`,
+		expected: `{
+			"products": [
+				{ "name": "Table", "shippingEstimate": 25 },
+				{ "name": "Chair", "shippingEstimate": 8 }
+			]
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionWithRequiredFieldsRepresentations(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
+				type Product @boundary {
+					id: ID!
+					name: String!
+				}
+
+				type Query {
+					products: [Product!]!
+					product(id: ID!): Product @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"products": [
+								{ "_id": "1", "name": "Table" },
+								{ "_id": "2", "name": "Chair" }
+							]
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
+				type Product @boundary {
+					id: ID!
+					weight: Float!
+				}
+
+				type Query {
+					products(ids: [ID!]): [Product]! @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"_result": [
+								{ "_id": "1", "_weight": 12.5 },
+								{ "_id": "2", "_weight": 4 }
+							]
+						}
+					}
+					`))
+				}),
+			},
+			{
+				schema: `directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+				directive @requires(fields: String!) on FIELD_DEFINITION
+
+				type Product @boundary {
+					id: ID!
+					shippingEstimate: Float! @requires(fields: "weight")
+				}
+
+				input ProductRepresentation {
+					weight: Float
+				}
+
+				type Query {
+					products(ids: [ID!], representations: [ProductRepresentation!]): [Product]! @boundary(key: "ids")
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := ioutil.ReadAll(r.Body)
+					if !strings.Contains(string(b), `representations: [{weight: 12.5} {weight: 4}]`) {
+						w.Write([]byte(`{ "errors": [{ "message": "missing required fields" }] }`))
+						return
+					}
+					w.Write([]byte(`{
+						"data": {
+							"_result": [
+								{ "_id": "1", "shippingEstimate": 25 },
+								{ "_id": "2", "shippingEstimate": 8 }
+							]
+						}
+					}
+					`))
+				}),
+			},
+		},
+		query: `{
+			products {
+				name
+				shippingEstimate
+			}
+		}`,
+		expected: `{
+			"products": [
+				{ "name": "Table", "shippingEstimate": 25 },
+				{ "name": "Chair", "shippingEstimate": 8 }
+			]
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionWithNamespaces(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `
+					directive @boundary on OBJECT
+					directive @namespace on OBJECT
+					interface Node { id: ID! }
+
+					type Cat implements Node @boundary {
+						id: ID!
+						name: String!
+					}
+
+					type AnimalsQuery @namespace {
+						cats: CatsQuery!
+					}
+
+					type CatsQuery @namespace {
+						allCats: [Cat!]!
+					}
+
+					type Query {
+						animals: AnimalsQuery!
+						node(id: ID!): Node!
+					}
+				`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := ioutil.ReadAll(r.Body)
+
+					if strings.Contains(string(b), "node") {
+						w.Write([]byte(`{
+							"data": {
+								"_0": {
+									"name": "Felix"
+								}
+							}
+						}
+						`))
+					} else {
+						w.Write([]byte(`{
+							"data": {
+								"animals": {
+									"cats": {
+										"allCats": [
+											{ "name": "Felix" },
+											{ "name": "Tigrou" }
+										]
+									}
+								}
+							}
+						}
+						`))
+					}
+				}),
+			},
+			{
+				schema: `
+					directive @boundary on OBJECT
+					directive @namespace on OBJECT
+					interface Node { id: ID! }
+
+					type Cat implements Node @boundary {
+						id: ID!
+					}
+
+					type AnimalsQuery @namespace {
+						species: [String!]!
+						cats: CatsQuery!
+					}
+
+					type CatsQuery @namespace {
+						searchCat(name: String!): Cat
+					}
+
+					type Query {
+						animals: AnimalsQuery!
+					}
+				`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"animals": {
+								"cats": {
+									"searchCat": {
+										"id": "CA7"
+									}
+								}
+							}
+						}
+					}
+					`))
+				}),
+			},
+		},
+		query: `{ animals {
+			cats {
+				allCats {
+					name
+				}
+				searchCat(name: "Felix") {
+					id
+					name
+				}
+			}
+		}}`,
+		expected: `{
+			"animals": {
+				"cats": {
+					"allCats": [
+						{ "name": "Felix" },
+						{ "name": "Tigrou" }
+					],
+					"searchCat": { "id": "CA7", "name": "Felix" }
+				}
+			}
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestQueryExecutionRootStepsArrivalOrder(t *testing.T) {
+	delay := func() {
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+	}
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `
+					directive @boundary on OBJECT
+					directive @namespace on OBJECT
+					interface Node { id: ID! }
+
+					type Cat implements Node @boundary {
+						id: ID!
+						name: String!
+					}
+
+					type AnimalsQuery @namespace {
+						cats: CatsQuery!
+					}
+
+					type CatsQuery @namespace {
+						allCats: [Cat!]!
+					}
+
+					type Query {
+						animals: AnimalsQuery!
+						node(id: ID!): Node!
+					}
+				`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := ioutil.ReadAll(r.Body)
+					delay()
+					if strings.Contains(string(b), "node") {
+						w.Write([]byte(`{ "data": { "_0": { "name": "Felix" } } }`))
+						return
+					}
+					w.Write([]byte(`{
+						"data": {
+							"animals": {
+								"cats": {
+									"allCats": [{ "name": "Felix" }, { "name": "Tigrou" }]
+								}
+							}
+						}
+					}`))
+				}),
+			},
+			{
+				schema: `
+					directive @boundary on OBJECT
+					directive @namespace on OBJECT
+					interface Node { id: ID! }
+
+					type Cat implements Node @boundary {
+						id: ID!
+					}
+
+					type AnimalsQuery @namespace {
+						species: [String!]!
+						cats: CatsQuery!
+					}
+
+					type CatsQuery @namespace {
+						searchCat(name: String!): Cat
+					}
+
+					type Query {
+						animals: AnimalsQuery!
+					}
+				`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					delay()
+					w.Write([]byte(`{
+						"data": {
+							"animals": {
+								"species": ["cat"],
+								"cats": {
+									"searchCat": { "id": "CA7" }
+								}
+							}
+						}
+					}`))
+				}),
+			},
+		},
+		query: `{ animals {
+			__typename
+			species
+			cats {
+				__typename
+				allCats {
+					name
+				}
+				searchCat(name: "Felix") {
+					id
+					name
+				}
+			}
+		}}`,
+		expected: `{
+			"animals": {
+				"__typename": "AnimalsQuery",
+				"species": ["cat"],
+				"cats": {
+					"__typename": "CatsQuery",
+					"allCats": [
+						{ "name": "Felix" },
+						{ "name": "Tigrou" }
+					],
+					"searchCat": { "id": "CA7", "name": "Felix" }
+				}
+			}
+		}`,
+	}
+
+	for i := 0; i < 50; i++ {
+		f.checkSuccess(t)
+	}
+}
+
+func TestStripInjectedFields(t *testing.T) {
+	data := map[string]interface{}{
+		"movies": []interface{}{
+			map[string]interface{}{
+				"_id":   "1",
+				"title": "Movie 1",
+				"compTitles": []interface{}{
+					map[string]interface{}{"_id": "2", "title": "Movie 2"},
+				},
+				"_join_directorId": "3",
+				"director":         map[string]interface{}{"_id": "3", "name": "Director 3"},
+			},
+			nil,
+		},
+		"raw":      json.RawMessage(`{"_id": "4", "title": "Movie 4"}`),
+		"rawNoIDs": json.RawMessage(`{"title": "Movie 5"}`),
+	}
+	plan := &QueryPlan{
+		RootSteps: []*QueryPlanStep{
+			{
+				InjectedFields: []string{"movies._id"},
+				Then: []*QueryPlanStep{
+					{
+						InsertionPoint: []string{"movies"},
+						InjectedFields: []string{"_id", "_join_directorId"},
+						Then: []*QueryPlanStep{
+							{
+								InsertionPoint: []string{"movies", "compTitles"},
+								InjectedFields: []string{"_id"},
+							},
+						},
+					},
+					{
+						InsertionPoint: []string{"movies"},
+						InjectedFields: []string{"_id"},
+						Join:           &JoinStep{FieldAlias: "director"},
+					},
+				},
+			},
+			{
+				InjectedFields: []string{"raw._id", "rawNoIDs._id"},
+			},
+		},
+	}
+
+	stripInjectedFields(data, plan.RootSteps)
+	assert.Equal(t, map[string]interface{}{
+		"movies": []interface{}{
+			map[string]interface{}{
+				"title": "Movie 1",
+				"compTitles": []interface{}{
+					map[string]interface{}{"title": "Movie 2"},
+				},
+				"director": map[string]interface{}{"name": "Director 3"},
+			},
+			nil,
+		},
+		"raw":      map[string]interface{}{"title": json.RawMessage(`"Movie 4"`)},
+		"rawNoIDs": json.RawMessage(`{"title": "Movie 5"}`),
+	}, data)
+}
+
+func TestMergeMaps(t *testing.T) {
+	sources := []string{
+		`{ "animals": { "__typename": "AnimalsQuery", "cats": { "__typename": "CatsQuery" } } }`,
+		`{ "animals": { "cats": { "allCats": [{ "name": "Felix" }] } } }`,
+		`{ "animals": { "species": ["cat"], "cats": null } }`,
+		`{ "animals": { "__typename": "AnimalsQuery", "count": 1 } }`,
+		`{ "animals": { "count": 2 }, "other": null }`,
+		`{ "animals": { "count": 1 } }`,
+	}
+	expected := `{
+		"animals": {
+			"__typename": "AnimalsQuery",
+			"cats": {
+				"__typename": "CatsQuery",
+				"allCats": [{ "name": "Felix" }]
+			},
+			"species": ["cat"],
+			"count": null
 		},
-		expected: `{
-			"movie": {
-				"id": "1"
+		"other": null
+	}`
+
+	permutations := [][]int{{0, 1, 2, 3, 4, 5}, {5, 4, 3, 2, 1, 0}, {2, 0, 4, 1, 5, 3}, {3, 5, 4, 0, 2, 1}, {1, 2, 3, 4, 0, 5}}
+	for _, order := range permutations {
+		result := map[string]interface{}{}
+		var conflicts []ast.Path
+		for i, index := range order {
+			var data map[string]json.RawMessage
+			require.NoError(t, json.Unmarshal([]byte(sources[index]), &data))
+			src := jsonMapToInterfaceMap(data)
+			if i%2 == 0 {
+				// mix raw and decoded values
+				var decoded map[string]interface{}
+				require.NoError(t, json.Unmarshal([]byte(sources[index]), &decoded))
+				src = decoded
 			}
-		}`,
-	}
+			conflicts = append(conflicts, mergeMaps(result, src, nil)...)
+		}
 
-	f.checkSuccess(t)
+		b, err := json.Marshal(result)
+		require.NoError(t, err)
+		assert.JSONEq(t, expected, string(b), "order: %v", order)
+		assert.Equal(t, []ast.Path{{ast.PathName("animals"), ast.PathName("count")}}, conflicts, "order: %v", order)
+	}
 }
 
-func TestQueryExecutionMultipleServicesWithSkipFalseDirectives(t *testing.T) {
+func TestDebugExtensions(t *testing.T) {
+	called := false
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `directive @boundary on OBJECT
-				type Movie @boundary {
-					id: ID!
-					title: String
-				}
+				schema: `
 				type Query {
-					movie(id: ID!): Movie!
-				}`,
-				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					w.Write([]byte(`{
-						"data": {
-							"movie": {
-								"id": "1"
-							}
-						}
-					}
-					`))
-				}),
-			},
-			{
-				schema: `directive @boundary on OBJECT
-				interface Node { id: ID! }
-				type Gizmo {
-					foo: String!
-					bar: String!
-				}
-				type Movie @boundary {
-					id: ID!
-					gizmo: Gizmo
+					q(id: ID!): String!
 				}
-				type Query {
-					node(id: ID!): Node!
-				}`,
+				`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					called = true
 					w.Write([]byte(`{
 						"data": {
-							"_0": {
-								"id": "1",
-								"title": "no soup for you",
-								"gizmo": {
-									"foo": "a foo",
-									"bar": "a bar"
-								}
-							}
+							"q": "hi"
 						}
-					}
-					`))
+					}`))
 				}),
 			},
 		},
-		query: `query q($skipTitle: Boolean!, $skipGizmo: Boolean!) {
-			movie(id: "1") {
-				id
-				title @skip(if: $skipTitle)
-				gizmo @skip(if: $skipGizmo) {
-					foo
-					bar
-				}
-			}
-		}`,
-		variables: map[string]interface{}{
-			"skipTitle": false,
-			"skipGizmo": false,
+		debug: &DebugInfo{
+			Variables: true,
+			Query:     true,
+			Plan:      true,
 		},
+		query: `{
+			q(id: "1")
+		}`,
 		expected: `{
-			"movie": {
-				"id": "1",
-				"title": "no soup for you",
-				"gizmo": {
-					"foo": "a foo",
-					"bar": "a bar"
-				}
-			}
+			"q": "hi"
 		}`,
 	}
 
 	f.checkSuccess(t)
+	assert.True(t, called)
+	assert.NotNil(t, f.resp.Extensions["variables"])
 }
 
-func TestQueryExecutionMultipleServicesWithIncludeFalseDirectives(t *testing.T) {
+func TestDebugExtensionsStepTimings(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `directive @boundary on OBJECT
-				type Movie @boundary {
-					id: ID!
-					title: String
+				schema: `
+				directive @namespace on OBJECT
+
+				type MovieQuery @namespace {
+					title: String!
 				}
+
 				type Query {
-					movie(id: ID!): Movie!
-				}`,
+					movie: MovieQuery!
+				}
+				`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
 						"data": {
-							"movie": {
-								"id": "1"
-							}
+							"movie": { "title": "Test title" }
 						}
-					}
-					`))
-				}),
-			},
-			{
-				schema: `directive @boundary on OBJECT
-				interface Node { id: ID! }
-				type Gizmo {
-					foo: String!
-					bar: String!
-				}
-				type Movie @boundary {
-					id: ID!
-					gizmo: Gizmo
-				}
-				type Query {
-					node(id: ID!): Node!
-				}`,
-				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					panic("should not be called")
+					}`))
 				}),
 			},
 		},
-		query: `query q($includeTitle: Boolean!, $includeGizmo: Boolean!) {
-			movie(id: "1") {
-				id
-				title @include(if: $includeTitle)
-				gizmo @include(if: $includeGizmo) {
-					foo
-					bar
-				}
+		debug: &DebugInfo{
+			Timing: true,
+		},
+		query: `{
+			movie {
+				__typename
+				title
 			}
 		}`,
-		variables: map[string]interface{}{
-			"includeTitle": false,
-			"includeGizmo": false,
-		},
 		expected: `{
 			"movie": {
-				"id": "1"
+				"__typename": "MovieQuery",
+				"title": "Test title"
 			}
 		}`,
 	}
 
 	f.checkSuccess(t)
+	require.IsType(t, []StepTiming{}, f.resp.Extensions["steps"])
+	steps := f.resp.Extensions["steps"].([]StepTiming)
+	require.Len(t, steps, 2)
+	var services []string
+	for _, s := range steps {
+		services = append(services, s.ServiceURL)
+	}
+	assert.Contains(t, services, internalServiceName)
 }
 
-func TestQueryExecutionMultipleServicesWithIncludeTrueDirectives(t *testing.T) {
+func TestQueryExecutionInternalStepError(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		directive @namespace on OBJECT
+
+		type MovieQuery @namespace {
+			title: String!
+		}
+
+		type Query {
+			movie: MovieQuery!
+		}
+	`})
+	query := gqlparser.MustLoadQuery(schema, `{
+		movie {
+			__typename
+		}
+	}`)
+
+	locations := FieldURLMap{}
+	locations.RegisterURL("MovieQuery", "title", "http://movies")
+	plan, err := Plan(&PlanningContext{
+		Operation: query.Operations[0],
+		Schema:    schema,
+		Locations: locations,
+		Services:  map[string]*Service{},
+	})
+	require.NoError(t, err)
+	require.Len(t, plan.RootSteps, 1)
+	require.Equal(t, internalServiceName, plan.RootSteps[0].ServiceURL)
+
+	ctx, cancel := context.WithCancel(testContextWithoutVariables(query.Operations[0]))
+	cancel()
+
+	qe := newQueryExecution(NewClient(), schema, nil, 50, nil)
+	errs := qe.execute(ctx, plan, map[string]interface{}{})
+	require.Len(t, errs, 1)
+	assert.Equal(t, "context canceled", errs[0].Message)
+	assert.Equal(t, ast.Path{ast.PathName("movie")}, errs[0].Path)
+	assert.Equal(t, []gqlerror.Location{{Line: 2, Column: 3}}, errs[0].Locations)
+	require.Len(t, qe.StepTimings, 1)
+	assert.Equal(t, internalServiceName, qe.StepTimings[0].ServiceName)
+}
+
+func TestQueryWithBoundaryFields(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `directive @boundary on OBJECT
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
 				type Movie @boundary {
 					id: ID!
 					title: String
 				}
+
 				type Query {
-					movie(id: ID!): Movie!
+					movie(id: ID!): Movie
+					_movie(id: ID!): Movie @boundary
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
 						"data": {
 							"movie": {
-								"id": "1"
+								"id": "1",
+								"title": "Test title"
 							}
 						}
 					}
@@ -1931,29 +4113,22 @@ func TestQueryExecutionMultipleServicesWithIncludeTrueDirectives(t *testing.T) {
 				}),
 			},
 			{
-				schema: `directive @boundary on OBJECT
-				interface Node { id: ID! }
-				type Gizmo {
-					foo: String!
-					bar: String!
-				}
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
 				type Movie @boundary {
 					id: ID!
-					gizmo: Gizmo
+					release: Int
 				}
+
 				type Query {
-					node(id: ID!): Node!
+					movie(id: ID!): Movie @boundary
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
 						"data": {
 							"_0": {
 								"id": "1",
-								"title": "yada yada yada",
-								"gizmo": {
-									"foo": "a foo",
-									"bar": "a bar"
-								}
+								"release": 2007
 							}
 						}
 					}
@@ -1961,28 +4136,18 @@ func TestQueryExecutionMultipleServicesWithIncludeTrueDirectives(t *testing.T) {
 				}),
 			},
 		},
-		query: `query q($includeTitle: Boolean!, $includeGizmo: Boolean!) {
+		query: `{
 			movie(id: "1") {
 				id
-				title @include(if: $includeTitle)
-				gizmo @include(if: $includeGizmo) {
-					foo
-					bar
-				}
+				title
+				release
 			}
 		}`,
-		variables: map[string]interface{}{
-			"includeTitle": true,
-			"includeGizmo": true,
-		},
 		expected: `{
 			"movie": {
 				"id": "1",
-				"title": "yada yada yada",
-				"gizmo": {
-					"foo": "a foo",
-					"bar": "a bar"
-				}
+				"title": "Test title",
+				"release": 2007
 			}
 		}`,
 	}
@@ -1990,147 +4155,158 @@ func TestQueryExecutionMultipleServicesWithIncludeTrueDirectives(t *testing.T) {
 	f.checkSuccess(t)
 }
 
-func TestMutationExecution(t *testing.T) {
-	schema1 := `directive @boundary on OBJECT
-				type Movie @boundary {
-					id: ID!
-					title: String
-				}
-				type Query {
-					movie(id: ID!): Movie!
-				}
-				type Mutation {
-					updateTitle(id: ID!, title: String): Movie
-				}`
+func TestQueryWithArrayBoundaryFields(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: schema1,
-				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					var q map[string]string
-					json.NewDecoder(r.Body).Decode(&q)
-					assertQueriesEqual(t, schema1, `mutation { updateTitle(id: "2", title: "New title") { _id: id title } }`, q["query"])
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
 
+				type Query {
+					randomMovies: [Movie!]!
+					movie(id: ID!): Movie @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
 						"data": {
-							"updateTitle": {
-								"id": "2",
-								"title": "New title"
-							}
+							"randomMovies": [
+								{
+									"id": "1",
+									"title": "Movie 1"
+								},
+								{
+									"id": "2",
+									"title": "Movie 2"
+								},
+								{
+									"id": "3",
+									"title": "Movie 3"
+								}
+							]
 						}
 					}
 					`))
 				}),
 			},
 			{
-				schema: `directive @boundary on OBJECT
-				interface Node { id: ID! }
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
 				type Movie @boundary {
 					id: ID!
 					release: Int
 				}
+
 				type Query {
-					node(id: ID!): Node!
+					movies(ids: [ID!]): [Movie]! @boundary
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
 						"data": {
-							"_0": {
-								"id": "2",
-								"release": 2007
-							}
+							"_result": [
+								{
+									"id": "1",
+									"release": 2007
+								},
+								{
+									"id": "2",
+									"release": 2008
+								},
+								{
+									"id": "3",
+									"release": 2009
+								}
+							]
 						}
 					}
 					`))
 				}),
 			},
 		},
-		query: `mutation {
-			updateTitle(id: "2", title: "New title") {
+		query: `{
+			randomMovies {
+				id
 				title
 				release
 			}
 		}`,
 		expected: `{
-			"updateTitle": {
-				"title": "New title",
-				"release": 2007
-			}
+			"randomMovies": [
+				{
+					"id": "1",
+					"title": "Movie 1",
+					"release": 2007
+				},
+				{
+					"id": "2",
+					"title": "Movie 2",
+					"release": 2008
+				},
+				{
+					"id": "3",
+					"title": "Movie 3",
+					"release": 2009
+				}
+			]
 		}`,
 	}
 
 	f.checkSuccess(t)
 }
-func TestQueryExecutionWithUnions(t *testing.T) {
+
+func TestQueryWithCustomBoundaryArgumentNames(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `
-				interface Node { id: ID! }
-				directive @boundary on OBJECT
-
-				type Dog { name: String! age: Int }
-				type Cat { name: String! age: Int }
-				type Snake { name: String! age: Int }
-				union Animal = Dog | Cat | Snake
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
 
-				type Person @boundary {
+				type Movie @boundary {
 					id: ID!
-					pet: Animal
+					title: String
 				}
 
 				type Query {
-					node(id: ID!): Node
-					animals: [Animal]!
+					randomMovie: Movie!
+					movieByKey(key: ID!): Movie @boundary
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					b, _ := ioutil.ReadAll(r.Body)
-					if strings.Contains(string(b), "animals") {
-						w.Write([]byte(`{
-							"data": {
-								"foo": [
-									{ "name": "fido", "age": 4 },
-									{ "name": "felix", "age": 2 },
-									{ "age": 20, "name": "ka" }
-								]
-							}
-						}
-						`))
-					} else {
-						w.Write([]byte(`{
-							"data": {
-								"_0": {
-									"_id": "2",
-									"pet": {
-										"name": "felix",
-										"age": 2
-									}
-								}
+					w.Write([]byte(`{
+						"data": {
+							"randomMovie": {
+								"id": "1",
+								"title": "Movie 1"
 							}
 						}
-						`))
 					}
+					`))
 				}),
 			},
 			{
-				schema: `directive @boundary on OBJECT
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
 
-				type Person @boundary {
+				type Movie @boundary {
 					id: ID!
-					name: String!
+					release: Int
 				}
 
 				type Query {
-					person(id: ID!): Person
+					moviesByKeys(keys: [ID!]): [Movie]! @boundary
 				}`,
-
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var req map[string]string
+					json.NewDecoder(r.Body).Decode(&req)
+					assert.Contains(t, req["query"], `moviesByKeys(keys: ["1" ])`)
 					w.Write([]byte(`{
 						"data": {
-							"person": {
-								"_id": "2",
-								"name": "Bob"
-							}
+							"_result": [
+								{
+									"id": "1",
+									"release": 2007
+								}
+							]
 						}
 					}
 					`))
@@ -2138,528 +4314,671 @@ func TestQueryExecutionWithUnions(t *testing.T) {
 			},
 		},
 		query: `{
-			person(id: "2") {
-				name
-				pet {
-					... on Dog { name, age }
-					... on Cat { name, age }
-					... on Snake { age, name }
-				}
-			}
-			foo: animals {
-				... on Dog { name, age }
-				... on Cat { name, age }
-				... on Snake { age, name }
+			randomMovie {
+				id
+				title
+				release
 			}
 		}`,
 		expected: `{
-			"person": {
-				"name": "Bob",
-				"pet": {
-					"name": "felix",
-					"age": 2
-				}
-			},
-			"foo": [
-				{ "name": "fido", "age": 4 },
-				{ "name": "felix", "age": 2 },
-				{ "age": 20, "name": "ka" }
-			]
+			"randomMovie": {
+				"id": "1",
+				"title": "Movie 1",
+				"release": 2007
+			}
 		}`,
 	}
 
 	f.checkSuccess(t)
 }
 
-func TestQueryExecutionWithNamespaces(t *testing.T) {
+func TestQueryWithArrayBoundaryFieldsAndMultipleChildrenSteps(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `
-					directive @boundary on OBJECT
-					directive @namespace on OBJECT
-					interface Node { id: ID! }
-
-					type Cat implements Node @boundary {
-						id: ID!
-						name: String!
-					}
-
-					type AnimalsQuery @namespace {
-						cats: CatsQuery!
-					}
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
 
-					type CatsQuery @namespace {
-						allCats: [Cat!]!
-					}
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
 
-					type Query {
-						animals: AnimalsQuery!
-						node(id: ID!): Node!
-					}
-				`,
+				type Query {
+					randomMovie: Movie!
+					movies(ids: [ID!]!): [Movie]! @boundary
+				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					b, _ := ioutil.ReadAll(r.Body)
-
-					if strings.Contains(string(b), "node") {
+					b, _ := io.ReadAll(r.Body)
+					if strings.Contains(string(b), "randomMovie") {
 						w.Write([]byte(`{
-							"data": {
-								"_0": {
-									"name": "Felix"
-								}
+						"data": {
+							"randomMovie": {
+									"id": "1",
+									"title": "Movie 1"
 							}
 						}
-						`))
+					}
+					`))
 					} else {
 						w.Write([]byte(`{
-							"data": {
-								"animals": {
-									"cats": {
-										"allCats": [
-											{ "name": "Felix" },
-											{ "name": "Tigrou" }
-										]
-									}
-								}
-							}
-						}
-						`))
-					}
-				}),
-			},
-			{
-				schema: `
-					directive @boundary on OBJECT
-					directive @namespace on OBJECT
-					interface Node { id: ID! }
-
-					type Cat implements Node @boundary {
-						id: ID!
-					}
-
-					type AnimalsQuery @namespace {
-						species: [String!]!
-						cats: CatsQuery!
+						"data": {
+							"_result": [
+								{ "id": 2, "title": "Movie 2" },
+								{ "id": 3, "title": "Movie 3" },
+								{ "id": 4, "title": "Movie 4" }
+							]
+						}
 					}
-
-					type CatsQuery @namespace {
-						searchCat(name: String!): Cat
+					`))
 					}
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
 
-					type Query {
-						animals: AnimalsQuery!
-					}
-				`,
+				type Movie @boundary {
+					id: ID!
+					compTitles: [Movie!]!
+				}
+
+				type Query {
+					movies(ids: [ID!]): [Movie]! @boundary
+				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
 						"data": {
-							"animals": {
-								"cats": {
-									"searchCat": {
-										"id": "CA7"
-									}
+							"_result": [
+								{
+									"_id": "1",
+									"compTitles": [
+										{"id": "2"},
+										{"id": "3"},
+										{"id": "4"}
+									]
 								}
-							}
+							]
 						}
 					}
 					`))
 				}),
 			},
 		},
-		query: `{ animals {
-			cats {
-				allCats {
-					name
-				}
-				searchCat(name: "Felix") {
+		query: `{
+			randomMovie {
+				id
+				title
+				compTitles {
 					id
-					name
+					title
 				}
 			}
-		}}`,
+		}`,
 		expected: `{
-			"animals": {
-				"cats": {
-					"allCats": [
-						{ "name": "Felix" },
-						{ "name": "Tigrou" }
-					],
-					"searchCat": { "id": "CA7", "name": "Felix" }
+			"randomMovie":
+				{
+					"id": "1",
+					"title": "Movie 1",
+					"compTitles": [
+						{ "id": 2, "title": "Movie 2" },
+						{ "id": 3, "title": "Movie 3" },
+						{ "id": 4, "title": "Movie 4" }
+					]
 				}
-			}
 		}`,
 	}
 
 	f.checkSuccess(t)
 }
 
-func TestDebugExtensions(t *testing.T) {
-	called := false
+func TestQueryError(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `
+				schema: `type Movie {
+					id: ID!
+					title: String
+				}
+
 				type Query {
-					q(id: ID!): String!
+					movie(id: ID!): Movie!
 				}
 				`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					called = true
 					w.Write([]byte(`{
-						"data": {
-							"q": "hi"
-						}
+						"errors": [
+							{
+								"message": "Movie does not exist",
+								"path": ["movie"],
+								"extensions": {
+									"code": "NOT_FOUND"
+								}
+							}
+						]
 					}`))
 				}),
 			},
 		},
-		debug: &DebugInfo{
-			Variables: true,
-			Query:     true,
-			Plan:      true,
-		},
 		query: `{
-			q(id: "1")
-		}`,
-		expected: `{
-			"q": "hi"
+			movie(id: "1") {
+				id
+				title
+			}
 		}`,
+		errors: gqlerror.List{
+			&gqlerror.Error{
+				Message: "Movie does not exist",
+				Path:    ast.Path{ast.PathName("movie")},
+				Locations: []gqlerror.Location{
+					{Line: 2, Column: 4},
+				},
+				Extensions: map[string]interface{}{
+					"code":         "NOT_FOUND",
+					"selectionSet": `{ movie(id: "1") { id title } }`,
+					"serviceName":  "",
+				},
+			},
+		},
 	}
 
-	f.checkSuccess(t)
-	assert.True(t, called)
-	assert.NotNil(t, f.resp.Extensions["variables"])
+	f.run(t)
+	assert.Equal(t, "null", string(f.resp.Data))
 }
 
-func TestQueryWithBoundaryFields(t *testing.T) {
+func TestQueryErrorNestedPath(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
-
-				type Movie @boundary {
+				schema: `type Movie {
 					id: ID!
 					title: String
+					reviews: [Review!]
+				}
+
+				type Review {
+					text: String
 				}
 
 				type Query {
-					movie(id: ID!): Movie
-					_movie(id: ID!): Movie @boundary
-				}`,
+					movie(id: ID!): Movie!
+				}
+				`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
 						"data": {
 							"movie": {
 								"id": "1",
-								"title": "Test title"
+								"title": "Movie 1",
+								"reviews": [{ "text": "good" }, { "text": null }]
 							}
-						}
-					}
-					`))
+						},
+						"errors": [
+							{
+								"message": "review text unavailable",
+								"path": ["movie", "reviews", 1, "text"],
+								"locations": [{ "line": 1, "column": 42 }],
+								"extensions": {
+									"code": "UNAVAILABLE",
+									"serviceName": "reviews-backend"
+								}
+							}
+						]
+					}`))
 				}),
 			},
-			{
-				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+		},
+		query: `{
+			movie(id: "1") {
+				id
+				title
+				reviews {
+					text
+				}
+			}
+		}`,
+		errors: gqlerror.List{
+			&gqlerror.Error{
+				Message: "review text unavailable",
+				Path:    ast.Path{ast.PathName("movie"), ast.PathName("reviews"), ast.PathIndex(1), ast.PathName("text")},
+				Locations: []gqlerror.Location{
+					{Line: 6, Column: 6},
+				},
+				Extensions: map[string]interface{}{
+					"code":         "UNAVAILABLE",
+					"selectionSet": `{ movie(id: "1") { id title reviews { text } } }`,
+					"serviceName":  "reviews-backend",
+				},
+			},
+		},
+		expected: `{
+			"movie": {
+				"id": "1",
+				"title": "Movie 1",
+				"reviews": [{ "text": "good" }, { "text": null }]
+			}
+		}`,
+	}
 
+	f.run(t)
+}
+
+func TestQueryExecutionErrorOnlyResponse(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
 				type Movie @boundary {
 					id: ID!
-					release: Int
+					title: String
 				}
 
 				type Query {
-					movie(id: ID!): Movie @boundary
+					movies: [Movie!]
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
-						"data": {
-							"_0": {
-								"id": "1",
-								"release": 2007
-							}
-						}
-					}
-					`))
+						"data": null,
+						"errors": [
+							{ "message": "movies unavailable", "path": ["movies"] }
+						]
+					}`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+
+				type Movie implements Node @boundary {
+					id: ID!
+					release: Int
+				}
+
+				type Query {
+					node(id: ID!): Node
+				}`,
+				handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+					assert.Fail(t, "handler should not be called")
 				}),
 			},
 		},
 		query: `{
-			movie(id: "1") {
-				id
+			movies {
 				title
 				release
 			}
 		}`,
-		expected: `{
-			"movie": {
-				"id": "1",
-				"title": "Test title",
-				"release": 2007
-			}
-		}`,
+		errors: gqlerror.List{
+			&gqlerror.Error{
+				Message:   "movies unavailable",
+				Path:      ast.Path{ast.PathName("movies")},
+				Locations: []gqlerror.Location{{Line: 2, Column: 4}},
+				Extensions: map[string]interface{}{
+					"selectionSet": "{ movies { _id: id title } }",
+					"serviceName":  "",
+				},
+			},
+		},
 	}
 
-	f.checkSuccess(t)
+	f.run(t)
+	assert.JSONEq(t, `{ "movies": null }`, string(f.resp.Data))
 }
 
-func TestQueryWithArrayBoundaryFields(t *testing.T) {
+func TestQueryExecutionChildStepPartialError(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
-
+				schema: `directive @boundary on OBJECT
 				type Movie @boundary {
 					id: ID!
 					title: String
 				}
 
 				type Query {
-					randomMovies: [Movie!]!
-					movie(id: ID!): Movie @boundary
+					movies: [Movie!]!
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
 						"data": {
-							"randomMovies": [
-								{
-									"id": "1",
-									"title": "Movie 1"
-								},
-								{
-									"id": "2",
-									"title": "Movie 2"
-								},
-								{
-									"id": "3",
-									"title": "Movie 3"
-								}
+							"movies": [
+								{ "_id": "1", "title": "Movie 1" },
+								{ "_id": "2", "title": "Movie 2" }
 							]
 						}
-					}
-					`))
+					}`))
 				}),
 			},
 			{
-				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
 
-				type Movie @boundary {
+				type Movie implements Node @boundary {
 					id: ID!
 					release: Int
 				}
 
 				type Query {
-					movies(ids: [ID!]): [Movie]! @boundary
+					node(id: ID!): Node
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.Write([]byte(`{
+						"errors": [
+							{ "message": "release not found", "path": ["_1", "release"] }
+						],
 						"data": {
-							"_result": [
-								{
-									"id": "1",
-									"release": 2007
-								},
-								{
-									"id": "2",
-									"release": 2008
-								},
-								{
-									"id": "3",
-									"release": 2009
-								}
-							]
+							"_0": { "_id": "1", "release": 2007 },
+							"_1": { "_id": "2", "release": null }
 						}
-					}
-					`))
+					}`))
 				}),
 			},
 		},
 		query: `{
-			randomMovies {
-				id
+			movies {
 				title
 				release
 			}
 		}`,
-		expected: `{
-			"randomMovies": [
-				{
-					"id": "1",
-					"title": "Movie 1",
-					"release": 2007
-				},
-				{
-					"id": "2",
-					"title": "Movie 2",
-					"release": 2008
+		errors: gqlerror.List{
+			&gqlerror.Error{
+				Message:   "release not found",
+				Path:      ast.Path{ast.PathName("movies"), ast.PathIndex(1), ast.PathName("release")},
+				Locations: []gqlerror.Location{{Line: 4, Column: 5}},
+				Extensions: map[string]interface{}{
+					"selectionSet": "{ _id: id release }",
+					"serviceName":  "",
 				},
-				{
-					"id": "3",
-					"title": "Movie 3",
-					"release": 2009
-				}
-			]
-		}`,
+			},
+		},
 	}
 
-	f.checkSuccess(t)
+	f.run(t)
+	jsonEqWithOrder(t, `{
+		"movies": [
+			{ "title": "Movie 1", "release": 2007 },
+			{ "title": "Movie 2", "release": null }
+		]
+	}`, string(f.resp.Data))
 }
 
-func TestQueryWithArrayBoundaryFieldsAndMultipleChildrenSteps(t *testing.T) {
+func TestQueryExecutionChildStepFailureWithNonNullableField(t *testing.T) {
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
-
+				schema: `directive @boundary on OBJECT
 				type Movie @boundary {
 					id: ID!
 					title: String
 				}
 
 				type Query {
-					randomMovie: Movie!
-					movies(ids: [ID!]!): [Movie]! @boundary
+					movies: [Movie]
+					director: String
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					b, _ := io.ReadAll(r.Body)
-					if strings.Contains(string(b), "randomMovie") {
-						w.Write([]byte(`{
-						"data": {
-							"randomMovie": {
-									"id": "1",
-									"title": "Movie 1"
-							}
-						}
-					}
-					`))
-					} else {
-						w.Write([]byte(`{
+					w.Write([]byte(`{
 						"data": {
-							"_result": [
-								{ "id": 2, "title": "Movie 2" },
-								{ "id": 3, "title": "Movie 3" },
-								{ "id": 4, "title": "Movie 4" }
-							]
+							"movies": [
+								{ "_id": "1", "title": "Movie 1" },
+								{ "_id": "2", "title": "Movie 2" }
+							],
+							"director": "Director"
 						}
-					}
-					`))
-					}
+					}`))
 				}),
 			},
 			{
-				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
 
-				type Movie @boundary {
+				type Movie implements Node @boundary {
 					id: ID!
-					compTitles: [Movie!]!
+					release: Int!
 				}
 
 				type Query {
-					movies(ids: [ID!]): [Movie]! @boundary
+					node(id: ID!): Node
 				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					w.Write([]byte(`{
-						"data": {
-							"_result": [
-								{
-									"_id": "1",
-									"compTitles": [
-										{"id": "2"},
-										{"id": "3"},
-										{"id": "4"}
-									]
-								}
-							]
-						}
-					}
-					`))
+					w.WriteHeader(http.StatusInternalServerError)
 				}),
 			},
 		},
 		query: `{
-			randomMovie {
-				id
+			movies {
 				title
-				compTitles {
-					id
-					title
-				}
+				release
 			}
-		}`,
-		expected: `{
-			"randomMovie":
-				{
-					"id": "1",
-					"title": "Movie 1",
-					"compTitles": [
-						{ "id": 2, "title": "Movie 2" },
-						{ "id": 3, "title": "Movie 3" },
-						{ "id": 4, "title": "Movie 4" }
-					]
-				}
+			director
 		}`,
 	}
+	for i := 0; i < 2; i++ {
+		f.errors = append(f.errors, &gqlerror.Error{
+			Message:   "error decoding response: EOF",
+			Path:      ast.Path{ast.PathName("movies"), ast.PathIndex(i), ast.PathName("release")},
+			Locations: []gqlerror.Location{{Line: 4, Column: 5}},
+			Extensions: map[string]interface{}{
+				"code":         serviceErrorCode,
+				"selectionSet": "{ _id: id release }",
+			},
+		})
+	}
 
-	f.checkSuccess(t)
+	f.run(t)
+	jsonEqWithOrder(t, `{
+		"movies": [null, null],
+		"director": "Director"
+	}`, string(f.resp.Data))
 }
 
-func TestQueryError(t *testing.T) {
+func TestQueryExecutionFillsArgumentDefaultsOfBoundaryFields(t *testing.T) {
+	schema2 := `directive @boundary on OBJECT | FIELD_DEFINITION
+	type Movie @boundary {
+		id: ID!
+		reviews(first: Int = 5, language: String): [String!]!
+	}
+	type Query {
+		movie(id: ID!): Movie @boundary
+	}`
+
 	f := &queryExecutionFixture{
 		services: []testService{
 			{
-				schema: `type Movie {
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+				type Movie @boundary {
 					id: ID!
 					title: String
 				}
-
 				type Query {
-					movie(id: ID!): Movie!
-				}
-				`,
+					movie(id: ID!): Movie
+				}`,
 				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					w.Write([]byte(`{
-						"errors": [
-							{
-								"message": "Movie does not exist",
-								"path": ["movie"],
-								"extensions": {
-									"code": "NOT_FOUND"
-								}
-							}
-						]
-					}`))
+					w.Write([]byte(`{ "data": { "movie": { "_id": "1", "title": "Alien" } } }`))
+				}),
+			},
+			{
+				schema: schema2,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var q map[string]string
+					json.NewDecoder(r.Body).Decode(&q)
+					assertQueriesEqual(t, schema2, `{
+						_0: movie(id: "1") { ... on Movie { _id: id reviews(first: 5) } }
+					}`, q["query"])
+					w.Write([]byte(`{ "data": { "_0": { "_id": "1", "reviews": ["Great"] } } }`))
 				}),
 			},
 		},
-		query: `{
+		query: `query($first: Int, $language: String) {
 			movie(id: "1") {
-				id
 				title
+				reviews(first: $first, language: $language)
 			}
 		}`,
-		errors: gqlerror.List{
-			&gqlerror.Error{
-				Message: "Movie does not exist",
-				Path:    ast.Path{ast.PathName("movie")},
-				Locations: []gqlerror.Location{
-					{Line: 2, Column: 4},
+		expected: `{
+			"movie": { "title": "Alien", "reviews": ["Great"] }
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestInsertionTargetsInNestedLists(t *testing.T) {
+	tests := []struct {
+		name           string
+		insertionPoint []string
+		result         string
+		// expected are the paths of the targets, by ID
+		expected map[string]string
+	}{
+		{
+			name:           "object",
+			insertionPoint: []string{"movie"},
+			result:         `{ "movie": { "_id": "1" } }`,
+			expected:       map[string]string{"1": "movie"},
+		},
+		{
+			name:           "null object",
+			insertionPoint: []string{"movie"},
+			result:         `{ "movie": null }`,
+			expected:       map[string]string{},
+		},
+		{
+			name:           "list",
+			insertionPoint: []string{"movies"},
+			result:         `{ "movies": [{ "_id": "1" }, null, { "_id": "2" }] }`,
+			expected:       map[string]string{"1": "movies[0]", "2": "movies[2]"},
+		},
+		{
+			name:           "list of lists",
+			insertionPoint: []string{"movies"},
+			result:         `{ "movies": [[{ "_id": "1" }], [], null, [null, { "_id": "2" }]] }`,
+			expected:       map[string]string{"1": "movies[0][0]", "2": "movies[3][1]"},
+		},
+		{
+			name:           "list of lists of lists",
+			insertionPoint: []string{"movies"},
+			result:         `{ "movies": [[[{ "_id": "1" }]], [[], [{ "_id": "2" }]]] }`,
+			expected:       map[string]string{"1": "movies[0][0][0]", "2": "movies[1][1][0]"},
+		},
+		{
+			name:           "list of lists under an object",
+			insertionPoint: []string{"shelf", "rows"},
+			result:         `{ "shelf": { "rows": [[{ "_id": "1" }], [{ "_id": "2" }]] } }`,
+			expected:       map[string]string{"1": "shelf.rows[0][0]", "2": "shelf.rows[1][0]"},
+		},
+		{
+			name:           "list of lists under a list",
+			insertionPoint: []string{"shelves", "rows"},
+			result:         `{ "shelves": [{ "rows": [[{ "_id": "1" }, null], null] }, null, { "rows": [[{ "_id": "2" }]] }] }`,
+			expected:       map[string]string{"1": "shelves[0].rows[0][0]", "2": "shelves[2].rows[0][0]"},
+		},
+		{
+			name:           "objects under lists of lists",
+			insertionPoint: []string{"shelves", "rows", "movie"},
+			result:         `{ "shelves": [[{ "rows": [[{ "movie": { "_id": "1" } }], [{ "movie": null }]] }]] }`,
+			expected:       map[string]string{"1": "shelves[0][0].rows[0][0].movie"},
+		},
+		{
+			name:           "missing intermediate field",
+			insertionPoint: []string{"shelves", "rows"},
+			result:         `{ "shelves": [{}, { "rows": null }] }`,
+			expected:       map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, rawJSON := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s (raw JSON: %t)", tt.name, rawJSON), func(t *testing.T) {
+				var data map[string]json.RawMessage
+				require.NoError(t, json.Unmarshal([]byte(tt.result), &data))
+				e := &QueryExecution{rawJSON: rawJSON}
+				result := e.prepareMapForInsertion(tt.insertionPoint, jsonMapToInterfaceMap(data))
+
+				targets := buildInsertionSlice(tt.insertionPoint, result, nil)
+				paths := make(map[string]string, len(targets))
+				for _, target := range targets {
+					paths[target.ID] = target.Path.String()
+					// the targets must be the objects of the result
+					target.Target["inserted"] = target.ID
+				}
+				assert.Equal(t, tt.expected, paths)
+
+				merged, err := json.Marshal(result)
+				require.NoError(t, err)
+				assert.Equal(t, len(tt.expected), strings.Count(string(merged), `"inserted"`))
+			})
+		}
+	}
+}
+
+func TestQueryWithNestedListsOfBoundaryTypes(t *testing.T) {
+	for _, rawJSON := range []bool{false, true} {
+		f := &queryExecutionFixture{
+			rawJSON: rawJSON,
+			services: []testService{
+				{
+					schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+					type Movie @boundary {
+						id: ID!
+						title: String
+					}
+					type Shelf {
+						rows: [[Movie]]
+					}
+					type Query {
+						movieLists: [[Movie!]!]!
+						shelves: [Shelf!]
+					}`,
+					handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						w.Write([]byte(`{
+							"data": {
+								"movieLists": [[{ "_id": "1", "title": "A" }, { "_id": "2", "title": "B" }], [], [{ "_id": "3", "title": "C" }]],
+								"shelves": [{ "rows": [[{ "_id": "1", "title": "A" }, null], null, [{ "_id": "3", "title": "C" }]] }]
+							}
+						}`))
+					}),
 				},
-				Extensions: map[string]interface{}{
-					"code":         "NOT_FOUND",
-					"selectionSet": `{ movie(id: "1") { id title } }`,
-					"serviceName":  "",
+				{
+					schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+					type Movie @boundary {
+						id: ID!
+						release: Int
+					}
+					type Query {
+						movies(ids: [ID!]!): [Movie]! @boundary
+					}`,
+					handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						var q map[string]string
+						json.NewDecoder(r.Body).Decode(&q)
+						var movies []string
+						for _, id := range regexp.MustCompile(`"(\d+)"`).FindAllStringSubmatch(q["query"], -1) {
+							movies = append(movies, fmt.Sprintf(`{ "_id": %q, "release": %s }`, id[1], id[1]))
+						}
+						fmt.Fprintf(w, `{ "data": { "_result": [%s] } }`, strings.Join(movies, ","))
+					}),
 				},
 			},
-			&gqlerror.Error{
-				Message: `got a null response for non-nullable field "movie"`,
-			},
-		},
-	}
+			query: `{
+				movieLists { title release }
+				shelves { rows { title release } }
+			}`,
+			expected: `{
+				"movieLists": [[{ "title": "A", "release": 1 }, { "title": "B", "release": 2 }], [], [{ "title": "C", "release": 3 }]],
+				"shelves": [{ "rows": [[{ "title": "A", "release": 1 }, null], null, [{ "title": "C", "release": 3 }]] }]
+			}`,
+		}
 
-	f.run(t)
+		f.checkSuccess(t)
+	}
 }
 
 type testService struct {
+	name    string
 	schema  string
 	handler http.Handler
+	// lenientNulls adds the service to the lenient null services
+	lenientNulls bool
+	// aliasPrefix is the alias prefix of the service
+	aliasPrefix string
 }
 
 type queryExecutionFixture struct {
@@ -2669,7 +4988,24 @@ type queryExecutionFixture struct {
 	expected  string
 	resp      *graphql.Response
 	debug     *DebugInfo
+	claims    map[string]interface{}
+	joins     []Join
 	errors    gqlerror.List
+
+	errorFormatter ErrorFormatter
+	rawJSON        bool
+	hooks          []ExecutionHooks
+
+	boundaryBatching  bool
+	executionTimeout  time.Duration
+	deadlineBudgeting bool
+	slowQueryLog      *SlowQueryLog
+
+	strictResponseValidation bool
+	errorClassification      *ErrorClassification
+	idempotencyKey           string
+	paginationGuard          PaginationGuardConfig
+	directivePassthrough     DirectivePassthroughConfig
 }
 
 func (f *queryExecutionFixture) checkSuccess(t *testing.T) {
@@ -2682,13 +5018,25 @@ func (f *queryExecutionFixture) checkSuccess(t *testing.T) {
 func (f *queryExecutionFixture) run(t *testing.T) {
 	var services []*Service
 	var schemas []*ast.Schema
+	var lenientNullServices map[string]bool
+	aliasPrefixes := map[string]string{}
 
 	for _, s := range f.services {
 		serv := httptest.NewServer(s.handler)
 		defer serv.Close()
+		if s.lenientNulls {
+			if lenientNullServices == nil {
+				lenientNullServices = map[string]bool{}
+			}
+			lenientNullServices[serv.URL] = true
+		}
+		if s.aliasPrefix != "" {
+			aliasPrefixes[serv.URL] = s.aliasPrefix
+		}
 
 		schema := gqlparser.MustLoadSchema(&ast.Source{Input: s.schema})
 		services = append(services, &Service{
+			Name:       s.name,
 			ServiceURL: serv.URL,
 			Schema:     schema,
 		})
@@ -2698,12 +5046,35 @@ func (f *queryExecutionFixture) run(t *testing.T) {
 
 	merged, err := MergeSchemas(schemas...)
 	require.NoError(t, err)
+	addPassthroughDirectives(merged, services, f.directivePassthrough)
 
 	es := newExecutableSchema(nil, 50, nil, services...)
 	es.MergedSchema = merged
 	es.BoundaryQueries = buildBoundaryQueriesMap(services...)
 	es.Locations = buildFieldURLMap(services...)
 	es.IsBoundary = buildIsBoundaryMap(services...)
+	es.FieldRoles = buildFieldRolesMap(services...)
+	es.Requires = buildRequiresMap(services...)
+	es.joins, err = applyJoins(merged, es.Locations, f.joins)
+	require.NoError(t, err)
+	es.PublicSchema = buildPublicSchema(merged)
+	es.ErrorFormatter = f.errorFormatter
+	es.RawJSONMerge = f.rawJSON
+	es.BoundaryQueryBatching = f.boundaryBatching
+	es.ExecutionTimeout = f.executionTimeout
+	es.DeadlineBudgeting = f.deadlineBudgeting
+	es.SlowQueryLog = f.slowQueryLog
+	es.StrictResponseValidation = f.strictResponseValidation
+	es.ErrorClassification = f.errorClassification
+	es.PaginationGuard = f.paginationGuard
+	es.DirectivePassthrough = f.directivePassthrough
+	es.LenientNullServices = lenientNullServices
+	es.GraphqlClient.Aliases, err = NewServiceAliases(aliasPrefixes, nil, nil)
+	require.NoError(t, err)
+	es.GraphqlClient.Aliases.updateSchemas(services)
+	for _, h := range f.hooks {
+		es.AddExecutionHooks(h)
+	}
 	query := gqlparser.MustLoadQuery(merged, f.query)
 	vars := f.variables
 	if vars == nil {
@@ -2713,6 +5084,12 @@ func (f *queryExecutionFixture) run(t *testing.T) {
 	if f.debug != nil {
 		ctx = context.WithValue(ctx, DebugKey, *f.debug)
 	}
+	if f.claims != nil {
+		ctx = AddClaimsToContext(ctx, f.claims)
+	}
+	if f.idempotencyKey != "" {
+		ctx = AddIdempotencyKeyToContext(ctx, f.idempotencyKey)
+	}
 	f.resp = es.ExecuteQuery(ctx)
 	f.resp.Extensions = graphql.GetExtensions(ctx)
 
@@ -2790,3 +5167,37 @@ func testContextWithVariables(vars map[string]interface{}, op *ast.OperationDefi
 		AllowedRootSubscriptionFields: AllowedFields{AllowAll: true},
 	})
 }
+
+// newTestService starts a service answering the service query of the gateway
+// with its name and schema, see testServiceHandler. It is stopped at the end
+// of the test.
+func newTestService(t testing.TB, name, schema string, handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewServer(testServiceHandler(name, schema, handler))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testServiceHandler returns the handler of a service answering the service
+// query of the gateway with its name and schema. The other requests are
+// passed to the handler, or fail if it's nil.
+func testServiceHandler(name, schema string, handler http.HandlerFunc) http.Handler {
+	response, _ := json.Marshal(map[string]interface{}{
+		"data": map[string]interface{}{
+			"service": map[string]string{"name": name, "version": "1.0", "schema": schema},
+		},
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var req Request
+		if json.Unmarshal(body, &req) == nil && strings.HasPrefix(req.Query, "{ service") {
+			w.Write(response)
+			return
+		}
+		if handler == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		handler(w, r)
+	})
+}
@@ -0,0 +1,241 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	log "github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const (
+	// viaHeader contains the names of the gateways a request went through
+	viaHeader = "X-Bramble-Via"
+	// timeoutHeader contains the time left to the upstream gateway to
+	// execute the request
+	timeoutHeader = "X-Bramble-Timeout"
+)
+
+// gatewayService contains the service information returned by the gateway
+// when it's federated by another Bramble gateway
+type gatewayService struct {
+	Name    string
+	Version string
+	Schema  string
+}
+
+// boundaryQueryFieldName returns the name of the boundary query exposed by
+// the gateway for the given type
+func boundaryQueryFieldName(typeName string) string {
+	return "_" + typeName
+}
+
+// addGatewayServiceFields adds the fields required to federate the gateway to
+// the merged schema: the service query and an array boundary query for every
+// boundary type. The fields are resolved by the gateway itself.
+func addGatewayServiceFields(schema *ast.Schema, locations FieldURLMap) {
+	stringType := ast.NonNullNamedType("String", nil)
+	schema.Types[serviceObjectName] = &ast.Definition{
+		Kind: ast.Object,
+		Name: serviceObjectName,
+		Fields: ast.FieldList{
+			{Name: "name", Type: stringType},
+			{Name: "version", Type: stringType},
+			{Name: "schema", Type: stringType},
+		},
+	}
+	for _, f := range schema.Types[serviceObjectName].Fields {
+		locations.RegisterURL(serviceObjectName, f.Name, internalServiceName)
+	}
+
+	schema.Directives[boundaryDirectiveName] = &ast.DirectiveDefinition{
+		Name:      boundaryDirectiveName,
+		Locations: []ast.DirectiveLocation{ast.LocationObject, ast.LocationFieldDefinition},
+		Position:  &ast.Position{Src: &ast.Source{Name: internalServiceName}},
+	}
+
+	fields := ast.FieldList{
+		{Name: serviceRootFieldName, Type: ast.NonNullNamedType(serviceObjectName, nil)},
+	}
+	locations.RegisterURL(queryObjectName, serviceRootFieldName, internalServiceName)
+
+	var boundaryTypes []string
+	for name, t := range schema.Types {
+		if t.Kind == ast.Object && isBoundaryObject(t) {
+			boundaryTypes = append(boundaryTypes, name)
+		}
+	}
+	sort.Strings(boundaryTypes)
+	for _, name := range boundaryTypes {
+		fields = append(fields, &ast.FieldDefinition{
+			Name: boundaryQueryFieldName(name),
+			Arguments: ast.ArgumentDefinitionList{
+				{Name: "ids", Type: ast.ListType(ast.NonNullNamedType("ID", nil), nil)},
+			},
+			Type:       ast.NonNullListType(ast.NamedType(name, nil), nil),
+			Directives: ast.DirectiveList{{Name: boundaryDirectiveName}},
+		})
+		locations.RegisterURL(queryObjectName, boundaryQueryFieldName(name), internalServiceName)
+	}
+
+	if schema.Query == nil {
+		schema.Query = &ast.Definition{Kind: ast.Object, Name: queryObjectName}
+		schema.Types[queryObjectName] = schema.Query
+	}
+	schema.Query.Fields = append(schema.Query.Fields, fields...)
+}
+
+// resolve resolves the service and boundary queries of the gateway
+func (g *gatewayService) resolve(ctx context.Context, selectionSet ast.SelectionSet, result map[string]interface{}) {
+	var variables map[string]interface{}
+	if graphql.HasOperationContext(ctx) {
+		variables = graphql.GetOperationContext(ctx).Variables
+	}
+
+	for _, f := range selectionSetToFields(selectionSet) {
+		if f.Name == serviceRootFieldName {
+			service := make(map[string]interface{})
+			for _, sf := range selectionSetToFields(f.SelectionSet) {
+				switch sf.Name {
+				case "name":
+					service[sf.Alias] = g.Name
+				case "version":
+					service[sf.Alias] = g.Version
+				case "schema":
+					service[sf.Alias] = g.Schema
+				case "__typename":
+					service[sf.Alias] = serviceObjectName
+				}
+			}
+			result[f.Alias] = service
+			continue
+		}
+
+		if f.Definition == nil || !isBoundaryField(f.Definition) {
+			continue
+		}
+
+		// the objects only contain the id, the other fields are resolved by
+		// the children steps
+		typeName := f.Definition.Type.Name()
+		ids, _ := f.ArgumentMap(variables)["ids"].([]interface{})
+		objects := make([]interface{}, 0, len(ids))
+		for _, id := range ids {
+			obj := make(map[string]interface{})
+			for _, sf := range selectionSetToFields(f.SelectionSet) {
+				switch sf.Name {
+				case idFieldName:
+					obj[sf.Alias] = id
+				case "__typename":
+					obj[sf.Alias] = typeName
+				}
+			}
+			objects = append(objects, obj)
+		}
+		result[f.Alias] = objects
+	}
+}
+
+// gatewayChainMiddleware handles the requests coming from other Bramble
+// gateways: it rejects requests that already went through this gateway
+// (federation loop), applies the deadline of the upstream gateway, and adds
+// the gateway name to the outgoing requests.
+func gatewayChainMiddleware(name string) middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if timeout, err := time.ParseDuration(r.Header.Get(timeoutHeader)); err == nil && timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			if name != "" {
+				var via []string
+				for _, v := range strings.Split(r.Header.Get(viaHeader), ",") {
+					if v = strings.TrimSpace(v); v != "" {
+						via = append(via, v)
+					}
+				}
+				if stringSliceContains(via, name) {
+					log.WithFields(log.Fields{"gateway": name, "via": via}).Error("gateway loop detected")
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusLoopDetected)
+					_ = json.NewEncoder(w).Encode(Response{Errors: GraphqlErrors{{
+						Message: fmt.Sprintf("gateway loop detected: request already went through %s", strings.Join(via, ", ")),
+					}}})
+					return
+				}
+				ctx = AddOutgoingRequestsHeaderToContext(ctx, viaHeader, strings.Join(append(via, name), ", "))
+			}
+
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requestTimeout returns the time left to execute the request, from the
+// context deadline or the client timeout
+func requestTimeout(ctx context.Context, client *http.Client) time.Duration {
+	timeout := client.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); timeout == 0 || left < timeout {
+			timeout = left
+		}
+	}
+	return timeout
+}
+
+// DownstreamExtension contains the extensions returned by a downstream
+// service
+type DownstreamExtension struct {
+	ServiceURL string                 `json:"serviceUrl"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+// downstreamExtensions collects the extensions of the downstream responses
+// (e.g. the debug information of downstream gateways). It is safe for
+// concurrent use.
+type downstreamExtensions struct {
+	mu         sync.Mutex
+	extensions []DownstreamExtension
+}
+
+func addDownstreamExtensionsToContext(ctx context.Context) (context.Context, *downstreamExtensions) {
+	d := &downstreamExtensions{}
+	return context.WithValue(ctx, downstreamExtensionsContextKey, d), d
+}
+
+func getDownstreamExtensionsFromContext(ctx context.Context) *downstreamExtensions {
+	d, _ := ctx.Value(downstreamExtensionsContextKey).(*downstreamExtensions)
+	return d
+}
+
+func (d *downstreamExtensions) add(serviceURL string, extensions map[string]interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.extensions = append(d.extensions, DownstreamExtension{
+		ServiceURL: serviceURL,
+		Extensions: extensions,
+	})
+}
+
+// list returns the collected extensions, ordered by service URL
+func (d *downstreamExtensions) list() []DownstreamExtension {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	res := make([]DownstreamExtension, len(d.extensions))
+	copy(res, d.extensions)
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].ServiceURL < res[j].ServiceURL
+	})
+	return res
+}
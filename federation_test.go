@@ -0,0 +1,151 @@
+package bramble
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFederationTestService returns a service answering the service query
+// with the given schema and any other query with the given response
+func newFederationTestService(t *testing.T, name, schema, response string, headers chan<- http.Header) *httptest.Server {
+	return newTestService(t, name, schema, func(w http.ResponseWriter, r *http.Request) {
+		if headers != nil {
+			headers <- r.Header.Clone()
+		}
+		w.Write([]byte(response))
+	})
+}
+
+func TestGatewayFederation(t *testing.T) {
+	serviceSchema := `
+		directive @boundary on OBJECT | FIELD_DEFINITION
+		type Service {
+			name: String!
+			version: String!
+			schema: String!
+		}
+	`
+	headers := make(chan http.Header, 10)
+	titles := newFederationTestService(t, "titles", serviceSchema+`
+		type Movie @boundary {
+			id: ID!
+			title: String
+		}
+		type Query {
+			service: Service!
+			movies(ids: [ID!]): [Movie]! @boundary
+		}`,
+		`{ "data": { "_result": [{ "_id": "1", "title": "Movie 1" }] } }`,
+		headers,
+	)
+	defer titles.Close()
+	releases := newFederationTestService(t, "releases", serviceSchema+`
+		type Movie @boundary {
+			id: ID!
+			release: Int
+		}
+		type Query {
+			service: Service!
+			movie(id: ID!): Movie @boundary
+		}`,
+		`{ "data": { "_0": { "_id": "1", "release": 2001 } } }`,
+		nil,
+	)
+	defer releases.Close()
+
+	downstreamGateway, err := New(WithServices(titles.URL, releases.URL), WithServiceName("downstream"))
+	require.NoError(t, err)
+	downstream := httptest.NewServer(downstreamGateway)
+	defer downstream.Close()
+
+	random := newFederationTestService(t, "random", serviceSchema+`
+		type Movie @boundary {
+			id: ID!
+		}
+		type Query {
+			service: Service!
+			randomMovie: Movie!
+			movies(ids: [ID!]): [Movie]! @boundary
+		}`,
+		`{ "data": { "randomMovie": { "id": "1" } } }`,
+		nil,
+	)
+	defer random.Close()
+
+	upstream, err := New(WithServices(random.URL, downstream.URL+"/query"), WithServiceName("upstream"))
+	require.NoError(t, err)
+
+	query := func(headers map[string]string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"query": "{ randomMovie { id title release } }"}`))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		upstream.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("query", func(t *testing.T) {
+		rec := query(nil)
+		assert.JSONEq(t, `{
+			"data": {
+				"randomMovie": { "id": "1", "title": "Movie 1", "release": 2001 }
+			}
+		}`, rec.Body.String())
+
+		header := <-headers
+		assert.Equal(t, "upstream, downstream", header.Get(viaHeader))
+		assert.NotEmpty(t, header.Get(timeoutHeader))
+	})
+
+	t.Run("downstream debug info", func(t *testing.T) {
+		rec := query(map[string]string{debugHeader: "plan"})
+		<-headers
+
+		var resp struct {
+			Extensions struct {
+				Downstream []DownstreamExtension `json:"downstream"`
+			} `json:"extensions"`
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		require.Len(t, resp.Extensions.Downstream, 1)
+		assert.Equal(t, downstream.URL+"/query", resp.Extensions.Downstream[0].ServiceURL)
+		assert.Contains(t, resp.Extensions.Downstream[0].Extensions, "plan")
+	})
+
+	t.Run("loop", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, downstream.URL+"/query", strings.NewReader(`{"query": "{ service { name } }"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(viaHeader, "upstream, downstream")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusLoopDetected, res.StatusCode)
+	})
+}
+
+func TestGatewayFederationSelf(t *testing.T) {
+	server := newFederationTestService(t, "gateway", `
+		type Service {
+			name: String!
+			version: String!
+			schema: String!
+		}
+		type Query {
+			service: Service!
+			foo: String
+		}`, "", nil)
+	defer server.Close()
+
+	es := newExecutableSchema(nil, 50, nil, NewService(server.URL))
+	es.ServiceName = "gateway"
+	assert.Error(t, es.UpdateSchema(true))
+	assert.Nil(t, es.MergedSchema)
+}
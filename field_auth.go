@@ -0,0 +1,204 @@
+package bramble
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const defaultRolesClaimName = "roles"
+
+// FieldRolesMap is a mapping type -> field -> roles allowed to access the
+// field, as declared with the @auth directive in the services schemas
+type FieldRolesMap map[string]map[string][]string
+
+// RegisterField adds roles allowed to access the given field
+func (m FieldRolesMap) RegisterField(typeName, fieldName string, roles []string) {
+	if _, ok := m[typeName]; !ok {
+		m[typeName] = make(map[string][]string)
+	}
+
+	for _, r := range roles {
+		if !stringSliceContains(m[typeName][fieldName], r) {
+			m[typeName][fieldName] = append(m[typeName][fieldName], r)
+		}
+	}
+}
+
+// Roles returns the roles allowed to access the given field, or nil if the
+// field is not restricted
+func (m FieldRolesMap) Roles(typeName, fieldName string) []string {
+	return m[typeName][fieldName]
+}
+
+// buildFieldRolesMap collects the @auth(requires: [...]) directives of the
+// services. A directive on a type applies to all the fields of the type
+// defined by that service.
+func buildFieldRolesMap(services ...*Service) FieldRolesMap {
+	result := make(FieldRolesMap)
+	for _, rs := range services {
+		if rs.Schema == nil {
+			continue
+		}
+		for _, t := range rs.Schema.Types {
+			if isGraphQLBuiltinName(t.Name) {
+				continue
+			}
+			typeRoles := authDirectiveRoles(t.Directives)
+			for _, f := range t.Fields {
+				roles := authDirectiveRoles(f.Directives)
+				if roles == nil {
+					roles = typeRoles
+				}
+				if len(roles) > 0 {
+					result.RegisterField(t.Name, f.Name, roles)
+				}
+			}
+		}
+	}
+	return result
+}
+
+func authDirectiveRoles(directives ast.DirectiveList) []string {
+	d := directives.ForName(authDirectiveName)
+	if d == nil {
+		return nil
+	}
+	arg := d.Arguments.ForName("requires")
+	if arg == nil || arg.Value == nil {
+		return nil
+	}
+	if arg.Value.Kind != ast.ListValue {
+		return []string{arg.Value.Raw}
+	}
+	roles := []string{}
+	for _, c := range arg.Value.Children {
+		roles = append(roles, c.Value.Raw)
+	}
+	return roles
+}
+
+// rolesFromContext returns the roles of the caller, read from the given claim
+// (either a string or a list of strings)
+func rolesFromContext(ctx context.Context, claim string) []string {
+	if claim == "" {
+		claim = defaultRolesClaimName
+	}
+	claims, _ := GetClaimsFromContext(ctx)
+	switch roles := claims[claim].(type) {
+	case string:
+		return []string{roles}
+	case []string:
+		return roles
+	case []interface{}:
+		var res []string
+		for _, r := range roles {
+			if s, ok := r.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// filterFieldsByRole removes the fields the caller isn't allowed to access
+// from the operation, and returns a FORBIDDEN error for each of them
+func (s *ExecutableSchema) filterFieldsByRole(ctx context.Context, op *ast.OperationDefinition) gqlerror.List {
+	if len(s.FieldRoles) == 0 {
+		return nil
+	}
+
+	roles := rolesFromContext(ctx, s.RolesClaim)
+	var errs gqlerror.List
+	op.SelectionSet, errs = filterFieldsByRole(s.MergedSchema, s.FieldRoles, roles, nil, strings.Title(string(op.Operation)), op.SelectionSet)
+	return errs
+}
+
+func filterFieldsByRole(schema *ast.Schema, fieldRoles FieldRolesMap, roles []string, path ast.Path, parentType string, ss ast.SelectionSet) (ast.SelectionSet, gqlerror.List) {
+	res := make(ast.SelectionSet, 0, len(ss))
+	var errs gqlerror.List
+	// the spreads of the same fragment are filtered separately (they're
+	// copied when evaluating @skip/@include) but their errors are reported
+	// once
+	spreads := make(map[string]bool)
+
+	for _, selection := range ss {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			fieldPath := append(append(ast.Path{}, path...), ast.PathName(selection.Alias))
+			if !fieldAllowed(schema, fieldRoles, roles, parentType, selection.Name) {
+				errs = append(errs, &gqlerror.Error{
+					Message:    fmt.Sprintf("user does not have the required role to access field %s.%s", parentType, selection.Name),
+					Path:       fieldPath,
+					Extensions: map[string]interface{}{"code": "FORBIDDEN"},
+				})
+				continue
+			}
+			if selection.Definition != nil && len(selection.SelectionSet) > 0 {
+				var ferrs gqlerror.List
+				selection.SelectionSet, ferrs = filterFieldsByRole(schema, fieldRoles, roles, fieldPath, selection.Definition.Type.Name(), selection.SelectionSet)
+				errs = append(errs, ferrs...)
+				// all the sub-fields were removed, the errors are already
+				// reported on the sub-fields
+				if len(selection.SelectionSet) == 0 {
+					continue
+				}
+			}
+			res = append(res, selection)
+		case *ast.InlineFragment:
+			typeCondition := parentType
+			if selection.TypeCondition != "" {
+				typeCondition = selection.TypeCondition
+			}
+			var ferrs gqlerror.List
+			selection.SelectionSet, ferrs = filterFieldsByRole(schema, fieldRoles, roles, path, typeCondition, selection.SelectionSet)
+			res = append(res, selection)
+			errs = append(errs, ferrs...)
+		case *ast.FragmentSpread:
+			var ferrs gqlerror.List
+			selection.Definition.SelectionSet, ferrs = filterFieldsByRole(schema, fieldRoles, roles, path, selection.Definition.TypeCondition, selection.Definition.SelectionSet)
+			res = append(res, selection)
+			if !spreads[selection.Name] {
+				spreads[selection.Name] = true
+				errs = append(errs, ferrs...)
+			}
+		}
+	}
+
+	return res, errs
+}
+
+// fieldAllowed returns whether the caller is allowed to access the field of
+// the type. The field of an interface or union is only allowed if it's
+// allowed on all the possible types.
+func fieldAllowed(schema *ast.Schema, fieldRoles FieldRolesMap, roles []string, typeName, fieldName string) bool {
+	if allowed := fieldRoles.Roles(typeName, fieldName); allowed != nil && !hasAnyRole(roles, allowed) {
+		return false
+	}
+	if schema == nil {
+		return true
+	}
+	def := schema.Types[typeName]
+	if def == nil || !def.IsAbstractType() {
+		return true
+	}
+	for _, t := range schema.PossibleTypes[typeName] {
+		if allowed := fieldRoles.Roles(t.Name, fieldName); allowed != nil && !hasAnyRole(roles, allowed) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAnyRole(roles, allowed []string) bool {
+	for _, r := range roles {
+		if stringSliceContains(allowed, r) {
+			return true
+		}
+	}
+	return false
+}
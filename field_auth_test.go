@@ -0,0 +1,224 @@
+package bramble
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestBuildFieldRolesMap(t *testing.T) {
+	service := &Service{
+		ServiceURL: "http://movies",
+		Schema: loadSchema(`
+			directive @auth(requires: [String!]!) on OBJECT | FIELD_DEFINITION
+
+			enum Role { ADMIN EDITOR }
+			directive @authEnum(requires: [Role!]!) on FIELD_DEFINITION
+
+			type Movie {
+				id: ID!
+				title: String
+				budget: Int @auth(requires: ["ADMIN", "FINANCE"])
+			}
+
+			type Contract @auth(requires: ["LEGAL"]) {
+				id: ID!
+				terms: String @auth(requires: ["ADMIN"])
+			}
+
+			type Query {
+				movie(id: ID!): Movie
+				contract(id: ID!): Contract
+			}`),
+	}
+
+	roles := buildFieldRolesMap(service)
+	assert.Nil(t, roles.Roles("Movie", "title"))
+	assert.Equal(t, []string{"ADMIN", "FINANCE"}, roles.Roles("Movie", "budget"))
+	assert.Equal(t, []string{"LEGAL"}, roles.Roles("Contract", "id"))
+	assert.Equal(t, []string{"ADMIN"}, roles.Roles("Contract", "terms"))
+}
+
+func TestQueryExecutionWithAuthDirective(t *testing.T) {
+	schema := `
+		directive @auth(requires: [Role!]!) on OBJECT | FIELD_DEFINITION
+
+		enum Role {
+			ADMIN
+			FINANCE
+		}
+
+		type Movie {
+			id: ID!
+			title: String
+			budget: Int @auth(requires: [ADMIN, FINANCE])
+			salaries: Salaries
+		}
+
+		type Salaries @auth(requires: [ADMIN]) {
+			director: Int
+			cast: Int
+		}
+
+		type Query {
+			movie(id: ID!): Movie
+		}`
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		assert.NotContains(t, req["query"], "cast")
+		w.Write([]byte(`{
+			"data": {
+				"movie": {
+					"id": "1",
+					"title": "Test title",
+					"budget": 1000
+				}
+			}
+		}`))
+	})
+
+	t.Run("removes forbidden fields", func(t *testing.T) {
+		f := &queryExecutionFixture{
+			services: []testService{{schema: schema, handler: handler}},
+			claims:   map[string]interface{}{"roles": []interface{}{"FINANCE"}},
+			query: `{
+				movie(id: "1") {
+					id
+					title
+					budget
+					salaries {
+						cast
+					}
+				}
+			}`,
+			errors: gqlerror.List{
+				{
+					Message:    "user does not have the required role to access field Salaries.cast",
+					Path:       ast.Path{ast.PathName("movie"), ast.PathName("salaries"), ast.PathName("cast")},
+					Extensions: map[string]interface{}{"code": "FORBIDDEN"},
+				},
+			},
+		}
+		f.run(t)
+		jsonEqWithOrder(t, `{
+			"movie": {
+				"id": "1",
+				"title": "Test title",
+				"budget": 1000
+			}
+		}`, string(f.resp.Data))
+	})
+
+	t.Run("unauthenticated caller", func(t *testing.T) {
+		f := &queryExecutionFixture{
+			services: []testService{{schema: schema, handler: handler}},
+			query: `{
+				movie(id: "1") {
+					id
+					cost: budget
+				}
+			}`,
+			errors: gqlerror.List{
+				{
+					Message:    "user does not have the required role to access field Movie.budget",
+					Path:       ast.Path{ast.PathName("movie"), ast.PathName("cost")},
+					Extensions: map[string]interface{}{"code": "FORBIDDEN"},
+				},
+			},
+		}
+		f.run(t)
+	})
+}
+
+func TestQueryExecutionWithAuthDirectiveOnInterfaceImplementations(t *testing.T) {
+	schema := `
+		directive @auth(requires: [Role!]!) on OBJECT | FIELD_DEFINITION
+
+		enum Role {
+			ADMIN
+		}
+
+		interface Named {
+			id: ID!
+			secret: String
+		}
+
+		type Movie implements Named {
+			id: ID!
+			secret: String @auth(requires: [ADMIN])
+		}
+
+		type Person implements Named {
+			id: ID!
+			secret: String
+		}
+
+		type Query {
+			named(id: ID!): Named
+		}`
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		assert.NotContains(t, req["query"], "secret")
+		w.Write([]byte(`{
+			"data": {
+				"named": {
+					"id": "1"
+				}
+			}
+		}`))
+	})
+
+	t.Run("field selected through the interface", func(t *testing.T) {
+		f := &queryExecutionFixture{
+			services: []testService{{schema: schema, handler: handler}},
+			query: `{
+				named(id: "1") {
+					id
+					secret
+				}
+			}`,
+			errors: gqlerror.List{
+				{
+					Message:    "user does not have the required role to access field Named.secret",
+					Path:       ast.Path{ast.PathName("named"), ast.PathName("secret")},
+					Extensions: map[string]interface{}{"code": "FORBIDDEN"},
+				},
+			},
+		}
+		f.run(t)
+		jsonEqWithOrder(t, `{ "named": { "id": "1" } }`, string(f.resp.Data))
+	})
+
+	t.Run("fragment spread twice", func(t *testing.T) {
+		f := &queryExecutionFixture{
+			services: []testService{{schema: schema, handler: handler}},
+			query: `{
+				named(id: "1") {
+					id
+					...secret
+					...secret
+				}
+			}
+			fragment secret on Named {
+				secret
+			}`,
+			errors: gqlerror.List{
+				{
+					Message:    "user does not have the required role to access field Named.secret",
+					Path:       ast.Path{ast.PathName("named"), ast.PathName("secret")},
+					Extensions: map[string]interface{}{"code": "FORBIDDEN"},
+				},
+			},
+		}
+		f.run(t)
+		jsonEqWithOrder(t, `{ "named": { "id": "1" } }`, string(f.resp.Data))
+	})
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/vektah/gqlparser/v2/ast"
 	"github.com/vektah/gqlparser/v2/formatter"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 func indentPrefix(sb *strings.Builder, level int, suffix ...string) (int, error) {
@@ -54,7 +55,7 @@ func formatSelection(sb *strings.Builder, schema *ast.Schema, vars map[string]in
 			} else {
 				sb.WriteString(selection.Alias)
 			}
-			formatArgumentList(sb, schema, vars, selection.Arguments)
+			formatArgumentList(sb, schema, vars, fieldArguments(selection, vars))
 			for _, d := range selection.Directives {
 				sb.WriteString(" @")
 				sb.WriteString(d.Name)
@@ -86,6 +87,35 @@ func formatArgumentList(sb *strings.Builder, schema *ast.Schema, vars map[string
 	}
 }
 
+// fieldArguments returns the arguments of the field sent to the service. The
+// arguments whose variable wasn't provided get the default value of the
+// merged schema or are left out, like the arguments missing from the
+// operation, so the service applies the same defaults as the gateway.
+func fieldArguments(field *ast.Field, vars map[string]interface{}) ast.ArgumentList {
+	if field.Definition == nil {
+		return field.Arguments
+	}
+
+	var args ast.ArgumentList
+	for _, arg := range field.Arguments {
+		if arg.Value != nil && arg.Value.Kind == ast.Variable {
+			if _, ok := vars[arg.Value.Raw]; !ok {
+				if def := field.Definition.Arguments.ForName(arg.Name); def != nil && def.DefaultValue != nil {
+					args = append(args, &ast.Argument{Name: arg.Name, Value: def.DefaultValue, Position: arg.Position})
+				}
+				continue
+			}
+		}
+		args = append(args, arg)
+	}
+	for _, def := range field.Definition.Arguments {
+		if def.DefaultValue != nil && field.Arguments.ForName(def.Name) == nil {
+			args = append(args, &ast.Argument{Name: def.Name, Value: def.DefaultValue})
+		}
+	}
+	return args
+}
+
 func formatSelectionSet(ctx context.Context, schema *ast.Schema, selection ast.SelectionSet) string {
 	vars := map[string]interface{}{}
 	if reqctx := graphql.GetOperationContext(ctx); reqctx != nil {
@@ -209,157 +239,447 @@ func expandAndFormatVariable(schema *ast.Schema, objectType *ast.Definition, v i
 // marshalResult marshals the result map according to the field order specified
 // in the selection set and the (non)-nullability of fields.
 // If a non-nullable field is null, the null value will bubble up to the next
-// nullable field.
+// nullable field. All the fields are marshalled even when one of their
+// siblings is null, and a gqlerror.List with an error for each null
+// non-nullable field is returned.
 func marshalResult(data interface{}, selectionSet ast.SelectionSet, schema *ast.Schema, currentType *ast.Type) ([]byte, error) {
+	return marshalValidatedResult(data, selectionSet, schema, currentType, nil, nil, nil)
+}
+
+// marshalValidatedResult marshals the result like marshalResult. If the
+// validation is set (strict mode) the values are also validated against their
+// type: the invalid values are replaced with null and an error naming the
+// service of the field is returned for each of them. If lenient is set, the
+// null values of the non-nullable fields of the lenient services don't bubble
+// up. If the encoding is set the result is written in that binary encoding
+// instead of JSON.
+func marshalValidatedResult(data interface{}, selectionSet ast.SelectionSet, schema *ast.Schema, currentType *ast.Type, validation *resultValidation, lenient *lenientNulls, encoding *responseEncoding) ([]byte, error) {
 	var buf bytes.Buffer
-	var err error
+	m := newResultMarshaler(&buf, schema)
+	m.validation = validation
+	m.lenient = lenient
+	m.encoding = encoding
+	if err := m.marshal(data, selectionSet, currentType, nil); err != nil {
+		return buf.Bytes(), err
+	}
+	if len(m.errs) > 0 {
+		return buf.Bytes(), m.errs
+	}
+	return buf.Bytes(), nil
+}
 
-	if currentType == nil {
-		return []byte("null"), fmt.Errorf("currentType is nil, unable to marshal data")
+// resultMarshaler writes the result in a single buffer. Since a null value
+// can bubble up to any nullable parent, the parent value is truncated from the
+// buffer and replaced with null when it happens.
+type resultMarshaler struct {
+	buf    *bytes.Buffer
+	enc    *json.Encoder
+	schema *ast.Schema
+	// errs are the errors of the null non-nullable fields and list elements
+	errs gqlerror.List
+	// validation is set in strict mode, field is the field being marshalled
+	validation *resultValidation
+	field      fieldCoordinate
+	// lenient relaxes the nullability of the fields of the lenient services
+	lenient *lenientNulls
+	// scratch is the buffer of the scalars written by the fast path
+	scratch []byte
+	// encoding is the binary encoding of the result, JSON if nil
+	encoding *responseEncoding
+}
+
+func newResultMarshaler(buf *bytes.Buffer, schema *ast.Schema) *resultMarshaler {
+	return &resultMarshaler{
+		buf:    buf,
+		enc:    json.NewEncoder(buf),
+		schema: schema,
 	}
+}
 
-	if schema.Types[currentType.Name()].Kind == ast.Scalar {
-		if len(selectionSet) != 0 {
-			return []byte("null"), errors.New("non-empty selection set on scalar type")
-		}
+var nullValue = []byte("null")
 
-		b, err := json.Marshal(data)
-		if err != nil {
-			return []byte("null"), err
-		}
-		return b, nil
+// null replaces everything written since start with null
+func (m *resultMarshaler) null(start int, err error) error {
+	m.buf.Truncate(start)
+	m.writeNull()
+	return err
+}
+
+func (m *resultMarshaler) writeNull() {
+	if m.encoding != nil {
+		m.buf.WriteByte(m.encoding.null)
+		return
 	}
+	m.buf.Write(nullValue)
+}
 
-	switch data := data.(type) {
+// isNull returns whether the value written since start is null
+func (m *resultMarshaler) isNull(start int) bool {
+	if m.encoding != nil {
+		return m.buf.Len() == start+1 && m.buf.Bytes()[start] == m.encoding.null
+	}
+	return bytes.Equal(m.buf.Bytes()[start:], nullValue)
+}
+
+// nonNullError records an error for the null non-nullable value if no error
+// was recorded while marshalling it, i.e. the value was null in the result
+// rather than bubbled up.
+func (m *resultMarshaler) nonNullError(errCount int, message string, path ast.Path) {
+	if len(m.errs) == errCount {
+		m.errs = append(m.errs, &gqlerror.Error{
+			Message: message,
+			Path:    appendPath(path),
+		})
+	}
+}
+
+// writeValue writes the value as json.Marshal would. The common scalars are
+// written directly, the other values with the encoder. In a binary encoding,
+// the values are encoded as their JSON.
+func (m *resultMarshaler) writeValue(v interface{}) error {
+	if m.encoding != nil {
+		return m.writeEncoded(v)
+	}
+	var ok bool
+	if m.scratch, ok = appendJSONScalar(m.scratch[:0], v); ok {
+		m.buf.Write(m.scratch)
+		return nil
+	}
+	start := m.buf.Len()
+	if err := m.enc.Encode(v); err != nil {
+		return m.null(start, err)
+	}
+	// remove the newline added by the encoder
+	m.buf.Truncate(m.buf.Len() - 1)
+	return nil
+}
+
+func (m *resultMarshaler) writeEncoded(v interface{}) error {
+	switch v := v.(type) {
+	case nil, bool, string, json.Number:
+		m.encoding.encode(m.buf, v)
+		return nil
 	case json.RawMessage:
-		return data, nil
-	case map[string]interface{}:
-		if data == nil {
-			return []byte("null"), nil
+		return m.writeRaw(v)
+	}
+	var ok bool
+	if m.scratch, ok = appendJSONScalar(m.scratch[:0], v); ok {
+		m.encoding.encode(m.buf, json.Number(m.scratch))
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return m.null(m.buf.Len(), err)
+	}
+	return m.writeRaw(b)
+}
+
+// writeRaw writes a JSON value as is, or transcoded in a binary encoding
+func (m *resultMarshaler) writeRaw(raw []byte) error {
+	if m.encoding == nil {
+		m.buf.Write(raw)
+		return nil
+	}
+	start := m.buf.Len()
+	if err := m.encoding.encodeJSON(m.buf, raw); err != nil {
+		return m.null(start, err)
+	}
+	return nil
+}
+
+// marshal writes the data of the given type. The errors of null non-nullable
+// values are recorded in m.errs, the returned error is only set if the data
+// can't be marshalled at all.
+// The path shares its backing array with the paths of the siblings, it must be
+// copied to be kept.
+func (m *resultMarshaler) marshal(data interface{}, selectionSet ast.SelectionSet, currentType *ast.Type, path ast.Path) error {
+	start := m.buf.Len()
+
+	if currentType == nil {
+		return m.null(start, fmt.Errorf("currentType is nil, unable to marshal data"))
+	}
+
+	if raw, ok := data.(json.RawMessage); ok && m.validation != nil {
+		// raw values are decoded to be validated, the valid values are
+		// written as returned by the service
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return m.invalidValue(path, fmt.Errorf("invalid JSON: %w", err))
+		}
+		errCount := len(m.errs)
+		if err := m.marshal(value, selectionSet, currentType, path); err != nil {
+			return err
+		}
+		if len(m.errs) == errCount {
+			m.buf.Truncate(start)
+			return m.writeRaw(raw)
 		}
+		return nil
+	}
 
-		def := schema.Types[getInnerTypeName(currentType)]
+	if currentType.Elem == nil {
+		def := m.schema.Types[currentType.Name()]
 		if def == nil {
-			return []byte("null"), fmt.Errorf("could not find type %q in schema", currentType.String())
+			return m.null(start, fmt.Errorf("could not find type %q in schema", currentType.String()))
 		}
-
-		buf.WriteString("{")
-		fields := selectionSetToFieldsWithTypeCondition(selectionSet, "")
-		for i, fieldWithOptionalTypeCondition := range fields {
-			field := fieldWithOptionalTypeCondition.field
-			if fieldWithOptionalTypeCondition.typeCondition != "" {
-				typeCondition := fieldWithOptionalTypeCondition.typeCondition
-				def = schema.Types[typeCondition]
-				if def == nil {
-					errMsg := fmt.Sprintf("could not find field %q in typeCondition %q in fragment spread", field.Name, typeCondition)
-					return []byte("null"), errors.New(errMsg)
-				}
-			}
-			var fieldType *ast.Type
-			if field.Name == "__typename" {
-				fieldType = ast.NamedType("String", nil)
-			} else if fieldDef := def.Fields.ForName(field.Name); fieldDef != nil {
-				fieldType = fieldDef.Type
+		if def.Kind == ast.Scalar || (def.Kind == ast.Enum && m.validation != nil) {
+			if len(selectionSet) != 0 {
+				return m.null(start, errors.New("non-empty selection set on scalar type"))
 			}
-			if fieldType == nil {
-				return []byte("null"), fmt.Errorf("could not find field %q in %q", field.Name, currentType.String())
-			}
-
-			key, fieldErr := json.Marshal(field.Alias)
-			if fieldErr != nil {
-				return nil, fieldErr
-			}
-			buf.Write(key)
-			buf.WriteString(`:`)
-			d, ok := data[field.Alias]
-			var value []byte
-			if !ok {
-				value = []byte("null")
-			} else {
-				value, fieldErr = marshalResult(d, field.SelectionSet, schema, fieldType)
-			}
-			if fieldType.NonNull && bytes.Equal(value, []byte("null")) {
-				if fieldErr == nil {
-					fieldErr = fmt.Errorf("got a null response for non-nullable field %q", field.Alias)
+			if m.validation != nil && data != nil {
+				if err := validateLeafValue(def, data); err != nil {
+					return m.invalidValue(path, err)
 				}
-				return []byte("null"), fieldErr
-			}
-			buf.Write(value)
-			if i != len(fields)-1 {
-				buf.WriteString(",")
 			}
 
-			if fieldErr != nil {
-				err = fieldErr
-			}
+			return m.writeValue(data)
 		}
-		buf.WriteString("}")
-	case []map[string]interface{}:
+	}
+
+	switch data := data.(type) {
+	case nil:
+		m.writeNull()
+		return nil
+	case json.RawMessage:
+		return m.writeRaw(data)
+	case map[string]interface{}:
 		if data == nil {
-			return []byte("null"), nil
+			return m.null(start, nil)
+		}
+		if currentType.Elem != nil {
+			if m.validation != nil {
+				return m.invalidValue(path, fmt.Errorf("expected %s, got an object", currentType.String()))
+			}
+			return m.null(start, fmt.Errorf("expected a list for type %q", currentType.String()))
 		}
 
-		elemType := currentType.Elem
-		if elemType == nil {
-			return []byte("null"), fmt.Errorf("type %q should be a list but element is nil", currentType.String())
+		return m.marshalObject(data, selectionSet, currentType, path)
+	case []map[string]interface{}:
+		if data == nil {
+			return m.null(start, nil)
 		}
 
-		buf.WriteString("[")
+		elems := make([]interface{}, len(data))
 		for i, e := range data {
-			b, eltErr := marshalResult(e, selectionSet, schema, currentType.Elem)
-			if eltErr != nil {
-				err = eltErr
-			}
-			if elemType.NonNull && bytes.Equal(b, []byte("null")) {
-				if eltErr == nil {
-					eltErr = fmt.Errorf("got null element in list of non-null elements")
-				}
-				return []byte("null"), eltErr
-			}
-			buf.Write(b)
-			if i != len(data)-1 {
-				buf.WriteString(",")
-			}
+			elems[i] = e
 		}
-		buf.WriteString("]")
+		return m.marshalList(elems, selectionSet, currentType, path)
 	case []interface{}:
 		if data == nil {
-			return []byte("null"), nil
+			return m.null(start, nil)
+		}
+		if currentType.Elem == nil && m.validation != nil {
+			return m.invalidValue(path, fmt.Errorf("expected %s, got a list", currentType.String()))
 		}
 
-		elemType := currentType.Elem
-		if elemType == nil {
-			return []byte("null"), fmt.Errorf("type %q should be a list but element is nil", currentType.String())
+		return m.marshalList(data, selectionSet, currentType, path)
+	default:
+		if m.validation != nil {
+			return m.invalidValue(path, fmt.Errorf("expected %s, got %s", currentType.String(), describeJSONValue(data)))
 		}
+		return m.writeValue(data)
+	}
+}
 
-		buf.WriteString("[")
-		for i, value := range data {
-			valueBytes, valueErr := marshalResult(value, selectionSet, schema, currentType.Elem)
-			if valueErr != nil {
-				err = valueErr
-			}
-			if elemType.NonNull && bytes.Equal(valueBytes, []byte("null")) {
-				if valueErr == nil {
-					valueErr = fmt.Errorf("got null element in list of non-null elements")
+func (m *resultMarshaler) marshalObject(data map[string]interface{}, selectionSet ast.SelectionSet, currentType *ast.Type, path ast.Path) error {
+	start := m.buf.Len()
+
+	objectDef := m.schema.Types[currentType.Name()]
+	if objectDef == nil {
+		return m.null(start, fmt.Errorf("could not find type %q in schema", currentType.String()))
+	}
+
+	// the type of the object is known if the planner injected (or the client
+	// selected) its __typename, the fragments on other types are skipped then
+	typename := insertionTargetTypename(data)
+
+	// the fields to write are collected first, the binary encodings need
+	// their number
+	fields := selectionSetToFieldsWithTypeCondition(selectionSet, "")
+	objectFields := make([]objectField, 0, len(fields))
+	// the fields with the same alias (e.g. in fragments on different
+	// types) are written once, with their selection sets merged
+	written := make(map[string]bool, len(fields))
+	for i, fieldWithOptionalTypeCondition := range fields {
+		field := fieldWithOptionalTypeCondition.field
+		if written[field.Alias] {
+			continue
+		}
+		def := objectDef
+		if fieldWithOptionalTypeCondition.typeCondition != "" {
+			typeCondition := fieldWithOptionalTypeCondition.typeCondition
+			if typename != "" {
+				if !m.fragmentApplies(typeCondition, typename) {
+					continue
 				}
-				return []byte("null"), valueErr
+			} else if _, ok := data[field.Alias]; !ok && typeCondition != objectDef.Name && objectDef.IsAbstractType() {
+				// the fields of the fragments on the other types of an
+				// abstract type aren't in the object
+				continue
 			}
-			buf.Write(valueBytes)
-			if i != len(data)-1 {
-				buf.WriteString(",")
+			def = m.schema.Types[typeCondition]
+			if def == nil {
+				errMsg := fmt.Sprintf("could not find field %q in typeCondition %q in fragment spread", field.Name, typeCondition)
+				return m.null(start, errors.New(errMsg))
 			}
 		}
-		buf.WriteString("]")
-	default:
-		b, err := json.Marshal(data)
-		if err != nil {
-			return []byte("null"), err
+		var fieldType *ast.Type
+		if field.Name == "__typename" {
+			fieldType = ast.NamedType("String", nil)
+		} else if fieldDef := def.Fields.ForName(field.Name); fieldDef != nil {
+			fieldType = fieldDef.Type
+		}
+		if fieldType == nil {
+			return m.null(start, fmt.Errorf("could not find field %q in %q", field.Name, currentType.String()))
 		}
 
-		return b, nil
+		written[field.Alias] = true
+		selectionSet := field.SelectionSet
+		for _, other := range fields[i+1:] {
+			if other.field.Alias == field.Alias && len(other.field.SelectionSet) > 0 {
+				selectionSet = append(selectionSet[:len(selectionSet):len(selectionSet)], other.field.SelectionSet...)
+			}
+		}
+		objectFields = append(objectFields, objectField{field: field, def: def, fieldType: fieldType, selectionSet: selectionSet})
+	}
+
+	// the object is null if one of its non-nullable fields is null, the other
+	// fields are still marshalled to report all their errors
+	isNull := false
+	m.beginObject(len(objectFields))
+	for i, f := range objectFields {
+		// aliases are GraphQL names, they don't need to be escaped. The
+		// client aliases escaped by the planner are unescaped.
+		alias := unescapeAlias(f.field.Alias)
+		m.writeKey(i, alias)
+		fieldPath := append(path, ast.PathName(alias))
+		fieldStart, errCount := m.buf.Len(), len(m.errs)
+		parentField := m.field
+		m.field = fieldCoordinate{typename: f.def.Name, field: f.field.Name}
+		if d, ok := data[f.field.Alias]; !ok {
+			if m.validation != nil && f.fieldType.NonNull {
+				m.invalidValue(fieldPath, errors.New("the non-nullable field is missing"))
+			} else {
+				m.writeNull()
+			}
+		} else if err := m.marshal(d, f.selectionSet, f.fieldType, fieldPath); err != nil {
+			return m.null(start, err)
+		}
+		m.field = parentField
+		if f.fieldType.NonNull && m.isNull(fieldStart) && !m.relaxNull(fieldCoordinate{typename: f.def.Name, field: f.field.Name}, errCount, fieldPath) {
+			m.nonNullError(errCount, fmt.Sprintf("got a null response for non-nullable field %q", alias), fieldPath)
+			isNull = true
+		}
+	}
+	m.endObject()
+
+	if isNull {
+		return m.null(start, nil)
 	}
+	return nil
+}
+
+// objectField is a field of an object written by marshalObject
+type objectField struct {
+	field        *ast.Field
+	def          *ast.Definition
+	fieldType    *ast.Type
+	selectionSet ast.SelectionSet
+}
+
+func (m *resultMarshaler) beginObject(n int) {
+	if m.encoding != nil {
+		m.encoding.writeMapHeader(m.buf, n)
+		return
+	}
+	m.buf.WriteByte('{')
+}
+
+// writeKey writes the key of the i-th field of an object
+func (m *resultMarshaler) writeKey(i int, key string) {
+	if m.encoding != nil {
+		m.encoding.encode(m.buf, key)
+		return
+	}
+	if i > 0 {
+		m.buf.WriteByte(',')
+	}
+	m.buf.WriteByte('"')
+	m.buf.WriteString(key)
+	m.buf.WriteString(`":`)
+}
+
+func (m *resultMarshaler) endObject() {
+	if m.encoding == nil {
+		m.buf.WriteByte('}')
+	}
+}
+
+func (m *resultMarshaler) beginList(n int) {
+	if m.encoding != nil {
+		m.encoding.writeArrayHeader(m.buf, n)
+		return
+	}
+	m.buf.WriteByte('[')
+}
+
+// writeElementSeparator writes the separator before the i-th element of a
+// list
+func (m *resultMarshaler) writeElementSeparator(i int) {
+	if m.encoding == nil && i > 0 {
+		m.buf.WriteByte(',')
+	}
+}
+
+func (m *resultMarshaler) endList() {
+	if m.encoding == nil {
+		m.buf.WriteByte(']')
+	}
+}
+
+// fragmentApplies returns whether a fragment on the type condition applies to
+// the objects of the type
+func (m *resultMarshaler) fragmentApplies(typeCondition, typename string) bool {
+	if typeCondition == typename {
+		return true
+	}
+	def := m.schema.Types[typeCondition]
+	if def == nil || !def.IsAbstractType() {
+		return false
+	}
+	return ast.DefinitionList(m.schema.GetPossibleTypes(def)).ForName(typename) != nil
+}
 
-	return buf.Bytes(), err
+func (m *resultMarshaler) marshalList(data []interface{}, selectionSet ast.SelectionSet, currentType *ast.Type, path ast.Path) error {
+	start := m.buf.Len()
+
+	elemType := currentType.Elem
+	if elemType == nil {
+		return m.null(start, fmt.Errorf("type %q should be a list but element is nil", currentType.String()))
+	}
+
+	// as for objects, all the elements are marshalled even if the list is
+	// null because of one of them
+	isNull := false
+	m.beginList(len(data))
+	for i, value := range data {
+		m.writeElementSeparator(i)
+		valuePath := append(path, ast.PathIndex(i))
+		valueStart, errCount := m.buf.Len(), len(m.errs)
+		if err := m.marshal(value, selectionSet, elemType, valuePath); err != nil {
+			return m.null(start, err)
+		}
+		if elemType.NonNull && m.isNull(valueStart) && !m.relaxNull(m.field, errCount, valuePath) {
+			m.nonNullError(errCount, "got null element in list of non-null elements", valuePath)
+			isNull = true
+		}
+	}
+	m.endList()
+
+	if isNull {
+		return m.null(start, nil)
+	}
+	return nil
 }
 
 type fieldWithOptionalTypeCondition struct {
@@ -2,12 +2,18 @@ package bramble
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/vektah/gqlparser/v2"
 	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 func TestFormatSelectionSetVerySimple(t *testing.T) {
@@ -519,6 +525,21 @@ func TestMarshalResult(t *testing.T) {
 		jsonEqWithOrder(t, `null`, string(res))
 	})
 
+	t.Run("raw and decoded values", func(t *testing.T) {
+		r := map[string]interface{}{
+			"movies": []interface{}{
+				map[string]interface{}{
+					"id":         json.RawMessage(`"1"`),
+					"title":      "<b>Source Code</b>",
+					"compTitles": json.RawMessage(`[{"id":"2"}]`),
+				},
+			},
+		}
+		res, err := marshalResult(r, query.Operations[0].SelectionSet, schema, &ast.Type{NamedType: "Query"})
+		assert.NoError(t, err)
+		assert.Equal(t, `{"movies":[{"id":"1","title":"\u003cb\u003eSource Code\u003c/b\u003e","compTitles":[{"id":"2"}]}]}`, string(res))
+	})
+
 	t.Run("object scalar", func(t *testing.T) {
 		query := gqlparser.MustLoadQuery(schema, `query { complexValue }`)
 		var r map[string]interface{}
@@ -539,3 +560,487 @@ func TestMarshalResult(t *testing.T) {
 		}`, string(res))
 	})
 }
+
+func TestMarshalResultFragmentsWithTypename(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+	interface Named { name: String! }
+	type Movie implements Named { name: String! title: String! }
+	type Book implements Named { name: String! title: String }
+	type Query { search: [Named!]! }
+	`})
+	query := gqlparser.MustLoadQuery(schema, `{
+		search {
+			... on Named { name }
+			... on Movie { kind: __typename title }
+			... on Book { _typename: __typename }
+		}
+	}`)
+
+	var r map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"search": [
+			{ "_typename": "Movie", "name": "Alien", "kind": "Movie", "title": "Alien" },
+			{ "_typename": "Book", "name": "Dune", "title": "Dune" }
+		]
+	}`), &r)
+	require.NoError(t, err)
+	res, err := marshalResult(r, query.Operations[0].SelectionSet, schema, &ast.Type{NamedType: "Query"})
+	assert.NoError(t, err)
+	jsonEqWithOrder(t, `{
+		"search": [
+			{ "name": "Alien", "kind": "Movie", "title": "Alien" },
+			{ "name": "Dune", "_typename": "Book" }
+		]
+	}`, string(res))
+}
+
+func TestMarshalResultNullBubbling(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+	type Movie {
+		id: ID!
+		title: String!
+		ratings: [[Int!]!]
+	}
+
+	type Query {
+		movie: Movie
+		movies: [Movie]
+		matrix: [[Int!]]
+		nonNullMatrix: [[Int!]!]
+	}
+	`})
+
+	marshal := func(t *testing.T, query string, data string) (string, []string) {
+		t.Helper()
+		op := gqlparser.MustLoadQuery(schema, query)
+		var r map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(data), &r))
+		res, err := marshalResult(r, op.Operations[0].SelectionSet, schema, &ast.Type{NamedType: "Query"})
+		var paths []string
+		if err != nil {
+			errs, ok := err.(gqlerror.List)
+			require.True(t, ok, "unexpected error: %s", err)
+			for _, e := range errs {
+				paths = append(paths, e.Path.String())
+			}
+		}
+		return string(res), paths
+	}
+
+	t.Run("all null sibling fields are reported", func(t *testing.T) {
+		res, paths := marshal(t, `{ movie { id title } }`, `{ "movie": { "id": null, "title": null } }`)
+		assert.Equal(t, `{"movie":null}`, res)
+		assert.Equal(t, []string{"movie.id", "movie.title"}, paths)
+	})
+
+	t.Run("siblings of a null field are still marshalled", func(t *testing.T) {
+		res, paths := marshal(t, `{ movies { id title } }`, `{ "movies": [{ "id": null }, { "id": "2", "title": null }, { "id": "3", "title": "Alien" }] }`)
+		assert.Equal(t, `{"movies":[null,null,{"id":"3","title":"Alien"}]}`, res)
+		assert.Equal(t, []string{"movies[0].id", "movies[0].title", "movies[1].title"}, paths)
+	})
+
+	t.Run("null element in list of lists", func(t *testing.T) {
+		res, paths := marshal(t, `{ matrix }`, `{ "matrix": [[1, 2], [3, null], [null]] }`)
+		assert.Equal(t, `{"matrix":[[1,2],null,null]}`, res)
+		assert.Equal(t, []string{"matrix[1][1]", "matrix[2][0]"}, paths)
+	})
+
+	t.Run("null inner list in list of non-null lists", func(t *testing.T) {
+		res, paths := marshal(t, `{ nonNullMatrix }`, `{ "nonNullMatrix": [[1], null, [2, null]] }`)
+		assert.Equal(t, `{"nonNullMatrix":null}`, res)
+		assert.Equal(t, []string{"nonNullMatrix[1]", "nonNullMatrix[2][1]"}, paths)
+	})
+
+	t.Run("list of lists in object", func(t *testing.T) {
+		res, paths := marshal(t, `{ movie { id ratings } }`, `{ "movie": { "id": "1", "ratings": [[4, 5], [null]] } }`)
+		assert.Equal(t, `{"movie":{"id":"1","ratings":null}}`, res)
+		assert.Equal(t, []string{"movie.ratings[1][0]"}, paths)
+	})
+}
+
+// TestMarshalResultRandomNulls compares the result of marshalResult on
+// randomly generated results with a straightforward implementation of the
+// nullability rules of the spec (section 6.4.4 "Handling Field Errors").
+func TestMarshalResultRandomNulls(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+	type Node {
+		id: ID!
+		name: String
+		tags: [String!]
+		matrix: [[Int!]!]
+		child: Node
+		requiredChild: Node!
+		children: [Node!]!
+		grid: [[Node]!]
+	}
+
+	type Query {
+		node: Node
+		requiredNode: Node!
+		nodes: [[Node!]]
+	}
+	`})
+	nodeFields := "id name tags matrix"
+	query := gqlparser.MustLoadQuery(schema, fmt.Sprintf(`{
+		node { %[1]s child { %[1]s } requiredChild { %[1]s } children { %[1]s } }
+		requiredNode { %[1]s grid { %[1]s requiredChild { %[1]s } } }
+		nodes { %[1]s children { %[1]s child { %[1]s } } }
+	}`, nodeFields))
+	selectionSet := query.Operations[0].SelectionSet
+	queryType := &ast.Type{NamedType: "Query"}
+
+	for seed := int64(0); seed < 500; seed++ {
+		rnd := rand.New(rand.NewSource(seed))
+		data := randomResult(rnd, schema, selectionSet, queryType)
+
+		expected, expectedPaths := completeResult(schema, data, selectionSet, queryType, nil)
+		expectedJSON, err := json.Marshal(expected)
+		require.NoError(t, err)
+		sort.Strings(expectedPaths)
+
+		res, err := marshalResult(data, selectionSet, schema, queryType)
+		var paths []string
+		if err != nil {
+			errs, ok := err.(gqlerror.List)
+			require.True(t, ok, "seed %d: unexpected error: %s", seed, err)
+			for _, e := range errs {
+				paths = append(paths, e.Path.String())
+			}
+		}
+		sort.Strings(paths)
+
+		require.JSONEq(t, string(expectedJSON), string(res), "seed %d", seed)
+		require.Equal(t, expectedPaths, paths, "seed %d", seed)
+	}
+}
+
+// randomResult generates a result for the selection set with random nulls,
+// including for non-nullable fields and list elements
+func randomResult(rnd *rand.Rand, schema *ast.Schema, selectionSet ast.SelectionSet, t *ast.Type) interface{} {
+	if rnd.Intn(8) == 0 {
+		return nil
+	}
+	if t.Elem != nil {
+		list := make([]interface{}, rnd.Intn(4))
+		for i := range list {
+			list[i] = randomResult(rnd, schema, selectionSet, t.Elem)
+		}
+		return list
+	}
+	if schema.Types[t.Name()].Kind == ast.Scalar {
+		if t.Name() == "Int" {
+			return float64(rnd.Intn(100))
+		}
+		return fmt.Sprintf("s%d", rnd.Intn(100))
+	}
+	obj := map[string]interface{}{}
+	for _, f := range selectionSetToFields(selectionSet) {
+		if rnd.Intn(16) == 0 {
+			continue
+		}
+		obj[f.Alias] = randomResult(rnd, schema, f.SelectionSet, f.Definition.Type)
+	}
+	return obj
+}
+
+// completeResult returns the value of the result after the null values of
+// non-nullable fields and list elements are propagated to their parents, along
+// with the paths of the errors
+func completeResult(schema *ast.Schema, data interface{}, selectionSet ast.SelectionSet, t *ast.Type, path ast.Path) (interface{}, []string) {
+	if data == nil {
+		return nil, nil
+	}
+	var errs []string
+	complete := func(value interface{}, ss ast.SelectionSet, valueType *ast.Type, valuePath ast.Path) (interface{}, bool) {
+		result, valueErrs := completeResult(schema, value, ss, valueType, valuePath)
+		errs = append(errs, valueErrs...)
+		if result == nil && valueType.NonNull {
+			if len(valueErrs) == 0 {
+				errs = append(errs, valuePath.String())
+			}
+			return nil, true
+		}
+		return result, false
+	}
+
+	isNull := false
+	switch data := data.(type) {
+	case []interface{}:
+		list := make([]interface{}, len(data))
+		for i, elem := range data {
+			var elemNull bool
+			list[i], elemNull = complete(elem, selectionSet, t.Elem, append(path[:len(path):len(path)], ast.PathIndex(i)))
+			isNull = isNull || elemNull
+		}
+		if !isNull {
+			return list, errs
+		}
+	case map[string]interface{}:
+		obj := map[string]interface{}{}
+		for _, f := range selectionSetToFields(selectionSet) {
+			var fieldNull bool
+			obj[f.Alias], fieldNull = complete(data[f.Alias], f.SelectionSet, f.Definition.Type, append(path[:len(path):len(path)], ast.PathName(f.Alias)))
+			isNull = isNull || fieldNull
+		}
+		if !isNull {
+			return obj, errs
+		}
+	default:
+		return data, nil
+	}
+	return nil, errs
+}
+
+func BenchmarkMarshalResult(b *testing.B) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+	type Person {
+		name: String!
+	}
+
+	type Movie {
+		id: ID!
+		title: String
+		tags: [String!]!
+		cast: [Person!]!
+	}
+
+	type Query {
+		movies: [Movie!]!
+	}
+	`})
+	query := gqlparser.MustLoadQuery(schema, `{ movies { id title tags cast { name } } }`)
+
+	var movies []string
+	for i := 0; i < 1000; i++ {
+		movies = append(movies, fmt.Sprintf(`{ "id": "%d", "title": "Movie %d", "tags": ["a", "b"], "cast": [{ "name": "A" }, { "name": "B" }, { "name": "C" }] }`, i, i))
+	}
+	var data map[string]interface{}
+	require.NoError(b, json.Unmarshal([]byte(`{ "movies": [`+strings.Join(movies, ",")+`] }`), &data))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := marshalResult(data, query.Operations[0].SelectionSet, schema, &ast.Type{NamedType: "Query"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMarshalResultFragmentsOnAbstractType(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+	interface Named { name: String! }
+	type Movie implements Named { name: String! posterUrl: String! }
+	type Book implements Named { name: String! pages: Int! }
+	type Query { search: [Named!]! }
+	`})
+	query := gqlparser.MustLoadQuery(schema, `{
+		search {
+			name
+			... on Movie { name posterUrl }
+			... on Book { pages name }
+		}
+	}`)
+
+	var r map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"search": [
+			{ "name": "Alien", "posterUrl": "alien.png" },
+			{ "name": "Dune", "pages": 412 }
+		]
+	}`), &r)
+	require.NoError(t, err)
+	res, err := marshalResult(r, query.Operations[0].SelectionSet, schema, &ast.Type{NamedType: "Query"})
+	assert.NoError(t, err)
+	jsonEqWithOrder(t, `{
+		"search": [
+			{ "name": "Alien", "posterUrl": "alien.png" },
+			{ "name": "Dune", "pages": 412 }
+		]
+	}`, string(res))
+}
+
+func TestMarshalResultStrictValidation(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+	enum Genre { DRAMA COMEDY }
+	scalar Date
+	type Movie {
+		id: ID!
+		title: String!
+		release: Int
+		rating: Float
+		released: Boolean
+		genre: Genre
+		date: Date
+		tags: [String!]
+		director: Person
+	}
+	type Person { name: String }
+	type Query { movie: Movie movies: [Movie!] }
+	`})
+	validation := &resultValidation{
+		locations: FieldURLMap{"Movie.title": "http://movies", "Movie.release": "http://movies", "Movie.genre": "http://movies", "Query.movie": "http://movies"},
+		services:  map[string]*Service{"http://movies": {Name: "movies", ServiceURL: "http://movies"}},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		data     string
+		expected string
+		errors   gqlerror.List
+	}{
+		{
+			name:     "valid values",
+			query:    `{ movie { id title release rating released genre date tags director { name } } }`,
+			data:     `{ "movie": { "id": 1, "title": "Alien", "release": 1979, "rating": 8.5, "released": true, "genre": "DRAMA", "date": { "any": "value" }, "tags": ["scifi"], "director": { "name": "Ridley Scott" } } }`,
+			expected: `{ "movie": { "id": 1, "title": "Alien", "release": 1979, "rating": 8.5, "released": true, "genre": "DRAMA", "date": { "any": "value" }, "tags": ["scifi"], "director": { "name": "Ridley Scott" } } }`,
+		},
+		{
+			name:     "invalid scalars and enums",
+			query:    `{ movie { release genre rating released } }`,
+			data:     `{ "movie": { "release": "1979", "genre": "HORROR", "rating": "high", "released": 1 } }`,
+			expected: `{ "movie": { "release": null, "genre": null, "rating": null, "released": null } }`,
+			errors: gqlerror.List{
+				{
+					Message:    `service "movies" returned an invalid value for field Movie.release: expected Int, got a string`,
+					Path:       ast.Path{ast.PathName("movie"), ast.PathName("release")},
+					Extensions: map[string]interface{}{"code": invalidResponseCode, "serviceName": "movies", "serviceUrl": "http://movies"},
+				},
+				{
+					Message:    `service "movies" returned an invalid value for field Movie.genre: "HORROR" is not a value of Genre`,
+					Path:       ast.Path{ast.PathName("movie"), ast.PathName("genre")},
+					Extensions: map[string]interface{}{"code": invalidResponseCode, "serviceName": "movies", "serviceUrl": "http://movies"},
+				},
+				{
+					Message:    `invalid value for field Movie.rating: expected Float, got a string`,
+					Path:       ast.Path{ast.PathName("movie"), ast.PathName("rating")},
+					Extensions: map[string]interface{}{"code": invalidResponseCode},
+				},
+				{
+					Message:    `invalid value for field Movie.released: expected Boolean, got an integer`,
+					Path:       ast.Path{ast.PathName("movie"), ast.PathName("released")},
+					Extensions: map[string]interface{}{"code": invalidResponseCode},
+				},
+			},
+		},
+		{
+			name:     "invalid values bubble up to the nullable parent",
+			query:    `{ movie { title release } }`,
+			data:     `{ "movie": { "title": 42, "release": 2147483648 } }`,
+			expected: `{ "movie": null }`,
+			errors: gqlerror.List{
+				{
+					Message:    `service "movies" returned an invalid value for field Movie.title: expected String, got an integer`,
+					Path:       ast.Path{ast.PathName("movie"), ast.PathName("title")},
+					Extensions: map[string]interface{}{"code": invalidResponseCode, "serviceName": "movies", "serviceUrl": "http://movies"},
+				},
+				{
+					Message:    `service "movies" returned an invalid value for field Movie.release: the integer is out of the Int range`,
+					Path:       ast.Path{ast.PathName("movie"), ast.PathName("release")},
+					Extensions: map[string]interface{}{"code": invalidResponseCode, "serviceName": "movies", "serviceUrl": "http://movies"},
+				},
+			},
+		},
+		{
+			name:     "missing non-nullable fields",
+			query:    `{ movie { id title } }`,
+			data:     `{ "movie": { "title": "Alien" } }`,
+			expected: `{ "movie": null }`,
+			errors: gqlerror.List{
+				{
+					Message:    `invalid value for field Movie.id: the non-nullable field is missing`,
+					Path:       ast.Path{ast.PathName("movie"), ast.PathName("id")},
+					Extensions: map[string]interface{}{"code": invalidResponseCode},
+				},
+			},
+		},
+		{
+			name:     "invalid shapes",
+			query:    `{ movie { tags director { name } } movies { title } }`,
+			data:     `{ "movie": { "tags": "scifi", "director": ["Ridley Scott"] }, "movies": { "title": "Alien" } }`,
+			expected: `{ "movie": { "tags": null, "director": null }, "movies": null }`,
+			errors: gqlerror.List{
+				{
+					Message:    `invalid value for field Movie.tags: expected [String!], got a string`,
+					Path:       ast.Path{ast.PathName("movie"), ast.PathName("tags")},
+					Extensions: map[string]interface{}{"code": invalidResponseCode},
+				},
+				{
+					Message:    `invalid value for field Movie.director: expected Person, got a list`,
+					Path:       ast.Path{ast.PathName("movie"), ast.PathName("director")},
+					Extensions: map[string]interface{}{"code": invalidResponseCode},
+				},
+				{
+					Message:    `invalid value for field Query.movies: expected [Movie!], got an object`,
+					Path:       ast.Path{ast.PathName("movies")},
+					Extensions: map[string]interface{}{"code": invalidResponseCode},
+				},
+			},
+		},
+		{
+			name:     "raw values",
+			query:    `{ movie { title release } }`,
+			data:     `{ "movie": { "release": 1979, "title": "Alien" } }`,
+			expected: `{ "movie": { "release": 1979, "title": "Alien" } }`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := gqlparser.MustLoadQuery(schema, tt.query)
+			var data map[string]interface{}
+			if tt.name == "raw values" {
+				var raw map[string]json.RawMessage
+				require.NoError(t, json.Unmarshal([]byte(tt.data), &raw))
+				data = map[string]interface{}{"movie": raw["movie"]}
+			} else {
+				require.NoError(t, json.Unmarshal([]byte(tt.data), &data))
+			}
+
+			res, err := marshalValidatedResult(data, query.Operations[0].SelectionSet, schema, &ast.Type{NamedType: "Query"}, validation, nil, nil)
+			jsonEqWithOrder(t, tt.expected, string(res))
+			if len(tt.errors) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			var errs gqlerror.List
+			require.True(t, errors.As(err, &errs))
+			assert.Equal(t, tt.errors, errs)
+		})
+	}
+
+	t.Run("non-strict mode writes the values as returned", func(t *testing.T) {
+		query := gqlparser.MustLoadQuery(schema, `{ movie { release genre } }`)
+		var data map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(`{ "movie": { "release": "1979", "genre": "HORROR" } }`), &data))
+		res, err := marshalResult(data, query.Operations[0].SelectionSet, schema, &ast.Type{NamedType: "Query"})
+		require.NoError(t, err)
+		jsonEqWithOrder(t, `{ "movie": { "release": "1979", "genre": "HORROR" } }`, string(res))
+	})
+}
+
+func TestFormatSelectionSetWithDefaultArguments(t *testing.T) {
+	schema := loadSchema(`
+	enum Sort {
+		TITLE
+		RELEASE
+	}
+
+	type Movie {
+		title: String
+	}
+
+	type Query {
+		movies(first: Int = 10, after: String, sort: Sort = TITLE): [Movie!]
+	}
+	`)
+
+	query := gqlparser.MustLoadQuery(schema, `query($first: Int, $after: String) {
+		movies(first: $first, after: $after) { title }
+	}`)
+
+	res := formatSelectionSetSingleLine(testContextWithVariables(map[string]interface{}{}, nil), schema, query.Operations[0].SelectionSet)
+	assert.Equal(t, `{ movies(first: 10, sort: TITLE) { title } }`, res)
+
+	res = formatSelectionSetSingleLine(testContextWithVariables(map[string]interface{}{"first": 5, "after": nil}, nil), schema, query.Operations[0].SelectionSet)
+	assert.Equal(t, `{ movies(first: 5, after: null, sort: TITLE) { title } }`, res)
+}
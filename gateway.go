@@ -2,9 +2,14 @@ package bramble
 
 import (
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -12,7 +17,11 @@ import (
 type Gateway struct {
 	ExecutableSchema *ExecutableSchema
 
-	plugins []Plugin
+	plugins        []Plugin
+	safeModeErrors []error
+
+	routerOnce sync.Once
+	router     http.Handler
 }
 
 // NewGateway returns the graphql gateway server mux
@@ -23,6 +32,14 @@ func NewGateway(executableSchema *ExecutableSchema, plugins []Plugin) *Gateway {
 	}
 }
 
+// ServeHTTP serves the public router, it is built on the first request
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.routerOnce.Do(func() {
+		g.router = g.Router()
+	})
+	g.router.ServeHTTP(w, r)
+}
+
 // UpdateSchemas periodically updates the execute schema
 func (g *Gateway) UpdateSchemas(interval time.Duration) {
 	for range time.Tick(interval) {
@@ -33,17 +50,42 @@ func (g *Gateway) UpdateSchemas(interval time.Duration) {
 	}
 }
 
+// serviceName returns the name of the gateway when it's federated by another
+// gateway
+func (g *Gateway) serviceName() string {
+	if g.ExecutableSchema == nil {
+		return ""
+	}
+	return g.ExecutableSchema.ServiceName
+}
+
 // Router returns the public http handler
 func (g *Gateway) Router() http.Handler {
+	if g.safeModeEnabled() {
+		return g.safeModeRouter()
+	}
+
 	mux := http.NewServeMux()
 
 	mux.Handle("/query",
 		applyMiddleware(
-			handler.NewDefaultServer(g.ExecutableSchema),
+			g.graphQLHandler(),
+			clientIDMiddleware(g.ExecutableSchema),
+			idempotencyKeyMiddleware,
+			clientMetadataMiddleware(g.ExecutableSchema),
+			errorStatusMiddleware(g.ExecutableSchema),
+			canaryMiddleware,
 			debugMiddleware,
+			gatewayChainMiddleware(g.serviceName()),
+			compressionMiddleware(g.ExecutableSchema),
 		),
 	)
 
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", g.readyzHandler(false))
+	mux.HandleFunc("/schema.graphql", g.schemaSDLHandler)
+	mux.HandleFunc("/schema-metadata", g.schemaMetadataHandler)
+
 	for _, plugin := range g.plugins {
 		plugin.SetupPublicMux(mux)
 	}
@@ -54,12 +96,70 @@ func (g *Gateway) Router() http.Handler {
 		result = g.plugins[i].ApplyMiddlewarePublicMux(result)
 	}
 
-	return applyMiddleware(result, monitoringMiddleware)
+	return applyMiddleware(result, monitoringMiddleware, requestIDMiddleware)
+}
+
+// graphQLHandler returns the gqlgen handler of the gateway, extended by the
+// plugins implementing GraphQLServerPlugin
+func (g *Gateway) graphQLHandler() *handler.Server {
+	srv := NewGraphQLHandler(g.ExecutableSchema)
+	for _, plugin := range g.plugins {
+		if p, ok := plugin.(GraphQLServerPlugin); ok {
+			p.ConfigureGraphQLServer(srv)
+		}
+	}
+	return srv
+}
+
+// NewGraphQLHandler returns the gqlgen handler for the schema. It is the same
+// as gqlgen's default server (POST, GET, multipart and websocket transports,
+// introspection and automatic persisted queries), with the addition of the
+// graphql-transport-ws transport and of the complexity limit of the schema.
+// It can be used to serve the schema with other gqlgen transports and
+// extensions, the middleware of the gateway router isn't applied.
+func NewGraphQLHandler(es graphql.ExecutableSchema) *handler.Server {
+	srv := handler.New(es)
+
+	ws := graphqlTransportWS{}
+	s, _ := es.(*ExecutableSchema)
+	if s != nil {
+		ws.acquireSubscription = s.acquireClientSubscription
+		ws.shutdown = s.drain.cancelled
+	}
+	srv.AddTransport(ws)
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+	})
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(binaryTransport{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
+
+	srv.SetQueryCache(lru.New(1000))
+	srv.AroundResponses(requestIDResponseMiddleware)
+	srv.AroundResponses(errorCodesResponseMiddleware)
+
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New(100),
+	})
+	if s != nil && s.MaxQueryComplexity > 0 {
+		srv.Use(extension.FixedComplexityLimit(s.MaxQueryComplexity))
+	}
+
+	return srv
 }
 
 // PrivateRouter returns the private http handler
 func (g *Gateway) PrivateRouter() http.Handler {
+	if g.safeModeEnabled() {
+		return g.safeModePrivateRouter()
+	}
+
 	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", g.readyzHandler(true))
 
 	for _, plugin := range g.plugins {
 		plugin.SetupPrivateMux(mux)
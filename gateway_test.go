@@ -1,15 +1,20 @@
 package bramble
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -52,11 +57,8 @@ func TestGatewayQuery(t *testing.T) {
 			assert.Equal(t, "Bramble/dev (query)", r.Header.Get("User-Agent"))
 		}
 	}))
-	client := NewClient(WithUserAgent(GenerateUserAgent("query")))
-	executableSchema := newExecutableSchema(nil, 50, client, NewService(server.URL))
-	err := executableSchema.UpdateSchema(true)
+	gtw, err := New(WithServices(server.URL))
 	require.NoError(t, err)
-	gtw := NewGateway(executableSchema, []Plugin{})
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`
 	{
@@ -65,7 +67,7 @@ func TestGatewayQuery(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
 	req.Header.Set("Accept", "application/json; charset=utf-8")
 
-	gtw.Router().ServeHTTP(rec, req)
+	gtw.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusOK, rec.Code)
 	assert.JSONEq(t, `{"data": { "test": "Hello" }}`, rec.Body.String())
 }
@@ -197,6 +199,10 @@ func TestDebugMiddleware(t *testing.T) {
 			Query: true,
 			Plan:  true,
 		},
+		"plan dryrun": {
+			Plan:   true,
+			DryRun: true,
+		},
 	} {
 		t.Run("with debug header value all", func(t *testing.T) {
 			called := false
@@ -209,6 +215,7 @@ func TestDebugMiddleware(t *testing.T) {
 				assert.Equal(t, expected.Variables, info.Variables)
 				assert.Equal(t, expected.Query, info.Query)
 				assert.Equal(t, expected.Plan, info.Plan)
+				assert.Equal(t, expected.DryRun, info.DryRun)
 				w.WriteHeader(http.StatusOK)
 			}
 			server := debugMiddleware(http.HandlerFunc(h))
@@ -218,3 +225,253 @@ func TestDebugMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestGatewayRequestID(t *testing.T) {
+	var downstreamRequestID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query string
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if strings.Contains(req.Query, "service") {
+			schema := `type Service {
+				name: String!
+				version: String!
+				schema: String!
+			}
+
+			type Query {
+				test: String
+				service: Service!
+			}`
+			encodedSchema, _ := json.Marshal(schema)
+			fmt.Fprintf(w, `{
+				"data": {
+					"service": {
+						"schema": %s,
+						"version": "1.0",
+						"name": "test-service"
+					}
+				}
+			}`, string(encodedSchema))
+		} else {
+			downstreamRequestID = r.Header.Get("X-Request-Id")
+			w.Write([]byte(`{ "data": { "test": "Hello" }}`))
+		}
+	}))
+	defer server.Close()
+
+	executableSchema := newExecutableSchema(nil, 50, nil, NewService(server.URL))
+	err := executableSchema.UpdateSchema(true)
+	require.NoError(t, err)
+	router := NewGateway(executableSchema, []Plugin{}).Router()
+
+	query := func(query, requestID string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(query))
+		req.Header.Set("Content-Type", "application/json")
+		if requestID != "" {
+			req.Header.Set("X-Request-Id", requestID)
+		}
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("forwards the incoming request id", func(t *testing.T) {
+		rec := query(`{"query": "{ test }"}`, "request-1")
+		assert.Equal(t, "request-1", rec.Header().Get("X-Request-Id"))
+		assert.Equal(t, "request-1", downstreamRequestID)
+	})
+
+	t.Run("generates a request id", func(t *testing.T) {
+		rec := query(`{"query": "{ test }"}`, "")
+		id := rec.Header().Get("X-Request-Id")
+		assert.Len(t, id, 32)
+		assert.Equal(t, id, downstreamRequestID)
+	})
+
+	t.Run("adds the request id to the errors", func(t *testing.T) {
+		rec := query(`{"query": "{ unknown }"}`, "request-2")
+		var res Response
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		require.Len(t, res.Errors, 1)
+		assert.Equal(t, "request-2", res.Errors[0].Extensions["requestId"])
+	})
+
+	t.Run("logs the request id", func(t *testing.T) {
+		logrusLock.Lock()
+		defer logrusLock.Unlock()
+		executableSchema.SlowQueryLog = &SlowQueryLog{Threshold: time.Nanosecond}
+		defer func() { executableSchema.SlowQueryLog = nil }()
+
+		obj := collectLogEvent(t, func() {
+			query(`{"query": "{ test }"}`, "request-3")
+		})
+		assert.Equal(t, "slow query", obj["msg"])
+		assert.Equal(t, "request-3", obj["request.id"])
+	})
+}
+
+func TestGatewayServiceRemoved(t *testing.T) {
+	newServer := func(field string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Query string
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+
+			if strings.Contains(req.Query, "service") {
+				schema := fmt.Sprintf(`type Service {
+					name: String!
+					version: String!
+					schema: String!
+				}
+
+				type Query {
+					%s: String
+					service: Service!
+				}`, field)
+				encodedSchema, _ := json.Marshal(schema)
+				fmt.Fprintf(w, `{
+					"data": {
+						"service": {
+							"schema": %s,
+							"version": "1.0",
+							"name": "%s-service"
+						}
+					}
+				}`, string(encodedSchema), field)
+				return
+			}
+			fmt.Fprintf(w, `{ "data": { "%s": "Hello" }}`, field)
+		}))
+	}
+	foo := newServer("foo")
+	defer foo.Close()
+	bar := newServer("bar")
+	defer bar.Close()
+
+	executableSchema := newExecutableSchema(nil, 50, nil, NewService(foo.URL), NewService(bar.URL))
+	require.NoError(t, executableSchema.UpdateSchema(true))
+	router := NewGateway(executableSchema, []Plugin{}).Router()
+
+	query := func() string {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"query": "query { bar }"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Request-Id", "test-request")
+		router.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	assert.JSONEq(t, `{"data": { "bar": "Hello" }}`, query())
+
+	require.NoError(t, executableSchema.UpdateServiceList([]string{foo.URL}))
+	assert.Len(t, executableSchema.Services, 1)
+	assert.Nil(t, executableSchema.MergedSchema.Query.Fields.ForName("bar"))
+	assert.Equal(t, []string{bar.URL}, executableSchema.LastSchemaChanges().RemovedServices)
+
+	// the query document is cached and isn't validated again by gqlgen
+	assert.JSONEq(t, `{
+		"errors": [
+			{
+				"message": "Cannot query field \"bar\" on type \"Query\".",
+				"locations": [{ "line": 1, "column": 9 }],
+				"extensions": { "code": "GRAPHQL_VALIDATION_FAILED", "requestId": "test-request" }
+			}
+		],
+		"data": null
+	}`, query())
+}
+
+type graphQLServerPlugin struct {
+	BasePlugin
+	configured int
+}
+
+func (p *graphQLServerPlugin) ID() string {
+	return "graphql-server"
+}
+
+func (p *graphQLServerPlugin) ConfigureGraphQLServer(srv *handler.Server) {
+	p.configured++
+	srv.AroundResponses(func(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+		res := next(ctx)
+		res.Extensions = map[string]interface{}{"plugin": "graphql-server"}
+		return res
+	})
+}
+
+func TestGatewayGraphQLServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query string
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if strings.Contains(req.Query, "service") {
+			schema := `type Service {
+				name: String!
+				version: String!
+				schema: String!
+			}
+
+			type Movie {
+				id: ID!
+				title: String!
+			}
+
+			type Query {
+				movie: Movie!
+				service: Service!
+			}`
+			encodedSchema, _ := json.Marshal(schema)
+			fmt.Fprintf(w, `{
+				"data": {
+					"service": {
+						"schema": %s,
+						"version": "1.0",
+						"name": "test-service"
+					}
+				}
+			}`, string(encodedSchema))
+			return
+		}
+		w.Write([]byte(`{ "data": { "movie": { "id": "1" } }}`))
+	}))
+	defer server.Close()
+
+	executableSchema := newExecutableSchema(nil, 50, nil, NewService(server.URL))
+	require.NoError(t, executableSchema.UpdateSchema(true))
+	executableSchema.MaxQueryComplexity = 2
+	plugin := &graphQLServerPlugin{}
+	router := NewGateway(executableSchema, []Plugin{plugin}).Router()
+	assert.Equal(t, 1, plugin.configured)
+
+	t.Run("GET transport", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/query?query="+url.QueryEscape("{ movie { id } }"), nil)
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"data": { "movie": { "id": "1" } }, "extensions": { "plugin": "graphql-server" }}`, rec.Body.String())
+	})
+
+	t.Run("complexity limit", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"query": "{ movie { id title } }"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Request-Id", "test-request")
+		router.ServeHTTP(rec, req)
+		assert.JSONEq(t, `{
+			"errors": [
+				{
+					"message": "operation has complexity 3, which exceeds the limit of 2",
+					"extensions": { "code": "COMPLEXITY_LIMIT_EXCEEDED", "requestId": "test-request" }
+				}
+			],
+			"data": null,
+			"extensions": { "plugin": "graphql-server" }
+		}`, rec.Body.String())
+	})
+}
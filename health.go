@@ -0,0 +1,134 @@
+package bramble
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ServiceHealth is the status of a service, as reported by the readiness
+// endpoint of the private router
+type ServiceHealth struct {
+	Name       string `json:"name"`
+	ServiceURL string `json:"url"`
+	Status     string `json:"status"`
+	// Merged is true if the service schema is part of the merged schema
+	Merged bool `json:"merged"`
+	// LastSuccess is the time of the last successful schema update
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	// LastError is the error of the last failed schema update
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+	// Latency of the last schema update
+	Latency string `json:"latency,omitempty"`
+}
+
+// Health returns the health of the service schema updates
+func (s *Service) Health() ServiceHealth {
+	s.healthMutex.RLock()
+	defer s.healthMutex.RUnlock()
+
+	h := ServiceHealth{
+		Name:       s.Name,
+		ServiceURL: s.ServiceURL,
+		Status:     s.Status,
+		LastError:  s.lastError,
+	}
+	if !s.lastSuccess.IsZero() {
+		t := s.lastSuccess
+		h.LastSuccess = &t
+	}
+	if !s.lastErrorAt.IsZero() {
+		t := s.lastErrorAt
+		h.LastErrorAt = &t
+	}
+	if s.latency > 0 {
+		h.Latency = s.latency.Round(time.Millisecond).String()
+	}
+	return h
+}
+
+// Readiness returns whether the gateway is ready to serve queries, and the
+// health of every service. The gateway is ready once the merged schema
+// contains the schemas of at least ReadinessQuorum of the services.
+func (s *ExecutableSchema) Readiness() (bool, []ServiceHealth) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	services := make([]ServiceHealth, 0, len(s.Services))
+	merged := 0
+	for url, svc := range s.Services {
+		h := svc.Health()
+		h.Merged = s.mergedServices[url]
+		if h.Merged {
+			merged++
+		}
+		services = append(services, h)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].ServiceURL < services[j].ServiceURL
+	})
+
+	quorum := s.ReadinessQuorum
+	if quorum <= 0 || quorum > 1 {
+		quorum = 1
+	}
+	required := int(math.Ceil(quorum * float64(len(s.Services))))
+	return s.MergedSchema != nil && merged >= required, services
+}
+
+type healthResponse struct {
+	Status   string          `json:"status"`
+	Errors   []string        `json:"errors,omitempty"`
+	Services []ServiceHealth `json:"services,omitempty"`
+}
+
+// healthzHandler is the liveness endpoint, it succeeds as long as the gateway
+// is serving requests
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(healthResponse{Status: "ok"})
+}
+
+// readyzHandler returns the readiness endpoint. The status is 503 until the
+// gateway is ready, in safe mode and while the gateway is draining. The detailed variant includes the
+// health of every service.
+func (g *Gateway) readyzHandler(detailed bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var res healthResponse
+		var ready bool
+		var services []ServiceHealth
+		if g.ExecutableSchema != nil {
+			ready, services = g.ExecutableSchema.Readiness()
+		}
+
+		switch {
+		case g.ExecutableSchema != nil && g.ExecutableSchema.Draining():
+			ready = false
+			res.Status = "draining"
+		case g.safeModeEnabled():
+			ready = false
+			res.Status = "safe-mode"
+			if detailed {
+				for _, err := range g.safeModeErrors {
+					res.Errors = append(res.Errors, err.Error())
+				}
+			}
+		case ready:
+			res.Status = "ready"
+		default:
+			res.Status = "not-ready"
+		}
+		if detailed {
+			res.Services = services
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}
+}
@@ -0,0 +1,105 @@
+package bramble
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHealthTestService(t *testing.T, name string, up bool) *httptest.Server {
+	if up {
+		return newTestService(t, name, fmt.Sprintf(`type Service { name: String! version: String! schema: String! }
+		type Query { service: Service! %s: String }`, name), nil)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func getHealth(t *testing.T, router http.Handler, path string) (int, healthResponse) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var res healthResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	return rec.Code, res
+}
+
+func TestReadiness(t *testing.T) {
+	up := newHealthTestService(t, "up", true)
+	down := newHealthTestService(t, "down", false)
+
+	es := newExecutableSchema(nil, 50, nil, NewService(up.URL), NewService(down.URL))
+	ready, _ := es.Readiness()
+	assert.False(t, ready, "not ready before the first schema update")
+
+	require.NoError(t, es.UpdateSchema(true))
+	ready, services := es.Readiness()
+	assert.False(t, ready, "all the services are required by default")
+	require.Len(t, services, 2)
+
+	byURL := map[string]ServiceHealth{}
+	for _, s := range services {
+		byURL[s.ServiceURL] = s
+	}
+	assert.True(t, byURL[up.URL].Merged)
+	assert.Equal(t, "up", byURL[up.URL].Name)
+	assert.NotNil(t, byURL[up.URL].LastSuccess)
+	assert.Empty(t, byURL[up.URL].LastError)
+	assert.NotEmpty(t, byURL[up.URL].Latency)
+	assert.False(t, byURL[down.URL].Merged)
+	assert.Nil(t, byURL[down.URL].LastSuccess)
+	assert.NotEmpty(t, byURL[down.URL].LastError)
+	assert.NotNil(t, byURL[down.URL].LastErrorAt)
+
+	es.ReadinessQuorum = 0.5
+	ready, _ = es.Readiness()
+	assert.True(t, ready)
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	up := newHealthTestService(t, "up", true)
+	down := newHealthTestService(t, "down", false)
+	es := newExecutableSchema(nil, 50, nil, NewService(up.URL), NewService(down.URL))
+	require.NoError(t, es.UpdateSchema(true))
+	gtw := NewGateway(es, nil)
+
+	code, res := getHealth(t, gtw.Router(), "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", res.Status)
+
+	code, res = getHealth(t, gtw.Router(), "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not-ready", res.Status)
+	assert.Empty(t, res.Services, "the public endpoint doesn't include the services")
+
+	code, res = getHealth(t, gtw.PrivateRouter(), "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Len(t, res.Services, 2)
+
+	es.ReadinessQuorum = 0.5
+	code, res = getHealth(t, gtw.Router(), "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", res.Status)
+
+	t.Run("safe mode", func(t *testing.T) {
+		gtw.EnableSafeMode([]error{errors.New("invalid plugin configuration")})
+		defer promSafeMode.Set(0)
+
+		code, res := getHealth(t, gtw.Router(), "/healthz")
+		assert.Equal(t, http.StatusOK, code)
+
+		code, res = getHealth(t, gtw.PrivateRouter(), "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "safe-mode", res.Status)
+		assert.Equal(t, []string{"invalid plugin configuration"}, res.Errors)
+	})
+}
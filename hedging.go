@@ -0,0 +1,88 @@
+package bramble
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+// hedgingReplica returns the replica the request of the step can be hedged
+// to, or an empty string if the request must not be hedged. Mutations are
+// never hedged as they're not idempotent.
+func (e *QueryExecution) hedgingReplica(step *QueryPlanStep) string {
+	if e.hedgingDelay <= 0 || step.ParentType == mutationObjectName {
+		return ""
+	}
+	replicas := e.serviceReplicas[step.ServiceURL]
+	if len(replicas) == 0 {
+		return ""
+	}
+	return replicas[rand.Intn(len(replicas))]
+}
+
+type hedgedResponse struct {
+	url  string
+	resp interface{}
+	err  error
+}
+
+// hedgedRequest sends the request to the service at url, and to the replica if
+// the service didn't respond after the hedging delay. The first successful
+// response is decoded in resp and the other request is cancelled. If both
+// requests fail the response of the service is used.
+func (e *QueryExecution) hedgedRequest(ctx context.Context, step *QueryPlanStep, url string, replica string, req *Request, resp interface{}) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the responses are decoded in separate values as both requests can be
+	// in flight at the same time
+	responses := make(chan hedgedResponse, 2)
+	send := func(target string, release func()) {
+		defer release()
+		out := reflect.New(reflect.TypeOf(resp).Elem()).Interface()
+		err := e.graphqlClient.Request(ctx, target, req, out)
+		responses <- hedgedResponse{url: target, resp: out, err: err}
+	}
+	go send(url, func() {})
+
+	timer := time.NewTimer(e.hedgingDelay)
+	defer timer.Stop()
+	hedge := timer.C
+
+	pending := 1
+	var failed *hedgedResponse
+	for {
+		select {
+		case <-hedge:
+			hedge = nil
+			// the replica must be below its own limit of concurrent
+			// requests, otherwise the request isn't hedged
+			limiter := e.serviceLimiters.get(replica, e.maxServiceConcurrency)
+			if !limiter.tryAcquire() {
+				continue
+			}
+			pending++
+			promHedgedRequests.WithLabelValues(step.ServiceName).Inc()
+			go send(replica, limiter.release)
+		case r := <-responses:
+			pending--
+			if r.err == nil {
+				if r.url != url {
+					promHedgedRequestWins.WithLabelValues(step.ServiceName).Inc()
+				}
+				reflect.ValueOf(resp).Elem().Set(reflect.ValueOf(r.resp).Elem())
+				return nil
+			}
+			if failed == nil || r.url == url {
+				failed = &r
+			}
+			// a service failing before the hedging delay is not retried on
+			// the replica
+			if pending == 0 {
+				reflect.ValueOf(resp).Elem().Set(reflect.ValueOf(failed.resp).Elem())
+				return failed.err
+			}
+		}
+	}
+}
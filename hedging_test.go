@@ -0,0 +1,95 @@
+package bramble
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryExecutionHedgedRequest(t *testing.T) {
+	newServer := func(delay time.Duration, body string) (*httptest.Server, *int64) {
+		var calls int64
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&calls, 1)
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+			w.Write([]byte(body))
+		})), &calls
+	}
+	execute := func(primary, replica string, parentType string) (map[string]interface{}, error) {
+		e := newQueryExecution(NewClient(), nil, nil, 50, nil)
+		e.serviceReplicas = map[string][]string{primary: {replica}}
+		e.hedgingDelay = 20 * time.Millisecond
+		resp := map[string]interface{}{}
+		err := e.request(context.Background(), &QueryPlanStep{ServiceURL: primary, ParentType: parentType}, NewRequest("{ a }"), &resp)
+		return resp, err
+	}
+
+	t.Run("slow service", func(t *testing.T) {
+		primary, _ := newServer(300*time.Millisecond, `{ "data": { "a": "primary" } }`)
+		defer primary.Close()
+		replica, _ := newServer(0, `{ "data": { "a": "replica" } }`)
+		defer replica.Close()
+
+		start := time.Now()
+		resp, err := execute(primary.URL, replica.URL, queryObjectName)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"a": "replica"}, resp)
+		assert.Less(t, int64(time.Since(start)), int64(200*time.Millisecond))
+	})
+
+	t.Run("fast service", func(t *testing.T) {
+		primary, _ := newServer(0, `{ "data": { "a": "primary" } }`)
+		defer primary.Close()
+		replica, replicaCalls := newServer(0, `{ "data": { "a": "replica" } }`)
+		defer replica.Close()
+
+		resp, err := execute(primary.URL, replica.URL, queryObjectName)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"a": "primary"}, resp)
+		assert.Equal(t, int64(0), atomic.LoadInt64(replicaCalls))
+	})
+
+	t.Run("mutations are not hedged", func(t *testing.T) {
+		primary, _ := newServer(50*time.Millisecond, `{ "data": { "a": "primary" } }`)
+		defer primary.Close()
+		replica, replicaCalls := newServer(0, `{ "data": { "a": "replica" } }`)
+		defer replica.Close()
+
+		resp, err := execute(primary.URL, replica.URL, mutationObjectName)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"a": "primary"}, resp)
+		assert.Equal(t, int64(0), atomic.LoadInt64(replicaCalls))
+	})
+
+	t.Run("failing replica", func(t *testing.T) {
+		primary, _ := newServer(50*time.Millisecond, `{ "data": { "a": "primary" } }`)
+		defer primary.Close()
+		replica, replicaCalls := newServer(0, `invalid`)
+		defer replica.Close()
+
+		resp, err := execute(primary.URL, replica.URL, queryObjectName)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"a": "primary"}, resp)
+		assert.Equal(t, int64(1), atomic.LoadInt64(replicaCalls))
+	})
+
+	t.Run("both failing", func(t *testing.T) {
+		primary, _ := newServer(50*time.Millisecond, `{ "errors": [{ "message": "primary error" }] }`)
+		defer primary.Close()
+		replica, _ := newServer(0, `{ "errors": [{ "message": "replica error" }] }`)
+		defer replica.Close()
+
+		_, err := execute(primary.URL, replica.URL, queryObjectName)
+		assert.EqualError(t, err, "primary error")
+	})
+}
@@ -0,0 +1,215 @@
+package bramble
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// ExecutionHooks are called during the execution of the operations. Plugins
+// implementing this interface have their hooks called automatically, other
+// hooks can be added with ExecutableSchema.AddExecutionHooks. The hooks are
+// called in order, the errors returned by the hooks are returned to the
+// client (as is if they're *gqlerror.Error).
+type ExecutionHooks interface {
+	// OnRequest is called before the operation is planned. The returned
+	// context is used for the rest of the execution, returning an error
+	// rejects the operation.
+	OnRequest(ctx context.Context, op *ast.OperationDefinition, variables map[string]interface{}) (context.Context, error)
+	// OnPlan is called with the query plan before it's executed. The plan is
+	// a copy of the cached plan, it can be modified. Returning an error
+	// rejects the operation.
+	OnPlan(ctx context.Context, plan *QueryPlan) error
+	// OnStepRequest is called before every request to a downstream service.
+	// The request can be modified (e.g. to add headers), returning an error
+	// fails the step without sending the request.
+	OnStepRequest(ctx context.Context, step *QueryPlanStep, req *Request) error
+	// OnStepResponse is called after every request to a downstream service
+	// with the decoded response and the error of the request, if any. The
+	// returned error replaces the request error.
+	OnStepResponse(ctx context.Context, step *QueryPlanStep, response interface{}, err error) error
+	// OnMergedResponse is called with the merged responses of all the steps,
+	// before they're formatted according to the operation selection set. The
+	// values not merged with the results of other steps are left as
+	// json.RawMessage. The data can be modified, returning an error fails the
+	// operation.
+	OnMergedResponse(ctx context.Context, data map[string]interface{}) error
+	// OnError is called for every error returned to the client.
+	OnError(ctx context.Context, err *gqlerror.Error)
+}
+
+// BaseExecutionHooks are no-op execution hooks. They can be embedded as a way
+// to avoid declaring unnecessary hooks.
+type BaseExecutionHooks struct{}
+
+// OnRequest ...
+func (h *BaseExecutionHooks) OnRequest(ctx context.Context, op *ast.OperationDefinition, variables map[string]interface{}) (context.Context, error) {
+	return ctx, nil
+}
+
+// OnPlan ...
+func (h *BaseExecutionHooks) OnPlan(ctx context.Context, plan *QueryPlan) error {
+	return nil
+}
+
+// OnStepRequest ...
+func (h *BaseExecutionHooks) OnStepRequest(ctx context.Context, step *QueryPlanStep, req *Request) error {
+	return nil
+}
+
+// OnStepResponse ...
+func (h *BaseExecutionHooks) OnStepResponse(ctx context.Context, step *QueryPlanStep, response interface{}, err error) error {
+	return err
+}
+
+// OnMergedResponse ...
+func (h *BaseExecutionHooks) OnMergedResponse(ctx context.Context, data map[string]interface{}) error {
+	return nil
+}
+
+// OnError ...
+func (h *BaseExecutionHooks) OnError(ctx context.Context, err *gqlerror.Error) {}
+
+// AddExecutionHooks adds hooks called during the execution of the
+// operations, after the hooks of the plugins.
+func (s *ExecutableSchema) AddExecutionHooks(h ExecutionHooks) {
+	s.hooksMutex.Lock()
+	defer s.hooksMutex.Unlock()
+	s.hooks = append(s.hooks, h)
+}
+
+// executionHooks returns the hooks of the plugins followed by the added hooks
+func (s *ExecutableSchema) executionHooks() executionHooks {
+	var res executionHooks
+	for _, p := range s.plugins {
+		if h, ok := p.(ExecutionHooks); ok {
+			res = append(res, h)
+		}
+	}
+	s.hooksMutex.Lock()
+	res = append(res, s.hooks...)
+	s.hooksMutex.Unlock()
+	return res
+}
+
+// executionHooks calls a list of hooks in order
+type executionHooks []ExecutionHooks
+
+func (hs executionHooks) onRequest(ctx context.Context, op *ast.OperationDefinition, variables map[string]interface{}) (context.Context, error) {
+	for _, h := range hs {
+		var err error
+		ctx, err = h.OnRequest(ctx, op, variables)
+		if err != nil {
+			return ctx, err
+		}
+	}
+	return ctx, nil
+}
+
+// onPlan calls the OnPlan hooks with a copy of the plan, the plan is returned
+// as is if there are no hooks
+func (hs executionHooks) onPlan(ctx context.Context, plan *QueryPlan) (*QueryPlan, error) {
+	if len(hs) == 0 {
+		return plan, nil
+	}
+	plan, selectionSets := copyQueryPlan(plan)
+	for _, h := range hs {
+		if err := h.OnPlan(ctx, plan); err != nil {
+			return nil, err
+		}
+	}
+	resetModifiedDocuments(plan.RootSteps, selectionSets)
+	return plan, nil
+}
+
+func (hs executionHooks) onStepRequest(ctx context.Context, step *QueryPlanStep, req *Request) error {
+	for _, h := range hs {
+		if err := h.OnStepRequest(ctx, step, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (hs executionHooks) onStepResponse(ctx context.Context, step *QueryPlanStep, response interface{}, err error) error {
+	for _, h := range hs {
+		err = h.OnStepResponse(ctx, step, response, err)
+	}
+	return err
+}
+
+func (hs executionHooks) onMergedResponse(ctx context.Context, data map[string]interface{}) error {
+	for _, h := range hs {
+		if err := h.OnMergedResponse(ctx, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (hs executionHooks) onError(ctx context.Context, errs gqlerror.List) {
+	for _, h := range hs {
+		for _, err := range errs {
+			h.OnError(ctx, err)
+		}
+	}
+}
+
+// hookError converts the error returned by a hook to a GraphQL error
+func hookError(err error) *gqlerror.Error {
+	var gqlErr *gqlerror.Error
+	if errors.As(err, &gqlErr) {
+		return gqlErr
+	}
+	return &gqlerror.Error{Message: err.Error()}
+}
+
+// copyQueryPlan returns a copy of the plan that can be modified without
+// affecting the original one, and the selection set of every copied step. The
+// selection sets are shared, they must be replaced rather than modified in
+// place.
+func copyQueryPlan(plan *QueryPlan) (*QueryPlan, map[*QueryPlanStep]ast.SelectionSet) {
+	selectionSets := make(map[*QueryPlanStep]ast.SelectionSet)
+	return &QueryPlan{RootSteps: copyQueryPlanSteps(plan.RootSteps, selectionSets)}, selectionSets
+}
+
+func copyQueryPlanSteps(steps []*QueryPlanStep, selectionSets map[*QueryPlanStep]ast.SelectionSet) []*QueryPlanStep {
+	if steps == nil {
+		return nil
+	}
+	res := make([]*QueryPlanStep, len(steps))
+	for i, step := range steps {
+		newStep := *step
+		newStep.InsertionPoint = append([]string(nil), step.InsertionPoint...)
+		newStep.InjectedFields = append([]string(nil), step.InjectedFields...)
+		newStep.Then = copyQueryPlanSteps(step.Then, selectionSets)
+		selectionSets[&newStep] = step.SelectionSet
+		res[i] = &newStep
+	}
+	return res
+}
+
+// resetModifiedDocuments discards the pre-formatted selection set of the steps
+// added or whose selection set was replaced by the hooks
+func resetModifiedDocuments(steps []*QueryPlanStep, selectionSets map[*QueryPlanStep]ast.SelectionSet) {
+	for _, step := range steps {
+		if original, ok := selectionSets[step]; !ok || !sameSelections(original, step.SelectionSet) {
+			step.document = ""
+		}
+		resetModifiedDocuments(step.Then, selectionSets)
+	}
+}
+
+func sameSelections(a, b ast.SelectionSet) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package bramble
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+type hooksTestContextKey struct{}
+
+type recordingHooks struct {
+	BaseExecutionHooks
+	mu            sync.Mutex
+	calls         []string
+	errs          []string
+	rejectRequest bool
+	failSteps     bool
+}
+
+func (h *recordingHooks) record(call string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, call)
+}
+
+func (h *recordingHooks) OnRequest(ctx context.Context, op *ast.OperationDefinition, variables map[string]interface{}) (context.Context, error) {
+	h.record("request")
+	if h.rejectRequest {
+		return ctx, &gqlerror.Error{Message: "rejected", Extensions: map[string]interface{}{"code": "FORBIDDEN"}}
+	}
+	return context.WithValue(ctx, hooksTestContextKey{}, "from-hook"), nil
+}
+
+func (h *recordingHooks) OnPlan(ctx context.Context, plan *QueryPlan) error {
+	h.record("plan")
+	return nil
+}
+
+func (h *recordingHooks) OnStepRequest(ctx context.Context, step *QueryPlanStep, req *Request) error {
+	h.record("step-request")
+	req.Headers.Set("X-Hook", ctx.Value(hooksTestContextKey{}).(string))
+	return nil
+}
+
+func (h *recordingHooks) OnStepResponse(ctx context.Context, step *QueryPlanStep, response interface{}, err error) error {
+	h.record("step-response")
+	if h.failSteps {
+		return errors.New("step failed")
+	}
+	return err
+}
+
+func (h *recordingHooks) OnMergedResponse(ctx context.Context, data map[string]interface{}) error {
+	h.record("merged-response")
+	data["movie"] = map[string]interface{}{"id": "1", "title": "Modified title"}
+	return nil
+}
+
+func (h *recordingHooks) OnError(ctx context.Context, err *gqlerror.Error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.errs = append(h.errs, err.Message)
+}
+
+func newHooksTestFixture(hooks *recordingHooks) *queryExecutionFixture {
+	return &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `type Movie {
+					id: ID!
+					title: String
+				}
+
+				type Query {
+					movie(id: ID!): Movie
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.Header.Get("X-Hook") != "from-hook" {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					w.Write([]byte(`{ "data": { "movie": { "id": "1", "title": "Test title" } } }`))
+				}),
+			},
+		},
+		query: `{
+			movie(id: "1") {
+				id
+				title
+			}
+		}`,
+		hooks: []ExecutionHooks{hooks},
+	}
+}
+
+func TestExecutionHooks(t *testing.T) {
+	t.Run("hooks are called in order", func(t *testing.T) {
+		hooks := &recordingHooks{}
+		f := newHooksTestFixture(hooks)
+		f.expected = `{ "movie": { "id": "1", "title": "Modified title" } }`
+		f.checkSuccess(t)
+		assert.Equal(t, []string{"request", "plan", "step-request", "step-response", "merged-response"}, hooks.calls)
+		assert.Empty(t, hooks.errs)
+	})
+
+	t.Run("request hook rejects the operation", func(t *testing.T) {
+		hooks := &recordingHooks{rejectRequest: true}
+		f := newHooksTestFixture(hooks)
+		f.errors = gqlerror.List{{Message: "rejected", Extensions: map[string]interface{}{"code": "FORBIDDEN"}}}
+		f.run(t)
+		assert.Equal(t, []string{"request"}, hooks.calls)
+		assert.Equal(t, []string{"rejected"}, hooks.errs)
+	})
+
+	t.Run("step response hook replaces the error", func(t *testing.T) {
+		hooks := &recordingHooks{failSteps: true}
+		f := newHooksTestFixture(hooks)
+		f.errors = gqlerror.List{{
+			Message:   "step failed",
+			Path:      ast.Path{ast.PathName("movie")},
+			Locations: []gqlerror.Location{{Line: 2, Column: 4}},
+			Extensions: map[string]interface{}{
+				"code":         serviceErrorCode,
+				"selectionSet": `{ movie(id: "1") { id title } }`,
+			},
+		}}
+		f.run(t)
+		assert.Equal(t, []string{"step failed"}, hooks.errs)
+	})
+}
+
+func TestCopyQueryPlan(t *testing.T) {
+	selectionSet := ast.SelectionSet{&ast.Field{Name: "id"}}
+	child := &QueryPlanStep{ServiceURL: "b", SelectionSet: selectionSet, InsertionPoint: []string{"movie"}, document: "{ id }"}
+	plan := &QueryPlan{RootSteps: []*QueryPlanStep{
+		{ServiceURL: "a", SelectionSet: selectionSet, Then: []*QueryPlanStep{child}, document: "{ id }"},
+	}}
+
+	copied, selectionSets := copyQueryPlan(plan)
+	copied.RootSteps[0].ServiceURL = "c"
+	copied.RootSteps[0].Then[0].InsertionPoint[0] = "film"
+	copied.RootSteps[0].Then[0].SelectionSet = ast.SelectionSet{&ast.Field{Name: "title"}}
+	copied.RootSteps = append(copied.RootSteps, &QueryPlanStep{ServiceURL: "d", document: "{ stale }"})
+	resetModifiedDocuments(copied.RootSteps, selectionSets)
+
+	assert.Equal(t, "a", plan.RootSteps[0].ServiceURL)
+	assert.Equal(t, []string{"movie"}, child.InsertionPoint)
+	assert.Equal(t, selectionSet, child.SelectionSet)
+	assert.Equal(t, "{ id }", child.document)
+	assert.Equal(t, "{ id }", copied.RootSteps[0].document, "unchanged selection sets keep their document")
+	assert.Empty(t, copied.RootSteps[0].Then[0].document)
+	assert.Empty(t, copied.RootSteps[1].document)
+}
@@ -0,0 +1,202 @@
+package bramble
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// HTTPClient is an HTTP client for auxiliary (non GraphQL) calls made by
+// plugins, e.g. to a feature flag or entitlement service. Requests are
+// traced, retried and instrumented like downstream GraphQL requests.
+type HTTPClient struct {
+	// Name of the client, used in traces, metrics and the user agent
+	Name       string
+	HTTPClient *http.Client
+	// Base URL relative request paths are resolved against
+	BaseURL string
+	// Headers added to every request
+	Header http.Header
+	// Maximum number of retries for failed requests (network errors, 429
+	// and 5xx responses)
+	MaxRetries int
+	// Delay before the first retry, doubled for each subsequent retry
+	RetryBackoff time.Duration
+}
+
+// HTTPClientOpt is a function used to set an HTTP client option
+type HTTPClientOpt func(*HTTPClient)
+
+// NewHTTPClient creates a new HTTPClient from the given options.
+func NewHTTPClient(name string, opts ...HTTPClientOpt) *HTTPClient {
+	c := &HTTPClient{
+		Name: name,
+		HTTPClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+		Header:       make(http.Header),
+		RetryBackoff: 100 * time.Millisecond,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// WithBaseURL sets the base URL relative request paths are resolved against.
+func WithBaseURL(baseURL string) HTTPClientOpt {
+	return func(c *HTTPClient) {
+		c.BaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithDefaultHeader adds a header to every request.
+func WithDefaultHeader(key, value string) HTTPClientOpt {
+	return func(c *HTTPClient) {
+		c.Header.Add(key, value)
+	}
+}
+
+// WithRetries sets the maximum number of retries and the initial backoff.
+func WithRetries(maxRetries int, backoff time.Duration) HTTPClientOpt {
+	return func(c *HTTPClient) {
+		c.MaxRetries = maxRetries
+		c.RetryBackoff = backoff
+	}
+}
+
+// WithTimeout sets the timeout of a single request attempt.
+func WithTimeout(timeout time.Duration) HTTPClientOpt {
+	return func(c *HTTPClient) {
+		c.HTTPClient.Timeout = timeout
+	}
+}
+
+// NewRequest creates a request for the given path (or absolute URL). If body
+// is not nil it is encoded as JSON.
+func (c *HTTPClient) NewRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
+	url := path
+	if c.BaseURL != "" && !strings.Contains(path, "://") {
+		url = c.BaseURL + "/" + strings.TrimPrefix(path, "/")
+	}
+
+	var bodyReader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode request body: %w", err)
+		}
+		bodyReader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+
+	for k, v := range c.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	req.Header.Set("User-Agent", GenerateUserAgent(c.Name))
+
+	return req, nil
+}
+
+// Do sends the request, retrying it if needed. Requests with a body can only
+// be retried if the body can be replayed (see http.Request.GetBody).
+func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		tracer := parent.Tracer()
+		span := tracer.StartSpan(c.Name, opentracing.ChildOf(parent.Context()), ext.SpanKindRPCClient)
+		ext.HTTPMethod.Set(span, req.Method)
+		ext.HTTPUrl.Set(span, req.URL.String())
+		defer span.Finish()
+		_ = tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+	}
+
+	backoff := c.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, fmt.Errorf("unable to replay request body: %w", err)
+				}
+				req.Body = body
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			backoff *= 2
+		}
+
+		start := time.Now()
+		res, err := c.HTTPClient.Do(req)
+		status := "error"
+		if err == nil {
+			status = strconv.Itoa(res.StatusCode)
+		}
+		promHTTPClientDurations.WithLabelValues(c.Name, status).Observe(time.Since(start).Seconds())
+
+		canRetry := attempt < c.MaxRetries && ctx.Err() == nil && (req.Body == nil || req.GetBody != nil)
+		if !canRetry || (err == nil && !isRetryableStatus(res.StatusCode)) {
+			return res, err
+		}
+
+		if res != nil {
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+	}
+}
+
+// DoJSON sends a request with a JSON body (if in is not nil) and decodes the
+// JSON response into out (if not nil). Non 2xx responses return an error.
+func (c *HTTPClient) DoJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	req, err := c.NewRequest(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json; charset=utf-8")
+
+	res, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("error during request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
@@ -0,0 +1,93 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPClient(t *testing.T) {
+	t.Run("json request", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/flags/new-ui", r.URL.Path)
+			assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+			assert.Equal(t, GenerateUserAgent("feature-flags"), r.Header.Get("User-Agent"))
+			var in map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+			assert.Equal(t, "user-1", in["user"])
+			_, _ = w.Write([]byte(`{"enabled": true}`))
+		}))
+		defer server.Close()
+
+		c := NewHTTPClient("feature-flags", WithBaseURL(server.URL+"/"), WithDefaultHeader("X-Api-Key", "secret"))
+		var out struct {
+			Enabled bool `json:"enabled"`
+		}
+		err := c.DoJSON(context.Background(), http.MethodPost, "/flags/new-ui", map[string]string{"user": "user-1"}, &out)
+		require.NoError(t, err)
+		assert.True(t, out.Enabled)
+	})
+
+	t.Run("retries failed requests", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var in map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+			assert.Equal(t, "user-1", in["user"])
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`{}`))
+		}))
+		defer server.Close()
+
+		c := NewHTTPClient("entitlements", WithBaseURL(server.URL), WithRetries(2, time.Millisecond))
+		err := c.DoJSON(context.Background(), http.MethodPost, "check", map[string]string{"user": "user-1"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("returns the last error", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		c := NewHTTPClient("entitlements", WithRetries(1, time.Millisecond))
+		err := c.DoJSON(context.Background(), http.MethodGet, server.URL, nil, nil)
+		assert.EqualError(t, err, "unexpected status code 500")
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("traces requests", func(t *testing.T) {
+		tracer := mocktracer.New()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+			assert.NoError(t, err)
+		}))
+		defer server.Close()
+
+		parent := tracer.StartSpan("query")
+		ctx := opentracing.ContextWithSpan(context.Background(), parent)
+		c := NewHTTPClient("feature-flags")
+		require.NoError(t, c.DoJSON(ctx, http.MethodGet, server.URL, nil, nil))
+		parent.Finish()
+
+		spans := tracer.FinishedSpans()
+		require.Len(t, spans, 2)
+		assert.Equal(t, "feature-flags", spans[0].OperationName)
+		assert.Equal(t, parent.Context().(mocktracer.MockSpanContext).SpanID, spans[0].ParentID)
+	})
+}
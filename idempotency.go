@@ -0,0 +1,236 @@
+package bramble
+
+import (
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// idempotencyKeyHeader is the header carrying the idempotency key of the
+// mutations, from the clients and to the services
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyKeyReusedCode is the error code returned when an idempotency key
+// is used again with a different request
+const idempotencyKeyReusedCode = "IDEMPOTENCY_KEY_REUSED"
+
+// idempotencyKeyMiddleware adds the idempotency key of the request (if any) to
+// the context
+func idempotencyKeyMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+			r = r.WithContext(AddIdempotencyKeyToContext(r.Context(), key))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// addMutationIdempotencyKeyToContext generates the idempotency key of a
+// mutation sent without one
+func addMutationIdempotencyKeyToContext(ctx context.Context) context.Context {
+	if GetIdempotencyKeyFromContext(ctx) != "" {
+		return ctx
+	}
+	return AddIdempotencyKeyToContext(ctx, generateRequestID())
+}
+
+// stepIdempotencyKey returns the idempotency key of the i-th of the n root
+// steps of a mutation. The key of the operation is used as is for a single
+// step, otherwise each step gets its own key derived from it: two steps may
+// be sent to the same service.
+func stepIdempotencyKey(key string, i, n int) string {
+	if key == "" || n <= 1 {
+		return key
+	}
+	return fmt.Sprintf("%s-%d", key, i+1)
+}
+
+// withIdempotencyKeyHeader returns the headers of the request of a mutation
+// step with the idempotency key of the context
+func withIdempotencyKeyHeader(ctx context.Context, headers http.Header) http.Header {
+	key := GetIdempotencyKeyFromContext(ctx)
+	if key == "" {
+		return headers
+	}
+	result := headers.Clone()
+	if result == nil {
+		result = make(http.Header)
+	}
+	result.Set(idempotencyKeyHeader, key)
+	return result
+}
+
+// idempotencyCache keeps the responses of the mutations sent with an
+// idempotency key, so a client retrying a mutation gets the original response
+// instead of executing it again. It is safe for concurrent use.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	// expiries contains the kept responses, the first one to expire first
+	expiries idempotencyExpiries
+}
+
+type idempotencyEntry struct {
+	key string
+	// requestHash identifies the operation and variables the key was used
+	// with
+	requestHash string
+	// done is closed once the response is available
+	done     chan struct{}
+	response *graphql.Response
+	expires  time.Time
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{entries: make(map[string]*idempotencyEntry)}
+}
+
+// idempotencyExpiries is a heap of the kept responses ordered by expiry
+type idempotencyExpiries []*idempotencyEntry
+
+func (e idempotencyExpiries) Len() int           { return len(e) }
+func (e idempotencyExpiries) Less(i, j int) bool { return e[i].expires.Before(e[j].expires) }
+func (e idempotencyExpiries) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+func (e *idempotencyExpiries) Push(x interface{}) {
+	*e = append(*e, x.(*idempotencyEntry))
+}
+
+func (e *idempotencyExpiries) Pop() interface{} {
+	old := *e
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*e = old[:len(old)-1]
+	return entry
+}
+
+// removeExpired removes the expired responses. c.mu must be held.
+func (c *idempotencyCache) removeExpired(now time.Time) {
+	for len(c.expiries) > 0 && now.After(c.expiries[0].expires) {
+		entry := heap.Pop(&c.expiries).(*idempotencyEntry)
+		if c.entries[entry.key] == entry {
+			delete(c.entries, entry.key)
+		}
+	}
+}
+
+// do returns the cached response of the key, waiting for it if the mutation
+// is still executing, or executes the mutation and caches its response for
+// the window. The responses without data aren't cached: the mutation was
+// rejected before it was executed and can be retried.
+func (c *idempotencyCache) do(ctx context.Context, key, requestHash string, window time.Duration, execute func() *graphql.Response) *graphql.Response {
+	c.mu.Lock()
+	c.removeExpired(time.Now())
+	if entry, ok := c.entries[key]; ok {
+		c.mu.Unlock()
+		if entry.requestHash != requestHash {
+			return &graphql.Response{Errors: gqlerror.List{idempotencyKeyReusedError()}}
+		}
+		select {
+		case <-entry.done:
+			return cloneResponse(entry.response)
+		case <-ctx.Done():
+			return graphql.ErrorResponse(ctx, "error while waiting for the mutation with the same idempotency key: %s", ctx.Err())
+		}
+	}
+	entry := &idempotencyEntry{key: key, requestHash: requestHash, done: make(chan struct{})}
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	var response *graphql.Response
+	defer func() {
+		// the response is copied as it's modified by the response
+		// middlewares of the original request
+		entry.response = cloneResponse(response)
+		c.mu.Lock()
+		if response == nil || response.Data == nil {
+			delete(c.entries, key)
+		} else {
+			entry.expires = time.Now().Add(window)
+			heap.Push(&c.expiries, entry)
+		}
+		c.mu.Unlock()
+		close(entry.done)
+	}()
+	response = execute()
+	return response
+}
+
+func idempotencyKeyReusedError() *gqlerror.Error {
+	return &gqlerror.Error{
+		Message:    "the idempotency key was already used with a different request",
+		Extensions: map[string]interface{}{"code": idempotencyKeyReusedCode},
+	}
+}
+
+// cloneResponse returns a copy of the response and of its errors
+func cloneResponse(response *graphql.Response) *graphql.Response {
+	if response == nil {
+		return &graphql.Response{}
+	}
+	result := &graphql.Response{Data: response.Data}
+	for _, err := range response.Errors {
+		e := *err
+		if err.Extensions != nil {
+			e.Extensions = make(map[string]interface{}, len(err.Extensions))
+			for k, v := range err.Extensions {
+				e.Extensions[k] = v
+			}
+		}
+		result.Errors = append(result.Errors, &e)
+	}
+	return result
+}
+
+// operationRequestHash returns the hash of the query, operation name and
+// variables of the operation
+func operationRequestHash(ctx context.Context) string {
+	h := sha256.New()
+	if graphql.HasOperationContext(ctx) {
+		opctx := graphql.GetOperationContext(ctx)
+		vars, _ := json.Marshal(opctx.Variables)
+		fmt.Fprintf(h, "%s\x00%s\x00%s", opctx.RawQuery, opctx.OperationName, vars)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// executeIdempotentMutation returns the cached response of a mutation sent
+// with an idempotency key, or executes it. The keys are scoped by client and
+// authenticated identity, see idempotencyScope.
+func (s *ExecutableSchema) executeIdempotentMutation(ctx context.Context, op *ast.OperationDefinition, execute func(context.Context) *graphql.Response) *graphql.Response {
+	key := GetIdempotencyKeyFromContext(ctx)
+	if s.IdempotencyCacheWindow <= 0 || op == nil || op.Operation != ast.Mutation || key == "" {
+		return execute(ctx)
+	}
+	// the cached response can be replayed to a client requesting another
+	// encoding, its data is kept in JSON
+	ctx = context.WithValue(ctx, responseEncodingContextKey, (*requestedEncoding)(nil))
+	cacheKey := s.idempotencyScope(ctx) + "\x00" + key
+	return s.idempotencyCache.do(ctx, cacheKey, operationRequestHash(ctx), s.IdempotencyCacheWindow, func() *graphql.Response {
+		return execute(ctx)
+	})
+}
+
+// idempotencyScope returns the scope of the idempotency keys of the request:
+// the subject and roles of the claims, and the client ID. The client ID can be
+// sent by the clients (see client-id-header), it's not enough to keep a client
+// from replaying the responses of another identity.
+func (s *ExecutableSchema) idempotencyScope(ctx context.Context) string {
+	var subject string
+	if claims, ok := GetClaimsFromContext(ctx); ok {
+		subject, _ = claims[clientIDClaim].(string)
+	}
+	roles := strings.Join(rolesFromContext(ctx, s.RolesClaim), ",")
+	return subject + "\x00" + roles + "\x00" + GetClientIDFromContext(ctx)
+}
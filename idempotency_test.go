@@ -0,0 +1,253 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestIdempotencyKeyMiddleware(t *testing.T) {
+	var key string
+	h := idempotencyKeyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = GetIdempotencyKeyFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Empty(t, key)
+
+	req.Header.Set("Idempotency-Key", "abc")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "abc", key)
+}
+
+func TestStepIdempotencyKey(t *testing.T) {
+	assert.Equal(t, "abc", stepIdempotencyKey("abc", 0, 1))
+	assert.Equal(t, "abc-1", stepIdempotencyKey("abc", 0, 2))
+	assert.Equal(t, "abc-2", stepIdempotencyKey("abc", 1, 2))
+	assert.Equal(t, "", stepIdempotencyKey("", 1, 2))
+
+	headers := http.Header{"X-Request-Id": []string{"1"}}
+	ctx := AddIdempotencyKeyToContext(context.Background(), "abc")
+	assert.Equal(t, "abc", withIdempotencyKeyHeader(ctx, headers).Get("Idempotency-Key"))
+	assert.Empty(t, headers.Get("Idempotency-Key"), "the headers of the context must not be modified")
+	assert.Equal(t, "abc", withIdempotencyKeyHeader(ctx, nil).Get("Idempotency-Key"))
+	assert.Nil(t, withIdempotencyKeyHeader(context.Background(), nil))
+}
+
+func TestIdempotencyCache(t *testing.T) {
+	c := newIdempotencyCache()
+	var executions int
+	execute := func() *graphql.Response {
+		executions++
+		return &graphql.Response{Data: json.RawMessage(`{"rateMovie":5}`)}
+	}
+
+	resp := c.do(context.Background(), "a", "hash", time.Minute, execute)
+	assert.JSONEq(t, `{"rateMovie":5}`, string(resp.Data))
+	resp = c.do(context.Background(), "a", "hash", time.Minute, execute)
+	assert.JSONEq(t, `{"rateMovie":5}`, string(resp.Data))
+	assert.Equal(t, 1, executions)
+
+	t.Run("other keys are executed", func(t *testing.T) {
+		c.do(context.Background(), "b", "hash", time.Minute, execute)
+		assert.Equal(t, 2, executions)
+	})
+
+	t.Run("key reused with a different request", func(t *testing.T) {
+		resp := c.do(context.Background(), "a", "other hash", time.Minute, execute)
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, idempotencyKeyReusedCode, resp.Errors[0].Extensions["code"])
+		assert.Nil(t, resp.Data)
+		assert.Equal(t, 2, executions)
+	})
+
+	t.Run("responses without data aren't kept", func(t *testing.T) {
+		rejected := func() *graphql.Response {
+			executions++
+			return graphql.ErrorResponse(context.Background(), "too many operations")
+		}
+		c.do(context.Background(), "c", "hash", time.Minute, rejected)
+		c.do(context.Background(), "c", "hash", time.Minute, rejected)
+		assert.Equal(t, 4, executions)
+	})
+
+	t.Run("expired responses", func(t *testing.T) {
+		c.do(context.Background(), "d", "hash", time.Nanosecond, execute)
+		time.Sleep(time.Millisecond)
+		c.do(context.Background(), "d", "hash", time.Nanosecond, execute)
+		assert.Equal(t, 6, executions)
+	})
+
+	t.Run("expired responses are removed", func(t *testing.T) {
+		c := newIdempotencyCache()
+		c.do(context.Background(), "a", "hash", time.Minute, execute)
+		c.do(context.Background(), "b", "hash", time.Nanosecond, execute)
+		time.Sleep(time.Millisecond)
+		c.mu.Lock()
+		c.removeExpired(time.Now())
+		c.mu.Unlock()
+		assert.Contains(t, c.entries, "a")
+		assert.NotContains(t, c.entries, "b")
+		assert.Len(t, c.expiries, 1)
+	})
+}
+
+func TestIdempotencyCacheWaitsForTheExecutingMutation(t *testing.T) {
+	c := newIdempotencyCache()
+	started, release := make(chan struct{}), make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.do(context.Background(), "a", "hash", time.Minute, func() *graphql.Response {
+			close(started)
+			<-release
+			return &graphql.Response{Data: json.RawMessage(`{"rateMovie":5}`)}
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	resp := c.do(ctx, "a", "hash", time.Minute, nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Contains(t, resp.Errors[0].Message, "context deadline exceeded")
+
+	go close(release)
+	resp = c.do(context.Background(), "a", "hash", time.Minute, nil)
+	assert.JSONEq(t, `{"rateMovie":5}`, string(resp.Data))
+	wg.Wait()
+}
+
+func TestExecuteIdempotentMutation(t *testing.T) {
+	es := newExecutableSchema(nil, 50, nil)
+	es.IdempotencyCacheWindow = time.Minute
+	mutation := &ast.OperationDefinition{Operation: ast.Mutation}
+	var executions int
+	execute := func(context.Context) *graphql.Response {
+		executions++
+		return &graphql.Response{Data: json.RawMessage(`{"rateMovie":5}`)}
+	}
+	operationContext := func(client, key string, vars map[string]interface{}) context.Context {
+		ctx := graphql.WithOperationContext(context.Background(), &graphql.OperationContext{
+			RawQuery:  `mutation($rating: Int!) { rateMovie(id: "1", rating: $rating) }`,
+			Variables: vars,
+			Operation: mutation,
+		})
+		ctx = AddClientIDToContext(ctx, client)
+		return AddIdempotencyKeyToContext(ctx, key)
+	}
+
+	ctx := operationContext("client-1", "abc", map[string]interface{}{"rating": 5})
+	es.executeIdempotentMutation(ctx, mutation, execute)
+	es.executeIdempotentMutation(ctx, mutation, execute)
+	assert.Equal(t, 1, executions)
+
+	es.executeIdempotentMutation(operationContext("client-2", "abc", map[string]interface{}{"rating": 5}), mutation, execute)
+	assert.Equal(t, 2, executions, "the keys are scoped by client")
+
+	spoofed := AddClaimsToContext(ctx, map[string]interface{}{"sub": "user-2"})
+	es.executeIdempotentMutation(spoofed, mutation, execute)
+	assert.Equal(t, 3, executions, "the keys are scoped by authenticated identity")
+	es.executeIdempotentMutation(AddClaimsToContext(ctx, map[string]interface{}{"roles": []interface{}{"admin"}}), mutation, execute)
+	assert.Equal(t, 4, executions, "the keys are scoped by role")
+	es.executeIdempotentMutation(spoofed, mutation, execute)
+	assert.Equal(t, 4, executions)
+
+	resp := es.executeIdempotentMutation(operationContext("client-1", "abc", map[string]interface{}{"rating": 1}), mutation, execute)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, idempotencyKeyReusedCode, resp.Errors[0].Extensions["code"])
+
+	es.executeIdempotentMutation(operationContext("client-1", "", nil), mutation, execute)
+	es.executeIdempotentMutation(operationContext("client-1", "", nil), mutation, execute)
+	assert.Equal(t, 6, executions, "the mutations without key are always executed")
+
+	es.executeIdempotentMutation(ctx, &ast.OperationDefinition{Operation: ast.Query}, execute)
+	assert.Equal(t, 7, executions, "the queries are always executed")
+
+	es.IdempotencyCacheWindow = 0
+	es.executeIdempotentMutation(ctx, mutation, execute)
+	assert.Equal(t, 8, executions)
+}
+
+func TestQueryExecutionForwardsIdempotencyKeys(t *testing.T) {
+	var mu sync.Mutex
+	keys := map[string]string{}
+	handler := func(name, response string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			keys[name] = r.Header.Get("Idempotency-Key")
+			mu.Unlock()
+			w.Write([]byte(response))
+		})
+	}
+	services := []testService{
+		{
+			name: "movies",
+			schema: `
+			type Query {
+				movie(id: ID!): String
+			}
+			type Mutation {
+				rateMovie(id: ID!, rating: Int!): Int
+			}`,
+			handler: handler("movies", `{ "data": { "rateMovie": 5 } }`),
+		},
+		{
+			name: "reviews",
+			schema: `
+			type Query {
+				review(id: ID!): String
+			}
+			type Mutation {
+				addReview(id: ID!, text: String!): String
+			}`,
+			handler: handler("reviews", `{ "data": { "addReview": "great" } }`),
+		},
+	}
+
+	t.Run("each root step gets its own key", func(t *testing.T) {
+		f := &queryExecutionFixture{
+			services:       services,
+			query:          `mutation { rateMovie(id: "1", rating: 5) addReview(id: "1", text: "great") }`,
+			expected:       `{ "rateMovie": 5, "addReview": "great" }`,
+			idempotencyKey: "abc",
+		}
+		f.checkSuccess(t)
+		assert.Equal(t, map[string]string{"movies": "abc-1", "reviews": "abc-2"}, keys)
+	})
+
+	t.Run("a key is generated", func(t *testing.T) {
+		f := &queryExecutionFixture{
+			services: services,
+			query:    `mutation { rateMovie(id: "1", rating: 5) }`,
+			expected: `{ "rateMovie": 5 }`,
+		}
+		f.checkSuccess(t)
+		assert.Len(t, keys["movies"], 32)
+		assert.NotEqual(t, "abc-1", keys["movies"])
+	})
+
+	t.Run("queries don't have keys", func(t *testing.T) {
+		queryServices := append([]testService(nil), services...)
+		queryServices[0].handler = handler("movies", `{ "data": { "movie": null } }`)
+		f := &queryExecutionFixture{
+			services:       queryServices,
+			query:          `{ movie(id: "1") }`,
+			expected:       `{ "movie": null }`,
+			idempotencyKey: "abc",
+		}
+		f.checkSuccess(t)
+		assert.Empty(t, keys["movies"])
+	})
+}
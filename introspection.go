@@ -3,6 +3,8 @@ package bramble
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/vektah/gqlparser/v2"
 	"github.com/vektah/gqlparser/v2/ast"
@@ -18,19 +20,84 @@ type Service struct {
 	Status       string
 
 	client *GraphQLClient
+	// transform is applied to the schema of the service before it's merged
+	transform        *SchemaTransform
+	transformedNames *transformedNames
+	// schemaConfig fetches the schema from another source than the service
+	// query
+	schemaConfig *ServiceSchemaConfig
+
+	// health of the schema updates, see Health
+	healthMutex sync.RWMutex
+	lastSuccess time.Time
+	lastError   string
+	lastErrorAt time.Time
+	latency     time.Duration
 }
 
-// NewService returns a new Service.
-func NewService(serviceURL string) *Service {
+// NewService returns a new Service. The options are applied to the client
+// used to update the service.
+func NewService(serviceURL string, opts ...ClientOpt) *Service {
+	opts = append([]ClientOpt{WithUserAgent(GenerateUserAgent("update"))}, opts...)
 	s := &Service{
 		ServiceURL: serviceURL,
-		client:     NewClient(WithUserAgent(GenerateUserAgent("update"))),
+		client:     NewClient(opts...),
 	}
 	return s
 }
 
 // Update queries the service's schema, name and version and updates its status.
 func (s *Service) Update() (bool, error) {
+	return s.recordUpdate(s.update)
+}
+
+// UpdateFromRegistry updates the service's schema, name and version from the
+// schema registry instead of querying the service.
+func (s *Service) UpdateFromRegistry(registry SchemaRegistry) (bool, error) {
+	return s.updateFrom(registry)
+}
+
+func (s *Service) updateFrom(source serviceSchemaSource) (bool, error) {
+	return s.recordUpdate(func() (bool, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), schemaRegistryTimeout)
+		defer cancel()
+		schema, err := source.ServiceSchema(ctx, s.ServiceURL)
+		if err != nil {
+			s.Status = "Unreachable"
+			return false, fmt.Errorf("unable to fetch schema from registry: %w", err)
+		}
+		return s.apply(schema.Name, schema.Version, schema.Schema)
+	})
+}
+
+// recordUpdate runs the update and records its result for the health
+func (s *Service) recordUpdate(update func() (bool, error)) (bool, error) {
+	start := time.Now()
+	updated, err := update()
+	latency := time.Since(start)
+
+	s.healthMutex.Lock()
+	defer s.healthMutex.Unlock()
+	s.latency = latency
+	if err != nil {
+		s.lastError = err.Error()
+		s.lastErrorAt = start
+	} else {
+		s.lastSuccess = start
+	}
+	return updated, err
+}
+
+func (s *Service) update() (bool, error) {
+	if s.schemaConfig != nil {
+		schema, err := s.schemaConfig.fetch(context.Background(), s.client, s.ServiceURL)
+		if err != nil {
+			s.Status = "Unreachable"
+			return false, err
+		}
+		return s.apply(s.schemaConfig.name(s.ServiceURL), s.schemaConfig.Version, schema)
+	}
+
 	req := NewRequest("{ service { name, version, schema} }")
 	response := struct {
 		Service struct {
@@ -45,13 +112,19 @@ func (s *Service) Update() (bool, error) {
 		return false, err
 	}
 
-	updated := response.Service.Schema != s.SchemaSource
+	return s.apply(response.Service.Name, response.Service.Version, response.Service.Schema)
+}
+
+// apply sets the service's name, version and schema, it returns whether the
+// schema changed
+func (s *Service) apply(name, version, source string) (bool, error) {
+	updated := source != s.SchemaSource
 
-	s.Name = response.Service.Name
-	s.Version = response.Service.Version
-	s.SchemaSource = response.Service.Schema
+	s.Name = name
+	s.Version = version
+	s.SchemaSource = source
 
-	schema, err := gqlparser.LoadSchema(&ast.Source{Name: s.ServiceURL, Input: response.Service.Schema})
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: s.ServiceURL, Input: source})
 	if err != nil {
 		s.Status = "Schema error"
 		return false, err
@@ -63,6 +136,16 @@ func (s *Service) Update() (bool, error) {
 		return updated, err
 	}
 
+	s.transformedNames = nil
+	if s.transform != nil {
+		var transformErr error
+		s.Schema, s.transformedNames, transformErr = s.transform.apply(schema)
+		if transformErr != nil {
+			s.Status = fmt.Sprintf("Invalid (%s)", transformErr)
+			return updated, transformErr
+		}
+	}
+
 	s.Status = "OK"
 	return updated, nil
 }
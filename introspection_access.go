@@ -0,0 +1,95 @@
+package bramble
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// introspectionDisabledCode is the error code returned when a client isn't
+// allowed to introspect the schema
+const introspectionDisabledCode = "INTROSPECTION_DISABLED"
+
+// IntrospectionConfig restricts the __schema and __type introspection queries
+// to a list of callers. The __typename field is always allowed.
+type IntrospectionConfig struct {
+	// Disabled blocks the introspection queries of the clients that aren't
+	// allowed by AllowedRoles or AllowedClients
+	Disabled bool `json:"disabled"`
+	// AllowedRoles are the roles (read from the roles claim) allowed to
+	// introspect the schema
+	AllowedRoles []string `json:"allowed-roles"`
+	// AllowedClients are the client IDs (see ClientIDHeader) allowed to
+	// introspect the schema
+	AllowedClients []string `json:"allowed-clients"`
+}
+
+// allowed returns whether the caller is allowed to introspect the schema
+func (c IntrospectionConfig) allowed(ctx context.Context, rolesClaim string) bool {
+	if !c.Disabled {
+		return true
+	}
+	if len(c.AllowedRoles) > 0 && hasAnyRole(rolesFromContext(ctx, rolesClaim), c.AllowedRoles) {
+		return true
+	}
+	if client := GetClientIDFromContext(ctx); client != "" && stringSliceContains(c.AllowedClients, client) {
+		return true
+	}
+	return false
+}
+
+// checkIntrospection returns an error if the operation introspects the schema
+// (or selects the schema of the gateway service, see service-name) and the
+// caller isn't allowed to. IntrospectionResult isn't restricted, its callers
+// (e.g. the GraphiQL plugin) must check SchemaRequestAllowed.
+func (s *ExecutableSchema) checkIntrospection(ctx context.Context, op *ast.OperationDefinition) *gqlerror.Error {
+	if !selectsIntrospectionFields(op.SelectionSet) && !(s.gatewayService != nil && selectsServiceSchema(op.SelectionSet)) {
+		return nil
+	}
+	if s.Introspection.allowed(ctx, s.RolesClaim) {
+		return nil
+	}
+	return &gqlerror.Error{
+		Message:    "GraphQL introspection is not allowed",
+		Extensions: map[string]interface{}{"code": introspectionDisabledCode},
+	}
+}
+
+// SchemaRequestAllowed returns whether the caller of the request is allowed
+// to fetch the schema, in SDL format or introspected
+func (s *ExecutableSchema) SchemaRequestAllowed(r *http.Request) bool {
+	ctx := r.Context()
+	if GetClientIDFromContext(ctx) == "" {
+		ctx = AddClientIDToContext(ctx, requestClientID(r, s.ClientIDHeader))
+	}
+	return s.Introspection.allowed(ctx, s.RolesClaim)
+}
+
+// selectsIntrospectionFields returns whether the root selection set selects
+// __schema or __type
+func selectsIntrospectionFields(selectionSet ast.SelectionSet) bool {
+	for _, f := range selectionSetToFields(selectionSet) {
+		if f.Name == "__schema" || f.Name == "__type" {
+			return true
+		}
+	}
+	return false
+}
+
+// selectsServiceSchema returns whether the root selection set selects the
+// schema of the service field
+func selectsServiceSchema(selectionSet ast.SelectionSet) bool {
+	for _, f := range selectionSetToFields(selectionSet) {
+		if f.Name != serviceRootFieldName {
+			continue
+		}
+		for _, sf := range selectionSetToFields(f.SelectionSet) {
+			if sf.Name == "schema" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package bramble
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestCheckIntrospection(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `type Query { hello: String }`})
+	operation := func(query string) *ast.OperationDefinition {
+		return gqlparser.MustLoadQuery(schema, query).Operations[0]
+	}
+	es := &ExecutableSchema{
+		Introspection: IntrospectionConfig{
+			Disabled:       true,
+			AllowedRoles:   []string{"admin"},
+			AllowedClients: []string{"schema-ci"},
+		},
+	}
+
+	t.Run("blocks introspection queries", func(t *testing.T) {
+		for _, query := range []string{
+			`{ __schema { queryType { name } } }`,
+			`{ __type(name: "Query") { name } }`,
+			`{ hello ... on Query { __schema { types { name } } } }`,
+		} {
+			err := es.checkIntrospection(context.Background(), operation(query))
+			require.NotNil(t, err, query)
+			assert.Equal(t, "GraphQL introspection is not allowed", err.Message)
+			assert.Equal(t, introspectionDisabledCode, err.Extensions["code"])
+		}
+	})
+
+	t.Run("allows typename", func(t *testing.T) {
+		assert.Nil(t, es.checkIntrospection(context.Background(), operation(`{ __typename hello }`)))
+	})
+
+	t.Run("allows roles", func(t *testing.T) {
+		ctx := AddClaimsToContext(context.Background(), map[string]interface{}{"roles": []interface{}{"admin"}})
+		assert.Nil(t, es.checkIntrospection(ctx, operation(`{ __schema { queryType { name } } }`)))
+
+		ctx = AddClaimsToContext(context.Background(), map[string]interface{}{"roles": []interface{}{"user"}})
+		assert.NotNil(t, es.checkIntrospection(ctx, operation(`{ __schema { queryType { name } } }`)))
+	})
+
+	t.Run("allows clients", func(t *testing.T) {
+		ctx := AddClientIDToContext(context.Background(), "schema-ci")
+		assert.Nil(t, es.checkIntrospection(ctx, operation(`{ __schema { queryType { name } } }`)))
+	})
+
+	t.Run("blocks the schema of the gateway service", func(t *testing.T) {
+		schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+			type Service { name: String! version: String! schema: String! }
+			type Query { service: Service! }
+		`})
+		es := &ExecutableSchema{
+			Introspection:  IntrospectionConfig{Disabled: true, AllowedClients: []string{"gateway"}},
+			gatewayService: &gatewayService{Name: "movies"},
+		}
+
+		op := gqlparser.MustLoadQuery(schema, `{ service { name schema } }`).Operations[0]
+		err := es.checkIntrospection(context.Background(), op)
+		require.NotNil(t, err)
+		assert.Equal(t, introspectionDisabledCode, err.Extensions["code"])
+		assert.Nil(t, es.checkIntrospection(AddClientIDToContext(context.Background(), "gateway"), op))
+
+		op = gqlparser.MustLoadQuery(schema, `{ service { name version } }`).Operations[0]
+		assert.Nil(t, es.checkIntrospection(context.Background(), op))
+	})
+
+	t.Run("enabled by default", func(t *testing.T) {
+		es := &ExecutableSchema{}
+		assert.Nil(t, es.checkIntrospection(context.Background(), operation(`{ __schema { queryType { name } } }`)))
+	})
+}
@@ -0,0 +1,250 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Join declares a field resolved by another service from a scalar foreign
+// key. For example the following join adds the field "author: User" to the
+// type Post, resolved with the query "user(id: $authorId)":
+//
+//	{"type": "Post", "field": "author", "key": "authorId", "query": "user"}
+//
+// This allows federating services that don't model the relationship (and
+// can't be modified).
+type Join struct {
+	// Type the field is added to
+	Type string `json:"type"`
+	// Name of the added field
+	Field string `json:"field"`
+	// Foreign key field on the type
+	Key string `json:"key"`
+	// Root query field resolving the object from the key
+	Query string `json:"query"`
+	// Query argument the key is passed as, defaults to "id"
+	Argument string `json:"argument"`
+}
+
+// JoinsMap is a mapping type -> field -> join
+type JoinsMap map[string]map[string]Join
+
+// Join returns the join for the given field, if any
+func (m JoinsMap) Join(typeName, fieldName string) (Join, bool) {
+	j, ok := m[typeName][fieldName]
+	return j, ok
+}
+
+// JoinStep contains the information needed to execute a join step
+type JoinStep struct {
+	// Query and argument used to fetch the joined objects
+	Query    string
+	Argument string
+	// Alias of the key field in the parent objects
+	KeyAlias string
+	// Alias of the join field in the parent objects
+	FieldAlias string
+}
+
+func (j Join) argument() string {
+	if j.Argument != "" {
+		return j.Argument
+	}
+	return idFieldName
+}
+
+func joinKeyAlias(j Join) string {
+	return "_join_" + j.Key
+}
+
+// applyJoins adds the join fields to the merged schema and registers their
+// location (the service resolving the key field)
+func applyJoins(schema *ast.Schema, locations FieldURLMap, joins []Join) (JoinsMap, error) {
+	result := make(JoinsMap)
+	for _, j := range joins {
+		def, ok := schema.Types[j.Type]
+		if !ok || def.Kind != ast.Object {
+			return nil, fmt.Errorf("invalid join %s.%s: object type %q not found", j.Type, j.Field, j.Type)
+		}
+		if def.Fields.ForName(j.Field) != nil {
+			return nil, fmt.Errorf("invalid join %s.%s: field already exists", j.Type, j.Field)
+		}
+		key := def.Fields.ForName(j.Key)
+		if key == nil {
+			return nil, fmt.Errorf("invalid join %s.%s: key field %q not found", j.Type, j.Field, j.Key)
+		}
+		if keyType := schema.Types[key.Type.Name()]; keyType == nil || keyType.Kind != ast.Scalar || key.Type.Elem != nil {
+			return nil, fmt.Errorf("invalid join %s.%s: key field %q must be a scalar", j.Type, j.Field, j.Key)
+		}
+		keyLocation, err := locations.URLFor(j.Type, "", j.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid join %s.%s: %w", j.Type, j.Field, err)
+		}
+
+		query := schema.Query.Fields.ForName(j.Query)
+		if query == nil {
+			return nil, fmt.Errorf("invalid join %s.%s: query %q not found", j.Type, j.Field, j.Query)
+		}
+		if query.Arguments.ForName(j.argument()) == nil {
+			return nil, fmt.Errorf("invalid join %s.%s: query %q has no argument %q", j.Type, j.Field, j.Query, j.argument())
+		}
+		if query.Type.Elem != nil {
+			return nil, fmt.Errorf("invalid join %s.%s: query %q must return a single object", j.Type, j.Field, j.Query)
+		}
+
+		newDef := *def
+		newDef.Fields = append(ast.FieldList{}, def.Fields...)
+		newDef.Fields = append(newDef.Fields, &ast.FieldDefinition{
+			Name:        j.Field,
+			Description: fmt.Sprintf("Resolved from %s with %s(%s:)", j.Key, j.Query, j.argument()),
+			Type:        ast.NamedType(query.Type.Name(), nil),
+		})
+		schema.Types[j.Type] = &newDef
+		locations.RegisterURL(j.Type, j.Field, keyLocation)
+
+		if _, ok := result[j.Type]; !ok {
+			result[j.Type] = make(map[string]Join)
+		}
+		result[j.Type][j.Field] = j
+	}
+	return result, nil
+}
+
+// executeJoinStep fetches the joined objects for every parent object at the
+// step's insertion point and inserts them under the join field.
+func (e *QueryExecution) executeJoinStep(ctx context.Context, step *QueryPlanStep, result map[string]interface{}) {
+	defer e.wg.Done()
+	defer e.recordStepTiming(step, time.Now())
+	defer func() {
+		if r := recover(); r != nil {
+			AddField(ctx, "panic", map[string]interface{}{
+				"err":        r,
+				"stacktrace": string(debug.Stack()),
+			})
+			e.addError(ctx, step, errors.New("an error happened during query execution"))
+		}
+	}()
+
+	if e.tracer != nil {
+		contextSpan := opentracing.SpanFromContext(ctx)
+		if contextSpan != nil {
+			span := e.tracer.StartSpan(step.ServiceName, opentracing.ChildOf(contextSpan.Context()))
+			ctx = opentracing.ContextWithSpan(ctx, span)
+			defer span.Finish()
+		}
+	}
+
+	e.m.Lock()
+	result = e.prepareMapForInsertion(step.InsertionPoint, result)
+	targets := buildJoinTargets(step.InsertionPoint, result, nil)
+	e.m.Unlock()
+
+	selectionSet := e.formatStepSelectionSet(ctx, step)
+	var b strings.Builder
+	var queried []insertionTarget
+	b.WriteString("{")
+	for _, target := range targets {
+		e.m.Lock()
+		key := joinKeyLiteral(target.Target[step.Join.KeyAlias])
+		if key == "" {
+			target.Target[step.Join.FieldAlias] = nil
+		}
+		e.m.Unlock()
+		if key == "" {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("%s: %s(%s: %s) %s ", nodeAlias(len(queried)), step.Join.Query, step.Join.Argument, key, selectionSet))
+		queried = append(queried, target)
+	}
+	b.WriteString("}")
+
+	if len(queried) == 0 {
+		return
+	}
+
+	if atomic.AddInt64(&e.RequestCount, 1) > e.maxRequest {
+		return
+	}
+
+	var resp interface{} = &map[string]interface{}{}
+	if e.rawJSON {
+		resp = &map[string]json.RawMessage{}
+	}
+	req := NewRequest(b.String())
+	req.Headers = GetOutgoingServiceRequestHeadersFromContext(ctx, step.ServiceURL)
+	err := e.request(ctx, step, req, resp)
+	if err != nil {
+		prefixes := make([]ast.Path, 0, len(queried))
+		for _, target := range queried {
+			prefixes = append(prefixes, appendPath(target.Path, ast.PathName(step.Join.FieldAlias)))
+		}
+		e.addErrorAtPaths(ctx, step, prefixes, "", err)
+	}
+
+	var received int
+	e.m.Lock()
+	for i, target := range queried {
+		switch resp := resp.(type) {
+		case *map[string]interface{}:
+			target.Target[step.Join.FieldAlias] = (*resp)[nodeAlias(i)]
+			received = len(*resp)
+		case *map[string]json.RawMessage:
+			target.Target[step.Join.FieldAlias] = rawValue((*resp)[nodeAlias(i)])
+			received = len(*resp)
+		}
+	}
+	e.m.Unlock()
+
+	// the service only returned errors, the joined objects are all null
+	if err != nil && received == 0 {
+		return
+	}
+
+	e.executeChildSteps(ctx, step.Then, result)
+}
+
+// buildJoinTargets returns the objects at the insertion point
+func buildJoinTargets(insertionPoint []string, in interface{}, path ast.Path) []insertionTarget {
+	switch in := in.(type) {
+	case map[string]interface{}:
+		if len(insertionPoint) == 0 {
+			return []insertionTarget{{Target: in, Path: path}}
+		}
+		return buildJoinTargets(insertionPoint[1:], in[insertionPoint[0]], appendPath(path, ast.PathName(insertionPoint[0])))
+	case []interface{}:
+		var result []insertionTarget
+		for i, e := range in {
+			result = append(result, buildJoinTargets(insertionPoint, e, appendPath(path, ast.PathIndex(i)))...)
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// joinKeyLiteral returns the GraphQL literal for the key value, or an empty
+// string if the key is null
+func joinKeyLiteral(v interface{}) string {
+	var b []byte
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case json.RawMessage:
+		b = v
+	default:
+		b, _ = json.Marshal(v)
+	}
+	if s := string(b); s != "null" {
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package bramble
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryExecutionWithJoin(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `
+				type Post {
+					id: ID!
+					title: String
+					authorId: ID
+				}
+
+				type Query {
+					posts: [Post!]!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var req map[string]string
+					json.NewDecoder(r.Body).Decode(&req)
+					assert.Contains(t, req["query"], "_join_authorId: authorId")
+					w.Write([]byte(`{
+						"data": {
+							"posts": [
+								{ "title": "Post 1", "_join_authorId": "1" },
+								{ "title": "Post 2", "_join_authorId": "2" },
+								{ "title": "Post 3", "_join_authorId": null }
+							]
+						}
+					}`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
+				type User @boundary {
+					id: ID!
+					name: String
+				}
+
+				type Query {
+					user(id: ID!): User
+					getUser(id: ID!): User @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var req map[string]string
+					json.NewDecoder(r.Body).Decode(&req)
+					assert.Contains(t, req["query"], `_0: user(id: "1")`)
+					assert.Contains(t, req["query"], `_1: user(id: "2")`)
+					w.Write([]byte(`{
+						"data": {
+							"_0": { "_id": "1", "name": "Alice" },
+							"_1": { "_id": "2", "name": "Bob" }
+						}
+					}`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
+				type User @boundary {
+					id: ID!
+					reviewCount: Int
+				}
+
+				type Query {
+					getUser(id: ID!): User @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"_0": { "_id": "1", "reviewCount": 3 },
+							"_1": { "_id": "2", "reviewCount": 5 }
+						}
+					}`))
+				}),
+			},
+		},
+		joins: []Join{
+			{Type: "Post", Field: "author", Key: "authorId", Query: "user"},
+		},
+		query: `{
+			posts {
+				title
+				author {
+					name
+					reviewCount
+				}
+			}
+		}`,
+		expected: `{
+			"posts": [
+				{ "title": "Post 1", "author": { "name": "Alice", "reviewCount": 3 } },
+				{ "title": "Post 2", "author": { "name": "Bob", "reviewCount": 5 } },
+				{ "title": "Post 3", "author": null }
+			]
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func TestApplyJoins(t *testing.T) {
+	schema := loadSchema(`
+		type Post {
+			id: ID!
+			authorId: ID
+			tags: [String!]
+		}
+
+		type User {
+			id: ID!
+		}
+
+		type Query {
+			posts: [Post!]!
+			user(id: ID!): User
+			users(ids: [ID!]!): [User]
+		}`)
+	locations := FieldURLMap{}
+	locations.RegisterURL("Post", "id", "A")
+	locations.RegisterURL("Post", "authorId", "A")
+	locations.RegisterURL("Post", "tags", "A")
+
+	t.Run("adds the field", func(t *testing.T) {
+		joins, err := applyJoins(schema, locations, []Join{
+			{Type: "Post", Field: "author", Key: "authorId", Query: "user"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "User", schema.Types["Post"].Fields.ForName("author").Type.String())
+		url, err := locations.URLFor("Post", "", "author")
+		require.NoError(t, err)
+		assert.Equal(t, "A", url)
+		_, ok := joins.Join("Post", "author")
+		assert.True(t, ok)
+	})
+
+	for _, tc := range []struct {
+		join Join
+		err  string
+	}{
+		{Join{Type: "Comment", Field: "author", Key: "authorId", Query: "user"}, `invalid join Comment.author: object type "Comment" not found`},
+		{Join{Type: "Post", Field: "id", Key: "authorId", Query: "user"}, "invalid join Post.id: field already exists"},
+		{Join{Type: "Post", Field: "writer", Key: "writerId", Query: "user"}, `invalid join Post.writer: key field "writerId" not found`},
+		{Join{Type: "Post", Field: "tagObjects", Key: "tags", Query: "user"}, `invalid join Post.tagObjects: key field "tags" must be a scalar`},
+		{Join{Type: "Post", Field: "writer", Key: "authorId", Query: "writer"}, `invalid join Post.writer: query "writer" not found`},
+		{Join{Type: "Post", Field: "writer", Key: "authorId", Query: "user", Argument: "key"}, `invalid join Post.writer: query "user" has no argument "key"`},
+		{Join{Type: "Post", Field: "writer", Key: "authorId", Query: "users", Argument: "ids"}, `invalid join Post.writer: query "users" must return a single object`},
+	} {
+		_, err := applyJoins(schema, locations, []Join{tc.join})
+		assert.EqualError(t, err, tc.err)
+	}
+}
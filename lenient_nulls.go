@@ -0,0 +1,51 @@
+package bramble
+
+import (
+	"fmt"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// nonNullViolationCode is the error code of the null values returned by the
+// lenient services for non-nullable fields
+const nonNullViolationCode = "NON_NULL_VIOLATION"
+
+// lenientNulls relaxes the nullability of the fields resolved by the lenient
+// services: a null value (or null list element) returned for a non-nullable
+// field stops bubbling up at the field, as if it was nullable, so a partial
+// outage of the service doesn't null its whole branch of the response.
+type lenientNulls struct {
+	resultValidation
+	// urls are the URLs of the lenient services
+	urls map[string]bool
+}
+
+// relaxNull records the error of the null value of the non-nullable field (or
+// element of its list) if no error was recorded while marshalling it. It
+// returns false if the service resolving the field isn't lenient, the null
+// bubbles up to the parent then.
+func (m *resultMarshaler) relaxNull(field fieldCoordinate, errCount int, path ast.Path) bool {
+	if m.lenient == nil {
+		return false
+	}
+	name, url := m.lenient.service(field)
+	if !m.lenient.urls[url] {
+		return false
+	}
+
+	coordinate := field.typename + "." + field.field
+	promLenientNullValues.WithLabelValues(name, coordinate).Inc()
+	if len(m.errs) == errCount {
+		m.errs = append(m.errs, &gqlerror.Error{
+			Message: fmt.Sprintf("service %q returned null for non-nullable field %s", name, coordinate),
+			Path:    appendPath(path),
+			Extensions: map[string]interface{}{
+				"code":        nonNullViolationCode,
+				"serviceName": name,
+				"serviceUrl":  url,
+			},
+		})
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package bramble
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestQueryExecutionLenientNulls(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String!
+				}
+
+				type Query {
+					movies: [Movie!]!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "movies": [{ "_id": "1", "title": "Test title" }, { "_id": "2", "title": "Other title" }] } }`))
+				}),
+			},
+			{
+				name: "ratings",
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					rating: Float!
+					tags: [String!]!
+				}
+
+				type Query {
+					movie(id: ID!): Movie
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": {
+						"_0": { "_id": "1", "rating": null, "tags": ["classic"] },
+						"_1": { "_id": "2", "rating": 4.5, "tags": ["new"] }
+					} }`))
+				}),
+				lenientNulls: true,
+			},
+		},
+		query: `{
+			movies {
+				title
+				rating
+				tags
+			}
+		}`,
+		errors: gqlerror.List{
+			{
+				Message:    `service "ratings" returned null for non-nullable field Movie.rating`,
+				Path:       ast.Path{ast.PathName("movies"), ast.PathIndex(0), ast.PathName("rating")},
+				Extensions: map[string]interface{}{"code": nonNullViolationCode, "serviceName": "ratings"},
+			},
+		},
+	}
+	f.run(t)
+	jsonEqWithOrder(t, `{
+		"movies": [
+			{ "title": "Test title", "rating": null, "tags": ["classic"] },
+			{ "title": "Other title", "rating": 4.5, "tags": ["new"] }
+		]
+	}`, string(f.resp.Data))
+
+	// the null values bubble up to the closest nullable field otherwise
+	f.services[1].lenientNulls = false
+	f.errors = gqlerror.List{
+		{
+			Message: `got a null response for non-nullable field "rating"`,
+			Path:    ast.Path{ast.PathName("movies"), ast.PathIndex(0), ast.PathName("rating")},
+		},
+	}
+	f.run(t)
+	jsonEqWithOrder(t, `null`, string(f.resp.Data))
+}
+
+func TestMarshalResultLenientNulls(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		type Movie {
+			title: String!
+			tags: [String!]!
+		}
+
+		type Query {
+			movie: Movie!
+		}`})
+	query := gqlparser.MustLoadQuery(schema, `{ movie { title tags } }`)
+	data := map[string]interface{}{
+		"movie": map[string]interface{}{
+			"title": "Test title",
+			"tags":  []interface{}{"new", nil},
+		},
+	}
+	lenient := &lenientNulls{
+		resultValidation: resultValidation{
+			locations: FieldURLMap{"Query.movie": "http://movies", "Movie.title": "http://movies", "Movie.tags": "http://tags"},
+			services:  map[string]*Service{"http://tags": {Name: "tags"}},
+		},
+		urls: map[string]bool{"http://tags": true},
+	}
+
+	res, err := marshalValidatedResult(data, query.Operations[0].SelectionSet, schema, &ast.Type{NamedType: "Query"}, nil, lenient, nil)
+	assert.JSONEq(t, `{ "movie": { "title": "Test title", "tags": ["new", null] } }`, string(res))
+	assert.Equal(t, gqlerror.List{
+		{
+			Message:    `service "tags" returned null for non-nullable field Movie.tags`,
+			Path:       ast.Path{ast.PathName("movie"), ast.PathName("tags"), ast.PathIndex(1)},
+			Extensions: map[string]interface{}{"code": nonNullViolationCode, "serviceName": "tags", "serviceUrl": "http://tags"},
+		},
+	}, err)
+
+	// the null bubbles up if the service isn't lenient, up to the closest
+	// field of a lenient service
+	lenient.urls = map[string]bool{"http://movies": true}
+	res, err = marshalValidatedResult(data, query.Operations[0].SelectionSet, schema, &ast.Type{NamedType: "Query"}, nil, lenient, nil)
+	assert.JSONEq(t, `{ "movie": null }`, string(res))
+	assert.Equal(t, gqlerror.List{
+		{
+			Message: "got null element in list of non-null elements",
+			Path:    ast.Path{ast.PathName("movie"), ast.PathName("tags"), ast.PathIndex(1)},
+		},
+	}, err)
+}
@@ -0,0 +1,255 @@
+package bramble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LoadBalancingStrategy is the strategy used to pick the endpoint of a service
+// a request is sent to
+type LoadBalancingStrategy string
+
+const (
+	// RoundRobinLoadBalancing sends the requests to each endpoint in turn
+	RoundRobinLoadBalancing LoadBalancingStrategy = "round-robin"
+	// LeastPendingLoadBalancing sends the requests to the endpoint with the
+	// fewest requests in flight
+	LeastPendingLoadBalancing LoadBalancingStrategy = "least-pending"
+	// WeightedLoadBalancing sends the requests to each endpoint in proportion
+	// to its weight
+	WeightedLoadBalancing LoadBalancingStrategy = "weighted"
+)
+
+const (
+	// endpointFailureThreshold is the number of consecutive failed requests
+	// after which an endpoint is excluded from the load balancing
+	endpointFailureThreshold = 3
+	// endpointExclusionDuration is the time a failing endpoint is excluded
+	// for, it's then tried again
+	endpointExclusionDuration = 10 * time.Second
+)
+
+// ServiceEndpoints are the URLs the requests to a service are load balanced
+// across
+type ServiceEndpoints struct {
+	URLs []string `json:"urls"`
+	// Strategy defaults to round-robin
+	Strategy LoadBalancingStrategy `json:"strategy"`
+	// Weights of the URLs, only used by the weighted strategy
+	Weights []int `json:"weights"`
+	// Mutations are the endpoints the root mutation steps are sent to (e.g.
+	// the primary), the other steps use URLs (e.g. the read replicas)
+	Mutations *ServiceEndpoints `json:"mutations"`
+}
+
+// Validate checks the strategy and weights are valid
+func (e ServiceEndpoints) Validate() error {
+	if e.Mutations != nil {
+		if len(e.Mutations.URLs) == 0 {
+			return errors.New("mutations: at least one URL is required")
+		}
+		if e.Mutations.Mutations != nil {
+			return errors.New("mutations: nested mutations endpoints are not supported")
+		}
+		if err := e.Mutations.Validate(); err != nil {
+			return fmt.Errorf("mutations: %w", err)
+		}
+	}
+	switch e.Strategy {
+	case "", RoundRobinLoadBalancing, LeastPendingLoadBalancing:
+	case WeightedLoadBalancing:
+		if len(e.Weights) != len(e.URLs) {
+			return fmt.Errorf("expected %d weights, got %d", len(e.URLs), len(e.Weights))
+		}
+		for _, w := range e.Weights {
+			if w <= 0 {
+				return fmt.Errorf("weights must be positive, got %d", w)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown load balancing strategy %q", e.Strategy)
+	}
+	return nil
+}
+
+// forStep returns the endpoints the step is sent to and the key of their
+// balancer: the root mutation steps use the mutations endpoints if any
+func (e ServiceEndpoints) forStep(step *QueryPlanStep) (string, ServiceEndpoints) {
+	if e.Mutations != nil && step.ParentType == mutationObjectName {
+		return step.ServiceURL + "#mutation", *e.Mutations
+	}
+	return step.ServiceURL, e
+}
+
+// allURLs returns the URLs of the endpoints, including the mutations
+// endpoints
+func (e ServiceEndpoints) allURLs() []string {
+	if e.Mutations == nil {
+		return e.URLs
+	}
+	urls := append([]string{}, e.URLs...)
+	return append(urls, e.Mutations.URLs...)
+}
+
+type endpoint struct {
+	url     string
+	weight  int
+	pending int
+	// current is the current weight of the smooth weighted round-robin
+	current       int
+	failures      int
+	excludedUntil time.Time
+}
+
+// endpointBalancer picks the endpoint of a service each request is sent to,
+// excluding the endpoints failing repeatedly. It is safe for concurrent use.
+type endpointBalancer struct {
+	config ServiceEndpoints
+	now    func() time.Time
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	next      int
+}
+
+func newEndpointBalancer(config ServiceEndpoints) *endpointBalancer {
+	b := &endpointBalancer{
+		config: config,
+		now:    time.Now,
+	}
+	for i, url := range config.URLs {
+		weight := 1
+		if config.Strategy == WeightedLoadBalancing && i < len(config.Weights) && config.Weights[i] > 0 {
+			weight = config.Weights[i]
+		}
+		b.endpoints = append(b.endpoints, &endpoint{url: url, weight: weight})
+	}
+	return b
+}
+
+// acquire picks the endpoint for a request, it must be released with the
+// result of the request. If every endpoint is excluded they're all
+// considered, as there is nothing better to do.
+func (b *endpointBalancer) acquire() *endpoint {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	var available []*endpoint
+	for _, ep := range b.endpoints {
+		if !now.Before(ep.excludedUntil) {
+			available = append(available, ep)
+		}
+	}
+	if len(available) == 0 {
+		available = b.endpoints
+	}
+
+	var ep *endpoint
+	switch b.config.Strategy {
+	case LeastPendingLoadBalancing:
+		// start from the next endpoint so ties are spread evenly
+		for i := range available {
+			candidate := available[(b.next+i)%len(available)]
+			if ep == nil || candidate.pending < ep.pending {
+				ep = candidate
+			}
+		}
+		b.next++
+	case WeightedLoadBalancing:
+		total := 0
+		for _, candidate := range available {
+			candidate.current += candidate.weight
+			total += candidate.weight
+			if ep == nil || candidate.current > ep.current {
+				ep = candidate
+			}
+		}
+		ep.current -= total
+	default:
+		ep = available[b.next%len(available)]
+		b.next++
+	}
+
+	ep.pending++
+	return ep
+}
+
+// release records the result of a request sent to the endpoint. Only
+// transport errors count as failures, GraphQL errors are a valid response.
+func (b *endpointBalancer) release(ep *endpoint, service string, err error) {
+	if b == nil || ep == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ep.pending--
+	var graphqlErrors GraphqlErrors
+	switch {
+	case err == nil || errors.As(err, &graphqlErrors):
+		promServiceEndpointRequests.WithLabelValues(service, ep.url, "success").Inc()
+		if ep.failures > 0 || !ep.excludedUntil.IsZero() {
+			ep.failures = 0
+			ep.excludedUntil = time.Time{}
+			promServiceEndpointExcluded.WithLabelValues(service, ep.url).Set(0)
+		}
+	case errors.Is(err, context.Canceled):
+		// cancelled by the gateway (e.g. hedged request), not a failure
+	default:
+		promServiceEndpointRequests.WithLabelValues(service, ep.url, "error").Inc()
+		ep.failures++
+		if ep.failures >= endpointFailureThreshold {
+			ep.failures = 0
+			ep.excludedUntil = b.now().Add(endpointExclusionDuration)
+			promServiceEndpointExcluded.WithLabelValues(service, ep.url).Set(1)
+			log.WithFields(log.Fields{
+				"service":  service,
+				"endpoint": ep.url,
+				"until":    ep.excludedUntil,
+			}).WithError(err).Warn("excluding failing service endpoint")
+		}
+	}
+}
+
+// endpointBalancers contains the balancer of every service with endpoints,
+// shared by all the queries. It is safe for concurrent use.
+type endpointBalancers struct {
+	mu        sync.Mutex
+	balancers map[string]*endpointBalancer
+}
+
+func newEndpointBalancers() *endpointBalancers {
+	return &endpointBalancers{
+		balancers: make(map[string]*endpointBalancer),
+	}
+}
+
+// get returns the balancer with the given key (the service URL, or its
+// mutations endpoints), or nil if it has no endpoints. The balancer is
+// replaced if the endpoints changed.
+func (b *endpointBalancers) get(key string, config ServiceEndpoints) *endpointBalancer {
+	if b == nil || len(config.URLs) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	balancer, ok := b.balancers[key]
+	if !ok || !reflect.DeepEqual(balancer.config, config) {
+		balancer = newEndpointBalancer(config)
+		b.balancers[key] = balancer
+	}
+	return balancer
+}
@@ -0,0 +1,171 @@
+package bramble
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pickEndpoints(b *endpointBalancer, n int) []string {
+	var urls []string
+	for i := 0; i < n; i++ {
+		ep := b.acquire()
+		urls = append(urls, ep.url)
+		b.release(ep, "test", nil)
+	}
+	return urls
+}
+
+func TestEndpointBalancerRoundRobin(t *testing.T) {
+	b := newEndpointBalancer(ServiceEndpoints{URLs: []string{"a", "b", "c"}})
+	assert.Equal(t, []string{"a", "b", "c", "a", "b", "c"}, pickEndpoints(b, 6))
+}
+
+func TestEndpointBalancerWeighted(t *testing.T) {
+	b := newEndpointBalancer(ServiceEndpoints{
+		URLs:     []string{"a", "b"},
+		Strategy: WeightedLoadBalancing,
+		Weights:  []int{3, 1},
+	})
+	assert.Equal(t, []string{"a", "a", "b", "a", "a", "a", "b", "a"}, pickEndpoints(b, 8))
+}
+
+func TestEndpointBalancerLeastPending(t *testing.T) {
+	b := newEndpointBalancer(ServiceEndpoints{
+		URLs:     []string{"a", "b", "c"},
+		Strategy: LeastPendingLoadBalancing,
+	})
+	a := b.acquire()
+	require.Equal(t, "a", a.url)
+	bb := b.acquire()
+	require.Equal(t, "b", bb.url)
+	b.release(a, "test", nil)
+
+	// a and c have no pending requests, b has one
+	assert.NotEqual(t, "b", b.acquire().url)
+	assert.NotEqual(t, "b", b.acquire().url)
+}
+
+func TestEndpointBalancerExclusion(t *testing.T) {
+	now := time.Now()
+	b := newEndpointBalancer(ServiceEndpoints{URLs: []string{"a", "b"}})
+	b.now = func() time.Time { return now }
+
+	fail := func(url string, err error) {
+		for {
+			ep := b.acquire()
+			if ep.url == url {
+				b.release(ep, "test", err)
+				return
+			}
+			b.release(ep, "test", nil)
+		}
+	}
+
+	for i := 0; i < endpointFailureThreshold; i++ {
+		fail("a", GraphqlErrors{{Message: "graphql error"}})
+	}
+	assert.ElementsMatch(t, []string{"a", "b"}, pickEndpoints(b, 2), "GraphQL errors aren't failures")
+
+	for i := 0; i < endpointFailureThreshold; i++ {
+		fail("a", errors.New("connection refused"))
+	}
+	assert.Equal(t, []string{"b", "b", "b"}, pickEndpoints(b, 3))
+
+	now = now.Add(endpointExclusionDuration)
+	assert.ElementsMatch(t, []string{"a", "b"}, pickEndpoints(b, 2))
+}
+
+func TestEndpointBalancerAllExcluded(t *testing.T) {
+	b := newEndpointBalancer(ServiceEndpoints{URLs: []string{"a"}})
+	for i := 0; i < endpointFailureThreshold; i++ {
+		b.release(b.acquire(), "test", errors.New("connection refused"))
+	}
+	assert.Equal(t, []string{"a"}, pickEndpoints(b, 1))
+}
+
+func TestServiceEndpointsValidate(t *testing.T) {
+	assert.NoError(t, ServiceEndpoints{URLs: []string{"a"}}.Validate())
+	assert.NoError(t, ServiceEndpoints{URLs: []string{"a"}, Strategy: LeastPendingLoadBalancing}.Validate())
+	assert.NoError(t, ServiceEndpoints{URLs: []string{"a", "b"}, Strategy: WeightedLoadBalancing, Weights: []int{1, 2}}.Validate())
+	assert.Error(t, ServiceEndpoints{URLs: []string{"a", "b"}, Strategy: WeightedLoadBalancing, Weights: []int{1}}.Validate())
+	assert.Error(t, ServiceEndpoints{URLs: []string{"a"}, Strategy: WeightedLoadBalancing, Weights: []int{0}}.Validate())
+	assert.Error(t, ServiceEndpoints{URLs: []string{"a"}, Strategy: "random"}.Validate())
+	assert.NoError(t, ServiceEndpoints{Mutations: &ServiceEndpoints{URLs: []string{"a"}}}.Validate())
+	assert.Error(t, ServiceEndpoints{Mutations: &ServiceEndpoints{}}.Validate())
+	assert.Error(t, ServiceEndpoints{Mutations: &ServiceEndpoints{URLs: []string{"a"}, Strategy: "random"}}.Validate())
+	assert.Error(t, ServiceEndpoints{Mutations: &ServiceEndpoints{URLs: []string{"a"}, Mutations: &ServiceEndpoints{URLs: []string{"b"}}}}.Validate())
+}
+
+func TestServiceEndpointsAllURLs(t *testing.T) {
+	assert.Equal(t, []string{"a"}, ServiceEndpoints{URLs: []string{"a"}}.allURLs())
+	assert.Equal(t, []string{"a", "b"}, ServiceEndpoints{URLs: []string{"a"}, Mutations: &ServiceEndpoints{URLs: []string{"b"}}}.allURLs())
+}
+
+func TestQueryExecutionLoadBalancedRequest(t *testing.T) {
+	newServer := func(body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+	}
+	a := newServer(`{ "data": { "a": "a" } }`)
+	defer a.Close()
+	b := newServer(`{ "data": { "a": "b" } }`)
+	defer b.Close()
+
+	e := newQueryExecution(NewClient(), nil, nil, 50, nil)
+	e.endpointBalancers = newEndpointBalancers()
+	e.serviceEndpoints = map[string]ServiceEndpoints{
+		"http://service/query": {URLs: []string{a.URL, b.URL}},
+	}
+
+	var results []interface{}
+	for i := 0; i < 4; i++ {
+		resp := map[string]interface{}{}
+		err := e.request(context.Background(), &QueryPlanStep{ServiceURL: "http://service/query"}, NewRequest("{ a }"), &resp)
+		require.NoError(t, err)
+		results = append(results, resp["a"])
+	}
+	assert.Equal(t, []interface{}{"a", "b", "a", "b"}, results)
+}
+
+func TestQueryExecutionMutationEndpoints(t *testing.T) {
+	newServer := func(body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+	}
+	replica := newServer(`{ "data": { "a": "replica" } }`)
+	defer replica.Close()
+	primary := newServer(`{ "data": { "a": "primary" } }`)
+	defer primary.Close()
+
+	e := newQueryExecution(NewClient(), nil, nil, 50, nil)
+	e.endpointBalancers = newEndpointBalancers()
+	e.serviceEndpoints = map[string]ServiceEndpoints{
+		"http://service/query": {
+			URLs:      []string{replica.URL},
+			Mutations: &ServiceEndpoints{URLs: []string{primary.URL}},
+		},
+	}
+
+	for _, tc := range []struct {
+		parentType string
+		expected   string
+	}{
+		{queryObjectName, "replica"},
+		{mutationObjectName, "primary"},
+		{"Movie", "replica"},
+	} {
+		resp := map[string]interface{}{}
+		err := e.request(context.Background(), &QueryPlanStep{ServiceURL: "http://service/query", ParentType: tc.parentType}, NewRequest("{ a }"), &resp)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, resp["a"], tc.parentType)
+	}
+}
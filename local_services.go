@@ -0,0 +1,96 @@
+package bramble
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	log "github.com/sirupsen/logrus"
+)
+
+// localServiceScheme is the URL scheme of the services running in the gateway
+// process, their requests are handled without going over the network
+const localServiceScheme = "local://"
+
+var localServices = struct {
+	sync.RWMutex
+	handlers map[string]http.Handler
+}{handlers: map[string]http.Handler{}}
+
+// RegisterLocalService registers a GraphQL handler running in the gateway
+// process as a federated service. It is added to the services of the gateway
+// with the URL "local://<name>" and its requests are passed directly to the
+// handler. Like any other service it must implement the `service` query.
+// Subscriptions aren't supported by local services.
+func RegisterLocalService(name string, h http.Handler) string {
+	url := localServiceScheme + name
+	localServices.Lock()
+	defer localServices.Unlock()
+	if _, found := localServices.handlers[url]; found {
+		log.Fatalf("local service %q already registered", name)
+	}
+	localServices.handlers[url] = h
+	return url
+}
+
+// RegisterLocalExecutableSchema registers a gqlgen executable schema as a
+// local service, see RegisterLocalService
+func RegisterLocalExecutableSchema(name string, es graphql.ExecutableSchema) string {
+	return RegisterLocalService(name, handler.NewDefaultServer(es))
+}
+
+// localServiceURLs returns the URLs of the registered local services
+func localServiceURLs() []string {
+	localServices.RLock()
+	defer localServices.RUnlock()
+	urls := make([]string, 0, len(localServices.handlers))
+	for url := range localServices.handlers {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+func isLocalServiceURL(url string) bool {
+	return strings.HasPrefix(url, localServiceScheme)
+}
+
+// localServiceTransport returns the transport passing the requests to the
+// registered local service, or nil if the URL isn't a registered local
+// service
+func localServiceTransport(url string) http.RoundTripper {
+	if !isLocalServiceURL(url) {
+		return nil
+	}
+	localServices.RLock()
+	h, ok := localServices.handlers[url]
+	localServices.RUnlock()
+	if !ok {
+		return nil
+	}
+	return localTransport{handler: h}
+}
+
+// isRegisteredLocalService returns whether a local service is registered
+// under the name
+func isRegisteredLocalService(name string) bool {
+	localServices.RLock()
+	defer localServices.RUnlock()
+	_, found := localServices.handlers[localServiceScheme+name]
+	return found
+}
+
+// localTransport passes the requests to the handler of a local service
+type localTransport struct {
+	handler http.Handler
+}
+
+func (t localTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
@@ -0,0 +1,48 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalService(t *testing.T) {
+	url := RegisterLocalService("local-test", testServiceHandler("local", `type Service { name: String! version: String! schema: String! }
+	type Query { requestID: String service: Service! }`, func(w http.ResponseWriter, r *http.Request) {
+		// the request context is the context of the gateway query
+		fmt.Fprintf(w, `{ "data": { "requestID": %q } }`, GetRequestIDFromContext(r.Context()))
+	}))
+	t.Cleanup(func() {
+		localServices.Lock()
+		delete(localServices.handlers, url)
+		localServices.Unlock()
+	})
+	assert.Equal(t, "local://local-test", url)
+	assert.Contains(t, localServiceURLs(), url)
+
+	es := newExecutableSchema(nil, 50, nil, NewService(url))
+	require.NoError(t, es.UpdateSchema(true))
+	assert.Equal(t, "local", es.Services[url].Name)
+
+	body, _ := json.Marshal(map[string]string{"query": "{ requestID }"})
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestIDHeader, "abc")
+	rec := httptest.NewRecorder()
+	NewGateway(es, nil).Router().ServeHTTP(rec, req)
+	assert.JSONEq(t, `{ "data": { "requestID": "abc" } }`, rec.Body.String())
+}
+
+func TestLocalServiceNotRegistered(t *testing.T) {
+	var resp map[string]interface{}
+	err := NewClient().Request(context.Background(), "local://unknown", NewRequest("{ foo }"), &resp)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unsupported protocol scheme "local"`)
+}
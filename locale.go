@@ -0,0 +1,92 @@
+package bramble
+
+import (
+	"context"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// RequestLocale contains the locale information of the incoming request
+type RequestLocale struct {
+	Locale   string
+	Timezone string
+	Currency string
+}
+
+// LocaleArguments contains the names of the field arguments the request locale
+// values are injected into. An empty name disables the injection for that
+// value.
+type LocaleArguments struct {
+	Locale   string `json:"locale"`
+	Timezone string `json:"timezone"`
+	Currency string `json:"currency"`
+}
+
+// AddLocaleToContext adds the request locale to the context
+func AddLocaleToContext(ctx context.Context, locale RequestLocale) context.Context {
+	return context.WithValue(ctx, localeContextKey, locale)
+}
+
+// GetLocaleFromContext returns the request locale stored in the context
+func GetLocaleFromContext(ctx context.Context) (RequestLocale, bool) {
+	locale, ok := ctx.Value(localeContextKey).(RequestLocale)
+	return locale, ok
+}
+
+// injectLocaleArguments sets the locale arguments on every field of the
+// selection set accepting them, unless the argument was explicitly provided.
+// The selection set is modified in place and must not be shared.
+func injectLocaleArguments(schema *ast.Schema, selectionSet ast.SelectionSet, arguments LocaleArguments, locale RequestLocale) {
+	values := map[string]string{}
+	if arguments.Locale != "" && locale.Locale != "" {
+		values[arguments.Locale] = locale.Locale
+	}
+	if arguments.Timezone != "" && locale.Timezone != "" {
+		values[arguments.Timezone] = locale.Timezone
+	}
+	if arguments.Currency != "" && locale.Currency != "" {
+		values[arguments.Currency] = locale.Currency
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	injectArguments(schema, selectionSet, values)
+}
+
+func injectArguments(schema *ast.Schema, selectionSet ast.SelectionSet, values map[string]string) {
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if selection.Definition != nil {
+				var args ast.ArgumentList
+				for _, argDef := range selection.Definition.Arguments {
+					value, ok := values[argDef.Name]
+					if !ok || selection.Arguments.ForName(argDef.Name) != nil {
+						continue
+					}
+					kind := ast.StringValue
+					if t, ok := schema.Types[argDef.Type.Name()]; ok && t.Kind == ast.Enum {
+						kind = ast.EnumValue
+					}
+					args = append(args, &ast.Argument{
+						Name:  argDef.Name,
+						Value: &ast.Value{Kind: kind, Raw: value, Definition: schema.Types[argDef.Type.Name()]},
+					})
+				}
+				if len(args) > 0 {
+					// the argument list can be shared with the cached
+					// operation, so we need to make a copy
+					newArgs := make(ast.ArgumentList, 0, len(selection.Arguments)+len(args))
+					newArgs = append(newArgs, selection.Arguments...)
+					selection.Arguments = append(newArgs, args...)
+				}
+			}
+			injectArguments(schema, selection.SelectionSet, values)
+		case *ast.InlineFragment:
+			injectArguments(schema, selection.SelectionSet, values)
+		case *ast.FragmentSpread:
+			injectArguments(schema, selection.Definition.SelectionSet, values)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package bramble
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestInjectLocaleArguments(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		enum Currency {
+			EUR
+			NZD
+		}
+
+		type Price {
+			amount(currency: Currency): Float
+			formatted(locale: String, currency: Currency): String
+		}
+
+		type Product {
+			name(lang: String): String
+			price: Price
+		}
+
+		type Query {
+			product: Product
+		}
+	`})
+	arguments := LocaleArguments{Locale: "locale", Currency: "currency"}
+	locale := RequestLocale{Locale: "fr-CH", Timezone: "Europe/Zurich", Currency: "EUR"}
+
+	t.Run("injects missing arguments", func(t *testing.T) {
+		query := gqlparser.MustLoadQuery(schema, `{
+			product {
+				name
+				price {
+					amount
+					... on Price { formatted }
+				}
+			}
+		}`)
+		selectionSet := query.Operations[0].SelectionSet
+		injectLocaleArguments(schema, selectionSet, arguments, locale)
+		assert.Equal(t,
+			`{ product { name price { amount(currency: EUR) ... on Price { formatted(locale: "fr-CH", currency: EUR) } } } }`,
+			formatSelectionSetSingleLine(testContextWithoutVariables(nil), schema, selectionSet),
+		)
+	})
+
+	t.Run("keeps provided arguments", func(t *testing.T) {
+		query := gqlparser.MustLoadQuery(schema, `{
+			product {
+				price {
+					formatted(currency: NZD)
+				}
+			}
+		}`)
+		selectionSet := query.Operations[0].SelectionSet
+		injectLocaleArguments(schema, selectionSet, arguments, locale)
+		assert.Equal(t,
+			`{ product { price { formatted(currency: NZD, locale: "fr-CH") } } }`,
+			formatSelectionSetSingleLine(testContextWithoutVariables(nil), schema, selectionSet),
+		)
+	})
+
+	t.Run("ignores empty values", func(t *testing.T) {
+		query := gqlparser.MustLoadQuery(schema, `{ product { price { amount } } }`)
+		selectionSet := query.Operations[0].SelectionSet
+		injectLocaleArguments(schema, selectionSet, arguments, RequestLocale{Locale: "fr-CH"})
+		assert.Equal(t,
+			`{ product { price { amount } } }`,
+			formatSelectionSetSingleLine(testContextWithoutVariables(nil), schema, selectionSet),
+		)
+	})
+}
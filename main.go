@@ -3,10 +3,12 @@ package bramble
 import (
 	"context"
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -17,11 +19,15 @@ import (
 func Main() {
 	var configFiles arrayFlags
 	flag.Var(&configFiles, "conf", "Config file (can appear multiple times)")
+	validateConfig := flag.Bool("validate-config", false, "Validate the config files and exit")
 	flag.Parse()
 
 	log.SetFormatter(&log.JSONFormatter{TimestampFormat: time.RFC3339Nano})
 
 	cfg, err := GetConfig(configFiles)
+	if *validateConfig {
+		os.Exit(reportConfigValidation(cfg, err))
+	}
 	if err != nil {
 		log.WithError(err).Fatal("failed to get config")
 	}
@@ -37,10 +43,24 @@ func Main() {
 	gtw := NewGateway(cfg.executableSchema, cfg.plugins)
 	RegisterMetrics()
 
+	if errs := cfg.InitErrors(); len(errs) > 0 {
+		log.WithField("errors", errs).Error("starting in safe mode")
+		gtw.EnableSafeMode(errs)
+	}
+
 	go gtw.UpdateSchemas(cfg.PollIntervalDuration)
 
-	signalChan := make(chan os.Signal)
-	signal.Notify(signalChan, os.Interrupt)
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	go func() {
+		for range reloadChan {
+			log.Info("received reload signal")
+			cfg.Reload()
+		}
+	}()
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -48,6 +68,7 @@ func Main() {
 	go func() {
 		<-signalChan
 		log.Info("received shutdown signal")
+		cfg.executableSchema.Drain(cfg.ShutdownDelayDuration, cfg.DrainTimeoutDuration)
 		cancel()
 	}()
 
@@ -61,6 +82,20 @@ func Main() {
 	wg.Wait()
 }
 
+// reportConfigValidation prints the result of the validation of the config
+// and returns the exit code
+func reportConfigValidation(cfg *Config, err error) int {
+	if err == nil && len(cfg.InitErrors()) > 0 {
+		err = cfg.InitErrors()[0]
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %s\n", err)
+		return 1
+	}
+	fmt.Println("configuration is valid")
+	return 0
+}
+
 func runHandler(ctx context.Context, wg *sync.WaitGroup, name, addr string, handler http.Handler) {
 	srv := &http.Server{
 		Addr:    addr,
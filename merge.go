@@ -1,14 +1,47 @@
 package bramble
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/vektah/gqlparser/v2"
 	"github.com/vektah/gqlparser/v2/ast"
 )
 
-// MergeSchemas merges the provided schemas together
+// MergeSchemas merges the provided schemas together. The conflicts are
+// returned as a *MergeConflictError, attributed to the schemas by position
+// ("schema 1", "schema 2"...).
 func MergeSchemas(schemas ...*ast.Schema) (*ast.Schema, error) {
+	sources := make([]string, len(schemas))
+	for i := range schemas {
+		sources[i] = fmt.Sprintf("schema %d", i+1)
+	}
+	return mergeSchemas(sources, schemas)
+}
+
+// MergeServiceSchemas merges the schemas of the services together. The
+// conflicts are returned as a *MergeConflictError, attributed to the services
+// by name (or URL if the service has no name).
+func MergeServiceSchemas(services ...*Service) (*ast.Schema, error) {
+	sources := make([]string, 0, len(services))
+	schemas := make([]*ast.Schema, 0, len(services))
+	for _, s := range services {
+		name := s.Name
+		if name == "" {
+			name = s.ServiceURL
+		}
+		sources = append(sources, name)
+		schemas = append(schemas, s.Schema)
+	}
+	return mergeSchemas(sources, schemas)
+}
+
+// mergeSchemas merges the schemas, sources are the names of the schemas the
+// conflicts are attributed to
+func mergeSchemas(sources []string, schemas []*ast.Schema) (*ast.Schema, error) {
 	if len(schemas) < 1 {
 		return nil, fmt.Errorf("no source schemas")
 	}
@@ -27,6 +60,7 @@ func MergeSchemas(schemas ...*ast.Schema) (*ast.Schema, error) {
 			service: Service!
 		}
 		`}))
+		sources = append(sources, "empty schema")
 	}
 
 	merged := ast.Schema{
@@ -36,9 +70,13 @@ func MergeSchemas(schemas ...*ast.Schema) (*ast.Schema, error) {
 	}
 
 	merged.Types = schemas[0].Types
-	for _, schema := range schemas[1:] {
+	for i, schema := range schemas[1:] {
 		mergedTypes, err := mergeTypes(merged.Types, schema.Types)
 		if err != nil {
+			var conflict *mergeConflict
+			if errors.As(err, &conflict) {
+				return nil, newMergeConflictError(conflict, sources[:i+2], schemas[:i+2])
+			}
 			return nil, err
 		}
 		merged.Types = mergedTypes
@@ -57,13 +95,28 @@ func MergeSchemas(schemas ...*ast.Schema) (*ast.Schema, error) {
 
 func buildFieldURLMap(services ...*Service) FieldURLMap {
 	result := FieldURLMap{}
+	shared := buildSharedValueTypes(services...)
 	for _, rs := range services {
 		for _, t := range rs.Schema.Types {
+			// the interface fields are resolved by the service returning the
+			// object, which implements the interface
+			if t.Kind == ast.Interface && !isGraphQLBuiltinName(t.Name) && t.Name != nodeInterfaceName {
+				for _, f := range mergeableFields(t) {
+					result.RegisterURL(t.Name, f.Name, sharedFieldLocation)
+				}
+				continue
+			}
 			if t.Kind != ast.Object || isGraphQLBuiltinName(t.Name) || t.Name == serviceObjectName {
 				continue
 			}
+			if shared[t.Name] {
+				for _, f := range mergeableFields(t) {
+					result.RegisterURL(t.Name, f.Name, sharedFieldLocation)
+				}
+				continue
+			}
 			for _, f := range mergeableFields(t) {
-				if isBoundaryObject(t) && isIDField(f) {
+				if isBoundaryObject(t) && isBoundaryIDField(f) {
 					continue
 				}
 
@@ -109,7 +162,16 @@ func buildBoundaryQueriesMap(services ...*Service) BoundaryQueriesMap {
 					array = true
 				}
 
-				result.RegisterQuery(rs.ServiceURL, queryType, f.Name, array)
+				query := BoundaryQuery{Query: f.Name, Argument: boundaryKeyArgument(f), Array: array}
+				if query.Argument == "" && len(f.Arguments) == 1 {
+					query.Argument = f.Arguments[0].Name
+				}
+				if arg := f.Arguments.ForName(query.Argument); arg != nil && arg.Type.Name() != "ID" {
+					query.ArgumentType = arg.Type.Name()
+				}
+				query.CacheTTL, _ = boundaryCacheTTL(f)
+
+				result.RegisterBoundaryQuery(rs.ServiceURL, queryType, query)
 			}
 		}
 	}
@@ -133,7 +195,15 @@ func mergeTypes(a, b map[string]*ast.Definition) (map[string]*ast.Definition, er
 		return result, nil
 	}
 
-	for k, vb := range b {
+	// the types are merged in order, so the conflict returned is always the
+	// same
+	names := make([]string, 0, len(b))
+	for k := range b {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		vb := b[k]
 		if isGraphQLBuiltinName(k) || k == nodeInterfaceName || k == serviceObjectName {
 			continue
 		}
@@ -148,61 +218,113 @@ func mergeTypes(a, b map[string]*ast.Definition) (map[string]*ast.Definition, er
 			continue
 		}
 
-		if newVB.Kind != va.Kind {
-			return nil, fmt.Errorf("name collision: %s(%s) conflicts with %s(%s)", newVB.Name, newVB.Kind, va.Name, va.Kind)
+		merged, err := mergeTypeDefinitions(a, b, va, &newVB)
+		if err != nil {
+			return nil, &mergeConflict{typeName: k, err: err}
 		}
+		result[k] = merged
+	}
 
-		if newVB.Kind == ast.Scalar {
-			result[k] = &newVB
-			continue
-		}
+	return result, nil
+}
 
-		if !hasFederationDirectives(&newVB) || !hasFederationDirectives(va) {
-			if k != queryObjectName && k != mutationObjectName {
-				if newVB.Kind == ast.Interface {
-					return nil, fmt.Errorf("conflicting interface: %s (interfaces may not span multiple services)", k)
-				}
-				return nil, fmt.Errorf("conflicting non boundary type: %s", k)
-			}
-		}
+// mergeTypeDefinitions merges two definitions of the same type. aTypes and
+// bTypes are the types of the schemas the definitions come from.
+func mergeTypeDefinitions(aTypes, bTypes map[string]*ast.Definition, va, newVB *ast.Definition) (*ast.Definition, error) {
+	k := va.Name
 
-		if isBoundaryObject(va) != isBoundaryObject(&newVB) || isNamespaceObject(va) != isNamespaceObject(&newVB) {
-			return nil, fmt.Errorf("conflicting object directives, merged objects %q should both be boundary or namespaces", newVB.Name)
-		}
+	if newVB.Kind != va.Kind {
+		return nil, fmt.Errorf("name collision: %s(%s) conflicts with %s(%s)", newVB.Name, newVB.Kind, va.Name, va.Kind)
+	}
+
+	if newVB.Kind == ast.Scalar {
+		return newVB, nil
+	}
+
+	if isSharedValueType(va) && isSharedValueType(newVB) {
+		return mergeSharedValueTypes(va, newVB)
+	}
+
+	if newVB.Kind == ast.Interface {
+		return mergeInterfaces(va, newVB)
+	}
 
-		// now, either it's boundary type, namespace type or the Query/Mutation type
+	if newVB.Kind == ast.Union {
+		return mergeUnions(va, newVB), nil
+	}
 
-		if va.Kind != ast.Object {
-			return nil, fmt.Errorf("non object boundary type")
+	if !hasFederationDirectives(newVB) || !hasFederationDirectives(va) {
+		if k != queryObjectName && k != mutationObjectName {
+			return nil, fmt.Errorf("conflicting non boundary type: %s", k)
 		}
+	}
 
-		if isNamespaceObject(&newVB) || k == queryObjectName || k == mutationObjectName || k == subscriptionObjectName {
-			mergedObject, err := mergeNamespaceObjects(a, b, &newVB, va)
-			if err != nil {
-				return nil, err
-			}
-			result[k] = mergedObject
+	if isBoundaryObject(va) != isBoundaryObject(newVB) || isNamespaceObject(va) != isNamespaceObject(newVB) {
+		return nil, fmt.Errorf("conflicting object directives, merged objects %q should both be boundary or namespaces", newVB.Name)
+	}
+
+	// now, either it's boundary type, namespace type or the Query/Mutation type
+
+	if va.Kind != ast.Object {
+		return nil, fmt.Errorf("non object boundary type")
+	}
+
+	if isNamespaceObject(newVB) || k == queryObjectName || k == mutationObjectName || k == subscriptionObjectName {
+		return mergeNamespaceObjects(aTypes, bTypes, newVB, va)
+	}
+
+	mergedBoundaryObject, err := mergeBoundaryObjects(aTypes, bTypes, newVB, va)
+	if err != nil {
+		return nil, err
+	}
+
+	var newInterfaces []string
+	for _, i := range mergedBoundaryObject.Interfaces {
+		if i == nodeInterfaceName {
 			continue
 		}
+		newInterfaces = append(newInterfaces, i)
+	}
+	mergedBoundaryObject.Interfaces = newInterfaces
 
-		mergedBoundaryObject, err := mergeBoundaryObjects(a, b, &newVB, va)
-		if err != nil {
-			return nil, err
-		}
+	return mergedBoundaryObject, nil
+}
 
-		var newInterfaces []string
-		for _, i := range mergedBoundaryObject.Interfaces {
-			if i == nodeInterfaceName {
-				continue
-			}
-			newInterfaces = append(newInterfaces, i)
-		}
-		mergedBoundaryObject.Interfaces = newInterfaces
+// mergeInterfaces merges two definitions of an interface implemented in
+// several services, they must be identical
+func mergeInterfaces(a, b *ast.Definition) (*ast.Definition, error) {
+	if differences := sharedValueTypeDifferences(a, b); len(differences) > 0 {
+		return nil, fmt.Errorf("conflicting interface: %s (%s)", a.Name, strings.Join(differences, ", "))
+	}
+	result := *a
+	if result.Description == "" {
+		result.Description = b.Description
+	}
+	return &result, nil
+}
 
-		result[k] = mergedBoundaryObject
+// mergeUnions merges two definitions of a union, the merged union has the
+// members of both. Each service only returns its own members, the fragments
+// on the other members are resolved by the services owning them.
+func mergeUnions(a, b *ast.Definition) *ast.Definition {
+	result := *a
+	if result.Description == "" {
+		result.Description = b.Description
 	}
+	result.Types = mergeNames(a.Types, b.Types)
+	return &result
+}
 
-	return result, nil
+// mergeNames returns the names of a, followed by the names of b that aren't in
+// a (e.g. the interfaces implemented by a merged object)
+func mergeNames(a, b []string) []string {
+	result := append([]string(nil), a...)
+	for _, i := range b {
+		if !stringSliceContains(result, i) {
+			result = append(result, i)
+		}
+	}
+	return result
 }
 
 func mergeImplements(sources []*ast.Schema) map[string][]*ast.Definition {
@@ -210,7 +332,7 @@ func mergeImplements(sources []*ast.Schema) map[string][]*ast.Definition {
 	for _, schema := range sources {
 		for typeName, interfaces := range schema.Implements {
 			for _, i := range interfaces {
-				if i.Name != nodeInterfaceName {
+				if i.Name != nodeInterfaceName && ast.DefinitionList(result[typeName]).ForName(i.Name) == nil {
 					result[typeName] = append(result[typeName], i)
 				}
 			}
@@ -279,7 +401,7 @@ func mergeNamespaceObjects(aTypes, bTypes map[string]*ast.Definition, a, b *ast.
 		Description: mergeDescriptions(a, b),
 		Name:        a.Name,
 		Directives:  a.Directives.ForNames(namespaceDirectiveName),
-		Interfaces:  append(a.Interfaces, b.Interfaces...),
+		Interfaces:  mergeNames(a.Interfaces, b.Interfaces),
 		Fields:      fields,
 	}, nil
 }
@@ -290,7 +412,7 @@ func mergeBoundaryObjects(aTypes, bTypes map[string]*ast.Definition, a, b *ast.D
 		Description: mergeDescriptions(a, b),
 		Name:        a.Name,
 		Directives:  a.Directives.ForNames(boundaryDirectiveName),
-		Interfaces:  append(a.Interfaces, b.Interfaces...),
+		Interfaces:  mergeNames(a.Interfaces, b.Interfaces),
 		Fields:      nil,
 	}
 
@@ -312,7 +434,10 @@ func mergeBoundaryObjectFields(aTypes, bTypes map[string]*ast.Definition, a, b *
 		result = append(result, f)
 	}
 	for _, f := range mergeableFields(b) {
-		if isIDField(f) {
+		if isBoundaryIDField(f) {
+			if id := result.ForName(idFieldName); id != nil && id.Type.String() != f.Type.String() {
+				return nil, fmt.Errorf("conflicting id types %s : %s and %s", a.Name, id.Type, f.Type)
+			}
 			continue
 		}
 		if rf := result.ForName(f.Name); rf != nil {
@@ -378,8 +503,10 @@ func cleanFields(fields ast.FieldList) ast.FieldList {
 			continue
 		}
 
-		f.Directives = cleanDirectives(f.Directives)
-		res = append(res, f)
+		// copy the field so the service schema keeps its directives
+		newF := *f
+		newF.Directives = cleanDirectives(f.Directives)
+		res = append(res, &newF)
 	}
 
 	return res
@@ -387,7 +514,7 @@ func cleanFields(fields ast.FieldList) ast.FieldList {
 
 func allowedDirective(name string) bool {
 	switch name {
-	case boundaryDirectiveName, namespaceDirectiveName, "skip", "include", "deprecated":
+	case boundaryDirectiveName, namespaceDirectiveName, privateDirectiveName, "skip", "include", "deprecated":
 		return true
 	default:
 		return false
@@ -418,6 +545,12 @@ func isIDField(f *ast.FieldDefinition) bool {
 	return f.Name == idFieldName && len(f.Arguments) == 0 && isIDType(f.Type)
 }
 
+// isBoundaryIDField returns whether the field is the id field of a boundary
+// type, whose type can be a built-in or custom scalar (see isBoundaryIDType)
+func isBoundaryIDField(f *ast.FieldDefinition) bool {
+	return f.Name == idFieldName && len(f.Arguments) == 0 && f.Type.Elem == nil && f.Type.NonNull
+}
+
 func isServiceField(f *ast.FieldDefinition) bool {
 	return f.Name == serviceRootFieldName &&
 		len(f.Arguments) == 0 &&
@@ -448,6 +581,34 @@ func hasBoundaryDirective(f *ast.FieldDefinition) bool {
 	return f.Directives.ForName(boundaryDirectiveName) != nil
 }
 
+// boundaryKeyArgument returns the key argument declared with
+// @boundary(key: "...") on a boundary query, if any
+func boundaryKeyArgument(f *ast.FieldDefinition) string {
+	d := f.Directives.ForName(boundaryDirectiveName)
+	if d == nil {
+		return ""
+	}
+	arg := d.Arguments.ForName(boundaryKeyArgumentName)
+	if arg == nil || arg.Value == nil {
+		return ""
+	}
+	return arg.Value.Raw
+}
+
+// boundaryCacheTTL returns the cache TTL declared with
+// @boundary(cacheTTL: "...") on a boundary query, if any
+func boundaryCacheTTL(f *ast.FieldDefinition) (time.Duration, error) {
+	d := f.Directives.ForName(boundaryDirectiveName)
+	if d == nil {
+		return 0, nil
+	}
+	arg := d.Arguments.ForName(boundaryCacheTTLArgumentName)
+	if arg == nil || arg.Value == nil {
+		return 0, nil
+	}
+	return time.ParseDuration(arg.Value.Raw)
+}
+
 func filterBuiltinFields(fields ast.FieldList) ast.FieldList {
 	var res ast.FieldList
 	for _, f := range fields {
@@ -0,0 +1,179 @@
+package bramble
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// MergeConflictError is the error returned when the definitions of a type in
+// several schemas can't be merged. It attributes the conflict to the services
+// defining the type and lists how their definitions differ.
+type MergeConflictError struct {
+	// TypeName is the name of the conflicting type
+	TypeName string `json:"typeName"`
+	// Message is the reason of the conflict
+	Message string `json:"message"`
+	// Services are the services defining the type, in merge order
+	Services []string `json:"services"`
+	// Differences are the differences between the definitions of the type,
+	// field by field
+	Differences []MergeConflictDifference `json:"differences"`
+}
+
+// MergeConflictDifference is a field (or the type itself if Field is empty)
+// whose definitions conflict. For the types that must be identical in every
+// service (shared types, interfaces...) these are the fields that are defined
+// differently or not defined by every service, for the other types these are
+// the fields defined by several services.
+type MergeConflictDifference struct {
+	Field string `json:"field,omitempty"`
+	// Definitions are the definitions of the field (or the kind and
+	// federation directives of the type), by service. The services that
+	// don't define the field are absent.
+	Definitions map[string]string `json:"definitions"`
+}
+
+// Error returns the reason of the conflict, with the services defining the
+// type
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("%s (services: %s)", e.Message, strings.Join(e.Services, ", "))
+}
+
+// mergeConflict is the conflict of a type returned by mergeTypes, the
+// services are attributed by mergeSchemas
+type mergeConflict struct {
+	typeName string
+	err      error
+}
+
+func (c *mergeConflict) Error() string {
+	return c.err.Error()
+}
+
+// newMergeConflictError attributes the conflict to the services, sources are
+// the names of the services whose schemas were merged until the conflict
+func newMergeConflictError(conflict *mergeConflict, sources []string, schemas []*ast.Schema) *MergeConflictError {
+	var services []string
+	var defs []*ast.Definition
+	for i, schema := range schemas {
+		if def, ok := schema.Types[conflict.typeName]; ok {
+			services = append(services, sources[i])
+			defs = append(defs, def)
+		}
+	}
+	return &MergeConflictError{
+		TypeName:    conflict.typeName,
+		Message:     conflict.err.Error(),
+		Services:    services,
+		Differences: typeDifferences(services, defs),
+	}
+}
+
+// typeDifferences returns the differences between the definitions of a type
+func typeDifferences(services []string, defs []*ast.Definition) []MergeConflictDifference {
+	differences := []MergeConflictDifference{}
+
+	kinds := make(map[string]string, len(defs))
+	mustMatch := true
+	for i, def := range defs {
+		kinds[services[i]] = formatTypeKind(def)
+		if def.Kind == ast.Object && !isSharedValueType(def) {
+			mustMatch = false
+		}
+	}
+	if !sameDefinitions(kinds) {
+		// the fields of definitions of different kinds aren't compared
+		return append(differences, MergeConflictDifference{Definitions: kinds})
+	}
+
+	var names []string
+	members := make(map[string]map[string]string)
+	for i, def := range defs {
+		for name, formatted := range typeMembers(def) {
+			if _, ok := members[name]; !ok {
+				members[name] = make(map[string]string)
+				names = append(names, name)
+			}
+			members[name][services[i]] = formatted
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		definitions := members[name]
+		conflicting := len(definitions) > 1
+		if mustMatch {
+			conflicting = len(definitions) != len(defs) || !sameDefinitions(definitions)
+		}
+		if conflicting {
+			differences = append(differences, MergeConflictDifference{Field: name, Definitions: definitions})
+		}
+	}
+	return differences
+}
+
+// formatTypeKind returns the kind of the type with its federation directives
+func formatTypeKind(def *ast.Definition) string {
+	kind := string(def.Kind)
+	if directives := formatDirectiveList(def.Directives.ForNames(boundaryDirectiveName)); directives != "" {
+		kind += " " + directives
+	}
+	if directives := formatDirectiveList(def.Directives.ForNames(namespaceDirectiveName)); directives != "" {
+		kind += " " + directives
+	}
+	return kind
+}
+
+// typeMembers returns the formatted fields and enum values of the type, by
+// name. The fields merged by the gateway (e.g. the boundary id field) are
+// ignored.
+func typeMembers(def *ast.Definition) map[string]string {
+	members := make(map[string]string)
+	for _, f := range def.Fields {
+		if isGraphQLBuiltinName(f.Name) || (isQueryType(def) && (isNodeField(f) || isServiceField(f))) || (isBoundaryObject(def) && isBoundaryIDField(f)) {
+			continue
+		}
+		members[f.Name] = formatFieldDefinition(f)
+	}
+	for _, v := range def.EnumValues {
+		members[v.Name] = strings.TrimSpace(v.Name + " " + formatDirectiveList(v.Directives))
+	}
+	return members
+}
+
+// formatFieldDefinition returns the field definition as in a schema, e.g.
+// "movies(first: Int = 10): [Movie!]! @deprecated"
+func formatFieldDefinition(f *ast.FieldDefinition) string {
+	var b strings.Builder
+	b.WriteString(f.Name)
+	if len(f.Arguments) > 0 {
+		args := make([]string, 0, len(f.Arguments))
+		for _, arg := range f.Arguments {
+			formatted := arg.Name + ": " + arg.Type.String()
+			if arg.DefaultValue != nil {
+				formatted += " = " + arg.DefaultValue.String()
+			}
+			args = append(args, formatted)
+		}
+		b.WriteString("(" + strings.Join(args, ", ") + ")")
+	}
+	b.WriteString(": " + f.Type.String())
+	if f.DefaultValue != nil {
+		b.WriteString(" = " + f.DefaultValue.String())
+	}
+	if directives := formatDirectiveList(f.Directives); directives != "" {
+		b.WriteString(" " + directives)
+	}
+	return b.String()
+}
+
+// sameDefinitions returns whether all the definitions are identical
+func sameDefinitions(definitions map[string]string) bool {
+	values := make(map[string]bool, len(definitions))
+	for _, d := range definitions {
+		values[d] = true
+	}
+	return len(values) <= 1
+}
@@ -0,0 +1,100 @@
+package bramble
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mergeServiceSchemasConflict(t *testing.T, services ...*Service) *MergeConflictError {
+	t.Helper()
+	_, err := MergeServiceSchemas(services...)
+	var conflict *MergeConflictError
+	require.True(t, errors.As(err, &conflict), "expected a merge conflict, got %v", err)
+	return conflict
+}
+
+func TestMergeConflictBoundaryFields(t *testing.T) {
+	conflict := mergeServiceSchemasConflict(t,
+		&Service{Name: "movies", Schema: loadSchema(`
+			directive @boundary on OBJECT
+			type Movie @boundary {
+				id: ID!
+				title: String
+				rating: Int
+			}
+			type Query { movie(id: ID!): Movie }`)},
+		&Service{Name: "reviews", Schema: loadSchema(`
+			type Review { text: String }
+			type Query { review: Review }`)},
+		&Service{ServiceURL: "http://ratings/query", Schema: loadSchema(`
+			directive @boundary on OBJECT
+			type Movie @boundary {
+				id: ID!
+				rating(scale: Int = 5): Float!
+			}
+			type Query { topMovies: [Movie!]! }`)},
+	)
+
+	assert.Equal(t, &MergeConflictError{
+		TypeName: "Movie",
+		Message:  "overlapping fields Movie : rating",
+		Services: []string{"movies", "http://ratings/query"},
+		Differences: []MergeConflictDifference{{
+			Field: "rating",
+			Definitions: map[string]string{
+				"movies":               "rating: Int",
+				"http://ratings/query": "rating(scale: Int = 5): Float!",
+			},
+		}},
+	}, conflict)
+	assert.Equal(t, "overlapping fields Movie : rating (services: movies, http://ratings/query)", conflict.Error())
+}
+
+func TestMergeConflictSharedType(t *testing.T) {
+	conflict := mergeServiceSchemasConflict(t,
+		&Service{Name: "movies", Schema: loadSchema(`
+			type Price { amount: Float! currency: String }
+			type Query { moviePrice: Price }`)},
+		&Service{Name: "gizmos", Schema: loadSchema(`
+			type Price { amount: Float! currency: String! @deprecated discount: Float }
+			type Query { gizmoPrice: Price }`)},
+	)
+
+	assert.Equal(t, "Price", conflict.TypeName)
+	assert.Equal(t, []MergeConflictDifference{
+		{
+			Field: "currency",
+			Definitions: map[string]string{
+				"movies": "currency: String",
+				"gizmos": "currency: String! @deprecated",
+			},
+		},
+		{
+			Field:       "discount",
+			Definitions: map[string]string{"gizmos": "discount: Float"},
+		},
+	}, conflict.Differences)
+}
+
+func TestMergeConflictKinds(t *testing.T) {
+	conflict := mergeServiceSchemasConflict(t,
+		&Service{Name: "animals", Schema: loadSchema(`
+			type Cat { name: String }
+			union Animal = Cat
+			type Query { animal: Animal }`)},
+		&Service{Name: "zoo", Schema: loadSchema(`
+			type Animal { name: String }
+			type Query { zoo: [Animal] }`)},
+	)
+
+	assert.Equal(t, "name collision: Animal(OBJECT) conflicts with Animal(UNION)", conflict.Message)
+	assert.Equal(t, []MergeConflictDifference{{
+		Definitions: map[string]string{
+			"animals": "UNION",
+			"zoo":     "OBJECT",
+		},
+	}}, conflict.Differences)
+}
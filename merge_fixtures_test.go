@@ -1,9 +1,11 @@
 package bramble
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/vektah/gqlparser/v2"
 	"github.com/vektah/gqlparser/v2/ast"
 )
@@ -55,8 +57,10 @@ func (f MergeTestFixture) CheckError(t *testing.T) {
 		schemas = append(schemas, loadSchema(f.Input2))
 	}
 	_, err := MergeSchemas(schemas...)
-	assert.Error(t, err)
-	assert.Equal(t, f.Error, err.Error())
+	var conflict *MergeConflictError
+	require.True(t, errors.As(err, &conflict), "expected a merge conflict, got %v", err)
+	assert.Equal(t, f.Error, conflict.Message)
+	assert.Equal(t, []string{"schema 1", "schema 2"}, conflict.Services)
 }
 
 func (f BuildFieldURLMapFixture) Check(t *testing.T) {
@@ -2,6 +2,7 @@ package bramble
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -105,13 +106,27 @@ func TestMergeTwoSchemasNoBoundaryTypes(t *testing.T) {
 	fixture.CheckSuccess(t)
 }
 
-func TestMergeTwoSchemasWithCollindingInterface(t *testing.T) {
+func TestMergeTwoSchemasWithSharedInterface(t *testing.T) {
 	fixture := MergeTestFixture{
 		Input1: `
 			interface Named {
 				name: String!
 			}
 
+			type Gimmick implements Named {
+				name: String!
+				bar: Float!
+			}
+
+			type Query {
+				gimmick(id: ID!): Gimmick!
+			}
+		`,
+		Input2: `
+			interface Named {
+				name: String!
+			}
+
 			type Gizmo implements Named {
 				name: String!
 				foo: Float!
@@ -121,7 +136,7 @@ func TestMergeTwoSchemasWithCollindingInterface(t *testing.T) {
 				gizmo(id: ID!): Gizmo!
 			}
 		`,
-		Input2: `
+		Expected: `
 			interface Named {
 				name: String!
 			}
@@ -131,15 +146,127 @@ func TestMergeTwoSchemasWithCollindingInterface(t *testing.T) {
 				bar: Float!
 			}
 
+			type Gizmo implements Named {
+				name: String!
+				foo: Float!
+			}
+
 			type Query {
+				gizmo(id: ID!): Gizmo!
 				gimmick(id: ID!): Gimmick!
 			}
 		`,
-		Error: "conflicting interface: Named (interfaces may not span multiple services)",
+	}
+	fixture.CheckSuccess(t)
+}
+
+func TestMergeTwoSchemasWithCollidingInterface(t *testing.T) {
+	fixture := MergeTestFixture{
+		Input1: `
+			interface Named {
+				name: String!
+			}
+
+			type Gizmo implements Named {
+				name: String!
+			}
+
+			type Query {
+				gizmo(id: ID!): Gizmo!
+			}
+		`,
+		Input2: `
+			interface Named {
+				name: String
+			}
+
+			type Gimmick implements Named {
+				name: String
+			}
+
+			type Query {
+				gimmick(id: ID!): Gimmick!
+			}
+		`,
+		Error: "conflicting interface: Named (field name has types String! and String)",
 	}
 	fixture.CheckError(t)
 }
 
+func TestMergeBoundaryTypesImplementingSharedInterface(t *testing.T) {
+	fixture := MergeTestFixture{
+		Input1: `
+			directive @boundary on OBJECT
+
+			interface Named {
+				name: String!
+			}
+
+			type Movie implements Named @boundary {
+				id: ID!
+				name: String!
+			}
+
+			type Query {
+				search: [Named!]!
+				movie(id: ID!): Movie
+			}
+		`,
+		Input2: `
+			directive @boundary on OBJECT
+
+			interface Named {
+				name: String!
+			}
+
+			type Movie implements Named @boundary {
+				id: ID!
+				name: String!
+			}
+
+			type Query {
+				movie2(id: ID!): Movie
+			}
+		`,
+		Error: "overlapping fields Movie : name",
+	}
+	fixture.CheckError(t)
+
+	fixture.Input2 = `
+		directive @boundary on OBJECT
+
+		type Movie @boundary {
+			id: ID!
+			posterUrl: String
+		}
+
+		type Query {
+			movie2(id: ID!): Movie
+		}
+	`
+	fixture.Error = ""
+	fixture.Expected = `
+		directive @boundary on OBJECT
+
+		interface Named {
+			name: String!
+		}
+
+		type Movie implements Named @boundary {
+			id: ID!
+			posterUrl: String
+			name: String!
+		}
+
+		type Query {
+			movie2(id: ID!): Movie
+			search: [Named!]!
+			movie(id: ID!): Movie
+		}
+	`
+	fixture.CheckSuccess(t)
+}
+
 func TestMergeTwoSchemasWithBoundaryTypes(t *testing.T) {
 	fixture := MergeTestFixture{
 		Input1: `
@@ -450,6 +577,7 @@ func TestBuildFieldURLMapSingleSchema(t *testing.T) {
 			"Query.gizmo": loc1,
 			"Gizmo.id":    loc1,
 			"Gizmo.name":  loc1,
+			"Named.name":  sharedFieldLocation,
 		},
 	}
 	fixture.Check(t)
@@ -496,6 +624,8 @@ func TestBuildFieldURLMapTwoSchemasNoBoundaryType(t *testing.T) {
 			"Gizmo.name":    loc1,
 			"Gimmick.id":    loc2,
 			"Gimmick.size":  loc2,
+			"Named.name":    sharedFieldLocation,
+			"Sized.size":    sharedFieldLocation,
 		},
 	}
 	fixture.Check(t)
@@ -561,6 +691,8 @@ func TestBuildFieldURLMapTwoSchemasWithBoundaryType(t *testing.T) {
 			"Query.gizmo": loc1,
 			"Gizmo.name":  loc1,
 			"Gizmo.size":  loc2,
+			"Named.name":  sharedFieldLocation,
+			"Sized.size":  sharedFieldLocation,
 		},
 	}
 	fixture.Check(t)
@@ -650,7 +782,7 @@ func TestHandlesMutationServices(t *testing.T) {
 	fixture.CheckSuccess(t)
 }
 
-func TestMergeHandlesUnionConflict(t *testing.T) {
+func TestMergeUnionMembersOfDifferentServices(t *testing.T) {
 	fixture := MergeTestFixture{
 		Input1: `
 			type Dog1 { name: String! }
@@ -665,14 +797,48 @@ func TestMergeHandlesUnionConflict(t *testing.T) {
 		Input2: `
 			type Dog2 { name: String! }
 			type Cat2 { name: String! }
-			type Snake2 { name: String! }
-			union Animal = Dog2 | Cat2 | Snake2
+			type Snake1 { name: String! }
+			union Animal = Dog2 | Cat2 | Snake1
+
+			type Query {
+				foo: String!
+			}
+		`,
+		Expected: `
+			type Cat1 { name: String! }
+			type Cat2 { name: String! }
+			type Dog1 { name: String! }
+			type Dog2 { name: String! }
+			type Snake1 { name: String! }
+			union Animal = Dog1 | Cat1 | Snake1 | Dog2 | Cat2
 
 			type Query {
 				foo: String!
+				animals: [Animal]!
+			}
+		`,
+	}
+	fixture.CheckSuccess(t)
+}
+
+func TestMergeUnionConflict(t *testing.T) {
+	fixture := MergeTestFixture{
+		Input1: `
+			type Dog { name: String! }
+			union Animal = Dog
+
+			type Query {
+				animals: [Animal]!
+			}
+		`,
+		Input2: `
+			type Animal { name: String! }
+
+			type Query {
+				foo: Animal!
 			}
 		`,
-		Error: "conflicting non boundary type: Animal",
+		Error: "name collision: Animal(OBJECT) conflicts with Animal(UNION)",
 	}
 	fixture.CheckError(t)
 }
@@ -877,3 +1043,327 @@ func TestMergeRemovesCustomDirectives(t *testing.T) {
 	}
 	fixture.CheckSuccess(t)
 }
+
+func TestBuildBoundaryQueriesMap(t *testing.T) {
+	service := &Service{
+		ServiceURL: "http://movies",
+		Schema: loadSchema(`
+			directive @boundary on OBJECT | FIELD_DEFINITION
+
+			type Movie @boundary {
+				id: ID!
+			}
+
+			type Actor @boundary {
+				id: ID!
+			}
+
+			type Query {
+				movie(key: ID!): Movie @boundary
+				actors(ids: [ID!]): [Actor]! @boundary
+			}`),
+	}
+
+	queries := buildBoundaryQueriesMap(service)
+	assert.Equal(t, BoundaryQuery{Query: "movie", Argument: "key"}, queries.Query("http://movies", "Movie"))
+	assert.Equal(t, "key", queries.Query("http://movies", "Movie").ArgumentName())
+	assert.Equal(t, "ids", queries.Query("http://movies", "Actor").ArgumentName())
+	assert.Equal(t, "id", queries.Query("http://movies", "Unknown").ArgumentName())
+}
+
+func TestBuildBoundaryQueriesMapWithKeyArgument(t *testing.T) {
+	service := &Service{
+		ServiceURL: "http://owners",
+		Schema: loadSchema(`
+			directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+
+			type Owner @boundary {
+				id: ID!
+			}
+
+			type Pet @boundary {
+				id: ID!
+			}
+
+			type Query {
+				getOwner(ownerId: Int!, locale: String): Owner @boundary(key: "ownerId")
+				getPets(filter: String, petIds: [String!]!): [Pet]! @boundary(key: "petIds")
+			}`),
+	}
+
+	queries := buildBoundaryQueriesMap(service)
+	assert.Equal(t, BoundaryQuery{Query: "getOwner", Argument: "ownerId", ArgumentType: "Int"}, queries.Query("http://owners", "Owner"))
+	assert.Equal(t, BoundaryQuery{Query: "getPets", Argument: "petIds", ArgumentType: "String", Array: true}, queries.Query("http://owners", "Pet"))
+}
+
+func TestBuildBoundaryQueriesMapWithCacheTTL(t *testing.T) {
+	service := &Service{
+		ServiceURL: "http://currencies",
+		Schema: loadSchema(`
+			directive @boundary(key: String, cacheTTL: String) on OBJECT | FIELD_DEFINITION
+
+			type Currency @boundary {
+				id: ID!
+			}
+
+			type Query {
+				currencies(codes: [ID!]): [Currency]! @boundary(key: "codes", cacheTTL: "1h")
+			}`),
+	}
+
+	queries := buildBoundaryQueriesMap(service)
+	assert.Equal(t, BoundaryQuery{Query: "currencies", Argument: "codes", Array: true, CacheTTL: time.Hour}, queries.Query("http://currencies", "Currency"))
+}
+
+func TestBoundaryQueryFormatID(t *testing.T) {
+	assert.Equal(t, `"1"`, BoundaryQuery{}.formatID("1"))
+	assert.Equal(t, `"1"`, BoundaryQuery{ArgumentType: "String"}.formatID("1"))
+	assert.Equal(t, `42`, BoundaryQuery{ArgumentType: "Int"}.formatID("42"))
+	assert.Equal(t, `"abc"`, BoundaryQuery{ArgumentType: "Int"}.formatID("abc"))
+}
+
+func TestBoundaryQueryFormatTargetID(t *testing.T) {
+	assert.Equal(t, `"7"`, BoundaryQuery{}.formatTargetID(insertionTarget{ID: "7", numericID: true}))
+	assert.Equal(t, `7`, BoundaryQuery{ArgumentType: "Int"}.formatTargetID(insertionTarget{ID: "7", numericID: true}))
+	assert.Equal(t, `7`, BoundaryQuery{ArgumentType: "Long"}.formatTargetID(insertionTarget{ID: "7", numericID: true}))
+	assert.Equal(t, `"7"`, BoundaryQuery{ArgumentType: "UUID"}.formatTargetID(insertionTarget{ID: "7"}))
+}
+
+func TestMergeBoundaryTypesWithScalarIDs(t *testing.T) {
+	fixture := MergeTestFixture{
+		Input1: `
+			directive @boundary on OBJECT
+
+			type Owner @boundary {
+				id: Int!
+				name: String!
+			}
+
+			type Query {
+				owner(id: Int!): Owner
+			}
+		`,
+		Input2: `
+			directive @boundary on OBJECT
+
+			type Owner @boundary {
+				id: Int!
+				age: Int!
+			}
+
+			type Query {
+				owner2(id: Int!): Owner
+			}
+		`,
+		Expected: `
+			directive @boundary on OBJECT
+
+			type Owner @boundary {
+				id: Int!
+				age: Int!
+				name: String!
+			}
+
+			type Query {
+				owner2(id: Int!): Owner
+				owner(id: Int!): Owner
+			}
+		`,
+	}
+	fixture.CheckSuccess(t)
+
+	fixture.Input2 = `
+		directive @boundary on OBJECT
+
+		type Owner @boundary {
+			id: ID!
+			age: Int!
+		}
+
+		type Query {
+			owner2(id: ID!): Owner
+		}
+	`
+	fixture.Error = "conflicting id types Owner : ID! and Int!"
+	fixture.CheckError(t)
+}
+
+func TestMergeSharedValueTypes(t *testing.T) {
+	fixture := MergeTestFixture{
+		Input1: `
+			enum Currency { NZD USD }
+
+			input PriceFilter {
+				currency: Currency!
+				max: Float = 100
+			}
+
+			type Price {
+				amount: Float!
+				currency: Currency!
+			}
+
+			type Gizmo {
+				price: Price!
+			}
+
+			type Query {
+				gizmos(filter: PriceFilter): [Gizmo!]!
+			}
+		`,
+		Input2: `
+			enum Currency { USD NZD }
+
+			input PriceFilter {
+				max: Float = 100
+				currency: Currency!
+			}
+
+			type Price {
+				currency: Currency!
+				amount: Float!
+			}
+
+			type Gimmick {
+				price: Price!
+			}
+
+			type Query {
+				gimmicks(filter: PriceFilter): [Gimmick!]!
+			}
+		`,
+		Expected: `
+			enum Currency { NZD USD }
+
+			input PriceFilter {
+				currency: Currency!
+				max: Float = 100
+			}
+
+			type Price {
+				amount: Float!
+				currency: Currency!
+			}
+
+			type Gizmo {
+				price: Price!
+			}
+
+			type Gimmick {
+				price: Price!
+			}
+
+			type Query {
+				gimmicks(filter: PriceFilter): [Gimmick!]!
+				gizmos(filter: PriceFilter): [Gizmo!]!
+			}
+		`,
+	}
+	fixture.CheckSuccess(t)
+}
+
+func TestMergeSharedValueTypesConflicts(t *testing.T) {
+	t.Run("enum values", func(t *testing.T) {
+		fixture := MergeTestFixture{
+			Input1: `
+				enum Currency { NZD USD }
+				type Query { a: Currency }
+			`,
+			Input2: `
+				enum Currency { NZD EUR }
+				type Query { b: Currency }
+			`,
+			Error: "conflicting shared type: Currency (value USD is missing from one of the definitions, value EUR is missing from one of the definitions)",
+		}
+		fixture.CheckError(t)
+	})
+
+	t.Run("input default values", func(t *testing.T) {
+		fixture := MergeTestFixture{
+			Input1: `
+				input PriceFilter { max: Float = 100 }
+				type Query { a(filter: PriceFilter): String }
+			`,
+			Input2: `
+				input PriceFilter { max: Float = 50 }
+				type Query { b(filter: PriceFilter): String }
+			`,
+			Error: `conflicting shared type: PriceFilter (field max has default values "100" and "50")`,
+		}
+		fixture.CheckError(t)
+	})
+
+	t.Run("object fields", func(t *testing.T) {
+		fixture := MergeTestFixture{
+			Input1: `
+				type Price {
+					amount: Float!
+					currency(format: String): String!
+				}
+				type Query { a: Price }
+			`,
+			Input2: `
+				type Price {
+					amount: Float
+					currency: String! @deprecated
+				}
+				type Query { b: Price }
+			`,
+			Error: `conflicting shared type: Price (field amount has types Float! and Float, field currency has directives "" and "@deprecated", argument currency.format is missing from one of the definitions)`,
+		}
+		fixture.CheckError(t)
+	})
+
+	t.Run("boundary object", func(t *testing.T) {
+		fixture := MergeTestFixture{
+			Input1: `
+				directive @boundary on OBJECT
+				type Price @boundary { id: ID! }
+				type Query { a: Price }
+			`,
+			Input2: `
+				type Price { id: ID! }
+				type Query { b: Price }
+			`,
+			Error: "conflicting non boundary type: Price",
+		}
+		fixture.CheckError(t)
+	})
+}
+
+func TestBuildFieldURLMapSharedValueType(t *testing.T) {
+	loc1 := "http://location1.com/query"
+	loc2 := "http://location2.com/query"
+	fixture := BuildFieldURLMapFixture{
+		Schema1: `
+			type Price {
+				amount: Float!
+			}
+
+			type Query {
+				gizmoPrice: Price!
+			}
+		`,
+		Location1: loc1,
+		Schema2: `
+			type Price {
+				amount: Float!
+			}
+
+			type Query {
+				gimmickPrice: Price!
+			}
+		`,
+		Location2: loc2,
+		Expected: FieldURLMap{
+			"Query.gizmoPrice":   loc1,
+			"Query.gimmickPrice": loc2,
+			"Price.amount":       sharedFieldLocation,
+		},
+	}
+	fixture.Check(t)
+
+	location, err := fixture.Expected.URLFor("Price", loc2, "amount")
+	assert.NoError(t, err)
+	assert.Equal(t, loc2, location)
+}
@@ -14,6 +14,12 @@ var (
 		Help: "A gauge representing the current status of remote services schemas",
 	})
 
+	// promSafeMode is a gauge indicating whether the gateway is running in safe mode
+	promSafeMode = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "safe_mode",
+		Help: "A gauge indicating whether the gateway is running in safe mode",
+	})
+
 	promServiceUpdateError = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "service_update_error",
@@ -24,6 +30,258 @@ var (
 		},
 	)
 
+	// promHTTPClientDurations is a histogram of the latencies of auxiliary
+	// requests made by plugins
+	promHTTPClientDurations = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_client_request_duration_seconds",
+			Help:    "A histogram of auxiliary request latencies",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"client", "code"},
+	)
+
+	// promQueryStepDurations is a histogram of the execution time of the
+	// query plan steps, by service
+	promQueryStepDurations = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "query_step_duration_seconds",
+			Help:    "A histogram of query plan steps execution time",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"service"},
+	)
+
+	// promBoundaryCacheHits is a counter of the entities found in the
+	// boundary cache
+	promBoundaryCacheHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "boundary_cache_hits_total",
+			Help: "A counter of the entities found in the boundary cache",
+		},
+		[]string{"service", "type"},
+	)
+
+	// promBoundaryCacheMisses is a counter of the entities not found in the
+	// boundary cache
+	promBoundaryCacheMisses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "boundary_cache_misses_total",
+			Help: "A counter of the entities not found in the boundary cache",
+		},
+		[]string{"service", "type"},
+	)
+
+	// promPlanCacheHits is a counter of the query plans found in the plan
+	// cache
+	promPlanCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "plan_cache_hits_total",
+		Help: "A counter of the query plans found in the plan cache",
+	})
+
+	// promPlanCacheMisses is a counter of the query plans not found in the
+	// plan cache
+	promPlanCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "plan_cache_misses_total",
+		Help: "A counter of the query plans not found in the plan cache",
+	})
+
+	// promServiceSchemaSkew is a gauge indicating which services report a
+	// schema different from the one used to build the merged schema
+	promServiceSchemaSkew = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "service_schema_skew",
+			Help: "A gauge indicating what services report a schema different from the merged one",
+		},
+		[]string{"service"},
+	)
+
+	// promServiceSchemaSkewResponses is a counter of the responses reporting
+	// a schema different from the one used to build the merged schema
+	promServiceSchemaSkewResponses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "service_schema_skew_responses_total",
+			Help: "A counter of the responses reporting a schema different from the merged one",
+		},
+		[]string{"service"},
+	)
+
+	// promHedgedRequests is a counter of the requests hedged to a replica of
+	// the service
+	promHedgedRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "hedged_requests_total",
+			Help: "A counter of the requests hedged to a replica of the service",
+		},
+		[]string{"service"},
+	)
+
+	// promHedgedRequestWins is a counter of the hedged requests where the
+	// replica responded first
+	promHedgedRequestWins = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "hedged_request_wins_total",
+			Help: "A counter of the hedged requests where the replica responded first",
+		},
+		[]string{"service"},
+	)
+
+	// promServiceEndpointRequests is a counter of the requests sent to each
+	// endpoint of the load balanced services
+	promServiceEndpointRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "service_endpoint_requests_total",
+			Help: "A counter of the requests sent to each endpoint of the load balanced services",
+		},
+		[]string{"service", "endpoint", "status"},
+	)
+
+	// promUnboundedListFields is a counter of the operations selecting
+	// paginated fields without any pagination argument, by field and policy
+	promUnboundedListFields = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "unbounded_list_fields_total",
+			Help: "A counter of the operations selecting paginated fields without any pagination argument, by field (Type.field) and policy",
+		},
+		[]string{"field", "policy"},
+	)
+
+	// promLenientNullValues is a counter of the null values returned by the
+	// lenient services for non-nullable fields, by service and field
+	promLenientNullValues = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lenient_null_values_total",
+			Help: "A counter of the null values returned by the lenient services for non-nullable fields, by service and field (Type.field)",
+		},
+		[]string{"service", "field"},
+	)
+
+	// promCancelledOperations is a counter of the operations whose client
+	// disconnected before the end of the execution
+	promCancelledOperations = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "cancelled_operations_total",
+			Help: "A counter of the operations cancelled by a client disconnect before the end of their execution",
+		},
+	)
+
+	// promDeprecatedFieldUsages is a counter of the operations selecting
+	// deprecated fields, by field
+	promDeprecatedFieldUsages = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "deprecated_field_usages_total",
+			Help: "A counter of the operations selecting deprecated fields, by field (Type.field)",
+		},
+		[]string{"field"},
+	)
+
+	// promServiceVariantRequestDurations is a histogram of the duration of the
+	// requests to the services with a canary, by variant
+	promServiceVariantRequestDurations = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "service_variant_request_duration_seconds",
+			Help:    "A histogram of the duration of the requests to the services with a canary, by variant (primary or canary)",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"service", "variant", "status"},
+	)
+
+	// promServiceEndpointExcluded is a gauge set to 1 when a failing endpoint
+	// is excluded from the load balancing
+	promServiceEndpointExcluded = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "service_endpoint_excluded",
+			Help: "A gauge set to 1 when a failing endpoint is excluded from the load balancing",
+		},
+		[]string{"service", "endpoint"},
+	)
+
+	// promDroppedEvents is a counter of the lifecycle events dropped because
+	// a subscriber was too slow
+	promDroppedEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dropped_events_total",
+			Help: "A counter of the lifecycle events dropped because a subscriber was too slow",
+		},
+		[]string{"event"},
+	)
+
+	// promSchemaRegistryErrors is a counter of the failed schema registry
+	// operations
+	promSchemaRegistryErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "schema_registry_errors_total",
+			Help: "A counter of the failed schema registry operations",
+		},
+	)
+
+	// promUpstreamSubscriptions is a gauge of the subscriptions to the
+	// services, each shared by the identical client subscriptions
+	promUpstreamSubscriptions = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "upstream_subscriptions",
+			Help: "A gauge of the subscriptions to the services, each shared by the identical client subscriptions",
+		},
+	)
+
+	// promDroppedSubscriptionEvents is a counter of the subscription events
+	// dropped because a client was too slow
+	promDroppedSubscriptionEvents = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "dropped_subscription_events_total",
+			Help: "A counter of the subscription events dropped because a client was too slow",
+		},
+	)
+
+	// promServiceRequestBytes is a counter of the bytes sent to the services
+	promServiceRequestBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "service_request_bytes_total",
+			Help: "A counter of the bytes sent to the services",
+		},
+		[]string{"service"},
+	)
+
+	// promServiceResponseBytes is a counter of the bytes received from the
+	// services, on the wire (compressed) and decoded
+	promServiceResponseBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "service_response_bytes_total",
+			Help: "A counter of the bytes received from the services, on the wire (compressed) and decoded",
+		},
+		[]string{"service", "size"},
+	)
+
+	// promClientLimitRejections is a counter of the operations and
+	// subscriptions rejected because the client exceeded its limit
+	promClientLimitRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_limit_rejections_total",
+			Help: "A counter of the operations and subscriptions rejected because the client exceeded its limit",
+		},
+		[]string{"kind"},
+	)
+
+	// promOperationDurations is a histogram of the execution time of the
+	// operations, by fingerprint
+	promOperationDurations = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "operation_duration_seconds",
+			Help:    "A histogram of the operations execution time, by fingerprint",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"operation_type", "operation_name", "fingerprint"},
+	)
+
+	// promResponseErrors is a counter of the errors of the responses, by code
+	promResponseErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "response_errors_total",
+			Help: "A counter of the errors of the responses, by code",
+		},
+		[]string{"code"},
+	)
+
 	// promHTTPInFlightGauge is a gauge of requests currently being served by the wrapped handler
 	promHTTPInFlightGauge = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "http_in_flight_requests",
@@ -74,6 +332,33 @@ var (
 func RegisterMetrics() {
 	prometheus.MustRegister(promInvalidSchema)
 	prometheus.MustRegister(promServiceUpdateError)
+	prometheus.MustRegister(promSafeMode)
+	prometheus.MustRegister(promHTTPClientDurations)
+	prometheus.MustRegister(promQueryStepDurations)
+	prometheus.MustRegister(promPlanCacheHits)
+	prometheus.MustRegister(promPlanCacheMisses)
+	prometheus.MustRegister(promBoundaryCacheHits)
+	prometheus.MustRegister(promUnboundedListFields)
+	prometheus.MustRegister(promBoundaryCacheMisses)
+	prometheus.MustRegister(promServiceSchemaSkew)
+	prometheus.MustRegister(promServiceSchemaSkewResponses)
+	prometheus.MustRegister(promHedgedRequests)
+	prometheus.MustRegister(promHedgedRequestWins)
+	prometheus.MustRegister(promClientLimitRejections)
+	prometheus.MustRegister(promServiceRequestBytes)
+	prometheus.MustRegister(promServiceResponseBytes)
+	prometheus.MustRegister(promDroppedEvents)
+	prometheus.MustRegister(promSchemaRegistryErrors)
+	prometheus.MustRegister(promUpstreamSubscriptions)
+	prometheus.MustRegister(promDroppedSubscriptionEvents)
+	prometheus.MustRegister(promServiceEndpointRequests)
+	prometheus.MustRegister(promServiceEndpointExcluded)
+	prometheus.MustRegister(promServiceVariantRequestDurations)
+	prometheus.MustRegister(promDeprecatedFieldUsages)
+	prometheus.MustRegister(promLenientNullValues)
+	prometheus.MustRegister(promCancelledOperations)
+	prometheus.MustRegister(promResponseErrors)
+	prometheus.MustRegister(promOperationDurations)
 	prometheus.MustRegister(promHTTPInFlightGauge)
 	prometheus.MustRegister(promHTTPRequestCounter)
 	prometheus.MustRegister(promHTTPResponseDurations)
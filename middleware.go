@@ -3,6 +3,8 @@ package bramble
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,8 +12,10 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/felixge/httpsnoop"
 	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
 )
 
 type middleware func(http.Handler) http.Handler
@@ -20,7 +24,8 @@ type middleware func(http.Handler) http.Handler
 const DebugKey contextKey = "debug"
 
 const (
-	debugHeader = "X-Bramble-Debug"
+	debugHeader     = "X-Bramble-Debug"
+	requestIDHeader = "X-Request-Id"
 )
 
 // DebugInfo contains the requested debug info for a query
@@ -30,6 +35,14 @@ type DebugInfo struct {
 	Plan      bool
 	Timing    bool
 	TraceID   bool
+	Sizes     bool
+	// Schedule adds the scheduling decisions of the plan steps
+	Schedule bool
+	// Pretty indents the JSON response
+	Pretty bool
+	// DryRun plans the operation and generates the documents of the steps
+	// without sending them, they're returned instead of the data
+	DryRun bool
 }
 
 func debugMiddleware(h http.Handler) http.Handler {
@@ -43,6 +56,8 @@ func debugMiddleware(h http.Handler) http.Handler {
 				info.Query = true
 				info.Timing = true
 				info.TraceID = true
+				info.Sizes = true
+				info.Schedule = true
 			case "query":
 				info.Query = true
 			case "variables":
@@ -53,14 +68,76 @@ func debugMiddleware(h http.Handler) http.Handler {
 				info.Timing = true
 			case "traceid":
 				info.TraceID = true
+			case "sizes":
+				info.Sizes = true
+			case "schedule":
+				info.Schedule = true
+			case "pretty":
+				info.Pretty = true
+			case "dryrun":
+				info.DryRun = true
 			}
 		}
 
 		ctx := context.WithValue(r.Context(), DebugKey, info)
+		// downstream Bramble gateways return their own debug info
+		if debug := r.Header.Get(debugHeader); debug != "" {
+			ctx = AddOutgoingRequestsHeaderToContext(ctx, debugHeader, debug)
+		}
+		if info.Pretty && r.Header.Get("Upgrade") == "" {
+			pw := &prettyResponseWriter{ResponseWriter: w}
+			h.ServeHTTP(pw, r.WithContext(ctx))
+			pw.flush()
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestIDMiddleware reads the request ID from the incoming request (or
+// generates one), adds it (and a logger logging it) to the context and to the
+// outgoing requests, and returns it in the response headers.
+func requestIDMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" {
+			id = generateRequestID()
+			r.Header.Set(requestIDHeader, id)
+		}
+
+		ctx := AddRequestIDToContext(r.Context(), id)
+		ctx = addLoggerToContext(ctx, log.WithField("request.id", id))
+		ctx = AddOutgoingRequestsHeaderToContext(ctx, requestIDHeader, id)
+		w.Header().Set(requestIDHeader, id)
+
 		h.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func generateRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDResponseMiddleware adds the request ID to the extensions of the
+// response errors
+func requestIDResponseMiddleware(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	res := next(ctx)
+	id := GetRequestIDFromContext(ctx)
+	if res == nil || id == "" {
+		return res
+	}
+
+	for _, err := range res.Errors {
+		if err.Extensions == nil {
+			err.Extensions = make(map[string]interface{})
+		}
+		err.Extensions["requestId"] = id
+	}
+	return res
+}
+
 func monitoringMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx, event := startEvent(r.Context(), "request")
@@ -68,6 +145,10 @@ func monitoringMiddleware(h http.Handler) http.Handler {
 			defer event.finish()
 		}
 
+		if id := GetRequestIDFromContext(r.Context()); id != "" {
+			event.addField("request.id", id)
+		}
+
 		if host := r.Header.Get("X-Forwarded-Host"); host != "" {
 			event.addField("forwarded_host", host)
 		}
@@ -0,0 +1,154 @@
+package bramble
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// OperationFingerprint returns the hex encoded SHA-256 of the normalized
+// operation. The operations only differing by their literal arguments, the
+// order of their selections, arguments and directives, their fragments or
+// their whitespace have the same fingerprint.
+func OperationFingerprint(op *ast.OperationDefinition) string {
+	h := sha256.Sum256([]byte(normalizeOperation(op)))
+	return hex.EncodeToString(h[:])
+}
+
+// newFingerprintCache returns an empty operation fingerprint cache
+func newFingerprintCache() graphql.Cache {
+	return lru.New(planCacheSize)
+}
+
+// operationFingerprint returns the fingerprint of the operation being
+// executed. The fingerprints are kept by query document, the operation is only
+// normalized the first time the document is executed.
+func (s *ExecutableSchema) operationFingerprint(ctx context.Context) string {
+	opctx := graphql.GetOperationContext(ctx)
+	if s.fingerprints == nil || opctx.RawQuery == "" {
+		return OperationFingerprint(opctx.Operation)
+	}
+
+	key := opctx.OperationName + "\x00" + opctx.RawQuery
+	if fingerprint, ok := s.fingerprints.Get(ctx, key); ok {
+		return fingerprint.(string)
+	}
+	fingerprint := OperationFingerprint(opctx.Operation)
+	s.fingerprints.Add(ctx, key, fingerprint)
+	return fingerprint
+}
+
+// AddOperationFingerprintToContext adds the fingerprint of the operation
+// being executed to the context
+func AddOperationFingerprintToContext(ctx context.Context, fingerprint string) context.Context {
+	return context.WithValue(ctx, operationFingerprintContextKey, fingerprint)
+}
+
+// GetOperationFingerprintFromContext returns the fingerprint of the operation
+// being executed, or an empty string
+func GetOperationFingerprintFromContext(ctx context.Context) string {
+	fingerprint, _ := ctx.Value(operationFingerprintContextKey).(string)
+	return fingerprint
+}
+
+// observeOperationDuration reports the duration of the operation, by
+// fingerprint
+func observeOperationDuration(op *ast.OperationDefinition, fingerprint string, duration time.Duration) {
+	promOperationDurations.WithLabelValues(string(op.Operation), op.Name, fingerprint).Observe(duration.Seconds())
+}
+
+// normalizeOperation formats the operation on a single line with the
+// fragments inlined, the literal arguments replaced with "?" and the
+// selections, arguments, directives and variables sorted, so the operations
+// only differing by their arguments or the order of their selections have
+// the same normalized query
+func normalizeOperation(op *ast.OperationDefinition) string {
+	var sb strings.Builder
+	sb.WriteString(string(op.Operation))
+	if op.Name != "" {
+		sb.WriteString(" " + op.Name)
+	}
+	if len(op.VariableDefinitions) > 0 {
+		vars := make([]string, 0, len(op.VariableDefinitions))
+		for _, v := range op.VariableDefinitions {
+			vars = append(vars, fmt.Sprintf("$%s: %s", v.Variable, v.Type.String()))
+		}
+		sort.Strings(vars)
+		sb.WriteString("(" + strings.Join(vars, ", ") + ")")
+	}
+	sb.WriteString(normalizeDirectives(op.Directives))
+	sb.WriteString(normalizeSelectionSet(op.SelectionSet))
+	return sb.String()
+}
+
+func normalizeSelectionSet(selectionSet ast.SelectionSet) string {
+	selections := make([]string, 0, len(selectionSet))
+	for _, selection := range selectionSet {
+		var sb strings.Builder
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if selection.Alias != "" && selection.Alias != selection.Name {
+				sb.WriteString(selection.Alias + ": ")
+			}
+			sb.WriteString(selection.Name)
+			sb.WriteString(normalizeArguments(selection.Arguments))
+			sb.WriteString(normalizeDirectives(selection.Directives))
+			if len(selection.SelectionSet) > 0 {
+				sb.WriteString(normalizeSelectionSet(selection.SelectionSet))
+			}
+		case *ast.InlineFragment:
+			sb.WriteString("...")
+			if selection.TypeCondition != "" {
+				sb.WriteString(" on " + selection.TypeCondition)
+			}
+			sb.WriteString(normalizeDirectives(selection.Directives))
+			sb.WriteString(normalizeSelectionSet(selection.SelectionSet))
+		case *ast.FragmentSpread:
+			sb.WriteString("... on " + selection.Definition.TypeCondition)
+			sb.WriteString(normalizeDirectives(selection.Directives))
+			sb.WriteString(normalizeSelectionSet(selection.Definition.SelectionSet))
+		}
+		selections = append(selections, sb.String())
+	}
+	sort.Strings(selections)
+	return " { " + strings.Join(selections, " ") + " }"
+}
+
+func normalizeArguments(arguments ast.ArgumentList) string {
+	if len(arguments) == 0 {
+		return ""
+	}
+	args := make([]string, 0, len(arguments))
+	for _, arg := range arguments {
+		args = append(args, arg.Name+": "+normalizeValue(arg.Value))
+	}
+	sort.Strings(args)
+	return "(" + strings.Join(args, ", ") + ")"
+}
+
+func normalizeDirectives(directives ast.DirectiveList) string {
+	if len(directives) == 0 {
+		return ""
+	}
+	dirs := make([]string, 0, len(directives))
+	for _, d := range directives {
+		dirs = append(dirs, "@"+d.Name+normalizeArguments(d.Arguments))
+	}
+	sort.Strings(dirs)
+	return " " + strings.Join(dirs, " ")
+}
+
+func normalizeValue(v *ast.Value) string {
+	if v.Kind == ast.Variable {
+		return v.String()
+	}
+	return "?"
+}
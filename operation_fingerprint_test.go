@@ -0,0 +1,128 @@
+package bramble
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const fingerprintTestSchema = `
+	type Movie {
+		id: ID!
+		title(language: String, format: String): String
+	}
+
+	type Query {
+		movie(id: ID!): Movie
+		movies(ids: [ID!]!, limit: Int): [Movie!]!
+	}`
+
+func TestNormalizeOperation(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: fingerprintTestSchema})
+	query := gqlparser.MustLoadQuery(schema, `query Movies($limit: Int, $skip: Boolean!) {
+		first: movie(id: "1") { ...MovieFields }
+		movies(limit: $limit, ids: ["1", "2"]) { ... on Movie { id } title @skip(if: $skip) }
+	}
+
+	fragment MovieFields on Movie {
+		title(language: "fr")
+	}`)
+	assert.Equal(t,
+		`query Movies($limit: Int, $skip: Boolean!) { first: movie(id: ?) { ... on Movie { title(language: ?) } } movies(ids: ?, limit: $limit) { ... on Movie { id } title @skip(if: $skip) } }`,
+		normalizeOperation(query.Operations[0]),
+	)
+}
+
+func TestOperationFingerprint(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: fingerprintTestSchema})
+	fingerprint := func(query string) string {
+		return OperationFingerprint(gqlparser.MustLoadQuery(schema, query).Operations[0])
+	}
+
+	reference := fingerprint(`query Movie { movie(id: "1") { id ... on Movie { title(language: "fr", format: "short") } } }`)
+	assert.Len(t, reference, 64)
+
+	// same logical operation
+	for _, query := range []string{
+		`query Movie { movie(id: "2") { id ... on Movie { title(language: "en", format: "long") } } }`,
+		`query Movie {
+			movie(id: "1") {
+				... on Movie {
+					title(format: "short", language: "fr")
+				}
+				id
+			}
+		}`,
+		`query Movie { movie(id: "1") { id ...MovieFields } } fragment MovieFields on Movie { title(language: "fr", format: "short") }`,
+	} {
+		assert.Equal(t, reference, fingerprint(query), query)
+	}
+
+	// different operations
+	for _, query := range []string{
+		`query OtherName { movie(id: "1") { id ... on Movie { title(language: "fr", format: "short") } } }`,
+		`query Movie { movie(id: "1") { id ... on Movie { title(language: "fr") } } }`,
+		`query Movie { movie(id: "1") { id ... on Movie { name: title(language: "fr", format: "short") } } }`,
+		`query Movie { movie(id: "1") { id ... on Movie { title(language: "fr", format: "short") @include(if: false) } } }`,
+		`query Movie { movie(id: "1") { id title(language: "fr", format: "short") } }`,
+	} {
+		assert.NotEqual(t, reference, fingerprint(query), query)
+	}
+}
+
+type fingerprintHooks struct {
+	BaseExecutionHooks
+	fingerprint string
+}
+
+func (h *fingerprintHooks) OnRequest(ctx context.Context, op *ast.OperationDefinition, variables map[string]interface{}) (context.Context, error) {
+	h.fingerprint = GetOperationFingerprintFromContext(ctx)
+	return ctx, nil
+}
+
+func TestQueryExecutionAddsTheOperationFingerprintToTheContext(t *testing.T) {
+	hooks := &fingerprintHooks{}
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: fingerprintTestSchema,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "movie": { "id": "1" } } }`))
+				}),
+			},
+		},
+		query:    `query Movie { movie(id: "1") { id } }`,
+		expected: `{ "movie": { "id": "1" } }`,
+		hooks:    []ExecutionHooks{hooks},
+	}
+	f.checkSuccess(t)
+
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: fingerprintTestSchema})
+	assert.Equal(t, OperationFingerprint(gqlparser.MustLoadQuery(schema, `query Movie { movie(id: "2") { id } }`).Operations[0]), hooks.fingerprint)
+}
+
+func TestOperationFingerprintIsKeptByQueryDocument(t *testing.T) {
+	es := newExecutableSchema(nil, 50, nil)
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: fingerprintTestSchema})
+	query := `query Movie { movie(id: "1") { id } }`
+	op := gqlparser.MustLoadQuery(schema, query).Operations[0]
+	ctx := graphql.WithOperationContext(context.Background(), &graphql.OperationContext{
+		RawQuery:      query,
+		OperationName: "Movie",
+		Operation:     op,
+	})
+
+	assert.Equal(t, OperationFingerprint(op), es.operationFingerprint(ctx))
+	fingerprint, ok := es.fingerprints.Get(ctx, "Movie\x00"+query)
+	require.True(t, ok)
+	assert.Equal(t, OperationFingerprint(op), fingerprint)
+
+	es.fingerprints.Add(ctx, "Movie\x00"+query, "kept")
+	assert.Equal(t, "kept", es.operationFingerprint(ctx))
+}
@@ -0,0 +1,51 @@
+package bramble
+
+import (
+	"net/http"
+	"strings"
+)
+
+// nameRequest names the document of the request after the client operation,
+// so the services can attribute the traffic to the gateway operations. The
+// documents of anonymous operations are left untouched.
+func nameRequest(req *Request, operationName string) {
+	if operationName == "" || req.OperationName != "" {
+		return
+	}
+	req.Query = namedDocument(req.Query, operationName)
+	req.OperationName = operationName
+}
+
+// namedDocument returns the document of a single anonymous operation
+// (e.g. "{ ... }" or "mutation { ... }") with the given name
+func namedDocument(document, name string) string {
+	if strings.HasPrefix(document, "{") {
+		return "query " + name + " " + document
+	}
+	for _, operation := range []string{"query", "mutation", "subscription"} {
+		if strings.HasPrefix(document, operation+" {") {
+			return operation + " " + name + document[len(operation):]
+		}
+	}
+	return document
+}
+
+// clientMetadataMiddleware forwards the ClientMetadataHeaders of the incoming
+// request (e.g. "apollographql-client-name") to all the services
+func clientMetadataMiddleware(es *ExecutableSchema) middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if es == nil || len(es.ClientMetadataHeaders) == 0 {
+				h.ServeHTTP(w, r)
+				return
+			}
+			ctx := r.Context()
+			for _, header := range es.ClientMetadataHeaders {
+				for _, value := range r.Header.Values(header) {
+					ctx = AddOutgoingRequestsHeaderToContext(ctx, header, value)
+				}
+			}
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package bramble
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamedDocument(t *testing.T) {
+	assert.Equal(t, `query Movies { movies { id } }`, namedDocument(`{ movies { id } }`, "Movies"))
+	assert.Equal(t, `query Movies { movies { id } }`, namedDocument(`query { movies { id } }`, "Movies"))
+	assert.Equal(t, `mutation AddMovie { addMovie { id } }`, namedDocument(`mutation { addMovie { id } }`, "AddMovie"))
+	assert.Equal(t, `subscription OnMovie { movieAdded { id } }`, namedDocument(`subscription { movieAdded { id } }`, "OnMovie"))
+	// documents that are already named are left untouched
+	assert.Equal(t, `query Other { movies { id } }`, namedDocument(`query Other { movies { id } }`, "Movies"))
+}
+
+func TestQueryExecutionForwardsOperationName(t *testing.T) {
+	var mu sync.Mutex
+	var requests []Request
+	record := func(r *http.Request) {
+		var req Request
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+	}
+
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+
+				type Query {
+					movie(id: ID!): Movie!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					record(r)
+					w.Write([]byte(`{ "data": { "movie": { "_id": "1", "id": "1", "title": "Test title" } } }`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+
+				type Movie @boundary {
+					id: ID!
+					release: Int
+				}
+
+				type Query {
+					node(id: ID!): Node
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					record(r)
+					w.Write([]byte(`{ "data": { "_0": { "_id": "1", "release": 2007 } } }`))
+				}),
+			},
+		},
+		query: `query MovieDetails {
+			movie(id: "1") {
+				id
+				title
+				release
+			}
+		}`,
+		expected: `{
+			"movie": {
+				"id": "1",
+				"title": "Test title",
+				"release": 2007
+			}
+		}`,
+	}
+	f.checkSuccess(t)
+
+	require.Len(t, requests, 2)
+	for _, req := range requests {
+		assert.Equal(t, "MovieDetails", req.OperationName)
+		assert.True(t, strings.HasPrefix(req.Query, "query MovieDetails {"), req.Query)
+	}
+}
+
+func TestClientMetadataHeaders(t *testing.T) {
+	var mu sync.Mutex
+	var headers []http.Header
+	var operationNames []string
+	service := newTestService(t, "test", `type Service { name: String! version: String! schema: String! }
+	type Query { me: String service: Service! }`, func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		headers = append(headers, r.Header)
+		operationNames = append(operationNames, req.OperationName)
+		mu.Unlock()
+		w.Write([]byte(`{ "data": { "me": "me" } }`))
+	})
+
+	es := newExecutableSchema(nil, 50, nil, NewService(service.URL))
+	require.NoError(t, es.UpdateSchema(true))
+	router := NewGateway(es, nil).Router()
+
+	query := func() {
+		body, _ := json.Marshal(map[string]string{"query": "query Me { me }"})
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("apollographql-client-name", "web")
+		req.Header.Set("apollographql-client-version", "1.2.3")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	// the headers are only forwarded when configured
+	query()
+	es.ClientMetadataHeaders = []string{"apollographql-client-name", "apollographql-client-version"}
+	query()
+
+	require.Len(t, headers, 2)
+	assert.Empty(t, headers[0].Get("apollographql-client-name"))
+	assert.Equal(t, "web", headers[1].Get("apollographql-client-name"))
+	assert.Equal(t, "1.2.3", headers[1].Get("apollographql-client-version"))
+	assert.Equal(t, []string{"Me", "Me"}, operationNames)
+}
@@ -0,0 +1,214 @@
+package bramble
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// unboundedListCode is the error code returned when an operation selects an
+// unbounded list field with the reject policy
+const unboundedListCode = "UNBOUNDED_LIST"
+
+// PaginationPolicy is the action taken when an operation selects a paginated
+// field without any pagination argument
+type PaginationPolicy string
+
+const (
+	// WarnPaginationPolicy reports the unbounded fields in the
+	// unboundedLists extension of the response
+	WarnPaginationPolicy PaginationPolicy = "warn"
+	// LimitPaginationPolicy passes the default limit to the unbounded fields,
+	// and reports them like the warn policy
+	LimitPaginationPolicy PaginationPolicy = "limit"
+	// RejectPaginationPolicy rejects the operations selecting unbounded
+	// fields
+	RejectPaginationPolicy PaginationPolicy = "reject"
+)
+
+// defaultPaginationArguments are the pagination arguments when none are
+// configured
+var defaultPaginationArguments = []string{"first", "last", "limit"}
+
+// defaultPaginationLimit is the limit passed with the limit policy when none
+// is configured
+const defaultPaginationLimit = 100
+
+// PaginationGuardConfig protects the services from the operations selecting
+// a whole list by accident. A field declaring one of the pagination arguments
+// (without a default value) is unbounded when the operation passes none of
+// them, at any depth.
+type PaginationGuardConfig struct {
+	// Policy is the action taken for the unbounded fields, the guard is
+	// disabled if empty
+	Policy PaginationPolicy `json:"policy"`
+	// Arguments are the pagination arguments, defaults to first, last and
+	// limit. The limit policy passes the default limit to the first one
+	// declared by the field.
+	Arguments []string `json:"arguments"`
+	// DefaultLimit is the limit passed by the limit policy, defaults to 100
+	DefaultLimit int `json:"default-limit"`
+}
+
+// Validate checks the policy and the default limit are valid
+func (c PaginationGuardConfig) Validate() error {
+	switch c.Policy {
+	case "", WarnPaginationPolicy, LimitPaginationPolicy, RejectPaginationPolicy:
+	default:
+		return fmt.Errorf("unknown policy %q", c.Policy)
+	}
+	if c.DefaultLimit < 0 {
+		return errors.New("default-limit must be positive")
+	}
+	for _, arg := range c.Arguments {
+		if arg == "" {
+			return errors.New("arguments can't be empty")
+		}
+	}
+	return nil
+}
+
+func (c PaginationGuardConfig) arguments() []string {
+	if len(c.Arguments) > 0 {
+		return c.Arguments
+	}
+	return defaultPaginationArguments
+}
+
+func (c PaginationGuardConfig) defaultLimit() int {
+	if c.DefaultLimit > 0 {
+		return c.DefaultLimit
+	}
+	return defaultPaginationLimit
+}
+
+// UnboundedListWarning is an unbounded field selected by an operation, as
+// reported in the unboundedLists extension of the response
+type UnboundedListWarning struct {
+	// Field is the coordinate of the field (Type.field)
+	Field string `json:"field"`
+	// Path is the response path of the field, without list indices
+	Path []string `json:"path"`
+	// Limit is the limit passed to the field by the limit policy, if any
+	Limit int `json:"limit,omitempty"`
+}
+
+// guardPagination applies the policy to the unbounded fields of the operation.
+// It returns the warnings of the unbounded fields, or the errors if they're
+// rejected. The operation must be a copy of the cached operation, the limit
+// policy adds the limit to its fields.
+func (c PaginationGuardConfig) guardPagination(op *ast.OperationDefinition, variables map[string]interface{}) ([]UnboundedListWarning, gqlerror.List) {
+	if c.Policy == "" {
+		return nil, nil
+	}
+
+	arguments := c.arguments()
+	var warnings []UnboundedListWarning
+	var errs gqlerror.List
+	var walk func(selectionSet ast.SelectionSet, path []string)
+	walk = func(selectionSet ast.SelectionSet, path []string) {
+		for _, selection := range selectionSet {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				fieldPath := append(path[:len(path):len(path)], selection.Alias)
+				if paginationArgs := unboundedFieldArguments(selection, arguments, variables); len(paginationArgs) > 0 {
+					field := selection.ObjectDefinition.Name + "." + selection.Name
+					promUnboundedListFields.WithLabelValues(field, string(c.Policy)).Inc()
+					switch c.Policy {
+					case RejectPaginationPolicy:
+						err := gqlerror.ErrorPosf(selection.Position, "unbounded list field %q: one of the arguments %s is required", field, strings.Join(paginationArgs, ", "))
+						err.Path = stringsToPath(fieldPath)
+						err.Extensions = map[string]interface{}{"code": unboundedListCode}
+						errs = append(errs, err)
+					case LimitPaginationPolicy:
+						warning := UnboundedListWarning{Field: field, Path: fieldPath}
+						if injectPaginationLimit(selection, paginationArgs, c.defaultLimit()) {
+							warning.Limit = c.defaultLimit()
+						}
+						warnings = append(warnings, warning)
+					default:
+						warnings = append(warnings, UnboundedListWarning{Field: field, Path: fieldPath})
+					}
+				}
+				walk(selection.SelectionSet, fieldPath)
+			case *ast.InlineFragment:
+				walk(selection.SelectionSet, path)
+			case *ast.FragmentSpread:
+				if selection.Definition != nil {
+					walk(selection.Definition.SelectionSet, path)
+				}
+			}
+		}
+	}
+	walk(op.SelectionSet, nil)
+	return warnings, errs
+}
+
+// unboundedFieldArguments returns the pagination arguments declared by the
+// field if the operation passes none of them, and they don't have a default
+// value. Passing null counts as passing nothing.
+func unboundedFieldArguments(field *ast.Field, arguments []string, variables map[string]interface{}) []string {
+	if field.Definition == nil || field.ObjectDefinition == nil {
+		return nil
+	}
+	var declared []string
+	for _, name := range arguments {
+		argDef := field.Definition.Arguments.ForName(name)
+		if argDef == nil {
+			continue
+		}
+		if argDef.DefaultValue != nil {
+			return nil
+		}
+		if arg := field.Arguments.ForName(name); arg != nil && arg.Value != nil {
+			switch arg.Value.Kind {
+			case ast.NullValue:
+			case ast.Variable:
+				if variables[arg.Value.Raw] != nil {
+					return nil
+				}
+			default:
+				return nil
+			}
+		}
+		declared = append(declared, name)
+	}
+	return declared
+}
+
+// injectPaginationLimit passes the limit to the first pagination argument of
+// type Int. It returns false if the field has no such argument.
+func injectPaginationLimit(field *ast.Field, paginationArgs []string, limit int) bool {
+	for _, name := range paginationArgs {
+		argDef := field.Definition.Arguments.ForName(name)
+		if argDef.Type.Name() != "Int" || argDef.Type.Elem != nil {
+			continue
+		}
+		// the argument list can be shared with the cached operation, so we
+		// need to make a copy
+		args := make(ast.ArgumentList, 0, len(field.Arguments)+1)
+		for _, arg := range field.Arguments {
+			if arg.Name != name {
+				args = append(args, arg)
+			}
+		}
+		field.Arguments = append(args, &ast.Argument{
+			Name:  name,
+			Value: &ast.Value{Kind: ast.IntValue, Raw: strconv.Itoa(limit)},
+		})
+		return true
+	}
+	return false
+}
+
+func stringsToPath(path []string) ast.Path {
+	res := make(ast.Path, 0, len(path))
+	for _, p := range path {
+		res = append(res, ast.PathName(p))
+	}
+	return res
+}
@@ -0,0 +1,135 @@
+package bramble
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const paginationGuardTestSchema = `
+	type Movie {
+		id: ID!
+		title: String!
+		actors(first: Int, after: String): [Actor!]!
+		genres: [String!]!
+	}
+
+	type Actor {
+		name: String!
+	}
+
+	type Query {
+		movies(first: Int, last: Int): [Movie!]!
+		moviesByIds(ids: [ID!]!): [Movie!]!
+		topMovies(limit: Int = 10): [Movie!]!
+		search(first: String): [Movie!]!
+	}`
+
+func TestPaginationGuardConfigValidate(t *testing.T) {
+	assert.NoError(t, PaginationGuardConfig{}.Validate())
+	assert.NoError(t, PaginationGuardConfig{Policy: LimitPaginationPolicy, DefaultLimit: 50, Arguments: []string{"first"}}.Validate())
+	assert.EqualError(t, PaginationGuardConfig{Policy: "ignore"}.Validate(), `unknown policy "ignore"`)
+	assert.EqualError(t, PaginationGuardConfig{Policy: WarnPaginationPolicy, DefaultLimit: -1}.Validate(), "default-limit must be positive")
+	assert.EqualError(t, PaginationGuardConfig{Policy: WarnPaginationPolicy, Arguments: []string{""}}.Validate(), "arguments can't be empty")
+}
+
+func TestGuardPagination(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: paginationGuardTestSchema})
+	load := func(query string) *ast.OperationDefinition {
+		return gqlparser.MustLoadQuery(schema, query).Operations[0]
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		warnings, errs := PaginationGuardConfig{}.guardPagination(load(`{ movies { id } }`), nil)
+		assert.Empty(t, warnings)
+		assert.Empty(t, errs)
+	})
+
+	t.Run("bounded fields", func(t *testing.T) {
+		op := load(`query($n: Int) {
+			a: movies(first: 10) { id }
+			b: movies(first: null, last: 5) { id }
+			c: movies(first: $n) { actors(first: 1) { name } }
+			moviesByIds(ids: ["1"]) { genres }
+			topMovies { id }
+		}`)
+		warnings, errs := PaginationGuardConfig{Policy: RejectPaginationPolicy}.guardPagination(op, map[string]interface{}{"n": 5})
+		assert.Empty(t, warnings)
+		assert.Empty(t, errs)
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		op := load(`query($n: Int) {
+			movies(first: $n) { id ... on Movie { actors { name } } }
+		}`)
+		warnings, errs := PaginationGuardConfig{Policy: WarnPaginationPolicy}.guardPagination(op, map[string]interface{}{})
+		assert.Empty(t, errs)
+		assert.Equal(t, []UnboundedListWarning{
+			{Field: "Query.movies", Path: []string{"movies"}},
+			{Field: "Movie.actors", Path: []string{"movies", "actors"}},
+		}, warnings)
+		assert.Len(t, op.SelectionSet[0].(*ast.Field).Arguments, 1)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		op := load(`{ movies { actors { name } } search { id } }`)
+		original := op.SelectionSet[0].(*ast.Field).Arguments
+		warnings, errs := PaginationGuardConfig{Policy: LimitPaginationPolicy, Arguments: []string{"first"}}.guardPagination(op, nil)
+		assert.Empty(t, errs)
+		assert.Equal(t, []UnboundedListWarning{
+			{Field: "Query.movies", Path: []string{"movies"}, Limit: 100},
+			{Field: "Movie.actors", Path: []string{"movies", "actors"}, Limit: 100},
+			{Field: "Query.search", Path: []string{"search"}},
+		}, warnings)
+		movies := op.SelectionSet[0].(*ast.Field)
+		require.Len(t, movies.Arguments, 1)
+		assert.Equal(t, "first", movies.Arguments[0].Name)
+		assert.Equal(t, &ast.Value{Kind: ast.IntValue, Raw: "100"}, movies.Arguments[0].Value)
+		assert.Len(t, movies.SelectionSet[0].(*ast.Field).Arguments, 1)
+		assert.Empty(t, op.SelectionSet[1].(*ast.Field).Arguments)
+		assert.Empty(t, original)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		op := load(`{
+			movies(last: 1) { id }
+			all: movies { id }
+		}`)
+		warnings, errs := PaginationGuardConfig{Policy: RejectPaginationPolicy}.guardPagination(op, nil)
+		assert.Empty(t, warnings)
+		require.Len(t, errs, 1)
+		assert.Equal(t, &gqlerror.Error{
+			Message:    `unbounded list field "Query.movies": one of the arguments first, last is required`,
+			Path:       ast.Path{ast.PathName("all")},
+			Locations:  []gqlerror.Location{{Line: 3, Column: 4}},
+			Extensions: map[string]interface{}{"code": unboundedListCode},
+		}, errs[0])
+	})
+}
+
+func TestQueryExecutionPaginationLimit(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: paginationGuardTestSchema,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var req Request
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+					assert.Contains(t, req.Query, "movies(first: 20)")
+					w.Write([]byte(`{ "data": { "movies": [{ "title": "Test title" }] } }`))
+				}),
+			},
+		},
+		query:           `{ movies { title } }`,
+		expected:        `{ "movies": [{ "title": "Test title" }] }`,
+		paginationGuard: PaginationGuardConfig{Policy: LimitPaginationPolicy, DefaultLimit: 20},
+	}
+	f.checkSuccess(t)
+	assert.Equal(t, []UnboundedListWarning{{Field: "Query.movies", Path: []string{"movies"}, Limit: 20}}, f.resp.Extensions["unboundedLists"])
+}
@@ -0,0 +1,123 @@
+package bramble
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// PayloadSizes are the sizes of the payloads exchanged with a service
+type PayloadSizes struct {
+	Requests int64 `json:"requests"`
+	// RequestBytes is the size of the request bodies
+	RequestBytes int64 `json:"requestBytes"`
+	// ResponseBytes is the decoded (uncompressed) size of the response bodies
+	ResponseBytes int64 `json:"responseBytes"`
+	// ResponseWireBytes is the size of the response bodies on the wire, it's
+	// smaller than ResponseBytes when the responses are compressed
+	ResponseWireBytes int64 `json:"responseWireBytes"`
+}
+
+func (p *PayloadSizes) add(other PayloadSizes) {
+	p.Requests += other.Requests
+	p.RequestBytes += other.RequestBytes
+	p.ResponseBytes += other.ResponseBytes
+	p.ResponseWireBytes += other.ResponseWireBytes
+}
+
+// payloadSizes collects the payload sizes of the downstream requests of an
+// operation, by URL. It is safe for concurrent use.
+type payloadSizes struct {
+	mu    sync.Mutex
+	sizes map[string]*PayloadSizes
+}
+
+func addPayloadSizesToContext(ctx context.Context) (context.Context, *payloadSizes) {
+	p := &payloadSizes{sizes: make(map[string]*PayloadSizes)}
+	return context.WithValue(ctx, payloadSizesContextKey, p), p
+}
+
+func getPayloadSizesFromContext(ctx context.Context) *payloadSizes {
+	p, _ := ctx.Value(payloadSizesContextKey).(*payloadSizes)
+	return p
+}
+
+func (p *payloadSizes) add(url string, sizes PayloadSizes) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.sizes[url]
+	if !ok {
+		s = &PayloadSizes{}
+		p.sizes[url] = s
+	}
+	s.add(sizes)
+}
+
+// byURL returns a copy of the collected sizes
+func (p *payloadSizes) byURL() map[string]PayloadSizes {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make(map[string]PayloadSizes, len(p.sizes))
+	for url, s := range p.sizes {
+		res[url] = *s
+	}
+	return res
+}
+
+// total returns the sum of the sizes of every URL
+func (p *payloadSizes) total() PayloadSizes {
+	var total PayloadSizes
+	for _, s := range p.byURL() {
+		total.add(s)
+	}
+	return total
+}
+
+// observe reports the collected sizes in the metrics, the URLs are resolved to
+// the names of the services
+func (p *payloadSizes) observe(serviceName func(url string) string) {
+	for url, s := range p.byURL() {
+		name := serviceName(url)
+		promServiceRequestBytes.WithLabelValues(name).Add(float64(s.RequestBytes))
+		promServiceResponseBytes.WithLabelValues(name, "decoded").Add(float64(s.ResponseBytes))
+		promServiceResponseBytes.WithLabelValues(name, "wire").Add(float64(s.ResponseWireBytes))
+	}
+}
+
+// serviceNameForURL returns the name of the service the URL belongs to, the
+// URL can be the service URL, one of its endpoints or one of its replicas. The
+// URL itself is returned for unknown URLs.
+func (s *ExecutableSchema) serviceNameForURL(url string) string {
+	if svc, ok := s.Services[url]; ok {
+		return svc.Name
+	}
+	for serviceURL, svc := range s.Services {
+		for _, u := range s.ServiceEndpoints[serviceURL].allURLs() {
+			if u == url {
+				return svc.Name
+			}
+		}
+		for _, u := range s.ServiceReplicas[serviceURL] {
+			if u == url {
+				return svc.Name
+			}
+		}
+	}
+	return url
+}
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
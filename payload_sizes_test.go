@@ -0,0 +1,88 @@
+package bramble
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPayloadSizes(t *testing.T) {
+	body := `{ "data": { "a": "` + strings.Repeat("a", 1000) + `" } }`
+
+	t.Run("compressed response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "gzip", r.Header.Get("Accept-Encoding"))
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(body))
+			gz.Close()
+		}))
+		defer server.Close()
+
+		ctx, sizes := addPayloadSizesToContext(context.Background())
+		var resp struct{ A string }
+		require.NoError(t, NewClient().Request(ctx, server.URL, NewRequest("{ a }"), &resp))
+		assert.Len(t, resp.A, 1000)
+
+		s := sizes.byURL()[server.URL]
+		assert.Equal(t, int64(1), s.Requests)
+		assert.Equal(t, int64(len(`{"query":"{ a }"}`)+1), s.RequestBytes)
+		assert.Equal(t, int64(len(body)), s.ResponseBytes)
+		assert.Less(t, s.ResponseWireBytes, int64(100))
+	})
+
+	t.Run("uncompressed response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		defer server.Close()
+
+		ctx, sizes := addPayloadSizesToContext(context.Background())
+		var resp struct{ A string }
+		require.NoError(t, NewClient().Request(ctx, server.URL, NewRequest("{ a }"), &resp))
+		require.NoError(t, NewClient().Request(ctx, server.URL, NewRequest("{ a }"), &resp))
+
+		s := sizes.total()
+		assert.Equal(t, int64(2), s.Requests)
+		assert.Equal(t, int64(2*len(body)), s.ResponseBytes)
+		assert.Equal(t, s.ResponseBytes, s.ResponseWireBytes)
+	})
+
+	t.Run("compressed response exceeding the max size", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(body))
+			gz.Close()
+		}))
+		defer server.Close()
+
+		var resp struct{ A string }
+		err := NewClient(WithMaxResponseSize(100)).Request(context.Background(), server.URL, NewRequest("{ a }"), &resp)
+		assert.EqualError(t, err, "response exceeded maximum size of 100 bytes")
+	})
+}
+
+func TestServiceNameForURL(t *testing.T) {
+	es := &ExecutableSchema{
+		Services: map[string]*Service{
+			"http://movies": {ServiceURL: "http://movies", Name: "movies"},
+		},
+		ServiceEndpoints: map[string]ServiceEndpoints{
+			"http://movies": {URLs: []string{"http://movies-1"}},
+		},
+		ServiceReplicas: map[string][]string{
+			"http://movies": {"http://movies-replica"},
+		},
+	}
+	assert.Equal(t, "movies", es.serviceNameForURL("http://movies"))
+	assert.Equal(t, "movies", es.serviceNameForURL("http://movies-1"))
+	assert.Equal(t, "movies", es.serviceNameForURL("http://movies-replica"))
+	assert.Equal(t, "http://other", es.serviceNameForURL("http://other"))
+}
@@ -4,11 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/vektah/gqlparser/v2/ast"
 )
 
+// injectedIDAlias is the alias of the boundary id field injected by the
+// planner when the client didn't select it
+const injectedIDAlias = "_id"
+
+// injectedTypenameAlias is the alias of the __typename field injected by the
+// planner when the type of the objects is needed (see injectTypename)
+const injectedTypenameAlias = "_typename"
+
 // QueryPlanStep is a single execution step
 type QueryPlanStep struct {
 	ServiceURL     string
@@ -17,6 +27,20 @@ type QueryPlanStep struct {
 	SelectionSet   ast.SelectionSet
 	InsertionPoint []string
 	Then           []*QueryPlanStep
+	// Join is set if the step fetches the objects of a join field
+	Join *JoinStep
+	// InjectedFields are the fields added to the selection set to merge the
+	// results (boundary ids and join keys) but not requested by the client.
+	// They are given as dot separated paths of aliases, relative to the step
+	// selection set, and stripped from the response once the query is
+	// executed.
+	InjectedFields []string
+	// Requires are the fields of other services required by the fields of
+	// the step, their values are passed to the boundary query
+	Requires []string
+
+	// document is the pre-formatted selection set, set for the cached plans
+	document string
 }
 
 // MarshalJSON marshals the step the JSON
@@ -29,12 +53,18 @@ func (s *QueryPlanStep) MarshalJSON() ([]byte, error) {
 		ParentType     string
 		SelectionSet   string
 		InsertionPoint []string
+		InjectedFields []string  `json:",omitempty"`
+		Requires       []string  `json:",omitempty"`
+		Join           *JoinStep `json:",omitempty"`
 		Then           []*QueryPlanStep
 	}{
 		ServiceURL:     s.ServiceURL,
 		ParentType:     s.ParentType,
 		SelectionSet:   formatSelectionSetSingleLine(ctx, nil, s.SelectionSet),
 		InsertionPoint: s.InsertionPoint,
+		InjectedFields: s.InjectedFields,
+		Requires:       s.Requires,
+		Join:           s.Join,
 		Then:           s.Then,
 	})
 }
@@ -51,6 +81,8 @@ type PlanningContext struct {
 	Locations  FieldURLMap
 	IsBoundary map[string]bool
 	Services   map[string]*Service
+	Joins      JoinsMap
+	Requires   RequiresMap
 }
 
 // Plan returns a query plan from the given planning context
@@ -61,19 +93,113 @@ func Plan(ctx *PlanningContext) (*QueryPlan, error) {
 		parentType = queryObjectName
 	case ast.Mutation:
 		parentType = mutationObjectName
+	case ast.Subscription:
+		parentType = subscriptionObjectName
 	default:
 		return nil, fmt.Errorf("not implemented")
 	}
 
-	steps, err := createSteps(ctx, nil, parentType, "", ctx.Operation.SelectionSet, false)
+	var steps []*QueryPlanStep
+	var err error
+	if parentType == mutationObjectName {
+		steps, err = createMutationSteps(ctx, ctx.Operation.SelectionSet)
+	} else {
+		steps, err = createSteps(ctx, nil, parentType, "", ctx.Operation.SelectionSet, false)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if err := checkRequiredArguments(steps); err != nil {
+		return nil, err
+	}
 	return &QueryPlan{
 		RootSteps: steps,
 	}, nil
 }
 
+// checkRequiredArguments returns an error if a field of the steps misses a
+// non-null argument without default value, e.g. the key field of a join
+// taking arguments. The service would reject the document.
+func checkRequiredArguments(steps []*QueryPlanStep) error {
+	for _, step := range steps {
+		if err := checkSelectionSetArguments(step, step.SelectionSet); err != nil {
+			return err
+		}
+		if err := checkRequiredArguments(step.Then); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkSelectionSetArguments(step *QueryPlanStep, selectionSet ast.SelectionSet) error {
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if selection.Definition != nil {
+				for _, arg := range selection.Definition.Arguments {
+					if arg.Type.NonNull && arg.DefaultValue == nil && selection.Arguments.ForName(arg.Name) == nil {
+						return fmt.Errorf("argument %q of field %q is required by service %q but isn't provided by the plan", arg.Name, selection.Name, step.ServiceName)
+					}
+				}
+			}
+			if err := checkSelectionSetArguments(step, selection.SelectionSet); err != nil {
+				return err
+			}
+		case *ast.InlineFragment:
+			if err := checkSelectionSetArguments(step, selection.SelectionSet); err != nil {
+				return err
+			}
+		case *ast.FragmentSpread:
+			if err := checkSelectionSetArguments(step, selection.Definition.SelectionSet); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// createMutationSteps creates the root steps of a mutation. The top-level
+// mutation fields must be executed serially, so the steps are created in the
+// order of the fields: consecutive fields resolved by the same service are
+// grouped in a single step, and each namespace field gets its own steps.
+func createMutationSteps(ctx *PlanningContext, selectionSet ast.SelectionSet) ([]*QueryPlanStep, error) {
+	var result []*QueryPlanStep
+	var chunk ast.SelectionSet
+	var chunkLocation string
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		steps, err := createSteps(ctx, nil, mutationObjectName, "", chunk, false)
+		if err != nil {
+			return err
+		}
+		result = append(result, steps...)
+		chunk = nil
+		return nil
+	}
+
+	for _, f := range selectionSetToFields(selectionSet) {
+		// namespaces and gateway fields don't have a single location
+		location, err := ctx.Locations.URLFor(mutationObjectName, "", f.Name)
+		if err != nil {
+			location = ""
+		}
+		if location == "" || location != chunkLocation {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		chunk = append(chunk, f)
+		chunkLocation = location
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func createSteps(ctx *PlanningContext, insertionPoint []string, parentType, parentLocation string, selectionSet ast.SelectionSet, childstep bool) ([]*QueryPlanStep, error) {
 	var result []*QueryPlanStep
 
@@ -83,7 +209,7 @@ func createSteps(ctx *PlanningContext, insertionPoint []string, parentType, pare
 	}
 
 	for location, selectionSet := range routedSelectionSet {
-		selectionSetForLocation, childrenSteps, err := extractSelectionSet(ctx, insertionPoint, parentType, selectionSet, location, childstep)
+		selectionSetForLocation, childrenSteps, injectedFields, err := extractSelectionSet(ctx, insertionPoint, parentType, selectionSet, location, childstep)
 
 		if err != nil {
 			return nil, err
@@ -91,6 +217,8 @@ func createSteps(ctx *PlanningContext, insertionPoint []string, parentType, pare
 		name := "unknown"
 		if service, ok := ctx.Services[location]; ok {
 			name = service.Name
+		} else if location == internalServiceName {
+			name = internalServiceName
 		}
 
 		// the insertionPoint slice can be modified later as we're appending
@@ -109,14 +237,21 @@ func createSteps(ctx *PlanningContext, insertionPoint []string, parentType, pare
 			ServiceName:    name,
 			ParentType:     parentType,
 			SelectionSet:   selectionSetForLocation,
+			InjectedFields: injectedFields,
 		})
 	}
 	return result, nil
 }
 
-func extractSelectionSet(ctx *PlanningContext, insertionPoint []string, parentType string, input ast.SelectionSet, location string, childstep bool) (ast.SelectionSet, []*QueryPlanStep, error) {
+// extractSelectionSet returns the part of the selection set resolved by the
+// location, the steps resolving the rest of the selection set, and the paths of
+// the fields injected in the returned selection set (see
+// QueryPlanStep.InjectedFields)
+func extractSelectionSet(ctx *PlanningContext, insertionPoint []string, parentType string, input ast.SelectionSet, location string, childstep bool) (ast.SelectionSet, []*QueryPlanStep, []string, error) {
 	var selectionSetResult []ast.Selection
 	var childrenStepsResult []*QueryPlanStep
+	var injectedFieldsResult []string
+	var dependentFields []*ast.Field
 	for _, selection := range input {
 		switch selection := selection.(type) {
 		case *ast.Field:
@@ -125,15 +260,36 @@ func extractSelectionSet(ctx *PlanningContext, insertionPoint []string, parentTy
 				continue
 			}
 			loc, err := ctx.Locations.URLFor(parentType, location, selection.Name)
+			if err == nil && loc != location && len(ctx.Requires.Fields(parentType, selection.Name)) > 0 {
+				dependentFields = append(dependentFields, selection)
+				continue
+			}
 			if err != nil {
 				// namespace
-				subSS, steps, err := extractSelectionSet(ctx, append(insertionPoint, selection.Name), selection.Definition.Type.Name(), selection.SelectionSet, location, childstep)
+				subSS, steps, injected, err := extractSelectionSet(ctx, append(insertionPoint, selection.Name), selection.Definition.Type.Name(), selection.SelectionSet, location, childstep)
 				if err != nil {
-					return nil, nil, err
+					return nil, nil, nil, err
 				}
 				selection.SelectionSet = subSS
 				selectionSetResult = append(selectionSetResult, selection)
 				childrenStepsResult = append(childrenStepsResult, steps...)
+				injectedFieldsResult = append(injectedFieldsResult, prefixInjectedFields(selection.Alias, injected)...)
+				continue
+			}
+			if join, ok := ctx.Joins.Join(parentType, selection.Name); ok && loc == location {
+				step, err := createJoinStep(ctx, insertionPoint, selection, join)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				if !selectionSetHasFieldAliased(selectionSetResult, step.Join.KeyAlias) {
+					selectionSetResult = append(selectionSetResult, &ast.Field{
+						Alias:      step.Join.KeyAlias,
+						Name:       join.Key,
+						Definition: ctx.Schema.Types[parentType].Fields.ForName(join.Key),
+					})
+					injectedFieldsResult = append(injectedFieldsResult, step.Join.KeyAlias)
+				}
+				childrenStepsResult = append(childrenStepsResult, step)
 				continue
 			}
 			if loc == location {
@@ -141,7 +297,7 @@ func extractSelectionSet(ctx *PlanningContext, insertionPoint []string, parentTy
 					selectionSetResult = append(selectionSetResult, selection)
 				} else {
 					newField := *selection
-					selectionSet, childrenSteps, err := extractSelectionSet(
+					selectionSet, childrenSteps, injected, err := extractSelectionSet(
 						ctx,
 						append(insertionPoint, selection.Alias),
 						selection.Definition.Type.Name(),
@@ -150,11 +306,13 @@ func extractSelectionSet(ctx *PlanningContext, insertionPoint []string, parentTy
 						childstep,
 					)
 					if err != nil {
-						return nil, nil, err
+						return nil, nil, nil, err
 					}
+					selectionSet, injected = injectTypename(ctx, append(insertionPoint, selection.Alias), selection.Definition.Type.Name(), selectionSet, childrenSteps, injected)
 					newField.SelectionSet = selectionSet
 					selectionSetResult = append(selectionSetResult, &newField)
 					childrenStepsResult = append(childrenStepsResult, childrenSteps...)
+					injectedFieldsResult = append(injectedFieldsResult, prefixInjectedFields(selection.Alias, injected)...)
 				}
 			} else {
 				mergedWithExistingStep := false
@@ -170,13 +328,16 @@ func extractSelectionSet(ctx *PlanningContext, insertionPoint []string, parentTy
 					newSelectionSet := []ast.Selection{selection}
 					childrenSteps, err := createSteps(ctx, insertionPoint, parentType, location, newSelectionSet, true)
 					if err != nil {
-						return nil, nil, err
+						return nil, nil, nil, err
 					}
 					childrenStepsResult = append(childrenStepsResult, childrenSteps...)
 				}
 			}
 		case *ast.InlineFragment:
-			selectionSet, childrenSteps, err := extractSelectionSet(
+			if !serviceReturnsType(ctx, location, parentType, selection.TypeCondition) {
+				continue
+			}
+			selectionSet, childrenSteps, injected, err := extractSelectionSet(
 				ctx,
 				insertionPoint,
 				selection.TypeCondition,
@@ -185,14 +346,18 @@ func extractSelectionSet(ctx *PlanningContext, insertionPoint []string, parentTy
 				childstep,
 			)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 			inlineFragment := *selection
 			inlineFragment.SelectionSet = selectionSet
 			selectionSetResult = append(selectionSetResult, &inlineFragment)
 			childrenStepsResult = append(childrenStepsResult, childrenSteps...)
+			injectedFieldsResult = mergeNames(injectedFieldsResult, injected)
 		case *ast.FragmentSpread:
-			selectionSet, childrenSteps, err := extractSelectionSet(
+			if !serviceReturnsType(ctx, location, parentType, selection.Definition.TypeCondition) {
+				continue
+			}
+			selectionSet, childrenSteps, injected, err := extractSelectionSet(
 				ctx,
 				insertionPoint,
 				selection.Definition.TypeCondition,
@@ -201,7 +366,7 @@ func extractSelectionSet(ctx *PlanningContext, insertionPoint []string, parentTy
 				childstep,
 			)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 			inlineFragment := ast.InlineFragment{
 				TypeCondition: selection.Definition.TypeCondition,
@@ -209,28 +374,178 @@ func extractSelectionSet(ctx *PlanningContext, insertionPoint []string, parentTy
 			}
 			selectionSetResult = append(selectionSetResult, &inlineFragment)
 			childrenStepsResult = append(childrenStepsResult, childrenSteps...)
+			injectedFieldsResult = mergeNames(injectedFieldsResult, injected)
 		default:
-			return nil, nil, fmt.Errorf("unexpected %T in SelectionSet", selection)
+			return nil, nil, nil, fmt.Errorf("unexpected %T in SelectionSet", selection)
+		}
+	}
+
+	if len(dependentFields) > 0 {
+		var err error
+		selectionSetResult, childrenStepsResult, injectedFieldsResult, err = createDependentSteps(ctx, insertionPoint, parentType, location, dependentFields, selectionSetResult, childrenStepsResult, injectedFieldsResult)
+		if err != nil {
+			return nil, nil, nil, err
 		}
 	}
 
 	// We need to add the id field only if it's a boundary type and the result
 	// is going to be merged with another step (we have children steps or it's a
-	// child step).
+	// child step). The id is looked up under the "_id" or "id" key, so an
+	// aliased id selected by the client isn't enough.
 	if parentType != queryObjectName && parentType != mutationObjectName &&
 		ctx.IsBoundary[parentType] &&
 		ctx.Schema.Types[parentType].Fields.ForName("id") != nil &&
 		(childstep || len(childrenStepsResult) > 0) {
-		if !selectionSetHasFieldNamed(selectionSetResult, "id") {
+		if !selectionSetHasField(selectionSetResult, "id", "id") && !selectionSetHasField(selectionSetResult, injectedIDAlias, "id") {
 			id := &ast.Field{
-				Alias:      "_id",
+				Alias:      injectedIDAlias,
 				Name:       "id",
 				Definition: ctx.Schema.Types[parentType].Fields.ForName("id"),
 			}
 			selectionSetResult = append([]ast.Selection{id}, selectionSetResult...)
+			injectedFieldsResult = append([]string{injectedIDAlias}, injectedFieldsResult...)
+		}
+	}
+	return selectionSetResult, childrenStepsResult, injectedFieldsResult, nil
+}
+
+// serviceReturnsType returns whether the service at location can return
+// objects of the fragment type condition for a field of the parent type. The
+// fragments on the types of other services are left out of the service
+// selection set, their fields are resolved by the children steps.
+func serviceReturnsType(ctx *PlanningContext, location, parentType, typeCondition string) bool {
+	if typeCondition == "" || typeCondition == parentType {
+		return true
+	}
+	service, ok := ctx.Services[location]
+	if !ok || service.Schema == nil {
+		return true
+	}
+	condition := service.Schema.Types[typeCondition]
+	parent := service.Schema.Types[parentType]
+	if condition == nil {
+		return false
+	}
+	if parent == nil {
+		return true
+	}
+	for _, a := range service.Schema.GetPossibleTypes(parent) {
+		for _, b := range service.Schema.GetPossibleTypes(condition) {
+			if a.Name == b.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// injectTypename adds the __typename field, aliased injectedTypenameAlias, to
+// the selection set of the field at path when the type of its objects is
+// needed (see typenameNeeded). It's injected once, outside of the fragments,
+// so all the objects have it. The type is looked up under the "_typename" or
+// "__typename" key, so an unaliased __typename selected by the client is
+// enough.
+func injectTypename(ctx *PlanningContext, path []string, fieldType string, selectionSet ast.SelectionSet, steps []*QueryPlanStep, injected []string) (ast.SelectionSet, []string) {
+	if selectionSetHasField(selectionSet, injectedTypenameAlias, "__typename") ||
+		selectionSetHasField(selectionSet, "__typename", "__typename") ||
+		!typenameNeeded(ctx, path, fieldType, selectionSet, steps) {
+		return selectionSet, injected
+	}
+	selectionSet = append(ast.SelectionSet{newTypenameField()}, selectionSet...)
+	injected = append([]string{injectedTypenameAlias}, injected...)
+	return selectionSet, injected
+}
+
+// typenameNeeded returns whether the __typename of the objects of the field
+// must be queried:
+//   - the selection set is empty, all its fragments are on types the service
+//     doesn't return, and a selection set can't be empty
+//   - the field is abstract and has children steps for the same objects (e.g.
+//     for the fragments on some of its types), the steps are executed for the
+//     objects of their type only
+//
+// Otherwise the service applies the fragments itself and its response is used
+// as is.
+func typenameNeeded(ctx *PlanningContext, path []string, fieldType string, selectionSet ast.SelectionSet, steps []*QueryPlanStep) bool {
+	if len(selectionSet) == 0 {
+		return true
+	}
+	def := ctx.Schema.Types[fieldType]
+	if def == nil || !def.IsAbstractType() {
+		return false
+	}
+	for _, step := range steps {
+		if step.Join == nil && stringArraysEqual(step.InsertionPoint, path) {
+			return true
 		}
 	}
-	return selectionSetResult, childrenStepsResult, nil
+	return false
+}
+
+func newTypenameField() *ast.Field {
+	return &ast.Field{
+		Alias: injectedTypenameAlias,
+		Name:  "__typename",
+		Definition: &ast.FieldDefinition{
+			Name: "__typename",
+			Type: ast.NonNullNamedType("String", nil),
+		},
+	}
+}
+
+// prefixInjectedFields returns the paths of the injected fields of a sub
+// selection set, relative to the parent selection set
+func prefixInjectedFields(alias string, injected []string) []string {
+	res := make([]string, 0, len(injected))
+	for _, path := range injected {
+		res = append(res, alias+"."+path)
+	}
+	return res
+}
+
+// createJoinStep creates the step fetching the objects of a join field. The
+// step is inserted in the parent objects, under the field alias.
+func createJoinStep(ctx *PlanningContext, insertionPoint []string, selection *ast.Field, join Join) (*QueryPlanStep, error) {
+	location, err := ctx.Locations.URLFor(queryObjectName, "", join.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	insertionPointCopy := make([]string, len(insertionPoint))
+	copy(insertionPointCopy, insertionPoint)
+
+	selectionSet, childrenSteps, injectedFields, err := extractSelectionSet(
+		ctx,
+		append(insertionPointCopy, selection.Alias),
+		selection.Definition.Type.Name(),
+		selection.SelectionSet,
+		location,
+		false,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	name := "unknown"
+	if service, ok := ctx.Services[location]; ok {
+		name = service.Name
+	}
+
+	return &QueryPlanStep{
+		InsertionPoint: insertionPointCopy,
+		Then:           childrenSteps,
+		ServiceURL:     location,
+		ServiceName:    name,
+		ParentType:     selection.Definition.Type.Name(),
+		SelectionSet:   selectionSet,
+		InjectedFields: injectedFields,
+		Join: &JoinStep{
+			Query:      join.Query,
+			Argument:   join.argument(),
+			KeyAlias:   joinKeyAlias(join),
+			FieldAlias: selection.Alias,
+		},
+	}, nil
 }
 
 func routeSelectionSet(ctx *PlanningContext, parentType, parentLocation string, input ast.SelectionSet) (map[string]ast.SelectionSet, error) {
@@ -313,10 +628,22 @@ func filterSelectionSetByLoc(ctx *PlanningContext, ss ast.SelectionSet, loc, par
 	return res
 }
 
-func selectionSetHasFieldNamed(selectionSet []ast.Selection, fieldName string) bool {
+// selectionSetHasField returns whether the field is selected with the given
+// alias
+func selectionSetHasField(selectionSet []ast.Selection, alias, fieldName string) bool {
+	for _, selection := range selectionSet {
+		field, ok := selection.(*ast.Field)
+		if ok && field.Name == fieldName && field.Alias == alias {
+			return true
+		}
+	}
+	return false
+}
+
+func selectionSetHasFieldAliased(selectionSet []ast.Selection, alias string) bool {
 	for _, selection := range selectionSet {
 		field, ok := selection.(*ast.Field)
-		if ok && field.Name == fieldName {
+		if ok && field.Alias == alias {
 			return true
 		}
 	}
@@ -326,6 +653,10 @@ func selectionSetHasFieldNamed(selectionSet []ast.Selection, fieldName string) b
 // FieldURLMap maps fields to service URLs
 type FieldURLMap map[string]string
 
+// sharedFieldLocation is the location of the fields of the shared value
+// types, they are resolved by the service of the parent field
+const sharedFieldLocation = ""
+
 // URLFor returns the URL for the given field
 func (m FieldURLMap) URLFor(parent, parentLocation, field string) (string, error) {
 	if field == "__typename" {
@@ -336,6 +667,9 @@ func (m FieldURLMap) URLFor(parent, parentLocation, field string) (string, error
 	if !exists {
 		return "", fmt.Errorf("could not find location for %q", key)
 	}
+	if value == sharedFieldLocation {
+		return parentLocation, nil
+	}
 	return value, nil
 }
 
@@ -366,20 +700,72 @@ func stringArraysEqual(a, b []string) bool {
 // BoundaryQuery contains the name and format for a boundary query
 type BoundaryQuery struct {
 	Query string
+	// Name of the ID argument, defaults to "id" (or "ids" in the array
+	// format)
+	Argument string
+	// Name of the scalar type of the ID argument, defaults to "ID"
+	ArgumentType string
 	// Whether the query is in the array format
 	Array bool
+	// CacheTTL is the duration the results can be kept in the boundary
+	// cache, declared with @boundary(cacheTTL: "..."). They aren't cached if
+	// 0.
+	CacheTTL time.Duration
+}
+
+// formatID formats an ID as a value of the ID argument of the boundary query
+func (q BoundaryQuery) formatID(id string) string {
+	if q.ArgumentType == "Int" {
+		if _, err := strconv.ParseInt(id, 10, 64); err == nil {
+			return id
+		}
+	}
+	return strconv.Quote(id)
+}
+
+// formatTargetID formats the id of the target as a value of the ID argument
+// of the boundary query. The numeric ids of the custom scalars aren't quoted,
+// as the service serialized them as numbers.
+func (q BoundaryQuery) formatTargetID(target insertionTarget) string {
+	if target.numericID && q.ArgumentType != "" && !boundaryKeyScalars[q.ArgumentType] {
+		return target.ID
+	}
+	return q.formatID(target.ID)
+}
+
+// ArgumentName returns the name of the ID argument of the boundary query
+func (q BoundaryQuery) ArgumentName() string {
+	if q.Argument != "" {
+		return q.Argument
+	}
+	if q.Array {
+		return "ids"
+	}
+	return idFieldName
 }
 
 // BoundaryQueriesMap is a mapping service -> type -> boundary query
 type BoundaryQueriesMap map[string]map[string]BoundaryQuery
 
-// RegisterQuery registers a boundary query
+// RegisterQuery registers a boundary query using the default argument name
 func (m BoundaryQueriesMap) RegisterQuery(serviceURL, typeName, query string, array bool) {
+	m.RegisterQueryWithArgument(serviceURL, typeName, query, "", array)
+}
+
+// RegisterQueryWithArgument registers a boundary query taking the IDs in the
+// given argument
+func (m BoundaryQueriesMap) RegisterQueryWithArgument(serviceURL, typeName, query, argument string, array bool) {
+	m.RegisterBoundaryQuery(serviceURL, typeName, BoundaryQuery{Query: query, Argument: argument, Array: array})
+}
+
+// RegisterBoundaryQuery registers a boundary query for the given service and
+// type
+func (m BoundaryQueriesMap) RegisterBoundaryQuery(serviceURL, typeName string, query BoundaryQuery) {
 	if _, ok := m[serviceURL]; !ok {
 		m[serviceURL] = make(map[string]BoundaryQuery)
 	}
 
-	m[serviceURL][typeName] = BoundaryQuery{Query: query, Array: array}
+	m[serviceURL][typeName] = query
 }
 
 // Query returns the boundary query for the given service and type
@@ -0,0 +1,150 @@
+package bramble
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// planCacheSize is the number of query plans kept in the plan cache
+const planCacheSize = 1000
+
+// newPlanCache returns an empty query plan cache. The cache must be replaced
+// every time the merged schema changes.
+func newPlanCache() graphql.Cache {
+	return lru.New(planCacheSize)
+}
+
+// planCacheKey returns the key of the operation in the plan cache. The key is
+// built from the fingerprint of the operation, the literal arguments and the
+// positions of the fields left once the @skip/@include directives are
+// evaluated and the fields are filtered (the fingerprint doesn't include them
+// but the plans do), and the shape of the variables, the variable values are
+// not part of the key.
+func planCacheKey(fingerprint string, op *ast.OperationDefinition, variables map[string]interface{}) string {
+	h := sha256.New()
+	io.WriteString(h, fingerprint)
+	writeSelectionSetLiterals(h, op.SelectionSet)
+
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "$%s:%T", name, variables[name])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeSelectionSetLiterals writes the positions, arguments and directives of
+// the fields of the selection set to w, in document order, fragment spreads
+// included. The positions are written as they're used in the error
+// locations.
+func writeSelectionSetLiterals(w io.Writer, selectionSet ast.SelectionSet) {
+	fmt.Fprint(w, "{")
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			fmt.Fprint(w, " ")
+			if selection.Position != nil {
+				fmt.Fprintf(w, "@%d:%d", selection.Position.Line, selection.Position.Column)
+			}
+			for _, arg := range selection.Arguments {
+				fmt.Fprintf(w, " %s=%s", arg.Name, arg.Value.String())
+			}
+			for _, d := range selection.Directives {
+				fmt.Fprintf(w, " @%s", d.Name)
+				for _, arg := range d.Arguments {
+					fmt.Fprintf(w, " %s=%s", arg.Name, arg.Value.String())
+				}
+			}
+			if len(selection.SelectionSet) > 0 {
+				writeSelectionSetLiterals(w, selection.SelectionSet)
+			}
+		case *ast.InlineFragment:
+			fmt.Fprint(w, " ...")
+			writeSelectionSetLiterals(w, selection.SelectionSet)
+		case *ast.FragmentSpread:
+			fmt.Fprint(w, " ...")
+			writeSelectionSetLiterals(w, selection.Definition.SelectionSet)
+		}
+	}
+	fmt.Fprint(w, " }")
+}
+
+// preformatDocuments formats the selection sets of the steps that don't
+// reference any variable, so they don't need to be formatted again when the
+// plan is reused. It must be called before the plan is added to the cache.
+func preformatDocuments(ctx context.Context, schema *ast.Schema, steps []*QueryPlanStep) {
+	for _, step := range steps {
+		if !selectionSetHasVariables(step.SelectionSet) {
+			step.document = formatSelectionSet(ctx, schema, step.SelectionSet)
+		}
+		preformatDocuments(ctx, schema, step.Then)
+	}
+}
+
+func selectionSetHasVariables(selectionSet ast.SelectionSet) bool {
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			for _, arg := range selection.Arguments {
+				if valueHasVariables(arg.Value) {
+					return true
+				}
+			}
+			for _, d := range selection.Directives {
+				for _, arg := range d.Arguments {
+					if valueHasVariables(arg.Value) {
+						return true
+					}
+				}
+			}
+			if selectionSetHasVariables(selection.SelectionSet) {
+				return true
+			}
+		case *ast.InlineFragment:
+			if selectionSetHasVariables(selection.SelectionSet) {
+				return true
+			}
+		case *ast.FragmentSpread:
+			if selectionSetHasVariables(selection.Definition.SelectionSet) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func valueHasVariables(v *ast.Value) bool {
+	if v == nil {
+		return false
+	}
+	if v.Kind == ast.Variable {
+		return true
+	}
+	for _, child := range v.Children {
+		if valueHasVariables(child.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatStepSelectionSet returns the formatted selection set of the step,
+// pre-formatted if the plan comes from the cache
+func (e *QueryExecution) formatStepSelectionSet(ctx context.Context, step *QueryPlanStep) string {
+	if step.document != "" {
+		return step.document
+	}
+	return formatSelectionSet(ctx, e.Schema, step.SelectionSet)
+}
@@ -0,0 +1,120 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestPlanCacheKey(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		type Movie {
+			id: ID!
+			title: String
+		}
+
+		type Query {
+			movie(id: ID!): Movie
+		}
+	`})
+	key := func(query string, variables map[string]interface{}) string {
+		op := gqlparser.MustLoadQuery(schema, query).Operations[0]
+		return planCacheKey(OperationFingerprint(op), op, variables)
+	}
+
+	withVariable := `query q($id: ID!) { movie(id: $id) { title } }`
+	assert.Equal(t, key(withVariable, map[string]interface{}{"id": "1"}), key(withVariable, map[string]interface{}{"id": "2"}))
+	assert.NotEqual(t, key(withVariable, map[string]interface{}{"id": "1"}), key(withVariable, map[string]interface{}{"id": 1}))
+	assert.NotEqual(t, key(`{ movie(id: "1") { title } }`, nil), key(`{ movie(id: "2") { title } }`, nil))
+	assert.NotEqual(t, key(`{ movie(id: "1") { title } }`, nil), key(`{ movie(id: "1") { id } }`, nil))
+	assert.NotEqual(t,
+		key(`{ movie(id: "1") { ...f } } fragment f on Movie { title }`, nil),
+		key(`{ movie(id: "1") { ...f } } fragment f on Movie { id }`, nil),
+	)
+	// same fingerprint, the fields are in a different order
+	assert.NotEqual(t, key(`{ movie(id: "1") { id title } }`, nil), key(`{ movie(id: "1") { title id } }`, nil))
+}
+
+func TestExecutableSchemaPlanCache(t *testing.T) {
+	queries := make(chan string, 10)
+	server := newTestService(t, "movies", `
+		type Service {
+			name: String!
+			version: String!
+			schema: String!
+		}
+		type Movie {
+			id: ID!
+			title: String
+		}
+		type Query {
+			service: Service!
+			movie(id: ID!): Movie
+		}`, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query string
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		queries <- req.Query
+		w.Write([]byte(`{ "data": { "movie": { "title": "Test title" } } }`))
+	})
+
+	es := newExecutableSchema(nil, 50, nil, NewService(server.URL))
+	require.NoError(t, es.UpdateSchema(true))
+
+	execute := func(query string, variables map[string]interface{}) {
+		t.Helper()
+		op := gqlparser.MustLoadQuery(es.MergedSchema, query).Operations[0]
+		resp := es.ExecuteQuery(testContextWithVariables(variables, op))
+		require.Empty(t, resp.Errors)
+		assert.JSONEq(t, `{ "movie": { "title": "Test title" } }`, string(resp.Data))
+	}
+	cached := func(query string, variables map[string]interface{}) *QueryPlan {
+		t.Helper()
+		op := gqlparser.MustLoadQuery(es.MergedSchema, query).Operations[0]
+		plan, ok := es.planCache.Get(context.Background(), planCacheKey(OperationFingerprint(op), op, variables))
+		if !ok {
+			return nil
+		}
+		return plan.(*QueryPlan)
+	}
+
+	t.Run("variables are not cached", func(t *testing.T) {
+		query := `query q($id: ID!) { movie(id: $id) { title } }`
+		execute(query, map[string]interface{}{"id": "1"})
+		assert.Contains(t, <-queries, `movie(id: "1")`)
+		plan := cached(query, map[string]interface{}{"id": "1"})
+		require.NotNil(t, plan)
+		assert.Empty(t, plan.RootSteps[0].document)
+
+		execute(query, map[string]interface{}{"id": "2"})
+		assert.Contains(t, <-queries, `movie(id: "2")`)
+		assert.Same(t, plan, cached(query, map[string]interface{}{"id": "2"}))
+	})
+
+	t.Run("documents are pre-formatted", func(t *testing.T) {
+		query := `{ movie(id: "1") { title } }`
+		execute(query, nil)
+		<-queries
+		plan := cached(query, nil)
+		require.NotNil(t, plan)
+		assert.Contains(t, plan.RootSteps[0].document, `movie(id: "1")`)
+
+		execute(query, nil)
+		assert.Contains(t, <-queries, `movie(id: "1")`)
+	})
+
+	t.Run("cache is invalidated on schema update", func(t *testing.T) {
+		query := `{ movie(id: "1") { title } }`
+		require.NotNil(t, cached(query, nil))
+		es.Services[server.URL].Version = ""
+		require.NoError(t, es.UpdateSchema(true))
+		assert.Nil(t, cached(query, nil))
+	})
+}
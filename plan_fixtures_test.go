@@ -16,6 +16,10 @@ type PlanTestFixture struct {
 	Schema     string
 	Locations  map[string]string
 	IsBoundary map[string]bool
+	Joins      JoinsMap
+	Requires   RequiresMap
+	// ServiceSchemas are the schemas of the services, by URL
+	ServiceSchemas map[string]string
 }
 
 var PlanTestFixture1 = &PlanTestFixture{
@@ -101,7 +105,6 @@ var PlanTestFixture2 = &PlanTestFixture{
 	},
 }
 
-// nolint
 var PlanTestFixture3 = &PlanTestFixture{
 	Schema: `
 	directive @boundary on OBJECT
@@ -136,11 +139,13 @@ var PlanTestFixture3 = &PlanTestFixture{
 
 	Locations: map[string]string{
 		"Query.animals":  "A",
+		"Animal.weight":  sharedFieldLocation,
+		"Animal.name":    sharedFieldLocation,
 		"Lion.weight":    "A",
 		"Lion.name":      "A",
 		"Lion.maneColor": "A",
-		"Snake.weight":   "B",
-		"Snake.name":     "B",
+		"Snake.weight":   "A",
+		"Snake.name":     "A",
 		"Snake.venomous": "B",
 	},
 
@@ -221,18 +226,34 @@ var PlanTestFixture5 = &PlanTestFixture{
 }
 
 func (f *PlanTestFixture) Check(t *testing.T, query, expectedJSON string) {
+	t.Helper()
+	actual := f.plan(t, query)
+	actual.SortSteps()
+	assert.JSONEq(t, expectedJSON, jsonMustMarshal(actual))
+}
+
+// CheckInOrder checks the plan without sorting its steps first
+func (f *PlanTestFixture) CheckInOrder(t *testing.T, query, expectedJSON string) {
+	t.Helper()
+	assert.JSONEq(t, expectedJSON, jsonMustMarshal(f.plan(t, query)))
+}
+
+func (f *PlanTestFixture) plan(t *testing.T, query string) *QueryPlan {
 	t.Helper()
 	schema := gqlparser.MustLoadSchema(&ast.Source{Name: "fixture", Input: f.Schema})
 	operation := gqlparser.MustLoadQuery(schema, query)
 	require.Len(t, operation.Operations, 1, "bad test: query must be a single operation")
-	actual, err := Plan(&PlanningContext{operation.Operations[0], schema, f.Locations, f.IsBoundary, map[string]*Service{
+	services := map[string]*Service{
 		"A": {Name: "A", ServiceURL: "A"},
 		"B": {Name: "B", ServiceURL: "B"},
 		"C": {Name: "C", ServiceURL: "C"},
-	}})
+	}
+	for url, serviceSchema := range f.ServiceSchemas {
+		services[url].Schema = gqlparser.MustLoadSchema(&ast.Source{Name: url, Input: serviceSchema})
+	}
+	actual, err := Plan(&PlanningContext{escapeOperationAliases(operation.Operations[0]), schema, f.Locations, f.IsBoundary, services, f.Joins, f.Requires})
 	require.NoError(t, err)
-	actual.SortSteps()
-	assert.JSONEq(t, expectedJSON, jsonMustMarshal(actual))
+	return actual
 }
 
 type ByServiceURL []*QueryPlanStep
@@ -2,6 +2,10 @@ package bramble
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
 )
 
 func TestQueryPlanA(t *testing.T) {
@@ -35,6 +39,7 @@ func TestQueryPlanAB1(t *testing.T) {
 				"ParentType": "Movie",
 				"SelectionSet": "{ _id: id compTitles(limit: 42) { id } }",
 				"InsertionPoint": ["movies"],
+				"InjectedFields": ["_id"],
 				"Then": null
 			  }
 			]
@@ -59,6 +64,7 @@ func TestQueryPlanAB2(t *testing.T) {
 				"ParentType": "Movie",
 				"SelectionSet": "{ _id: id compTitles(limit: 42) { id compTitles(limit: 666) { id } } }",
 				"InsertionPoint": ["movies"],
+				"InjectedFields": ["_id"],
 				"Then": null
 			  }
 			]
@@ -83,12 +89,14 @@ func TestQueryPlanABA1(t *testing.T) {
 				"ParentType": "Movie",
 				"SelectionSet": "{ _id: id compTitles(limit: 42) { id } }",
 				"InsertionPoint": ["movies"],
+				"InjectedFields": ["_id"],
 				"Then": [
 				  {
 					"ServiceURL": "A",
 					"ParentType": "Movie",
 					"SelectionSet": "{ _id: id title }",
 					"InsertionPoint": ["movies", "compTitles"],
+					"InjectedFields": ["_id"],
 					"Then": null
 				  }
 				]
@@ -115,12 +123,14 @@ func TestQueryPlanABA2(t *testing.T) {
 				"ParentType": "Movie",
 				"SelectionSet": "{ _id: id compTitles(limit: 42) { id compTitles(limit: 666) { id } } }",
 				"InsertionPoint": ["movies"],
+				"InjectedFields": ["_id"],
 				"Then": [
 				  {
 					"ServiceURL": "A",
 					"ParentType": "Movie",
 					"SelectionSet": "{ _id: id title }",
 					"InsertionPoint": ["movies", "compTitles"],
+					"InjectedFields": ["_id"],
 					"Then": null
 				  },
 				  {
@@ -128,6 +138,7 @@ func TestQueryPlanABA2(t *testing.T) {
 					"ParentType": "Movie",
 					"SelectionSet": "{ _id: id title }",
 					"InsertionPoint": ["movies", "compTitles", "compTitles"],
+					"InjectedFields": ["_id"],
 					"Then": null
 				  }
 				]
@@ -169,14 +180,16 @@ func TestQueryPlanWithAliases(t *testing.T) {
 		  {
 			"ServiceURL": "A",
 			"ParentType": "Query",
-			"SelectionSet": "{ a1: movies { a2: id a3: title } }",
+			"SelectionSet": "{ a1: movies { _id: id a2: id a3: title } }",
 			"InsertionPoint": null,
+			"InjectedFields": ["a1._id"],
 			"Then": [
 			  {
 				"ServiceURL": "B",
 				"ParentType": "Movie",
-				"SelectionSet": "{ _id: id a4: compTitles(limit: 42) { a5: id } }",
+				"SelectionSet": "{ _id: id a4: compTitles(limit: 42) { _id: id a5: id } }",
 				"InsertionPoint": ["a1"],
+				"InjectedFields": ["_id", "a4._id"],
 				"Then": null
 			  }
 			]
@@ -290,12 +303,14 @@ func TestQueryPlanInlineFragmentPlan(t *testing.T) {
 				"ParentType": "Query",
 				"SelectionSet": "{ movies { _id: id ... on Movie { id title(language: French) } } }",
 				"InsertionPoint": null,
+				"InjectedFields": ["movies._id"],
 				"Then": [
 					{
 						"ServiceURL": "B",
 						"ParentType": "Movie",
 						"SelectionSet": "{ _id: id compTitles(limit: 42) { id } }",
 						"InsertionPoint": ["movies"],
+						"InjectedFields": ["_id"],
 						"Then": null
 					}
 				]
@@ -356,7 +371,6 @@ func TestQueryPlanFragmentSpread2(t *testing.T) {
 }
 
 func TestQueryPlanInlineFragmentSpreadOfInterface(t *testing.T) {
-	t.Skip("not supported at this time")
 	query := `
 	{
 		animals {
@@ -374,21 +388,16 @@ func TestQueryPlanInlineFragmentSpreadOfInterface(t *testing.T) {
 			{
 				"ServiceURL": "A",
 				"ParentType": "Query",
-				"SelectionSet": "{ animals { id name __typename }",
+				"SelectionSet": "{ animals { _typename: __typename name ... on Lion { maneColor } ... on Snake { _id: id } } }",
 				"InsertionPoint": null,
+				"InjectedFields": ["animals._typename", "animals._id"],
 				"Then": [
-					{
-						"ServiceURL": "A",
-						"ParentType": "Lion",
-						"SelectionSet": "{ _id: id maneColor }",
-						"InsertionPoint": ["animals"],
-						"Then": null
-					},
 					{
 						"ServiceURL": "B",
 						"ParentType": "Snake",
 						"SelectionSet": "{ _id: id venomous }",
 						"InsertionPoint": ["animals"],
+						"InjectedFields": ["_id"],
 						"Then": null
 					}
 				]
@@ -398,6 +407,213 @@ func TestQueryPlanInlineFragmentSpreadOfInterface(t *testing.T) {
 	PlanTestFixture3.Check(t, query, plan)
 }
 
+func TestQueryPlanFragmentOnTypeOfAnotherService(t *testing.T) {
+	fixture := &PlanTestFixture{
+		Schema: `
+			interface Named { name: String! }
+			type Gizmo implements Named { name: String! }
+			type Gimmick implements Named { name: String! size: Float! }
+			type Query { named: [Named!]! }
+		`,
+		Locations: map[string]string{
+			"Query.named":  "A",
+			"Named.name":   sharedFieldLocation,
+			"Gizmo.name":   "A",
+			"Gimmick.name": "B",
+			"Gimmick.size": "B",
+		},
+		IsBoundary: map[string]bool{},
+		ServiceSchemas: map[string]string{
+			"A": `
+				interface Named { name: String! }
+				type Gizmo implements Named { name: String! }
+				type Query { named: [Named!]! }
+			`,
+		},
+	}
+	query := `{
+		named {
+			... on Gimmick { size }
+		}
+	}`
+	plan := `{
+		"RootSteps": [
+			{
+				"ServiceURL": "A",
+				"ParentType": "Query",
+				"SelectionSet": "{ named { _typename: __typename } }",
+				"InsertionPoint": null,
+				"InjectedFields": ["named._typename"],
+				"Then": null
+			}
+		]
+	}`
+	fixture.Check(t, query, plan)
+}
+
+func TestQueryPlanUnionMembersOfDifferentServices(t *testing.T) {
+	fixture := &PlanTestFixture{
+		Schema: `
+			directive @boundary on OBJECT
+
+			type Movie @boundary { id: ID! title: String! posterUrl: String }
+			type Book @boundary { id: ID! title: String! pages: Int! }
+			type Podcast { title: String! }
+			union Media = Movie | Book | Podcast
+
+			type Query { media: [Media!]! podcasts: [Media!]! }
+		`,
+		Locations: map[string]string{
+			"Query.media":     "A",
+			"Query.podcasts":  "C",
+			"Movie.title":     "A",
+			"Movie.posterUrl": "B",
+			"Book.title":      "A",
+			"Book.pages":      "C",
+			"Podcast.title":   "C",
+		},
+		IsBoundary: map[string]bool{
+			"Movie":   true,
+			"Book":    true,
+			"Podcast": false,
+		},
+		ServiceSchemas: map[string]string{
+			"A": `
+				directive @boundary on OBJECT
+				type Movie @boundary { id: ID! title: String! }
+				type Book @boundary { id: ID! title: String! }
+				union Media = Movie | Book
+				type Query { media: [Media!]! }
+			`,
+		},
+	}
+	query := `{
+		media {
+			... on Movie { title posterUrl }
+			... on Book { title pages }
+			... on Podcast { title }
+		}
+	}`
+	plan := `{
+		"RootSteps": [
+			{
+				"ServiceURL": "A",
+				"ParentType": "Query",
+				"SelectionSet": "{ media { _typename: __typename ... on Movie { _id: id title } ... on Book { _id: id title } } }",
+				"InsertionPoint": null,
+				"InjectedFields": ["media._typename", "media._id"],
+				"Then": [
+					{
+						"ServiceURL": "B",
+						"ParentType": "Movie",
+						"SelectionSet": "{ _id: id posterUrl }",
+						"InsertionPoint": ["media"],
+						"InjectedFields": ["_id"],
+						"Then": null
+					},
+					{
+						"ServiceURL": "C",
+						"ParentType": "Book",
+						"SelectionSet": "{ _id: id pages }",
+						"InsertionPoint": ["media"],
+						"InjectedFields": ["_id"],
+						"Then": null
+					}
+				]
+			}
+		]
+	}`
+	fixture.Check(t, query, plan)
+}
+
+func TestQueryPlanTypenameInjection(t *testing.T) {
+	t.Run("not injected without children steps", func(t *testing.T) {
+		PlanTestFixture3.Check(t, "{ animals { name ... on Lion { maneColor } } }", `{
+			"RootSteps": [
+				{
+					"ServiceURL": "A",
+					"ParentType": "Query",
+					"SelectionSet": "{ animals { name ... on Lion { maneColor } } }",
+					"InsertionPoint": null,
+					"Then": null
+				}
+			]
+		}`)
+	})
+
+	t.Run("selected by the client", func(t *testing.T) {
+		PlanTestFixture3.Check(t, "{ animals { __typename ... on Snake { venomous } } }", `{
+			"RootSteps": [
+				{
+					"ServiceURL": "A",
+					"ParentType": "Query",
+					"SelectionSet": "{ animals { __typename ... on Snake { _id: id } } }",
+					"InsertionPoint": null,
+					"InjectedFields": ["animals._id"],
+					"Then": [
+						{
+							"ServiceURL": "B",
+							"ParentType": "Snake",
+							"SelectionSet": "{ _id: id venomous }",
+							"InsertionPoint": ["animals"],
+							"InjectedFields": ["_id"],
+							"Then": null
+						}
+					]
+				}
+			]
+		}`)
+	})
+
+	t.Run("alias selected by the client", func(t *testing.T) {
+		PlanTestFixture3.Check(t, "{ animals { ... on Snake { _typename: __typename venomous } } }", `{
+			"RootSteps": [
+				{
+					"ServiceURL": "A",
+					"ParentType": "Query",
+					"SelectionSet": "{ animals { _typename: __typename ... on Snake { _id: id _typename_: __typename } } }",
+					"InsertionPoint": null,
+					"InjectedFields": ["animals._typename", "animals._id"],
+					"Then": [
+						{
+							"ServiceURL": "B",
+							"ParentType": "Snake",
+							"SelectionSet": "{ _id: id venomous }",
+							"InsertionPoint": ["animals"],
+							"InjectedFields": ["_id"],
+							"Then": null
+						}
+					]
+				}
+			]
+		}`)
+	})
+
+	t.Run("aliased by the client", func(t *testing.T) {
+		PlanTestFixture3.Check(t, "{ animals { kind: __typename ... on Snake { venomous } } }", `{
+			"RootSteps": [
+				{
+					"ServiceURL": "A",
+					"ParentType": "Query",
+					"SelectionSet": "{ animals { _typename: __typename kind: __typename ... on Snake { _id: id } } }",
+					"InsertionPoint": null,
+					"InjectedFields": ["animals._typename", "animals._id"],
+					"Then": [
+						{
+							"ServiceURL": "B",
+							"ParentType": "Snake",
+							"SelectionSet": "{ _id: id venomous }",
+							"InsertionPoint": ["animals"],
+							"InjectedFields": ["_id"],
+							"Then": null
+						}
+					]
+				}
+			]
+		}`)
+	})
+}
+
 func TestQueryPlanSkipDirective(t *testing.T) {
 	PlanTestFixture1.Check(t, "{ movies { id title @skip(if: false) } }", `
 	  {
@@ -461,6 +677,7 @@ func TestQueryPlanSkipAndIncludeDirectiveInChildStep(t *testing.T) {
 				"ParentType": "Movie",
 				"SelectionSet": "{ _id: id compTitles(limit: 42) { id @skip(if: false) @include(if: true) } }",
 				"InsertionPoint": ["movies"],
+				"InjectedFields": ["_id"],
 				"Then": null
 			  }
 			]
@@ -487,6 +704,7 @@ func TestQueryPlanSupportsAliasing(t *testing.T) {
               "InsertionPoint": [
                 "foo"
               ],
+              "InjectedFields": ["_id"],
               "Then": [
                 {
                   "ServiceURL": "A",
@@ -496,6 +714,7 @@ func TestQueryPlanSupportsAliasing(t *testing.T) {
                     "foo",
                     "bar"
                   ],
+                  "InjectedFields": ["_id"],
                   "Then": null
                 }
               ]
@@ -563,6 +782,7 @@ func TestQueryPlanSupportsMutations(t *testing.T) {
 			"ParentType": "Mutation",
 			"SelectionSet": "{ updateTitle(id: \"2\", title: \"New title\") { _id: id title } }",
 			"InsertionPoint": null,
+			"InjectedFields": ["updateTitle._id"],
 			"Then": [
 			  {
 				"ServiceURL": "B",
@@ -571,6 +791,117 @@ func TestQueryPlanSupportsMutations(t *testing.T) {
 				"InsertionPoint": [
 				  "updateTitle"
 				],
+				"InjectedFields": ["_id"],
+				"Then": null
+			  }
+			]
+		  }
+		]
+	  }
+	`)
+}
+
+func TestQueryPlanMutationStepsFollowFieldOrder(t *testing.T) {
+	f := &PlanTestFixture{
+		Schema: `
+		type Movie {
+			id: ID!
+			title: String
+		}
+
+		type Query {
+			movie(id: ID!): Movie
+		}
+
+		type Mutation {
+			updateTitle(id: ID!, title: String): Movie
+			deleteMovie(id: ID!): Boolean
+			rateMovie(id: ID!, rating: Int): Boolean
+		}
+		`,
+		Locations: map[string]string{
+			"Movie.title":          "A",
+			"Query.movie":          "A",
+			"Mutation.updateTitle": "A",
+			"Mutation.deleteMovie": "A",
+			"Mutation.rateMovie":   "B",
+		},
+		IsBoundary: map[string]bool{},
+	}
+
+	f.CheckInOrder(t, `mutation { updateTitle(id: "1", title: "New title") { title } rateMovie(id: "1", rating: 5) deleteMovie(id: "1") }`, `
+	{
+		"RootSteps": [
+		  {
+			"ServiceURL": "A",
+			"ParentType": "Mutation",
+			"SelectionSet": "{ updateTitle(id: \"1\", title: \"New title\") { title } }",
+			"InsertionPoint": null,
+			"Then": null
+		  },
+		  {
+			"ServiceURL": "B",
+			"ParentType": "Mutation",
+			"SelectionSet": "{ rateMovie(id: \"1\", rating: 5) }",
+			"InsertionPoint": null,
+			"Then": null
+		  },
+		  {
+			"ServiceURL": "A",
+			"ParentType": "Mutation",
+			"SelectionSet": "{ deleteMovie(id: \"1\") }",
+			"InsertionPoint": null,
+			"Then": null
+		  }
+		]
+	  }
+	`)
+}
+
+func TestQueryPlanSubscription(t *testing.T) {
+	f := &PlanTestFixture{
+		Schema: `
+		directive @boundary on OBJECT | FIELD_DEFINITION
+
+		type Movie @boundary {
+			id: ID!
+			title: String
+			rating: Int
+		}
+
+		type Query {
+			movie(id: ID!): Movie
+		}
+
+		type Subscription {
+			movieUpdated(id: ID!): Movie
+		}
+		`,
+		Locations: map[string]string{
+			"Movie.title":               "A",
+			"Movie.rating":              "B",
+			"Query.movie":               "A",
+			"Subscription.movieUpdated": "A",
+		},
+		IsBoundary: map[string]bool{"Movie": true},
+	}
+
+	f.Check(t, `subscription { movieUpdated(id: "1") { title rating } }`, `
+	{
+		"RootSteps": [
+		  {
+			"ServiceURL": "A",
+			"ParentType": "Subscription",
+			"SelectionSet": "{ movieUpdated(id: \"1\") { _id: id title } }",
+			"InjectedFields": ["movieUpdated._id"],
+			"InsertionPoint": null,
+			"Then": [
+			  {
+				"ServiceURL": "B",
+				"ParentType": "Movie",
+				"SelectionSet": "{ _id: id rating }",
+				"InjectedFields": ["_id"],
+				"InsertionPoint": ["movieUpdated"],
 				"Then": null
 			  }
 			]
@@ -595,6 +926,7 @@ func TestQueryPlanWithPaginatedBoundaryType(t *testing.T) {
 				"ParentType": "Foo",
 				"SelectionSet": "{ _id: id size }",
 				"InsertionPoint": [ "foo", "foos", "page" ],
+				"InjectedFields": ["_id"],
 				"Then": null
 			}
 		  ]
@@ -693,6 +1025,7 @@ func TestQueryPlanWithNestedNamespaces(t *testing.T) {
 				  "movie",
 				  "compTitles"
 				],
+				"InjectedFields": ["_id"],
 				"Then": null
 			  }
 			]
@@ -717,3 +1050,199 @@ func TestQueryPlanNoUnnessecaryID(t *testing.T) {
 	  }
 	`)
 }
+
+func TestQueryPlanInjectedIDSelectedByClient(t *testing.T) {
+	PlanTestFixture1.Check(t, "{ movies { _id: id compTitles(limit: 42) { id } } }", `
+	  {
+		"RootSteps": [
+		  {
+			"ServiceURL": "A",
+			"ParentType": "Query",
+			"SelectionSet": "{ movies { _id: id _id_: id } }",
+			"InsertionPoint": null,
+			"InjectedFields": ["movies._id"],
+			"Then": [
+			  {
+				"ServiceURL": "B",
+				"ParentType": "Movie",
+				"SelectionSet": "{ _id: id compTitles(limit: 42) { id } }",
+				"InsertionPoint": ["movies"],
+				"InjectedFields": ["_id"],
+				"Then": null
+			  }
+			]
+		  }
+		]
+	  }
+	`)
+}
+
+func TestQueryPlanRequiresFieldsOfParentService(t *testing.T) {
+	fixture := &PlanTestFixture{
+		Schema: `
+			directive @boundary on OBJECT
+
+			type Product @boundary { id: ID! name: String! weight: Float! shippingEstimate: Float! }
+			type Query { products: [Product!]! }
+		`,
+		Locations: map[string]string{
+			"Query.products":           "A",
+			"Product.name":             "A",
+			"Product.weight":           "A",
+			"Product.shippingEstimate": "B",
+		},
+		IsBoundary: map[string]bool{"Product": true},
+		Requires: RequiresMap{
+			"Product": {"shippingEstimate": {"weight"}},
+		},
+	}
+	query := `{
+		products {
+			name
+			shippingEstimate
+		}
+	}`
+	plan := `{
+		"RootSteps": [
+			{
+				"ServiceURL": "A",
+				"ParentType": "Query",
+				"SelectionSet": "{ products { _id: id name _weight: weight } }",
+				"InsertionPoint": null,
+				"InjectedFields": ["products._id", "products._weight"],
+				"Then": [
+					{
+						"ServiceURL": "B",
+						"ParentType": "Product",
+						"SelectionSet": "{ _id: id shippingEstimate }",
+						"InsertionPoint": ["products"],
+						"InjectedFields": ["_id"],
+						"Requires": ["weight"],
+						"Then": null
+					}
+				]
+			}
+		]
+	}`
+	fixture.Check(t, query, plan)
+}
+
+func TestQueryPlanRequiresFieldsOfSiblingService(t *testing.T) {
+	fixture := &PlanTestFixture{
+		Schema: `
+			directive @boundary on OBJECT
+
+			type Product @boundary { id: ID! name: String! weight: Float! shippingEstimate: Float! }
+			type Query { products: [Product!]! }
+		`,
+		Locations: map[string]string{
+			"Query.products":           "A",
+			"Product.name":             "A",
+			"Product.weight":           "C",
+			"Product.shippingEstimate": "B",
+		},
+		IsBoundary: map[string]bool{"Product": true},
+		Requires: RequiresMap{
+			"Product": {"shippingEstimate": {"weight"}},
+		},
+	}
+	query := `{
+		products {
+			name
+			weight
+			shippingEstimate
+		}
+	}`
+	plan := `{
+		"RootSteps": [
+			{
+				"ServiceURL": "A",
+				"ParentType": "Query",
+				"SelectionSet": "{ products { _id: id name } }",
+				"InsertionPoint": null,
+				"InjectedFields": ["products._id"],
+				"Then": [
+					{
+						"ServiceURL": "C",
+						"ParentType": "Product",
+						"SelectionSet": "{ _id: id weight _weight: weight }",
+						"InsertionPoint": ["products"],
+						"InjectedFields": ["_id", "_weight"],
+						"Then": [
+							{
+								"ServiceURL": "B",
+								"ParentType": "Product",
+								"SelectionSet": "{ _id: id shippingEstimate }",
+								"InsertionPoint": ["products"],
+								"InjectedFields": ["_id"],
+								"Requires": ["weight"],
+								"Then": null
+							}
+						]
+					}
+				]
+			}
+		]
+	}`
+	fixture.Check(t, query, plan)
+}
+
+func TestQueryPlanRequiresFieldsOfSeveralServices(t *testing.T) {
+	fixture := &PlanTestFixture{
+		Schema: `
+			directive @boundary on OBJECT
+
+			type Product @boundary { id: ID! weight: Float! size: Int! shippingEstimate: Float! }
+			type Query { products: [Product!]! }
+		`,
+		Locations: map[string]string{
+			"Query.products":           "A",
+			"Product.weight":           "B",
+			"Product.size":             "C",
+			"Product.shippingEstimate": "B",
+		},
+		IsBoundary: map[string]bool{"Product": true},
+		Requires: RequiresMap{
+			"Product": {"shippingEstimate": {"weight", "size"}},
+		},
+	}
+	schema := gqlparser.MustLoadSchema(&ast.Source{Name: "fixture", Input: fixture.Schema})
+	operation := gqlparser.MustLoadQuery(schema, `{ products { ... on Product { shippingEstimate } } }`)
+	_, err := Plan(&PlanningContext{operation.Operations[0], schema, fixture.Locations, fixture.IsBoundary, map[string]*Service{
+		"A": {Name: "A", ServiceURL: "A"},
+	}, nil, fixture.Requires})
+	assert.EqualError(t, err, "the fields required by Product.shippingEstimate must be resolved by a single service")
+}
+
+func TestQueryPlanRequiredArguments(t *testing.T) {
+	schema := loadSchema(`
+	type Movie {
+		id: ID!
+		ownerId(tenant: String!): ID!
+		rating(scale: Int! = 5): Int
+	}
+	type Query {
+		movie: Movie
+	}`)
+	movie := schema.Types["Movie"]
+
+	step := &QueryPlanStep{
+		ServiceName: "movies",
+		SelectionSet: ast.SelectionSet{
+			&ast.Field{Alias: "movie", Name: "movie", Definition: schema.Query.Fields.ForName("movie"), SelectionSet: ast.SelectionSet{
+				&ast.Field{Alias: "rating", Name: "rating", Definition: movie.Fields.ForName("rating")},
+			}},
+		},
+	}
+	assert.NoError(t, checkRequiredArguments([]*QueryPlanStep{step}))
+
+	step.Then = []*QueryPlanStep{{
+		ServiceName: "owners",
+		SelectionSet: ast.SelectionSet{
+			&ast.InlineFragment{TypeCondition: "Movie", SelectionSet: ast.SelectionSet{
+				&ast.Field{Alias: "ownerId", Name: "ownerId", Definition: movie.Fields.ForName("ownerId")},
+			}},
+		},
+	}}
+	assert.EqualError(t, checkRequiredArguments([]*QueryPlanStep{step}), `argument "tenant" of field "ownerId" is required by service "owners" but isn't provided by the plan`)
+}
@@ -3,8 +3,10 @@ package bramble
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/99designs/gqlgen/graphql/handler"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -66,6 +68,56 @@ func (p *BasePlugin) ModifyExtensions(ctx context.Context, e *QueryExecution, ex
 	return nil
 }
 
+// ReconfigurablePlugin is implemented by the plugins whose configuration can
+// be replaced at runtime (e.g. through the admin API), without restarting the
+// gateway.
+type ReconfigurablePlugin interface {
+	// Reconfigure applies the new plugin config, the raw json of the "config"
+	// key. It can be called concurrently with the requests handled by the
+	// plugin. The current config must be kept if an error is returned.
+	Reconfigure(pluginCfg json.RawMessage) error
+}
+
+// GraphQLServerPlugin is implemented by the plugins extending the gqlgen
+// server of the gateway, e.g. with additional transports or extensions
+// (handler.Server.AddTransport and handler.Server.Use).
+type GraphQLServerPlugin interface {
+	// ConfigureGraphQLServer is called every time the router is built, after
+	// the default transports and extensions are added
+	ConfigureGraphQLServer(srv *handler.Server)
+}
+
+// ErrPluginNotFound is returned when reconfiguring a plugin that isn't
+// enabled
+var ErrPluginNotFound = errors.New("plugin not found")
+
+// ErrPluginNotReconfigurable is returned when reconfiguring a plugin that
+// doesn't implement ReconfigurablePlugin
+var ErrPluginNotReconfigurable = errors.New("plugin can't be reconfigured at runtime")
+
+// Plugins returns the enabled plugins
+func (s *ExecutableSchema) Plugins() []Plugin {
+	return s.plugins
+}
+
+// ReconfigurePlugin replaces the config of the enabled plugin with the given
+// ID. The config is overridden by the config file when it's reloaded.
+func (s *ExecutableSchema) ReconfigurePlugin(id string, pluginCfg json.RawMessage) error {
+	for _, p := range s.plugins {
+		if p.ID() != id {
+			continue
+		}
+		r, ok := p.(ReconfigurablePlugin)
+		if !ok {
+			return ErrPluginNotReconfigurable
+		}
+		s.reconfigureMutex.Lock()
+		defer s.reconfigureMutex.Unlock()
+		return r.Reconfigure(pluginCfg)
+	}
+	return ErrPluginNotFound
+}
+
 var registeredPlugins = map[string]Plugin{}
 
 // RegisterPlugin register a plugin so that it can be enabled via the configuration.
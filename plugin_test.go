@@ -0,0 +1,53 @@
+package bramble
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type reconfigurablePlugin struct {
+	BasePlugin
+	config json.RawMessage
+}
+
+func (p *reconfigurablePlugin) ID() string {
+	return "reconfigurable"
+}
+
+func (p *reconfigurablePlugin) Reconfigure(data json.RawMessage) error {
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	if _, ok := config["invalid"]; ok {
+		return errors.New("invalid config")
+	}
+	p.config = data
+	return nil
+}
+
+type staticPlugin struct {
+	BasePlugin
+}
+
+func (p *staticPlugin) ID() string {
+	return "static"
+}
+
+func TestReconfigurePlugin(t *testing.T) {
+	reconfigurable := &reconfigurablePlugin{}
+	es := newExecutableSchema([]Plugin{reconfigurable, &staticPlugin{}}, 50, nil)
+	assert.Len(t, es.Plugins(), 2)
+
+	assert.NoError(t, es.ReconfigurePlugin("reconfigurable", json.RawMessage(`{"debug": true}`)))
+	assert.JSONEq(t, `{"debug": true}`, string(reconfigurable.config))
+
+	assert.EqualError(t, es.ReconfigurePlugin("reconfigurable", json.RawMessage(`{"invalid": true}`)), "invalid config")
+	assert.JSONEq(t, `{"debug": true}`, string(reconfigurable.config))
+
+	assert.True(t, errors.Is(es.ReconfigurePlugin("static", json.RawMessage(`{}`)), ErrPluginNotReconfigurable))
+	assert.True(t, errors.Is(es.ReconfigurePlugin("unknown", json.RawMessage(`{}`)), ErrPluginNotFound))
+}
@@ -0,0 +1,232 @@
+package plugins
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/movio/bramble"
+)
+
+func init() {
+	bramble.RegisterPlugin(&AdminAPIPlugin{})
+}
+
+// AdminAPIPlugin serves an authenticated HTTP API to inspect and register the
+// federated services.
+type AdminAPIPlugin struct {
+	bramble.BasePlugin
+	config           AdminAPIPluginConfig
+	executableSchema *bramble.ExecutableSchema
+}
+
+// AdminAPIPluginConfig is the configuration for the admin API plugin
+type AdminAPIPluginConfig struct {
+	// Tokens accepted in the Authorization header (as bearer tokens), at
+	// least one is required
+	Tokens []string `json:"tokens"`
+}
+
+func (p *AdminAPIPlugin) ID() string {
+	return "admin-api"
+}
+
+func (p *AdminAPIPlugin) Configure(cfg *bramble.Config, data json.RawMessage) error {
+	if err := json.Unmarshal(data, &p.config); err != nil {
+		return err
+	}
+	if len(p.config.Tokens) == 0 {
+		return errors.New("at least one token is required")
+	}
+	for _, t := range p.config.Tokens {
+		if t == "" {
+			return errors.New("tokens can't be empty")
+		}
+	}
+	return nil
+}
+
+func (p *AdminAPIPlugin) Init(s *bramble.ExecutableSchema) {
+	p.executableSchema = s
+}
+
+func (p *AdminAPIPlugin) SetupPrivateMux(mux *http.ServeMux) {
+	mux.Handle("/admin/api/services", p.authenticate(http.HandlerFunc(p.servicesHandler)))
+	mux.Handle("/admin/api/services/schema", p.authenticate(http.HandlerFunc(p.serviceSchemaHandler)))
+	mux.Handle("/admin/api/schema", p.authenticate(http.HandlerFunc(p.schemaHandler)))
+	mux.Handle("/admin/api/plugins", p.authenticate(http.HandlerFunc(p.pluginsHandler)))
+	mux.Handle("/admin/api/plugins/config", p.authenticate(http.HandlerFunc(p.pluginConfigHandler)))
+}
+
+// authenticate rejects the requests without a valid bearer token
+func (p *AdminAPIPlugin) authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		for _, t := range p.config.Tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeAdminAPIError(w, http.StatusUnauthorized, "unauthorized")
+	})
+}
+
+// AdminAPIService is a service, as returned by the admin API
+type AdminAPIService struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	ServiceURL string `json:"url"`
+	SchemaHash string `json:"schemaHash,omitempty"`
+	Status     string `json:"status"`
+}
+
+type adminAPIServiceRequest struct {
+	ServiceURL string `json:"url"`
+}
+
+// servicesHandler lists (GET), adds (POST) and removes (DELETE) the services
+func (p *AdminAPIPlugin) servicesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req adminAPIServiceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ServiceURL == "" {
+			writeAdminAPIError(w, http.StatusBadRequest, "invalid request: the service url is required")
+			return
+		}
+		bramble.GetLoggerFromContext(r.Context()).WithField("url", req.ServiceURL).Info("adding service from the admin API")
+		if err := p.executableSchema.AddService(req.ServiceURL); err != nil {
+			writeAdminAPISchemaError(w, err)
+			return
+		}
+	case http.MethodDelete:
+		url := r.URL.Query().Get("url")
+		bramble.GetLoggerFromContext(r.Context()).WithField("url", url).Info("removing service from the admin API")
+		found, err := p.executableSchema.RemoveService(url)
+		if !found {
+			writeAdminAPIError(w, http.StatusNotFound, fmt.Sprintf("service %q not found", url))
+			return
+		}
+		if err != nil {
+			writeAdminAPISchemaError(w, err)
+			return
+		}
+	default:
+		writeAdminAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	services := []AdminAPIService{}
+	for _, s := range p.executableSchema.ServiceList() {
+		service := AdminAPIService{
+			Name:       s.Name,
+			Version:    s.Version,
+			ServiceURL: s.ServiceURL,
+			Status:     s.Status,
+		}
+		if s.SchemaSource != "" {
+			service.SchemaHash = s.SchemaHash()
+		}
+		services = append(services, service)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(services)
+}
+
+// serviceSchemaHandler returns the schema of the service (by name or URL) in
+// SDL format
+func (p *AdminAPIPlugin) serviceSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("service")
+	for _, s := range p.executableSchema.ServiceList() {
+		if name != "" && (s.Name == name || s.ServiceURL == name) && s.SchemaSource != "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", s.Name+".graphql"))
+			_, _ = w.Write([]byte(s.SchemaSource))
+			return
+		}
+	}
+	writeAdminAPIError(w, http.StatusNotFound, fmt.Sprintf("service %q not found", name))
+}
+
+// schemaHandler returns the merged schema in SDL format
+func (p *AdminAPIPlugin) schemaHandler(w http.ResponseWriter, r *http.Request) {
+	sdl := p.executableSchema.SDLWithDirectives()
+	if sdl == "" {
+		writeAdminAPIError(w, http.StatusServiceUnavailable, "schema unavailable")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(sdl))
+}
+
+// AdminAPIPluginInfo is an enabled plugin, as returned by the admin API
+type AdminAPIPluginInfo struct {
+	ID             string `json:"id"`
+	Reconfigurable bool   `json:"reconfigurable"`
+}
+
+// pluginsHandler lists the enabled plugins
+func (p *AdminAPIPlugin) pluginsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	plugins := []AdminAPIPluginInfo{}
+	for _, plugin := range p.executableSchema.Plugins() {
+		_, reconfigurable := plugin.(bramble.ReconfigurablePlugin)
+		plugins = append(plugins, AdminAPIPluginInfo{ID: plugin.ID(), Reconfigurable: reconfigurable})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(plugins)
+}
+
+// pluginConfigHandler replaces (PUT) the config of the plugin, the body is the
+// new plugin config
+func (p *AdminAPIPlugin) pluginConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeAdminAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	id := r.URL.Query().Get("plugin")
+	var config json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		writeAdminAPIError(w, http.StatusBadRequest, "invalid request: the body must be the plugin config")
+		return
+	}
+	bramble.GetLoggerFromContext(r.Context()).WithField("plugin", id).Info("reconfiguring plugin from the admin API")
+	err := p.executableSchema.ReconfigurePlugin(id, config)
+	switch {
+	case errors.Is(err, bramble.ErrPluginNotFound):
+		writeAdminAPIError(w, http.StatusNotFound, fmt.Sprintf("plugin %q not found", id))
+	case errors.Is(err, bramble.ErrPluginNotReconfigurable):
+		writeAdminAPIError(w, http.StatusConflict, fmt.Sprintf("plugin %q can't be reconfigured at runtime", id))
+	case err != nil:
+		writeAdminAPIError(w, http.StatusUnprocessableEntity, fmt.Sprintf("invalid plugin config: %s", err))
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeAdminAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// writeAdminAPISchemaError writes the error of a schema update, with the
+// conflicting definitions if the schemas of the services don't merge
+func writeAdminAPISchemaError(w http.ResponseWriter, err error) {
+	body := map[string]interface{}{"error": fmt.Sprintf("error updating schema: %s", err)}
+	var conflict *bramble.MergeConflictError
+	if errors.As(err, &conflict) {
+		body["conflict"] = conflict
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,131 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/movio/bramble"
+	"github.com/movio/bramble/brambletest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminAPIPlugin(t *testing.T) {
+	movies := brambletest.NewService(t, brambletest.Service{Name: "movies", Schema: "type Query { movies: String }"})
+	reviews := brambletest.NewService(t, brambletest.Service{Name: "reviews", Schema: "type Query { reviews: String }"})
+
+	es := &bramble.ExecutableSchema{
+		Services: map[string]*bramble.Service{
+			movies.URL: bramble.NewService(movies.URL),
+		},
+	}
+	require.NoError(t, es.UpdateSchema(true))
+
+	p := &AdminAPIPlugin{}
+	require.NoError(t, p.Configure(nil, []byte(`{"tokens": ["secret"]}`)))
+	p.Init(es)
+	mux := http.NewServeMux()
+	p.SetupPrivateMux(mux)
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	listServices := func(rec *httptest.ResponseRecorder) []AdminAPIService {
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var services []AdminAPIService
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&services))
+		return services
+	}
+
+	t.Run("requires a token", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/admin/api/services", nil)
+		req.Header.Set("Authorization", "Bearer wrong")
+		mux.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("lists the services", func(t *testing.T) {
+		services := listServices(request(http.MethodGet, "/admin/api/services", ""))
+		require.Len(t, services, 1)
+		assert.Equal(t, "movies", services[0].Name)
+		assert.Equal(t, "test", services[0].Version)
+		assert.Equal(t, movies.URL, services[0].ServiceURL)
+		assert.Equal(t, "OK", services[0].Status)
+		assert.Len(t, services[0].SchemaHash, 64)
+	})
+
+	t.Run("adds and removes a service", func(t *testing.T) {
+		services := listServices(request(http.MethodPost, "/admin/api/services", fmt.Sprintf(`{"url": %q}`, reviews.URL)))
+		require.Len(t, services, 2)
+		assert.Contains(t, request(http.MethodGet, "/admin/api/schema", "").Body.String(), "reviews: String")
+
+		services = listServices(request(http.MethodDelete, "/admin/api/services?url="+reviews.URL, ""))
+		require.Len(t, services, 1)
+		assert.NotContains(t, request(http.MethodGet, "/admin/api/schema", "").Body.String(), "reviews: String")
+
+		rec := request(http.MethodDelete, "/admin/api/services?url="+reviews.URL, "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		rec = request(http.MethodPost, "/admin/api/services", `{}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("downloads the service schema", func(t *testing.T) {
+		rec := request(http.MethodGet, "/admin/api/services/schema?service=movies", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "movies: String")
+
+		rec = request(http.MethodGet, "/admin/api/services/schema?service=unknown", "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("reconfigures the plugins", func(t *testing.T) {
+		rec := request(http.MethodGet, "/admin/api/plugins", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[]`, rec.Body.String())
+
+		rec = request(http.MethodPut, "/admin/api/plugins/config?plugin=header-forwarding", `{"rules": []}`)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		rec = request(http.MethodPut, "/admin/api/plugins/config?plugin=header-forwarding", `{"rules": [`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = request(http.MethodPost, "/admin/api/plugins/config?plugin=header-forwarding", `{}`)
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+
+	t.Run("reports the merge conflicts", func(t *testing.T) {
+		conflicting := brambletest.NewService(t, brambletest.Service{Name: "films", Schema: "type Query { movies: Int }"})
+
+		rec := request(http.MethodPost, "/admin/api/services", fmt.Sprintf(`{"url": %q}`, conflicting.URL))
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		var body struct {
+			Conflict bramble.MergeConflictError `json:"conflict"`
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, "Query", body.Conflict.TypeName)
+		assert.ElementsMatch(t, []string{"movies", "films"}, body.Conflict.Services)
+		assert.Equal(t, []bramble.MergeConflictDifference{{
+			Field: "movies",
+			Definitions: map[string]string{
+				"movies": "movies: String",
+				"films":  "movies: Int",
+			},
+		}}, body.Conflict.Differences)
+	})
+}
+
+func TestAdminAPIPluginConfigure(t *testing.T) {
+	p := &AdminAPIPlugin{}
+	assert.Error(t, p.Configure(nil, []byte(`{}`)))
+	assert.Error(t, p.Configure(nil, []byte(`{"tokens": [""]}`)))
+}
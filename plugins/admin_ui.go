@@ -1,16 +1,15 @@
 package plugins
 
 import (
-	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"sort"
+	"strings"
 	"text/template"
 
 	log "github.com/sirupsen/logrus"
-	"github.com/vektah/gqlparser/v2"
-	"github.com/vektah/gqlparser/v2/ast"
-	"github.com/vektah/gqlparser/v2/formatter"
 
 	"github.com/movio/bramble"
 )
@@ -43,6 +42,9 @@ func (p *AdminUIPlugin) Init(s *bramble.ExecutableSchema) {
 
 func (p *AdminUIPlugin) SetupPrivateMux(mux *http.ServeMux) {
 	mux.HandleFunc("/admin", p.handler)
+	mux.HandleFunc("/admin/schema-check", p.schemaCheckHandler)
+	mux.HandleFunc("/admin/schema-changes", p.schemaChangesHandler)
+	mux.HandleFunc("/admin/schema-changes/force", p.forceSchemaUpdateHandler)
 }
 
 type services []service
@@ -102,30 +104,68 @@ func (p *AdminUIPlugin) handler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (p *AdminUIPlugin) testSchema(schemaStr string) (string, error) {
-	schema, gqlErr := gqlparser.LoadSchema(&ast.Source{Input: schemaStr})
-	if gqlErr != nil {
-		return "", errors.New(gqlErr.Error())
+	result := p.executableSchema.CheckSchema("", schemaStr)
+	if len(result.Errors) > 0 {
+		return "", errors.New(strings.Join(result.Errors, "\n"))
 	}
+	if len(result.Conflicts) > 0 {
+		var errs []string
+		for _, c := range result.Conflicts {
+			errs = append(errs, c.Error())
+		}
+		return "", errors.New(strings.Join(errs, "\n"))
+	}
+
+	return result.MergedSchema, nil
+}
 
-	if err := bramble.ValidateSchema(schema); err != nil {
-		return "", err
+type schemaCheckRequest struct {
+	Service string `json:"service"`
+	Schema  string `json:"schema"`
+}
+
+// schemaCheckHandler checks whether the schema from the request would merge
+// cleanly with the currently federated services.
+func (p *AdminUIPlugin) schemaCheckHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	schemas := []*ast.Schema{schema}
-	for _, service := range p.executableSchema.Services {
-		schemas = append(schemas, service.Schema)
+	var req schemaCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
 	}
 
-	result, err := bramble.MergeSchemas(schemas...)
-	if err != nil {
-		return "", err
+	result := p.executableSchema.CheckSchema(req.Service, req.Schema)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// schemaChangesHandler returns the changes detected during the last merged
+// schema update.
+func (p *AdminUIPlugin) schemaChangesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(p.executableSchema.LastSchemaChanges())
+}
+
+// forceSchemaUpdateHandler rebuilds the merged schema, applying breaking
+// changes if any.
+func (p *AdminUIPlugin) forceSchemaUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	var buf bytes.Buffer
-	f := formatter.NewFormatter(&buf)
-	f.FormatSchema(result)
+	if err := p.executableSchema.ForceSchemaUpdate(); err != nil {
+		http.Error(w, fmt.Sprintf("error updating schema: %s", err), http.StatusInternalServerError)
+		return
+	}
 
-	return buf.String(), nil
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(p.executableSchema.LastSchemaChanges())
 }
 
 const htmlTemplate = `
@@ -1,20 +1,40 @@
 package plugins
 
 import (
+	"bytes"
 	"context"
 	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/dgrijalva/jwt-go/request"
+	"github.com/gorilla/websocket"
 	"github.com/movio/bramble"
 	log "github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
 	"gopkg.in/square/go-jose.v2"
 )
 
+// jwksMinRefreshInterval is the minimum interval between two key refreshes
+// triggered by an unknown key id
+var jwksMinRefreshInterval = time.Minute
+
+// defaultMaxAuthenticationCheckBytes is the size of the request bodies read to
+// check whether the operation requires authentication, when the request size
+// isn't limited by the limits plugin
+const defaultMaxAuthenticationCheckBytes = 10 * 1024 * 1024
+
 func init() {
 	bramble.RegisterPlugin(NewJWTPlugin(nil, nil))
 }
@@ -32,7 +52,9 @@ func NewJWTPlugin(keyProviders []SigningKeyProvider, roles map[string]bramble.Op
 	}
 
 	return &JWTPlugin{
-		publicKeys: publicKeys,
+		keyProviders:    keyProviders,
+		publicKeys:      publicKeys,
+		keysRefreshedAt: time.Now(),
 		config: JWTPluginConfig{
 			Roles: roles,
 		},
@@ -47,19 +69,52 @@ func NewJWTPlugin(keyProviders []SigningKeyProvider, roles map[string]bramble.Op
 // the necessary permissions and information to the context
 type JWTPlugin struct {
 	config       JWTPluginConfig
-	keyProviders []SigningKeyProvider
-	publicKeys   map[string]*rsa.PublicKey
 	jwtExtractor request.Extractor
 
+	keysMutex       sync.RWMutex
+	keyProviders    []SigningKeyProvider
+	publicKeys      map[string]*rsa.PublicKey
+	keysRefreshedAt time.Time
+
+	// refreshTicker refreshes the keys at the JWKS refresh interval until
+	// refreshDone is closed, it's nil until the plugin is initialized
+	refreshMutex  sync.Mutex
+	refreshTicker *time.Ticker
+	refreshDone   chan struct{}
+	initialized   bool
+
 	bramble.BasePlugin
 }
 
 type JWTPluginConfig struct {
 	// List of JWKS endpoints
 	JWKS []WellKnownKeyProvider `json:"jwks"`
+	// Interval at which the keys are refreshed (e.g. "1h"), keys are also
+	// refreshed when a token is signed with an unknown key
+	JWKSRefreshInterval string `json:"jwks-refresh-interval"`
 	// Map of kid -> public key (RSA, PEM format)
-	PublicKeys map[string]string                       `json:"public-keys"`
-	Roles      map[string]bramble.OperationPermissions `json:"roles"`
+	PublicKeys map[string]string `json:"public-keys"`
+	// Expected issuer of the tokens, not checked if empty
+	Issuer string `json:"issuer"`
+	// Accepted audiences, the token must contain at least one of them. Not
+	// checked if empty
+	Audience []string `json:"audience"`
+	// Map of claim -> header added to outgoing requests
+	ClaimHeaders map[string]string `json:"claim-headers"`
+	// Operations rejected when the request is not authenticated
+	RequireAuthentication AuthenticationRequirement               `json:"require-authentication"`
+	Roles                 map[string]bramble.OperationPermissions `json:"roles"`
+
+	jwksRefreshInterval time.Duration
+}
+
+// AuthenticationRequirement describes the operations requiring an
+// authenticated request. Introspection queries are always allowed.
+type AuthenticationRequirement struct {
+	// Operation types (query, mutation, subscription)
+	Operations []string `json:"operations"`
+	// Root fields allowed without authentication, e.g. "mutation.login"
+	AllowedRootFields []string `json:"allowed-root-fields"`
 }
 
 type SigningKeyProvider interface {
@@ -77,8 +132,25 @@ func (p *JWTPlugin) Configure(cfg *bramble.Config, data json.RawMessage) error {
 		return err
 	}
 
-	for _, k := range p.config.JWKS {
-		p.keyProviders = append(p.keyProviders, &k)
+	p.config.jwksRefreshInterval = 0
+	if p.config.JWKSRefreshInterval != "" {
+		p.config.jwksRefreshInterval, err = time.ParseDuration(p.config.JWKSRefreshInterval)
+		if err != nil {
+			return fmt.Errorf("invalid JWKS refresh interval: %w", err)
+		}
+	}
+
+	for _, op := range p.config.RequireAuthentication.Operations {
+		switch ast.Operation(op) {
+		case ast.Query, ast.Mutation, ast.Subscription:
+		default:
+			return fmt.Errorf("invalid operation type %q", op)
+		}
+	}
+
+	var keyProviders []SigningKeyProvider
+	for i := range p.config.JWKS {
+		keyProviders = append(keyProviders, &p.config.JWKS[i])
 	}
 
 	if len(p.config.PublicKeys) > 0 {
@@ -86,23 +158,111 @@ func (p *JWTPlugin) Configure(cfg *bramble.Config, data json.RawMessage) error {
 		if err != nil {
 			return fmt.Errorf("error creating manual keys provider: %w", err)
 		}
-		p.keyProviders = append(p.keyProviders, provider)
+		keyProviders = append(keyProviders, provider)
+	}
+
+	p.keysMutex.Lock()
+	p.keyProviders = keyProviders
+	p.keysMutex.Unlock()
+
+	p.refreshMutex.Lock()
+	if p.initialized {
+		p.scheduleKeysRefresh()
 	}
+	p.refreshMutex.Unlock()
 
-	p.publicKeys = make(map[string]*rsa.PublicKey)
-	for _, kp := range p.keyProviders {
+	return p.refreshKeys()
+}
+
+func (p *JWTPlugin) Init(es *bramble.ExecutableSchema) {
+	p.refreshMutex.Lock()
+	defer p.refreshMutex.Unlock()
+	p.initialized = true
+	p.scheduleKeysRefresh()
+}
+
+// scheduleKeysRefresh starts, resets or stops the ticker refreshing the keys
+// according to the JWKS refresh interval. p.refreshMutex must be held.
+func (p *JWTPlugin) scheduleKeysRefresh() {
+	interval := p.config.jwksRefreshInterval
+	if interval == 0 {
+		if p.refreshTicker != nil {
+			p.refreshTicker.Stop()
+			close(p.refreshDone)
+			p.refreshTicker, p.refreshDone = nil, nil
+		}
+		return
+	}
+	if p.refreshTicker != nil {
+		p.refreshTicker.Reset(interval)
+		return
+	}
+
+	p.refreshTicker = time.NewTicker(interval)
+	p.refreshDone = make(chan struct{})
+	go func(ticker *time.Ticker, done chan struct{}) {
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.refreshKeys(); err != nil {
+					log.WithError(err).Error("error refreshing signing keys")
+				}
+			case <-done:
+				return
+			}
+		}
+	}(p.refreshTicker, p.refreshDone)
+}
+
+// refreshKeys fetches the keys of all providers. The current keys are kept
+// if any provider fails.
+func (p *JWTPlugin) refreshKeys() error {
+	p.keysMutex.RLock()
+	keyProviders := p.keyProviders
+	p.keysMutex.RUnlock()
+
+	publicKeys := make(map[string]*rsa.PublicKey)
+	for _, kp := range keyProviders {
 		keys, err := kp.Keys()
 		if err != nil {
 			return fmt.Errorf("couldn't get signing keys for provider %q: %w", kp.Name(), err)
 		}
 		for id, k := range keys {
-			p.publicKeys[id] = k
+			publicKeys[id] = k
 		}
 	}
 
+	p.keysMutex.Lock()
+	p.publicKeys = publicKeys
+	p.keysRefreshedAt = time.Now()
+	p.keysMutex.Unlock()
+
 	return nil
 }
 
+// publicKey returns the key for the given key id, refreshing the keys if the
+// key is unknown (at most once every jwksMinRefreshInterval).
+func (p *JWTPlugin) publicKey(keyID string) (*rsa.PublicKey, bool) {
+	p.keysMutex.RLock()
+	key, ok := p.publicKeys[keyID]
+	refreshedAt := p.keysRefreshedAt
+	p.keysMutex.RUnlock()
+
+	if ok || time.Since(refreshedAt) < jwksMinRefreshInterval {
+		return key, ok
+	}
+
+	if err := p.refreshKeys(); err != nil {
+		log.WithError(err).Error("error refreshing signing keys")
+		return nil, false
+	}
+
+	p.keysMutex.RLock()
+	defer p.keysMutex.RUnlock()
+	key, ok = p.publicKeys[keyID]
+	return key, ok
+}
+
 type Claims struct {
 	jwt.StandardClaims
 	Role string
@@ -112,36 +272,47 @@ func (p *JWTPlugin) ApplyMiddlewarePublicMux(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		tokenStr, err := p.jwtExtractor.ExtractToken(r)
 		if err != nil {
+			if p.requiresAuthentication(rw, r) {
+				bramble.GetLoggerFromContext(r.Context()).Info("unauthenticated request rejected")
+				rw.WriteHeader(http.StatusUnauthorized)
+				writeGraphqlError(rw, "authentication required")
+				return
+			}
 			// unauthenticated request, must use "public_role"
-			log.Info("unauthenticated request")
-			r = r.WithContext(bramble.AddPermissionsToContext(r.Context(), p.config.Roles["public_role"]))
+			bramble.GetLoggerFromContext(r.Context()).Info("unauthenticated request")
+			ctx := bramble.AddPermissionsToContext(r.Context(), p.config.Roles["public_role"])
+			r = r.WithContext(context.WithValue(ctx, unauthenticatedKey, true))
 			h.ServeHTTP(rw, r)
 			return
 		}
 
-		var claims Claims
-		_, err = jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
+		mapClaims := jwt.MapClaims{}
+		_, err = jwt.ParseWithClaims(tokenStr, mapClaims, func(token *jwt.Token) (interface{}, error) {
 			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 			}
 
 			keyID, _ := token.Header["kid"].(string)
-			if key, ok := p.publicKeys[keyID]; ok {
+			if key, ok := p.publicKey(keyID); ok {
 				return key, nil
 			}
 
 			return nil, fmt.Errorf("could not find key for kid %q", keyID)
 		})
+		if err == nil {
+			err = p.verifyIssuerAndAudience(mapClaims)
+		}
 		if err != nil {
-			log.WithError(err).Info("invalid token")
+			bramble.GetLoggerFromContext(r.Context()).WithError(err).Info("invalid token")
 			rw.WriteHeader(http.StatusUnauthorized)
 			writeGraphqlError(rw, "invalid token")
 			return
 		}
 
+		claims := claimsFromMap(mapClaims)
 		role, ok := p.config.Roles[claims.Role]
 		if !ok {
-			log.WithField("role", claims.Role).Info("invalid role")
+			bramble.GetLoggerFromContext(r.Context()).WithField("role", claims.Role).Info("invalid role")
 			rw.WriteHeader(http.StatusUnauthorized)
 			writeGraphqlError(rw, "invalid role")
 			return
@@ -154,12 +325,236 @@ func (p *JWTPlugin) ApplyMiddlewarePublicMux(h http.Handler) http.Handler {
 
 		ctx := r.Context()
 		ctx = bramble.AddPermissionsToContext(ctx, role)
+		ctx = bramble.AddClaimsToContext(ctx, mapClaims)
 		ctx = addStandardJWTClaimsToOutgoingRequest(ctx, claims.StandardClaims)
 		ctx = bramble.AddOutgoingRequestsHeaderToContext(ctx, "JWT-Claim-Role", claims.Role)
+		for claim, header := range p.config.ClaimHeaders {
+			if v, ok := claimString(mapClaims[claim]); ok {
+				ctx = bramble.AddOutgoingRequestsHeaderToContext(ctx, header, v)
+			}
+		}
 		h.ServeHTTP(rw, r.WithContext(ctx))
 	})
 }
 
+func (p *JWTPlugin) verifyIssuerAndAudience(claims jwt.MapClaims) error {
+	if p.config.Issuer != "" && !claims.VerifyIssuer(p.config.Issuer, true) {
+		return fmt.Errorf("invalid issuer")
+	}
+
+	if len(p.config.Audience) == 0 {
+		return nil
+	}
+	for _, aud := range claimAudience(claims) {
+		for _, expected := range p.config.Audience {
+			if aud == expected {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("invalid audience")
+}
+
+// claimsFromMap returns the role and standard claims. The audience is joined
+// if the token contains multiple audiences.
+func claimsFromMap(m jwt.MapClaims) Claims {
+	var claims Claims
+	claims.Role = roleClaim(m)
+	claims.Audience = strings.Join(claimAudience(m), ",")
+	claims.Id, _ = m["jti"].(string)
+	claims.Issuer, _ = m["iss"].(string)
+	claims.Subject, _ = m["sub"].(string)
+	return claims
+}
+
+// roleClaim returns the role claim. As with the decoding of JSON objects, the
+// claim name is case-insensitive and an exact match ("Role") is preferred.
+func roleClaim(m jwt.MapClaims) string {
+	if role, ok := m["Role"].(string); ok {
+		return role
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		if strings.EqualFold(name, "role") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if role, ok := m[name].(string); ok {
+			return role
+		}
+	}
+	return ""
+}
+
+// claimAudience returns the "aud" claim, which can either be a string or an
+// array of strings
+func claimAudience(m jwt.MapClaims) []string {
+	switch aud := m["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		var res []string
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+func claimString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64, bool, json.Number:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// requiresAuthentication returns true if the request executes an operation
+// that requires authentication. Requests with an invalid query are allowed,
+// as they won't be executed. The operations of the requests without query
+// text (automatic persisted queries) are only known once the query is
+// resolved, they're checked by ConfigureGraphQLServer.
+func (p *JWTPlugin) requiresAuthentication(rw http.ResponseWriter, r *http.Request) bool {
+	if len(p.config.RequireAuthentication.Operations) == 0 {
+		return false
+	}
+
+	// the operations are sent after the connection is established
+	if websocket.IsWebSocketUpgrade(r) {
+		return true
+	}
+
+	var params struct {
+		Query         string `json:"query"`
+		OperationName string `json:"operationName"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+		params.Query = r.URL.Query().Get("query")
+		params.OperationName = r.URL.Query().Get("operationName")
+	case http.MethodPost:
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			return true
+		}
+		// the body is read before the request is authenticated, its size
+		// must be limited
+		maxBytes := int64(defaultMaxAuthenticationCheckBytes)
+		if limits, ok := bramble.GetRequestLimitsFromContext(r.Context()); ok && limits.MaxRequestBytes > 0 {
+			maxBytes = limits.MaxRequestBytes
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, maxBytes))
+		if err != nil {
+			return true
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err := json.Unmarshal(body, &params); err != nil {
+			return true
+		}
+	default:
+		return false
+	}
+	if params.Query == "" {
+		return false
+	}
+
+	doc, err := parser.ParseQuery(&ast.Source{Input: params.Query})
+	if err != nil {
+		return false
+	}
+
+	for _, op := range doc.Operations {
+		if params.OperationName != "" && op.Name != params.OperationName {
+			continue
+		}
+		if p.operationRequiresAuthentication(op) {
+			return true
+		}
+	}
+	return false
+}
+
+type jwtContextKey int
+
+// unauthenticatedKey marks the requests without token in the context
+const unauthenticatedKey jwtContextKey = 0
+
+// ConfigureGraphQLServer adds the check of the operations requiring
+// authentication once they're resolved, for the requests the middleware
+// can't check (e.g. automatic persisted queries sent by hash)
+func (p *JWTPlugin) ConfigureGraphQLServer(srv *handler.Server) {
+	srv.Use(requireAuthenticationExtension{plugin: p})
+}
+
+// requireAuthenticationExtension rejects the operations of the
+// unauthenticated requests that require authentication
+type requireAuthenticationExtension struct {
+	plugin *JWTPlugin
+}
+
+func (requireAuthenticationExtension) ExtensionName() string {
+	return "RequireAuthentication"
+}
+
+func (requireAuthenticationExtension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (e requireAuthenticationExtension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	unauthenticated, _ := ctx.Value(unauthenticatedKey).(bool)
+	if !unauthenticated || len(e.plugin.config.RequireAuthentication.Operations) == 0 || !graphql.HasOperationContext(ctx) {
+		return next(ctx)
+	}
+	op := graphql.GetOperationContext(ctx).Operation
+	if op == nil || e.plugin.operationRequiresAuthentication(op) {
+		bramble.GetLoggerFromContext(ctx).Info("unauthenticated request rejected")
+		return graphql.OneShot(graphql.ErrorResponse(ctx, "authentication required"))
+	}
+	return next(ctx)
+}
+
+func (p *JWTPlugin) operationRequiresAuthentication(op *ast.OperationDefinition) bool {
+	required := false
+	for _, o := range p.config.RequireAuthentication.Operations {
+		if ast.Operation(o) == op.Operation {
+			required = true
+		}
+	}
+	if !required {
+		return false
+	}
+
+	for _, s := range op.SelectionSet {
+		f, ok := s.(*ast.Field)
+		if !ok {
+			return true
+		}
+		switch f.Name {
+		case "__schema", "__type", "__typename":
+			continue
+		}
+		if !stringInSlice(string(op.Operation)+"."+f.Name, p.config.RequireAuthentication.AllowedRootFields) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringInSlice(s string, list []string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
 func addStandardJWTClaimsToOutgoingRequest(ctx context.Context, claims jwt.StandardClaims) context.Context {
 	if claims.Audience != "" {
 		ctx = bramble.AddOutgoingRequestsHeaderToContext(ctx, "JWT-Claim-Audience", claims.Audience)
@@ -244,7 +639,8 @@ func (w *WellKnownKeyProvider) Name() string {
 }
 
 func (w *WellKnownKeyProvider) Keys() (map[string]*rsa.PublicKey, error) {
-	resp, err := http.Get(w.url)
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(w.url)
 	if err != nil {
 		return nil, fmt.Errorf("error requesting URL: %w", err)
 	}
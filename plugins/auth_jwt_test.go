@@ -1,16 +1,21 @@
 package plugins
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/movio/bramble"
+	"github.com/movio/bramble/brambletest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/square/go-jose.v2"
@@ -207,3 +212,238 @@ func TestJWTPlugin(t *testing.T) {
 		assert.Equal(t, http.StatusTeapot, rr.Result().StatusCode)
 	})
 }
+
+func TestJWTPluginValidation(t *testing.T) {
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(testPrivateKey))
+	require.NoError(t, err)
+
+	newPlugin := func(t *testing.T, config string) *JWTPlugin {
+		encodedKey, _ := json.Marshal(testPublicKey)
+		jwtPlugin := NewJWTPlugin(nil, nil)
+		err := jwtPlugin.Configure(&bramble.Config{}, json.RawMessage(fmt.Sprintf(`{
+			"public-keys": {"": %s},
+			"roles": {
+				"public_role": {},
+				"basic_role": {"query": "*"}
+			},
+			%s
+		}`, encodedKey, config)))
+		require.NoError(t, err)
+		return jwtPlugin
+	}
+
+	sign := func(t *testing.T, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(privateKey)
+		require.NoError(t, err)
+		return token
+	}
+
+	serve := func(p *JWTPlugin, req *http.Request) (*httptest.ResponseRecorder, *http.Request) {
+		var received *http.Request
+		handler := p.ApplyMiddlewarePublicMux(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r
+			w.WriteHeader(http.StatusTeapot)
+		}))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr, received
+	}
+
+	t.Run("issuer and audience", func(t *testing.T) {
+		p := newPlugin(t, `"issuer": "https://issuer", "audience": ["api"]`)
+
+		for _, tc := range []struct {
+			name   string
+			claims jwt.MapClaims
+			status int
+		}{
+			{"valid", jwt.MapClaims{"Role": "basic_role", "iss": "https://issuer", "aud": "api"}, http.StatusTeapot},
+			{"multiple audiences", jwt.MapClaims{"Role": "basic_role", "iss": "https://issuer", "aud": []string{"other", "api"}}, http.StatusTeapot},
+			{"invalid issuer", jwt.MapClaims{"Role": "basic_role", "iss": "https://other", "aud": "api"}, http.StatusUnauthorized},
+			{"invalid audience", jwt.MapClaims{"Role": "basic_role", "iss": "https://issuer", "aud": "other"}, http.StatusUnauthorized},
+			{"missing audience", jwt.MapClaims{"Role": "basic_role", "iss": "https://issuer"}, http.StatusUnauthorized},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader("{}"))
+				req.Header.Add("authorization", "Bearer "+sign(t, tc.claims))
+				rr, _ := serve(p, req)
+				assert.Equal(t, tc.status, rr.Result().StatusCode)
+			})
+		}
+	})
+
+	t.Run("claims", func(t *testing.T) {
+		p := newPlugin(t, `"claim-headers": {"email": "X-User-Email", "org_id": "X-Org-ID"}`)
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader("{}"))
+		req.Header.Add("authorization", "Bearer "+sign(t, jwt.MapClaims{
+			"Role":   "basic_role",
+			"sub":    "user-1",
+			"email":  "user@example.com",
+			"org_id": 42,
+		}))
+		rr, received := serve(p, req)
+		require.Equal(t, http.StatusTeapot, rr.Result().StatusCode)
+
+		claims, ok := bramble.GetClaimsFromContext(received.Context())
+		require.True(t, ok)
+		assert.Equal(t, "user@example.com", claims["email"])
+
+		headers := bramble.GetOutgoingRequestHeadersFromContext(received.Context())
+		assert.Equal(t, "user@example.com", headers.Get("X-User-Email"))
+		assert.Equal(t, "42", headers.Get("X-Org-ID"))
+		assert.Equal(t, "user-1", headers.Get("JWT-Claim-Subject"))
+	})
+
+	t.Run("role claim name is case-insensitive", func(t *testing.T) {
+		p := newPlugin(t, `"claim-headers": {}`)
+		for _, name := range []string{"Role", "role", "ROLE"} {
+			req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader("{}"))
+			req.Header.Add("authorization", "Bearer "+sign(t, jwt.MapClaims{name: "basic_role"}))
+			rr, _ := serve(p, req)
+			assert.Equal(t, http.StatusTeapot, rr.Result().StatusCode, name)
+		}
+	})
+
+	t.Run("require authentication", func(t *testing.T) {
+		p := newPlugin(t, `"require-authentication": {
+			"operations": ["query", "mutation"],
+			"allowed-root-fields": ["mutation.login"]
+		}`)
+
+		for _, tc := range []struct {
+			name   string
+			body   string
+			status int
+		}{
+			{"query", `{"query": "{ me { name } }"}`, http.StatusUnauthorized},
+			{"mutation", `{"query": "mutation { deleteAccount }"}`, http.StatusUnauthorized},
+			{"allowed root field", `{"query": "mutation { login(password: \"\") }"}`, http.StatusTeapot},
+			{"introspection", `{"query": "{ __schema { queryType { name } } }"}`, http.StatusTeapot},
+			{"named operation", `{"query": "query A { __typename } query B { me { name } }", "operationName": "A"}`, http.StatusTeapot},
+			{"invalid query", `{"query": "{"}`, http.StatusTeapot},
+			{"invalid body", `{"query": `, http.StatusUnauthorized},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(tc.body))
+				req.Header.Set("Content-Type", "application/json")
+				rr, received := serve(p, req)
+				assert.Equal(t, tc.status, rr.Result().StatusCode)
+				if received != nil {
+					body, err := ioutil.ReadAll(received.Body)
+					require.NoError(t, err)
+					assert.Equal(t, tc.body, string(body))
+				}
+			})
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"query": "{ me { name } }"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Add("authorization", "Bearer "+sign(t, jwt.MapClaims{"Role": "basic_role"}))
+		rr, _ := serve(p, req)
+		assert.Equal(t, http.StatusTeapot, rr.Result().StatusCode)
+	})
+
+	t.Run("require authentication with a body larger than the request limit", func(t *testing.T) {
+		p := newPlugin(t, `"require-authentication": {
+			"operations": ["mutation"],
+			"allowed-root-fields": ["mutation.login"]
+		}`)
+		body := `{"query": "mutation { login(password: \"` + strings.Repeat("a", 100) + `\") }"}`
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req = req.WithContext(bramble.AddRequestLimitsToContext(req.Context(), bramble.RequestLimits{MaxRequestBytes: 50}))
+		rr, _ := serve(p, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Result().StatusCode)
+	})
+
+	t.Run("require authentication with persisted queries", func(t *testing.T) {
+		p := newPlugin(t, `"require-authentication": {
+			"operations": ["query"]
+		}`)
+		gateway := brambletest.NewGateway(t, []brambletest.Service{
+			{
+				Name:    "users",
+				Schema:  `type User { name: String! } type Query { me: User }`,
+				Handler: brambletest.Respond(`{ "data": { "me": { "name": "Alice" } } }`),
+			},
+		}, bramble.WithPlugins(p))
+
+		query := "{ me { name } }"
+		hash := sha256.Sum256([]byte(query))
+		extensions := fmt.Sprintf(`{"persistedQuery": {"version": 1, "sha256Hash": %q}}`, hex.EncodeToString(hash[:]))
+
+		// the query is registered by an authenticated request
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(fmt.Sprintf(`{"query": %q, "extensions": %s}`, query, extensions)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Add("authorization", "Bearer "+sign(t, jwt.MapClaims{"Role": "basic_role"}))
+		resp := gateway.Do(req)
+		resp.AssertData(t, `{ "me": { "name": "Alice" } }`)
+
+		// the requests sending only the hash are checked once the query is
+		// resolved
+		req = httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(fmt.Sprintf(`{"extensions": %s}`, extensions)))
+		req.Header.Set("Content-Type", "application/json")
+		resp = gateway.Do(req)
+		resp.AssertErrors(t, "authentication required")
+
+		req = httptest.NewRequest(http.MethodGet, "/query?extensions="+url.QueryEscape(extensions), nil)
+		resp = gateway.Do(req)
+		resp.AssertErrors(t, "authentication required")
+	})
+
+	t.Run("refreshes keys on unknown kid", func(t *testing.T) {
+		defer func(d time.Duration) { jwksMinRefreshInterval = d }(jwksMinRefreshInterval)
+		jwksMinRefreshInterval = 0
+
+		keyID := "old-key"
+		jwksHandler := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var jwks jose.JSONWebKeySet
+			jwks.Keys = append(jwks.Keys, jose.JSONWebKey{
+				Key:       &privateKey.PublicKey,
+				KeyID:     keyID,
+				Algorithm: string(jose.RS256),
+			})
+			_ = json.NewEncoder(w).Encode(jwks)
+		}))
+		defer jwksHandler.Close()
+
+		jwtPlugin := NewJWTPlugin(nil, nil)
+		err := jwtPlugin.Configure(&bramble.Config{}, json.RawMessage(fmt.Sprintf(`{
+			"jwks": [%q],
+			"roles": {"basic_role": {"query": "*"}}
+		}`, jwksHandler.URL)))
+		require.NoError(t, err)
+
+		keyID = "new-key"
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"Role": "basic_role"})
+		token.Header["kid"] = "new-key"
+		tokenStr, err := token.SignedString(privateKey)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader("{}"))
+		req.Header.Add("authorization", "Bearer "+tokenStr)
+		rr, _ := serve(jwtPlugin, req)
+		assert.Equal(t, http.StatusTeapot, rr.Result().StatusCode)
+	})
+}
+
+func TestJWTPluginKeysRefreshTicker(t *testing.T) {
+	p := NewJWTPlugin(nil, nil)
+	require.NoError(t, p.Configure(&bramble.Config{}, json.RawMessage(`{"jwks-refresh-interval": "1h"}`)))
+	p.Init(nil)
+	p.Init(nil)
+	p.refreshMutex.Lock()
+	ticker := p.refreshTicker
+	p.refreshMutex.Unlock()
+	require.NotNil(t, ticker)
+
+	require.NoError(t, p.Configure(&bramble.Config{}, json.RawMessage(`{"jwks-refresh-interval": "2h"}`)))
+	p.refreshMutex.Lock()
+	assert.Same(t, ticker, p.refreshTicker, "the ticker is reset, not replaced")
+	p.refreshMutex.Unlock()
+
+	require.NoError(t, p.Configure(&bramble.Config{}, json.RawMessage(`{"jwks-refresh-interval": ""}`)))
+	p.refreshMutex.Lock()
+	assert.Nil(t, p.refreshTicker, "the ticker is stopped without interval")
+	p.refreshMutex.Unlock()
+}
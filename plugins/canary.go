@@ -0,0 +1,396 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/movio/bramble"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	bramble.RegisterPlugin(&CanaryPlugin{})
+}
+
+var (
+	promCanaryDurations = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "canary_operation_duration_seconds",
+			Help:    "A histogram of canary operation latencies",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"operation"},
+	)
+
+	promCanarySuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "canary_operation_success",
+			Help: "A gauge indicating whether the last run of the canary operation succeeded",
+		},
+		[]string{"operation"},
+	)
+
+	promCanaryServiceSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "canary_service_success",
+			Help: "A gauge indicating whether the service succeeded during the last run of the canary operation",
+		},
+		[]string{"operation", "service"},
+	)
+
+	registerCanaryMetrics sync.Once
+)
+
+// CanaryPlugin periodically executes configured operations against the
+// gateway, to detect breakages caused by downstream deploys even when there
+// is little user traffic.
+type CanaryPlugin struct {
+	bramble.BasePlugin
+	config     CanaryPluginConfig
+	interval   time.Duration
+	timeout    time.Duration
+	gatewayURL string
+	client     *bramble.HTTPClient
+	es         *bramble.ExecutableSchema
+
+	mutex   sync.RWMutex
+	results map[string]CanaryResult
+	// ticker runs the operations until done is closed, it's nil when there
+	// are no operations
+	ticker *time.Ticker
+	done   chan struct{}
+}
+
+// CanaryPluginConfig is the configuration for the canary plugin
+type CanaryPluginConfig struct {
+	// Interval between runs, defaults to 1m
+	Interval string `json:"interval"`
+	// Timeout of a single operation, defaults to 10s
+	Timeout string `json:"timeout"`
+	// Number of consecutive failures of an operation before the gateway is
+	// reported as not ready, defaults to 1
+	FailureThreshold int               `json:"failure-threshold"`
+	Operations       []CanaryOperation `json:"operations"`
+}
+
+// CanaryOperation is an operation executed by the canary plugin
+type CanaryOperation struct {
+	Name          string                 `json:"name"`
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operation-name"`
+	Variables     map[string]interface{} `json:"variables"`
+	// Headers sent with the operation (e.g. a service token)
+	Headers map[string]string `json:"headers"`
+}
+
+// CanaryResult is the result of the last run of a canary operation
+type CanaryResult struct {
+	Operation           string    `json:"operation"`
+	Success             bool      `json:"success"`
+	Timestamp           time.Time `json:"timestamp"`
+	Duration            string    `json:"duration"`
+	ConsecutiveFailures int       `json:"consecutive-failures"`
+	Errors              []string  `json:"errors,omitempty"`
+	// Status of the services involved in the operation, by service name
+	Services map[string]bool `json:"services,omitempty"`
+}
+
+func NewCanaryPlugin(config CanaryPluginConfig, gatewayURL string) (*CanaryPlugin, error) {
+	interval, timeout, err := parseCanaryConfig(&config)
+	if err != nil {
+		return nil, err
+	}
+	return &CanaryPlugin{config: config, interval: interval, timeout: timeout, gatewayURL: gatewayURL}, nil
+}
+
+func (p *CanaryPlugin) ID() string {
+	return "canary"
+}
+
+// Configure validates the config and applies it, the interval of the running
+// plugin is reset
+func (p *CanaryPlugin) Configure(cfg *bramble.Config, data json.RawMessage) error {
+	var config CanaryPluginConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	interval, timeout, err := parseCanaryConfig(&config)
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.config = config
+	p.interval = interval
+	p.timeout = timeout
+	p.gatewayURL = fmt.Sprintf("http://localhost:%d", cfg.GatewayPort)
+	if p.results != nil {
+		p.client = bramble.NewHTTPClient("canary", bramble.WithBaseURL(p.gatewayURL))
+		p.schedule()
+	}
+	return nil
+}
+
+// parseCanaryConfig validates the config, sets its defaults and returns its
+// interval and timeout
+func parseCanaryConfig(config *CanaryPluginConfig) (interval, timeout time.Duration, err error) {
+	interval = time.Minute
+	if config.Interval != "" {
+		interval, err = time.ParseDuration(config.Interval)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid interval: %w", err)
+		}
+	}
+
+	timeout = 10 * time.Second
+	if config.Timeout != "" {
+		timeout, err = time.ParseDuration(config.Timeout)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 1
+	}
+
+	names := make(map[string]bool)
+	for _, op := range config.Operations {
+		if op.Name == "" || op.Query == "" {
+			return 0, 0, fmt.Errorf("canary operations must have a name and a query")
+		}
+		if names[op.Name] {
+			return 0, 0, fmt.Errorf("duplicate canary operation %q", op.Name)
+		}
+		names[op.Name] = true
+	}
+
+	return interval, timeout, nil
+}
+
+func (p *CanaryPlugin) Init(es *bramble.ExecutableSchema) {
+	registerCanaryMetrics.Do(func() {
+		prometheus.MustRegister(promCanaryDurations)
+		prometheus.MustRegister(promCanarySuccess)
+		prometheus.MustRegister(promCanaryServiceSuccess)
+	})
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.es = es
+	p.client = bramble.NewHTTPClient("canary", bramble.WithBaseURL(p.gatewayURL))
+	p.results = make(map[string]CanaryResult)
+	p.schedule()
+}
+
+// schedule starts, resets or stops the ticker running the operations
+// according to the config. p.mutex must be held.
+func (p *CanaryPlugin) schedule() {
+	if len(p.config.Operations) == 0 {
+		if p.ticker != nil {
+			p.ticker.Stop()
+			close(p.done)
+			p.ticker, p.done = nil, nil
+		}
+		return
+	}
+	if p.ticker != nil {
+		p.ticker.Reset(p.interval)
+		return
+	}
+
+	p.ticker = time.NewTicker(p.interval)
+	p.done = make(chan struct{})
+	go func(ticker *time.Ticker, done chan struct{}) {
+		// the first run happens after an interval, once the gateway is
+		// listening
+		for {
+			select {
+			case <-ticker.C:
+				p.runOperations()
+			case <-done:
+				return
+			}
+		}
+	}(p.ticker, p.done)
+}
+
+func (p *CanaryPlugin) SetupPrivateMux(mux *http.ServeMux) {
+	mux.HandleFunc("/canary", p.resultsHandler)
+}
+
+// resultsHandler returns the results of the last runs. The status is 503 if
+// an operation failed more than the failure threshold, so it can be used as
+// a readiness check.
+func (p *CanaryPlugin) resultsHandler(w http.ResponseWriter, r *http.Request) {
+	p.mutex.RLock()
+	results := make([]CanaryResult, 0, len(p.results))
+	ready := true
+	for _, r := range p.results {
+		results = append(results, r)
+		if r.ConsecutiveFailures >= p.config.FailureThreshold {
+			ready = false
+		}
+	}
+	p.mutex.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Operation < results[j].Operation
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(struct {
+		Ready   bool           `json:"ready"`
+		Results []CanaryResult `json:"results"`
+	}{
+		Ready:   ready,
+		Results: results,
+	})
+}
+
+func (p *CanaryPlugin) runOperations() {
+	p.mutex.RLock()
+	operations, timeout := p.config.Operations, p.timeout
+	client, es := p.client, p.es
+	p.mutex.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, op := range operations {
+		wg.Add(1)
+		go func(op CanaryOperation) {
+			defer wg.Done()
+			p.recordResult(runCanaryOperation(client, es, op, timeout))
+		}(op)
+	}
+	wg.Wait()
+}
+
+type canaryPlanStep struct {
+	ServiceURL string
+	Then       []canaryPlanStep
+}
+
+type canaryResponse struct {
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+	Extensions struct {
+		Plan *struct {
+			RootSteps []canaryPlanStep
+		} `json:"plan"`
+	} `json:"extensions"`
+}
+
+func runCanaryOperation(client *bramble.HTTPClient, es *bramble.ExecutableSchema, op CanaryOperation, timeout time.Duration) CanaryResult {
+	result := CanaryResult{
+		Operation: op.Name,
+		Timestamp: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := client.NewRequest(ctx, http.MethodPost, "/query", map[string]interface{}{
+		"query":         op.Query,
+		"operationName": op.OperationName,
+		"variables":     op.Variables,
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result
+	}
+	for k, v := range op.Headers {
+		req.Header.Set(k, v)
+	}
+	// the plan is used to report the status of each service
+	req.Header.Set("X-Bramble-Debug", "plan")
+
+	var resp canaryResponse
+	start := time.Now()
+	res, err := client.Do(req)
+	if err == nil {
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			err = fmt.Errorf("unexpected status code %d", res.StatusCode)
+		} else if decodeErr := json.NewDecoder(res.Body).Decode(&resp); decodeErr != nil {
+			err = fmt.Errorf("error decoding response: %w", decodeErr)
+		}
+	}
+	duration := time.Since(start)
+	result.Duration = duration.String()
+	promCanaryDurations.WithLabelValues(op.Name).Observe(duration.Seconds())
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result
+	}
+
+	failedServices := make(map[string]bool)
+	for _, e := range resp.Errors {
+		result.Errors = append(result.Errors, e.Message)
+		if url, ok := e.Extensions["serviceUrl"].(string); ok {
+			failedServices[url] = true
+		}
+	}
+	result.Success = len(resp.Errors) == 0
+
+	if resp.Extensions.Plan != nil {
+		result.Services = make(map[string]bool)
+		names := make(map[string]string)
+		for _, service := range es.ServiceList() {
+			names[service.ServiceURL] = service.Name
+		}
+		addCanaryServices(result.Services, names, resp.Extensions.Plan.RootSteps, failedServices)
+	}
+
+	return result
+}
+
+// addCanaryServices adds the services of the steps to services, by name
+// (names are the service names by URL)
+func addCanaryServices(services map[string]bool, names map[string]string, steps []canaryPlanStep, failed map[string]bool) {
+	for _, step := range steps {
+		if name, ok := names[step.ServiceURL]; ok {
+			services[name] = !failed[step.ServiceURL]
+		}
+		addCanaryServices(services, names, step.Then, failed)
+	}
+}
+
+func (p *CanaryPlugin) recordResult(result CanaryResult) {
+	p.mutex.Lock()
+	if !result.Success {
+		result.ConsecutiveFailures = p.results[result.Operation].ConsecutiveFailures + 1
+	}
+	p.results[result.Operation] = result
+	p.mutex.Unlock()
+
+	promCanarySuccess.WithLabelValues(result.Operation).Set(boolToFloat(result.Success))
+	for service, ok := range result.Services {
+		promCanaryServiceSuccess.WithLabelValues(result.Operation, service).Set(boolToFloat(ok))
+	}
+
+	if !result.Success {
+		log.WithFields(log.Fields{
+			"operation": result.Operation,
+			"errors":    result.Errors,
+		}).Warn("canary operation failed")
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
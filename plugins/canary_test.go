@@ -0,0 +1,131 @@
+package plugins
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/movio/bramble"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanaryPlugin(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "plan", r.Header.Get("X-Bramble-Debug"))
+		assert.Equal(t, "canary-token", r.Header.Get("Authorization"))
+		var req struct {
+			Query string
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch req.Query {
+		case "{ movies { id } }":
+			_, _ = w.Write([]byte(`{
+				"data": { "movies": [] },
+				"extensions": { "plan": { "RootSteps": [{ "ServiceURL": "http://movies" }] } }
+			}`))
+		default:
+			_, _ = w.Write([]byte(`{
+				"errors": [{ "message": "boom", "extensions": { "serviceUrl": "http://reviews" } }],
+				"data": { "movies": [] },
+				"extensions": { "plan": { "RootSteps": [{
+					"ServiceURL": "http://movies",
+					"Then": [{ "ServiceURL": "http://reviews" }]
+				}] } }
+			}`))
+		}
+	}))
+	defer gateway.Close()
+
+	p, err := NewCanaryPlugin(CanaryPluginConfig{
+		Operations: []CanaryOperation{
+			{Name: "movies", Query: "{ movies { id } }", Headers: map[string]string{"Authorization": "canary-token"}},
+			{Name: "reviews", Query: "{ movies { reviews { id } } }", Headers: map[string]string{"Authorization": "canary-token"}},
+		},
+	}, gateway.URL)
+	require.NoError(t, err)
+	p.Init(&bramble.ExecutableSchema{
+		Services: map[string]*bramble.Service{
+			"http://movies":  {Name: "movies", ServiceURL: "http://movies"},
+			"http://reviews": {Name: "reviews", ServiceURL: "http://reviews"},
+		},
+	})
+
+	p.runOperations()
+	p.runOperations()
+
+	rec := httptest.NewRecorder()
+	p.resultsHandler(rec, httptest.NewRequest(http.MethodGet, "/canary", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var res struct {
+		Ready   bool
+		Results []CanaryResult
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.False(t, res.Ready)
+	require.Len(t, res.Results, 2)
+
+	assert.Equal(t, "movies", res.Results[0].Operation)
+	assert.True(t, res.Results[0].Success)
+	assert.Equal(t, 0, res.Results[0].ConsecutiveFailures)
+	assert.Equal(t, map[string]bool{"movies": true}, res.Results[0].Services)
+
+	assert.Equal(t, "reviews", res.Results[1].Operation)
+	assert.False(t, res.Results[1].Success)
+	assert.Equal(t, 2, res.Results[1].ConsecutiveFailures)
+	assert.Equal(t, []string{"boom"}, res.Results[1].Errors)
+	assert.Equal(t, map[string]bool{"movies": true, "reviews": false}, res.Results[1].Services)
+}
+
+func TestCanaryPluginConfigure(t *testing.T) {
+	p := &CanaryPlugin{}
+	err := p.Configure(&bramble.Config{}, []byte(`{"interval": "often"}`))
+	assert.Error(t, err)
+
+	err = p.Configure(&bramble.Config{}, []byte(`{"operations": [{"name": "a", "query": "{ a }"}, {"name": "a", "query": "{ b }"}]}`))
+	assert.Error(t, err)
+}
+
+func TestCanaryPluginReconfigure(t *testing.T) {
+	runs := make(chan string, 10)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query string
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		select {
+		case runs <- req.Query:
+		default:
+		}
+		_, _ = w.Write([]byte(`{ "data": { "movies": [] } }`))
+	}))
+	defer gateway.Close()
+
+	p, err := NewCanaryPlugin(CanaryPluginConfig{
+		Interval:   "1h",
+		Operations: []CanaryOperation{{Name: "movies", Query: "{ movies { id } }"}},
+	}, gateway.URL)
+	require.NoError(t, err)
+	p.Init(&bramble.ExecutableSchema{})
+
+	require.Error(t, p.Configure(&bramble.Config{}, []byte(`{"interval": "often"}`)))
+	assert.Equal(t, time.Hour, p.interval, "an invalid config isn't applied")
+
+	cfg := &bramble.Config{GatewayPort: gateway.Listener.Addr().(*net.TCPAddr).Port}
+	require.NoError(t, p.Configure(cfg, []byte(`{"interval": "10ms", "operations": [{"name": "movies", "query": "{ movies { id } }"}]}`)))
+	select {
+	case query := <-runs:
+		assert.Equal(t, "{ movies { id } }", query)
+	case <-time.After(time.Second):
+		t.Fatal("the operations weren't run with the new interval")
+	}
+
+	require.NoError(t, p.Configure(cfg, []byte(`{}`)))
+	p.mutex.RLock()
+	assert.Nil(t, p.ticker, "the ticker is stopped without operations")
+	p.mutex.RUnlock()
+}
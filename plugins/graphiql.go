@@ -0,0 +1,202 @@
+package plugins
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/movio/bramble"
+)
+
+func init() {
+	bramble.RegisterPlugin(&GraphiQLPlugin{})
+}
+
+// GraphiQLPlugin serves GraphiQL, pre-loaded with the merged schema and with a
+// panel showing the query plan of the executed queries.
+type GraphiQLPlugin struct {
+	bramble.BasePlugin
+	config           GraphiQLPluginConfig
+	executableSchema *bramble.ExecutableSchema
+	template         *template.Template
+}
+
+// GraphiQLPluginConfig is the configuration for the GraphiQL plugin
+type GraphiQLPluginConfig struct {
+	// Path GraphiQL is served on, defaults to /graphiql
+	Path string `json:"path"`
+	// Endpoint the queries are sent to, defaults to /query
+	Endpoint string `json:"endpoint"`
+	// Title of the page, defaults to "Bramble GraphiQL"
+	Title string `json:"title"`
+}
+
+func (p *GraphiQLPlugin) ID() string {
+	return "graphiql"
+}
+
+func (p *GraphiQLPlugin) Configure(cfg *bramble.Config, data json.RawMessage) error {
+	p.config = GraphiQLPluginConfig{
+		Path:     "/graphiql",
+		Endpoint: "/query",
+		Title:    "Bramble GraphiQL",
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, &p.config)
+}
+
+func (p *GraphiQLPlugin) Init(s *bramble.ExecutableSchema) {
+	tmpl, err := template.New("graphiql").Parse(graphiqlTemplate)
+	if err != nil {
+		log.WithError(err).Fatal("unable to load GraphiQL page template")
+	}
+	p.template = tmpl
+	p.executableSchema = s
+}
+
+func (p *GraphiQLPlugin) SetupPublicMux(mux *http.ServeMux) {
+	mux.HandleFunc(p.config.Path, p.handler)
+}
+
+type graphiqlTemplateVariables struct {
+	Title         string
+	Endpoint      string
+	Introspection json.RawMessage
+}
+
+func (p *GraphiQLPlugin) handler(w http.ResponseWriter, r *http.Request) {
+	vars := graphiqlTemplateVariables{
+		Title:    p.config.Title,
+		Endpoint: p.config.Endpoint,
+	}
+	// the schema is pre-loaded with the permissions of the request, GraphiQL
+	// introspects the endpoint itself if it's unavailable (or the caller
+	// isn't allowed to introspect the schema)
+	if p.executableSchema.SchemaRequestAllowed(r) {
+		introspection, err := p.executableSchema.IntrospectionResult(r.Context())
+		if err != nil {
+			bramble.GetLoggerFromContext(r.Context()).WithError(err).Warn("unable to pre-load the schema in GraphiQL")
+		} else {
+			vars.Introspection = introspection
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := p.template.Execute(w, vars); err != nil {
+		bramble.GetLoggerFromContext(r.Context()).WithError(err).Error("unable to render GraphiQL page")
+	}
+}
+
+const graphiqlTemplate = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="https://unpkg.com/graphiql@1.4.7/graphiql.min.css">
+  <style>
+    body { margin: 0; font-family: sans-serif; }
+    #root { height: 100vh; display: flex; }
+    #graphiql { flex: 1; height: 100vh; }
+    #plan { width: 35%; height: 100vh; overflow: auto; border-left: 1px solid #d6d6d6; font-size: 13px; }
+    #plan h3 { margin: 0; padding: 10px; background: #f7f7f7; border-bottom: 1px solid #d6d6d6; }
+    .plan-step { margin: 8px; padding: 8px; border-left: 3px solid #e535ab; background: #fafafa; }
+    .plan-step .service { font-weight: bold; }
+    .plan-step .location { color: #888; }
+    .plan-step pre { margin: 4px 0; white-space: pre-wrap; }
+  </style>
+</head>
+<body>
+  <div id="root"></div>
+  <script crossorigin src="https://unpkg.com/react@17/umd/react.production.min.js"></script>
+  <script crossorigin src="https://unpkg.com/react-dom@17/umd/react-dom.production.min.js"></script>
+  <script crossorigin src="https://unpkg.com/graphiql@1.4.7/graphiql.min.js"></script>
+  <script>
+    var endpoint = {{.Endpoint}};
+    var introspection = {{.Introspection}};
+    var e = React.createElement;
+
+    // serviceNames maps the service URLs to their names, using the steps timings
+    function serviceNames(steps) {
+      var names = {};
+      (steps || []).forEach(function (s) { names[s.serviceUrl] = s.serviceName; });
+      return names;
+    }
+
+    function PlanStep(props) {
+      var step = props.step;
+      var location = step.ParentType + (step.InsertionPoint && step.InsertionPoint.length ? " at " + step.InsertionPoint.join(".") : "");
+      return e("div", { className: "plan-step" },
+        e("div", { className: "service" }, props.names[step.ServiceURL] || step.ServiceURL),
+        e("div", { className: "location" }, location),
+        e("pre", null, step.SelectionSet),
+        (step.Then || []).map(function (child, i) {
+          return e(PlanStep, { key: i, step: child, names: props.names });
+        }));
+    }
+
+    function QueryPlan(props) {
+      if (!props.plan) {
+        return e("div", { className: "plan-step" }, "Run a query to see its plan");
+      }
+      return e("div", null, (props.plan.RootSteps || []).map(function (step, i) {
+        return e(PlanStep, { key: i, step: step, names: props.names });
+      }));
+    }
+
+    function App() {
+      var state = React.useState({ plan: null, names: {} });
+      var showPlan = React.useState(true);
+
+      function fetcher(params, opts) {
+        // the first introspection query is answered with the pre-loaded schema
+        if (introspection && params.operationName === "IntrospectionQuery") {
+          var data = introspection;
+          introspection = null;
+          return Promise.resolve({ data: data });
+        }
+        var headers = Object.assign({}, opts && opts.headers, {
+          "Content-Type": "application/json",
+          "X-Bramble-Debug": "plan timing"
+        });
+        return fetch(endpoint, {
+          method: "POST",
+          headers: headers,
+          credentials: "same-origin",
+          body: JSON.stringify(params)
+        }).then(function (res) { return res.json(); }).then(function (res) {
+          if (res.extensions && res.extensions.plan) {
+            state[1]({ plan: res.extensions.plan, names: serviceNames(res.extensions.steps) });
+            delete res.extensions.plan;
+            delete res.extensions.steps;
+          }
+          return res;
+        });
+      }
+
+      return e(React.Fragment, null,
+        e("div", { id: "graphiql" },
+          e(GraphiQL, {
+            fetcher: fetcher,
+            headerEditorEnabled: true,
+            toolbar: {
+              additionalContent: e(GraphiQL.Button, {
+                label: "Query plan",
+                title: "Show or hide the query plan",
+                onClick: function () { showPlan[1](!showPlan[0]); }
+              })
+            }
+          })),
+        showPlan[0] && e("div", { id: "plan" },
+          e("h3", null, "Query plan"),
+          e(QueryPlan, state[0])));
+    }
+
+    ReactDOM.render(e(App), document.getElementById("root"));
+  </script>
+</body>
+</html>
+`
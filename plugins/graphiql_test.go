@@ -0,0 +1,84 @@
+package plugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/movio/bramble"
+	"github.com/movio/bramble/brambletest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphiQLPlugin(t *testing.T) {
+	movies := brambletest.NewService(t, brambletest.Service{Name: "movies", Schema: "type Query { movies: String }"})
+	es := &bramble.ExecutableSchema{
+		Services: map[string]*bramble.Service{
+			movies.URL: bramble.NewService(movies.URL),
+		},
+	}
+	require.NoError(t, es.UpdateSchema(true))
+
+	t.Run("default configuration", func(t *testing.T) {
+		p := &GraphiQLPlugin{}
+		require.NoError(t, p.Configure(nil, nil))
+		p.Init(es)
+		mux := http.NewServeMux()
+		p.SetupPublicMux(mux)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graphiql", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+		body := rec.Body.String()
+		assert.Contains(t, body, `var endpoint = "/query";`)
+		assert.Contains(t, body, `"queryType":{"name":"Query"}`, "the schema is pre-loaded")
+		assert.Contains(t, body, `"name":"movies"`)
+		assert.Contains(t, body, "X-Bramble-Debug")
+	})
+
+	t.Run("restricted introspection", func(t *testing.T) {
+		es := &bramble.ExecutableSchema{
+			Services: map[string]*bramble.Service{
+				movies.URL: bramble.NewService(movies.URL),
+			},
+			ClientIDHeader: "X-Client-Id",
+			Introspection: bramble.IntrospectionConfig{
+				Disabled:       true,
+				AllowedClients: []string{"schema-ci"},
+			},
+		}
+		require.NoError(t, es.UpdateSchema(true))
+		p := &GraphiQLPlugin{}
+		require.NoError(t, p.Configure(nil, nil))
+		p.Init(es)
+		mux := http.NewServeMux()
+		p.SetupPublicMux(mux)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graphiql", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), `"queryType"`, "the schema isn't pre-loaded")
+
+		rec = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/graphiql", nil)
+		req.Header.Set("X-Client-Id", "schema-ci")
+		mux.ServeHTTP(rec, req)
+		assert.Contains(t, rec.Body.String(), `"queryType":{"name":"Query"}`)
+	})
+
+	t.Run("custom path and endpoint", func(t *testing.T) {
+		p := &GraphiQLPlugin{}
+		require.NoError(t, p.Configure(nil, []byte(`{"path": "/ide", "endpoint": "/graphql"}`)))
+		p.Init(es)
+		mux := http.NewServeMux()
+		p.SetupPublicMux(mux)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ide", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `var endpoint = "/graphql";`)
+		assert.Contains(t, rec.Body.String(), "<title>Bramble GraphiQL</title>")
+	})
+}
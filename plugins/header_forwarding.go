@@ -0,0 +1,236 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/movio/bramble"
+)
+
+func init() {
+	bramble.RegisterPlugin(&HeaderForwardingPlugin{})
+}
+
+// HeaderForwardingPlugin controls which headers of the incoming request are
+// forwarded to each downstream service, and sets additional headers
+// (e.g. service tokens, values from the JWT claims).
+type HeaderForwardingPlugin struct {
+	bramble.BasePlugin
+	es *bramble.ExecutableSchema
+
+	mutex sync.RWMutex
+	rules []headerForwardingRule
+}
+
+// HeaderForwardingPluginConfig is the configuration for the header forwarding
+// plugin
+type HeaderForwardingPluginConfig struct {
+	Rules []HeaderForwardingRule `json:"rules"`
+}
+
+// HeaderForwardingRule describes the headers sent to a set of services
+type HeaderForwardingRule struct {
+	// Names or URLs of the services the rule applies to, all services if
+	// empty
+	Services []string `json:"services"`
+	// Incoming headers forwarded to the services, "*" forwards all the
+	// headers (except hop-by-hop headers)
+	Allow []string `json:"allow"`
+	// Incoming headers never forwarded, takes precedence over Allow
+	Deny []string `json:"deny"`
+	// Incoming headers forwarded under another name (incoming -> outgoing)
+	Rename map[string]string `json:"rename"`
+	// Headers set on outgoing requests. Values are Go templates, with the
+	// methods .Claim and .Header returning the value of a claim or of an
+	// incoming header (e.g. `{{ .Claim "sub" }}`). Headers with an empty
+	// value are not set.
+	Set map[string]string `json:"set"`
+}
+
+type headerForwardingRule struct {
+	HeaderForwardingRule
+	set map[string]*template.Template
+}
+
+// hopByHopHeaders are never forwarded with "*" as they only apply to the
+// incoming connection
+var hopByHopHeaders = map[string]bool{
+	"Accept-Encoding":          true,
+	"Connection":               true,
+	"Content-Length":           true,
+	"Content-Type":             true,
+	"Keep-Alive":               true,
+	"Proxy-Authenticate":       true,
+	"Proxy-Authorization":      true,
+	"Sec-Websocket-Extensions": true,
+	"Sec-Websocket-Key":        true,
+	"Sec-Websocket-Protocol":   true,
+	"Sec-Websocket-Version":    true,
+	"Te":                       true,
+	"Trailer":                  true,
+	"Transfer-Encoding":        true,
+	"Upgrade":                  true,
+}
+
+func NewHeaderForwardingPlugin(config HeaderForwardingPluginConfig) (*HeaderForwardingPlugin, error) {
+	p := &HeaderForwardingPlugin{}
+	if err := p.setRules(config.Rules); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *HeaderForwardingPlugin) ID() string {
+	return "header-forwarding"
+}
+
+// Configure is called again when the configuration is reloaded, the new
+// rules apply to the following requests.
+func (p *HeaderForwardingPlugin) Configure(cfg *bramble.Config, data json.RawMessage) error {
+	var config HeaderForwardingPluginConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+
+	return p.setRules(config.Rules)
+}
+
+// Reconfigure replaces the rules at runtime, the current rules are kept if the
+// new ones are invalid
+func (p *HeaderForwardingPlugin) Reconfigure(data json.RawMessage) error {
+	return p.Configure(nil, data)
+}
+
+func (p *HeaderForwardingPlugin) setRules(rules []HeaderForwardingRule) error {
+	var compiled []headerForwardingRule
+	for i, rule := range rules {
+		c := headerForwardingRule{
+			HeaderForwardingRule: rule,
+			set:                  make(map[string]*template.Template),
+		}
+		for header, value := range rule.Set {
+			tmpl, err := template.New(header).Parse(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for header %q in rule %d: %w", header, i, err)
+			}
+			c.set[http.CanonicalHeaderKey(header)] = tmpl
+		}
+		compiled = append(compiled, c)
+	}
+
+	p.mutex.Lock()
+	p.rules = compiled
+	p.mutex.Unlock()
+	return nil
+}
+
+func (p *HeaderForwardingPlugin) Init(es *bramble.ExecutableSchema) {
+	p.es = es
+}
+
+func (p *HeaderForwardingPlugin) ApplyMiddlewarePublicMux(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mutex.RLock()
+		rules := p.rules
+		p.mutex.RUnlock()
+
+		if len(rules) == 0 || p.es == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		claims, _ := bramble.GetClaimsFromContext(ctx)
+		for _, service := range p.es.ServiceList() {
+			header := serviceHeaders(rules, service, r.Header, claims)
+			if len(header) > 0 {
+				ctx = bramble.AddOutgoingServiceRequestHeadersToContext(ctx, service.ServiceURL, header)
+			}
+		}
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// serviceHeaders returns the headers to send to the given service according
+// to the matching rules
+func serviceHeaders(rules []headerForwardingRule, service *bramble.Service, incoming http.Header, claims map[string]interface{}) http.Header {
+	var matching []headerForwardingRule
+	denied := make(map[string]bool)
+	for _, rule := range rules {
+		if len(rule.Services) > 0 && !stringInSlice(service.Name, rule.Services) && !stringInSlice(service.ServiceURL, rule.Services) {
+			continue
+		}
+		matching = append(matching, rule)
+		for _, name := range rule.Deny {
+			denied[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+
+	data := headerTemplateData{claims: claims, header: incoming}
+	result := make(http.Header)
+	for _, rule := range matching {
+		for _, name := range rule.Allow {
+			if name == "*" {
+				for key, values := range incoming {
+					if !hopByHopHeaders[key] && !denied[key] {
+						result[key] = values
+					}
+				}
+				continue
+			}
+			key := http.CanonicalHeaderKey(name)
+			if values, ok := incoming[key]; ok && !denied[key] {
+				result[key] = values
+			}
+		}
+
+		for from, to := range rule.Rename {
+			key := http.CanonicalHeaderKey(from)
+			if denied[key] {
+				continue
+			}
+			if values, ok := incoming[key]; ok {
+				result[http.CanonicalHeaderKey(to)] = values
+			}
+		}
+
+		for key, tmpl := range rule.set {
+			var b strings.Builder
+			err := tmpl.Execute(&b, data)
+			if err != nil || b.Len() == 0 {
+				continue
+			}
+			result.Set(key, b.String())
+		}
+	}
+
+	return result
+}
+
+// headerTemplateData is the data available to the header value templates
+type headerTemplateData struct {
+	claims map[string]interface{}
+	header http.Header
+}
+
+// Claim returns the value of the claim, or an empty string
+func (d headerTemplateData) Claim(name string) string {
+	switch v := d.claims[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Header returns the value of the incoming header, or an empty string
+func (d headerTemplateData) Header(name string) string {
+	return d.header.Get(name)
+}
@@ -0,0 +1,94 @@
+package plugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/movio/bramble"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderForwardingPlugin(t *testing.T) {
+	p, err := NewHeaderForwardingPlugin(HeaderForwardingPluginConfig{
+		Rules: []HeaderForwardingRule{
+			{
+				Allow: []string{"*"},
+				Deny:  []string{"Cookie"},
+			},
+			{
+				Services: []string{"billing"},
+				Deny:     []string{"Authorization"},
+				Rename: map[string]string{
+					"X-Request-Id": "X-Billing-Request-Id",
+					// denied headers aren't forwarded under another name
+					"Authorization": "X-Billing-Authorization",
+					"Cookie":        "X-Billing-Cookie",
+				},
+				Set: map[string]string{
+					"X-Service-Token": "billing-token",
+					"X-User-Id":       `{{ .Claim "sub" }}`,
+					"X-Missing":       `{{ .Claim "missing" }}`,
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	p.Init(&bramble.ExecutableSchema{
+		Services: map[string]*bramble.Service{
+			"http://movies":  {Name: "movies", ServiceURL: "http://movies"},
+			"http://billing": {Name: "billing", ServiceURL: "http://billing"},
+		},
+	})
+
+	var movies, billing http.Header
+	h := p.ApplyMiddlewarePublicMux(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		movies = bramble.GetOutgoingServiceRequestHeadersFromContext(r.Context(), "http://movies")
+		billing = bramble.GetOutgoingServiceRequestHeadersFromContext(r.Context(), "http://billing")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Cookie", "session=abc")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-Id", "123")
+	req = req.WithContext(bramble.AddClaimsToContext(req.Context(), map[string]interface{}{"sub": "user-1"}))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, http.Header{
+		"Authorization": []string{"Bearer token"},
+		"X-Request-Id":  []string{"123"},
+	}, movies)
+	assert.Equal(t, http.Header{
+		"X-Request-Id":         []string{"123"},
+		"X-Billing-Request-Id": []string{"123"},
+		"X-Service-Token":      []string{"billing-token"},
+		"X-User-Id":            []string{"user-1"},
+	}, billing)
+}
+
+func TestHeaderForwardingPluginConfigure(t *testing.T) {
+	p := &HeaderForwardingPlugin{}
+	err := p.Configure(&bramble.Config{}, []byte(`{"rules": [{"set": {"X-User": "{{ .Claim \"sub\" "}}]}`))
+	assert.Error(t, err)
+
+	err = p.Configure(&bramble.Config{}, []byte(`{"rules": [{"allow": ["Authorization"]}]}`))
+	require.NoError(t, err)
+	assert.Len(t, p.rules, 1)
+
+	// reloading the configuration replaces the rules
+	err = p.Configure(&bramble.Config{}, []byte(`{"rules": []}`))
+	require.NoError(t, err)
+	assert.Empty(t, p.rules)
+}
+
+func TestHeaderForwardingPluginReconfigure(t *testing.T) {
+	p := &HeaderForwardingPlugin{}
+	require.NoError(t, p.Reconfigure([]byte(`{"rules": [{"allow": ["Authorization"]}]}`)))
+	assert.Len(t, p.rules, 1)
+
+	// invalid rules keep the current ones
+	assert.Error(t, p.Reconfigure([]byte(`{"rules": [{"set": {"X-User": "{{ .Claim"}}]}`)))
+	assert.Len(t, p.rules, 1)
+}
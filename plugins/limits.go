@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/movio/bramble"
 )
 
@@ -63,5 +64,21 @@ func (p *LimitsPlugin) ApplyMiddlewarePublicMux(h http.Handler) http.Handler {
 		r.Body = http.MaxBytesReader(w, r.Body, p.config.MaxRequestBytes)
 		h.ServeHTTP(w, r)
 	})
-	return http.TimeoutHandler(handler, p.config.maxResponseDuration, "failed to serve query in time")
+	timeoutHandler := http.TimeoutHandler(handler, p.config.maxResponseDuration, "failed to serve query in time")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := bramble.AddRequestLimitsToContext(r.Context(), bramble.RequestLimits{
+			MaxRequestBytes: p.config.MaxRequestBytes,
+			MaxResponseTime: p.config.maxResponseDuration,
+		})
+		r = r.WithContext(ctx)
+
+		// websocket connections are long lived and need to be hijacked, the
+		// limits are enforced per message and per operation by the transport
+		if websocket.IsWebSocketUpgrade(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		timeoutHandler.ServeHTTP(w, r)
+	})
 }
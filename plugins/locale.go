@@ -0,0 +1,132 @@
+package plugins
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/movio/bramble"
+)
+
+func init() {
+	bramble.RegisterPlugin(NewLocalePlugin(LocalePluginConfig{}))
+}
+
+// LocalePlugin extracts the locale, timezone and currency of the incoming
+// request and propagates them to downstream services.
+type LocalePlugin struct {
+	bramble.BasePlugin
+	config LocalePluginConfig
+}
+
+// LocalePluginConfig is the configuration for the locale plugin
+type LocalePluginConfig struct {
+	Locale   LocaleSource `json:"locale"`
+	Timezone LocaleSource `json:"timezone"`
+	Currency LocaleSource `json:"currency"`
+	// Field arguments the values are injected into
+	Arguments bramble.LocaleArguments `json:"arguments"`
+}
+
+// LocaleSource describes where a locale value is read from and how it is
+// forwarded to downstream services.
+type LocaleSource struct {
+	// Incoming request header
+	Header string `json:"header"`
+	// Claim of the authenticated user (e.g. JWT claim), the header takes
+	// precedence over the claim
+	Claim string `json:"claim"`
+	// Value used if neither the header or the claim are present
+	Default string `json:"default"`
+	// Header set on downstream requests
+	OutgoingHeader string `json:"outgoing-header"`
+}
+
+// NewLocalePlugin returns a locale plugin with the given configuration.
+// Unset sources use the default headers and claims.
+func NewLocalePlugin(config LocalePluginConfig) *LocalePlugin {
+	p := &LocalePlugin{config: config}
+	p.setDefaults()
+	return p
+}
+
+func (p *LocalePlugin) ID() string {
+	return "locale"
+}
+
+func (p *LocalePlugin) Configure(cfg *bramble.Config, data json.RawMessage) error {
+	p.config = LocalePluginConfig{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &p.config); err != nil {
+			return err
+		}
+	}
+	p.setDefaults()
+	return nil
+}
+
+func (p *LocalePlugin) setDefaults() {
+	setDefaultLocaleSource(&p.config.Locale, "Accept-Language", "locale")
+	setDefaultLocaleSource(&p.config.Timezone, "X-Timezone", "zoneinfo")
+	setDefaultLocaleSource(&p.config.Currency, "X-Currency", "currency")
+}
+
+func setDefaultLocaleSource(s *LocaleSource, header, claim string) {
+	if s.Header == "" {
+		s.Header = header
+	}
+	if s.Claim == "" {
+		s.Claim = claim
+	}
+	if s.OutgoingHeader == "" {
+		s.OutgoingHeader = header
+	}
+}
+
+func (p *LocalePlugin) Init(es *bramble.ExecutableSchema) {
+	es.LocaleArguments = p.config.Arguments
+}
+
+func (p *LocalePlugin) ApplyMiddlewarePublicMux(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := bramble.GetClaimsFromContext(r.Context())
+
+		locale := bramble.RequestLocale{
+			Locale:   p.config.Locale.value(r, claims),
+			Timezone: p.config.Timezone.value(r, claims),
+			Currency: p.config.Currency.value(r, claims),
+		}
+		locale.Locale = primaryLanguageTag(locale.Locale)
+
+		ctx := bramble.AddLocaleToContext(r.Context(), locale)
+		if locale.Locale != "" {
+			ctx = bramble.AddOutgoingRequestsHeaderToContext(ctx, p.config.Locale.OutgoingHeader, locale.Locale)
+		}
+		if locale.Timezone != "" {
+			ctx = bramble.AddOutgoingRequestsHeaderToContext(ctx, p.config.Timezone.OutgoingHeader, locale.Timezone)
+		}
+		if locale.Currency != "" {
+			ctx = bramble.AddOutgoingRequestsHeaderToContext(ctx, p.config.Currency.OutgoingHeader, locale.Currency)
+		}
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (s LocaleSource) value(r *http.Request, claims map[string]interface{}) string {
+	if v := r.Header.Get(s.Header); v != "" {
+		return v
+	}
+	if v, ok := claims[s.Claim].(string); ok && v != "" {
+		return v
+	}
+	return s.Default
+}
+
+// primaryLanguageTag returns the first language tag of an Accept-Language
+// header value, e.g. "fr-CH, fr;q=0.9, en;q=0.8" returns "fr-CH"
+func primaryLanguageTag(value string) string {
+	tag := strings.Split(value, ",")[0]
+	tag = strings.Split(tag, ";")[0]
+	return strings.TrimSpace(tag)
+}
@@ -0,0 +1,50 @@
+package plugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/movio/bramble"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalePlugin(t *testing.T) {
+	run := func(p *LocalePlugin, req *http.Request) (bramble.RequestLocale, http.Header) {
+		var locale bramble.RequestLocale
+		var headers http.Header
+		h := p.ApplyMiddlewarePublicMux(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			locale, _ = bramble.GetLocaleFromContext(r.Context())
+			headers = bramble.GetOutgoingRequestHeadersFromContext(r.Context())
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		return locale, headers
+	}
+
+	t.Run("reads headers", func(t *testing.T) {
+		p := NewLocalePlugin(LocalePluginConfig{})
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		req.Header.Set("Accept-Language", "fr-CH, fr;q=0.9, en;q=0.8")
+		req.Header.Set("X-Timezone", "Europe/Zurich")
+		locale, headers := run(p, req)
+		assert.Equal(t, bramble.RequestLocale{Locale: "fr-CH", Timezone: "Europe/Zurich"}, locale)
+		assert.Equal(t, "fr-CH", headers.Get("Accept-Language"))
+		assert.Equal(t, "Europe/Zurich", headers.Get("X-Timezone"))
+		assert.Empty(t, headers.Get("X-Currency"))
+	})
+
+	t.Run("falls back to claims and defaults", func(t *testing.T) {
+		p := NewLocalePlugin(LocalePluginConfig{
+			Currency: LocaleSource{Default: "NZD", OutgoingHeader: "X-Request-Currency"},
+		})
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		req.Header.Set("X-Timezone", "Pacific/Auckland")
+		req = req.WithContext(bramble.AddClaimsToContext(req.Context(), map[string]interface{}{
+			"locale":   "en-NZ",
+			"zoneinfo": "Europe/Zurich",
+		}))
+		locale, headers := run(p, req)
+		assert.Equal(t, bramble.RequestLocale{Locale: "en-NZ", Timezone: "Pacific/Auckland", Currency: "NZD"}, locale)
+		assert.Equal(t, "NZD", headers.Get("X-Request-Currency"))
+	})
+}
@@ -171,7 +171,7 @@ type brambleSchema struct {
 }
 
 func (r *metaPluginResolver) Schema() (*brambleSchema, error) {
-	schema := r.executableSchema.MergedSchema
+	schema := r.executableSchema.Schema()
 	var types brambleTypes
 	for name, def := range schema.Types {
 		types = append(types, r.brambleType(name, def))
@@ -224,7 +224,7 @@ func (r *metaPluginResolver) GetService(ctx context.Context, args struct{ ID gra
 func (p *metaPluginResolver) GetType(ctx context.Context, args struct{ ID graphql.ID }) (*brambleType, error) {
 	typeName := string(args.ID)
 	var typeDef *ast.Definition
-	for _, def := range p.executableSchema.MergedSchema.Types {
+	for _, def := range p.executableSchema.Schema().Types {
 		if def.Name == typeName {
 			typeDef = def
 			break
@@ -297,7 +297,7 @@ func (p *metaPluginResolver) GetField(ctx context.Context, args struct{ ID graph
 	}
 	typeName := splitFieldName[0]
 	fieldName := splitFieldName[1]
-	for _, def := range p.executableSchema.MergedSchema.Types {
+	for _, def := range p.executableSchema.Schema().Types {
 		if def.Name != typeName {
 			continue
 		}
@@ -52,13 +52,15 @@ func (p *OpenTracingPlugin) Init(s *bramble.ExecutableSchema) {
 
 func (p *OpenTracingPlugin) ApplyMiddlewarePublicMux(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		// do not trace healthcheck
-		if strings.HasPrefix(r.Header.Get("user-agent"), "Bramble") {
+		spanContext, err := p.tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+
+		// do not trace healthcheck, but continue the traces of upstream
+		// Bramble gateways
+		if err != nil && strings.HasPrefix(r.Header.Get("user-agent"), "Bramble") {
 			h.ServeHTTP(rw, r)
 			return
 		}
 
-		spanContext, _ := p.tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
 		span := p.tracer.StartSpan("query", ext.RPCServerOption(spanContext))
 		c := opentracing.ContextWithSpan(r.Context(), span)
 		bramble.AddFields(r.Context(), bramble.EventFields{
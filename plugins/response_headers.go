@@ -0,0 +1,121 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/movio/bramble"
+)
+
+func init() {
+	bramble.RegisterPlugin(&ResponseHeadersPlugin{})
+}
+
+// ResponseHeadersPlugin passes downstream response headers through to the
+// gateway response.
+type ResponseHeadersPlugin struct {
+	bramble.BasePlugin
+	config ResponseHeadersPluginConfig
+	es     *bramble.ExecutableSchema
+}
+
+// ResponseHeadersPluginConfig is the configuration for the response headers
+// plugin
+type ResponseHeadersPluginConfig struct {
+	Rules []bramble.ResponseHeaderRule `json:"rules"`
+}
+
+func NewResponseHeadersPlugin(config ResponseHeadersPluginConfig) *ResponseHeadersPlugin {
+	return &ResponseHeadersPlugin{config: config}
+}
+
+func (p *ResponseHeadersPlugin) ID() string {
+	return "response-headers"
+}
+
+func (p *ResponseHeadersPlugin) Configure(cfg *bramble.Config, data json.RawMessage) error {
+	err := json.Unmarshal(data, &p.config)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range p.config.Rules {
+		if rule.Header == "" {
+			return fmt.Errorf("response header rule is missing the header name")
+		}
+		switch strings.ToLower(rule.Merge) {
+		case "", bramble.MergeAppend, bramble.MergeFirst, bramble.MergeMin, bramble.MergeMax:
+		default:
+			return fmt.Errorf("invalid merge strategy %q for header %q", rule.Merge, rule.Header)
+		}
+	}
+
+	return nil
+}
+
+func (p *ResponseHeadersPlugin) Init(es *bramble.ExecutableSchema) {
+	p.es = es
+}
+
+func (p *ResponseHeadersPlugin) ApplyMiddlewarePublicMux(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(p.config.Rules) == 0 || websocket.IsWebSocketUpgrade(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, downstream := bramble.AddDownstreamResponseHeadersToContext(r.Context())
+		h.ServeHTTP(&responseHeadersWriter{
+			ResponseWriter: w,
+			setHeaders: func(header http.Header) {
+				merged := bramble.MergeResponseHeaders(p.config.Rules, downstream.Responses(), p.serviceNames())
+				for name, values := range merged {
+					header.Del(name)
+					for _, v := range values {
+						header.Add(name, v)
+					}
+				}
+			},
+		}, r.WithContext(ctx))
+	})
+}
+
+// serviceNames returns a function returning the name of the service of a URL,
+// or an empty string. The services are read once under the schema lock.
+func (p *ResponseHeadersPlugin) serviceNames() func(url string) string {
+	names := make(map[string]string)
+	if p.es != nil {
+		for _, s := range p.es.ServiceList() {
+			names[s.ServiceURL] = s.Name
+		}
+	}
+	return func(url string) string {
+		return names[url]
+	}
+}
+
+// responseHeadersWriter sets the downstream headers right before the
+// response headers are written, once the query has been executed
+type responseHeadersWriter struct {
+	http.ResponseWriter
+	setHeaders  func(http.Header)
+	wroteHeader bool
+}
+
+func (w *responseHeadersWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.setHeaders(w.ResponseWriter.Header())
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseHeadersWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,45 @@
+package plugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/movio/bramble"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseHeadersPlugin(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Set-Cookie", "session=abc")
+		w.Header().Set("X-Internal", "secret")
+		_, _ = w.Write([]byte(`{"data": {}}`))
+	}))
+	defer service.Close()
+
+	p := NewResponseHeadersPlugin(ResponseHeadersPluginConfig{
+		Rules: []bramble.ResponseHeaderRule{{Header: "Set-Cookie"}},
+	})
+	h := p.ApplyMiddlewarePublicMux(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var res interface{}
+		err := bramble.NewClient().Request(r.Context(), service.URL, &bramble.Request{Query: "{ __typename }"}, &res)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data": {}}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, []string{"session=abc"}, rec.Header().Values("Set-Cookie"))
+	assert.Empty(t, rec.Header().Get("X-Internal"))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+}
+
+func TestResponseHeadersPluginConfigure(t *testing.T) {
+	p := &ResponseHeadersPlugin{}
+	err := p.Configure(&bramble.Config{}, []byte(`{"rules": [{"header": "X-Cache", "merge": "sum"}]}`))
+	assert.Error(t, err)
+}
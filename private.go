@@ -0,0 +1,81 @@
+package bramble
+
+import (
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func isPrivateField(f *ast.FieldDefinition) bool {
+	return f.Directives.ForName(privateDirectiveName) != nil
+}
+
+// buildPublicSchema returns a copy of the merged schema without the fields
+// marked with the @private directive. The public schema is used to validate
+// incoming queries and for introspection, while the merged schema (and so the
+// query planner and plugins) still have access to the private fields.
+func buildPublicSchema(schema *ast.Schema) *ast.Schema {
+	if schema == nil {
+		return nil
+	}
+
+	result := *schema
+	result.Types = make(map[string]*ast.Definition, len(schema.Types))
+	for name, def := range schema.Types {
+		result.Types[name] = publicDefinition(def)
+	}
+
+	result.Directives = make(map[string]*ast.DirectiveDefinition, len(schema.Directives))
+	for name, d := range schema.Directives {
+		if name == privateDirectiveName {
+			continue
+		}
+		result.Directives[name] = d
+	}
+
+	result.PossibleTypes = make(map[string][]*ast.Definition, len(schema.PossibleTypes))
+	for name, defs := range schema.PossibleTypes {
+		for _, def := range defs {
+			result.PossibleTypes[name] = append(result.PossibleTypes[name], result.Types[def.Name])
+		}
+	}
+
+	result.Implements = make(map[string][]*ast.Definition, len(schema.Implements))
+	for name, defs := range schema.Implements {
+		for _, def := range defs {
+			result.Implements[name] = append(result.Implements[name], result.Types[def.Name])
+		}
+	}
+
+	if schema.Query != nil {
+		result.Query = result.Types[schema.Query.Name]
+	}
+	if schema.Mutation != nil {
+		result.Mutation = result.Types[schema.Mutation.Name]
+	}
+	if schema.Subscription != nil {
+		result.Subscription = result.Types[schema.Subscription.Name]
+	}
+
+	return &result
+}
+
+func publicDefinition(def *ast.Definition) *ast.Definition {
+	hasPrivateFields := false
+	for _, f := range def.Fields {
+		if isPrivateField(f) {
+			hasPrivateFields = true
+			break
+		}
+	}
+	if !hasPrivateFields {
+		return def
+	}
+
+	newDef := *def
+	newDef.Fields = nil
+	for _, f := range def.Fields {
+		if !isPrivateField(f) {
+			newDef.Fields = append(newDef.Fields, f)
+		}
+	}
+	return &newDef
+}
@@ -0,0 +1,129 @@
+package bramble
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestBuildPublicSchema(t *testing.T) {
+	merged, err := MergeSchemas(gqlparser.MustLoadSchema(&ast.Source{Input: `
+		directive @private on FIELD_DEFINITION
+
+		interface Media {
+			id: ID!
+		}
+
+		type Movie implements Media {
+			id: ID!
+			title: String
+			budget: Int @private
+		}
+
+		type Query {
+			movie(id: ID!): Movie
+			movieByLegacyId(id: Int!): Movie @private
+		}`}))
+	require.NoError(t, err)
+
+	public := buildPublicSchema(merged)
+
+	assert.Nil(t, public.Types["Movie"].Fields.ForName("budget"))
+	assert.NotNil(t, public.Types["Movie"].Fields.ForName("title"))
+	assert.Nil(t, public.Query.Fields.ForName("movieByLegacyId"))
+	assert.Nil(t, public.Directives[privateDirectiveName])
+	assert.Equal(t, public.Types["Movie"], public.PossibleTypes["Media"][0])
+
+	// the merged schema is left untouched
+	assert.NotNil(t, merged.Types["Movie"].Fields.ForName("budget"))
+	assert.NotNil(t, merged.Query.Fields.ForName("movieByLegacyId"))
+	assert.NotNil(t, merged.Directives[privateDirectiveName])
+
+	_, errs := gqlparser.LoadQuery(public, `{ movie(id: "1") { title budget } }`)
+	require.Len(t, errs, 1)
+	assert.Equal(t, `Cannot query field "budget" on type "Movie".`, errs[0].Message)
+}
+
+func TestQueryExecutionWithPrivateJoinKey(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @private on FIELD_DEFINITION
+
+				type Post {
+					id: ID!
+					title: String
+					authorId: ID @private
+				}
+
+				type Query {
+					posts: [Post!]!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"posts": [
+								{ "title": "Post 1", "_join_authorId": "1" }
+							]
+						}
+					}`))
+				}),
+			},
+			{
+				schema: `type User {
+					id: ID!
+					name: String
+				}
+
+				type Query {
+					user(id: ID!): User
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var req map[string]string
+					json.NewDecoder(r.Body).Decode(&req)
+					assert.Contains(t, req["query"], `_0: user(id: "1")`)
+					w.Write([]byte(`{
+						"data": {
+							"_0": { "name": "Alice" }
+						}
+					}`))
+				}),
+			},
+		},
+		joins: []Join{
+			{Type: "Post", Field: "author", Key: "authorId", Query: "user"},
+		},
+		query: `{
+			posts {
+				title
+				author {
+					name
+				}
+			}
+			__type(name: "Post") {
+				fields {
+					name
+				}
+			}
+		}`,
+		expected: `{
+			"posts": [
+				{ "title": "Post 1", "author": { "name": "Alice" } }
+			],
+			"__type": {
+				"fields": [
+					{ "name": "id" },
+					{ "name": "title" },
+					{ "name": "author" }
+				]
+			}
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
@@ -0,0 +1,74 @@
+package bramble
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// decodeRawJSONLevel decodes a single level of the raw JSON value: objects are
+// decoded as maps of raw values, and arrays as slices of elements decoded the
+// same way (so the objects of nested lists are maps as well). Scalars are
+// kept raw and null is decoded as nil.
+func decodeRawJSONLevel(raw json.RawMessage) interface{} {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return nil
+	}
+
+	switch trimmed[0] {
+	case '{':
+		var m map[string]json.RawMessage
+		_ = json.Unmarshal(trimmed, &m)
+		return jsonMapToInterfaceMap(m)
+	case '[':
+		var l []json.RawMessage
+		_ = json.Unmarshal(trimmed, &l)
+		res := make([]interface{}, len(l))
+		for i, e := range l {
+			res[i] = decodeRawJSONLevel(e)
+		}
+		return res
+	case 'n':
+		return nil
+	default:
+		return raw
+	}
+}
+
+// prepareRawMapForInsertion is the same as prepareMapForInsertion, but only
+// decodes the raw values along the insertion point, the other values are
+// kept raw
+func prepareRawMapForInsertion(insertionPoint []string, in interface{}) interface{} {
+	if raw, ok := in.(json.RawMessage); ok {
+		in = decodeRawJSONLevel(raw)
+	}
+
+	if len(insertionPoint) == 0 {
+		return in
+	}
+
+	switch in := in.(type) {
+	case map[string]interface{}:
+		in[insertionPoint[0]] = prepareRawMapForInsertion(insertionPoint[1:], in[insertionPoint[0]])
+		return in
+	case []interface{}:
+		for i, e := range in {
+			in[i] = prepareRawMapForInsertion(insertionPoint, e)
+		}
+		return in
+	case nil, conflictingValue:
+		return in
+	default:
+		panic(fmt.Sprintf("unhandled type: %s", reflect.TypeOf(in).Name()))
+	}
+}
+
+// rawValue returns the raw value as an interface, or nil if it's missing
+func rawValue(raw json.RawMessage) interface{} {
+	if raw == nil {
+		return nil
+	}
+	return raw
+}
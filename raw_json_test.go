@@ -0,0 +1,207 @@
+package bramble
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestPrepareRawMapForInsertion(t *testing.T) {
+	result := map[string]interface{}{
+		"movies": json.RawMessage(`[
+			{ "id": "1", "title": "Movie 1", "cast": [{ "name": "A" }], "director": { "id": "2" } },
+			null,
+			{ "id": "3", "title": "Movie 3", "cast": [], "director": null }
+		]`),
+		"other": json.RawMessage(`{ "id": "4" }`),
+	}
+
+	result = prepareRawMapForInsertion([]string{"movies", "director"}, result).(map[string]interface{})
+
+	movies := result["movies"].([]interface{})
+	assert.Len(t, movies, 3)
+	movie := movies[0].(map[string]interface{})
+	assert.Equal(t, json.RawMessage(`"Movie 1"`), movie["title"])
+	assert.Equal(t, json.RawMessage(`[{ "name": "A" }]`), movie["cast"])
+	assert.Equal(t, map[string]interface{}{"id": json.RawMessage(`"2"`)}, movie["director"])
+	assert.Nil(t, movies[1])
+	assert.Nil(t, movies[2].(map[string]interface{})["director"])
+	assert.Equal(t, json.RawMessage(`{ "id": "4" }`), result["other"])
+
+	targets := buildInsertionSlice([]string{"movies", "director"}, result, nil)
+	assert.Len(t, targets, 1)
+	assert.Equal(t, "2", targets[0].ID)
+}
+
+func TestQueryExecutionRawJSONMerge(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+
+				type Query {
+					movies: [Movie!]!
+					_movies(ids: [ID!]!): [Movie]! @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := io.ReadAll(r.Body)
+					if strings.Contains(string(b), "_result") {
+						w.Write([]byte(`{
+							"data": {
+								"_result": [
+									{ "_id": "2", "title": "Movie 2" },
+									{ "_id": "3", "title": "Movie 3" }
+								]
+							}
+						}`))
+						return
+					}
+					w.Write([]byte(`{
+						"data": {
+							"movies": [
+								{ "id": "1", "title": "Movie 1" }
+							]
+						}
+					}`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+
+				type Movie @boundary {
+					id: ID!
+					compTitles: [Movie!]!
+				}
+
+				type Query {
+					_movies(ids: [ID!]!): [Movie]! @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{
+						"data": {
+							"_result": [
+								{
+									"_id": "1",
+									"compTitles": [{ "id": "2" }, { "id": "3" }]
+								}
+							]
+						}
+					}`))
+				}),
+			},
+		},
+		rawJSON: true,
+		query: `{
+			movies {
+				title
+				compTitles {
+					id
+					title
+				}
+			}
+		}`,
+		expected: `{
+			"movies": [
+				{
+					"title": "Movie 1",
+					"compTitles": [
+						{ "id": "2", "title": "Movie 2" },
+						{ "id": "3", "title": "Movie 3" }
+					]
+				}
+			]
+		}`,
+	}
+
+	f.checkSuccess(t)
+}
+
+func BenchmarkQueryExecutionMerge(b *testing.B) {
+	var movies []string
+	for i := 0; i < 1000; i++ {
+		movies = append(movies, fmt.Sprintf(`{ "id": "%d", "title": "Movie %d", "cast": [{ "name": "A" }, { "name": "B" }, { "name": "C" }] }`, i, i))
+	}
+	moviesResponse := []byte(`{ "data": { "movies": [` + strings.Join(movies, ",") + `] } }`)
+
+	var releases []string
+	for i := 0; i < 1000; i++ {
+		releases = append(releases, fmt.Sprintf(`{ "_id": "%d", "release": %d }`, i, 2000+i))
+	}
+	releasesResponse := []byte(`{ "data": { "_result": [` + strings.Join(releases, ",") + `] } }`)
+
+	schemas := []string{
+		`directive @boundary on OBJECT | FIELD_DEFINITION
+		type Person {
+			name: String!
+		}
+		type Movie @boundary {
+			id: ID!
+			title: String
+			cast: [Person!]!
+		}
+		type Query {
+			movies: [Movie!]!
+		}`,
+		`directive @boundary on OBJECT | FIELD_DEFINITION
+		type Movie @boundary {
+			id: ID!
+			release: Int
+		}
+		type Query {
+			_movies(ids: [ID!]!): [Movie]! @boundary
+		}`,
+	}
+	responses := [][]byte{moviesResponse, releasesResponse}
+
+	var services []*Service
+	var astSchemas []*ast.Schema
+	for i, s := range schemas {
+		response := responses[i]
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(response)
+		}))
+		defer server.Close()
+		schema := gqlparser.MustLoadSchema(&ast.Source{Input: s})
+		services = append(services, &Service{ServiceURL: server.URL, Schema: schema})
+		astSchemas = append(astSchemas, schema)
+	}
+
+	merged, err := MergeSchemas(astSchemas...)
+	require.NoError(b, err)
+	query := gqlparser.MustLoadQuery(merged, `{ movies { title cast { name } release } }`)
+
+	for _, rawJSON := range []bool{false, true} {
+		b.Run(fmt.Sprintf("raw=%t", rawJSON), func(b *testing.B) {
+			es := newExecutableSchema(nil, 50, nil, services...)
+			es.MergedSchema = merged
+			es.BoundaryQueries = buildBoundaryQueriesMap(services...)
+			es.Locations = buildFieldURLMap(services...)
+			es.IsBoundary = buildIsBoundaryMap(services...)
+			es.PublicSchema = buildPublicSchema(merged)
+			es.RawJSONMerge = rawJSON
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				resp := es.ExecuteQuery(testContextWithVariables(map[string]interface{}{}, query.Operations[0]))
+				if len(resp.Errors) > 0 {
+					b.Fatal(resp.Errors)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package bramble
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Recording modes
+const (
+	RecordingModeRecord = "record"
+	RecordingModeReplay = "replay"
+)
+
+// recordingRedactedHeaders are always redacted
+var recordingRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// RecordingConfig configures the recording of the requests to the services,
+// their responses can then be replayed without the services (e.g. in
+// regression tests)
+type RecordingConfig struct {
+	// Mode is either "record" or "replay"
+	Mode string `json:"mode"`
+	// Directory contains the recordings, one file per request
+	Directory string `json:"directory"`
+	// RedactHeaders are the headers whose values aren't recorded, in addition
+	// to the authorization and cookie headers
+	RedactHeaders []string `json:"redact-headers"`
+	// RedactFields are the JSON fields whose values aren't recorded, in the
+	// requests and the responses
+	RedactFields []string `json:"redact-fields"`
+}
+
+// Recording records the requests to the services and their responses, or
+// replays the recorded responses. The requests are identified by their URL
+// and body, so a replayed gateway must send the same requests as the
+// recorded one.
+type Recording struct {
+	mode          string
+	directory     string
+	redactHeaders []string
+	redactFields  map[string]bool
+
+	mutex sync.Mutex
+}
+
+// NewRecording returns the recording described by the config
+func NewRecording(config RecordingConfig) (*Recording, error) {
+	if config.Mode != RecordingModeRecord && config.Mode != RecordingModeReplay {
+		return nil, fmt.Errorf("invalid mode %q, must be %q or %q", config.Mode, RecordingModeRecord, RecordingModeReplay)
+	}
+	if config.Directory == "" {
+		return nil, errors.New("directory is required")
+	}
+	if config.Mode == RecordingModeRecord {
+		if err := os.MkdirAll(config.Directory, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &Recording{
+		mode:          config.Mode,
+		directory:     config.Directory,
+		redactHeaders: append(append([]string{}, recordingRedactedHeaders...), config.RedactHeaders...),
+		redactFields:  make(map[string]bool),
+	}
+	for _, field := range config.RedactFields {
+		r.redactFields[field] = true
+	}
+	return r, nil
+}
+
+// recordedExchange is a recorded request and its response
+type recordedExchange struct {
+	URL      string          `json:"url"`
+	Request  recordedMessage `json:"request"`
+	Response recordedMessage `json:"response"`
+}
+
+// recordedMessage is a recorded request or response. The body is recorded as
+// JSON if it's valid JSON, else as text.
+type recordedMessage struct {
+	Status  int             `json:"status,omitempty"`
+	Headers http.Header     `json:"headers,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"`
+	Text    string          `json:"text,omitempty"`
+}
+
+func (m recordedMessage) body() []byte {
+	if m.Body != nil {
+		return m.Body
+	}
+	return []byte(m.Text)
+}
+
+// transport wraps the transport of the requests to record or replay them
+func (r *Recording) transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &recordingTransport{recording: r, base: base}
+}
+
+// path returns the file of the recording of the request
+func (r *Recording) path(url string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(url))
+	hash.Write([]byte{'\n'})
+	hash.Write(body)
+	return filepath.Join(r.directory, hex.EncodeToString(hash.Sum(nil)[:16])+".json")
+}
+
+func (r *Recording) replay(req *http.Request, body []byte) (*http.Response, error) {
+	path := r.path(req.URL.String(), body)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no recorded response for the request to %s (%s)", req.URL, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var exchange recordedExchange
+	if err := json.Unmarshal(data, &exchange); err != nil {
+		return nil, fmt.Errorf("invalid recording %s: %w", path, err)
+	}
+
+	responseBody := exchange.Response.body()
+	header := exchange.Response.Headers.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.Response.Status, http.StatusText(exchange.Response.Status)),
+		StatusCode:    exchange.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(responseBody)),
+		ContentLength: int64(len(responseBody)),
+		Request:       req,
+	}, nil
+}
+
+func (r *Recording) record(req *http.Request, body []byte, res *http.Response) (*http.Response, error) {
+	responseBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+
+	// the recorded responses aren't compressed
+	header := res.Header.Clone()
+	if header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(bytes.NewReader(responseBody))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing response: %w", err)
+		}
+		if responseBody, err = ioutil.ReadAll(gz); err != nil {
+			return nil, fmt.Errorf("error decompressing response: %w", err)
+		}
+	}
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+
+	exchange := recordedExchange{
+		URL:      req.URL.String(),
+		Request:  r.redact(req.Header.Clone(), body),
+		Response: r.redact(header, responseBody),
+	}
+	exchange.Response.Status = res.StatusCode
+	data, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := ioutil.WriteFile(r.path(req.URL.String(), body), data, 0644); err != nil {
+		return nil, fmt.Errorf("error recording response: %w", err)
+	}
+	return res, nil
+}
+
+// redact returns the recorded message without the values of the redacted
+// headers and fields
+func (r *Recording) redact(header http.Header, body []byte) recordedMessage {
+	for _, name := range r.redactHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, redactedValue)
+		}
+	}
+	if len(header) == 0 {
+		header = nil
+	}
+
+	if !json.Valid(body) {
+		return recordedMessage{Headers: header, Text: string(body)}
+	}
+	if len(r.redactFields) > 0 {
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err == nil && r.redactValue(value) {
+			body, _ = json.Marshal(value)
+		}
+	}
+	return recordedMessage{Headers: header, Body: body}
+}
+
+// redactValue replaces the values of the redacted fields in the decoded JSON
+// value and returns whether any was replaced
+func (r *Recording) redactValue(value interface{}) bool {
+	redacted := false
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for k, v := range value {
+			if r.redactFields[k] {
+				value[k] = redactedValue
+				redacted = true
+				continue
+			}
+			redacted = r.redactValue(v) || redacted
+		}
+	case []interface{}:
+		for _, v := range value {
+			redacted = r.redactValue(v) || redacted
+		}
+	}
+	return redacted
+}
+
+type recordingTransport struct {
+	recording *Recording
+	base      http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if t.recording.mode == RecordingModeReplay {
+		return t.recording.replay(req, body)
+	}
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.recording.record(req, body, res)
+}
@@ -0,0 +1,92 @@
+package bramble
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecording(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("X-Schema-Version", "1")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(`{ "data": { "movie": { "title": "Inception", "secret": "s3cr3t" } } }`))
+		gz.Close()
+	}))
+
+	request := func(client *GraphQLClient, id string) (map[string]interface{}, error) {
+		req := &Request{
+			Query:     "query($id: ID!, $token: String!) { movie(id: $id, token: $token) { title secret } }",
+			Variables: map[string]interface{}{"id": id, "token": "t0k3n"},
+			Headers:   http.Header{"Authorization": []string{"Bearer token"}},
+		}
+		var resp map[string]interface{}
+		err := client.Request(context.Background(), server.URL, req, &resp)
+		return resp, err
+	}
+
+	recorder, err := NewRecording(RecordingConfig{
+		Mode:          RecordingModeRecord,
+		Directory:     dir,
+		RedactFields:  []string{"token"},
+		RedactHeaders: []string{"X-Schema-Version"},
+	})
+	require.NoError(t, err)
+	recorded, err := request(NewClient(WithRecording(recorder)), "1")
+	require.NoError(t, err)
+	server.Close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := ioutil.ReadFile(files[0])
+	require.NoError(t, err)
+	var exchange recordedExchange
+	require.NoError(t, json.Unmarshal(data, &exchange))
+	assert.Equal(t, server.URL, exchange.URL)
+	assert.Equal(t, redactedValue, exchange.Request.Headers.Get("Authorization"))
+	var recordedRequest Request
+	require.NoError(t, json.Unmarshal(exchange.Request.Body, &recordedRequest))
+	assert.Equal(t, map[string]interface{}{"id": "1", "token": redactedValue}, recordedRequest.Variables)
+	assert.NotContains(t, string(data), "t0k3n")
+	assert.Equal(t, http.StatusOK, exchange.Response.Status)
+	assert.Equal(t, redactedValue, exchange.Response.Headers.Get("X-Schema-Version"))
+	assert.Empty(t, exchange.Response.Headers.Get("Content-Encoding"))
+	assert.JSONEq(t, `{ "data": { "movie": { "title": "Inception", "secret": "s3cr3t" } } }`, string(exchange.Response.Body))
+
+	replayer, err := NewRecording(RecordingConfig{Mode: RecordingModeReplay, Directory: dir})
+	require.NoError(t, err)
+	client := NewClient(WithRecording(replayer))
+
+	t.Run("recorded request", func(t *testing.T) {
+		replayed, err := request(client, "1")
+		require.NoError(t, err)
+		assert.Equal(t, recorded, replayed)
+	})
+
+	t.Run("request not recorded", func(t *testing.T) {
+		_, err := request(client, "2")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no recorded response for the request to "+server.URL)
+	})
+}
+
+func TestRecordingConfig(t *testing.T) {
+	_, err := NewRecording(RecordingConfig{Mode: "rewind", Directory: t.TempDir()})
+	require.Error(t, err)
+	assert.Equal(t, `invalid mode "rewind", must be "record" or "replay"`, err.Error())
+
+	_, err = NewRecording(RecordingConfig{Mode: RecordingModeReplay})
+	require.Error(t, err)
+	assert.Equal(t, "directory is required", err.Error())
+}
@@ -0,0 +1,104 @@
+package bramble
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSignatureHeader          = "X-Bramble-Signature"
+	defaultSignatureTimestampHeader = "X-Bramble-Timestamp"
+)
+
+// RequestSigningConfig configures the signature of the requests to the
+// services, so they can verify the requests were sent by the gateway
+type RequestSigningConfig struct {
+	// SignatureHeader is the header of the signature, defaults to
+	// X-Bramble-Signature
+	SignatureHeader string `json:"signature-header"`
+	// TimestampHeader is the header of the signing time, defaults to
+	// X-Bramble-Timestamp
+	TimestampHeader string `json:"timestamp-header"`
+	// Secrets are the secrets shared with the services, by service URL. The
+	// requests to the other services aren't signed.
+	Secrets map[string]string `json:"secrets"`
+}
+
+// RequestSigner signs the requests to the services with an HMAC-SHA256 of the
+// timestamp and body of the request. A nil RequestSigner doesn't sign the
+// requests.
+type RequestSigner struct {
+	signatureHeader string
+	timestampHeader string
+	secrets         map[string][]byte
+	now             func() time.Time
+}
+
+// NewRequestSigner builds the signer of the requests to the services. The
+// secrets are also used for the endpoints and replicas of the services. It
+// returns nil if no secrets are configured.
+func NewRequestSigner(config RequestSigningConfig, endpoints map[string]ServiceEndpoints, replicas map[string][]string) (*RequestSigner, error) {
+	if len(config.Secrets) == 0 {
+		return nil, nil
+	}
+
+	s := &RequestSigner{
+		signatureHeader: config.SignatureHeader,
+		timestampHeader: config.TimestampHeader,
+		secrets:         make(map[string][]byte),
+		now:             time.Now,
+	}
+	if s.signatureHeader == "" {
+		s.signatureHeader = defaultSignatureHeader
+	}
+	if s.timestampHeader == "" {
+		s.timestampHeader = defaultSignatureTimestampHeader
+	}
+	if http.CanonicalHeaderKey(s.signatureHeader) == http.CanonicalHeaderKey(s.timestampHeader) {
+		return nil, errors.New("the signature and timestamp headers must be different")
+	}
+	for serviceURL, secret := range config.Secrets {
+		if secret == "" {
+			return nil, fmt.Errorf("empty secret for service %q", serviceURL)
+		}
+		s.secrets[serviceURL] = []byte(secret)
+		for _, endpoint := range endpoints[serviceURL].allURLs() {
+			s.secrets[endpoint] = []byte(secret)
+		}
+		for _, replica := range replicas[serviceURL] {
+			s.secrets[replica] = []byte(secret)
+		}
+	}
+	return s, nil
+}
+
+// sign adds the timestamp and signature headers to the request to the given
+// URL. The body is the body sent to the service, after compression.
+func (s *RequestSigner) sign(url string, header http.Header, body []byte) {
+	if s == nil {
+		return
+	}
+	secret, ok := s.secrets[url]
+	if !ok {
+		return
+	}
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	header.Set(s.timestampHeader, timestamp)
+	header.Set(s.signatureHeader, "sha256="+requestSignature(secret, timestamp, body))
+}
+
+// requestSignature returns the hex encoded HMAC-SHA256 of the timestamp, a
+// dot and the body
+func requestSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,93 @@
+package bramble
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRequestSigner(t *testing.T) {
+	signer, err := NewRequestSigner(RequestSigningConfig{}, nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, signer)
+
+	_, err = NewRequestSigner(RequestSigningConfig{Secrets: map[string]string{"http://movies/query": ""}}, nil, nil)
+	assert.EqualError(t, err, `empty secret for service "http://movies/query"`)
+
+	_, err = NewRequestSigner(RequestSigningConfig{
+		SignatureHeader: "X-Signature",
+		TimestampHeader: "x-signature",
+		Secrets:         map[string]string{"http://movies/query": "secret"},
+	}, nil, nil)
+	assert.EqualError(t, err, "the signature and timestamp headers must be different")
+
+	signer, err = NewRequestSigner(
+		RequestSigningConfig{Secrets: map[string]string{"http://movies/query": "secret"}},
+		map[string]ServiceEndpoints{"http://movies/query": {URLs: []string{"http://movies-1/query"}}},
+		map[string][]string{"http://movies/query": {"http://movies-replica/query"}},
+	)
+	require.NoError(t, err)
+	signer.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	for _, url := range []string{"http://movies/query", "http://movies-1/query", "http://movies-replica/query"} {
+		header := make(http.Header)
+		signer.sign(url, header, []byte(`{"query":"{ movies }"}`))
+		assert.Equal(t, "1700000000", header.Get("X-Bramble-Timestamp"))
+		assert.Equal(t, "sha256="+requestSignature([]byte("secret"), "1700000000", []byte(`{"query":"{ movies }"}`)), header.Get("X-Bramble-Signature"))
+	}
+
+	header := make(http.Header)
+	signer.sign("http://reviews/query", header, []byte(`{"query":"{ reviews }"}`))
+	assert.Empty(t, header)
+}
+
+func TestRequestSignature(t *testing.T) {
+	// echo -n '1700000000.{"query":"{ movies }"}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "431695df25e9148814884f19c9d6e4b429ff1596d9672ac9c3678546c31bf4a6", requestSignature([]byte("secret"), "1700000000", []byte(`{"query":"{ movies }"}`)))
+}
+
+func TestGraphqlClientSignsRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		expected := requestSignature([]byte("secret"), r.Header.Get("X-Timestamp"), body)
+		if r.Header.Get("X-Signature") != "sha256="+expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{ "data": { "root": "value" } }`))
+	}))
+	defer srv.Close()
+
+	signer, err := NewRequestSigner(RequestSigningConfig{
+		SignatureHeader: "X-Signature",
+		TimestampHeader: "X-Timestamp",
+		Secrets:         map[string]string{srv.URL: "secret"},
+	}, nil, nil)
+	require.NoError(t, err)
+
+	var res struct {
+		Root string
+	}
+	c := NewClient(WithRequestSigner(signer))
+	require.NoError(t, c.Request(context.Background(), srv.URL, NewRequest("{ root }"), &res))
+	assert.Equal(t, "value", res.Root)
+
+	t.Run("compressed requests", func(t *testing.T) {
+		c := NewClient(WithRequestSigner(signer), WithRequestCompression(1))
+		c.requestEncodings.Store(srv.URL, "gzip")
+		require.NoError(t, c.Request(context.Background(), srv.URL, NewRequest("{ root }"), &res))
+		assert.Equal(t, "value", res.Root)
+	})
+
+	t.Run("unsigned requests", func(t *testing.T) {
+		err := NewClient().Request(context.Background(), srv.URL, NewRequest("{ root }"), &res)
+		assert.Error(t, err)
+	})
+}
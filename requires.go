@@ -0,0 +1,258 @@
+package bramble
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// RequiresMap is a mapping type -> field -> fields of other services needed
+// to resolve the field, as declared with the @requires directive in the
+// services schemas
+type RequiresMap map[string]map[string][]string
+
+// RegisterField registers the fields required by the given field
+func (m RequiresMap) RegisterField(typeName, fieldName string, required []string) {
+	if _, ok := m[typeName]; !ok {
+		m[typeName] = make(map[string][]string)
+	}
+	m[typeName][fieldName] = required
+}
+
+// Fields returns the fields required by the given field, or nil if the field
+// doesn't require any
+func (m RequiresMap) Fields(typeName, fieldName string) []string {
+	return m[typeName][fieldName]
+}
+
+// buildRequiresMap collects the @requires(fields: "...") directives of the
+// services
+func buildRequiresMap(services ...*Service) RequiresMap {
+	result := make(RequiresMap)
+	for _, rs := range services {
+		if rs.Schema == nil {
+			continue
+		}
+		for _, t := range rs.Schema.Types {
+			if t.Kind != ast.Object || isGraphQLBuiltinName(t.Name) {
+				continue
+			}
+			for _, f := range t.Fields {
+				if required := requiresDirectiveFields(f.Directives); len(required) > 0 {
+					result.RegisterField(t.Name, f.Name, required)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// requiresDirectiveFields returns the fields listed by @requires, the names
+// are separated by spaces or commas
+func requiresDirectiveFields(directives ast.DirectiveList) []string {
+	d := directives.ForName(requiresDirectiveName)
+	if d == nil {
+		return nil
+	}
+	arg := d.Arguments.ForName(requiresFieldsArgumentName)
+	if arg == nil || arg.Value == nil {
+		return nil
+	}
+	return strings.FieldsFunc(arg.Value.Raw, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '\n' || r == '\t'
+	})
+}
+
+// requiredFieldAlias is the alias of a required field injected by the
+// planner in the selection set of the step resolving it
+func requiredFieldAlias(field string) string {
+	return "_" + field
+}
+
+// createDependentSteps creates the steps resolving the fields requiring
+// fields of other services. The required fields are added to the selection
+// set (or to the children steps if they're resolved by another service), and
+// the dependent steps are executed once the required fields are resolved:
+// either as children of the current step or of the step resolving them.
+func createDependentSteps(ctx *PlanningContext, insertionPoint []string, parentType, location string, fields []*ast.Field, selectionSet ast.SelectionSet, steps []*QueryPlanStep, injected []string) (ast.SelectionSet, []*QueryPlanStep, []string, error) {
+	type group struct {
+		parent *QueryPlanStep
+		fields ast.SelectionSet
+		// required are the fields required by the group fields
+		required []string
+	}
+	var groups []*group
+
+	for _, f := range fields {
+		var parent *QueryPlanStep
+		required := ctx.Requires.Fields(parentType, f.Name)
+		for _, name := range required {
+			def := ctx.Schema.Types[parentType].Fields.ForName(name)
+			if def == nil {
+				return nil, nil, nil, fmt.Errorf("field %q required by %s.%s not found", name, parentType, f.Name)
+			}
+			loc, err := ctx.Locations.URLFor(parentType, location, name)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			alias := requiredFieldAlias(name)
+			field := &ast.Field{Alias: alias, Name: name, Definition: def}
+			if loc == location {
+				if !selectionSetHasFieldAliased(selectionSet, alias) {
+					selectionSet = append(selectionSet, field)
+					injected = append(injected, alias)
+				}
+				continue
+			}
+
+			if parent != nil && parent.ServiceURL != loc {
+				return nil, nil, nil, fmt.Errorf("the fields required by %s.%s must be resolved by a single service", parentType, f.Name)
+			}
+			step := requiredFieldsStep(steps, insertionPoint, parentType, loc)
+			if step == nil {
+				newSteps, err := createSteps(ctx, insertionPoint, parentType, location, ast.SelectionSet{field}, true)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				steps = append(steps, newSteps...)
+				step = requiredFieldsStep(steps, insertionPoint, parentType, loc)
+			} else if !selectionSetHasFieldAliased(step.SelectionSet, alias) {
+				step.SelectionSet = append(step.SelectionSet, field)
+			}
+			if !stringSliceContains(step.InjectedFields, alias) {
+				step.InjectedFields = append(step.InjectedFields, alias)
+			}
+			parent = step
+		}
+
+		var g *group
+		for _, candidate := range groups {
+			if candidate.parent == parent {
+				g = candidate
+				break
+			}
+		}
+		if g == nil {
+			g = &group{parent: parent}
+			groups = append(groups, g)
+		}
+		g.fields = append(g.fields, f)
+		g.required = mergeNames(g.required, required)
+	}
+
+	for _, g := range groups {
+		dependentSteps, err := createSteps(ctx, insertionPoint, parentType, location, g.fields, true)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, step := range dependentSteps {
+			step.Requires = g.required
+		}
+		if g.parent == nil {
+			steps = append(steps, dependentSteps...)
+		} else {
+			g.parent.Then = append(g.parent.Then, dependentSteps...)
+		}
+	}
+
+	return selectionSet, steps, injected, nil
+}
+
+// requiredFieldsStep returns the child step of the service for the objects
+// at the insertion point, if any
+func requiredFieldsStep(steps []*QueryPlanStep, insertionPoint []string, parentType, location string) *QueryPlanStep {
+	for _, step := range steps {
+		if step.Join == nil && step.Requires == nil && step.ParentType == parentType && step.ServiceURL == location && stringArraysEqual(step.InsertionPoint, insertionPoint) {
+			return step
+		}
+	}
+	return nil
+}
+
+// formatRequiredArguments returns the values of the required fields of the
+// target, formatted as arguments of a boundary query
+func (e *QueryExecution) formatRequiredArguments(step *QueryPlanStep, target map[string]interface{}) string {
+	var args []string
+	for _, name := range step.Requires {
+		args = append(args, name+": "+e.formatRequiredValue(step.ParentType, name, target[requiredFieldAlias(name)]))
+	}
+	return strings.Join(args, ", ")
+}
+
+// formatRepresentations returns the representation objects of the targets,
+// holding their required fields, for the array boundary queries
+func (e *QueryExecution) formatRepresentations(step *QueryPlanStep, targets []insertionTarget) string {
+	var b strings.Builder
+	b.WriteString("[")
+	for i, target := range targets {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString("{")
+		b.WriteString(e.formatRequiredArguments(step, target.Target))
+		b.WriteString("}")
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// formatRequiredValue formats the value of a required field as a GraphQL
+// literal. The type of the field is looked up in the merged schema, so enum
+// values aren't quoted.
+func (e *QueryExecution) formatRequiredValue(parentType, field string, value interface{}) string {
+	var t *ast.Type
+	if e.Schema != nil {
+		if def := e.Schema.Types[parentType]; def != nil {
+			if f := def.Fields.ForName(field); f != nil {
+				t = f.Type
+			}
+		}
+	}
+	if raw, ok := value.(json.RawMessage); ok {
+		value = nil
+		_ = json.Unmarshal(raw, &value)
+	}
+	return formatLiteral(e.Schema, t, value)
+}
+
+func formatLiteral(schema *ast.Schema, t *ast.Type, value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case []interface{}:
+		var elem *ast.Type
+		if t != nil {
+			elem = t.Elem
+		}
+		res := make([]string, 0, len(value))
+		for _, v := range value {
+			res = append(res, formatLiteral(schema, elem, v))
+		}
+		return "[" + strings.Join(res, " ") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		res := make([]string, 0, len(value))
+		for _, k := range keys {
+			res = append(res, k+": "+formatLiteral(schema, nil, value[k]))
+		}
+		return "{" + strings.Join(res, ", ") + "}"
+	case string:
+		if t != nil && schema != nil {
+			if def := schema.Types[t.Name()]; def != nil && def.Kind == ast.Enum {
+				return value
+			}
+		}
+		return strconv.Quote(value)
+	default:
+		buf, _ := json.Marshal(value)
+		return string(buf)
+	}
+}
@@ -0,0 +1,182 @@
+package bramble
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// decodeResponse decodes a GraphQL response from the decoder, like Decode
+// would. The data is decoded one field at a time, and the arrays one element
+// at a time, so that the decoder only buffers a single entity of the boundary
+// query responses instead of the whole response.
+func decodeResponse(dec *json.Decoder, resp *Response) error {
+	start, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if start == nil {
+		return nil
+	}
+	if start != json.Delim('{') {
+		return fmt.Errorf("cannot unmarshal %v into a GraphQL response", start)
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "data":
+			err = decodeResponseData(dec, resp)
+		case "errors":
+			err = dec.Decode(&resp.Errors)
+		case "extensions":
+			err = dec.Decode(&resp.Extensions)
+		default:
+			err = dec.Decode(&json.RawMessage{})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func decodeResponseData(dec *json.Decoder, resp *Response) error {
+	v := reflect.ValueOf(resp.Data)
+	if !streamable(v, true) {
+		return dec.Decode(&resp.Data)
+	}
+	start, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if start == nil {
+		// like encoding/json, a null data leaves the value untouched
+		resp.Data = nil
+		return nil
+	}
+	return decodeStreamed(dec, start, v.Elem())
+}
+
+// streamable returns whether the value v points to is decoded one field or
+// element at a time. Only the fields of the first level are streamed.
+func streamable(v reflect.Value, fields bool) bool {
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Type().Implements(jsonUnmarshalerType) {
+		return false
+	}
+	switch v.Elem().Kind() {
+	case reflect.Map:
+		return fields && v.Elem().Type().Key().Kind() == reflect.String
+	case reflect.Struct:
+		return fields
+	case reflect.Slice:
+		return true
+	}
+	return false
+}
+
+// decodeStreamed decodes the value starting with the start token in v
+func decodeStreamed(dec *json.Decoder, start json.Token, v reflect.Value) error {
+	if start == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Slice {
+		if start != json.Delim('[') {
+			return fmt.Errorf("cannot unmarshal %v into a value of type %s", start, v.Type())
+		}
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		for dec.More() {
+			item := reflect.New(v.Type().Elem())
+			if err := dec.Decode(item.Interface()); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, item.Elem()))
+		}
+		return expectDelim(dec, ']')
+	}
+
+	if start != json.Delim('{') {
+		return fmt.Errorf("cannot unmarshal %v into a value of type %s", start, v.Type())
+	}
+	if v.Kind() == reflect.Map && v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := token.(string)
+
+		var field reflect.Value
+		if v.Kind() == reflect.Map {
+			field = reflect.New(v.Type().Elem()).Elem()
+		} else if field = structField(v, key); !field.IsValid() {
+			if err := dec.Decode(&json.RawMessage{}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if streamable(field.Addr(), false) {
+			var start json.Token
+			if start, err = dec.Token(); err == nil {
+				err = decodeStreamed(dec, start, field)
+			}
+		} else {
+			err = dec.Decode(field.Addr().Interface())
+		}
+		if err != nil {
+			return err
+		}
+
+		if v.Kind() == reflect.Map {
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), field)
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// structField returns the exported field of the struct with the JSON name, or
+// an invalid value. Like encoding/json, the name is matched case
+// insensitively if no field has this exact name.
+func structField(v reflect.Value, name string) reflect.Value {
+	var match reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fieldName := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			fieldName = tag
+		}
+		if fieldName == name {
+			return v.Field(i)
+		}
+		if !match.IsValid() && strings.EqualFold(fieldName, name) {
+			match = v.Field(i)
+		}
+	}
+	return match
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("invalid character %v, expected %v", token, delim)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package bramble
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestDecodeResponse(t *testing.T) {
+	responses := []string{
+		`{ "data": { "_0": { "_id": "1", "title": "Alien" }, "_1": null }, "extensions": { "cost": 2 } }`,
+		`{ "data": { "_result": [{ "_id": "1", "tags": ["a"] }, null, {}] }, "other": [1, { "a": 2 }] }`,
+		`{ "data": { "_RESULT": [{ "_id": "1" }], "_result": [] } }`,
+		`{ "data": { "movie": { "title": "Alien" } }, "errors": [{ "message": "failed", "path": ["movie", 0] }] }`,
+		`{ "errors": [{ "message": "failed" }], "data": null }`,
+		`{ "data": { "_result": null, "count": 1 } }`,
+		`null`,
+	}
+	targets := []func() interface{}{
+		func() interface{} { return &map[string]map[string]interface{}{} },
+		func() interface{} { return &map[string]map[string]json.RawMessage{} },
+		func() interface{} { return &map[string]interface{}{} },
+		func() interface{} {
+			return &struct {
+				Result []map[string]interface{} `json:"_result"`
+			}{}
+		},
+		func() interface{} {
+			return &struct {
+				Result []map[string]json.RawMessage `json:"_result"`
+				Count  int
+			}{}
+		},
+		func() interface{} { var v interface{}; return &v },
+	}
+
+	for _, response := range responses {
+		for _, target := range targets {
+			expected := Response{Data: target()}
+			expectedErr := json.Unmarshal([]byte(response), &expected)
+			actual := Response{Data: target()}
+			err := decodeResponse(json.NewDecoder(strings.NewReader(response)), &actual)
+			if expectedErr != nil {
+				assert.Error(t, err, response)
+				continue
+			}
+			require.NoError(t, err, response)
+			assert.Equal(t, expected, actual, "%s into %T", response, expected.Data)
+		}
+	}
+
+	for _, response := range []string{``, `{ "data": {`, `{ "data": { "_result": [{}, `, `[]`, `{ "data": { "_result": {} } }`} {
+		var data struct {
+			Result []map[string]interface{} `json:"_result"`
+		}
+		assert.Error(t, decodeResponse(json.NewDecoder(strings.NewReader(response)), &Response{Data: &data}), response)
+	}
+}
+
+func BenchmarkBoundaryEntities(b *testing.B) {
+	const count = 10000
+	description := strings.Repeat("lorem ipsum ", 20)
+
+	var movies []string
+	for i := 0; i < count; i++ {
+		movies = append(movies, fmt.Sprintf(`{ "id": "%d", "title": "Movie %d" }`, i, i))
+	}
+	moviesResponse := []byte(`{ "data": { "movies": [` + strings.Join(movies, ",") + `] } }`)
+
+	var results, nodes []string
+	for i := 0; i < count; i++ {
+		details := fmt.Sprintf(`"description": %q, "release": %d, "tags": ["a", "b", "c"]`, description, 2000+i%20)
+		results = append(results, fmt.Sprintf(`{ "_id": "%d", %s }`, i, details))
+		nodes = append(nodes, fmt.Sprintf(`"_%d": { "_id": "%d", %s }`, i, i, details))
+	}
+	responses := map[string][]byte{
+		"array": []byte(`{ "data": { "_result": [` + strings.Join(results, ",") + `] } }`),
+		"nodes": []byte(`{ "data": { ` + strings.Join(nodes, ",") + ` } }`),
+	}
+	boundaryQueries := map[string]string{
+		"array": `_movies(ids: [ID!]!): [Movie]! @boundary`,
+		"nodes": `movie(id: ID!): Movie @boundary`,
+	}
+
+	for _, mode := range []string{"array", "nodes"} {
+		schemas := []string{
+			`directive @boundary on OBJECT | FIELD_DEFINITION
+			type Movie @boundary {
+				id: ID!
+				title: String
+			}
+			type Query {
+				movies: [Movie!]!
+			}`,
+			`directive @boundary on OBJECT | FIELD_DEFINITION
+			type Movie @boundary {
+				id: ID!
+				description: String
+				release: Int
+				tags: [String!]
+			}
+			type Query {
+				` + boundaryQueries[mode] + `
+			}`,
+		}
+
+		var services []*Service
+		var astSchemas []*ast.Schema
+		for i, s := range schemas {
+			response := moviesResponse
+			if i == 1 {
+				response = responses[mode]
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(response)
+			}))
+			defer server.Close()
+			schema := gqlparser.MustLoadSchema(&ast.Source{Input: s})
+			services = append(services, &Service{ServiceURL: server.URL, Schema: schema})
+			astSchemas = append(astSchemas, schema)
+		}
+
+		merged, err := MergeSchemas(astSchemas...)
+		require.NoError(b, err)
+		query := gqlparser.MustLoadQuery(merged, `{ movies { title description release tags } }`)
+
+		for _, rawJSON := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/raw=%t", mode, rawJSON), func(b *testing.B) {
+				es := newExecutableSchema(nil, 50, NewClient(WithMaxResponseSize(100*1024*1024)), services...)
+				es.MergedSchema = merged
+				es.BoundaryQueries = buildBoundaryQueriesMap(services...)
+				es.Locations = buildFieldURLMap(services...)
+				es.IsBoundary = buildIsBoundaryMap(services...)
+				es.PublicSchema = buildPublicSchema(merged)
+				es.RawJSONMerge = rawJSON
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				peak := measurePeakHeap(func() {
+					for i := 0; i < b.N; i++ {
+						resp := es.ExecuteQuery(testContextWithVariables(map[string]interface{}{}, query.Operations[0]))
+						if len(resp.Errors) > 0 {
+							b.Fatal(resp.Errors)
+						}
+					}
+				})
+				b.ReportMetric(float64(peak)/(1024*1024), "peak-heap-MB")
+			})
+		}
+	}
+}
+
+// measurePeakHeap returns the peak heap growth while f runs, sampled every
+// millisecond
+func measurePeakHeap(f func()) uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	base := stats.HeapAlloc
+
+	var peak uint64
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		var stats runtime.MemStats
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > base && stats.HeapAlloc-base > atomic.LoadUint64(&peak) {
+				atomic.StoreUint64(&peak, stats.HeapAlloc-base)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	f()
+	close(done)
+	<-stopped
+	return atomic.LoadUint64(&peak)
+}
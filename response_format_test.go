@@ -0,0 +1,207 @@
+package bramble
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestAppendJSONScalar(t *testing.T) {
+	matchesEncodingJSON := func(v interface{}) bool {
+		b, ok := appendJSONScalar(nil, v)
+		if !ok {
+			return true
+		}
+		expected, err := json.Marshal(v)
+		return err == nil && string(expected) == string(b)
+	}
+
+	for _, f := range []interface{}{
+		func(v float64) bool { return matchesEncodingJSON(v) },
+		func(v float64, exp int8) bool { return matchesEncodingJSON(v * math.Pow10(int(exp)%30)) },
+		func(v string) bool { return matchesEncodingJSON(v) },
+		func(v int64) bool { return matchesEncodingJSON(v) },
+		func(v int) bool { return matchesEncodingJSON(v) },
+		func(v bool) bool { return matchesEncodingJSON(v) },
+	} {
+		require.NoError(t, quick.Check(f, &quick.Config{MaxCount: 2000}))
+	}
+
+	for _, v := range []interface{}{
+		nil, 0.0, math.Copysign(0, -1), 1e21, 1e20, 1e-6, 1e-7, -1.5e-9, math.MaxFloat64, math.SmallestNonzeroFloat64,
+		"", "plain", `"quoted"`, `back\slash`, "<html>&", "tab\t", "é", " ", "\xff",
+	} {
+		assert.True(t, matchesEncodingJSON(v), "%#v", v)
+	}
+
+	for _, v := range []interface{}{math.NaN(), math.Inf(1), json.Number("1"), "é", map[string]interface{}{}} {
+		_, ok := appendJSONScalar(nil, v)
+		assert.False(t, ok, "%#v", v)
+	}
+}
+
+func TestMarshalResultSelectionOrder(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+	type Item {
+		string: String
+		float: Float
+		int: Int
+		boolean: Boolean
+		child: Item
+		children: [Item]
+	}
+
+	type Query {
+		item: Item
+	}
+	`})
+	queryType := &ast.Type{NamedType: "Query"}
+
+	for seed := int64(0); seed < 500; seed++ {
+		rnd := rand.New(rand.NewSource(seed))
+		query := gqlparser.MustLoadQuery(schema, "{ item { "+randomItemSelection(rnd, 0)+" } }")
+		selectionSet := query.Operations[0].SelectionSet
+		item := selectionSetToFields(selectionSet)[0]
+		data := map[string]interface{}{item.Alias: randomOrderedResult(rnd, item.SelectionSet)}
+
+		res, err := marshalResult(data, selectionSet, schema, queryType)
+		require.NoError(t, err, "seed %d", seed)
+
+		// the fields are in the order of the selection set and the values
+		// are encoded like encoding/json does
+		var expected bytes.Buffer
+		writeOrderedJSON(t, &expected, data, selectionSet)
+		require.Equal(t, expected.String(), string(res), "seed %d", seed)
+
+		// the result round-trips through encoding/json
+		var decoded interface{}
+		require.NoError(t, json.Unmarshal(res, &decoded), "seed %d", seed)
+		roundTrip, err := json.Marshal(data)
+		require.NoError(t, err)
+		require.JSONEq(t, string(roundTrip), string(res), "seed %d", seed)
+	}
+}
+
+// randomItemSelection returns a random selection of the Item fields, in a
+// random order and with random aliases
+func randomItemSelection(rnd *rand.Rand, depth int) string {
+	fields := []string{"string", "float", "int", "boolean"}
+	if depth < 2 {
+		fields = append(fields, "child", "children")
+	}
+	var selection []string
+	for i, n := range rnd.Perm(len(fields))[:1+rnd.Intn(len(fields))] {
+		field := fields[n]
+		if rnd.Intn(3) == 0 {
+			field = fmt.Sprintf("a%d: %s", i, field)
+		}
+		if strings.HasSuffix(field, "child") || strings.HasSuffix(field, "children") {
+			field += " { " + randomItemSelection(rnd, depth+1) + " }"
+		}
+		selection = append(selection, field)
+	}
+	return strings.Join(selection, " ")
+}
+
+var randomRunes = []rune("ab <>&\"\\\n\t\x01é 😀")
+
+func randomOrderedResult(rnd *rand.Rand, selectionSet ast.SelectionSet) map[string]interface{} {
+	obj := map[string]interface{}{}
+	for _, f := range selectionSetToFields(selectionSet) {
+		if rnd.Intn(10) == 0 {
+			obj[f.Alias] = nil
+			continue
+		}
+		switch f.Name {
+		case "string":
+			runes := make([]rune, rnd.Intn(8))
+			for i := range runes {
+				runes[i] = randomRunes[rnd.Intn(len(randomRunes))]
+			}
+			obj[f.Alias] = string(runes)
+		case "float":
+			obj[f.Alias] = rnd.NormFloat64() * math.Pow10(rnd.Intn(50)-25)
+		case "int":
+			obj[f.Alias] = float64(rnd.Intn(2000) - 1000)
+		case "boolean":
+			obj[f.Alias] = rnd.Intn(2) == 0
+		case "child":
+			obj[f.Alias] = randomOrderedResult(rnd, f.SelectionSet)
+		case "children":
+			children := make([]interface{}, rnd.Intn(3))
+			for i := range children {
+				children[i] = randomOrderedResult(rnd, f.SelectionSet)
+			}
+			obj[f.Alias] = children
+		}
+	}
+	return obj
+}
+
+// writeOrderedJSON writes the result with the fields in the selection set
+// order, encoding the values with encoding/json
+func writeOrderedJSON(t *testing.T, buf *bytes.Buffer, data interface{}, selectionSet ast.SelectionSet) {
+	switch data := data.(type) {
+	case map[string]interface{}:
+		buf.WriteString("{")
+		for i, f := range selectionSetToFields(selectionSet) {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			fmt.Fprintf(buf, "%q:", f.Alias)
+			writeOrderedJSON(t, buf, data[f.Alias], f.SelectionSet)
+		}
+		buf.WriteString("}")
+	case []interface{}:
+		buf.WriteString("[")
+		for i, elem := range data {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			writeOrderedJSON(t, buf, elem, selectionSet)
+		}
+		buf.WriteString("]")
+	default:
+		b, err := json.Marshal(data)
+		require.NoError(t, err)
+		buf.Write(b)
+	}
+}
+
+func TestDebugPrettyResponse(t *testing.T) {
+	handler := debugMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"data":{"b":1,`))
+		w.Write([]byte(`"a":[true]}}`))
+	}))
+
+	t.Run("pretty", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		req.Header.Set(debugHeader, "timing pretty")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Equal(t, "{\n  \"data\": {\n    \"b\": 1,\n    \"a\": [\n      true\n    ]\n  }\n}\n", rec.Body.String())
+	})
+
+	t.Run("compact", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		req.Header.Set(debugHeader, "all")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, `{"data":{"b":1,"a":[true]}}`, rec.Body.String())
+	})
+}
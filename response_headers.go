@@ -0,0 +1,182 @@
+package bramble
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Response header merge strategies, used when multiple services return the
+// same header
+const (
+	// MergeAppend keeps all the distinct values
+	MergeAppend = "append"
+	// MergeFirst keeps the value of the first service, services are ordered
+	// as listed in the rule (or by URL if the rule doesn't list services)
+	MergeFirst = "first"
+	// MergeMin keeps the lowest numeric value (e.g. rate limit remaining)
+	MergeMin = "min"
+	// MergeMax keeps the highest numeric value
+	MergeMax = "max"
+)
+
+// ResponseHeaderRule describes a downstream response header that should be
+// passed through to the gateway response.
+type ResponseHeaderRule struct {
+	// Header name
+	Header string `json:"header"`
+	// Names or URLs of the services the header is accepted from, all
+	// services if empty
+	Services []string `json:"services"`
+	// Merge strategy (append, first, min or max), defaults to append
+	Merge string `json:"merge"`
+}
+
+// DownstreamResponse contains the headers returned by a downstream service
+type DownstreamResponse struct {
+	ServiceURL string
+	Header     http.Header
+}
+
+// DownstreamResponseHeaders collects the response headers of the downstream
+// requests made while executing a query. It is safe for concurrent use.
+type DownstreamResponseHeaders struct {
+	mu        sync.Mutex
+	responses []DownstreamResponse
+}
+
+// AddDownstreamResponseHeadersToContext adds a downstream response headers
+// collector to the context. The GraphQL client records the headers of every
+// response in the collector.
+func AddDownstreamResponseHeadersToContext(ctx context.Context) (context.Context, *DownstreamResponseHeaders) {
+	d := &DownstreamResponseHeaders{}
+	return context.WithValue(ctx, responseHeadersContextKey, d), d
+}
+
+// GetDownstreamResponseHeadersFromContext returns the downstream response
+// headers collector stored in the context, or nil
+func GetDownstreamResponseHeadersFromContext(ctx context.Context) *DownstreamResponseHeaders {
+	d, _ := ctx.Value(responseHeadersContextKey).(*DownstreamResponseHeaders)
+	return d
+}
+
+func (d *DownstreamResponseHeaders) add(serviceURL string, header http.Header) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.responses = append(d.responses, DownstreamResponse{
+		ServiceURL: serviceURL,
+		Header:     header.Clone(),
+	})
+}
+
+// Responses returns the collected responses, ordered by service URL
+func (d *DownstreamResponseHeaders) Responses() []DownstreamResponse {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	res := make([]DownstreamResponse, len(d.responses))
+	copy(res, d.responses)
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].ServiceURL < res[j].ServiceURL
+	})
+	return res
+}
+
+// MergeResponseHeaders applies the rules to the downstream responses and
+// returns the headers to set on the gateway response. serviceName is used to
+// match the rule services by name, it can be nil.
+func MergeResponseHeaders(rules []ResponseHeaderRule, responses []DownstreamResponse, serviceName func(url string) string) http.Header {
+	result := make(http.Header)
+	for _, rule := range rules {
+		var values [][]string
+		for _, service := range ruleServiceOrder(rule, responses, serviceName) {
+			for _, res := range responses {
+				if res.ServiceURL != service {
+					continue
+				}
+				if v := res.Header.Values(rule.Header); len(v) > 0 {
+					values = append(values, v)
+				}
+			}
+		}
+		for _, v := range mergeHeaderValues(rule.Merge, values) {
+			result.Add(rule.Header, v)
+		}
+	}
+	return result
+}
+
+// ruleServiceOrder returns the URLs of the services the rule accepts headers
+// from, in order of priority
+func ruleServiceOrder(rule ResponseHeaderRule, responses []DownstreamResponse, serviceName func(url string) string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	addURL := func(url string) {
+		if !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+
+	if len(rule.Services) == 0 {
+		for _, res := range responses {
+			addURL(res.ServiceURL)
+		}
+		return urls
+	}
+
+	for _, service := range rule.Services {
+		for _, res := range responses {
+			if res.ServiceURL == service || (serviceName != nil && serviceName(res.ServiceURL) == service) {
+				addURL(res.ServiceURL)
+			}
+		}
+	}
+	return urls
+}
+
+func mergeHeaderValues(strategy string, values [][]string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	strategy = strings.ToLower(strategy)
+	switch strategy {
+	case MergeFirst:
+		return values[0]
+	case MergeMin, MergeMax:
+		var result string
+		var resultNumber float64
+		for _, vs := range values {
+			for _, v := range vs {
+				n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil {
+					continue
+				}
+				if result == "" ||
+					(strategy == MergeMin && n < resultNumber) ||
+					(strategy == MergeMax && n > resultNumber) {
+					result, resultNumber = v, n
+				}
+			}
+		}
+		if result == "" {
+			return nil
+		}
+		return []string{result}
+	default:
+		var result []string
+		seen := map[string]bool{}
+		for _, vs := range values {
+			for _, v := range vs {
+				if !seen[v] {
+					seen[v] = true
+					result = append(result, v)
+				}
+			}
+		}
+		return result
+	}
+}
@@ -0,0 +1,89 @@
+package bramble
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeResponseHeaders(t *testing.T) {
+	responses := []DownstreamResponse{
+		{ServiceURL: "http://auth", Header: http.Header{
+			"Set-Cookie":            []string{"session=abc"},
+			"X-Ratelimit-Remaining": []string{"20"},
+		}},
+		{ServiceURL: "http://movies", Header: http.Header{
+			"Set-Cookie":            []string{"tracking=1"},
+			"X-Ratelimit-Remaining": []string{"5"},
+			"X-Cache":               []string{"MISS"},
+		}},
+		{ServiceURL: "http://movies", Header: http.Header{
+			"X-Ratelimit-Remaining": []string{"4"},
+			"X-Cache":               []string{"HIT"},
+		}},
+	}
+	serviceName := func(url string) string {
+		return url[len("http://"):]
+	}
+
+	t.Run("append", func(t *testing.T) {
+		header := MergeResponseHeaders([]ResponseHeaderRule{
+			{Header: "X-Cache"},
+		}, responses, serviceName)
+		assert.Equal(t, http.Header{"X-Cache": []string{"MISS", "HIT"}}, header)
+	})
+
+	t.Run("filters services by name", func(t *testing.T) {
+		header := MergeResponseHeaders([]ResponseHeaderRule{
+			{Header: "Set-Cookie", Services: []string{"auth"}},
+		}, responses, serviceName)
+		assert.Equal(t, http.Header{"Set-Cookie": []string{"session=abc"}}, header)
+	})
+
+	t.Run("first", func(t *testing.T) {
+		header := MergeResponseHeaders([]ResponseHeaderRule{
+			{Header: "Set-Cookie", Services: []string{"movies", "http://auth"}, Merge: "first"},
+		}, responses, serviceName)
+		assert.Equal(t, http.Header{"Set-Cookie": []string{"tracking=1"}}, header)
+	})
+
+	t.Run("min and max", func(t *testing.T) {
+		header := MergeResponseHeaders([]ResponseHeaderRule{
+			{Header: "X-RateLimit-Remaining", Merge: "min"},
+		}, responses, serviceName)
+		assert.Equal(t, http.Header{"X-Ratelimit-Remaining": []string{"4"}}, header)
+
+		header = MergeResponseHeaders([]ResponseHeaderRule{
+			{Header: "X-RateLimit-Remaining", Merge: "max"},
+		}, responses, serviceName)
+		assert.Equal(t, http.Header{"X-Ratelimit-Remaining": []string{"20"}}, header)
+	})
+
+	t.Run("missing header", func(t *testing.T) {
+		header := MergeResponseHeaders([]ResponseHeaderRule{
+			{Header: "X-Missing"},
+		}, responses, serviceName)
+		assert.Empty(t, header)
+	})
+}
+
+func TestClientCollectsResponseHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Cache", "HIT")
+		_, _ = w.Write([]byte(`{"data": {"root": "value"}}`))
+	}))
+	defer server.Close()
+
+	ctx, downstream := AddDownstreamResponseHeadersToContext(context.Background())
+	var res interface{}
+	require.NoError(t, NewClient().Request(ctx, server.URL, &Request{Query: "{ root }"}, &res))
+
+	responses := downstream.Responses()
+	require.Len(t, responses, 1)
+	assert.Equal(t, server.URL, responses[0].ServiceURL)
+	assert.Equal(t, "HIT", responses[0].Header.Get("X-Cache"))
+}
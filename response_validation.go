@@ -0,0 +1,144 @@
+package bramble
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// invalidResponseCode is the error code of the values of the services that
+// don't match their type in strict mode
+const invalidResponseCode = "INVALID_RESPONSE"
+
+// resultValidation validates the result against the merged schema before it
+// is marshalled (strict mode). The locations of the fields are used to name
+// the service that returned an invalid value.
+type resultValidation struct {
+	locations FieldURLMap
+	services  map[string]*Service
+}
+
+// fieldCoordinate identifies a field of the merged schema
+type fieldCoordinate struct {
+	typename string
+	field    string
+}
+
+// service returns the name and URL of the service resolving the field, or
+// empty strings if it's unknown
+func (v *resultValidation) service(field fieldCoordinate) (string, string) {
+	url, ok := v.locations[v.locations.keyFor(field.typename, field.field)]
+	if !ok {
+		return "", ""
+	}
+	name := url
+	if s, ok := v.services[url]; ok && s.Name != "" {
+		name = s.Name
+	}
+	return name, url
+}
+
+// invalidValue writes null for the invalid value and records its error
+func (m *resultMarshaler) invalidValue(path ast.Path, err error) error {
+	m.buf.Write(nullValue)
+
+	coordinate := m.field.typename + "." + m.field.field
+	message := fmt.Sprintf("invalid value for field %s: %s", coordinate, err)
+	extensions := map[string]interface{}{"code": invalidResponseCode}
+	if name, url := m.validation.service(m.field); url != "" {
+		message = fmt.Sprintf("service %q returned an invalid value for field %s: %s", name, coordinate, err)
+		extensions["serviceName"] = name
+		extensions["serviceUrl"] = url
+	}
+	m.errs = append(m.errs, &gqlerror.Error{
+		Message:    message,
+		Path:       appendPath(path),
+		Extensions: extensions,
+	})
+	return nil
+}
+
+// validateLeafValue returns an error if the non-null value isn't a valid
+// value of the scalar or enum type. The values of custom scalars aren't
+// validated.
+func validateLeafValue(def *ast.Definition, value interface{}) error {
+	if def.Kind == ast.Enum {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected %s, got %s", def.Name, describeJSONValue(value))
+		}
+		if def.EnumValues.ForName(s) == nil {
+			return fmt.Errorf("%q is not a value of %s", s, def.Name)
+		}
+		return nil
+	}
+
+	valid := true
+	switch def.Name {
+	case "Int":
+		n, ok := jsonNumber(value)
+		if ok && n == math.Trunc(n) && (n < math.MinInt32 || n > math.MaxInt32) {
+			return errors.New("the integer is out of the Int range")
+		}
+		valid = ok && n == math.Trunc(n)
+	case "Float":
+		_, valid = jsonNumber(value)
+	case "String":
+		_, valid = value.(string)
+	case "Boolean":
+		_, valid = value.(bool)
+	case "ID":
+		if _, ok := value.(string); !ok {
+			n, ok := jsonNumber(value)
+			valid = ok && n == math.Trunc(n)
+		}
+	}
+	if !valid {
+		return fmt.Errorf("expected %s, got %s", def.Name, describeJSONValue(value))
+	}
+	return nil
+}
+
+// jsonNumber returns the value of a decoded JSON number
+func jsonNumber(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case float64:
+		return value, true
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case json.Number:
+		n, err := value.Float64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// describeJSONValue returns the kind of a decoded JSON value for the error
+// messages, the values themselves aren't reported
+func describeJSONValue(value interface{}) string {
+	if n, ok := jsonNumber(value); ok {
+		if n == math.Trunc(n) {
+			return "an integer"
+		}
+		return "a number"
+	}
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "a list"
+	}
+	return fmt.Sprintf("a %T", value)
+}
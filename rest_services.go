@@ -0,0 +1,581 @@
+package bramble
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+// RESTServiceConfig describes a REST API federated as a virtual GraphQL
+// service. The schema of the service is part of the configuration, and every
+// Query and Mutation field is resolved by a REST operation.
+type RESTServiceConfig struct {
+	// URL is the base URL of the REST API
+	URL string `json:"url"`
+	// Version is the version of the service reported to the gateway
+	Version string `json:"version"`
+	// Schema is the schema of the virtual service. The Service type and the
+	// service query are added to it.
+	Schema string `json:"schema"`
+	// Fields are the REST operations resolving the Query and Mutation
+	// fields, by "Type.field"
+	Fields map[string]RESTOperation `json:"fields"`
+	// Paths are the JSON paths (e.g. "$.details.name") of the object fields
+	// in the REST responses, by "Type.field". The fields without a path are
+	// the properties of the same name.
+	Paths map[string]string `json:"paths"`
+}
+
+// RESTOperation is the REST operation resolving a field
+type RESTOperation struct {
+	// Method is the HTTP method of the operation, GET by default
+	Method string `json:"method"`
+	// Path is the path of the operation, relative to the URL of the API.
+	// The "{argument}" placeholders are replaced with the field arguments,
+	// the other arguments are sent as query parameters (GET and DELETE) or
+	// as a JSON object body.
+	Path string `json:"path"`
+	// Result is the JSON path of the field value in the response, the whole
+	// response if empty
+	Result string `json:"result"`
+}
+
+// restServiceSchema is added to the schema of the REST services, and of the
+// services whose schema is fetched from a ServiceSchemaConfig source
+const restServiceSchema = `
+type Service {
+	name: String!
+	version: String!
+	schema: String!
+}
+
+extend type Query {
+	service: Service!
+}
+`
+
+var restPathParameter = regexp.MustCompile(`{(\w+)}`)
+
+// restIgnoredHeaders are the headers of the requests to the virtual service
+// that aren't forwarded to the REST API
+var restIgnoredHeaders = map[string]bool{
+	"Accept":          true,
+	"Accept-Encoding": true,
+	"Content-Length":  true,
+	"Content-Type":    true,
+	timeoutHeader:     true,
+}
+
+// restServiceURL returns the URL of the virtual service of a REST API
+func restServiceURL(name string) string {
+	return localServiceScheme + name
+}
+
+// restService is the GraphQL handler of a REST API virtual service
+type restService struct {
+	name    string
+	version string
+	url     string
+	schema  *ast.Schema
+	sdl     string
+	fields  map[string]RESTOperation
+	results map[string]jsonPath
+	paths   map[string]jsonPath
+	client  *http.Client
+	// maxResponseSize is the max size of the REST responses, they're not
+	// limited if it's 0
+	maxResponseSize int64
+}
+
+func newRESTService(name string, config RESTServiceConfig, transport http.RoundTripper, maxResponseSize int64) (*restService, error) {
+	if config.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	schema, gqlErr := gqlparser.LoadSchema(&ast.Source{Name: name, Input: config.Schema + restServiceSchema})
+	if gqlErr != nil {
+		return nil, fmt.Errorf("invalid schema: %w", gqlErr)
+	}
+	if schema.Subscription != nil {
+		return nil, errors.New("subscriptions are not supported")
+	}
+
+	s := &restService{
+		name:    name,
+		version: config.Version,
+		url:     strings.TrimSuffix(config.URL, "/"),
+		schema:  schema,
+		sdl:     formatSchema(schema),
+		fields:  config.Fields,
+		results: make(map[string]jsonPath, len(config.Fields)),
+		paths:   make(map[string]jsonPath, len(config.Paths)),
+		client:  &http.Client{Transport: transport},
+
+		maxResponseSize: maxResponseSize,
+	}
+
+	for _, root := range []*ast.Definition{schema.Query, schema.Mutation} {
+		if root == nil {
+			continue
+		}
+		for _, f := range root.Fields {
+			if strings.HasPrefix(f.Name, "__") || (root == schema.Query && f.Name == serviceRootFieldName) {
+				continue
+			}
+			if _, ok := config.Fields[root.Name+"."+f.Name]; !ok {
+				return nil, fmt.Errorf("no REST operation for field %s.%s", root.Name, f.Name)
+			}
+		}
+	}
+	for key, operation := range config.Fields {
+		typename, field := splitTypeField(key)
+		if (typename != queryObjectName && typename != mutationObjectName) || schemaField(schema, typename, field) == nil {
+			return nil, fmt.Errorf("REST operation for unknown field %q", key)
+		}
+		switch strings.ToUpper(operation.Method) {
+		case "", http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return nil, fmt.Errorf("invalid method %q for field %q", operation.Method, key)
+		}
+		result, err := parseJSONPath(operation.Result)
+		if err != nil {
+			return nil, fmt.Errorf("invalid result path for field %q: %w", key, err)
+		}
+		s.results[key] = result
+	}
+	for key, path := range config.Paths {
+		typename, field := splitTypeField(key)
+		if schemaField(schema, typename, field) == nil {
+			return nil, fmt.Errorf("path for unknown field %q", key)
+		}
+		p, err := parseJSONPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path for field %q: %w", key, err)
+		}
+		s.paths[key] = p
+	}
+
+	return s, nil
+}
+
+func splitTypeField(key string) (string, string) {
+	i := strings.Index(key, ".")
+	if i < 0 {
+		return key, ""
+	}
+	return key[:i], key[i+1:]
+}
+
+func schemaField(schema *ast.Schema, typename, field string) *ast.FieldDefinition {
+	def := schema.Types[typename]
+	if def == nil {
+		return nil
+	}
+	return def.Fields.ForName(field)
+}
+
+func (s *restService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var resp struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors gqlerror.List          `json:"errors,omitempty"`
+	}
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		resp.Errors = gqlerror.List{gqlerror.Errorf("invalid request: %s", err)}
+	} else {
+		resp.Data, resp.Errors = s.execute(r.Context(), r.Header, &req)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// restExecution is the execution of a GraphQL operation by a REST service
+type restExecution struct {
+	service   *restService
+	ctx       context.Context
+	header    http.Header
+	variables map[string]interface{}
+
+	mu   sync.Mutex
+	errs gqlerror.List
+}
+
+func (s *restService) execute(ctx context.Context, header http.Header, req *Request) (map[string]interface{}, gqlerror.List) {
+	doc, errs := gqlparser.LoadQuery(s.schema, req.Query)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	op := doc.Operations.ForName(req.OperationName)
+	if op == nil {
+		return nil, gqlerror.List{gqlerror.Errorf("operation %q not found", req.OperationName)}
+	}
+	variables, gqlErr := validator.VariableValues(s.schema, op, req.Variables)
+	if gqlErr != nil {
+		return nil, gqlerror.List{gqlErr}
+	}
+
+	e := &restExecution{service: s, ctx: ctx, header: header, variables: variables}
+	root := s.schema.Query
+	if op.Operation == ast.Mutation {
+		root = s.schema.Mutation
+	}
+	fields := s.collectFields(op.SelectionSet, root.Name)
+	values := make([]interface{}, len(fields))
+	if op.Operation == ast.Mutation {
+		// mutation fields are resolved serially
+		for i, f := range fields {
+			values[i] = e.resolveRootField(root, f)
+		}
+	} else {
+		var wg sync.WaitGroup
+		wg.Add(len(fields))
+		for i, f := range fields {
+			go func(i int, f *ast.Field) {
+				defer wg.Done()
+				values[i] = e.resolveRootField(root, f)
+			}(i, f)
+		}
+		wg.Wait()
+	}
+
+	data := make(map[string]interface{}, len(fields))
+	for i, f := range fields {
+		data[f.Alias] = values[i]
+	}
+	return data, e.errs
+}
+
+func (e *restExecution) addError(path ast.Path, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errs = append(e.errs, &gqlerror.Error{Message: err.Error(), Path: path})
+}
+
+// collectFields returns the fields of the selection set that apply to the
+// type, the fields selected several times under the same alias are merged
+func (s *restService) collectFields(selectionSet ast.SelectionSet, typename string) []*ast.Field {
+	var result []*ast.Field
+	byAlias := make(map[string]int)
+	for _, f := range selectionSetToFieldsWithTypeCondition(selectionSet, "") {
+		if f.typeCondition != "" && !s.typeConditionApplies(f.typeCondition, typename) {
+			continue
+		}
+		if i, ok := byAlias[f.field.Alias]; ok {
+			merged := *result[i]
+			merged.SelectionSet = append(append(ast.SelectionSet{}, merged.SelectionSet...), f.field.SelectionSet...)
+			result[i] = &merged
+			continue
+		}
+		byAlias[f.field.Alias] = len(result)
+		result = append(result, f.field)
+	}
+	return result
+}
+
+func (s *restService) typeConditionApplies(typeCondition, typename string) bool {
+	if typeCondition == typename {
+		return true
+	}
+	def := s.schema.Types[typeCondition]
+	if def == nil || !def.IsAbstractType() {
+		return false
+	}
+	return ast.DefinitionList(s.schema.GetPossibleTypes(def)).ForName(typename) != nil
+}
+
+func (e *restExecution) resolveRootField(root *ast.Definition, field *ast.Field) interface{} {
+	path := ast.Path{ast.PathName(field.Alias)}
+	if field.Name == "__typename" {
+		return root.Name
+	}
+	if root == e.service.schema.Query && field.Name == serviceRootFieldName {
+		service := map[string]interface{}{
+			"name":    e.service.name,
+			"version": e.service.version,
+			"schema":  e.service.sdl,
+		}
+		return e.complete(service, field.Definition.Type, field.SelectionSet, path)
+	}
+
+	key := root.Name + "." + field.Name
+	args := field.ArgumentMap(e.variables)
+	value, err := e.call(e.service.fields[key], args)
+	if err != nil {
+		e.addError(path, err)
+		return nil
+	}
+	value = e.service.results[key].extract(value)
+	if isBoundaryField(field.Definition) && field.Definition.Type.Elem != nil {
+		value = e.orderByIDs(field.Definition, args, value)
+	}
+	return e.complete(value, field.Definition.Type, field.SelectionSet, path)
+}
+
+// orderByIDs orders the results of an array boundary query like the IDs of
+// its argument, as the REST APIs can return the objects in any order. The
+// missing objects are null.
+func (e *restExecution) orderByIDs(field *ast.FieldDefinition, args map[string]interface{}, value interface{}) interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	argument := boundaryKeyArgument(field)
+	if argument == "" && len(field.Arguments) == 1 {
+		argument = field.Arguments[0].Name
+	}
+	ids, ok := args[argument].([]interface{})
+	if !ok {
+		return value
+	}
+
+	byID := make(map[string]interface{}, len(list))
+	for _, elem := range list {
+		id := e.service.fieldValue(field.Type.Name(), idFieldName, elem)
+		if id != nil {
+			byID[fmt.Sprint(id)] = elem
+		}
+	}
+	result := make([]interface{}, len(ids))
+	for i, id := range ids {
+		result[i] = byID[fmt.Sprint(id)]
+	}
+	return result
+}
+
+// fieldValue returns the value of the field of an object of the REST
+// response
+func (s *restService) fieldValue(typename, field string, value interface{}) interface{} {
+	if path, ok := s.paths[typename+"."+field]; ok {
+		return path.extract(value)
+	}
+	obj, _ := value.(map[string]interface{})
+	return obj[field]
+}
+
+// complete returns the value of the selection set for the value of the REST
+// response
+func (e *restExecution) complete(value interface{}, fieldType *ast.Type, selectionSet ast.SelectionSet, path ast.Path) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	if fieldType.Elem != nil {
+		list, ok := value.([]interface{})
+		if !ok {
+			e.addError(path, errors.New("expected a list in the REST response"))
+			return nil
+		}
+		result := make([]interface{}, len(list))
+		for i, elem := range list {
+			result[i] = e.complete(elem, fieldType.Elem, selectionSet, appendPath(path, ast.PathIndex(i)))
+		}
+		return result
+	}
+
+	def := e.service.schema.Types[fieldType.Name()]
+	if def.Kind == ast.Scalar || def.Kind == ast.Enum {
+		if number, ok := value.(json.Number); ok && def.Name == "ID" {
+			return number.String()
+		}
+		return value
+	}
+
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		e.addError(path, errors.New("expected an object in the REST response"))
+		return nil
+	}
+	typename := def.Name
+	if def.IsAbstractType() {
+		typename, _ = obj["__typename"].(string)
+		if typename == "" {
+			e.addError(path, fmt.Errorf("missing __typename of the abstract type %s in the REST response", def.Name))
+			return nil
+		}
+	}
+
+	result := make(map[string]interface{})
+	for _, f := range e.service.collectFields(selectionSet, typename) {
+		if f.Name == "__typename" {
+			result[f.Alias] = typename
+			continue
+		}
+		v := e.service.fieldValue(typename, f.Name, obj)
+		result[f.Alias] = e.complete(v, f.Definition.Type, f.SelectionSet, appendPath(path, ast.PathName(f.Alias)))
+	}
+	return result
+}
+
+// call sends the REST request of the operation and returns the decoded
+// response. A 404 response is a null value.
+func (e *restExecution) call(operation RESTOperation, args map[string]interface{}) (interface{}, error) {
+	method := strings.ToUpper(operation.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	remaining := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		remaining[name] = value
+	}
+	var pathErr error
+	path := restPathParameter.ReplaceAllStringFunc(operation.Path, func(m string) string {
+		name := m[1 : len(m)-1]
+		value := restParameterValue(remaining[name])
+		delete(remaining, name)
+		// the dot segments aren't escaped, they would reach another path of
+		// the service
+		if value == "." || value == ".." {
+			pathErr = fmt.Errorf("invalid value %q for path parameter %s", value, name)
+		}
+		return url.PathEscape(value)
+	})
+	if pathErr != nil {
+		return nil, pathErr
+	}
+
+	u := e.service.url + path
+	var body io.Reader
+	if method == http.MethodGet || method == http.MethodDelete {
+		query := make(url.Values)
+		for name, value := range remaining {
+			switch value := value.(type) {
+			case nil:
+			case []interface{}:
+				for _, elem := range value {
+					query.Add(name, restParameterValue(elem))
+				}
+			default:
+				query.Add(name, restParameterValue(value))
+			}
+		}
+		if len(query) > 0 {
+			separator := "?"
+			if strings.Contains(u, "?") {
+				separator = "&"
+			}
+			u += separator + query.Encode()
+		}
+	} else {
+		b, err := json.Marshal(remaining)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode request body: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(e.ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	for key, values := range e.header {
+		if !restIgnoredHeaders[key] {
+			req.Header[key] = values
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := e.service.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error during request: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusNoContent:
+		return nil, nil
+	case res.StatusCode >= 300:
+		return nil, fmt.Errorf("%s %s returned status %d", method, e.service.url+path, res.StatusCode)
+	}
+
+	maxResponseSize := e.service.maxResponseSize
+	if maxResponseSize == 0 {
+		maxResponseSize = math.MaxInt64
+	}
+	limitReader := io.LimitedReader{
+		R: res.Body,
+		N: maxResponseSize,
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(&limitReader)
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil && err != io.EOF {
+		// the decoding fails on a truncated response
+		if limitReader.N == 0 {
+			return nil, fmt.Errorf("response exceeded maximum size of %d bytes", maxResponseSize)
+		}
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	return value, nil
+}
+
+// restParameterValue formats an argument as a path or query parameter
+func restParameterValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(value)
+		return string(b)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// jsonPath is a path in a JSON value, e.g. "$.items[0].name" or
+// "items.0.name"
+type jsonPath []string
+
+func parseJSONPath(path string) (jsonPath, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, nil
+	}
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	result := jsonPath(strings.Split(path, "."))
+	for _, elem := range result {
+		if elem == "" {
+			return nil, fmt.Errorf("empty element in path %q", path)
+		}
+	}
+	return result, nil
+}
+
+// extract returns the value at the path, or nil if it doesn't exist
+func (p jsonPath) extract(value interface{}) interface{} {
+	for _, elem := range p {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[elem]
+		case []interface{}:
+			i, err := strconv.Atoi(elem)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			value = v[i]
+		default:
+			return nil
+		}
+	}
+	return value
+}
@@ -0,0 +1,273 @@
+package bramble
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+)
+
+const restTestSchema = `
+directive @boundary on OBJECT | FIELD_DEFINITION
+
+type Person @boundary {
+	id: ID!
+	name: String
+	city: String
+}
+
+input PersonInput {
+	name: String!
+}
+
+type Query {
+	person(id: ID!): Person
+	persons(ids: [ID!]): [Person]! @boundary
+	search(name: String, limit: Int): [Person!]!
+}
+
+type Mutation {
+	createPerson(team: String!, input: PersonInput!): Person!
+}
+`
+
+func newRESTTestAPI(t *testing.T) *httptest.Server {
+	persons := map[string]string{
+		"1": `{ "personId": 1, "fullName": "Christopher Nolan", "address": { "city": "London" } }`,
+		"2": `{ "personId": 2, "fullName": "Emma Thomas", "address": { "city": "London" } }`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/people":
+			var results []string
+			for _, id := range r.URL.Query()["ids"] {
+				if p, ok := persons[id]; ok {
+					// returned in reverse order
+					results = append([]string{p}, results...)
+				}
+			}
+			fmt.Fprintf(w, `{ "results": [%s] }`, strings.Join(results, ","))
+		case r.Method == http.MethodGet && r.URL.Path == "/people/search":
+			assert.Equal(t, "name=Emma", r.URL.RawQuery)
+			fmt.Fprintf(w, `{ "results": [%s] }`, persons["2"])
+		case r.Method == http.MethodGet && r.URL.Path == "/people/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/people/"):
+			assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+			p, ok := persons[strings.TrimPrefix(r.URL.Path, "/people/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(p))
+		case r.Method == http.MethodPost && r.URL.Path == "/teams/directors/people":
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.JSONEq(t, `{ "input": { "name": "Jonathan Nolan" } }`, string(body))
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			w.Write([]byte(`{ "personId": 3, "fullName": "Jonathan Nolan" }`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newRESTTestService(t *testing.T, url string) *restService {
+	return newRESTTestServiceWithMaxResponseSize(t, url, 0)
+}
+
+func newRESTTestServiceWithMaxResponseSize(t *testing.T, url string, maxResponseSize int64) *restService {
+	s, err := newRESTService("people", RESTServiceConfig{
+		URL:     url,
+		Version: "1.0",
+		Schema:  restTestSchema,
+		Fields: map[string]RESTOperation{
+			"Query.person":          {Path: "/people/{id}"},
+			"Query.persons":         {Path: "/people?fields=all", Result: "$.results"},
+			"Query.search":          {Path: "/people/search", Result: "results"},
+			"Mutation.createPerson": {Method: "post", Path: "/teams/{team}/people"},
+		},
+		Paths: map[string]string{
+			"Person.id":   "personId",
+			"Person.name": "$.fullName",
+			"Person.city": "address.city",
+		},
+	}, nil, maxResponseSize)
+	require.NoError(t, err)
+	return s
+}
+
+func restTestQuery(t *testing.T, s *restService, query string, variables map[string]interface{}) string {
+	body, _ := json.Marshal(Request{Query: query, Variables: variables})
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec.Body.String()
+}
+
+func TestRESTService(t *testing.T) {
+	s := newRESTTestService(t, newRESTTestAPI(t).URL)
+
+	t.Run("fields are extracted from the response", func(t *testing.T) {
+		resp := restTestQuery(t, s, `query Person($id: ID!) {
+			director: person(id: $id) { id name ... on Person { _typename: __typename city } }
+			unknown: person(id: "4") { id }
+			search(name: "Emma") { name }
+		}`, map[string]interface{}{"id": "1"})
+		assert.JSONEq(t, `{
+			"data": {
+				"director": { "id": "1", "name": "Christopher Nolan", "_typename": "Person", "city": "London" },
+				"unknown": null,
+				"search": [{ "name": "Emma Thomas" }]
+			}
+		}`, resp)
+	})
+
+	t.Run("array boundary queries are ordered like their ids", func(t *testing.T) {
+		resp := restTestQuery(t, s, `{ _result: persons(ids: ["1", "4", "2"]) { _id: id name } }`, nil)
+		assert.JSONEq(t, `{
+			"data": {
+				"_result": [
+					{ "_id": "1", "name": "Christopher Nolan" },
+					null,
+					{ "_id": "2", "name": "Emma Thomas" }
+				]
+			}
+		}`, resp)
+	})
+
+	t.Run("errors are reported on their field", func(t *testing.T) {
+		resp := restTestQuery(t, s, `{ broken: person(id: "broken") { id } person(id: "2") { name } }`, nil)
+		assert.JSONEq(t, fmt.Sprintf(`{
+			"data": { "broken": null, "person": { "name": "Emma Thomas" } },
+			"errors": [{ "message": "GET %s/people/broken returned status 500", "path": ["broken"] }]
+		}`, s.url), resp)
+	})
+
+	t.Run("mutation arguments are sent as body", func(t *testing.T) {
+		resp := restTestQuery(t, s, `mutation { createPerson(team: "directors", input: { name: "Jonathan Nolan" }) { id name } }`, nil)
+		assert.JSONEq(t, `{ "data": { "createPerson": { "id": "3", "name": "Jonathan Nolan" } } }`, resp)
+	})
+
+	t.Run("dot segments are rejected", func(t *testing.T) {
+		for _, id := range []string{".", ".."} {
+			resp := restTestQuery(t, s, `query Person($id: ID!) { person(id: $id) { id } }`, map[string]interface{}{"id": id})
+			assert.JSONEq(t, fmt.Sprintf(`{
+				"data": { "person": null },
+				"errors": [{ "message": "invalid value \"%s\" for path parameter id", "path": ["person"] }]
+			}`, id), resp)
+		}
+	})
+
+	t.Run("responses larger than the max size are rejected", func(t *testing.T) {
+		s := newRESTTestServiceWithMaxResponseSize(t, s.url, 10)
+		resp := restTestQuery(t, s, `{ person(id: "1") { id } }`, nil)
+		assert.JSONEq(t, `{
+			"data": { "person": null },
+			"errors": [{ "message": "response exceeded maximum size of 10 bytes", "path": ["person"] }]
+		}`, resp)
+	})
+
+	t.Run("invalid queries are rejected", func(t *testing.T) {
+		resp := restTestQuery(t, s, `{ person(id: "1") { unknown } }`, nil)
+		assert.Contains(t, resp, `Cannot query field \"unknown\" on type \"Person\".`)
+	})
+}
+
+func TestRESTServiceFederation(t *testing.T) {
+	api := newRESTTestAPI(t)
+	movies := newTestService(t, "movies", `directive @boundary on OBJECT | FIELD_DEFINITION
+	type Service { name: String! version: String! schema: String! }
+	type Person @boundary { id: ID! }
+	type Movie { title: String! director: Person! }
+	type Query { movie: Movie! person(id: ID!): Person @boundary service: Service! }`, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{ "data": { "movie": { "title": "Inception", "director": { "_id": "1" } } } }`))
+	})
+
+	url := restServiceURL("people")
+	transports := (*Transports)(nil).withHandlers(map[string]http.Handler{url: newRESTTestService(t, api.URL)})
+	es := newExecutableSchema(nil, 50, NewClient(WithTransports(transports)), NewService(movies.URL), NewService(url, WithTransports(transports)))
+	require.NoError(t, es.UpdateSchema(true))
+	assert.Equal(t, "people", es.Services[url].Name)
+
+	query := gqlparser.MustLoadQuery(es.MergedSchema, `{ movie { title director { name city } } }`)
+	ctx := testContextWithVariables(map[string]interface{}{}, query.Operations[0])
+	ctx = AddOutgoingRequestsHeaderToContext(ctx, "Authorization", "Bearer token")
+	resp := es.ExecuteQuery(ctx)
+	assert.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{ "movie": { "title": "Inception", "director": { "name": "Christopher Nolan", "city": "London" } } }`, string(resp.Data))
+}
+
+func TestRESTServiceConfig(t *testing.T) {
+	valid := RESTServiceConfig{
+		URL:    "http://people",
+		Schema: `type Person { id: ID! } type Query { person(id: ID!): Person }`,
+		Fields: map[string]RESTOperation{"Query.person": {Path: "/people/{id}"}},
+	}
+	_, err := newRESTService("people", valid, nil, 0)
+	require.NoError(t, err)
+
+	tests := map[string]func(c *RESTServiceConfig){
+		"url is required": func(c *RESTServiceConfig) {
+			c.URL = ""
+		},
+		"invalid schema": func(c *RESTServiceConfig) {
+			c.Schema = "type Query {"
+		},
+		"no REST operation for field Query.person": func(c *RESTServiceConfig) {
+			c.Fields = nil
+		},
+		`REST operation for unknown field "Query.movie"`: func(c *RESTServiceConfig) {
+			c.Fields = map[string]RESTOperation{"Query.person": {}, "Query.movie": {}}
+		},
+		`invalid method "FETCH"`: func(c *RESTServiceConfig) {
+			c.Fields = map[string]RESTOperation{"Query.person": {Method: "FETCH"}}
+		},
+		`path for unknown field "Person.name"`: func(c *RESTServiceConfig) {
+			c.Paths = map[string]string{"Person.name": "fullName"}
+		},
+		`invalid path for field "Person.id"`: func(c *RESTServiceConfig) {
+			c.Paths = map[string]string{"Person.id": "a..b"}
+		},
+	}
+	for message, update := range tests {
+		t.Run(message, func(t *testing.T) {
+			config := valid
+			update(&config)
+			_, err := newRESTService("people", config, nil, 0)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), message)
+		})
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	value := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "first"},
+		},
+	}
+	for _, path := range []string{"$.items[0].name", "items.0.name", "items[0].name"} {
+		p, err := parseJSONPath(path)
+		require.NoError(t, err)
+		assert.Equal(t, "first", p.extract(value), path)
+	}
+
+	p, err := parseJSONPath("$")
+	require.NoError(t, err)
+	assert.Equal(t, value, p.extract(value))
+
+	p, _ = parseJSONPath("items[1].name")
+	assert.Nil(t, p.extract(value))
+}
@@ -0,0 +1,117 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// EnableSafeMode puts the gateway in safe mode. In safe mode plugins are
+// disabled and the gateway only serves the merged schema (SDL and
+// introspection) and a health endpoint reporting the given errors.
+// Query execution is disabled, as the gateway can't guarantee it would be
+// correct (e.g. if an authentication plugin failed to initialize).
+func (g *Gateway) EnableSafeMode(errs []error) {
+	g.safeModeErrors = errs
+	promSafeMode.Set(1)
+}
+
+func (g *Gateway) safeModeEnabled() bool {
+	return len(g.safeModeErrors) > 0
+}
+
+func (g *Gateway) safeModeRouter() http.Handler {
+	mux := http.NewServeMux()
+
+	srv := NewGraphQLHandler(g.ExecutableSchema)
+	srv.AroundOperations(safeModeOperationMiddleware)
+
+	mux.Handle("/query", applyMiddleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if g.ExecutableSchema.Schema() == nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_ = json.NewEncoder(w).Encode(Response{Errors: GraphqlErrors{{Message: "gateway is running in safe mode: schema unavailable"}}})
+				return
+			}
+			srv.ServeHTTP(w, r)
+		}),
+		idempotencyKeyMiddleware,
+		debugMiddleware,
+		gatewayChainMiddleware(g.serviceName()),
+		compressionMiddleware(g.ExecutableSchema),
+	))
+	mux.HandleFunc("/schema", g.safeModeSchemaHandler)
+	mux.HandleFunc("/health", g.safeModeHealthHandler)
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", g.readyzHandler(false))
+	mux.HandleFunc("/schema.graphql", g.schemaSDLHandler)
+	mux.HandleFunc("/schema-metadata", g.schemaMetadataHandler)
+
+	return applyMiddleware(mux, monitoringMiddleware, requestIDMiddleware)
+}
+
+func (g *Gateway) safeModePrivateRouter() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/schema", g.safeModeSchemaHandler)
+	mux.HandleFunc("/health", g.safeModeHealthHandler)
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", g.readyzHandler(true))
+	return mux
+}
+
+// safeModeOperationMiddleware only lets introspection operations through
+func safeModeOperationMiddleware(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	op := graphql.GetOperationContext(ctx).Operation
+	for _, f := range selectionSetToFields(op.SelectionSet) {
+		switch f.Name {
+		case "__schema", "__type", "__typename":
+		default:
+			return graphql.OneShot(graphql.ErrorResponse(ctx, "gateway is running in safe mode: only introspection queries are allowed"))
+		}
+	}
+	return next(ctx)
+}
+
+func (g *Gateway) safeModeSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	schema := g.ExecutableSchema.Schema()
+	if schema == nil {
+		http.Error(w, "schema unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(formatSchema(schema)))
+}
+
+type safeModeServiceStatus struct {
+	Name       string `json:"name"`
+	ServiceURL string `json:"url"`
+	Status     string `json:"status"`
+}
+
+type safeModeHealth struct {
+	Status   string                  `json:"status"`
+	Errors   []string                `json:"errors"`
+	Services []safeModeServiceStatus `json:"services"`
+}
+
+func (g *Gateway) safeModeHealthHandler(w http.ResponseWriter, r *http.Request) {
+	health := safeModeHealth{
+		Status: "safe-mode",
+	}
+	for _, err := range g.safeModeErrors {
+		health.Errors = append(health.Errors, err.Error())
+	}
+	for _, s := range g.ExecutableSchema.ServiceList() {
+		health.Services = append(health.Services, safeModeServiceStatus{
+			Name:       s.Name,
+			ServiceURL: s.ServiceURL,
+			Status:     s.Status,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(health)
+}
@@ -0,0 +1,75 @@
+package bramble
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestSafeMode(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		type Query {
+			test: String
+		}`})
+	es := newExecutableSchema(nil, 50, nil, &Service{
+		ServiceURL: "http://test-service",
+		Name:       "test-service",
+		Status:     "OK",
+		Schema:     schema,
+	})
+	merged, err := MergeSchemas(schema)
+	require.NoError(t, err)
+	es.MergedSchema = merged
+	es.PublicSchema = merged
+	es.Locations = buildFieldURLMap(es.Services["http://test-service"])
+
+	gtw := NewGateway(es, nil)
+	gtw.EnableSafeMode([]error{errors.New(`error configuring plugin "auth-jwt": invalid key`)})
+	router := gtw.Router()
+
+	query := func(q string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(q))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("rejects queries", func(t *testing.T) {
+		rec := query(`{"query": "{ test }"}`)
+		assert.JSONEq(t, `{
+			"errors": [{"message": "gateway is running in safe mode: only introspection queries are allowed"}],
+			"data": null
+		}`, rec.Body.String())
+	})
+
+	t.Run("allows introspection queries", func(t *testing.T) {
+		rec := query(`{"query": "{ __schema { queryType { name } } }"}`)
+		assert.JSONEq(t, `{"data": {"__schema": {"queryType": {"name": "Query"}}}}`, rec.Body.String())
+	})
+
+	t.Run("serves the schema", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/schema", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Contains(t, rec.Body.String(), "test: String")
+	})
+
+	t.Run("reports status", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.JSONEq(t, `{
+			"status": "safe-mode",
+			"errors": ["error configuring plugin \"auth-jwt\": invalid key"],
+			"services": [{"name": "test-service", "url": "http://test-service", "status": "OK"}]
+		}`, rec.Body.String())
+	})
+}
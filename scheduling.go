@@ -0,0 +1,220 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// stepScheduler limits the number of concurrent requests of a query. Once the
+// limit is reached, the free request slots go to the waiting steps in order
+// of priority: the steps with the longest chain of dependent steps first (the
+// critical path of the plan), then the steps of the earliest wave (dependency
+// depth), then in order of arrival. A nil scheduler doesn't limit anything.
+type stepScheduler struct {
+	limit int
+	ranks map[*QueryPlanStep]stepRank
+	// record is set if the scheduling decisions are recorded for the debug
+	// output
+	record bool
+
+	mu        sync.Mutex
+	active    int
+	arrivals  int
+	waiting   []*scheduledRequest
+	decisions []ScheduleDecision
+}
+
+// stepRank is the position of a step in the plan
+type stepRank struct {
+	// wave is the dependency depth of the step, 0 for the root steps
+	wave int
+	// priority is the length of the longest chain of steps starting with
+	// the step
+	priority int
+}
+
+// scheduledRequest is a request waiting for a slot
+type scheduledRequest struct {
+	step     *QueryPlanStep
+	rank     stepRank
+	arrival  int
+	queuedAt time.Time
+	ready    chan struct{}
+}
+
+// ScheduleDecision is the scheduling of the request of a plan step
+type ScheduleDecision struct {
+	ServiceName    string   `json:"serviceName"`
+	ServiceURL     string   `json:"serviceUrl"`
+	InsertionPoint []string `json:"insertionPoint"`
+	// Wave is the dependency depth of the step, 0 for the root steps
+	Wave int `json:"wave"`
+	// Priority is the length of the longest chain of steps starting with
+	// the step, the steps with the highest priority are scheduled first
+	Priority int `json:"priority"`
+	// Order is the order the request was sent in
+	Order int `json:"order"`
+	// Queued is the time the request waited for a slot
+	Queued time.Duration `json:"-"`
+}
+
+// MarshalJSON marshals the queued time as a duration string
+func (d ScheduleDecision) MarshalJSON() ([]byte, error) {
+	type scheduleDecision ScheduleDecision
+	return json.Marshal(&struct {
+		scheduleDecision
+		Queued string `json:"queued"`
+	}{
+		scheduleDecision: scheduleDecision(d),
+		Queued:           d.Queued.Round(time.Millisecond).String(),
+	})
+}
+
+// newStepScheduler returns the scheduler of the plan's requests, or nil if the
+// requests are neither limited nor recorded. A limit of 0 doesn't limit the
+// requests.
+func newStepScheduler(limit int, plan *QueryPlan, record bool) *stepScheduler {
+	if limit <= 0 && !record {
+		return nil
+	}
+	s := &stepScheduler{
+		limit:  limit,
+		ranks:  make(map[*QueryPlanStep]stepRank),
+		record: record,
+	}
+	if plan != nil {
+		for _, step := range plan.RootSteps {
+			s.rankSteps(step, 0)
+		}
+	}
+	return s
+}
+
+// rankSteps ranks the step and the steps depending on it, and returns the
+// step's priority
+func (s *stepScheduler) rankSteps(step *QueryPlanStep, wave int) int {
+	priority := 0
+	for _, child := range step.Then {
+		if p := s.rankSteps(child, wave+1); p > priority {
+			priority = p
+		}
+	}
+	priority++
+	s.ranks[step] = stepRank{wave: wave, priority: priority}
+	return priority
+}
+
+// acquire waits for a request slot for the step, or until the context is done
+func (s *stepScheduler) acquire(ctx context.Context, step *QueryPlanStep) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	r := &scheduledRequest{
+		step:     step,
+		rank:     s.ranks[step],
+		arrival:  s.arrivals,
+		queuedAt: time.Now(),
+		ready:    make(chan struct{}),
+	}
+	s.arrivals++
+	if s.limit <= 0 || s.active < s.limit {
+		s.active++
+		s.recordDecision(r)
+		s.mu.Unlock()
+		return nil
+	}
+	s.waiting = append(s.waiting, r)
+	s.mu.Unlock()
+
+	select {
+	case <-r.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-r.ready:
+			// the slot was given to the request in the meantime
+			s.releaseLocked()
+		default:
+			for i, w := range s.waiting {
+				if w == r {
+					s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+					break
+				}
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+// release releases a slot acquired with acquire, and gives it to the waiting
+// request with the highest priority
+func (s *stepScheduler) release() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked()
+}
+
+func (s *stepScheduler) releaseLocked() {
+	s.active--
+	if len(s.waiting) == 0 {
+		return
+	}
+	next := 0
+	for i, r := range s.waiting[1:] {
+		if r.before(s.waiting[next]) {
+			next = i + 1
+		}
+	}
+	r := s.waiting[next]
+	s.waiting = append(s.waiting[:next], s.waiting[next+1:]...)
+	s.active++
+	s.recordDecision(r)
+	close(r.ready)
+}
+
+// before returns whether the request is scheduled before the other one
+func (r *scheduledRequest) before(other *scheduledRequest) bool {
+	if r.rank.priority != other.rank.priority {
+		return r.rank.priority > other.rank.priority
+	}
+	if r.rank.wave != other.rank.wave {
+		return r.rank.wave < other.rank.wave
+	}
+	return r.arrival < other.arrival
+}
+
+// recordDecision records the request being sent. The mutex must be held.
+func (s *stepScheduler) recordDecision(r *scheduledRequest) {
+	if !s.record {
+		return
+	}
+	s.decisions = append(s.decisions, ScheduleDecision{
+		ServiceName:    r.step.ServiceName,
+		ServiceURL:     r.step.ServiceURL,
+		InsertionPoint: r.step.InsertionPoint,
+		Wave:           r.rank.wave,
+		Priority:       r.rank.priority,
+		Order:          len(s.decisions),
+		Queued:         time.Since(r.queuedAt),
+	})
+}
+
+// scheduleDecisions returns the recorded scheduling decisions, in the order
+// the requests were sent
+func (s *stepScheduler) scheduleDecisions() []ScheduleDecision {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ScheduleDecision(nil), s.decisions...)
+}
@@ -0,0 +1,152 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStepSchedulerRanks(t *testing.T) {
+	deep := &QueryPlanStep{ServiceName: "deep"}
+	middle := &QueryPlanStep{ServiceName: "middle", Then: []*QueryPlanStep{deep}}
+	shallow := &QueryPlanStep{ServiceName: "shallow"}
+	root := &QueryPlanStep{ServiceName: "root", Then: []*QueryPlanStep{shallow, middle}}
+	other := &QueryPlanStep{ServiceName: "other"}
+
+	s := newStepScheduler(1, &QueryPlan{RootSteps: []*QueryPlanStep{root, other}}, false)
+	assert.Equal(t, map[*QueryPlanStep]stepRank{
+		root:    {wave: 0, priority: 3},
+		shallow: {wave: 1, priority: 1},
+		middle:  {wave: 1, priority: 2},
+		deep:    {wave: 2, priority: 1},
+		other:   {wave: 0, priority: 1},
+	}, s.ranks)
+
+	assert.Nil(t, newStepScheduler(0, &QueryPlan{}, false))
+}
+
+func TestStepSchedulerPriorities(t *testing.T) {
+	steps := map[string]*QueryPlanStep{}
+	ranks := map[*QueryPlanStep]stepRank{}
+	for name, rank := range map[string]stepRank{
+		"shallow":      {wave: 1, priority: 1},
+		"deep":         {wave: 1, priority: 3},
+		"late":         {wave: 2, priority: 1},
+		"also shallow": {wave: 1, priority: 1},
+	} {
+		steps[name] = &QueryPlanStep{ServiceName: name}
+		ranks[steps[name]] = rank
+	}
+
+	s := newStepScheduler(1, nil, true)
+	s.ranks = ranks
+	require.NoError(t, s.acquire(context.Background(), &QueryPlanStep{ServiceName: "first"}))
+
+	order := make(chan string, len(steps))
+	for i, name := range []string{"late", "shallow", "deep", "also shallow"} {
+		step := steps[name]
+		go func() {
+			assert.NoError(t, s.acquire(context.Background(), step))
+			order <- step.ServiceName
+			s.release()
+		}()
+		waitForWaitingRequests(t, s, i+1)
+	}
+	// the waiting steps are sent one after the other from now on
+	s.release()
+
+	var names []string
+	for range steps {
+		names = append(names, <-order)
+	}
+	assert.Equal(t, []string{"deep", "shallow", "also shallow", "late"}, names)
+
+	decisions := s.scheduleDecisions()
+	require.Len(t, decisions, 5)
+	assert.Equal(t, "first", decisions[0].ServiceName)
+	assert.Equal(t, "deep", decisions[1].ServiceName)
+	assert.Equal(t, 3, decisions[1].Priority)
+	assert.Equal(t, 1, decisions[1].Wave)
+	assert.Equal(t, 1, decisions[1].Order)
+}
+
+func TestStepSchedulerCancellation(t *testing.T) {
+	s := newStepScheduler(1, nil, false)
+	require.NoError(t, s.acquire(context.Background(), &QueryPlanStep{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.acquire(ctx, &QueryPlanStep{}))
+	assert.Empty(t, s.waiting)
+
+	s.release()
+	require.NoError(t, s.acquire(context.Background(), &QueryPlanStep{}))
+	s.release()
+	assert.Equal(t, 0, s.active)
+}
+
+// waitForWaitingRequests waits until n requests wait for a slot
+func waitForWaitingRequests(t *testing.T, s *stepScheduler, n int) {
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.waiting) == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestQueryExecutionScheduleDebugInfo(t *testing.T) {
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+				type Query {
+					movie: Movie
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "movie": { "_id": "1", "id": "1", "title": "Alien" } } }`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT | FIELD_DEFINITION
+				type Movie @boundary {
+					id: ID!
+					release: Int
+				}
+				type Query {
+					movie(id: ID!): Movie @boundary
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "_0": { "_id": "1", "release": 1979 } } }`))
+				}),
+			},
+		},
+		debug: &DebugInfo{Schedule: true},
+		query: `{ movie { title release } }`,
+		expected: `{
+			"movie": { "title": "Alien", "release": 1979 }
+		}`,
+	}
+
+	f.checkSuccess(t)
+	require.IsType(t, []ScheduleDecision{}, f.resp.Extensions["schedule"])
+	decisions := f.resp.Extensions["schedule"].([]ScheduleDecision)
+	require.Len(t, decisions, 2)
+	assert.Equal(t, 0, decisions[0].Wave)
+	assert.Equal(t, 2, decisions[0].Priority)
+	assert.Equal(t, 1, decisions[1].Wave)
+	assert.Equal(t, 1, decisions[1].Priority)
+	assert.Equal(t, []string{"movie"}, decisions[1].InsertionPoint)
+
+	b, err := json.Marshal(decisions[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"queued":"0s"`)
+}
@@ -14,6 +14,8 @@ const (
 	serviceRootFieldName   = "service"
 	boundaryDirectiveName  = "boundary"
 	namespaceDirectiveName = "namespace"
+	authDirectiveName      = "auth"
+	privateDirectiveName   = "private"
 
 	queryObjectName        = "Query"
 	mutationObjectName     = "Mutation"
@@ -22,6 +24,27 @@ const (
 	internalServiceName = "__bramble"
 )
 
+const (
+	// boundaryKeyArgumentName is the argument of @boundary declaring the key
+	// argument of a boundary query
+	boundaryKeyArgumentName = "key"
+	// boundaryCacheTTLArgumentName is the argument of @boundary declaring how
+	// long the results of a boundary query can be cached
+	boundaryCacheTTLArgumentName = "cacheTTL"
+)
+
+const (
+	// requiresDirectiveName is the directive declaring the fields of other
+	// services a field needs to be resolved
+	requiresDirectiveName = "requires"
+	// requiresFieldsArgumentName is the argument of @requires listing the
+	// required fields
+	requiresFieldsArgumentName = "fields"
+	// representationsArgumentName is the argument of the array boundary
+	// queries receiving the required fields of the objects
+	representationsArgumentName = "representations"
+)
+
 func isGraphQLBuiltinName(s string) bool {
 	return strings.HasPrefix(s, "__")
 }
@@ -0,0 +1,129 @@
+package bramble
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// SchemaMetadata describes how the merged schema is federated: which service
+// owns every field, for developer portals and tooling
+type SchemaMetadata struct {
+	// Version is the hash of the merged schema
+	Version  string            `json:"version"`
+	Services []ServiceMetadata `json:"services"`
+	Types    []TypeMetadata    `json:"types"`
+}
+
+// ServiceMetadata is a federated service
+type ServiceMetadata struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	Status  string `json:"status"`
+}
+
+// TypeMetadata describes a type of the merged schema
+type TypeMetadata struct {
+	Name      string             `json:"name"`
+	Kind      ast.DefinitionKind `json:"kind"`
+	Boundary  bool               `json:"boundary"`
+	Namespace bool               `json:"namespace"`
+	Fields    []FieldMetadata    `json:"fields,omitempty"`
+	Services  []string           `json:"services,omitempty"`
+}
+
+// FieldMetadata describes a field of the merged schema and the service
+// resolving it. The fields of the types shared by several services are
+// resolved by the service of their parent field, they don't have a service.
+type FieldMetadata struct {
+	Name           string `json:"name"`
+	Service        string `json:"service,omitempty"`
+	ServiceURL     string `json:"serviceUrl,omitempty"`
+	ServiceVersion string `json:"serviceVersion,omitempty"`
+}
+
+// SchemaMetadata returns the metadata of the public merged schema, or nil if
+// the merged schema wasn't built yet
+func (s *ExecutableSchema) SchemaMetadata() *SchemaMetadata {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.PublicSchema == nil {
+		return nil
+	}
+
+	metadata := &SchemaMetadata{
+		Version:  s.schemaVersion,
+		Services: []ServiceMetadata{},
+		Types:    []TypeMetadata{},
+	}
+	for url, service := range s.Services {
+		metadata.Services = append(metadata.Services, ServiceMetadata{
+			Name:    service.Name,
+			Version: service.Version,
+			URL:     url,
+			Status:  service.Status,
+		})
+	}
+	sort.Slice(metadata.Services, func(i, j int) bool {
+		return metadata.Services[i].Name < metadata.Services[j].Name
+	})
+
+	for name, def := range s.PublicSchema.Types {
+		if isGraphQLBuiltinName(name) || name == serviceObjectName {
+			continue
+		}
+		t := TypeMetadata{
+			Name:      name,
+			Kind:      def.Kind,
+			Boundary:  s.IsBoundary[name],
+			Namespace: isNamespaceObject(def),
+		}
+		services := map[string]bool{}
+		for _, f := range def.Fields {
+			if isGraphQLBuiltinName(f.Name) || (def == s.PublicSchema.Query && f.Name == serviceRootFieldName) {
+				continue
+			}
+			field := FieldMetadata{Name: f.Name}
+			url, ok := s.Locations[s.Locations.keyFor(name, f.Name)]
+			if ok && url != sharedFieldLocation {
+				field.ServiceURL = url
+				if url == internalServiceName {
+					field.Service = internalServiceName
+				} else if service, ok := s.Services[url]; ok {
+					field.Service = service.Name
+					field.ServiceVersion = service.Version
+				}
+			}
+			if field.Service != "" && !services[field.Service] {
+				services[field.Service] = true
+				t.Services = append(t.Services, field.Service)
+			}
+			t.Fields = append(t.Fields, field)
+		}
+		sort.Strings(t.Services)
+		metadata.Types = append(metadata.Types, t)
+	}
+	sort.Slice(metadata.Types, func(i, j int) bool {
+		return metadata.Types[i].Name < metadata.Types[j].Name
+	})
+	return metadata
+}
+
+// schemaMetadataHandler serves the metadata of the merged schema in JSON. Like
+// the schema, it's only served to the clients allowed to introspect it.
+func (g *Gateway) schemaMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	if !g.ExecutableSchema.SchemaRequestAllowed(r) {
+		http.Error(w, "GraphQL introspection is not allowed", http.StatusForbidden)
+		return
+	}
+	metadata := g.ExecutableSchema.SchemaMetadata()
+	if metadata == nil {
+		http.Error(w, "schema unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(metadata)
+}
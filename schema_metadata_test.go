@@ -0,0 +1,87 @@
+package bramble
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestSchemaMetadata(t *testing.T) {
+	dir := t.TempDir()
+	schemas := map[string]string{
+		"movies": `
+		directive @boundary on OBJECT | FIELD_DEFINITION
+		type Movie @boundary {
+			id: ID!
+			title: String
+		}
+		type Query {
+			movie(id: ID!): Movie @boundary
+			movies: [Movie!]!
+		}`,
+		"reviews": `
+		directive @boundary on OBJECT | FIELD_DEFINITION
+		type Movie @boundary {
+			id: ID!
+			rating: Int
+		}
+		type Query {
+			movie(id: ID!): Movie @boundary
+		}`,
+	}
+	es := newExecutableSchema(nil, 50, nil, NewService("http://movies/query"), NewService("http://reviews/query"))
+	es.ServiceSchemas = map[string]ServiceSchemaConfig{}
+	for name, schema := range schemas {
+		path := filepath.Join(dir, name+".graphql")
+		require.NoError(t, ioutil.WriteFile(path, []byte(schema), 0644))
+		es.ServiceSchemas["http://"+name+"/query"] = ServiceSchemaConfig{Version: "v1", SDLFile: path}
+	}
+
+	assert.Nil(t, es.SchemaMetadata())
+	require.NoError(t, es.UpdateSchema(true))
+
+	metadata := es.SchemaMetadata()
+	require.NotNil(t, metadata)
+	assert.Equal(t, es.schemaVersion, metadata.Version)
+	assert.Equal(t, []ServiceMetadata{
+		{Name: "movies", Version: "v1", URL: "http://movies/query", Status: "OK"},
+		{Name: "reviews", Version: "v1", URL: "http://reviews/query", Status: "OK"},
+	}, metadata.Services)
+
+	types := map[string]TypeMetadata{}
+	for _, typ := range metadata.Types {
+		types[typ.Name] = typ
+	}
+	assert.NotContains(t, types, "Service")
+	assert.NotContains(t, types, "__Schema")
+	movie := types["Movie"]
+	assert.Equal(t, ast.Object, movie.Kind)
+	assert.True(t, movie.Boundary)
+	assert.False(t, movie.Namespace)
+	assert.Equal(t, []string{"movies", "reviews"}, movie.Services)
+	assert.ElementsMatch(t, []FieldMetadata{
+		{Name: "id"},
+		{Name: "title", Service: "movies", ServiceURL: "http://movies/query", ServiceVersion: "v1"},
+		{Name: "rating", Service: "reviews", ServiceURL: "http://reviews/query", ServiceVersion: "v1"},
+	}, movie.Fields)
+	assert.Equal(t, []FieldMetadata{
+		{Name: "movies", Service: "movies", ServiceURL: "http://movies/query", ServiceVersion: "v1"},
+	}, types["Query"].Fields)
+
+	t.Run("endpoint", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		NewGateway(es, nil).Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/schema-metadata", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		var served SchemaMetadata
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+		assert.Equal(t, *metadata, served)
+	})
+}
@@ -0,0 +1,360 @@
+package bramble
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// schemaRegistryTimeout is the timeout of the schema registry operations
+const schemaRegistryTimeout = 10 * time.Second
+
+// ErrSchemaNotFound is returned by the schema registries when the requested
+// schema doesn't exist
+var ErrSchemaNotFound = errors.New("schema not found in registry")
+
+// ServiceSchema is the schema of a service stored in a schema registry
+type ServiceSchema struct {
+	URL     string `json:"url"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Schema  string `json:"schema"`
+}
+
+// SchemaVersion is a version of the merged schema stored in a schema
+// registry, with the schemas of the services it was composed from
+type SchemaVersion struct {
+	// Hash identifies the version, it is the SHA-256 of the merged schema
+	// (see schemaHash)
+	Hash      string          `json:"hash"`
+	Timestamp time.Time       `json:"timestamp"`
+	Schema    string          `json:"schema"`
+	Services  []ServiceSchema `json:"services"`
+}
+
+// SchemaRegistry stores the schemas of the services and the versions of the
+// merged schema. It must be safe for concurrent use.
+type SchemaRegistry interface {
+	// ServiceSchema returns the latest schema of the service with the given
+	// URL, or ErrSchemaNotFound
+	ServiceSchema(ctx context.Context, serviceURL string) (*ServiceSchema, error)
+	// PublishSchemaVersion stores a version of the merged schema
+	PublishSchemaVersion(ctx context.Context, version *SchemaVersion) error
+	// SchemaVersion returns the version of the merged schema with the given
+	// hash, or ErrSchemaNotFound
+	SchemaVersion(ctx context.Context, hash string) (*SchemaVersion, error)
+}
+
+// serviceSchemaSource returns the schemas of the services, by URL
+type serviceSchemaSource interface {
+	ServiceSchema(ctx context.Context, serviceURL string) (*ServiceSchema, error)
+}
+
+// pinnedSchemaVersion is the source of the service schemas when the merged
+// schema is pinned to a version
+type pinnedSchemaVersion struct {
+	*SchemaVersion
+}
+
+func (v pinnedSchemaVersion) ServiceSchema(ctx context.Context, serviceURL string) (*ServiceSchema, error) {
+	for i := range v.Services {
+		if v.Services[i].URL == serviceURL {
+			return &v.Services[i], nil
+		}
+	}
+	return nil, fmt.Errorf("service isn't part of schema version %s: %w", v.Hash, ErrSchemaNotFound)
+}
+
+// SchemaRegistryConfig is the configuration of the schema registry
+type SchemaRegistryConfig struct {
+	// Path is the directory of a filesystem registry
+	Path string `json:"path"`
+	// URL is the base URL of an HTTP registry
+	URL string `json:"url"`
+	// Headers are added to the requests to an HTTP registry
+	Headers map[string]string `json:"headers"`
+	// FetchServices gets the schemas of the services from the registry
+	// instead of querying the services
+	FetchServices bool `json:"fetch-services"`
+	// PinnedVersion is the hash of the merged schema version to serve, the
+	// services aren't queried and no version is published
+	PinnedVersion string `json:"pinned-version"`
+}
+
+// registry returns the registry described by the config
+func (c *SchemaRegistryConfig) registry() (SchemaRegistry, error) {
+	switch {
+	case c.Path != "" && c.URL != "":
+		return nil, errors.New("only one of path and url can be set")
+	case c.Path != "":
+		return NewFileSchemaRegistry(c.Path), nil
+	case c.URL != "":
+		return NewHTTPSchemaRegistry(c.URL, c.Headers, nil), nil
+	}
+	return nil, errors.New("one of path and url is required")
+}
+
+// schemaObjectStore stores the registry objects by key
+type schemaObjectStore interface {
+	get(ctx context.Context, key string) ([]byte, error)
+	put(ctx context.Context, key string, data []byte) error
+}
+
+// objectSchemaRegistry is a registry storing the schemas as JSON objects:
+//
+//	services/<escaped service URL>.json
+//	versions/<hash>.json
+//	versions/latest.json
+type objectSchemaRegistry struct {
+	store schemaObjectStore
+}
+
+func serviceSchemaKey(serviceURL string) string {
+	return "services/" + url.PathEscape(serviceURL) + ".json"
+}
+
+func (r *objectSchemaRegistry) ServiceSchema(ctx context.Context, serviceURL string) (*ServiceSchema, error) {
+	var schema ServiceSchema
+	if err := r.getJSON(ctx, serviceSchemaKey(serviceURL), &schema); err != nil {
+		return nil, err
+	}
+	if schema.URL == "" {
+		schema.URL = serviceURL
+	}
+	return &schema, nil
+}
+
+// PublishServiceSchema stores the latest schema of a service, e.g. from the
+// deployment pipeline of the service
+func (r *objectSchemaRegistry) PublishServiceSchema(ctx context.Context, schema *ServiceSchema) error {
+	return r.putJSON(ctx, serviceSchemaKey(schema.URL), schema)
+}
+
+func (r *objectSchemaRegistry) PublishSchemaVersion(ctx context.Context, version *SchemaVersion) error {
+	if err := r.putJSON(ctx, "versions/"+version.Hash+".json", version); err != nil {
+		return err
+	}
+	return r.putJSON(ctx, "versions/latest.json", version)
+}
+
+func (r *objectSchemaRegistry) SchemaVersion(ctx context.Context, hash string) (*SchemaVersion, error) {
+	if strings.ContainsAny(hash, "/\\.") {
+		return nil, fmt.Errorf("invalid schema version %q", hash)
+	}
+	var version SchemaVersion
+	if err := r.getJSON(ctx, "versions/"+hash+".json", &version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func (r *objectSchemaRegistry) getJSON(ctx context.Context, key string, v interface{}) error {
+	data, err := r.store.get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error decoding %s: %w", key, err)
+	}
+	return nil
+}
+
+func (r *objectSchemaRegistry) putJSON(ctx context.Context, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return r.store.put(ctx, key, data)
+}
+
+// FileSchemaRegistry is a schema registry storing the schemas in a directory
+type FileSchemaRegistry struct {
+	objectSchemaRegistry
+}
+
+// NewFileSchemaRegistry returns a registry storing the schemas in the given
+// directory
+func NewFileSchemaRegistry(dir string) *FileSchemaRegistry {
+	return &FileSchemaRegistry{objectSchemaRegistry{store: fileObjectStore(dir)}}
+}
+
+type fileObjectStore string
+
+func (dir fileObjectStore) get(ctx context.Context, key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(string(dir), filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil, ErrSchemaNotFound
+	}
+	return data, err
+}
+
+func (dir fileObjectStore) put(ctx context.Context, key string, data []byte) error {
+	path := filepath.Join(string(dir), filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// written to a temporary file and renamed so the readers never see a
+	// partially written object
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// HTTPSchemaRegistry is a schema registry storing the schemas with GET and
+// PUT requests relative to a base URL, e.g. an S3 bucket (through a presigning
+// proxy or with a bucket policy allowing the gateway) or a WebDAV server.
+type HTTPSchemaRegistry struct {
+	objectSchemaRegistry
+}
+
+// NewHTTPSchemaRegistry returns a registry storing the schemas under the
+// given base URL, the headers are added to every request. The default HTTP
+// client is used if client is nil.
+func NewHTTPSchemaRegistry(baseURL string, headers map[string]string, client *http.Client) *HTTPSchemaRegistry {
+	if client == nil {
+		client = &http.Client{Timeout: schemaRegistryTimeout}
+	}
+	return &HTTPSchemaRegistry{objectSchemaRegistry{store: &httpObjectStore{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		headers: headers,
+		client:  client,
+	}}}
+}
+
+type httpObjectStore struct {
+	baseURL string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (s *httpObjectStore) do(ctx context.Context, method, key string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+"/"+key, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrSchemaNotFound
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("schema registry returned %d: %s", res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+func (s *httpObjectStore) get(ctx context.Context, key string) ([]byte, error) {
+	return s.do(ctx, http.MethodGet, key, nil)
+}
+
+func (s *httpObjectStore) put(ctx context.Context, key string, data []byte) error {
+	_, err := s.do(ctx, http.MethodPut, key, data)
+	return err
+}
+
+// schemaSource returns the source of the service schemas for a schema update:
+// the pinned schema version, the registry or nil if the services are queried.
+// It also returns whether the pinned version is already applied, in which
+// case there is nothing to update.
+func (s *ExecutableSchema) schemaSource(pending bool) (serviceSchemaSource, bool, error) {
+	if s.SchemaRegistry == nil {
+		return nil, false, nil
+	}
+	if s.PinnedSchemaVersion == "" {
+		if s.FetchServiceSchemasFromRegistry {
+			return s.SchemaRegistry, false, nil
+		}
+		return nil, false, nil
+	}
+
+	s.mutex.RLock()
+	applied := s.pinnedVersionApplied
+	s.mutex.RUnlock()
+	if applied && !pending {
+		return nil, true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), schemaRegistryTimeout)
+	defer cancel()
+	version, err := s.SchemaRegistry.SchemaVersion(ctx, s.PinnedSchemaVersion)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to fetch pinned schema version %s: %w", s.PinnedSchemaVersion, err)
+	}
+	return pinnedSchemaVersion{version}, false, nil
+}
+
+// publishSchemaVersion publishes the merged schema to the registry, unless
+// the schema is pinned or it was already published
+func (s *ExecutableSchema) publishSchemaVersion(schema string, services []*Service) {
+	if s.SchemaRegistry == nil || s.PinnedSchemaVersion != "" {
+		return
+	}
+	version := &SchemaVersion{
+		Hash:      schemaHash(schema),
+		Timestamp: time.Now(),
+		Schema:    schema,
+	}
+	s.mutex.RLock()
+	published := s.publishedSchemaVersion
+	s.mutex.RUnlock()
+	if version.Hash == published {
+		return
+	}
+	for _, svc := range services {
+		version.Services = append(version.Services, ServiceSchema{
+			URL:     svc.ServiceURL,
+			Name:    svc.Name,
+			Version: svc.Version,
+			Schema:  svc.SchemaSource,
+		})
+	}
+	sort.Slice(version.Services, func(i, j int) bool {
+		return version.Services[i].URL < version.Services[j].URL
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), schemaRegistryTimeout)
+	defer cancel()
+	logger := log.WithField("schema.version", version.Hash)
+	if err := s.SchemaRegistry.PublishSchemaVersion(ctx, version); err != nil {
+		promSchemaRegistryErrors.Inc()
+		logger.WithError(err).Error("unable to publish schema version")
+		return
+	}
+	s.mutex.Lock()
+	s.publishedSchemaVersion = version.Hash
+	s.mutex.Unlock()
+	logger.Info("published schema version")
+}
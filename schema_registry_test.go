@@ -0,0 +1,158 @@
+package bramble
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const registryTestSchema = `type Service {
+	name: String!
+	version: String!
+	schema: String!
+}
+
+type Query {
+	service: Service!
+	movie: String
+}`
+
+func newRegistryTestService(t *testing.T) *httptest.Server {
+	t.Helper()
+	return newTestService(t, "movies", registryTestSchema, nil)
+}
+
+func TestFileSchemaRegistry(t *testing.T) {
+	ctx := context.Background()
+	registry := NewFileSchemaRegistry(t.TempDir())
+
+	_, err := registry.ServiceSchema(ctx, "http://movies/query")
+	assert.True(t, errors.Is(err, ErrSchemaNotFound))
+
+	require.NoError(t, registry.PublishServiceSchema(ctx, &ServiceSchema{URL: "http://movies/query", Name: "movies", Schema: registryTestSchema}))
+	schema, err := registry.ServiceSchema(ctx, "http://movies/query")
+	require.NoError(t, err)
+	assert.Equal(t, "movies", schema.Name)
+	assert.Equal(t, registryTestSchema, schema.Schema)
+
+	version := &SchemaVersion{Hash: schemaHash("schema"), Schema: "schema", Services: []ServiceSchema{*schema}}
+	require.NoError(t, registry.PublishSchemaVersion(ctx, version))
+	stored, err := registry.SchemaVersion(ctx, version.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, version.Schema, stored.Schema)
+	assert.Equal(t, version.Services, stored.Services)
+
+	_, err = registry.SchemaVersion(ctx, "unknown")
+	assert.True(t, errors.Is(err, ErrSchemaNotFound))
+	_, err = registry.SchemaVersion(ctx, "../services/x")
+	assert.Error(t, err)
+}
+
+func TestHTTPSchemaRegistry(t *testing.T) {
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer registry-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			objects[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	registry := NewHTTPSchemaRegistry(srv.URL+"/registry/", map[string]string{"Authorization": "Bearer registry-token"}, nil)
+	version := &SchemaVersion{Hash: schemaHash("schema"), Schema: "schema"}
+	require.NoError(t, registry.PublishSchemaVersion(ctx, version))
+	assert.Contains(t, objects, "/registry/versions/"+version.Hash+".json")
+	assert.Contains(t, objects, "/registry/versions/latest.json")
+
+	stored, err := registry.SchemaVersion(ctx, version.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, "schema", stored.Schema)
+	_, err = registry.ServiceSchema(ctx, "http://movies/query")
+	assert.True(t, errors.Is(err, ErrSchemaNotFound))
+
+	_, err = NewHTTPSchemaRegistry(srv.URL, nil, nil).SchemaVersion(ctx, version.Hash)
+	require.Error(t, err)
+	assert.Equal(t, "schema registry returned 403: ", err.Error())
+}
+
+func TestSchemaRegistryIntegration(t *testing.T) {
+	t.Run("merged schema versions are published", func(t *testing.T) {
+		service := newRegistryTestService(t)
+		registry := NewFileSchemaRegistry(t.TempDir())
+		es := newExecutableSchema(nil, 50, nil, NewService(service.URL))
+		es.SchemaRegistry = registry
+		require.NoError(t, es.UpdateSchema(true))
+
+		version, err := registry.SchemaVersion(context.Background(), es.schemaVersion)
+		require.NoError(t, err)
+		assert.Equal(t, formatSchema(es.MergedSchema), version.Schema)
+		require.Len(t, version.Services, 1)
+		assert.Equal(t, ServiceSchema{URL: service.URL, Name: "movies", Version: "1.0", Schema: registryTestSchema}, version.Services[0])
+	})
+
+	t.Run("service schemas are fetched from the registry", func(t *testing.T) {
+		registry := NewFileSchemaRegistry(t.TempDir())
+		// the service isn't running
+		serviceURL := "http://movies.invalid/query"
+		require.NoError(t, registry.PublishServiceSchema(context.Background(), &ServiceSchema{URL: serviceURL, Name: "movies", Version: "2.0", Schema: registryTestSchema}))
+
+		es := newExecutableSchema(nil, 50, nil, NewService(serviceURL))
+		es.SchemaRegistry = registry
+		es.FetchServiceSchemasFromRegistry = true
+		require.NoError(t, es.UpdateSchema(true))
+		assert.NotNil(t, es.MergedSchema.Query.Fields.ForName("movie"))
+		assert.Equal(t, "2.0", es.Services[serviceURL].Version)
+	})
+
+	t.Run("pinned schema version", func(t *testing.T) {
+		service := newRegistryTestService(t)
+		dir := t.TempDir()
+		registry := NewFileSchemaRegistry(dir)
+		es := newExecutableSchema(nil, 50, nil, NewService(service.URL))
+		es.SchemaRegistry = registry
+		require.NoError(t, es.UpdateSchema(true))
+		pinned := es.schemaVersion
+		service.Close()
+
+		es = newExecutableSchema(nil, 50, nil, NewService(service.URL))
+		es.SchemaRegistry = registry
+		es.PinnedSchemaVersion = pinned
+		require.NoError(t, es.UpdateSchema(true))
+		assert.Equal(t, pinned, es.schemaVersion)
+		assert.NotNil(t, es.MergedSchema.Query.Fields.ForName("movie"))
+		// the pinned version is only applied once
+		require.NoError(t, es.UpdateSchema(false))
+
+		versions, err := ioutil.ReadDir(dir + "/versions")
+		require.NoError(t, err)
+		// the pinned version and latest.json
+		assert.Len(t, versions, 2)
+
+		es.PinnedSchemaVersion = strings.Repeat("0", 64)
+		es.pinnedVersionApplied = false
+		assert.Error(t, es.UpdateSchema(true))
+	})
+}
@@ -0,0 +1,133 @@
+package bramble
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// schemaHashHeader is the response header the services can set to the hash of
+// the schema they're serving (see schemaHash), so the gateway can detect when
+// it's not the schema it merged
+const schemaHashHeader = "X-Bramble-Schema-Hash"
+
+// schemaHash returns the hex encoded SHA-256 of the schema, as returned by the
+// service query
+func schemaHash(source string) string {
+	h := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(h[:])
+}
+
+// SchemaHash returns the hash of the service schema, as expected in the
+// X-Bramble-Schema-Hash header
+func (s *Service) SchemaHash() string {
+	return schemaHash(s.SchemaSource)
+}
+
+// schemaSkewDetector compares the schema hashes reported by the services with
+// the hashes of the schemas used to build the merged schema. It is safe for
+// concurrent use.
+type schemaSkewDetector struct {
+	mu sync.Mutex
+	// hashes of the merged schemas, by service or endpoint URL
+	hashes map[string]string
+	// names of the services, by service or endpoint URL
+	names map[string]string
+	// last hash reported by the skewed services, by service or endpoint URL
+	skewed map[string]string
+}
+
+func newSchemaSkewDetector() *schemaSkewDetector {
+	return &schemaSkewDetector{}
+}
+
+// setServices records the schemas of the services the merged schema was built
+// from, the skew of the previous schemas is cleared. The endpoints of a service
+// are expected to serve its schema.
+func (d *schemaSkewDetector) setServices(services []*Service, endpoints map[string]ServiceEndpoints) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for url := range d.skewed {
+		promServiceSchemaSkew.DeleteLabelValues(d.names[url])
+	}
+	d.hashes = make(map[string]string, len(services))
+	d.names = make(map[string]string, len(services))
+	d.skewed = make(map[string]string)
+	for _, s := range services {
+		hash := schemaHash(s.SchemaSource)
+		d.hashes[s.ServiceURL] = hash
+		d.names[s.ServiceURL] = s.Name
+		for _, url := range endpoints[s.ServiceURL].allURLs() {
+			d.hashes[url] = hash
+			d.names[url] = s.Name
+		}
+	}
+}
+
+// check compares the schema hash reported by the service with the hash of the
+// merged schema. Responses without a hash and unknown services are ignored.
+func (d *schemaSkewDetector) check(ctx context.Context, url, reported string) {
+	if d == nil || reported == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	expected, ok := d.hashes[url]
+	if !ok {
+		return
+	}
+	name := d.names[url]
+	logger := GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"service":  name,
+		"url":      url,
+		"expected": expected,
+		"reported": reported,
+	})
+
+	if reported == expected {
+		if _, ok := d.skewed[url]; ok {
+			delete(d.skewed, url)
+			logger.Info("service schema is back in sync with the merged schema")
+			if !d.serviceSkewed(name) {
+				promServiceSchemaSkew.DeleteLabelValues(name)
+			}
+		}
+		return
+	}
+
+	promServiceSchemaSkewResponses.WithLabelValues(name).Inc()
+	if d.skewed[url] != reported {
+		d.skewed[url] = reported
+		promServiceSchemaSkew.WithLabelValues(name).Set(1)
+		logger.Warn("service schema differs from the merged schema")
+	}
+}
+
+// serviceSkewed returns whether any URL of the service is still skewed
+func (d *schemaSkewDetector) serviceSkewed(name string) bool {
+	for url := range d.skewed {
+		if d.names[url] == name {
+			return true
+		}
+	}
+	return false
+}
+
+func addSchemaSkewDetectorToContext(ctx context.Context, d *schemaSkewDetector) context.Context {
+	return context.WithValue(ctx, schemaSkewDetectorContextKey, d)
+}
+
+func getSchemaSkewDetectorFromContext(ctx context.Context) *schemaSkewDetector {
+	d, _ := ctx.Value(schemaSkewDetectorContextKey).(*schemaSkewDetector)
+	return d
+}
@@ -0,0 +1,75 @@
+package bramble
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+)
+
+func TestSchemaSkewDetector(t *testing.T) {
+	service := &Service{ServiceURL: "http://movies", Name: "movies", SchemaSource: "type Query { movie: String }"}
+	expected := schemaHash(service.SchemaSource)
+
+	d := newSchemaSkewDetector()
+	d.setServices([]*Service{service}, nil)
+
+	d.check(context.Background(), "http://movies", "")
+	d.check(context.Background(), "http://unknown", "abc")
+	d.check(context.Background(), "http://movies", expected)
+	assert.Empty(t, d.skewed)
+
+	d.check(context.Background(), "http://movies", "abc")
+	assert.Equal(t, map[string]string{"http://movies": "abc"}, d.skewed)
+
+	d.check(context.Background(), "http://movies", expected)
+	assert.Empty(t, d.skewed)
+
+	d.check(context.Background(), "http://movies", "abc")
+	service.SchemaSource = "type Query { movie: String, movies: [String] }"
+	d.setServices([]*Service{service}, nil)
+	assert.Empty(t, d.skewed)
+	d.check(context.Background(), "http://movies", expected)
+	assert.Equal(t, map[string]string{"http://movies": expected}, d.skewed)
+
+	var nilDetector *schemaSkewDetector
+	assert.NotPanics(t, func() { nilDetector.check(context.Background(), "http://movies", "abc") })
+}
+
+func TestExecutableSchemaSchemaSkew(t *testing.T) {
+	schema := `
+		type Service {
+			name: String!
+			version: String!
+			schema: String!
+		}
+		type Query {
+			service: Service!
+			title: String
+		}`
+	reportedHash := schemaHash(schema)
+	server := newTestService(t, "movies", schema, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(schemaHashHeader, reportedHash)
+		w.Write([]byte(`{ "data": { "title": "Test title" } }`))
+	})
+
+	es := newExecutableSchema(nil, 50, nil, NewService(server.URL))
+	require.NoError(t, es.UpdateSchema(true))
+
+	execute := func() {
+		t.Helper()
+		op := gqlparser.MustLoadQuery(es.MergedSchema, `{ title }`).Operations[0]
+		resp := es.ExecuteQuery(testContextWithoutVariables(op))
+		require.Empty(t, resp.Errors)
+	}
+
+	execute()
+	assert.Empty(t, es.schemaSkew.skewed)
+
+	reportedHash = schemaHash(schema + "\nextend type Query { year: Int }")
+	execute()
+	assert.Equal(t, map[string]string{server.URL: reportedHash}, es.schemaSkew.skewed)
+}
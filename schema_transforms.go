@@ -0,0 +1,375 @@
+package bramble
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+var graphqlNameRegexp = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// SchemaTransform renames and removes the types and fields of a service
+// schema before it's merged, e.g. to federate third-party services whose type
+// names collide. The documents sent to the service use the original names.
+// Types and fields are identified by their original names.
+type SchemaTransform struct {
+	// TypePrefix is prepended to the names of the service types, except the
+	// root types, the boundary and namespace types, Node and Service
+	TypePrefix string `json:"type-prefix"`
+	// TypeRenames are the new names of the types, by original name. They
+	// take precedence over the prefix.
+	TypeRenames map[string]string `json:"type-renames"`
+	// FieldRenames are the new names of the fields, by original coordinate
+	// (Type.field). The fields renamed on an interface are also renamed on
+	// its implementations.
+	FieldRenames map[string]string `json:"field-renames"`
+	// ExcludedFields are the coordinates (Type.field) of the fields removed
+	// from the schema
+	ExcludedFields []string `json:"excluded-fields"`
+}
+
+// Validate checks the names and coordinates of the transform
+func (t SchemaTransform) Validate() error {
+	if t.TypePrefix != "" && !graphqlNameRegexp.MatchString(t.TypePrefix) {
+		return fmt.Errorf("invalid type prefix %q", t.TypePrefix)
+	}
+	for from, to := range t.TypeRenames {
+		if !graphqlNameRegexp.MatchString(to) {
+			return fmt.Errorf("invalid name %q for type %q", to, from)
+		}
+		if !renamableType(from) {
+			return fmt.Errorf("type %q can't be renamed", from)
+		}
+	}
+	for coordinate, to := range t.FieldRenames {
+		if _, _, err := splitFieldCoordinate(coordinate); err != nil {
+			return err
+		}
+		if !graphqlNameRegexp.MatchString(to) {
+			return fmt.Errorf("invalid name %q for field %q", to, coordinate)
+		}
+	}
+	for _, coordinate := range t.ExcludedFields {
+		if _, _, err := splitFieldCoordinate(coordinate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitFieldCoordinate(coordinate string) (string, string, error) {
+	parts := strings.Split(coordinate, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid field coordinate %q, expected Type.field", coordinate)
+	}
+	return parts[0], parts[1], nil
+}
+
+func renamableType(name string) bool {
+	switch name {
+	case queryObjectName, mutationObjectName, subscriptionObjectName, serviceObjectName, nodeInterfaceName:
+		return false
+	}
+	return !isGraphQLBuiltinName(name)
+}
+
+// transformedNames maps the names of a transformed service schema to the
+// original names of the service
+type transformedNames struct {
+	// types are the original names of the renamed types, by new name
+	types map[string]string
+	// typenames are the new names of the renamed types, by original name
+	typenames map[string]string
+	// fields are the original names of the renamed fields, by new
+	// coordinate (NewType.newField)
+	fields map[string]string
+}
+
+// apply returns the transformed schema, and the names to translate back to
+// the service
+func (t *SchemaTransform) apply(schema *ast.Schema) (*ast.Schema, *transformedNames, error) {
+	names := &transformedNames{
+		types:     make(map[string]string),
+		typenames: make(map[string]string),
+		fields:    make(map[string]string),
+	}
+
+	// the fields renamed on an interface are also renamed on its
+	// implementations
+	fieldRenames := make(map[string]string, len(t.FieldRenames))
+	for coordinate, newName := range t.FieldRenames {
+		fieldRenames[coordinate] = newName
+	}
+	for coordinate, newName := range t.FieldRenames {
+		typeName, fieldName, _ := splitFieldCoordinate(coordinate)
+		for _, def := range schema.Types {
+			for _, i := range def.Interfaces {
+				if _, ok := fieldRenames[def.Name+"."+fieldName]; i == typeName && !ok {
+					fieldRenames[def.Name+"."+fieldName] = newName
+				}
+			}
+		}
+	}
+
+	excluded := make(map[string]bool, len(t.ExcludedFields))
+	for _, coordinate := range t.ExcludedFields {
+		excluded[coordinate] = true
+	}
+
+	for name, def := range schema.Types {
+		if def.BuiltIn {
+			continue
+		}
+		newName := name
+		if rename, ok := t.TypeRenames[name]; ok {
+			newName = rename
+		} else if t.TypePrefix != "" && renamableType(name) && !hasFederationDirectives(def) && !isRootType(schema, def) {
+			newName = t.TypePrefix + name
+		}
+		if newName == name {
+			continue
+		}
+		if _, exists := schema.Types[newName]; exists {
+			return nil, nil, fmt.Errorf("can't rename type %q to %q, the type already exists", name, newName)
+		}
+		if _, exists := names.types[newName]; exists {
+			return nil, nil, fmt.Errorf("can't rename type %q to %q, another type has the same name", name, newName)
+		}
+		names.types[newName] = name
+		names.typenames[name] = newName
+	}
+
+	rename := func(name string) string {
+		if newName, ok := names.typenames[name]; ok {
+			return newName
+		}
+		return name
+	}
+	var renameType func(t *ast.Type)
+	renameType = func(t *ast.Type) {
+		if t == nil {
+			return
+		}
+		t.NamedType = rename(t.NamedType)
+		renameType(t.Elem)
+	}
+
+	// sorted, so the errors are deterministic
+	typeNames := make([]string, 0, len(schema.Types))
+	for name := range schema.Types {
+		typeNames = append(typeNames, name)
+	}
+	sort.Strings(typeNames)
+
+	var definitions ast.DefinitionList
+	for _, name := range typeNames {
+		def := schema.Types[name]
+		if def.BuiltIn {
+			continue
+		}
+		var fields ast.FieldList
+		for _, f := range def.Fields {
+			coordinate := name + "." + f.Name
+			if excluded[coordinate] {
+				continue
+			}
+			if newName, ok := fieldRenames[coordinate]; ok {
+				if def.Fields.ForName(newName) != nil {
+					return nil, nil, fmt.Errorf("can't rename field %q to %q, the field already exists", coordinate, newName)
+				}
+				names.fields[rename(name)+"."+newName] = f.Name
+				f.Name = newName
+			}
+			renameType(f.Type)
+			for _, arg := range f.Arguments {
+				renameType(arg.Type)
+			}
+			fields = append(fields, f)
+		}
+		def.Fields = fields
+		def.Name = rename(name)
+		for i := range def.Interfaces {
+			def.Interfaces[i] = rename(def.Interfaces[i])
+		}
+		for i := range def.Types {
+			def.Types[i] = rename(def.Types[i])
+		}
+		definitions = append(definitions, def)
+	}
+	for _, d := range schema.Directives {
+		for _, arg := range d.Arguments {
+			renameType(arg.Type)
+		}
+	}
+
+	// load the transformed definitions again, to rebuild the maps of the
+	// schema (possible types, implementations...)
+	source := formatSchema(&ast.Schema{
+		Query:        schema.Query,
+		Mutation:     schema.Mutation,
+		Subscription: schema.Subscription,
+		Types:        definitionMap(definitions),
+		Directives:   schema.Directives,
+	})
+	transformed, err := gqlparser.LoadSchema(&ast.Source{Name: "transformed", Input: source})
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid transformed schema: %w", err)
+	}
+	return transformed, names, nil
+}
+
+func isRootType(schema *ast.Schema, def *ast.Definition) bool {
+	return def == schema.Query || def == schema.Mutation || def == schema.Subscription
+}
+
+func definitionMap(definitions ast.DefinitionList) map[string]*ast.Definition {
+	m := make(map[string]*ast.Definition, len(definitions))
+	for _, def := range definitions {
+		m[def.Name] = def
+	}
+	return m
+}
+
+// buildTransformedNamesMap returns the names of the transformed services, by
+// service URL
+func buildTransformedNamesMap(services ...*Service) map[string]*transformedNames {
+	result := make(map[string]*transformedNames)
+	for _, s := range services {
+		if s.transformedNames != nil {
+			result[s.ServiceURL] = s.transformedNames
+		}
+	}
+	return result
+}
+
+// translateStepNames replaces the new names of the types and fields by the
+// original names in the selection sets of the steps of transformed services.
+// The aliases are kept, so the responses are merged as is.
+func translateStepNames(schema *ast.Schema, names map[string]*transformedNames, steps []*QueryPlanStep) {
+	for _, step := range steps {
+		if n, ok := names[step.ServiceURL]; ok {
+			step.SelectionSet = n.translateSelectionSet(schema, step.ParentType, step.SelectionSet)
+		}
+		translateStepNames(schema, names, step.Then)
+	}
+}
+
+func (n *transformedNames) translateSelectionSet(schema *ast.Schema, parentType string, selectionSet ast.SelectionSet) ast.SelectionSet {
+	result := make(ast.SelectionSet, 0, len(selectionSet))
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			f := *selection
+			if original, ok := n.fields[parentType+"."+selection.Name]; ok {
+				f.Name = original
+			}
+			if len(selection.SelectionSet) > 0 {
+				fieldType := parentType
+				if def := schema.Types[parentType]; def != nil {
+					if fieldDef := def.Fields.ForName(selection.Name); fieldDef != nil {
+						fieldType = fieldDef.Type.Name()
+					}
+				}
+				f.SelectionSet = n.translateSelectionSet(schema, fieldType, selection.SelectionSet)
+			}
+			result = append(result, &f)
+		case *ast.InlineFragment:
+			fragment := *selection
+			typeCondition := selection.TypeCondition
+			if typeCondition == "" {
+				typeCondition = parentType
+			}
+			if original, ok := n.types[selection.TypeCondition]; ok {
+				fragment.TypeCondition = original
+			}
+			fragment.SelectionSet = n.translateSelectionSet(schema, typeCondition, selection.SelectionSet)
+			result = append(result, &fragment)
+		case *ast.FragmentSpread:
+			typeCondition := selection.Definition.TypeCondition
+			fragment := &ast.InlineFragment{
+				TypeCondition: typeCondition,
+				Directives:    selection.Directives,
+				SelectionSet:  n.translateSelectionSet(schema, typeCondition, selection.Definition.SelectionSet),
+				Position:      selection.Position,
+			}
+			if original, ok := n.types[typeCondition]; ok {
+				fragment.TypeCondition = original
+			}
+			result = append(result, fragment)
+		default:
+			result = append(result, selection)
+		}
+	}
+	return result
+}
+
+// translateTypenames replaces the original type names of the service by the
+// new names in the __typename fields of the response. The response is
+// decoded again, it's only done for the services with renamed types.
+func (e *QueryExecution) translateTypenames(step *QueryPlanStep, resp interface{}) error {
+	names := e.transformedNames[step.ServiceURL]
+	if names == nil || len(names.typenames) == 0 {
+		return nil
+	}
+
+	aliases := map[string]bool{"__typename": true}
+	collectTypenameAliases(step.SelectionSet, aliases)
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	v = names.translateTypenameValues(v, aliases)
+	if data, err = json.Marshal(v); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, resp)
+}
+
+func collectTypenameAliases(selectionSet ast.SelectionSet, aliases map[string]bool) {
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if selection.Name == "__typename" {
+				aliases[selection.Alias] = true
+			}
+			collectTypenameAliases(selection.SelectionSet, aliases)
+		case *ast.InlineFragment:
+			collectTypenameAliases(selection.SelectionSet, aliases)
+		case *ast.FragmentSpread:
+			collectTypenameAliases(selection.Definition.SelectionSet, aliases)
+		}
+	}
+}
+
+func (n *transformedNames) translateTypenameValues(v interface{}, aliases map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if typename, ok := value.(string); ok && aliases[key] {
+				if newName, ok := n.typenames[typename]; ok {
+					v[key] = newName
+				}
+				continue
+			}
+			v[key] = n.translateTypenameValues(value, aliases)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = n.translateTypenameValues(v[i], aliases)
+		}
+	}
+	return v
+}
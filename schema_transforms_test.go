@@ -0,0 +1,119 @@
+package bramble
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestSchemaTransformApply(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+	type Service { name: String! version: String! schema: String! }
+	enum Genre { ACTION DRAMA }
+	interface Media { name: String! }
+	type Movie implements Media {
+		name: String!
+		genre: Genre!
+		secret: String
+	}
+	union SearchResult = Movie
+	type Query {
+		service: Service!
+		movies(genre: Genre): [Movie!]!
+		search: [SearchResult!]!
+	}`})
+
+	transform := &SchemaTransform{
+		TypePrefix:     "Ext",
+		TypeRenames:    map[string]string{"Genre": "Category"},
+		FieldRenames:   map[string]string{"Media.name": "title", "Query.movies": "extMovies"},
+		ExcludedFields: []string{"Movie.secret"},
+	}
+	transformed, names, err := transform.apply(schema)
+	require.NoError(t, err)
+
+	for _, name := range []string{"ExtMovie", "ExtMedia", "ExtSearchResult", "Category", "Query", "Service"} {
+		assert.NotNil(t, transformed.Types[name], name)
+	}
+	assert.Nil(t, transformed.Types["Movie"])
+	movie := transformed.Types["ExtMovie"]
+	assert.Equal(t, []string{"ExtMedia"}, movie.Interfaces)
+	assert.NotNil(t, movie.Fields.ForName("title"))
+	assert.Nil(t, movie.Fields.ForName("name"))
+	assert.Nil(t, movie.Fields.ForName("secret"))
+	assert.Equal(t, "Category", movie.Fields.ForName("genre").Type.Name())
+	assert.Equal(t, []string{"ExtMovie"}, transformed.Types["ExtSearchResult"].Types)
+	movies := transformed.Query.Fields.ForName("extMovies")
+	require.NotNil(t, movies)
+	assert.Equal(t, "[ExtMovie!]!", movies.Type.String())
+	assert.Equal(t, "Category", movies.Arguments.ForName("genre").Type.Name())
+
+	assert.Equal(t, "Movie", names.types["ExtMovie"])
+	assert.Equal(t, "ExtMovie", names.typenames["Movie"])
+	assert.Equal(t, "name", names.fields["ExtMovie.title"])
+	assert.Equal(t, "movies", names.fields["Query.extMovies"])
+
+	_, _, err = (&SchemaTransform{TypeRenames: map[string]string{"Movie": "Genre"}}).apply(gqlparser.MustLoadSchema(&ast.Source{Input: `
+	enum Genre { ACTION }
+	type Movie { genre: Genre }
+	type Query { movie: Movie }`}))
+	assert.EqualError(t, err, `can't rename type "Movie" to "Genre", the type already exists`)
+}
+
+func TestSchemaTransformValidate(t *testing.T) {
+	assert.NoError(t, SchemaTransform{TypePrefix: "Ext", FieldRenames: map[string]string{"Movie.name": "title"}}.Validate())
+	assert.Error(t, SchemaTransform{TypePrefix: "1Ext"}.Validate())
+	assert.Error(t, SchemaTransform{TypeRenames: map[string]string{"Query": "RootQuery"}}.Validate())
+	assert.Error(t, SchemaTransform{FieldRenames: map[string]string{"name": "title"}}.Validate())
+	assert.Error(t, SchemaTransform{ExcludedFields: []string{"Movie."}}.Validate())
+}
+
+func TestSchemaTransformExecution(t *testing.T) {
+	newService := func(schema, response string, queries *[]string) *httptest.Server {
+		return newTestService(t, "svc", schema, func(w http.ResponseWriter, r *http.Request) {
+			var req Request
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			if queries != nil {
+				*queries = append(*queries, multipleSpacesRegex.ReplaceAllString(req.Query, " "))
+			}
+			fmt.Fprint(w, response)
+		})
+	}
+
+	// both services define a Movie type
+	var queries []string
+	thirdParty := newService(`
+		type Service { name: String! version: String! schema: String! }
+		interface Media { name: String! }
+		type Movie implements Media { name: String! rating: Int }
+		type Query { service: Service! media: [Media!]! }`,
+		`{ "data": { "media": [{ "__typename": "Movie", "title": "Alien", "rating": 5 }] } }`, &queries)
+	movies := newService(`
+		type Service { name: String! version: String! schema: String! }
+		type Movie { id: ID! }
+		type Query { service: Service! movie: Movie }`,
+		`{ "data": { "movie": { "id": "1" } } }`, nil)
+
+	es := newExecutableSchema(nil, 50, nil, NewService(thirdParty.URL), NewService(movies.URL))
+	es.SchemaTransforms = map[string]SchemaTransform{
+		thirdParty.URL: {TypePrefix: "Ext", FieldRenames: map[string]string{"Media.name": "title"}},
+	}
+	require.NoError(t, es.UpdateSchema(true))
+
+	doc := gqlparser.MustLoadQuery(es.MergedSchema, `{ media { __typename ... on ExtMovie { title rating } } movie { id } }`)
+	resp := es.ExecuteQuery(testContextWithVariables(nil, doc.Operations[0]))
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{
+		"media": [{ "__typename": "ExtMovie", "title": "Alien", "rating": 5 }],
+		"movie": { "id": "1" }
+	}`, string(resp.Data))
+	require.Len(t, queries, 1)
+	assert.Equal(t, "query { media { __typename ... on Movie { title: name rating } } }", queries[0])
+}
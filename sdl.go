@@ -0,0 +1,222 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// brambleDirectives are the directives used by the services to describe how
+// their schemas are merged, they're meaningless to the clients
+var brambleDirectives = map[string]bool{
+	boundaryDirectiveName:  true,
+	namespaceDirectiveName: true,
+	privateDirectiveName:   true,
+}
+
+// SDL returns the public merged schema in SDL format, without the Bramble
+// directives (@boundary, @namespace). It returns an empty string if the merged
+// schema wasn't built yet.
+func (s *ExecutableSchema) SDL() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.PublicSchema == nil {
+		return ""
+	}
+	return formatSchema(withoutBrambleDirectives(s.PublicSchema))
+}
+
+// SDLWithDirectives returns the public merged schema in SDL format, including
+// the Bramble directives. It returns an empty string if the merged schema
+// wasn't built yet.
+func (s *ExecutableSchema) SDLWithDirectives() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.PublicSchema == nil {
+		return ""
+	}
+	return formatSchema(s.PublicSchema)
+}
+
+// IntrospectionResult returns the result of the standard introspection query
+// (as sent by GraphQL IDEs) against the public merged schema, filtered by the
+// permissions in the context.
+func (s *ExecutableSchema) IntrospectionResult(ctx context.Context) (json.RawMessage, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.PublicSchema == nil {
+		return nil, errors.New("schema unavailable")
+	}
+
+	query, errs := gqlparser.LoadQuery(s.PublicSchema, introspectionQuery)
+	if errs != nil {
+		return nil, errs
+	}
+	op := query.Operations[0]
+	ctx = graphql.WithOperationContext(ctx, &graphql.OperationContext{
+		Variables: map[string]interface{}{},
+		Operation: op,
+	})
+
+	schema := s.PublicSchema
+	if perms, ok := GetPermissionsFromContext(ctx); ok {
+		schema = perms.FilterSchema(schema)
+	}
+	result := make(map[string]interface{})
+	for _, f := range selectionSetToFields(op.SelectionSet) {
+		result[f.Alias] = s.resolveSchema(ctx, schema, f.SelectionSet)
+	}
+	return marshalResult(result, op.SelectionSet, s.MergedSchema, &ast.Type{NamedType: queryObjectName})
+}
+
+// introspectionQuery is the introspection query used by GraphiQL
+const introspectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types { ...FullType }
+    directives {
+      name
+      description
+      locations
+      args { ...InputValue }
+    }
+  }
+}
+
+fragment FullType on __Type {
+  kind
+  name
+  description
+  fields(includeDeprecated: true) {
+    name
+    description
+    args { ...InputValue }
+    type { ...TypeRef }
+    isDeprecated
+    deprecationReason
+  }
+  inputFields { ...InputValue }
+  interfaces { ...TypeRef }
+  enumValues(includeDeprecated: true) {
+    name
+    description
+    isDeprecated
+    deprecationReason
+  }
+  possibleTypes { ...TypeRef }
+}
+
+fragment InputValue on __InputValue {
+  name
+  description
+  type { ...TypeRef }
+  defaultValue
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType {
+    kind
+    name
+    ofType {
+      kind
+      name
+      ofType {
+        kind
+        name
+        ofType {
+          kind
+          name
+          ofType {
+            kind
+            name
+            ofType {
+              kind
+              name
+              ofType {
+                kind
+                name
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// withoutBrambleDirectives returns a copy of the schema without the Bramble
+// directives, only suitable for formatting
+func withoutBrambleDirectives(schema *ast.Schema) *ast.Schema {
+	result := *schema
+	result.Types = make(map[string]*ast.Definition, len(schema.Types))
+	for name, def := range schema.Types {
+		newDef := *def
+		newDef.Directives = removeBrambleDirectives(def.Directives)
+		newDef.Fields = nil
+		for _, f := range def.Fields {
+			newField := *f
+			newField.Directives = removeBrambleDirectives(f.Directives)
+			newDef.Fields = append(newDef.Fields, &newField)
+		}
+		result.Types[name] = &newDef
+	}
+
+	result.Directives = make(map[string]*ast.DirectiveDefinition, len(schema.Directives))
+	for name, d := range schema.Directives {
+		if !brambleDirectives[name] {
+			result.Directives[name] = d
+		}
+	}
+
+	if schema.Query != nil {
+		result.Query = result.Types[schema.Query.Name]
+	}
+	if schema.Mutation != nil {
+		result.Mutation = result.Types[schema.Mutation.Name]
+	}
+	if schema.Subscription != nil {
+		result.Subscription = result.Types[schema.Subscription.Name]
+	}
+	return &result
+}
+
+func removeBrambleDirectives(directives ast.DirectiveList) ast.DirectiveList {
+	var res ast.DirectiveList
+	for _, d := range directives {
+		if !brambleDirectives[d.Name] {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// schemaSDLHandler serves the merged schema in SDL format. The Bramble
+// directives are only included with the directives=true query parameter.
+func (g *Gateway) schemaSDLHandler(w http.ResponseWriter, r *http.Request) {
+	if !g.ExecutableSchema.SchemaRequestAllowed(r) {
+		http.Error(w, "GraphQL introspection is not allowed", http.StatusForbidden)
+		return
+	}
+	var sdl string
+	if withDirectives, _ := strconv.ParseBool(r.URL.Query().Get("directives")); withDirectives {
+		sdl = g.ExecutableSchema.SDLWithDirectives()
+	} else {
+		sdl = g.ExecutableSchema.SDL()
+	}
+	if sdl == "" {
+		http.Error(w, "schema unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(sdl))
+}
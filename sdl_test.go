@@ -0,0 +1,135 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func newSDLTestSchema(t *testing.T) *ExecutableSchema {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		directive @boundary on OBJECT | FIELD_DEFINITION
+		directive @namespace on OBJECT
+		directive @private on FIELD_DEFINITION
+
+		type Movie @boundary {
+			id: ID!
+			title: String @deprecated(reason: "use name")
+			secret: String @private
+		}
+
+		type MovieQuery @namespace {
+			all: [Movie!]!
+		}
+
+		type Query {
+			movie(id: ID!): Movie @boundary
+			movies: MovieQuery!
+		}`})
+	merged, err := MergeSchemas(schema)
+	require.NoError(t, err)
+
+	es := newExecutableSchema(nil, 50, nil)
+	es.MergedSchema = merged
+	es.PublicSchema = buildPublicSchema(merged)
+	return es
+}
+
+func TestExecutableSchemaSDL(t *testing.T) {
+	es := newSDLTestSchema(t)
+
+	sdl := es.SDL()
+	assert.Contains(t, sdl, "type Movie {")
+	assert.Contains(t, sdl, "type MovieQuery {")
+	assert.Contains(t, sdl, `@deprecated(reason: "use name")`)
+	assert.NotContains(t, sdl, "@boundary")
+	assert.NotContains(t, sdl, "@namespace")
+	assert.NotContains(t, sdl, "secret")
+	_, err := gqlparser.LoadSchema(&ast.Source{Input: sdl})
+	assert.Nil(t, err, "the SDL must be a valid schema")
+
+	withDirectives := es.SDLWithDirectives()
+	assert.Contains(t, withDirectives, "type Movie @boundary {")
+	assert.Contains(t, withDirectives, "directive @namespace on OBJECT")
+	assert.NotContains(t, withDirectives, "secret")
+
+	// the merged schema is left untouched
+	assert.NotNil(t, es.PublicSchema.Types["Movie"].Directives.ForName("boundary"))
+}
+
+func TestSchemaSDLEndpoint(t *testing.T) {
+	router := NewGateway(newSDLTestSchema(t), nil).Router()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/schema.graphql")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.NotContains(t, rec.Body.String(), "@boundary")
+
+	rec = get("/schema.graphql?directives=true")
+	assert.Contains(t, rec.Body.String(), "@boundary")
+
+	emptyRouter := NewGateway(newExecutableSchema(nil, 50, nil), nil).Router()
+	rec = httptest.NewRecorder()
+	emptyRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/schema.graphql", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestSchemaSDLEndpointWithIntrospectionDisabled(t *testing.T) {
+	es := newSDLTestSchema(t)
+	es.ClientIDHeader = "X-Client"
+	es.Introspection = IntrospectionConfig{Disabled: true, AllowedClients: []string{"schema-ci"}}
+	router := NewGateway(es, nil).Router()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/schema.graphql", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/schema.graphql", nil)
+	req.Header.Set("X-Client", "schema-ci")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestIntrospectionResult(t *testing.T) {
+	es := newSDLTestSchema(t)
+
+	res, err := es.IntrospectionResult(context.Background())
+	require.NoError(t, err)
+	var result struct {
+		Schema struct {
+			QueryType struct{ Name string }
+			Types     []struct {
+				Name   string
+				Fields []struct{ Name string }
+			}
+		} `json:"__schema"`
+	}
+	require.NoError(t, json.Unmarshal(res, &result))
+	assert.Equal(t, "Query", result.Schema.QueryType.Name)
+	var movieFields []string
+	for _, typ := range result.Schema.Types {
+		if typ.Name == "Movie" {
+			for _, f := range typ.Fields {
+				movieFields = append(movieFields, f.Name)
+			}
+		}
+	}
+	assert.Equal(t, []string{"id", "title"}, movieFields)
+
+	_, err = newExecutableSchema(nil, 50, nil).IntrospectionResult(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,364 @@
+package bramble
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/formatter"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// autoAliasPrefix is the alias prefix of the services whose prefix is
+// detected from their schema
+const autoAliasPrefix = "auto"
+
+// defaultAliasPrefix is the prefix tried first by the detection, suffixed
+// with a number until no field of the service starts with it
+const defaultAliasPrefix = "bramble_"
+
+var aliasPrefixRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// ServiceAliases are the prefixes of the aliases reserved by the gateway (see
+// isReservedAlias) in the documents sent to the services rejecting the
+// aliases starting with an underscore. The leading underscore of the reserved
+// aliases is replaced with the prefix of the service (e.g. "_id" is sent as
+// "bramble_id" and "_0" as "bramble_0"), and the response keys starting with
+// the prefix are translated back. The other response keys starting with the
+// prefix are escaped by adding an underscore after the prefix, so they can't
+// clash with the reserved aliases. A nil ServiceAliases doesn't translate the
+// aliases.
+type ServiceAliases struct {
+	// services are the service URLs by URL, including the endpoints and
+	// replicas of the services
+	services map[string]string
+	// mu protects the prefixes, the auto prefixes are updated with the
+	// schemas of the services
+	mu       sync.RWMutex
+	prefixes map[string]string
+	auto     map[string]bool
+}
+
+// NewServiceAliases builds the alias prefixes of the services, by service
+// URL. The prefixes are also used for the endpoints and replicas of the
+// services. It returns nil if no prefixes are configured.
+func NewServiceAliases(prefixes map[string]string, endpoints map[string]ServiceEndpoints, replicas map[string][]string) (*ServiceAliases, error) {
+	if len(prefixes) == 0 {
+		return nil, nil
+	}
+
+	a := &ServiceAliases{
+		services: make(map[string]string),
+		prefixes: make(map[string]string, len(prefixes)),
+		auto:     make(map[string]bool),
+	}
+	for serviceURL, prefix := range prefixes {
+		switch {
+		case prefix == autoAliasPrefix:
+			a.auto[serviceURL] = true
+			prefix = defaultAliasPrefix
+		case !aliasPrefixRegexp.MatchString(prefix):
+			return nil, fmt.Errorf("invalid alias prefix %q for service %q: must be a name starting with a letter", prefix, serviceURL)
+		}
+		a.prefixes[serviceURL] = prefix
+		a.services[serviceURL] = serviceURL
+		for _, endpoint := range endpoints[serviceURL].allURLs() {
+			a.services[endpoint] = serviceURL
+		}
+		for _, replica := range replicas[serviceURL] {
+			a.services[replica] = serviceURL
+		}
+	}
+	return a, nil
+}
+
+// prefixFor returns the alias prefix of the service, or "" if the reserved
+// aliases are sent as is
+func (a *ServiceAliases) prefixFor(url string) string {
+	if a == nil {
+		return ""
+	}
+	serviceURL, ok := a.services[url]
+	if !ok {
+		return ""
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.prefixes[serviceURL]
+}
+
+// updateSchemas detects the prefixes of the auto services from their schema:
+// the first prefix no field of the service starts with, so none of them need
+// to be escaped. The services whose configured prefix is used by their
+// fields are logged, their fields are escaped.
+func (a *ServiceAliases) updateSchemas(services []*Service) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, service := range services {
+		prefix, ok := a.prefixes[service.ServiceURL]
+		if !ok || service.Schema == nil {
+			continue
+		}
+		if a.auto[service.ServiceURL] {
+			prefix = defaultAliasPrefix
+			for i := 0; schemaFieldsStartWith(service.Schema, prefix); i++ {
+				prefix = strings.TrimSuffix(defaultAliasPrefix, "_") + strconv.Itoa(i) + "_"
+			}
+			a.prefixes[service.ServiceURL] = prefix
+			continue
+		}
+		if schemaFieldsStartWith(service.Schema, prefix) {
+			log.WithFields(log.Fields{"service": service.Name, "prefix": prefix}).Warn("fields of the service start with its alias prefix, they are escaped in the requests")
+		}
+	}
+}
+
+// schemaFieldsStartWith returns whether a field of the schema starts with the
+// prefix
+func schemaFieldsStartWith(schema *ast.Schema, prefix string) bool {
+	for _, def := range schema.Types {
+		if def.BuiltIn {
+			continue
+		}
+		for _, field := range def.Fields {
+			if strings.HasPrefix(field.Name, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// encodeAlias returns the response key sent to the service for the key of a
+// field
+func encodeAlias(key, prefix string) string {
+	switch {
+	case isReservedAlias(key):
+		return prefix + key[1:]
+	case strings.HasPrefix(key, prefix):
+		return prefix + "_" + key[len(prefix):]
+	}
+	return key
+}
+
+// decodeAlias returns the key of a field for the response key returned by the
+// service
+func decodeAlias(key, prefix string) string {
+	if !strings.HasPrefix(key, prefix) {
+		return key
+	}
+	rest := key[len(prefix):]
+	if strings.HasPrefix(rest, "_") {
+		return prefix + rest[1:]
+	}
+	return "_" + rest
+}
+
+// responseAliases are the fields of a selection set sent to a service with
+// the aliases translated, by response key returned by the service
+type responseAliases map[string]*responseAlias
+
+type responseAlias struct {
+	key    string
+	fields responseAliases
+}
+
+// translateRequest returns the request to the service with the aliases
+// translated and the response keys to translate back, or the request itself
+// if the service has no alias prefix
+func (a *ServiceAliases) translateRequest(url string, request *Request) (*Request, responseAliases, error) {
+	prefix := a.prefixFor(url)
+	if prefix == "" {
+		return request, nil, nil
+	}
+	doc, err := parser.ParseQuery(&ast.Source{Input: request.Query})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to translate the aliases of the request: %w", err)
+	}
+	for _, op := range doc.Operations {
+		encodeSelectionSetAliases(op.SelectionSet, prefix)
+	}
+	for _, fragment := range doc.Fragments {
+		encodeSelectionSetAliases(fragment.SelectionSet, prefix)
+	}
+	aliases := responseAliases{}
+	for _, op := range doc.Operations {
+		aliases.collect(op.SelectionSet, doc.Fragments, prefix)
+	}
+	var buf bytes.Buffer
+	formatter.NewFormatter(&buf).FormatQueryDocument(doc)
+
+	translated := *request
+	translated.Query = buf.String()
+	return &translated, aliases, nil
+}
+
+func encodeSelectionSetAliases(selectionSet ast.SelectionSet, prefix string) {
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			selection.Alias = encodeAlias(selection.Alias, prefix)
+			encodeSelectionSetAliases(selection.SelectionSet, prefix)
+		case *ast.InlineFragment:
+			encodeSelectionSetAliases(selection.SelectionSet, prefix)
+		}
+	}
+}
+
+// collect adds the fields of the translated selection set, merging the
+// fields of its fragments
+func (aliases responseAliases) collect(selectionSet ast.SelectionSet, fragments ast.FragmentDefinitionList, prefix string) {
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			alias, ok := aliases[selection.Alias]
+			if !ok {
+				alias = &responseAlias{key: decodeAlias(selection.Alias, prefix)}
+				aliases[selection.Alias] = alias
+			}
+			if len(selection.SelectionSet) > 0 {
+				if alias.fields == nil {
+					alias.fields = responseAliases{}
+				}
+				alias.fields.collect(selection.SelectionSet, fragments, prefix)
+			}
+		case *ast.InlineFragment:
+			aliases.collect(selection.SelectionSet, fragments, prefix)
+		case *ast.FragmentSpread:
+			if fragment := fragments.ForName(selection.Name); fragment != nil {
+				aliases.collect(fragment.SelectionSet, fragments, prefix)
+			}
+		}
+	}
+}
+
+// translateResponse returns the response of the service (or subscription
+// event) with the keys of the selected fields in its data and the paths of
+// its errors translated back, or the response itself if the request wasn't
+// translated. The values of the leaf fields (e.g. JSON scalars) are copied
+// untouched.
+func (aliases responseAliases) translateResponse(r io.Reader) (io.Reader, error) {
+	if aliases == nil {
+		return r, nil
+	}
+
+	var response map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&response); err != nil {
+		return nil, err
+	}
+	if data, ok := response["data"]; ok {
+		var buf bytes.Buffer
+		dataDec := json.NewDecoder(bytes.NewReader(data))
+		dataDec.UseNumber()
+		if err := decodeValueAliases(dataDec, &buf, aliases); err != nil {
+			return nil, err
+		}
+		response["data"] = buf.Bytes()
+	}
+	if errs, ok := response["errors"]; ok {
+		var graphqlErrors []map[string]json.RawMessage
+		if err := json.Unmarshal(errs, &graphqlErrors); err == nil {
+			for _, e := range graphqlErrors {
+				var path []interface{}
+				if err := json.Unmarshal(e["path"], &path); err != nil {
+					continue
+				}
+				fields := aliases
+				for i, elem := range path {
+					name, ok := elem.(string)
+					if !ok {
+						continue
+					}
+					alias, ok := fields[name]
+					if !ok {
+						break
+					}
+					path[i] = alias.key
+					fields = alias.fields
+				}
+				e["path"], _ = json.Marshal(path)
+			}
+			response["errors"], _ = json.Marshal(graphqlErrors)
+		}
+	}
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
+// decodeValueAliases copies the next JSON value of the decoder with the keys
+// of the selected fields translated back. The values of the fields without a
+// selection set and of the unknown keys are copied as is.
+func decodeValueAliases(dec *json.Decoder, w *bytes.Buffer, fields responseAliases) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		w.WriteByte('{')
+		for i := 0; dec.More(); i++ {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			name := key.(string)
+			alias, ok := fields[name]
+			if ok {
+				name = alias.key
+			}
+			b, _ := json.Marshal(name)
+			w.Write(b)
+			w.WriteByte(':')
+			if !ok || alias.fields == nil {
+				var value json.RawMessage
+				if err := dec.Decode(&value); err != nil {
+					return err
+				}
+				w.Write(value)
+				continue
+			}
+			if err := decodeValueAliases(dec, w, alias.fields); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('}')
+		_, err = dec.Token()
+		return err
+	case json.Delim('['):
+		w.WriteByte('[')
+		for i := 0; dec.More(); i++ {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := decodeValueAliases(dec, w, fields); err != nil {
+				return err
+			}
+		}
+		w.WriteByte(']')
+		_, err = dec.Token()
+		return err
+	}
+	b, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	w.Write(b)
+	return nil
+}
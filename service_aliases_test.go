@@ -0,0 +1,138 @@
+package bramble
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestServiceAliasesConfig(t *testing.T) {
+	aliases, err := NewServiceAliases(nil, nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, aliases)
+	assert.Equal(t, "", aliases.prefixFor("http://movies"))
+
+	aliases, err = NewServiceAliases(
+		map[string]string{"http://movies": "gw_", "http://reviews": "auto"},
+		map[string]ServiceEndpoints{"http://movies": {URLs: []string{"http://movies-1"}}},
+		map[string][]string{"http://movies": {"http://movies-replica"}},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "gw_", aliases.prefixFor("http://movies"))
+	assert.Equal(t, "gw_", aliases.prefixFor("http://movies-1"))
+	assert.Equal(t, "gw_", aliases.prefixFor("http://movies-replica"))
+	assert.Equal(t, "bramble_", aliases.prefixFor("http://reviews"))
+	assert.Equal(t, "", aliases.prefixFor("http://other"))
+
+	// the auto prefix isn't used by the fields of the service
+	aliases.updateSchemas([]*Service{{
+		ServiceURL: "http://reviews",
+		Schema: gqlparser.MustLoadSchema(&ast.Source{Input: `
+			type Review { bramble_score: Int, bramble0_score: Int }
+			type Query { review: Review }`}),
+	}})
+	assert.Equal(t, "bramble1_", aliases.prefixFor("http://reviews"))
+
+	_, err = NewServiceAliases(map[string]string{"http://movies": "_gw"}, nil, nil)
+	assert.EqualError(t, err, `invalid alias prefix "_gw" for service "http://movies": must be a name starting with a letter`)
+}
+
+func TestServiceAliasesTranslation(t *testing.T) {
+	for _, key := range []string{"_id", "_0", "_result", "_b1_0", "title", "__typename", "gw_title", "gw__title", "_gw_", "gw_"} {
+		encoded := encodeAlias(key, "gw_")
+		assert.NotRegexp(t, "^_[^_]", encoded)
+		assert.Equal(t, key, decodeAlias(encoded, "gw_"), "key %q encoded as %q", key, encoded)
+	}
+
+	aliases, err := NewServiceAliases(map[string]string{"http://movies": "gw_"}, nil, nil)
+	require.NoError(t, err)
+
+	req, responseAliases, err := aliases.translateRequest("http://movies", &Request{Query: `{ _0: movie(id: "1") { ... on Movie { _id: id gw_title title_: _title _metadata: metadata } } }`})
+	require.NoError(t, err)
+	assert.Equal(t, `query { gw_0: movie(id: "1") { ... on Movie { gw_id: id gw__title: gw_title title_: _title gw_metadata: metadata } } } `, multipleSpacesRegex.ReplaceAllString(req.Query, " "))
+
+	// the keys of the JSON scalar values are left untouched
+	r, err := responseAliases.translateResponse(bytes.NewReader([]byte(`{
+		"data": { "gw_0": { "gw_id": "1", "gw__title": "Test title", "title_": "Other", "rating": 4.50, "gw_metadata": { "gw_id": "2", "gw__tags": [{ "gw_0": true }] } } },
+		"errors": [{ "message": "failed", "path": ["gw_0", "gw__title"] }],
+		"extensions": { "gw_cost": 1 }
+	}`)))
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"data": { "_0": { "_id": "1", "gw_title": "Test title", "title_": "Other", "rating": 4.50, "_metadata": { "gw_id": "2", "gw__tags": [{ "gw_0": true }] } } },
+		"errors": [{ "message": "failed", "path": ["_0", "gw_title"] }],
+		"extensions": { "gw_cost": 1 }
+	}`, string(b))
+}
+
+func TestQueryExecutionServiceAliases(t *testing.T) {
+	// the service rejects the aliases starting with an underscore
+	underscoreAlias := regexp.MustCompile(`\b_[A-Za-z0-9]\w*\s*:`)
+	rejectUnderscoreAliases := func(next func(w http.ResponseWriter, req Request)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var req Request
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			if underscoreAlias.MatchString(req.Query) {
+				w.Write([]byte(`{ "errors": [{ "message": "invalid alias" }] }`))
+				return
+			}
+			next(w, req)
+		}
+	}
+
+	f := &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String!
+				}
+
+				type Query {
+					movies: [Movie!]!
+				}`,
+				handler: rejectUnderscoreAliases(func(w http.ResponseWriter, req Request) {
+					w.Write([]byte(`{ "data": { "movies": [{ "gw_id": "1", "title": "Test title" }] } }`))
+				}),
+				aliasPrefix: "gw_",
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					bramble_rating: Float!
+				}
+
+				type Query {
+					movie(id: ID!): Movie
+				}`,
+				handler: rejectUnderscoreAliases(func(w http.ResponseWriter, req Request) {
+					assert.Contains(t, req.Query, "bramble0_0: ")
+					w.Write([]byte(`{ "data": { "bramble0_0": { "bramble0_id": "1", "bramble_rating": 4.5 } } }`))
+				}),
+				aliasPrefix: "auto",
+			},
+		},
+		query: `{
+			movies {
+				title
+				bramble_rating
+			}
+		}`,
+		expected: `{
+			"movies": [{ "title": "Test title", "bramble_rating": 4.5 }]
+		}`,
+	}
+	f.checkSuccess(t)
+}
@@ -0,0 +1,148 @@
+package bramble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// ServiceSchemaConfig fetches the schema of a service from an SDL endpoint, a
+// file or a custom query instead of the service query, so that services
+// not implementing the bramble conventions can be federated. Exactly one of
+// SDLURL, SDLFile and Query must be set.
+type ServiceSchemaConfig struct {
+	// Name is the name of the service, defaults to the host of its URL
+	Name string `json:"name"`
+	// Version is the version of the service
+	Version string `json:"version"`
+	// SDLURL is the URL of the schema, fetched with a GET request
+	SDLURL string `json:"sdl-url"`
+	// SDLFile is the path of the schema file
+	SDLFile string `json:"sdl-file"`
+	// Query is the GraphQL query sent to the service to fetch its schema,
+	// e.g. "{ _service { sdl } }"
+	Query string `json:"query"`
+	// SchemaPath is the path of the schema in the data of the query
+	// response, e.g. "_service.sdl"
+	SchemaPath string `json:"schema-path"`
+}
+
+// Validate checks that exactly one schema source is set
+func (c ServiceSchemaConfig) Validate() error {
+	sources := 0
+	for _, source := range []string{c.SDLURL, c.SDLFile, c.Query} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New("exactly one of sdl-url, sdl-file and query is required")
+	}
+	if c.SDLURL != "" {
+		if u, err := url.Parse(c.SDLURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid sdl-url %q", c.SDLURL)
+		}
+	}
+	if c.Query != "" {
+		if _, err := parser.ParseQuery(&ast.Source{Input: c.Query}); err != nil {
+			return fmt.Errorf("invalid query: %w", err)
+		}
+		if c.SchemaPath == "" {
+			return errors.New("schema-path is required with query")
+		}
+		if _, err := parseJSONPath(c.SchemaPath); err != nil {
+			return fmt.Errorf("invalid schema-path: %w", err)
+		}
+	}
+	return nil
+}
+
+// fetch returns the schema of the service, with the Service type and the
+// service query added if it doesn't define them
+func (c ServiceSchemaConfig) fetch(ctx context.Context, client *GraphQLClient, serviceURL string) (string, error) {
+	var schema string
+	var err error
+	switch {
+	case c.SDLFile != "":
+		var b []byte
+		b, err = ioutil.ReadFile(c.SDLFile)
+		schema = string(b)
+	case c.SDLURL != "":
+		schema, err = fetchSDL(ctx, client, c.SDLURL)
+	default:
+		schema, err = c.query(ctx, client, serviceURL)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	doc, gqlErr := parser.ParseSchema(&ast.Source{Input: schema})
+	if gqlErr != nil {
+		return "", fmt.Errorf("invalid schema: %w", gqlErr)
+	}
+	if doc.Definitions.ForName(serviceObjectName) == nil {
+		schema += restServiceSchema
+	}
+	return schema, nil
+}
+
+func (c ServiceSchemaConfig) query(ctx context.Context, client *GraphQLClient, serviceURL string) (string, error) {
+	path, err := parseJSONPath(c.SchemaPath)
+	if err != nil {
+		return "", err
+	}
+	var response map[string]interface{}
+	if err := client.Request(ctx, serviceURL, NewRequest(c.Query), &response); err != nil {
+		return "", err
+	}
+	schema, ok := path.extract(response).(string)
+	if !ok {
+		return "", fmt.Errorf("no schema at %q in the response", c.SchemaPath)
+	}
+	return schema, nil
+}
+
+// name returns the name of the service
+func (c ServiceSchemaConfig) name(serviceURL string) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	if u, err := url.Parse(serviceURL); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return serviceURL
+}
+
+// fetchSDL fetches a schema with a GET request
+func fetchSDL(ctx context.Context, client *GraphQLClient, sdlURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sdlURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to create request: %w", err)
+	}
+	if client.UserAgent != "" {
+		req.Header.Set("User-Agent", client.UserAgent)
+	}
+	res, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error during request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned status %d", sdlURL, res.StatusCode)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, client.MaxResponseSize+1))
+	if err != nil {
+		return "", fmt.Errorf("error reading schema: %w", err)
+	}
+	if int64(len(b)) > client.MaxResponseSize {
+		return "", fmt.Errorf("schema exceeds the max size of %d bytes", client.MaxResponseSize)
+	}
+	return string(b), nil
+}
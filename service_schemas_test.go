@@ -0,0 +1,114 @@
+package bramble
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+)
+
+func TestServiceSchemaConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		config   ServiceSchemaConfig
+		expected string
+	}{
+		"sdl url":             {config: ServiceSchemaConfig{SDLURL: "http://movies/schema.graphql"}},
+		"sdl file":            {config: ServiceSchemaConfig{SDLFile: "movies.graphql"}},
+		"query":               {config: ServiceSchemaConfig{Query: "{ _service { sdl } }", SchemaPath: "_service.sdl"}},
+		"no source":           {config: ServiceSchemaConfig{Name: "movies"}, expected: "exactly one of sdl-url, sdl-file and query is required"},
+		"several sources":     {config: ServiceSchemaConfig{SDLURL: "http://movies/schema.graphql", SDLFile: "movies.graphql"}, expected: "exactly one of sdl-url, sdl-file and query is required"},
+		"invalid url":         {config: ServiceSchemaConfig{SDLURL: "movies/schema.graphql"}, expected: `invalid sdl-url "movies/schema.graphql"`},
+		"invalid query":       {config: ServiceSchemaConfig{Query: "{ _service { sdl }", SchemaPath: "_service.sdl"}, expected: "invalid query: input:1: Expected Name, found <EOF>"},
+		"no schema path":      {config: ServiceSchemaConfig{Query: "{ _service { sdl } }"}, expected: "schema-path is required with query"},
+		"invalid schema path": {config: ServiceSchemaConfig{Query: "{ _service { sdl } }", SchemaPath: "_service..sdl"}, expected: `invalid schema-path: empty element in path "_service..sdl"`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.expected, err.Error())
+		})
+	}
+}
+
+func TestServiceSchemaSources(t *testing.T) {
+	moviesSchema := `type Movie { id: ID! title: String } type Query { movie(id: ID!): Movie }`
+	actorsSchema := `type Actor { name: String } type Query { actor: Actor }`
+	reviewsSchema := `type Review { body: String } type Query { review: Review }`
+
+	var sdlRequests int
+	sdl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sdlRequests++
+		assert.Equal(t, http.MethodGet, r.Method)
+		w.Write([]byte(moviesSchema))
+	}))
+	defer sdl.Close()
+
+	// the services don't implement the service query
+	newService := func(data string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req Request
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			if strings.Contains(req.Query, "_service") {
+				resp, _ := json.Marshal(map[string]interface{}{"data": map[string]interface{}{"_service": map[string]interface{}{"sdl": reviewsSchema}}})
+				w.Write(resp)
+				return
+			}
+			w.Write([]byte(data))
+		}))
+	}
+	movies := newService(`{ "data": { "movie": { "title": "Alien" } } }`)
+	defer movies.Close()
+	actors := newService(`{ "data": { "actor": { "name": "Sigourney Weaver" } } }`)
+	defer actors.Close()
+	reviews := newService(`{ "data": { "review": { "body": "Great" } } }`)
+	defer reviews.Close()
+
+	actorsFile := filepath.Join(t.TempDir(), "actors.graphql")
+	require.NoError(t, ioutil.WriteFile(actorsFile, []byte(actorsSchema), 0644))
+
+	es := newExecutableSchema(nil, 50, nil, NewService(movies.URL), NewService(actors.URL), NewService(reviews.URL))
+	es.ServiceSchemas = map[string]ServiceSchemaConfig{
+		movies.URL:  {Name: "movies", Version: "1.0", SDLURL: sdl.URL},
+		actors.URL:  {SDLFile: actorsFile},
+		reviews.URL: {Name: "reviews", Query: "{ _service { sdl } }", SchemaPath: "_service.sdl"},
+	}
+	require.NoError(t, es.UpdateSchema(true))
+	assert.Equal(t, 1, sdlRequests)
+
+	services := es.Services
+	assert.Equal(t, "movies", services[movies.URL].Name)
+	assert.Equal(t, "1.0", services[movies.URL].Version)
+	assert.Equal(t, "127.0.0.1", services[actors.URL].Name)
+	assert.Equal(t, "reviews", services[reviews.URL].Name)
+	for _, s := range services {
+		assert.Equal(t, "OK", s.Status)
+	}
+
+	doc := gqlparser.MustLoadQuery(es.MergedSchema, `{ movie(id: "1") { title } actor { name } review { body } }`)
+	resp := es.ExecuteQuery(testContextWithVariables(nil, doc.Operations[0]))
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{
+		"movie": { "title": "Alien" },
+		"actor": { "name": "Sigourney Weaver" },
+		"review": { "body": "Great" }
+	}`, string(resp.Data))
+
+	t.Run("invalid schema", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(actorsFile, []byte("type Actor {"), 0644))
+		require.NoError(t, es.UpdateSchema(false))
+		assert.Equal(t, "Unreachable", es.Services[actors.URL].Status)
+		assert.Contains(t, es.Services[actors.URL].Health().LastError, "invalid schema")
+	})
+}
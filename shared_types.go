@@ -0,0 +1,170 @@
+package bramble
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// isSharedValueType returns whether the type can be defined by several
+// services without federation directives, as long as the definitions are
+// identical: enums, input objects and plain objects
+func isSharedValueType(t *ast.Definition) bool {
+	switch t.Kind {
+	case ast.Enum, ast.InputObject:
+		return true
+	case ast.Object:
+		switch t.Name {
+		case queryObjectName, mutationObjectName, subscriptionObjectName:
+			return false
+		}
+		return !hasFederationDirectives(t)
+	}
+	return false
+}
+
+// mergeSharedValueTypes merges two definitions of a shared value type, they
+// must be structurally identical. The descriptions are not compared.
+func mergeSharedValueTypes(a, b *ast.Definition) (*ast.Definition, error) {
+	if differences := sharedValueTypeDifferences(a, b); len(differences) > 0 {
+		return nil, fmt.Errorf("conflicting shared type: %s (%s)", a.Name, strings.Join(differences, ", "))
+	}
+	result := *a
+	if result.Description == "" {
+		result.Description = b.Description
+	}
+	return &result, nil
+}
+
+// sharedValueTypeDifferences returns the differences between two definitions
+// of the same type
+func sharedValueTypeDifferences(a, b *ast.Definition) []string {
+	var differences []string
+	if !stringArraysEqual(sortedStrings(a.Interfaces), sortedStrings(b.Interfaces)) {
+		differences = append(differences, fmt.Sprintf("implements [%s] and [%s]", strings.Join(a.Interfaces, ", "), strings.Join(b.Interfaces, ", ")))
+	}
+	if da, db := formatDirectiveList(a.Directives), formatDirectiveList(b.Directives); da != db {
+		differences = append(differences, fmt.Sprintf("directives %q and %q", da, db))
+	}
+
+	for _, va := range a.EnumValues {
+		vb := b.EnumValues.ForName(va.Name)
+		if vb == nil {
+			differences = append(differences, fmt.Sprintf("value %s is missing from one of the definitions", va.Name))
+			continue
+		}
+		if da, db := formatDirectiveList(va.Directives), formatDirectiveList(vb.Directives); da != db {
+			differences = append(differences, fmt.Sprintf("value %s has directives %q and %q", va.Name, da, db))
+		}
+	}
+	for _, vb := range b.EnumValues {
+		if a.EnumValues.ForName(vb.Name) == nil {
+			differences = append(differences, fmt.Sprintf("value %s is missing from one of the definitions", vb.Name))
+		}
+	}
+
+	fieldsA, fieldsB := filterBuiltinFields(a.Fields), filterBuiltinFields(b.Fields)
+	for _, fa := range fieldsA {
+		fb := fieldsB.ForName(fa.Name)
+		if fb == nil {
+			differences = append(differences, fmt.Sprintf("field %s is missing from one of the definitions", fa.Name))
+			continue
+		}
+		differences = append(differences, fieldDifferences(fa, fb)...)
+	}
+	for _, fb := range fieldsB {
+		if fieldsA.ForName(fb.Name) == nil {
+			differences = append(differences, fmt.Sprintf("field %s is missing from one of the definitions", fb.Name))
+		}
+	}
+
+	return differences
+}
+
+func fieldDifferences(a, b *ast.FieldDefinition) []string {
+	var differences []string
+	if a.Type.String() != b.Type.String() {
+		differences = append(differences, fmt.Sprintf("field %s has types %s and %s", a.Name, a.Type.String(), b.Type.String()))
+	}
+	if da, db := formatValue(a.DefaultValue), formatValue(b.DefaultValue); da != db {
+		differences = append(differences, fmt.Sprintf("field %s has default values %q and %q", a.Name, da, db))
+	}
+	if da, db := formatDirectiveList(a.Directives), formatDirectiveList(b.Directives); da != db {
+		differences = append(differences, fmt.Sprintf("field %s has directives %q and %q", a.Name, da, db))
+	}
+	for _, argA := range a.Arguments {
+		argB := b.Arguments.ForName(argA.Name)
+		if argB == nil {
+			differences = append(differences, fmt.Sprintf("argument %s.%s is missing from one of the definitions", a.Name, argA.Name))
+			continue
+		}
+		if argA.Type.String() != argB.Type.String() {
+			differences = append(differences, fmt.Sprintf("argument %s.%s has types %s and %s", a.Name, argA.Name, argA.Type.String(), argB.Type.String()))
+		}
+		if da, db := formatValue(argA.DefaultValue), formatValue(argB.DefaultValue); da != db {
+			differences = append(differences, fmt.Sprintf("argument %s.%s has default values %q and %q", a.Name, argA.Name, da, db))
+		}
+	}
+	for _, argB := range b.Arguments {
+		if a.Arguments.ForName(argB.Name) == nil {
+			differences = append(differences, fmt.Sprintf("argument %s.%s is missing from one of the definitions", a.Name, argB.Name))
+		}
+	}
+	return differences
+}
+
+// formatDirectiveList returns the directives with their arguments, sorted by
+// name so the order doesn't matter
+func formatDirectiveList(directives ast.DirectiveList) string {
+	res := make([]string, 0, len(directives))
+	for _, d := range directives {
+		var args []string
+		for _, arg := range d.Arguments {
+			args = append(args, arg.Name+": "+formatValue(arg.Value))
+		}
+		sort.Strings(args)
+		if len(args) > 0 {
+			res = append(res, "@"+d.Name+"("+strings.Join(args, ", ")+")")
+		} else {
+			res = append(res, "@"+d.Name)
+		}
+	}
+	sort.Strings(res)
+	return strings.Join(res, " ")
+}
+
+func formatValue(v *ast.Value) string {
+	if v == nil {
+		return ""
+	}
+	return v.String()
+}
+
+func sortedStrings(values []string) []string {
+	res := append([]string(nil), values...)
+	sort.Strings(res)
+	return res
+}
+
+// buildSharedValueTypes returns the plain object types defined by several
+// services. Their fields are resolved by the service of the parent field.
+func buildSharedValueTypes(services ...*Service) map[string]bool {
+	count := make(map[string]int)
+	for _, rs := range services {
+		for _, t := range rs.Schema.Types {
+			if t.Kind != ast.Object || isGraphQLBuiltinName(t.Name) || t.Name == serviceObjectName || !isSharedValueType(t) {
+				continue
+			}
+			count[t.Name]++
+		}
+	}
+	result := make(map[string]bool)
+	for name, n := range count {
+		if n > 1 {
+			result[name] = true
+		}
+	}
+	return result
+}
@@ -0,0 +1,189 @@
+package bramble
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// redactedValue replaces the values of the redacted variables
+const redactedValue = "[REDACTED]"
+
+// SlowQuery is an operation whose execution exceeded the slow query threshold
+type SlowQuery struct {
+	OperationName string `json:"operationName"`
+	OperationType string `json:"operationType"`
+	// Query is the normalized operation: the fragments are inlined, the
+	// literal arguments replaced with "?" and the selections sorted
+	Query string `json:"query"`
+	// Fingerprint is the hash of the normalized operation
+	Fingerprint string `json:"fingerprint"`
+	// Variables of the operation, only set if the variables are logged
+	Variables map[string]interface{} `json:"variables,omitempty"`
+	Duration  time.Duration          `json:"duration"`
+	// Steps are the timings of the query plan steps
+	Steps []StepTiming `json:"steps"`
+	// ServiceRequests is the number of requests sent to each service, by
+	// service name
+	ServiceRequests map[string]int64 `json:"serviceRequests"`
+	Errors          int              `json:"errors"`
+}
+
+// SlowQuerySink receives the slow queries, e.g. to store them for offline
+// analysis. It must be safe for concurrent use.
+type SlowQuerySink interface {
+	LogSlowQuery(ctx context.Context, query *SlowQuery)
+}
+
+// SlowQueryLog reports the operations whose execution exceeded a threshold.
+// The slow queries are logged and sent to the added sinks.
+type SlowQueryLog struct {
+	Threshold time.Duration
+	// Variables includes the variables of the operations in the slow queries
+	Variables bool
+	// RedactedVariables are the names of the variables (and input object
+	// fields) whose values are redacted, case-insensitive
+	RedactedVariables []string
+
+	sinks      []SlowQuerySink
+	sinksMutex sync.Mutex
+}
+
+// SlowQueryLogConfig is the configuration of the slow query log
+type SlowQueryLogConfig struct {
+	// Threshold is the minimum duration of the logged operations, the slow
+	// query log is disabled if it's empty
+	Threshold         string   `json:"threshold"`
+	Variables         bool     `json:"variables"`
+	RedactedVariables []string `json:"redacted-variables"`
+	thresholdDuration time.Duration
+}
+
+func (c *SlowQueryLogConfig) parse() error {
+	if c.Threshold == "" {
+		return nil
+	}
+	threshold, err := time.ParseDuration(c.Threshold)
+	if err != nil {
+		return fmt.Errorf("invalid slow query threshold: %w", err)
+	}
+	c.thresholdDuration = threshold
+	return nil
+}
+
+// slowQueryLog returns the slow query log described by the config, or nil if
+// it's disabled
+func (c SlowQueryLogConfig) slowQueryLog() *SlowQueryLog {
+	if c.thresholdDuration == 0 {
+		return nil
+	}
+	return &SlowQueryLog{
+		Threshold:         c.thresholdDuration,
+		Variables:         c.Variables,
+		RedactedVariables: c.RedactedVariables,
+	}
+}
+
+// AddSink adds a sink receiving the slow queries
+func (l *SlowQueryLog) AddSink(sink SlowQuerySink) {
+	l.sinksMutex.Lock()
+	defer l.sinksMutex.Unlock()
+	l.sinks = append(l.sinks, sink)
+}
+
+// isSlow returns whether an operation of the given duration is a slow query
+func (l *SlowQueryLog) isSlow(duration time.Duration) bool {
+	return l != nil && l.Threshold > 0 && duration >= l.Threshold
+}
+
+// report logs the slow query and sends it to the sinks
+func (l *SlowQueryLog) report(ctx context.Context, query *SlowQuery) {
+	GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"operation.name":   query.OperationName,
+		"operation.type":   query.OperationType,
+		"query":            query.Query,
+		"fingerprint":      query.Fingerprint,
+		"variables":        query.Variables,
+		"duration":         query.Duration.String(),
+		"steps":            query.Steps,
+		"service_requests": query.ServiceRequests,
+		"errors":           query.Errors,
+	}).Warn("slow query")
+
+	l.sinksMutex.Lock()
+	sinks := l.sinks
+	l.sinksMutex.Unlock()
+	for _, sink := range sinks {
+		sink.LogSlowQuery(ctx, query)
+	}
+}
+
+// redactVariables returns a copy of the variables with the values of the
+// redacted variables and input object fields replaced
+func (l *SlowQueryLog) redactVariables(variables map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]bool, len(l.RedactedVariables))
+	for _, name := range l.RedactedVariables {
+		redacted[strings.ToLower(name)] = true
+	}
+	return redactValue(variables, redacted).(map[string]interface{})
+}
+
+func redactValue(value interface{}, redacted map[string]bool) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			if redacted[strings.ToLower(k)] {
+				res[k] = redactedValue
+				continue
+			}
+			res[k] = redactValue(v, redacted)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(value))
+		for i, v := range value {
+			res[i] = redactValue(v, redacted)
+		}
+		return res
+	default:
+		return value
+	}
+}
+
+// reportSlowQuery reports the operation to the slow query log if its
+// execution exceeded the threshold
+func (s *ExecutableSchema) reportSlowQuery(ctx context.Context, duration time.Duration, op *ast.OperationDefinition, variables map[string]interface{}, qe *QueryExecution, sizes *payloadSizes, errors int) {
+	if !s.SlowQueryLog.isSlow(duration) {
+		return
+	}
+
+	requests := make(map[string]int64)
+	for url, size := range sizes.byURL() {
+		name := s.serviceNameForURL(url)
+		if name == "" {
+			name = url
+		}
+		requests[name] += size.Requests
+	}
+
+	query := &SlowQuery{
+		OperationName:   op.Name,
+		OperationType:   string(op.Operation),
+		Query:           normalizeOperation(op),
+		Fingerprint:     GetOperationFingerprintFromContext(ctx),
+		Duration:        duration,
+		Steps:           qe.StepTimings,
+		ServiceRequests: requests,
+		Errors:          errors,
+	}
+	if s.SlowQueryLog.Variables {
+		query.Variables = s.SlowQueryLog.redactVariables(variables)
+	}
+	s.SlowQueryLog.report(ctx, query)
+}
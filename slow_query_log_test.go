@@ -0,0 +1,132 @@
+package bramble
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSlowQuerySink struct {
+	mu      sync.Mutex
+	queries []*SlowQuery
+}
+
+func (s *recordingSlowQuerySink) LogSlowQuery(ctx context.Context, query *SlowQuery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = append(s.queries, query)
+}
+
+func newSlowQueryTestFixture(log *SlowQueryLog) *queryExecutionFixture {
+	return &queryExecutionFixture{
+		services: []testService{
+			{
+				schema: `directive @boundary on OBJECT
+				type Movie @boundary {
+					id: ID!
+					title: String
+				}
+
+				type Query {
+					movie(id: ID!): Movie!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "movie": { "_id": "1", "title": "Test title" } } }`))
+				}),
+			},
+			{
+				schema: `directive @boundary on OBJECT
+				interface Node { id: ID! }
+
+				type Movie @boundary {
+					id: ID!
+					release: Int
+				}
+
+				type Query {
+					node(id: ID!): Node!
+				}`,
+				handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{ "data": { "_0": { "_id": "1", "release": 2007 } } }`))
+				}),
+			},
+		},
+		query: `query Movie($id: ID!) {
+			movie(id: $id) {
+				title
+				release
+			}
+		}`,
+		variables:    map[string]interface{}{"id": "1"},
+		expected:     `{ "movie": { "title": "Test title", "release": 2007 } }`,
+		slowQueryLog: log,
+	}
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	t.Run("slow queries are sent to the sinks", func(t *testing.T) {
+		sink := &recordingSlowQuerySink{}
+		log := &SlowQueryLog{Threshold: time.Nanosecond, Variables: true, RedactedVariables: []string{"ID"}}
+		log.AddSink(sink)
+		f := newSlowQueryTestFixture(log)
+		f.checkSuccess(t)
+
+		require.Len(t, sink.queries, 1)
+		query := sink.queries[0]
+		assert.Equal(t, "Movie", query.OperationName)
+		assert.Equal(t, "query", query.OperationType)
+		assert.Equal(t, "query Movie($id: ID!) { movie(id: $id) { release title } }", query.Query)
+		assert.Len(t, query.Fingerprint, 64)
+		assert.Equal(t, map[string]interface{}{"id": "[REDACTED]"}, query.Variables)
+		assert.Len(t, query.Steps, 2)
+		assert.Len(t, query.ServiceRequests, 2)
+		for _, requests := range query.ServiceRequests {
+			assert.Equal(t, int64(1), requests)
+		}
+		assert.Equal(t, 0, query.Errors)
+		assert.True(t, query.Duration > 0)
+	})
+
+	t.Run("fast queries are not reported", func(t *testing.T) {
+		sink := &recordingSlowQuerySink{}
+		log := &SlowQueryLog{Threshold: time.Hour}
+		log.AddSink(sink)
+		newSlowQueryTestFixture(log).checkSuccess(t)
+		assert.Empty(t, sink.queries)
+	})
+
+	t.Run("variables are not included by default", func(t *testing.T) {
+		sink := &recordingSlowQuerySink{}
+		log := &SlowQueryLog{Threshold: time.Nanosecond}
+		log.AddSink(sink)
+		newSlowQueryTestFixture(log).checkSuccess(t)
+		require.Len(t, sink.queries, 1)
+		assert.Nil(t, sink.queries[0].Variables)
+	})
+}
+
+func TestRedactVariables(t *testing.T) {
+	log := &SlowQueryLog{RedactedVariables: []string{"password", "Token"}}
+	variables := map[string]interface{}{
+		"password": "hunter2",
+		"input": map[string]interface{}{
+			"name":  "Alice",
+			"token": "abc",
+			"cards": []interface{}{map[string]interface{}{"password": "1234"}},
+		},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"password": "[REDACTED]",
+		"input": map[string]interface{}{
+			"name":  "Alice",
+			"token": "[REDACTED]",
+			"cards": []interface{}{map[string]interface{}{"password": "[REDACTED]"}},
+		},
+	}, log.redactVariables(variables))
+	assert.Equal(t, "hunter2", variables["password"], "the variables are not modified")
+}
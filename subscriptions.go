@@ -0,0 +1,185 @@
+package bramble
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// errNoSubscriptionEvent is returned by the subscription root steps executed
+// outside of a subscription
+var errNoSubscriptionEvent = errors.New("subscriptions are only supported over websocket")
+
+func withSubscriptionEvent(ctx context.Context, event subscriptionEvent) context.Context {
+	return context.WithValue(ctx, subscriptionEventContextKey, event)
+}
+
+func subscriptionEventFromContext(ctx context.Context) (subscriptionEvent, bool) {
+	event, ok := ctx.Value(subscriptionEventContextKey).(subscriptionEvent)
+	return event, ok
+}
+
+// executeSubscription returns the response handler of a subscription. The
+// subscription to the service is made on the first call, then every call
+// waits for the next event and executes the operation with it: the event is
+// the result of the root step, and the child steps are executed as for a
+// query. The handler returns nil once the subscription is over.
+func (s *ExecutableSchema) executeSubscription(ctx context.Context) graphql.ResponseHandler {
+	var (
+		once  sync.Once
+		sub   *subscriber
+		start *graphql.Response
+	)
+	return func(ctx context.Context) *graphql.Response {
+		once.Do(func() {
+			release, drainErr := s.drain.acquire()
+			if drainErr != nil {
+				start = &graphql.Response{Errors: gqlerror.List{drainErr}}
+				return
+			}
+			sub, start = s.subscribe(ctx)
+			if sub == nil {
+				release()
+				return
+			}
+			go func() {
+				select {
+				case <-ctx.Done():
+				case <-s.drain.cancelled:
+				}
+				sub.unsubscribe()
+				release()
+			}()
+		})
+		if sub == nil {
+			// the subscription failed, the error is only returned once
+			res := start
+			start = nil
+			return res
+		}
+
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				return nil
+			}
+			return s.ExecuteQuery(withSubscriptionEvent(ctx, event))
+		case <-ctx.Done():
+			return nil
+		case <-s.drain.cancelled:
+			return nil
+		}
+	}
+}
+
+// subscribe plans the subscription and subscribes to the service resolving
+// its root field. The subscriptions identical to an active one share its
+// upstream subscription.
+func (s *ExecutableSchema) subscribe(ctx context.Context) (*subscriber, *graphql.Response) {
+	opctx := graphql.GetOperationContext(ctx)
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.subscriptions == nil {
+		return nil, graphql.ErrorResponse(ctx, "subscriptions are not supported")
+	}
+
+	op := s.evaluateSkipAndInclude(opctx.Variables, opctx.Operation)
+	if errs := unavailableFieldErrors(s.PublicSchema, op); len(errs) > 0 {
+		return nil, &graphql.Response{Errors: errs}
+	}
+
+	var errs gqlerror.List
+	if perms, ok := GetPermissionsFromContext(ctx); ok {
+		errs = perms.FilterAuthorizedFields(op)
+	}
+	errs = append(errs, s.filterFieldsByRole(ctx, op)...)
+	if len(errs) > 0 {
+		return nil, &graphql.Response{Errors: errs}
+	}
+
+	plan, err := s.plan(ctx, s.operationFingerprint(ctx), op, opctx.Variables)
+	if err != nil {
+		return nil, &graphql.Response{Errors: gqlerror.List{{Message: err.Error()}}}
+	}
+	var step *QueryPlanStep
+	for _, rootStep := range plan.RootSteps {
+		if rootStep.ParentType != subscriptionObjectName {
+			continue
+		}
+		if step != nil {
+			return nil, graphql.ErrorResponse(ctx, "a subscription must select a single service field")
+		}
+		step = rootStep
+	}
+	if step == nil {
+		return nil, graphql.ErrorResponse(ctx, "a subscription must select a service field")
+	}
+
+	req := NewRequest("subscription " + formatSelectionSet(ctx, s.MergedSchema, step.SelectionSet))
+	req.Headers = GetOutgoingServiceRequestHeadersFromContext(ctx, step.ServiceURL)
+	nameRequest(req, op.Name)
+	hooks := s.executionHooks()
+	if len(hooks) > 0 && req.Headers == nil {
+		req.Headers = make(map[string][]string)
+	}
+	if err := hooks.onStepRequest(ctx, step, req); err != nil {
+		return nil, &graphql.Response{Errors: gqlerror.List{hookError(err)}}
+	}
+
+	keepAlive := s.SubscriptionKeepAlive
+	if keepAlive == 0 {
+		keepAlive = defaultSubscriptionKeepAlive
+	}
+	return s.subscriptions.subscribe(s.GraphqlClient, keepAlive, step.ServiceURL, req), nil
+}
+
+// executeSubscriptionRootStep merges the subscription event of the context,
+// the result of the root step, and executes the child steps
+func (e *QueryExecution) executeSubscriptionRootStep(ctx context.Context, step *QueryPlanStep, result map[string]interface{}) {
+	event, ok := subscriptionEventFromContext(ctx)
+	if !ok {
+		e.addError(ctx, step, errNoSubscriptionEvent)
+		return
+	}
+
+	var err error
+	if len(event.Errors) > 0 {
+		err = event.Errors
+	}
+	resp := event.Data
+	if resp == nil {
+		resp = map[string]json.RawMessage{}
+	}
+	if translateErr := e.translateTypenames(step, &resp); translateErr != nil && err == nil {
+		err = translateErr
+	}
+	if err := e.hooks.onStepResponse(ctx, step, &resp, err); err != nil {
+		e.addError(ctx, step, err)
+		if len(resp) == 0 {
+			return
+		}
+	}
+
+	e.m.Lock()
+	e.mergeStepResult(ctx, step, result, jsonMapToInterfaceMap(resp))
+	e.m.Unlock()
+
+	e.executeChildSteps(ctx, step.Then, result)
+}
+
+// subscriptionOperation returns whether the operation of the context is a
+// subscription
+func subscriptionOperation(ctx context.Context) bool {
+	if !graphql.HasOperationContext(ctx) {
+		return false
+	}
+	op := graphql.GetOperationContext(ctx).Operation
+	return op != nil && op.Operation == ast.Subscription
+}
@@ -0,0 +1,223 @@
+package bramble
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportConfig configures the HTTP transport of the requests to the
+// services. The zero values keep the defaults of http.DefaultTransport.
+type TransportConfig struct {
+	// MaxIdleConns limits the idle connections across all the hosts
+	MaxIdleConns int `json:"max-idle-conns"`
+	// MaxIdleConnsPerHost limits the idle connections kept for each host
+	MaxIdleConnsPerHost int `json:"max-idle-conns-per-host"`
+	// MaxConnsPerHost limits the connections (active and idle) to each host
+	MaxConnsPerHost int `json:"max-conns-per-host"`
+	// IdleConnTimeout is the time after which an idle connection is closed
+	IdleConnTimeout string `json:"idle-conn-timeout"`
+	// KeepAlive is the interval of the TCP keep-alive probes
+	KeepAlive string `json:"keep-alive"`
+	// DisableKeepAlives closes the connections after every request
+	DisableKeepAlives bool `json:"disable-keep-alives"`
+	// HTTP2 enables HTTP/2 for the HTTPS services, defaults to true
+	HTTP2 *bool `json:"http2"`
+	// TLS configures the connections to the HTTPS services
+	TLS *TLSConfig `json:"tls"`
+}
+
+// TLSConfig configures the TLS connections to the services
+type TLSConfig struct {
+	// CAFile is a PEM file of the certificate authorities used to verify the
+	// services, the system ones are used if empty
+	CAFile string `json:"ca-file"`
+	// CertFile and KeyFile are the PEM files of the client certificate
+	CertFile string `json:"cert-file"`
+	KeyFile  string `json:"key-file"`
+	// ServerName overrides the name used to verify the service certificates
+	ServerName         string `json:"server-name"`
+	InsecureSkipVerify bool   `json:"insecure-skip-verify"`
+}
+
+// IsZero returns whether the config doesn't change the default transport
+func (t TransportConfig) IsZero() bool {
+	return t.MaxIdleConns == 0 && t.MaxIdleConnsPerHost == 0 && t.MaxConnsPerHost == 0 &&
+		t.IdleConnTimeout == "" && t.KeepAlive == "" && !t.DisableKeepAlives &&
+		t.HTTP2 == nil && t.TLS == nil
+}
+
+// override returns the config with the non-zero values of o replacing its own
+func (t TransportConfig) override(o TransportConfig) TransportConfig {
+	if o.MaxIdleConns != 0 {
+		t.MaxIdleConns = o.MaxIdleConns
+	}
+	if o.MaxIdleConnsPerHost != 0 {
+		t.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	if o.MaxConnsPerHost != 0 {
+		t.MaxConnsPerHost = o.MaxConnsPerHost
+	}
+	if o.IdleConnTimeout != "" {
+		t.IdleConnTimeout = o.IdleConnTimeout
+	}
+	if o.KeepAlive != "" {
+		t.KeepAlive = o.KeepAlive
+	}
+	if o.DisableKeepAlives {
+		t.DisableKeepAlives = true
+	}
+	if o.HTTP2 != nil {
+		t.HTTP2 = o.HTTP2
+	}
+	if o.TLS != nil {
+		t.TLS = o.TLS
+	}
+	return t
+}
+
+// Build creates the HTTP transport described by the config
+func (t TransportConfig) Build() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if t.MaxIdleConns != 0 {
+		transport.MaxIdleConns = t.MaxIdleConns
+	}
+	if t.MaxIdleConnsPerHost != 0 {
+		transport.MaxIdleConnsPerHost = t.MaxIdleConnsPerHost
+	}
+	if t.MaxConnsPerHost != 0 {
+		transport.MaxConnsPerHost = t.MaxConnsPerHost
+	}
+	if t.IdleConnTimeout != "" {
+		timeout, err := time.ParseDuration(t.IdleConnTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid idle connection timeout: %w", err)
+		}
+		transport.IdleConnTimeout = timeout
+	}
+	if t.KeepAlive != "" {
+		keepAlive, err := time.ParseDuration(t.KeepAlive)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keep-alive: %w", err)
+		}
+		// same dialer as http.DefaultTransport
+		transport.DialContext = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: keepAlive,
+		}).DialContext
+	}
+	transport.DisableKeepAlives = t.DisableKeepAlives
+
+	if t.TLS != nil {
+		tlsConfig, err := t.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	if t.HTTP2 != nil && !*t.HTTP2 {
+		// a non-nil empty map disables HTTP/2
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return transport, nil
+}
+
+func (c *TLSConfig) build() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file %q", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Transports are the HTTP transports of the requests to the services, by
+// URL. A nil Transports uses the transport of the HTTP client.
+type Transports struct {
+	defaultTransport http.RoundTripper
+	byURL            map[string]http.RoundTripper
+}
+
+// NewTransports builds the transports of the services from the global
+// config and the per-service configs (by service URL). The per-service
+// transports are also used for the endpoints and replicas of the services.
+// It returns nil if no transport is configured.
+func NewTransports(global TransportConfig, services map[string]TransportConfig, endpoints map[string]ServiceEndpoints, replicas map[string][]string) (*Transports, error) {
+	if global.IsZero() && len(services) == 0 {
+		return nil, nil
+	}
+
+	defaultTransport, err := global.Build()
+	if err != nil {
+		return nil, err
+	}
+	t := &Transports{
+		defaultTransport: defaultTransport,
+		byURL:            make(map[string]http.RoundTripper),
+	}
+	for url, config := range services {
+		transport, err := global.override(config).Build()
+		if err != nil {
+			return nil, fmt.Errorf("invalid transport for service %q: %w", url, err)
+		}
+		t.byURL[url] = transport
+		for _, endpoint := range endpoints[url].allURLs() {
+			t.byURL[endpoint] = transport
+		}
+		for _, replica := range replicas[url] {
+			t.byURL[replica] = transport
+		}
+	}
+	return t, nil
+}
+
+// withHandlers returns the transports with the requests to the given URLs
+// passed directly to their handler
+func (t *Transports) withHandlers(handlers map[string]http.Handler) *Transports {
+	if len(handlers) == 0 {
+		return t
+	}
+	result := &Transports{byURL: make(map[string]http.RoundTripper)}
+	if t != nil {
+		result.defaultTransport = t.defaultTransport
+		for url, transport := range t.byURL {
+			result.byURL[url] = transport
+		}
+	}
+	for url, h := range handlers {
+		result.byURL[url] = localTransport{handler: h}
+	}
+	return result
+}
+
+// For returns the transport of the requests to the given URL
+func (t *Transports) For(url string) http.RoundTripper {
+	if t == nil {
+		return nil
+	}
+	if transport, ok := t.byURL[url]; ok {
+		return transport
+	}
+	return t.defaultTransport
+}
@@ -0,0 +1,127 @@
+package bramble
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportConfigBuild(t *testing.T) {
+	t.Run("zero config keeps the defaults", func(t *testing.T) {
+		transport, err := TransportConfig{}.Build()
+		require.NoError(t, err)
+		defaultTransport := http.DefaultTransport.(*http.Transport)
+		assert.Equal(t, defaultTransport.MaxIdleConns, transport.MaxIdleConns)
+		assert.Equal(t, defaultTransport.IdleConnTimeout, transport.IdleConnTimeout)
+		assert.True(t, transport.ForceAttemptHTTP2)
+	})
+
+	t.Run("pooling options", func(t *testing.T) {
+		transport, err := TransportConfig{
+			MaxIdleConns:        500,
+			MaxIdleConnsPerHost: 100,
+			MaxConnsPerHost:     200,
+			IdleConnTimeout:     "30s",
+			KeepAlive:           "15s",
+		}.Build()
+		require.NoError(t, err)
+		assert.Equal(t, 500, transport.MaxIdleConns)
+		assert.Equal(t, 100, transport.MaxIdleConnsPerHost)
+		assert.Equal(t, 200, transport.MaxConnsPerHost)
+		assert.Equal(t, 30*time.Second, transport.IdleConnTimeout)
+	})
+
+	t.Run("invalid durations", func(t *testing.T) {
+		_, err := TransportConfig{IdleConnTimeout: "soon"}.Build()
+		assert.Error(t, err)
+		_, err = TransportConfig{KeepAlive: "often"}.Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("missing CA file", func(t *testing.T) {
+		_, err := TransportConfig{TLS: &TLSConfig{CAFile: filepath.Join(t.TempDir(), "ca.pem")}}.Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestTransportConfigHTTP2AndTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{ "data": { "proto": "` + r.Proto + `" } }`))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(caFile, certPEM, 0600))
+
+	request := func(config TransportConfig) (string, error) {
+		transports, err := NewTransports(config, nil, nil, nil)
+		require.NoError(t, err)
+		var res struct {
+			Proto string
+		}
+		err = NewClient(WithTransports(transports)).Request(context.Background(), srv.URL, &Request{}, &res)
+		return res.Proto, err
+	}
+
+	t.Run("unknown certificate authority", func(t *testing.T) {
+		_, err := request(TransportConfig{MaxIdleConns: 10})
+		assert.Error(t, err)
+	})
+
+	t.Run("HTTP/2 is enabled by default", func(t *testing.T) {
+		proto, err := request(TransportConfig{TLS: &TLSConfig{CAFile: caFile}})
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/2.0", proto)
+	})
+
+	t.Run("HTTP/2 can be disabled", func(t *testing.T) {
+		http2 := false
+		proto, err := request(TransportConfig{TLS: &TLSConfig{CAFile: caFile}, HTTP2: &http2})
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/1.1", proto)
+	})
+}
+
+func TestNewTransports(t *testing.T) {
+	t.Run("no config", func(t *testing.T) {
+		transports, err := NewTransports(TransportConfig{}, nil, nil, nil)
+		require.NoError(t, err)
+		assert.Nil(t, transports)
+		assert.Nil(t, transports.For("http://movies/query"))
+	})
+
+	t.Run("per-service transports override the global config", func(t *testing.T) {
+		transports, err := NewTransports(
+			TransportConfig{MaxIdleConnsPerHost: 10, IdleConnTimeout: "30s"},
+			map[string]TransportConfig{"http://movies/query": {MaxIdleConnsPerHost: 100}},
+			map[string]ServiceEndpoints{"http://movies/query": {URLs: []string{"http://movies-1/query"}}},
+			map[string][]string{"http://movies/query": {"http://movies-replica/query"}},
+		)
+		require.NoError(t, err)
+
+		global := transports.For("http://actors/query").(*http.Transport)
+		assert.Equal(t, 10, global.MaxIdleConnsPerHost)
+
+		movies := transports.For("http://movies/query").(*http.Transport)
+		assert.Equal(t, 100, movies.MaxIdleConnsPerHost)
+		assert.Equal(t, 30*time.Second, movies.IdleConnTimeout)
+		assert.Same(t, movies, transports.For("http://movies-1/query"))
+		assert.Same(t, movies, transports.For("http://movies-replica/query"))
+	})
+
+	t.Run("invalid per-service config", func(t *testing.T) {
+		_, err := NewTransports(TransportConfig{}, map[string]TransportConfig{"http://movies/query": {KeepAlive: "never"}}, nil, nil)
+		assert.Error(t, err)
+	})
+}
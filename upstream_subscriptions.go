@@ -0,0 +1,409 @@
+package bramble
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// subscriptionBufferSize is the number of events buffered for each
+	// subscriber, the events received while the buffer is full are dropped
+	subscriptionBufferSize = 32
+	// defaultSubscriptionKeepAlive is the default interval of the pings sent
+	// to the services, a connection not receiving any message for twice the
+	// interval is considered lost
+	defaultSubscriptionKeepAlive = 30 * time.Second
+	// subscriptionMaxReconnects is the number of consecutive failed attempts
+	// to reconnect after which a lost subscription is terminated
+	subscriptionMaxReconnects = 10
+	// subscriptionReconnectBackoff is the delay before the first reconnection
+	// attempt, doubled for each subsequent attempt up to
+	// subscriptionMaxReconnectBackoff
+	subscriptionReconnectBackoff    = 100 * time.Millisecond
+	subscriptionMaxReconnectBackoff = 10 * time.Second
+	// upstreamSubscriptionID is the ID of the subscription in the upstream
+	// connection, each connection carries a single subscription
+	upstreamSubscriptionID = "1"
+)
+
+// subscriptionEvent is an event of a subscription to a service
+type subscriptionEvent struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors GraphqlErrors              `json:"errors"`
+}
+
+// subscriptionKey identifies the identical subscriptions to a service. The
+// headers are part of the key so the clients with different credentials
+// don't share their subscriptions, except for the request ID which is unique
+// to each request.
+type subscriptionKey struct {
+	url       string
+	query     string
+	variables string
+	headers   string
+}
+
+func newSubscriptionKey(url string, req *Request) subscriptionKey {
+	// maps are marshalled with sorted keys
+	variables, _ := json.Marshal(req.Variables)
+
+	return subscriptionKey{
+		url:       url,
+		query:     req.Query,
+		variables: string(variables),
+		headers:   headersKey(req.Headers),
+	}
+}
+
+// headersKey formats the headers with sorted names, except for the request ID
+// which is unique to each request
+func headersKey(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		if name == http.CanonicalHeaderKey(requestIDHeader) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&headers, "%s: %s\n", name, strings.Join(header[name], ", "))
+	}
+	return headers.String()
+}
+
+// upstreamSubscriptions multiplexes the subscriptions to the services: the
+// identical subscriptions of all the clients share a single upstream
+// websocket connection, and its events are fanned out to every subscriber.
+// It is safe for concurrent use.
+type upstreamSubscriptions struct {
+	// mu protects the subscriptions and their subscribers, the events are
+	// sent and the subscriber channels closed with mu held
+	mu            sync.Mutex
+	subscriptions map[subscriptionKey]*upstreamSubscription
+}
+
+func newUpstreamSubscriptions() *upstreamSubscriptions {
+	return &upstreamSubscriptions{
+		subscriptions: make(map[subscriptionKey]*upstreamSubscription),
+	}
+}
+
+// subscriber is a client of an upstream subscription. The events channel is
+// closed once the subscription is over.
+type subscriber struct {
+	events   chan subscriptionEvent
+	upstream *upstreamSubscription
+}
+
+// subscribe subscribes to the service, sharing the upstream subscription
+// with the identical subscriptions
+func (u *upstreamSubscriptions) subscribe(client *GraphQLClient, keepAlive time.Duration, url string, req *Request) *subscriber {
+	key := newSubscriptionKey(url, req)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	upstream, ok := u.subscriptions[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		upstream = &upstreamSubscription{
+			parent:      u,
+			key:         key,
+			url:         url,
+			request:     req,
+			client:      client,
+			keepAlive:   keepAlive,
+			ctx:         ctx,
+			cancel:      cancel,
+			subscribers: make(map[*subscriber]struct{}),
+		}
+		u.subscriptions[key] = upstream
+		promUpstreamSubscriptions.Inc()
+		go upstream.run()
+	}
+
+	s := &subscriber{
+		events:   make(chan subscriptionEvent, subscriptionBufferSize),
+		upstream: upstream,
+	}
+	upstream.subscribers[s] = struct{}{}
+	return s
+}
+
+// unsubscribe removes the subscriber, the upstream subscription is
+// terminated when its last subscriber leaves
+func (s *subscriber) unsubscribe() {
+	u := s.upstream.parent
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := s.upstream.subscribers[s]; !ok {
+		return
+	}
+	delete(s.upstream.subscribers, s)
+	close(s.events)
+	if len(s.upstream.subscribers) == 0 {
+		s.upstream.cancel()
+		u.removeLocked(s.upstream)
+	}
+}
+
+// removeLocked removes the upstream subscription and closes the channels of
+// its subscribers. The mutex must be held.
+func (u *upstreamSubscriptions) removeLocked(upstream *upstreamSubscription) {
+	if u.subscriptions[upstream.key] != upstream {
+		return
+	}
+	delete(u.subscriptions, upstream.key)
+	promUpstreamSubscriptions.Dec()
+	for s := range upstream.subscribers {
+		close(s.events)
+		delete(upstream.subscribers, s)
+	}
+}
+
+// upstreamSubscription is a subscription to a service, shared by all its
+// subscribers
+type upstreamSubscription struct {
+	parent    *upstreamSubscriptions
+	key       subscriptionKey
+	url       string
+	request   *Request
+	client    *GraphQLClient
+	keepAlive time.Duration
+	// ctx is cancelled when the last subscriber leaves
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	subscribers map[*subscriber]struct{}
+}
+
+// run connects to the service and forwards the events to the subscribers.
+// Lost connections are re-established and the subscription resubscribed.
+func (s *upstreamSubscription) run() {
+	defer func() {
+		s.parent.mu.Lock()
+		s.parent.removeLocked(s)
+		s.parent.mu.Unlock()
+		s.cancel()
+	}()
+
+	logger := log.WithFields(log.Fields{"url": s.url, "query": s.request.Query})
+	established := false
+	failures := 0
+	backoff := subscriptionReconnectBackoff
+	for {
+		connected, err := s.serve()
+		if s.ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			// the service completed the subscription
+			return
+		}
+		if connected {
+			established = true
+			failures = 0
+			backoff = subscriptionReconnectBackoff
+		}
+		// the first connection isn't retried, the clients are told right
+		// away the subscription failed
+		if !established || failures >= subscriptionMaxReconnects {
+			logger.WithError(err).Warn("subscription to service failed")
+			s.broadcast(subscriptionEvent{Errors: GraphqlErrors{{Message: fmt.Sprintf("subscription to service failed: %s", err)}}})
+			return
+		}
+
+		logger.WithError(err).Info("subscription connection lost, reconnecting")
+		failures++
+		select {
+		case <-time.After(backoff):
+		case <-s.ctx.Done():
+			return
+		}
+		backoff *= 2
+		if backoff > subscriptionMaxReconnectBackoff {
+			backoff = subscriptionMaxReconnectBackoff
+		}
+	}
+}
+
+// broadcast sends the event to every subscriber. The event is dropped for
+// the subscribers whose buffer is full rather than slowing down the others.
+func (s *upstreamSubscription) broadcast(event subscriptionEvent) {
+	s.parent.mu.Lock()
+	defer s.parent.mu.Unlock()
+	for sub := range s.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			promDroppedSubscriptionEvents.Inc()
+		}
+	}
+}
+
+// serve connects to the service, subscribes and forwards the events until
+// the subscription is completed (nil error), the connection is lost or the
+// subscription cancelled. It returns whether the subscription was
+// established.
+func (s *upstreamSubscription) serve() (bool, error) {
+	conn, err := s.dial()
+	if err != nil {
+		return false, err
+	}
+	var writeMutex sync.Mutex
+	write := func(msg *wsMessage) error {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(s.keepAlive))
+		return conn.WriteJSON(msg)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(s.keepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				conn.Close()
+				return
+			case <-s.ctx.Done():
+				_ = write(&wsMessage{ID: upstreamSubscriptionID, Type: wsCompleteMsg})
+				conn.Close()
+				return
+			case <-ticker.C:
+				_ = write(&wsMessage{Type: wsPingMsg})
+			}
+		}
+	}()
+
+	read := func() (*wsMessage, error) {
+		conn.SetReadDeadline(time.Now().Add(2 * s.keepAlive))
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return nil, err
+		}
+		return &msg, nil
+	}
+
+	if err := write(&wsMessage{Type: wsConnectionInitMsg}); err != nil {
+		return false, err
+	}
+	for {
+		msg, err := read()
+		if err != nil {
+			return false, err
+		}
+		if msg.Type == wsConnectionAckMsg {
+			break
+		}
+		if msg.Type == wsPingMsg {
+			_ = write(&wsMessage{Type: wsPongMsg})
+		}
+	}
+
+	request, aliases, err := s.client.Aliases.translateRequest(s.url, s.request)
+	if err != nil {
+		return false, err
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return false, err
+	}
+	if err := write(&wsMessage{ID: upstreamSubscriptionID, Type: wsSubscribeMsg, Payload: payload}); err != nil {
+		return false, err
+	}
+
+	for {
+		msg, err := read()
+		if err != nil {
+			return true, err
+		}
+		switch msg.Type {
+		case wsNextMsg:
+			var event subscriptionEvent
+			payload, err := aliases.translateResponse(bytes.NewReader(msg.Payload))
+			if err == nil {
+				err = json.NewDecoder(payload).Decode(&event)
+			}
+			if err != nil {
+				return true, fmt.Errorf("error decoding event: %w", err)
+			}
+			s.broadcast(event)
+		case wsErrorMsg:
+			var errs GraphqlErrors
+			if err := json.Unmarshal(msg.Payload, &errs); err != nil || len(errs) == 0 {
+				errs = GraphqlErrors{{Message: "subscription rejected by service"}}
+			}
+			s.broadcast(subscriptionEvent{Errors: errs})
+			return true, nil
+		case wsCompleteMsg:
+			return true, nil
+		case wsPingMsg:
+			_ = write(&wsMessage{Type: wsPongMsg})
+		}
+	}
+}
+
+// dial opens the websocket connection to the service, with the request
+// headers, the credentials and the TLS configuration of the service
+func (s *upstreamSubscription) dial() (*websocket.Conn, error) {
+	if isLocalServiceURL(s.url) {
+		return nil, errors.New("subscriptions are not supported by local services")
+	}
+	url := s.url
+	switch {
+	case strings.HasPrefix(url, "https://"):
+		url = "wss://" + strings.TrimPrefix(url, "https://")
+	case strings.HasPrefix(url, "http://"):
+		url = "ws://" + strings.TrimPrefix(url, "http://")
+	}
+
+	header := make(http.Header)
+	for name, values := range s.request.Headers {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("User-Agent", s.client.UserAgent)
+
+	dialer := &websocket.Dialer{
+		Subprotocols:     []string{graphqlTransportWSProtocol},
+		HandshakeTimeout: s.keepAlive,
+		Proxy:            http.ProxyFromEnvironment,
+	}
+	if transport, ok := s.client.Transports.For(s.url).(*http.Transport); ok {
+		dialer.TLSClientConfig = transport.TLSClientConfig
+	}
+	if auth := s.client.Credentials.authorizerFor(s.url); auth != nil {
+		authorization, err := auth.authorization(s.ctx)
+		if err != nil {
+			return nil, err
+		}
+		header.Set("Authorization", authorization)
+	}
+
+	conn, res, err := dialer.DialContext(s.ctx, url, header)
+	if err != nil {
+		if res != nil {
+			return nil, fmt.Errorf("%w (status %d)", err, res.StatusCode)
+		}
+		return nil, err
+	}
+	if conn.Subprotocol() != graphqlTransportWSProtocol {
+		conn.Close()
+		return nil, errors.New("service doesn't support the graphql-transport-ws protocol")
+	}
+	return conn, nil
+}
@@ -0,0 +1,257 @@
+package bramble
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// subscriptionTestService is a service serving its subscriptions with the
+// graphql-transport-ws protocol
+type subscriptionTestService struct {
+	srv *httptest.Server
+
+	mu          sync.Mutex
+	connections int
+	active      map[*websocket.Conn]*sync.Mutex
+	// subscribed receives the payload of the subscribe messages
+	subscribed chan string
+	// completed receives a value for every complete message
+	completed chan struct{}
+}
+
+func newSubscriptionTestService(t *testing.T) *subscriptionTestService {
+	t.Helper()
+	s := &subscriptionTestService{
+		active:     make(map[*websocket.Conn]*sync.Mutex),
+		subscribed: make(chan string, 10),
+		completed:  make(chan struct{}, 10),
+	}
+	service := testServiceHandler("movies", `type Service {
+		name: String!
+		version: String!
+		schema: String!
+	}
+
+	type Movie {
+		id: ID!
+		title: String
+	}
+
+	type Query {
+		service: Service!
+	}
+
+	type Subscription {
+		movieUpdated(id: ID!): Movie
+	}`, nil)
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			s.serveWS(t, w, r)
+			return
+		}
+		service.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+func (s *subscriptionTestService) serveWS(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{graphqlTransportWSProtocol}}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	s.mu.Lock()
+	s.connections++
+	s.mu.Unlock()
+
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != wsConnectionInitMsg {
+		return
+	}
+	conn.WriteJSON(wsMessage{Type: wsConnectionAckMsg})
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != wsSubscribeMsg {
+		return
+	}
+	assert.Equal(t, upstreamSubscriptionID, msg.ID)
+	s.mu.Lock()
+	s.active[conn] = &sync.Mutex{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.active, conn)
+		s.mu.Unlock()
+	}()
+	s.subscribed <- string(msg.Payload)
+
+	for {
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg.Type == wsCompleteMsg {
+			s.completed <- struct{}{}
+			return
+		}
+	}
+}
+
+// send sends the event to all the active subscriptions
+func (s *subscriptionTestService) send(payload string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, m := range s.active {
+		m.Lock()
+		conn.WriteJSON(wsMessage{ID: upstreamSubscriptionID, Type: wsNextMsg, Payload: json.RawMessage(payload)})
+		m.Unlock()
+	}
+}
+
+// drop closes the connections of all the active subscriptions
+func (s *subscriptionTestService) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.active {
+		conn.Close()
+	}
+}
+
+func (s *subscriptionTestService) connectionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+func (s *subscriptionTestService) waitSubscribed(t *testing.T) string {
+	t.Helper()
+	select {
+	case payload := <-s.subscribed:
+		return payload
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the subscription")
+		return ""
+	}
+}
+
+func newSubscriptionTestGateway(t *testing.T, service *subscriptionTestService) *httptest.Server {
+	t.Helper()
+	es := newExecutableSchema(nil, 50, nil, NewService(service.srv.URL))
+	require.NoError(t, es.UpdateSchema(true))
+	gateway := httptest.NewServer(NewGateway(es, nil).Router())
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+func subscribeWS(t *testing.T, gateway *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+	conn := dialGraphqlTransportWS(t, gateway)
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsConnectionInitMsg}))
+	require.Equal(t, wsConnectionAckMsg, readWSMessage(t, conn).Type)
+	payload, _ := json.Marshal(map[string]string{"query": query})
+	require.NoError(t, conn.WriteJSON(wsMessage{ID: "1", Type: wsSubscribeMsg, Payload: payload}))
+	return conn
+}
+
+func TestSubscriptionMultiplexing(t *testing.T) {
+	t.Run("identical subscriptions share the upstream subscription", func(t *testing.T) {
+		service := newSubscriptionTestService(t)
+		gateway := newSubscriptionTestGateway(t, service)
+
+		query := `subscription { movieUpdated(id: "1") { title } }`
+		first := subscribeWS(t, gateway, query)
+		payload := service.waitSubscribed(t)
+		assert.Contains(t, payload, `movieUpdated(id: \"1\")`)
+		assert.True(t, strings.HasPrefix(subscriptionRequestQuery(t, payload), "subscription "))
+		second := subscribeWS(t, gateway, query)
+
+		// the second subscription is registered once its own plan is done,
+		// wait for it by sending events until it gets one
+		require.Eventually(t, func() bool {
+			service.send(`{ "data": { "movieUpdated": { "title": "Test title" } } }`)
+			second.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			var msg wsMessage
+			return second.ReadJSON(&msg) == nil && msg.Type == wsNextMsg
+		}, 5*time.Second, 10*time.Millisecond)
+		second.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		msg := readWSMessage(t, first)
+		assert.Equal(t, wsNextMsg, msg.Type)
+		assert.JSONEq(t, `{ "data": { "movieUpdated": { "title": "Test title" } } }`, string(msg.Payload))
+		assert.Equal(t, 1, service.connectionCount())
+
+		other := subscribeWS(t, gateway, `subscription { movieUpdated(id: "2") { title } }`)
+		assert.Contains(t, service.waitSubscribed(t), `movieUpdated(id: \"2\")`)
+		assert.Equal(t, 2, service.connectionCount())
+		other.WriteJSON(wsMessage{ID: "1", Type: wsCompleteMsg})
+
+		// the upstream subscription is completed once all the clients left
+		require.NoError(t, first.WriteJSON(wsMessage{ID: "1", Type: wsCompleteMsg}))
+		require.NoError(t, second.WriteJSON(wsMessage{ID: "1", Type: wsCompleteMsg}))
+		for i := 0; i < 2; i++ {
+			select {
+			case <-service.completed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the upstream subscriptions weren't completed")
+			}
+		}
+	})
+
+	t.Run("lost connections are resubscribed", func(t *testing.T) {
+		service := newSubscriptionTestService(t)
+		gateway := newSubscriptionTestGateway(t, service)
+
+		conn := subscribeWS(t, gateway, `subscription { movieUpdated(id: "1") { title } }`)
+		service.waitSubscribed(t)
+		service.send(`{ "data": { "movieUpdated": { "title": "First" } } }`)
+		assert.JSONEq(t, `{ "data": { "movieUpdated": { "title": "First" } } }`, string(readWSMessage(t, conn).Payload))
+
+		service.drop()
+		service.waitSubscribed(t)
+		service.send(`{ "data": { "movieUpdated": { "title": "Second" } } }`)
+		assert.JSONEq(t, `{ "data": { "movieUpdated": { "title": "Second" } } }`, string(readWSMessage(t, conn).Payload))
+		assert.Equal(t, 2, service.connectionCount())
+	})
+
+	t.Run("subscription failure", func(t *testing.T) {
+		service := newSubscriptionTestService(t)
+		gateway := newSubscriptionTestGateway(t, service)
+		// the service is down when the client subscribes
+		service.srv.Close()
+
+		conn := subscribeWS(t, gateway, `subscription { movieUpdated(id: "1") { title } }`)
+		msg := readWSMessage(t, conn)
+		assert.Equal(t, wsNextMsg, msg.Type)
+		assert.Contains(t, string(msg.Payload), "subscription to service failed")
+		assert.Equal(t, wsCompleteMsg, readWSMessage(t, conn).Type)
+	})
+}
+
+func TestUpstreamSubscriptionDropsEventsForSlowSubscribers(t *testing.T) {
+	subscriptions := newUpstreamSubscriptions()
+	upstream := &upstreamSubscription{parent: subscriptions, subscribers: make(map[*subscriber]struct{})}
+	slow := &subscriber{events: make(chan subscriptionEvent, 1), upstream: upstream}
+	fast := &subscriber{events: make(chan subscriptionEvent, 2), upstream: upstream}
+	upstream.subscribers[slow] = struct{}{}
+	upstream.subscribers[fast] = struct{}{}
+
+	upstream.broadcast(subscriptionEvent{})
+	upstream.broadcast(subscriptionEvent{})
+	assert.Len(t, slow.events, 1)
+	assert.Len(t, fast.events, 2)
+}
+
+func subscriptionRequestQuery(t *testing.T, payload string) string {
+	t.Helper()
+	var req Request
+	require.NoError(t, json.Unmarshal([]byte(payload), &req))
+	return req.Query
+}
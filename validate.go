@@ -18,6 +18,9 @@ func ValidateSchema(schema *ast.Schema) error {
 	if err := validateNamespaceObjects(schema); err != nil {
 		return err
 	}
+	if err := validateRequiresDirectives(schema); err != nil {
+		return err
+	}
 	if err := validateServiceQuery(schema); err != nil {
 		return err
 	}
@@ -304,8 +307,10 @@ func validateBoundaryDirective(schema *ast.Schema) error {
 		if d.Name != boundaryDirectiveName {
 			continue
 		}
-		if len(d.Arguments) != 0 {
-			return fmt.Errorf("@boundary directive may not take arguments")
+		for _, arg := range d.Arguments {
+			if (arg.Name != boundaryKeyArgumentName && arg.Name != boundaryCacheTTLArgumentName) || arg.Type.String() != "String" {
+				return fmt.Errorf(`@boundary directive may only take "key: String" and "cacheTTL: String" arguments`)
+			}
 		}
 		if len(d.Locations) == 1 {
 			// compatibility with existing @boundary directives
@@ -367,17 +372,26 @@ func validateBoundaryFields(schema *ast.Schema) error {
 
 func validateBoundaryObjectsFormat(schema *ast.Schema) error {
 	for _, t := range schema.Types {
-		if t.Directives.ForName(boundaryDirectiveName) == nil {
+		d := t.Directives.ForName(boundaryDirectiveName)
+		if d == nil {
 			continue
 		}
 
+		if d.Arguments.ForName(boundaryKeyArgumentName) != nil {
+			return fmt.Errorf("the key argument of @boundary is only allowed on boundary queries, found on type %q", t.Name)
+		}
+
+		if d.Arguments.ForName(boundaryCacheTTLArgumentName) != nil {
+			return fmt.Errorf("the cacheTTL argument of @boundary is only allowed on boundary queries, found on type %q", t.Name)
+		}
+
 		idField := t.Fields.ForName(idFieldName)
 		if idField == nil {
 			return fmt.Errorf(`missing "id: ID!" field in boundary type %q`, t.Name)
 		}
 
-		if idField.Type.String() != "ID!" {
-			return fmt.Errorf(`id field should have type "ID!" in boundary type %q`, t.Name)
+		if !isBoundaryIDType(schema, idField.Type) {
+			return fmt.Errorf(`id field should have type "ID!", "String!", "Int!" or a custom scalar in boundary type %q`, t.Name)
 		}
 	}
 
@@ -387,7 +401,7 @@ func validateBoundaryObjectsFormat(schema *ast.Schema) error {
 func validateBoundaryQueries(schema *ast.Schema) error {
 	for _, f := range schema.Query.Fields {
 		if hasBoundaryDirective(f) {
-			if err := validateBoundaryQuery(f); err != nil {
+			if err := validateBoundaryQuery(schema, f); err != nil {
 				return fmt.Errorf("invalid boundary query %q: %w", f.Name, err)
 			}
 		}
@@ -396,15 +410,26 @@ func validateBoundaryQueries(schema *ast.Schema) error {
 	return nil
 }
 
-func validateBoundaryQuery(f *ast.FieldDefinition) error {
+// validateBoundaryQuery validates a boundary query. Without a key argument,
+// the single argument must have the type of the id field of the boundary type.
+func validateBoundaryQuery(schema *ast.Schema, f *ast.FieldDefinition) error {
+	if ttl, err := boundaryCacheTTL(f); err != nil || ttl < 0 {
+		return fmt.Errorf(`cacheTTL must be a positive duration (e.g. "10m")`)
+	}
+
+	if key := boundaryKeyArgument(f); key != "" {
+		return validateBoundaryQueryWithKey(schema, f, key)
+	}
+
+	idType := boundaryIDType(schema, f.Type.Name())
 	if len(f.Arguments) != 1 {
-		return fmt.Errorf(`boundary query must have a single "id: ID!" argument`)
+		return fmt.Errorf(`boundary query must have a single "%s" (or "[%s]") argument`, idType, idType)
 	}
 
 	if f.Arguments[0].Type.Elem != nil {
 		// array type check
-		if idsField := f.Arguments.ForName("ids"); idsField == nil || idsField.Type.String() != "[ID!]" {
-			return fmt.Errorf(`boundary query must have a single "id: ID!" argument`)
+		if f.Arguments[0].Type.String() != "["+idType+"]" {
+			return fmt.Errorf(`array boundary query must have a single "[%s]" argument`, idType)
 		}
 
 		if !f.Type.NonNull || f.Type.Elem == nil {
@@ -415,14 +440,155 @@ func validateBoundaryQuery(f *ast.FieldDefinition) error {
 	}
 
 	// regular type check
-	if idField := f.Arguments.ForName(idFieldName); idField == nil || idField.Type.String() != "ID!" {
-		return fmt.Errorf(`boundary query must have a single "id: ID!" argument`)
+	if f.Arguments[0].Type.String() != idType {
+		return fmt.Errorf(`boundary query must have a single "%s" argument`, idType)
+	}
+
+	if f.Type.NonNull {
+		return fmt.Errorf("return type of boundary query should be nullable")
+	}
+
+	return nil
+}
+
+// boundaryKeyScalars are the built-in types a boundary id or boundary query key
+// argument can have, custom scalars are allowed too
+var boundaryKeyScalars = map[string]bool{
+	"ID":     true,
+	"String": true,
+	"Int":    true,
+}
+
+// isBoundaryKeyScalar returns whether the named type can be the type of a
+// boundary id
+func isBoundaryKeyScalar(schema *ast.Schema, name string) bool {
+	if boundaryKeyScalars[name] {
+		return true
+	}
+	def := schema.Types[name]
+	return def != nil && def.Kind == ast.Scalar && !def.BuiltIn
+}
+
+// isBoundaryIDType returns whether the type can be the type of the id field
+// of a boundary type
+func isBoundaryIDType(schema *ast.Schema, t *ast.Type) bool {
+	return t.Elem == nil && t.NonNull && isBoundaryKeyScalar(schema, t.NamedType)
+}
+
+// boundaryIDType returns the type of the id field of the boundary type,
+// defaults to "ID!"
+func boundaryIDType(schema *ast.Schema, typeName string) string {
+	if def := schema.Types[typeName]; def != nil {
+		if f := def.Fields.ForName(idFieldName); f != nil && isBoundaryIDType(schema, f.Type) {
+			return f.Type.String()
+		}
+	}
+	return "ID!"
+}
+
+// validateBoundaryQueryWithKey validates a boundary query declaring its key
+// argument with @boundary(key: "..."). The other arguments must be optional.
+func validateBoundaryQueryWithKey(schema *ast.Schema, f *ast.FieldDefinition, key string) error {
+	arg := f.Arguments.ForName(key)
+	if arg == nil {
+		return fmt.Errorf("key argument %q not found", key)
+	}
+
+	for _, a := range f.Arguments {
+		if a.Name != key && a.Type.NonNull && a.DefaultValue == nil {
+			return fmt.Errorf("argument %q must be optional (nullable or with a default value)", a.Name)
+		}
+	}
+
+	if arg.Type.Elem != nil {
+		if !arg.Type.Elem.NonNull || !isBoundaryKeyScalar(schema, arg.Type.Elem.NamedType) {
+			return fmt.Errorf(`key argument %q must be a list of "ID!", "String!", "Int!" or a custom scalar`, key)
+		}
+		if !f.Type.NonNull || f.Type.Elem == nil {
+			return fmt.Errorf("return type should be a non-null array of nullable elements")
+		}
+		return nil
 	}
 
+	if !arg.Type.NonNull || !isBoundaryKeyScalar(schema, arg.Type.NamedType) {
+		return fmt.Errorf(`key argument %q must be of type "ID!", "String!", "Int!" or a custom scalar`, key)
+	}
 	if f.Type.NonNull {
 		return fmt.Errorf("return type of boundary query should be nullable")
 	}
+	return nil
+}
+
+// validateRequiresDirectives validates the fields declared with @requires:
+// the required fields must be resolved by other services and the boundary
+// query of the type must accept their values, as arguments or in the
+// representation objects of the array format.
+func validateRequiresDirectives(schema *ast.Schema) error {
+	for _, t := range schema.Types {
+		if t.Kind != ast.Object || isGraphQLBuiltinName(t.Name) {
+			continue
+		}
+		for _, f := range t.Fields {
+			if f.Directives.ForName(requiresDirectiveName) == nil {
+				continue
+			}
+			if err := validateRequiresDirective(schema, t, f); err != nil {
+				return fmt.Errorf("invalid @requires on %s.%s: %w", t.Name, f.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateRequiresDirective(schema *ast.Schema, t *ast.Definition, f *ast.FieldDefinition) error {
+	if !isBoundaryObject(t) {
+		return fmt.Errorf("@requires is only allowed on the fields of boundary types")
+	}
+	required := requiresDirectiveFields(f.Directives)
+	if len(required) == 0 {
+		return fmt.Errorf("no required fields")
+	}
+	for _, name := range required {
+		if t.Fields.ForName(name) != nil {
+			return fmt.Errorf("required field %q must be resolved by another service", name)
+		}
+	}
+
+	var query *ast.FieldDefinition
+	if schema.Query != nil {
+		for _, q := range schema.Query.Fields {
+			if hasBoundaryDirective(q) && q.Type.Name() == t.Name {
+				query = q
+				break
+			}
+		}
+	}
+	if query == nil {
+		return fmt.Errorf("missing boundary query for type %q", t.Name)
+	}
 
+	if query.Type.Elem == nil {
+		for _, name := range required {
+			if query.Arguments.ForName(name) == nil {
+				return fmt.Errorf("boundary query %q must have a %q argument", query.Name, name)
+			}
+		}
+		return nil
+	}
+
+	arg := query.Arguments.ForName(representationsArgumentName)
+	if arg == nil || arg.Type.Elem == nil {
+		return fmt.Errorf("array boundary query %q must have a %q list argument", query.Name, representationsArgumentName)
+	}
+	representation := schema.Types[arg.Type.Elem.Name()]
+	if representation == nil || representation.Kind != ast.InputObject {
+		return fmt.Errorf("argument %q of boundary query %q must be a list of input objects", representationsArgumentName, query.Name)
+	}
+	for _, name := range required {
+		if representation.Fields.ForName(name) == nil {
+			return fmt.Errorf("input type %q must have a %q field", representation.Name, name)
+		}
+	}
 	return nil
 }
 
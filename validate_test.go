@@ -77,10 +77,25 @@ func TestBoundaryDirectiveRequirements(t *testing.T) {
 		directive @boundary on FIELD | OBJECT
 		`).assertInvalid("@boundary directive should have locations OBJECT | FIELD_DEFINITION", validateBoundaryDirective)
 	})
+	t.Run("@boundary with a key argument", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+		`).assertValid(validateBoundaryDirective)
+	})
+	t.Run("@boundary with key and cacheTTL arguments", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String, cacheTTL: String) on OBJECT | FIELD_DEFINITION
+		`).assertValid(validateBoundaryDirective)
+	})
+	t.Run("@boundary key argument must be a nullable string", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String!) on OBJECT | FIELD_DEFINITION
+		`).assertInvalid(`@boundary directive may only take "key: String" and "cacheTTL: String" arguments`, validateBoundaryDirective)
+	})
 	t.Run("@boundary has no arguments", func(t *testing.T) {
 		withSchema(t, `
 		directive @boundary(id: String) on OBJECT
-		`).assertInvalid("@boundary directive may not take arguments", validateBoundaryDirective)
+		`).assertInvalid(`@boundary directive may only take "key: String" and "cacheTTL: String" arguments`, validateBoundaryDirective)
 	})
 	// @boundary does not need to be present
 	t.Run("@boundary not required", func(t *testing.T) {
@@ -96,7 +111,7 @@ func TestBoundaryDirectiveRequirements(t *testing.T) {
 		type Filler @boundary {
 			id: ID!
 		}
-		`).assertInvalid("@boundary directive may not take arguments", validateBoundaryObjects)
+		`).assertInvalid(`@boundary directive may only take "key: String" and "cacheTTL: String" arguments`, validateBoundaryObjects)
 	})
 	t.Run("@boundary is checked if it is used", func(t *testing.T) {
 		withSchema(t, `
@@ -104,7 +119,7 @@ func TestBoundaryDirectiveRequirements(t *testing.T) {
 		type Filler @boundary {
 			id: ID!
 		}
-		`).assertInvalid("@boundary directive may not take arguments", ValidateSchema)
+		`).assertInvalid(`@boundary directive may only take "key: String" and "cacheTTL: String" arguments`, ValidateSchema)
 	})
 }
 
@@ -621,6 +636,185 @@ func TestSchemaValidateBoundaryFields(t *testing.T) {
 		`).assertValid(validateBoundaryFields)
 	})
 
+	t.Run("custom boundary query argument names", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary on OBJECT | FIELD_DEFINITION
+
+		type Foo @boundary {
+			id: ID!
+		}
+
+		type Bar @boundary {
+			id: ID!
+		}
+
+		type Query {
+			foo(key: ID!): Foo @boundary
+			bars(keys: [ID!]): [Bar]! @boundary
+		}
+		`).assertValid(validateBoundaryQueries)
+	})
+
+	t.Run("invalid boundary query argument type", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary on OBJECT | FIELD_DEFINITION
+
+		type Foo @boundary {
+			id: ID!
+		}
+
+		type Query {
+			foo(key: String!): Foo @boundary
+		}
+		`).assertInvalid(`invalid boundary query "foo": boundary query must have a single "ID!" argument`, validateBoundaryQueries)
+	})
+
+	t.Run("boundary queries with the type of the id field", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary on OBJECT | FIELD_DEFINITION
+
+		scalar UUID
+
+		type Foo @boundary {
+			id: Int!
+		}
+
+		type Bar @boundary {
+			id: UUID!
+		}
+
+		type Query {
+			foo(id: Int!): Foo @boundary
+			bars(ids: [UUID!]): [Bar]! @boundary
+		}
+		`).assertValid(validateBoundaryQueries)
+	})
+
+	t.Run("boundary query argument not matching the id field", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary on OBJECT | FIELD_DEFINITION
+
+		type Foo @boundary {
+			id: Int!
+		}
+
+		type Query {
+			foo(id: ID!): Foo @boundary
+		}
+		`).assertInvalid(`invalid boundary query "foo": boundary query must have a single "Int!" argument`, validateBoundaryQueries)
+	})
+
+	t.Run("boundary queries with a key argument", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+
+		type Foo @boundary {
+			id: ID!
+		}
+
+		type Bar @boundary {
+			id: ID!
+		}
+
+		type Query {
+			getFoo(fooId: Int!, locale: String, limit: Int! = 10): Foo @boundary(key: "fooId")
+			getBars(barIds: [String!]!): [Bar]! @boundary(key: "barIds")
+		}
+		`).assertValid(validateBoundaryQueries)
+	})
+
+	t.Run("missing key argument", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+
+		type Foo @boundary {
+			id: ID!
+		}
+
+		type Query {
+			getFoo(id: ID!): Foo @boundary(key: "fooId")
+		}
+		`).assertInvalid(`invalid boundary query "getFoo": key argument "fooId" not found`, validateBoundaryQueries)
+	})
+
+	t.Run("required argument other than the key", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+
+		type Foo @boundary {
+			id: ID!
+		}
+
+		type Query {
+			getFoo(fooId: ID!, locale: String!): Foo @boundary(key: "fooId")
+		}
+		`).assertInvalid(`invalid boundary query "getFoo": argument "locale" must be optional (nullable or with a default value)`, validateBoundaryQueries)
+	})
+
+	t.Run("invalid key argument type", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+
+		type Foo @boundary {
+			id: ID!
+		}
+
+		type Query {
+			getFoo(fooId: Float!): Foo @boundary(key: "fooId")
+		}
+		`).assertInvalid(`invalid boundary query "getFoo": key argument "fooId" must be of type "ID!", "String!", "Int!" or a custom scalar`, validateBoundaryQueries)
+	})
+
+	t.Run("custom scalar key argument", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+
+		scalar UUID
+
+		type Foo @boundary {
+			id: ID!
+		}
+
+		type Query {
+			getFoos(fooIds: [UUID!]!): [Foo]! @boundary(key: "fooIds")
+		}
+		`).assertValid(validateBoundaryQueries)
+	})
+
+	t.Run("key argument on a boundary type", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+
+		type Foo @boundary(key: "id") {
+			id: ID!
+		}
+		`).assertInvalid(`the key argument of @boundary is only allowed on boundary queries, found on type "Foo"`, validateBoundaryObjectsFormat)
+	})
+
+	t.Run("cacheTTL argument on a boundary type", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(cacheTTL: String) on OBJECT | FIELD_DEFINITION
+
+		type Foo @boundary(cacheTTL: "1h") {
+			id: ID!
+		}
+		`).assertInvalid(`the cacheTTL argument of @boundary is only allowed on boundary queries, found on type "Foo"`, validateBoundaryObjectsFormat)
+	})
+
+	t.Run("invalid cacheTTL argument", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(cacheTTL: String) on OBJECT | FIELD_DEFINITION
+
+		type Foo @boundary {
+			id: ID!
+		}
+
+		type Query {
+			foo(id: ID!): Foo @boundary(cacheTTL: "forever")
+		}
+		`).assertInvalid(`invalid boundary query "foo": cacheTTL must be a positive duration (e.g. "10m")`, validateBoundaryQueries)
+	})
+
 	t.Run("invalid array boundary query", func(t *testing.T) {
 		withSchema(t, `
 		directive @boundary on OBJECT | FIELD_DEFINITION
@@ -682,4 +876,136 @@ func TestSchemaValidateBoundaryObjectsFormat(t *testing.T) {
 		}
 		`).assertInvalid(`missing "id: ID!" field in boundary type "Foo"`, validateBoundaryObjectsFormat)
 	})
+
+	t.Run("scalar id fields", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary on OBJECT | FIELD_DEFINITION
+
+		scalar UUID
+
+		type Foo @boundary {
+			id: Int!
+		}
+
+		type Bar @boundary {
+			id: UUID!
+		}
+		`).assertValid(validateBoundaryObjectsFormat)
+	})
+
+	t.Run("invalid id field type", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary on OBJECT | FIELD_DEFINITION
+
+		type Foo @boundary {
+			id: Float!
+		}
+		`).assertInvalid(`id field should have type "ID!", "String!", "Int!" or a custom scalar in boundary type "Foo"`, validateBoundaryObjectsFormat)
+	})
+}
+
+func TestSchemaValidateRequiresDirectives(t *testing.T) {
+	t.Run("boundary query with arguments", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+		directive @requires(fields: String!) on FIELD_DEFINITION
+
+		type Product @boundary {
+			id: ID!
+			shippingEstimate: Float @requires(fields: "weight size")
+		}
+
+		type Query {
+			product(id: ID!, weight: Float, size: Int): Product @boundary(key: "id")
+		}
+		`).assertValid(validateRequiresDirectives)
+	})
+
+	t.Run("array boundary query with representations", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+		directive @requires(fields: String!) on FIELD_DEFINITION
+
+		type Product @boundary {
+			id: ID!
+			shippingEstimate: Float @requires(fields: "weight")
+		}
+
+		input ProductRepresentation {
+			weight: Float
+		}
+
+		type Query {
+			products(ids: [ID!], representations: [ProductRepresentation!]): [Product]! @boundary(key: "ids")
+		}
+		`).assertValid(validateRequiresDirectives)
+	})
+
+	t.Run("missing argument", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+		directive @requires(fields: String!) on FIELD_DEFINITION
+
+		type Product @boundary {
+			id: ID!
+			shippingEstimate: Float @requires(fields: "weight")
+		}
+
+		type Query {
+			product(id: ID!): Product @boundary
+		}
+		`).assertInvalid(`invalid @requires on Product.shippingEstimate: boundary query "product" must have a "weight" argument`, validateRequiresDirectives)
+	})
+
+	t.Run("missing representation field", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+		directive @requires(fields: String!) on FIELD_DEFINITION
+
+		type Product @boundary {
+			id: ID!
+			shippingEstimate: Float @requires(fields: "weight")
+		}
+
+		input ProductRepresentation {
+			size: Int
+		}
+
+		type Query {
+			products(ids: [ID!], representations: [ProductRepresentation!]): [Product]! @boundary(key: "ids")
+		}
+		`).assertInvalid(`invalid @requires on Product.shippingEstimate: input type "ProductRepresentation" must have a "weight" field`, validateRequiresDirectives)
+	})
+
+	t.Run("field resolved by the service", func(t *testing.T) {
+		withSchema(t, `
+		directive @boundary(key: String) on OBJECT | FIELD_DEFINITION
+		directive @requires(fields: String!) on FIELD_DEFINITION
+
+		type Product @boundary {
+			id: ID!
+			weight: Float
+			shippingEstimate: Float @requires(fields: "weight")
+		}
+
+		type Query {
+			product(id: ID!, weight: Float): Product @boundary(key: "id")
+		}
+		`).assertInvalid(`invalid @requires on Product.shippingEstimate: required field "weight" must be resolved by another service`, validateRequiresDirectives)
+	})
+
+	t.Run("not a boundary type", func(t *testing.T) {
+		withSchema(t, `
+		directive @requires(fields: String!) on FIELD_DEFINITION
+
+		type Product {
+			id: ID!
+			shippingEstimate: Float @requires(fields: "weight")
+		}
+
+		type Query {
+			product: Product
+		}
+		`).assertInvalid(`invalid @requires on Product.shippingEstimate: @requires is only allowed on the fields of boundary types`, validateRequiresDirectives)
+	})
 }
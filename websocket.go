@@ -0,0 +1,331 @@
+package bramble
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// graphqlTransportWSProtocol is the subprotocol name of the
+// graphql-transport-ws protocol (https://github.com/enisdenjo/graphql-ws)
+const graphqlTransportWSProtocol = "graphql-transport-ws"
+
+const (
+	wsConnectionInitMsg = "connection_init" // Client -> Server
+	wsConnectionAckMsg  = "connection_ack"  // Server -> Client
+	wsPingMsg           = "ping"            // bidirectional
+	wsPongMsg           = "pong"            // bidirectional
+	wsSubscribeMsg      = "subscribe"       // Client -> Server
+	wsNextMsg           = "next"            // Server -> Client
+	wsErrorMsg          = "error"           // Server -> Client
+	wsCompleteMsg       = "complete"        // bidirectional
+)
+
+// graphql-transport-ws close codes
+const (
+	wsCloseBadRequest           = 4400
+	wsCloseUnauthorized         = 4401
+	wsCloseInitTimeout          = 4408
+	wsCloseSubscriberExists     = 4409
+	wsCloseTooManyInitRequests  = 4429
+	defaultWSConnectionInitWait = 10 * time.Second
+)
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// graphqlTransportWS is a gqlgen transport implementing the
+// graphql-transport-ws protocol. Every operation type can be executed over the
+// connection, not only subscriptions.
+// Operations run with the context of the upgrade request, so permissions and
+// outgoing headers set by middlewares (e.g. authentication plugins) apply to
+// every operation of the connection.
+type graphqlTransportWS struct {
+	Upgrader              websocket.Upgrader
+	ConnectionInitTimeout time.Duration
+	// acquireSubscription reserves a subscription slot for the client of
+	// the context, subscriptions aren't limited if nil
+	acquireSubscription func(ctx context.Context) (func(), *gqlerror.Error)
+	// shutdown is closed when the gateway shuts down, the connections are then
+	// closed with a going away status
+	shutdown <-chan struct{}
+}
+
+var _ graphql.Transport = graphqlTransportWS{}
+
+// Supports returns true for websocket upgrade requests negotiating the
+// graphql-transport-ws subprotocol.
+func (t graphqlTransportWS) Supports(r *http.Request) bool {
+	if !websocket.IsWebSocketUpgrade(r) {
+		return false
+	}
+	for _, p := range websocket.Subprotocols(r) {
+		if p == graphqlTransportWSProtocol {
+			return true
+		}
+	}
+	return false
+}
+
+// Do upgrades the connection and serves operations until the connection is
+// closed.
+func (t graphqlTransportWS) Do(w http.ResponseWriter, r *http.Request, exec graphql.GraphExecutor) {
+	upgrader := t.Upgrader
+	upgrader.Subprotocols = []string{graphqlTransportWSProtocol}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		GetLoggerFromContext(r.Context()).WithError(err).Info("unable to upgrade websocket connection")
+		return
+	}
+
+	initTimeout := t.ConnectionInitTimeout
+	if initTimeout == 0 {
+		initTimeout = defaultWSConnectionInitWait
+	}
+
+	limits, _ := GetRequestLimitsFromContext(r.Context())
+	if limits.MaxRequestBytes > 0 {
+		conn.SetReadLimit(limits.MaxRequestBytes)
+	}
+
+	c := &wsConnection{
+		conn:        conn,
+		ctx:         r.Context(),
+		exec:        exec,
+		limits:      limits,
+		initTimeout: initTimeout,
+		active:      make(map[string]context.CancelFunc),
+
+		acquireSubscription: t.acquireSubscription,
+		shutdown:            t.shutdown,
+	}
+	c.run()
+}
+
+type wsConnection struct {
+	conn        *websocket.Conn
+	ctx         context.Context
+	exec        graphql.GraphExecutor
+	limits      RequestLimits
+	initTimeout time.Duration
+
+	acquireSubscription func(ctx context.Context) (func(), *gqlerror.Error)
+	shutdown            <-chan struct{}
+
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	active     map[string]context.CancelFunc
+	acked      bool
+}
+
+func (c *wsConnection) run() {
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer func() {
+		cancel()
+		c.conn.Close()
+	}()
+
+	initTimer := time.AfterFunc(c.initTimeout, func() {
+		c.mutex.Lock()
+		acked := c.acked
+		c.mutex.Unlock()
+		if !acked {
+			c.close(wsCloseInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer initTimer.Stop()
+
+	if c.shutdown != nil {
+		go func() {
+			select {
+			case <-c.shutdown:
+				c.close(websocket.CloseGoingAway, "Server shutting down")
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	for {
+		var msg wsMessage
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.close(wsCloseBadRequest, "Invalid message received")
+			return
+		}
+
+		switch msg.Type {
+		case wsConnectionInitMsg:
+			c.mutex.Lock()
+			alreadyAcked := c.acked
+			c.acked = true
+			c.mutex.Unlock()
+			if alreadyAcked {
+				c.close(wsCloseTooManyInitRequests, "Too many initialisation requests")
+				return
+			}
+			c.write(&wsMessage{Type: wsConnectionAckMsg})
+		case wsPingMsg:
+			c.write(&wsMessage{Type: wsPongMsg})
+		case wsPongMsg:
+		case wsSubscribeMsg:
+			c.mutex.Lock()
+			acked := c.acked
+			_, exists := c.active[msg.ID]
+			c.mutex.Unlock()
+			if !acked {
+				c.close(wsCloseUnauthorized, "Unauthorized")
+				return
+			}
+			if msg.ID == "" {
+				c.close(wsCloseBadRequest, "Invalid message received")
+				return
+			}
+			if exists {
+				c.close(wsCloseSubscriberExists, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+				return
+			}
+			c.subscribe(ctx, &msg)
+		case wsCompleteMsg:
+			c.mutex.Lock()
+			cancelOperation := c.active[msg.ID]
+			c.mutex.Unlock()
+			if cancelOperation != nil {
+				cancelOperation()
+			}
+		default:
+			c.close(wsCloseBadRequest, fmt.Sprintf("Invalid message type %q", msg.Type))
+			return
+		}
+	}
+}
+
+func (c *wsConnection) subscribe(ctx context.Context, msg *wsMessage) {
+	start := graphql.Now()
+	ctx = graphql.StartOperationTrace(ctx)
+
+	var params *graphql.RawParams
+	decoder := json.NewDecoder(bytes.NewReader(msg.Payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&params); err != nil || params == nil {
+		c.sendError(msg.ID, &gqlerror.Error{Message: "invalid json"})
+		return
+	}
+	params.ReadTime = graphql.TraceTiming{
+		Start: start,
+		End:   graphql.Now(),
+	}
+
+	rc, err := c.exec.CreateOperationContext(ctx, params)
+	if err != nil {
+		resp := c.exec.DispatchError(graphql.WithOperationContext(ctx, rc), err)
+		if errcode.GetErrorKind(err) == errcode.KindProtocol {
+			c.sendError(msg.ID, resp.Errors...)
+			return
+		}
+		c.sendError(msg.ID, err...)
+		return
+	}
+
+	ctx = graphql.WithOperationContext(ctx, rc)
+
+	release := func() {}
+	if c.acquireSubscription != nil {
+		var limitErr *gqlerror.Error
+		release, limitErr = c.acquireSubscription(ctx)
+		if limitErr != nil {
+			c.sendError(msg.ID, limitErr)
+			return
+		}
+	}
+
+	var cancel context.CancelFunc
+	if c.limits.MaxResponseTime > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.limits.MaxResponseTime)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	c.mutex.Lock()
+	c.active[msg.ID] = cancel
+	c.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				userErr := rc.Recover(ctx, r)
+				c.sendError(msg.ID, &gqlerror.Error{Message: userErr.Error()})
+			}
+			c.mutex.Lock()
+			delete(c.active, msg.ID)
+			c.mutex.Unlock()
+			cancel()
+			release()
+		}()
+
+		responses, ctx := c.exec.DispatchOperation(ctx, rc)
+		for {
+			response := responses(ctx)
+			if response == nil {
+				break
+			}
+			// the client cancelled the operation, no more messages should be
+			// sent for it
+			if ctx.Err() == context.Canceled {
+				return
+			}
+			c.sendNext(msg.ID, response)
+		}
+		if ctx.Err() == context.Canceled {
+			return
+		}
+		c.write(&wsMessage{ID: msg.ID, Type: wsCompleteMsg})
+	}()
+}
+
+func (c *wsConnection) sendNext(id string, response *graphql.Response) {
+	payload, err := json.Marshal(response)
+	if err != nil {
+		c.sendError(id, &gqlerror.Error{Message: err.Error()})
+		return
+	}
+	c.write(&wsMessage{ID: id, Type: wsNextMsg, Payload: payload})
+}
+
+func (c *wsConnection) sendError(id string, errs ...*gqlerror.Error) {
+	payload, err := json.Marshal(errs)
+	if err != nil {
+		payload = []byte(fmt.Sprintf(`[{"message":%q}]`, err.Error()))
+	}
+	c.write(&wsMessage{ID: id, Type: wsErrorMsg, Payload: payload})
+}
+
+func (c *wsConnection) write(msg *wsMessage) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if err := c.conn.WriteJSON(msg); err != nil {
+		log.WithError(err).Debug("error writing websocket message")
+	}
+}
+
+func (c *wsConnection) close(code int, reason string) {
+	c.writeMutex.Lock()
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	c.writeMutex.Unlock()
+	_ = c.conn.Close()
+}
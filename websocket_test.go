@@ -0,0 +1,148 @@
+package bramble
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWebsocketTestGateway(t *testing.T) *httptest.Server {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query string
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if strings.Contains(req.Query, "service") {
+			schema := `type Service {
+				name: String!
+				version: String!
+				schema: String!
+			}
+
+			type Query {
+				test: String
+				service: Service!
+			}
+
+			type Mutation {
+				setTest(value: String!): String
+			}`
+			encodedSchema, _ := json.Marshal(schema)
+			fmt.Fprintf(w, `{
+				"data": {
+					"service": {
+						"schema": %s,
+						"version": "1.0",
+						"name": "test-service"
+					}
+				}
+			}`, string(encodedSchema))
+			return
+		}
+		if strings.HasPrefix(req.Query, "mutation") {
+			w.Write([]byte(`{ "data": { "setTest": "updated" }}`))
+			return
+		}
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.Write([]byte(`{ "data": { "test": "Hello" }}`))
+	}))
+	t.Cleanup(service.Close)
+
+	es := newExecutableSchema(nil, 50, nil, NewService(service.URL))
+	require.NoError(t, es.UpdateSchema(true))
+
+	router := NewGateway(es, nil).Router()
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := AddOutgoingRequestsHeaderToContext(r.Context(), "Authorization", "Bearer token")
+		router.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	t.Cleanup(gateway.Close)
+
+	return gateway
+}
+
+func dialGraphqlTransportWS(t *testing.T, server *httptest.Server) *websocket.Conn {
+	dialer := websocket.Dialer{Subprotocols: []string{graphqlTransportWSProtocol}}
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/query"
+	conn, resp, err := dialer.Dial(url, nil)
+	require.NoError(t, err)
+	require.Equal(t, graphqlTransportWSProtocol, resp.Header.Get("Sec-Websocket-Protocol"))
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func readWSMessage(t *testing.T, conn *websocket.Conn) wsMessage {
+	var msg wsMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func TestGraphqlTransportWS(t *testing.T) {
+	gateway := newWebsocketTestGateway(t)
+
+	t.Run("executes queries and mutations", func(t *testing.T) {
+		conn := dialGraphqlTransportWS(t, gateway)
+
+		require.NoError(t, conn.WriteJSON(wsMessage{Type: wsConnectionInitMsg}))
+		assert.Equal(t, wsConnectionAckMsg, readWSMessage(t, conn).Type)
+
+		require.NoError(t, conn.WriteJSON(wsMessage{Type: wsPingMsg}))
+		assert.Equal(t, wsPongMsg, readWSMessage(t, conn).Type)
+
+		require.NoError(t, conn.WriteJSON(wsMessage{ID: "1", Type: wsSubscribeMsg, Payload: json.RawMessage(`{"query": "{ test }"}`)}))
+		msg := readWSMessage(t, conn)
+		assert.Equal(t, wsNextMsg, msg.Type)
+		assert.Equal(t, "1", msg.ID)
+		assert.JSONEq(t, `{"data": {"test": "Hello"}}`, string(msg.Payload))
+		msg = readWSMessage(t, conn)
+		assert.Equal(t, wsCompleteMsg, msg.Type)
+		assert.Equal(t, "1", msg.ID)
+
+		require.NoError(t, conn.WriteJSON(wsMessage{ID: "2", Type: wsSubscribeMsg, Payload: json.RawMessage(`{"query": "mutation { setTest(value: \"updated\") }"}`)}))
+		msg = readWSMessage(t, conn)
+		assert.Equal(t, wsNextMsg, msg.Type)
+		assert.Equal(t, "2", msg.ID)
+		assert.JSONEq(t, `{"data": {"setTest": "updated"}}`, string(msg.Payload))
+		assert.Equal(t, wsCompleteMsg, readWSMessage(t, conn).Type)
+	})
+
+	t.Run("returns validation errors", func(t *testing.T) {
+		conn := dialGraphqlTransportWS(t, gateway)
+
+		require.NoError(t, conn.WriteJSON(wsMessage{Type: wsConnectionInitMsg}))
+		assert.Equal(t, wsConnectionAckMsg, readWSMessage(t, conn).Type)
+
+		require.NoError(t, conn.WriteJSON(wsMessage{ID: "1", Type: wsSubscribeMsg, Payload: json.RawMessage(`{"query": "{ unknown }"}`)}))
+		msg := readWSMessage(t, conn)
+		assert.Equal(t, wsErrorMsg, msg.Type)
+		assert.Contains(t, string(msg.Payload), "Cannot query field")
+	})
+
+	t.Run("closes the connection when subscribing before init", func(t *testing.T) {
+		conn := dialGraphqlTransportWS(t, gateway)
+
+		require.NoError(t, conn.WriteJSON(wsMessage{ID: "1", Type: wsSubscribeMsg, Payload: json.RawMessage(`{"query": "{ test }"}`)}))
+		_, _, err := conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, wsCloseUnauthorized))
+	})
+
+	t.Run("closes the connection on duplicate init", func(t *testing.T) {
+		conn := dialGraphqlTransportWS(t, gateway)
+
+		require.NoError(t, conn.WriteJSON(wsMessage{Type: wsConnectionInitMsg}))
+		assert.Equal(t, wsConnectionAckMsg, readWSMessage(t, conn).Type)
+		require.NoError(t, conn.WriteJSON(wsMessage{Type: wsConnectionInitMsg}))
+		_, _, err := conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, wsCloseTooManyInitRequests))
+	})
+}